@@ -6,11 +6,13 @@
 package main
 
 import (
+	"context"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/key"
 	"flowsilicon/internal/logger"
-	"flowsilicon/internal/model"
+	"flowsilicon/internal/mockupstream"
 	"flowsilicon/internal/web"
+	"flowsilicon/pkg/utils"
 	"fmt"
 	"os"
 	"os/exec"
@@ -19,13 +21,13 @@ import (
 	"strings"
 	"syscall"
 	"time"
-
-	"github.com/gin-gonic/gin"
 )
 
 var (
 	// 全局变量，用于存储服务器端口
 	serverPort int
+	// HTTP服务，退出和重启时等待正在处理的请求完成
+	httpServer *web.Server
 	// 版本号
 	Version = "1.3.9"
 	// 程序所在目录
@@ -48,12 +50,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	// 数据库不可用时使用程序的构建版本号
+	config.SetBuildVersion(Version)
+
 	logger.Info("程序以控制台模式启动，日志同时写入控制台和文件")
 	logger.Info("程序运行目录: %s", executableDir)
 	// 添加更多路径信息用于调试
 	logger.Info("日志目录绝对路径: %s", getAbsolutePath("logs"))
 	logger.Info("当前工作目录: %s", getCurrentDir())
 
+	// 检查程序目录，在初始化数据库前提示可能导致日志和数据库写入失败的部署问题
+	for _, warning := range utils.ValidateExecutableDir(executableDir) {
+		logger.Warn("启动检查: %s", warning)
+	}
+
 	// 确保必要的目录结构存在
 	if err := ensureDirectoriesExist(); err != nil {
 		logger.Error("确保目录结构存在时出错: %v", err)
@@ -61,91 +71,38 @@ func main() {
 		logger.Info("已确保必要的目录结构存在")
 	}
 
-	// 初始化配置数据库
-	dbPath := getAbsolutePath("data/config.db")
-	err = config.InitConfigDB(dbPath)
-	if err != nil {
-		logger.Error("初始化配置数据库失败: %v", err)
-		os.Exit(1)
-	}
-	logger.Info("配置数据库初始化成功: %s", dbPath)
-
-	// 初始化模型数据库
-	err = model.InitModelDB(dbPath)
-	if err != nil {
-		logger.Error("初始化模型数据库失败: %v", err)
-		// 不退出程序，因为这不是致命错误
-	} else {
-		logger.Info("模型数据库初始化成功: %s", dbPath)
-	}
-
-	// 将当前版本号保存到数据库中
-	// 确保版本号格式一致 (添加v前缀如果不存在)
-	versionToSave := Version
-	if !strings.HasPrefix(versionToSave, "v") {
-		versionToSave = "v" + versionToSave
-	}
-	err = config.SaveVersion(versionToSave)
-	if err != nil {
-		logger.Error("保存版本号到数据库失败: %v", err)
-	} else {
-		logger.Info("版本号 '%s' 已保存到数据库", versionToSave)
-	}
-
-	// 检查并插入默认配置
-	err = config.EnsureDefaultConfig(dbPath)
-	if err != nil {
-		logger.Error("确保默认配置失败: %v", err)
-		return
-	}
-
-	// 确保apikeys表存在
-	err = config.EnsureApikeys(dbPath)
-	if err != nil {
-		logger.Error("创建apikeys表失败: %v", err)
-		// 继续执行，因为这不是致命错误
-	} else {
-		logger.Info("确保API密钥表存在成功")
+	// 使用--restore参数时，先将数据归档恢复到数据目录，再按正常流程打开数据库并执行迁移
+	if archivePath, force := config.ParseRestoreFlag(os.Args[1:]); archivePath != "" {
+		if _, err := config.RestoreDataArchive(archivePath, getAbsolutePath("data"), force); err != nil {
+			logger.Error("恢复数据归档失败: %v", err)
+			os.Exit(1)
+		}
 	}
 
-	// 设置数据文件路径
-	config.SetDailyFilePath(getAbsolutePath("data/daily.json"))
-
-	// 初始化每日统计数据
-	if err := config.InitDailyStats(); err != nil {
-		logger.Error("初始化每日统计数据失败: %v", err)
-		// 继续执行，因为这不是致命错误
-	} else {
-		logger.Info("每日统计数据初始化成功")
+	// 启用模拟上游时，所有上游请求都发往本机的模拟服务，不会消耗真实额度
+	var upstreamURL string
+	if mockAddr, enabled := mockupstream.ParseFlag(os.Args[1:]); enabled {
+		mockURL, err := mockupstream.NewServer().Start(mockAddr)
+		if err != nil {
+			logger.Error("启动模拟上游失败: %v", err)
+			os.Exit(1)
+		}
+		upstreamURL = mockURL
 	}
 
-	// 加载配置
-	cfg, err := config.LoadConfigFromDB()
+	// 初始化数据库、配置和API密钥并创建路由
+	// 副本实例使用--read-only参数以只读方式打开共享的配置数据库
+	handler, shutdowner, err := web.NewHandler(web.Options{
+		DataDir:     getAbsolutePath("data"),
+		Version:     Version,
+		ReadOnly:    config.ParseReadOnlyFlag(os.Args[1:]),
+		UpstreamURL: upstreamURL,
+	})
 	if err != nil {
-		logger.Error("从数据库加载配置失败: %v", err)
-		return
-	}
-
-	// 确保cfg不为nil后再使用
-	if cfg == nil {
-		logger.Error("配置加载后为空")
-		return
-	}
-
-	// 获取数据库中的版本号，并更新应用标题
-	dbVersion := config.GetVersion()
-	if dbVersion != "" {
-		// 确保版本号格式一致
-		if !strings.HasPrefix(dbVersion, "v") {
-			dbVersion = "v" + dbVersion
-		}
-		// 更新App.Title中的版本号
-		cfg.App.Title = fmt.Sprintf("流动硅基 FlowSilicon %s", dbVersion)
-		// 保存回数据库
-		config.UpdateConfig(cfg)
-		config.SaveConfigToDB()
-		logger.Info("已从数据库更新应用标题为: %s", cfg.App.Title)
+		logger.Error("初始化服务失败: %v", err)
+		os.Exit(1)
 	}
+	cfg := config.GetConfig()
 
 	// 添加调试信息
 	logger.Info("配置值 - AutoUpdateInterval: %d, StatsRefreshInterval: %d, RateRefreshInterval: %d",
@@ -167,62 +124,43 @@ func main() {
 		}
 		logger.SetLogLevel(logLevel)
 
+		// GUI模式下按配置同时输出到标准输出
+		logger.SetMultiOutput(cfg.Log.MultiOutput)
+
+		// 归档日志的保留数量
+		logger.SetLogFileLimits(cfg.Log.MaxFiles, cfg.Log.MinFiles)
+
 		// 手动触发一次日志清理，使用更长的延时确保系统完全初始化
 		// 避免在启动流程中太早清理日志造成问题
 		time.Sleep(5 * time.Second)
-		logger.CleanLogsNow()
+		logger.CleanLogsNow(cfg.Log.MinFiles)
 
 		// 输出确认信息
 		logger.Info("日志清理任务已在后台启动，日志等级设置为：%s", logLevel)
 	}()
 
-	// 加载API密钥
-	if err := config.LoadApiKeysFromDB(); err != nil {
-		logger.Error("加载API密钥失败: %v", err)
-		// 继续执行，因为这不是致命错误
-	} else {
-		logger.Info("API密钥加载成功")
-
-		// 强制刷新所有API密钥的余额
-		if refreshErr := key.ForceRefreshAllKeysBalance(); refreshErr != nil {
-			logger.Error("刷新API密钥余额失败: %v", refreshErr)
-		} else {
-			logger.Info("已完成API密钥余额的强制刷新")
-		}
-	}
-
-	// 启动API密钥管理器
-	key.StartKeyManager()
-	logger.Info("API密钥管理器已启动")
-
 	// 输出模型策略配置
 	logModelStrategies()
 
-	// 创建Gin路由
-	router := gin.Default()
-	// 设置受信任的代理
-	router.SetTrustedProxies([]string{"127.0.0.1", "::1"})
-
-	// 设置API代理
-	web.SetupApiProxy(router)
-
-	// 设置API密钥管理
-	web.SetupKeysAPI(router)
-
-	// 设置Web界面
-	web.SetupWebServer(router)
-
-	// 保存端口到全局变量
+	// 保存端口到全局变量，允许端口回退时首选端口被占用则使用后续可用端口
 	serverPort = cfg.Server.Port
+	if cfg.Server.AllowPortFallback {
+		serverPort = utils.FindAvailablePort(cfg.Server.Port)
+		if serverPort != cfg.Server.Port {
+			logger.Warn("端口 %d 已被占用，改用端口 %d", cfg.Server.Port, serverPort)
+		}
+	}
+	logger.Info("服务器使用端口: %d", serverPort)
 
 	// 创建一个通道来接收信号
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// 在goroutine中启动服务器
+	// 在goroutine中启动服务器，退出和重启时通过httpServer等待正在处理的请求完成
+	httpServer = web.NewServer(serverPort, handler, shutdowner)
 	go func() {
 		logger.Info("服务器启动在 :%d", serverPort)
-		if err := router.Run(fmt.Sprintf(":%d", serverPort)); err != nil {
+		if err := httpServer.ListenAndServe(); err != nil {
 			logger.Error("服务器启动失败: %v", err)
 			os.Exit(1)
 		}
@@ -241,29 +179,9 @@ func main() {
 	// 确保所有资源被正确关闭
 	logger.Info("正在关闭所有资源...")
 
-	// 停止API密钥管理器定时任务
-	key.StopKeyManager()
-	logger.Info("API密钥管理器已停止")
-
-	// 保存API密钥
-	if err := config.SaveApiKeys(); err != nil {
-		logger.Error("保存API密钥失败: %v", err)
-	} else {
-		logger.Info("API密钥已保存")
-	}
-
-	// 关闭配置数据库连接
-	if err := config.CloseConfigDB(); err != nil {
-		logger.Error("关闭配置数据库连接失败: %v", err)
-	} else {
-		logger.Info("配置数据库已关闭")
-	}
-
-	// 关闭模型数据库连接
-	if err := model.CloseModelDB(); err != nil {
-		logger.Error("关闭模型数据库连接失败: %v", err)
-	} else {
-		logger.Info("模型数据库已关闭")
+	// 等待正在处理的请求完成后停止后台任务，保存密钥池快照和API密钥后关闭数据库
+	if err := httpServer.Shutdown(context.Background()); err != nil {
+		logger.Error("关闭服务失败: %v", err)
 	}
 
 	// 关闭日志系统
@@ -355,36 +273,20 @@ func ensureDirectoriesExist() error {
 // logModelStrategies 输出所有已配置的模型策略
 func logModelStrategies() {
 	cfg := config.GetConfig()
+	issues := key.ValidateModelRules(cfg)
 
-	if len(cfg.App.ModelKeyStrategies) == 0 {
+	if len(cfg.App.ModelKeyStrategies) == 0 && len(issues) == 0 {
 		logger.Info("未配置任何模型特定策略")
 		return
 	}
 
 	logger.Info("===== 模型特定策略配置 =====")
 	for model, strategyID := range cfg.App.ModelKeyStrategies {
-		var strategyName string
-		switch strategyID {
-		case 1:
-			strategyName = "高成功率"
-		case 2:
-			strategyName = "高分数"
-		case 3:
-			strategyName = "低RPM"
-		case 4:
-			strategyName = "低TPM"
-		case 5:
-			strategyName = "高余额"
-		case 6:
-			strategyName = "普通"
-		case 7:
-			strategyName = "低余额"
-		case 8:
-			strategyName = "免费"
-		default:
-			strategyName = "普通"
-		}
-		logger.Info("模型: %s, 策略: %s (%d)", model, strategyName, strategyID)
+		logger.Info("模型: %s, 策略: %s (%d)", model, key.GetStrategyName(strategyID), strategyID)
+	}
+	// 无效的策略ID、不存在的模型和冲突的规则以警告输出，默认日志等级下也可见
+	for _, issue := range issues {
+		logger.Warn("模型配置问题: %s", issue.Message)
 	}
 	logger.Info("==========================")
 }
@@ -413,7 +315,8 @@ func reloadConfig() {
 		if !strings.HasPrefix(dbVersion, "v") {
 			dbVersion = "v" + dbVersion
 		}
-		// 更新App.Title中的版本号
+		// 更新App.Title中的版本号，加载的配置已经发布，在副本上修改
+		cfg = cfg.Clone()
 		cfg.App.Title = fmt.Sprintf("流动硅基 FlowSilicon %s", dbVersion)
 		logger.Info("已从数据库更新应用标题为: %s", cfg.App.Title)
 	}
@@ -421,8 +324,7 @@ func reloadConfig() {
 	// 更新全局配置
 	config.UpdateConfig(cfg)
 
-	// 更新服务器端口
-	serverPort = cfg.Server.Port
+	// 服务器不会重新监听，端口保持启动时实际使用的端口
 
 	// 将更新后的配置保存回数据库
 	err = config.SaveConfigToDB()
@@ -458,13 +360,18 @@ func restartProgram() {
 	// 获取当前命令行参数，排除第一个(程序路径)
 	args := os.Args
 	if len(args) > 1 {
-		args = args[1:]
+		args = config.StripRestoreFlags(args[1:])
 	} else {
 		args = []string{} // 确保args不为nil
 	}
 
 	logger.Info("准备重启程序: 路径=%s, 工作目录=%s, 参数=%v", execPath, workDir, args)
 
+	// 等待正在处理的请求完成并关闭端口，保存API密钥后关闭数据库，新进程启动时端口和数据库已释放
+	if err := httpServer.Shutdown(context.Background()); err != nil {
+		logger.Error("重启前关闭服务失败: %v", err)
+	}
+
 	// 创建新进程
 	cmd := exec.Command(execPath, args...)
 	cmd.Dir = workDir
@@ -475,11 +382,12 @@ func restartProgram() {
 	cmd.Stdout = nil
 	cmd.Stderr = nil
 
-	// 启动新进程
+	// 启动新进程，服务已关闭，启动失败时当前进程也退出
 	err = cmd.Start()
 	if err != nil {
 		logger.Error("启动新进程失败: %v", err)
-		return
+		logger.CloseLogger()
+		os.Exit(1)
 	}
 
 	// 从父进程中分离子进程
@@ -490,12 +398,7 @@ func restartProgram() {
 
 	logger.Info("新进程已启动(PID: %d)，当前进程将退出", cmd.Process.Pid)
 
-	// 保存必要的数据
-	logger.Info("正在保存重要数据...")
-	config.SaveApiKeys()
-	config.CloseConfigDB()
-
-	// 需要延迟一小段时间确保数据保存和日志写入完成
+	// 需要延迟一小段时间确保日志写入完成
 	time.Sleep(500 * time.Millisecond)
 
 	// 退出当前进程
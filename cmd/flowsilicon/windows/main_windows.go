@@ -6,11 +6,14 @@
 package main
 
 import (
+	"context"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/key"
 	"flowsilicon/internal/logger"
-	"flowsilicon/internal/model"
+	"flowsilicon/internal/mockupstream"
+	"flowsilicon/internal/notify"
 	"flowsilicon/internal/web"
+	"flowsilicon/pkg/utils"
 	"fmt"
 	"os"
 	"os/exec"
@@ -22,12 +25,13 @@ import (
 	"time"
 
 	"github.com/getlantern/systray"
-	"github.com/gin-gonic/gin"
 )
 
 var (
 	// 全局变量，用于存储服务器端口
 	serverPort int
+	// HTTP服务，退出和重启时等待正在处理的请求完成
+	httpServer *web.Server
 	// 版本号
 	Version = "1.3.9"
 	// 控制程序退出的通道
@@ -56,6 +60,9 @@ func main() {
 	// 初始化日志
 	logger.InitLogger()
 
+	// 数据库不可用时使用程序的构建版本号
+	config.SetBuildVersion(Version)
+
 	// 记录启动模式
 	if isGui {
 		logger.Info("程序以GUI模式启动，日志仅写入文件")
@@ -68,6 +75,11 @@ func main() {
 	logger.Info("日志目录绝对路径: %s", getAbsolutePath("logs"))
 	logger.Info("当前工作目录: %s", getCurrentDir())
 
+	// 检查程序目录，在初始化数据库前提示可能导致日志和数据库写入失败的部署问题
+	for _, warning := range utils.ValidateExecutableDir(executableDir) {
+		logger.Warn("启动检查: %s", warning)
+	}
+
 	// 确保必要的目录结构存在
 	if err = ensureDirectoriesExist(); err != nil {
 		logger.Error("确保目录结构存在时出错: %v", err)
@@ -75,108 +87,38 @@ func main() {
 		logger.Info("已确保必要的目录结构存在")
 	}
 
-	// 初始化配置数据库
-	dbPath := getAbsolutePath("data/config.db")
-	err = config.InitConfigDB(dbPath)
-	if err != nil {
-		logger.Error("初始化配置数据库失败: %v", err)
-		os.Exit(1)
-	}
-	logger.Info("配置数据库初始化成功: %s", dbPath)
-
-	// 初始化模型数据库
-	err = model.InitModelDB(dbPath)
-	if err != nil {
-		logger.Error("初始化模型数据库失败: %v", err)
-		// 不退出程序，因为这不是致命错误
-	} else {
-		logger.Info("模型数据库初始化成功: %s", dbPath)
-	}
-
-	// 将当前版本号保存到数据库中
-	// 确保版本号格式一致 (添加v前缀如果不存在)
-	versionToSave := Version
-	if !strings.HasPrefix(versionToSave, "v") {
-		versionToSave = "v" + versionToSave
-	}
-	err = config.SaveVersion(versionToSave)
-	if err != nil {
-		logger.Error("保存版本号到数据库失败: %v", err)
-	} else {
-		logger.Info("版本号 '%s' 已保存到数据库", versionToSave)
-	}
-
-	// 检查配置是否存在，如果不存在则插入默认配置
-	err = config.EnsureDefaultConfig(dbPath)
-	if err != nil {
-		logger.Error("确保默认配置失败: %v", err)
-		return
-	}
-
-	// 确保API密钥表存在
-	err = config.EnsureApikeys(dbPath)
-	if err != nil {
-		logger.Error("确保API密钥表存在失败: %v", err)
-		// 继续执行，因为这不是致命错误
-	} else {
-		logger.Info("确保API密钥表存在成功")
-	}
-
-	// 设置数据文件路径
-	config.SetDailyFilePath(getAbsolutePath("data/daily.json"))
-
-	// 确保初始化每日统计数据
-	err = config.InitDailyStats()
-	if err != nil {
-		logger.Error("初始化每日统计数据失败: %v", err)
-		// 继续执行，因为这不是致命错误
-	} else {
-		logger.Info("每日统计数据初始化成功")
-	}
-
-	// 加载配置
-	cfg, err := config.LoadConfigFromDB()
-	if err != nil {
-		logger.Error("从数据库加载配置失败: %v", err)
-		return
-	}
-
-	// 确保appConfig不为nil后再使用
-	if cfg == nil {
-		logger.Error("配置加载后为空")
-		return
+	// 使用--restore参数时，先将数据归档恢复到数据目录，再按正常流程打开数据库并执行迁移
+	if archivePath, force := config.ParseRestoreFlag(os.Args[1:]); archivePath != "" {
+		if _, err := config.RestoreDataArchive(archivePath, getAbsolutePath("data"), force); err != nil {
+			logger.Error("恢复数据归档失败: %v", err)
+			os.Exit(1)
+		}
 	}
 
-	// 获取数据库中的版本号，并更新应用标题
-	dbVersion := config.GetVersion()
-	if dbVersion != "" {
-		// 确保版本号格式一致
-		if !strings.HasPrefix(dbVersion, "v") {
-			dbVersion = "v" + dbVersion
+	// 启用模拟上游时，所有上游请求都发往本机的模拟服务，不会消耗真实额度
+	var upstreamURL string
+	if mockAddr, enabled := mockupstream.ParseFlag(os.Args[1:]); enabled {
+		mockURL, err := mockupstream.NewServer().Start(mockAddr)
+		if err != nil {
+			logger.Error("启动模拟上游失败: %v", err)
+			os.Exit(1)
 		}
-		// 更新App.Title中的版本号
-		cfg.App.Title = fmt.Sprintf("流动硅基 FlowSilicon %s", dbVersion)
-		// 保存回数据库
-		config.UpdateConfig(cfg)
-		config.SaveConfigToDB()
-		logger.Info("已从数据库更新应用标题为: %s", cfg.App.Title)
+		upstreamURL = mockURL
 	}
 
-	// 加载API密钥
-	err = config.LoadApiKeys()
+	// 初始化数据库、配置和API密钥并创建路由
+	// 副本实例使用--read-only参数以只读方式打开共享的配置数据库
+	handler, shutdowner, err := web.NewHandler(web.Options{
+		DataDir:     getAbsolutePath("data"),
+		Version:     Version,
+		ReadOnly:    config.ParseReadOnlyFlag(os.Args[1:]),
+		UpstreamURL: upstreamURL,
+	})
 	if err != nil {
-		logger.Error("从数据库加载API密钥失败: %v", err)
-		// 继续执行，因为这不是致命错误
-	} else {
-		logger.Info("已成功从数据库加载API密钥")
-
-		// 强制刷新所有API密钥的余额
-		if refreshErr := key.ForceRefreshAllKeysBalance(); refreshErr != nil {
-			logger.Error("刷新API密钥余额失败: %v", refreshErr)
-		} else {
-			logger.Info("已完成API密钥余额的强制刷新")
-		}
+		logger.Error("初始化服务失败: %v", err)
+		os.Exit(1)
 	}
+	cfg := config.GetConfig()
 
 	// 添加调试信息
 	logger.Info("配置值 - AutoUpdateInterval: %d, StatsRefreshInterval: %d, RateRefreshInterval: %d",
@@ -198,47 +140,43 @@ func main() {
 		}
 		logger.SetLogLevel(logLevel)
 
+		// GUI模式下按配置同时输出到标准输出
+		logger.SetMultiOutput(cfg.Log.MultiOutput)
+
+		// 归档日志的保留数量
+		logger.SetLogFileLimits(cfg.Log.MaxFiles, cfg.Log.MinFiles)
+
 		// 手动触发一次日志清理，使用更长的延时确保系统完全初始化
 		// 避免在启动流程中太早清理日志造成问题
 		time.Sleep(5 * time.Second)
-		logger.CleanLogsNow()
+		logger.CleanLogsNow(cfg.Log.MinFiles)
 
 		// 输出确认信息
 		logger.Info("日志清理任务已在后台启动，日志等级设置为：%s", logLevel)
 	}()
 
-	// 启动API密钥管理器
-	key.StartKeyManager()
-	logger.Info("API密钥管理器已启动")
-
 	// 输出模型策略配置
 	logModelStrategies()
 
-	// 创建Gin路由
-	router := gin.Default()
-	// 设置受信任的代理
-	router.SetTrustedProxies([]string{"127.0.0.1", "::1"})
-
-	// 设置API代理
-	web.SetupApiProxy(router)
-
-	// 设置API密钥管理
-	web.SetupKeysAPI(router)
-
-	// 设置Web界面
-	web.SetupWebServer(router)
-
-	// 保存端口到全局变量
+	// 保存端口到全局变量，允许端口回退时首选端口被占用则使用后续可用端口
 	serverPort = cfg.Server.Port
+	if cfg.Server.AllowPortFallback {
+		serverPort = utils.FindAvailablePort(cfg.Server.Port)
+		if serverPort != cfg.Server.Port {
+			logger.Warn("端口 %d 已被占用，改用端口 %d", cfg.Server.Port, serverPort)
+		}
+	}
+	logger.Info("服务器使用端口: %d", serverPort)
 
 	// 创建一个通道来接收信号
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// 在goroutine中启动服务器
+	// 在goroutine中启动服务器，退出和重启时通过httpServer等待正在处理的请求完成
+	httpServer = web.NewServer(serverPort, handler, shutdowner)
 	go func() {
 		logger.Info("服务器启动在 :%d", serverPort)
-		if err := router.Run(fmt.Sprintf(":%d", serverPort)); err != nil {
+		if err := httpServer.ListenAndServe(); err != nil {
 			logger.Error("服务器启动失败: %v", err)
 			os.Exit(1)
 		}
@@ -264,35 +202,9 @@ func main() {
 	// 确保所有资源被正确关闭
 	logger.Info("正在关闭所有资源...")
 
-	// 停止API密钥管理器定时任务
-	key.StopKeyManager()
-	logger.Info("API密钥管理器已停止")
-
-	// 检查数据库连接状态
-	isDBClosed := false
-	if err := config.DB().Ping(); err != nil {
-		// 将警告日志改为信息日志，数据库关闭是预期的行为
-		logger.Info("主程序退出时数据库已关闭，这是正常的")
-		isDBClosed = true
-	}
-
-	// 只有在数据库仍然开启时才保存API密钥和关闭数据库
-	if !isDBClosed {
-		// 保存API密钥
-		if err := config.SaveApiKeys(); err != nil {
-			logger.Error("保存API密钥失败: %v", err)
-		} else {
-			logger.Info("API密钥已保存")
-		}
-
-		// 关闭配置数据库连接
-		if err := config.CloseConfigDB(); err != nil {
-			logger.Error("关闭配置数据库连接失败: %v", err)
-		} else {
-			logger.Info("配置数据库已关闭")
-		}
-	} else {
-		logger.Info("数据库已关闭，跳过主程序退出时保存API密钥和关闭数据库步骤")
+	// 等待正在处理的请求完成后停止后台任务，保存密钥池快照和API密钥后关闭数据库
+	if err := httpServer.Shutdown(context.Background()); err != nil {
+		logger.Error("关闭服务失败: %v", err)
 	}
 
 	// 关闭日志系统
@@ -368,69 +280,12 @@ func ensureDirectoriesExist() error {
 
 // 系统托盘初始化
 func onReady() {
-	var iconLoaded bool
-
-	// 尝试从嵌入式文件系统加载图标
-	icon32Path := "static/img/favicon_32.ico"
-	icon128Path := "static/img/favicon_128.ico"
-
-	// 首先尝试加载32x32图标
-	icon32Data, err := web.GetEmbeddedFile(icon32Path)
-	if err == nil && len(icon32Data) > 0 {
-		systray.SetIcon(icon32Data)
-		iconLoaded = true
-		logger.Info("成功从嵌入式文件系统加载32x32图标")
+	// 加载系统托盘图标，程序目录下的internal/web中存在的图标优先于嵌入式资源
+	web.SetAssetOverrideDir(getAbsolutePath("internal/web"))
+	if iconData, err := web.GetTrayIcon(); err == nil {
+		systray.SetIcon(iconData)
 	} else {
-		logger.Warn("从嵌入式文件系统加载32x32图标失败: %v", err)
-
-		// 尝试从物理文件系统加载（作为备用）
-		iconPath := getAbsolutePath("internal/web/static/img/favicon_32.ico")
-		if _, err := os.Stat(iconPath); err == nil {
-			// 图标文件存在，读取图标
-			iconData, err := os.ReadFile(iconPath)
-			if err == nil {
-				systray.SetIcon(iconData)
-				iconLoaded = true
-				logger.Info("成功从物理文件系统加载32x32图标: %s", iconPath)
-			} else {
-				logger.Error("读取32x32图标文件失败: %v", err)
-			}
-		} else {
-			logger.Warn("找不到32x32图标文件: %s, 错误: %v", iconPath, err)
-		}
-	}
-
-	// 如果32x32图标加载失败，尝试加载128x128图标
-	if !iconLoaded {
-		// 尝试从嵌入式文件系统加载
-		icon128Data, err := web.GetEmbeddedFile(icon128Path)
-		if err == nil && len(icon128Data) > 0 {
-			systray.SetIcon(icon128Data)
-			iconLoaded = true
-			logger.Info("成功从嵌入式文件系统加载128x128图标")
-		} else {
-			logger.Warn("从嵌入式文件系统加载128x128图标失败: %v", err)
-
-			// 尝试从物理文件系统加载（作为备用）
-			iconPath := getAbsolutePath("internal/web/static/img/favicon_128.ico")
-			if _, err := os.Stat(iconPath); err == nil {
-				// 图标文件存在，读取图标
-				iconData, err := os.ReadFile(iconPath)
-				if err == nil {
-					systray.SetIcon(iconData)
-					iconLoaded = true
-					logger.Info("成功从物理文件系统加载128x128图标: %s", iconPath)
-				} else {
-					logger.Error("读取128x128图标文件失败: %v", err)
-				}
-			} else {
-				logger.Error("找不到128x128图标文件: %s, 错误: %v", iconPath, err)
-			}
-		}
-	}
-
-	if !iconLoaded {
-		logger.Error("无法加载任何系统托盘图标，托盘图标将显示为默认图标")
+		logger.Error("无法加载任何系统托盘图标，托盘图标将显示为默认图标: %v", err)
 	}
 
 	// 获取版本号
@@ -446,15 +301,25 @@ func onReady() {
 
 	// 正常显示图标和标题
 	systray.SetTitle("流动硅基")
-	systray.SetTooltip("流动硅基 FlowSilicon " + dbVersion)
+	tooltip := fmt.Sprintf("流动硅基 FlowSilicon %s（端口 %d）", dbVersion, serverPort)
+	// 托盘提示文字长度有限，详细说明见日志和仪表盘
+	if status := config.GetDataVersionStatus(); status.ReadOnly {
+		tooltip += fmt.Sprintf("（只读维护模式：数据版本 %s）", status.DataVersion)
+	}
+	systray.SetTooltip(tooltip)
 
 	// 添加菜单项
 	mOpen := systray.AddMenuItem("打开界面", "打开Web界面")
+	mErrorLogs := systray.AddMenuItem("错误日志", "在Web界面中查看错误日志")
+	mTestNotify := systray.AddMenuItem("测试通知", "显示一条测试用的桌面通知")
 	systray.AddSeparator()
 
 	// 新增重启程序菜单项
 	mRestart := systray.AddMenuItem("重启程序", "重新启动程序")
 
+	// 紧急轮换凭据菜单项，在设置页面中确认后执行
+	mPanic := systray.AddMenuItem("紧急轮换凭据", "吊销所有客户端令牌并更换对外暴露的凭据")
+
 	// 新增开机自启菜单项
 	mAutoStart := systray.AddMenuItem("开机自启", "设置或取消开机自启")
 	// 检查当前开机自启状态并设置选中状态
@@ -471,7 +336,21 @@ func onReady() {
 			select {
 			case <-mOpen.ClickedCh:
 				// 打开Web界面
-				openBrowser(fmt.Sprintf("http://localhost:%d", serverPort))
+				openBrowser(web.DeepLinkURL(serverPort, "/"))
+			case <-mErrorLogs.ClickedCh:
+				// 打开过滤为错误等级的日志
+				openBrowser(web.DeepLinkURL(serverPort, web.LogsPath("error")))
+			case <-mTestNotify.ClickedCh:
+				// 显示测试通知，失败原因已记录到日志，不阻塞菜单响应
+				go func() {
+					if err := notify.SendDesktopTest(); err == nil {
+						logger.Info("已显示测试通知")
+					}
+				}()
+			case <-mPanic.ClickedCh:
+				// 打开设置页面的确认流程，需要输入确认短语后才会执行
+				logger.Info("用户通过托盘菜单请求紧急轮换凭据")
+				openBrowser(web.DeepLinkURL(serverPort, "/setting?panic=1"))
 			case <-mRestart.ClickedCh:
 				// 重启程序
 				logger.Info("用户通过托盘菜单请求重启程序")
@@ -502,42 +381,7 @@ func onReady() {
 func onExit() {
 	// 如果是真正的退出请求，则退出程序
 	if realQuit {
-		// 检查数据库连接状态，避免重复关闭问题
-		isDBClosed := false
-		if err := config.DB().Ping(); err != nil {
-			// 将警告日志改为信息日志，数据库关闭是预期的行为
-			logger.Info("系统托盘退出时数据库已关闭，这是正常的")
-			isDBClosed = true
-		}
-
-		// 只有在数据库仍然开启时才保存API密钥
-		if !isDBClosed {
-			// 先保存API密钥 - 在关闭数据库之前执行
-			if err := config.SaveApiKeys(); err != nil {
-				logger.Error("退出程序时保存API密钥失败: %v", err)
-			} else {
-				logger.Info("API密钥已成功保存")
-			}
-
-			// 关闭数据库连接
-			if err := config.CloseConfigDB(); err != nil {
-				logger.Error("关闭配置数据库失败: %v", err)
-			} else {
-				logger.Info("配置数据库已成功关闭")
-			}
-
-			// 关闭模型数据库
-			if err := model.CloseModelDB(); err != nil {
-				logger.Error("关闭模型数据库失败: %v", err)
-			} else {
-				logger.Info("模型数据库已成功关闭")
-			}
-		} else {
-			logger.Info("数据库已关闭，跳过保存API密钥和关闭数据库步骤")
-		}
-
-		logger.Info("程序已退出")
-		// 关闭退出通道，通知主程序退出
+		// 关闭退出通道，主程序等待正在处理的请求完成后保存API密钥并关闭数据库
 		close(quitChan)
 	} else {
 		// 如果不是真正退出，只是重启systray（比如在隐藏/显示图标时）
@@ -564,36 +408,20 @@ func isConsolePresent() bool {
 // logModelStrategies 输出所有已配置的模型策略
 func logModelStrategies() {
 	cfg := config.GetConfig()
+	issues := key.ValidateModelRules(cfg)
 
-	if len(cfg.App.ModelKeyStrategies) == 0 {
+	if len(cfg.App.ModelKeyStrategies) == 0 && len(issues) == 0 {
 		logger.Info("未配置任何模型特定策略")
 		return
 	}
 
 	logger.Info("===== 模型特定策略配置 =====")
 	for model, strategyID := range cfg.App.ModelKeyStrategies {
-		var strategyName string
-		switch strategyID {
-		case 1:
-			strategyName = "高成功率"
-		case 2:
-			strategyName = "高分数"
-		case 3:
-			strategyName = "低RPM"
-		case 4:
-			strategyName = "低TPM"
-		case 5:
-			strategyName = "高余额"
-		case 6:
-			strategyName = "普通"
-		case 7:
-			strategyName = "低余额"
-		case 8:
-			strategyName = "免费"
-		default:
-			strategyName = "普通"
-		}
-		logger.Info("模型: %s, 策略: %s (%d)", model, strategyName, strategyID)
+		logger.Info("模型: %s, 策略: %s (%d)", model, key.GetStrategyName(strategyID), strategyID)
+	}
+	// 无效的策略ID、不存在的模型和冲突的规则以警告输出，默认日志等级下也可见
+	for _, issue := range issues {
+		logger.Warn("模型配置问题: %s", issue.Message)
 	}
 	logger.Info("==========================")
 }
@@ -702,12 +530,17 @@ func restartProgram() {
 	// 获取当前命令行参数，排除第一个(程序路径)
 	args := []string{}
 	if len(os.Args) > 1 {
-		args = os.Args[1:]
+		args = config.StripRestoreFlags(os.Args[1:])
 	}
 
 	// 记录重启前的命令行参数
 	logger.Info("重启程序，当前命令行参数: %v", args)
 
+	// 等待正在处理的请求完成并关闭端口，保存API密钥后关闭数据库，新进程启动时端口和数据库已释放
+	if err := httpServer.Shutdown(context.Background()); err != nil {
+		logger.Error("重启前关闭服务失败: %v", err)
+	}
+
 	// 创建新的进程
 	cmd := exec.Command(execPath, args...)
 
@@ -732,7 +565,10 @@ func restartProgram() {
 	// 启动新进程
 	err = cmd.Start()
 	if err != nil {
+		// 服务已关闭，启动失败时当前进程也退出
 		logger.Error("重启程序失败: %v", err)
+		realQuit = true
+		systray.Quit()
 		return
 	}
 
@@ -741,27 +577,6 @@ func restartProgram() {
 
 	// 设置退出标志并请求程序退出
 	logger.Info("当前程序将在重启成功后退出")
-
-	// 检查数据库连接状态
-	isDBClosed := false
-	if err := config.DB().Ping(); err != nil {
-		// 将警告日志改为信息日志，数据库关闭是预期的行为
-		logger.Info("重启程序时数据库已关闭，这是正常的")
-		isDBClosed = true
-	}
-
-	// 只有在数据库仍然开启时才保存API密钥
-	if !isDBClosed {
-		if err := config.SaveApiKeys(); err != nil {
-			logger.Error("重启前保存API密钥失败: %v", err)
-		} else {
-			logger.Info("重启前已成功保存API密钥")
-		}
-	} else {
-		logger.Info("数据库已关闭，跳过重启前保存API密钥步骤")
-	}
-
-	// 设置真正退出标志并请求退出
 	realQuit = true
 	systray.Quit()
 }
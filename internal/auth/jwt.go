@@ -11,6 +11,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
+	"flowsilicon/internal/config"
 	"flowsilicon/internal/logger"
 	"fmt"
 	"strconv"
@@ -23,6 +24,14 @@ var (
 	secretKey = []byte("flowsilicon_default_secret_key")
 )
 
+// signingKey 获取签名密钥，配置中设置了会话签名密钥时使用配置的密钥，更换后之前签发的令牌全部失效
+func signingKey() []byte {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Security.SessionSecret != "" {
+		return []byte(cfg.Security.SessionSecret)
+	}
+	return secretKey
+}
+
 // GenerateToken 生成简单的认证Token
 // 格式: timestamp.expiration.signature
 // timestamp: 当前时间戳
@@ -41,7 +50,7 @@ func GenerateToken(expirationMinutes int) (string, error) {
 	data := fmt.Sprintf("%d.%d", now, expiration)
 
 	// 计算签名
-	h := hmac.New(sha256.New, secretKey)
+	h := hmac.New(sha256.New, signingKey())
 	h.Write([]byte(data))
 	signature := hex.EncodeToString(h.Sum(nil))
 
@@ -75,7 +84,7 @@ func ParseToken(tokenString string) (bool, error) {
 
 	// 验证签名
 	data := fmt.Sprintf("%d.%d", timestamp, expiration)
-	h := hmac.New(sha256.New, secretKey)
+	h := hmac.New(sha256.New, signingKey())
 	h.Write([]byte(data))
 	expectedSignature := hex.EncodeToString(h.Sum(nil))
 
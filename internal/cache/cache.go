@@ -0,0 +1,297 @@
+/**
+  @author: Hanhai
+  @desc: 有容量上限和过期时间的LRU缓存，所有缓存共享一个全局内存预算，并记录淘汰统计
+**/
+
+package cache
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 默认的全局内存预算
+const DefaultMemoryBudget int64 = 64 << 20
+
+// 未提供SizeOf时每个条目的估算开销（字节）
+const defaultEntryOverhead int64 = 64
+
+var (
+	// 全局内存预算（字节），0表示不限制
+	memoryBudget atomic.Int64
+	// 所有缓存当前估算占用的内存（字节）
+	totalBytes atomic.Int64
+
+	// 已创建的缓存，用于汇总统计信息
+	registry     = make(map[string]statsProvider)
+	registryLock sync.RWMutex
+)
+
+func init() {
+	memoryBudget.Store(DefaultMemoryBudget)
+}
+
+// Options 缓存配置
+type Options struct {
+	MaxEntries int           // 最大条目数，0表示只受全局内存预算限制
+	TTL        time.Duration // 条目过期时间，0表示不过期
+}
+
+// Stats 缓存统计信息
+type Stats struct {
+	Name        string `json:"name"`        // 缓存名称
+	Entries     int    `json:"entries"`     // 当前条目数
+	MaxEntries  int    `json:"max_entries"` // 最大条目数
+	Bytes       int64  `json:"bytes"`       // 估算占用的内存（字节）
+	Hits        uint64 `json:"hits"`        // 命中次数
+	Misses      uint64 `json:"misses"`      // 未命中次数
+	Evictions   uint64 `json:"evictions"`   // 因容量或内存预算被淘汰的条目数
+	Expirations uint64 `json:"expirations"` // 因过期被删除的条目数
+}
+
+// statsProvider 可以提供统计信息的缓存
+type statsProvider interface {
+	Stats() Stats
+}
+
+// entry 缓存条目
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	size      int64
+	expiresAt time.Time
+}
+
+// Cache 有容量上限和过期时间的LRU缓存，并发安全
+type Cache[K comparable, V any] struct {
+	name   string
+	opts   Options
+	sizeOf func(K, V) int64
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[K]*list.Element
+	bytes int64
+
+	hits        uint64
+	misses      uint64
+	evictions   uint64
+	expirations uint64
+}
+
+// New 创建缓存并注册到全局统计中，同名缓存会替换之前的注册
+// sizeOf用于估算条目占用的内存，为nil时按固定开销加字符串键的长度估算
+func New[K comparable, V any](name string, opts Options, sizeOf func(K, V) int64) *Cache[K, V] {
+	c := &Cache[K, V]{
+		name:   name,
+		opts:   opts,
+		sizeOf: sizeOf,
+		ll:     list.New(),
+		items:  make(map[K]*list.Element),
+	}
+
+	registryLock.Lock()
+	registry[name] = c
+	registryLock.Unlock()
+
+	return c
+}
+
+// Get 获取条目，已过期的条目视为不存在
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	elem, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return zero, false
+	}
+
+	e := elem.Value.(*entry[K, V])
+	if c.isExpired(e, time.Now()) {
+		c.removeElement(elem)
+		c.expirations++
+		c.misses++
+		return zero, false
+	}
+
+	c.ll.MoveToFront(elem)
+	c.hits++
+	return e.value, true
+}
+
+// Set 写入条目，超出条目数上限或全局内存预算时淘汰最久未使用的条目
+func (c *Cache[K, V]) Set(key K, value V) {
+	size := c.entrySize(key, value)
+
+	var expiresAt time.Time
+	if c.opts.TTL > 0 {
+		expiresAt = time.Now().Add(c.opts.TTL)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry[K, V])
+		c.addBytes(size - e.size)
+		e.value = value
+		e.size = size
+		e.expiresAt = expiresAt
+		c.ll.MoveToFront(elem)
+	} else {
+		elem := c.ll.PushFront(&entry[K, V]{key: key, value: value, size: size, expiresAt: expiresAt})
+		c.items[key] = elem
+		c.addBytes(size)
+	}
+
+	c.evictLocked()
+}
+
+// Delete 删除条目
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// Len 获取当前条目数，包括尚未清理的过期条目
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Range 按从新到旧的顺序遍历未过期的条目，fn返回false时停止遍历
+// 遍历期间持有缓存的锁，fn中不能再调用该缓存的方法
+func (c *Cache[K, V]) Range(fn func(K, V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for elem := c.ll.Front(); elem != nil; elem = elem.Next() {
+		e := elem.Value.(*entry[K, V])
+		if c.isExpired(e, now) {
+			continue
+		}
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// Stats 获取缓存统计信息
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Name:        c.name,
+		Entries:     c.ll.Len(),
+		MaxEntries:  c.opts.MaxEntries,
+		Bytes:       c.bytes,
+		Hits:        c.hits,
+		Misses:      c.misses,
+		Evictions:   c.evictions,
+		Expirations: c.expirations,
+	}
+}
+
+// evictLocked 清理过期条目，并淘汰最久未使用的条目直到满足条目数上限和全局内存预算（已加锁）
+// 只从最久未使用的一端清理连续的过期条目，避免每次写入都遍历整个缓存，其余过期条目在读取或淘汰时删除
+// 全局内存预算超出时只淘汰当前缓存的条目，至少保留刚写入的条目
+func (c *Cache[K, V]) evictLocked() {
+	if c.opts.TTL > 0 {
+		now := time.Now()
+		for elem := c.ll.Back(); elem != nil && c.isExpired(elem.Value.(*entry[K, V]), now); elem = c.ll.Back() {
+			c.removeElement(elem)
+			c.expirations++
+		}
+	}
+
+	for c.ll.Len() > 1 {
+		overEntries := c.opts.MaxEntries > 0 && c.ll.Len() > c.opts.MaxEntries
+		budget := memoryBudget.Load()
+		overBudget := budget > 0 && totalBytes.Load() > budget
+		if !overEntries && !overBudget {
+			return
+		}
+		c.removeElement(c.ll.Back())
+		c.evictions++
+	}
+}
+
+// removeElement 删除条目并更新内存统计（已加锁）
+func (c *Cache[K, V]) removeElement(elem *list.Element) {
+	e := elem.Value.(*entry[K, V])
+	c.ll.Remove(elem)
+	delete(c.items, e.key)
+	c.addBytes(-e.size)
+}
+
+// addBytes 更新当前缓存和全局的内存统计（已加锁）
+func (c *Cache[K, V]) addBytes(delta int64) {
+	c.bytes += delta
+	totalBytes.Add(delta)
+}
+
+// isExpired 检查条目是否已过期
+func (c *Cache[K, V]) isExpired(e *entry[K, V], now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// entrySize 估算条目占用的内存
+func (c *Cache[K, V]) entrySize(key K, value V) int64 {
+	if c.sizeOf != nil {
+		return defaultEntryOverhead + c.sizeOf(key, value)
+	}
+	size := defaultEntryOverhead
+	if s, ok := any(key).(string); ok {
+		size += int64(len(s))
+	}
+	return size
+}
+
+// SetMemoryBudget 设置所有缓存共享的内存预算（字节），0表示不限制
+// 新的预算在下一次写入时生效
+func SetMemoryBudget(bytes int64) {
+	if bytes < 0 {
+		bytes = 0
+	}
+	memoryBudget.Store(bytes)
+}
+
+// GetMemoryBudget 获取所有缓存共享的内存预算（字节）
+func GetMemoryBudget() int64 {
+	return memoryBudget.Load()
+}
+
+// GetTotalBytes 获取所有缓存当前估算占用的内存（字节）
+func GetTotalBytes() int64 {
+	return totalBytes.Load()
+}
+
+// AllStats 获取所有缓存的统计信息，按名称排序
+func AllStats() []Stats {
+	registryLock.RLock()
+	providers := make([]statsProvider, 0, len(registry))
+	for _, p := range registry {
+		providers = append(providers, p)
+	}
+	registryLock.RUnlock()
+
+	stats := make([]Stats, 0, len(providers))
+	for _, p := range providers {
+		stats = append(stats, p.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
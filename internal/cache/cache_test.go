@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// useMemoryBudget 临时设置全局内存预算，测试结束后恢复
+func useMemoryBudget(t *testing.T, bytes int64) {
+	t.Helper()
+	old := GetMemoryBudget()
+	SetMemoryBudget(bytes)
+	t.Cleanup(func() { SetMemoryBudget(old) })
+}
+
+// 超出条目数上限时淘汰最久未使用的条目，读取会刷新使用顺序
+func TestCacheLRUEviction(t *testing.T) {
+	c := New[string, int]("test_lru", Options{MaxEntries: 3}, nil)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+	c.Set("d", 4)
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("b is still cached, want it evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if stats := c.Stats(); stats.Entries != 3 || stats.Evictions != 1 {
+		t.Errorf("stats = %+v, want 3 entries and 1 eviction", stats)
+	}
+}
+
+// 过期条目读取时视为不存在，写入时从最久未使用的一端清理
+func TestCacheTTL(t *testing.T) {
+	c := New[string, int]("test_ttl", Options{TTL: 20 * time.Millisecond}, nil)
+	c.Set("old", 1)
+	time.Sleep(30 * time.Millisecond)
+
+	if _, ok := c.Get("old"); ok {
+		t.Errorf("expired entry returned")
+	}
+	c.Set("stale", 2)
+	time.Sleep(30 * time.Millisecond)
+	c.Set("fresh", 3)
+
+	if got := c.Len(); got != 1 {
+		t.Errorf("Len() = %d, want 1 after expired entries are purged", got)
+	}
+	if stats := c.Stats(); stats.Expirations != 2 || stats.Evictions != 0 {
+		t.Errorf("stats = %+v, want 2 expirations and no evictions", stats)
+	}
+}
+
+// 所有缓存共享全局内存预算，超出时淘汰正在写入的缓存的旧条目
+func TestCacheMemoryBudget(t *testing.T) {
+	useMemoryBudget(t, 0)
+	base := GetTotalBytes()
+	useMemoryBudget(t, base+10*defaultEntryOverhead)
+
+	c := New[int, int]("test_budget", Options{}, nil)
+	for i := 0; i < 100; i++ {
+		c.Set(i, i)
+	}
+	if got := c.Len(); got != 10 {
+		t.Errorf("Len() = %d, want 10 entries within the budget", got)
+	}
+	if got := GetTotalBytes(); got > GetMemoryBudget() {
+		t.Errorf("GetTotalBytes() = %d, over the budget %d", got, GetMemoryBudget())
+	}
+	if _, ok := c.Get(99); !ok {
+		t.Errorf("the newest entry was evicted")
+	}
+}
+
+// heapAlloc 垃圾回收后获取堆上已分配的内存
+func heapAlloc() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// 写入数百万个不同的会话ID，缓存大小和堆内存都不随写入次数增长
+func TestCacheMillionsOfSessionsHeapBounded(t *testing.T) {
+	if testing.Short() {
+		t.Skip("写入数百万个条目，-short时跳过")
+	}
+
+	const sessions = 2000000
+	const warmup = 100000
+	// 不受限制时2百万个条目占用数百MB，有上限时应远低于该值
+	const maxGrowth = 16 << 20
+
+	tests := []struct {
+		name   string
+		opts   Options
+		budget int64
+	}{
+		{name: "条目数上限", opts: Options{MaxEntries: 10000, TTL: time.Hour}},
+		{name: "全局内存预算", budget: 1 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.budget > 0 {
+				useMemoryBudget(t, GetTotalBytes()+tt.budget)
+			}
+			c := New[string, int]("test_sessions", tt.opts, nil)
+
+			var base uint64
+			for i := 0; i < sessions; i++ {
+				if i == warmup {
+					base = heapAlloc()
+				}
+				c.Set(fmt.Sprintf("session-%d", i), i)
+			}
+			after := heapAlloc()
+
+			if tt.opts.MaxEntries > 0 && c.Len() > tt.opts.MaxEntries {
+				t.Errorf("Len() = %d, over MaxEntries %d", c.Len(), tt.opts.MaxEntries)
+			}
+			if tt.budget > 0 && GetTotalBytes() > GetMemoryBudget() {
+				t.Errorf("GetTotalBytes() = %d, over the budget %d", GetTotalBytes(), GetMemoryBudget())
+			}
+			if after > base && after-base > maxGrowth {
+				t.Errorf("heap grew by %d bytes after %d sessions, want at most %d", after-base, sessions-warmup, maxGrowth)
+			}
+			if stats := c.Stats(); stats.Evictions < sessions-uint64(c.Len()) {
+				t.Errorf("evictions = %d, want at least %d", stats.Evictions, sessions-c.Len())
+			}
+			runtime.KeepAlive(c)
+		})
+	}
+}
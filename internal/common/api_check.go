@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/logger"
+	"flowsilicon/internal/signing"
 	"flowsilicon/pkg/utils"
 	"fmt"
 	"io"
@@ -19,8 +20,7 @@ import (
 // TestChatAPI 测试对话API是否正常工作
 func TestChatAPI(apiKey string) (bool, string, error) {
 
-	cfg := config.GetConfig()
-	baseURL := cfg.ApiProxy.BaseURL
+	baseURL := config.GetApiBaseURL()
 	targetURL := fmt.Sprintf("%s/v1/chat/completions", baseURL)
 
 	logger.Info("测试对话API, 目标URL: %s", targetURL)
@@ -55,6 +55,9 @@ func TestChatAPI(apiKey string) (bool, string, error) {
 
 	// 设置请求头
 	utils.SetCommonHeaders(req, apiKey)
+	if err := signing.ApplyProviderHeaders(req, apiKey, jsonBody); err != nil {
+		return false, "", err
+	}
 
 	// 创建HTTP客户端
 	client := utils.CreateClient()
@@ -102,8 +105,7 @@ func TestChatAPI(apiKey string) (bool, string, error) {
 // testImageGeneration 测试图片生成API是否正常工作
 func TestImageGeneration(apiKey string) (bool, string, error) {
 	// 构建请求URL
-	cfg := config.GetConfig()
-	baseURL := cfg.ApiProxy.BaseURL
+	baseURL := config.GetApiBaseURL()
 	targetURL := fmt.Sprintf("%s/v1/images/generations", baseURL)
 
 	logger.Info("测试图片生成API，目标URL: %s", targetURL)
@@ -136,6 +138,9 @@ func TestImageGeneration(apiKey string) (bool, string, error) {
 
 	// 设置请求头
 	utils.SetCommonHeaders(req, apiKey)
+	if err := signing.ApplyProviderHeaders(req, apiKey, jsonBody); err != nil {
+		return false, "", err
+	}
 
 	logger.Info("图片生成测试使用的API密钥: %s", utils.MaskKey(apiKey))
 
@@ -211,8 +216,7 @@ func TestImageGeneration(apiKey string) (bool, string, error) {
 // testModelsAPI 测试模型列表API是否正常工作
 func TestModelsAPI(apiKey string) (bool, string, error) {
 	// 构建请求URL
-	cfg := config.GetConfig()
-	baseURL := cfg.ApiProxy.BaseURL
+	baseURL := config.GetApiBaseURL()
 	targetURL := fmt.Sprintf("%s/v1/models", baseURL)
 
 	logger.Info("测试模型列表API，目标URL: %s", targetURL)
@@ -226,6 +230,9 @@ func TestModelsAPI(apiKey string) (bool, string, error) {
 
 	// 设置请求头
 	utils.SetCommonHeaders(req, apiKey)
+	if err := signing.ApplyProviderHeaders(req, apiKey, nil); err != nil {
+		return false, "", err
+	}
 
 	logger.Info("模型列表测试使用的API密钥: %s", utils.MaskKey(apiKey))
 
@@ -287,8 +294,7 @@ func TestModelsAPI(apiKey string) (bool, string, error) {
 // testRerankAPI 测试重排序API是否正常工作
 func TestRerankAPI(apiKey string) (bool, string, error) {
 	// 构建请求URL
-	cfg := config.GetConfig()
-	baseURL := cfg.ApiProxy.BaseURL
+	baseURL := config.GetApiBaseURL()
 	targetURL := fmt.Sprintf("%s/v1/rerank", baseURL)
 
 	logger.Info("测试重排序API，目标URL: %s", targetURL)
@@ -327,6 +333,9 @@ func TestRerankAPI(apiKey string) (bool, string, error) {
 
 	// 设置请求头
 	utils.SetCommonHeaders(req, apiKey)
+	if err := signing.ApplyProviderHeaders(req, apiKey, jsonBody); err != nil {
+		return false, "", err
+	}
 
 	logger.Info("重排序测试使用的API密钥: %s", utils.MaskKey(apiKey))
 
@@ -388,8 +397,7 @@ func TestRerankAPI(apiKey string) (bool, string, error) {
 // TestEmbeddings 测试embeddings API是否正常工作
 func TestEmbeddings(apiKey string) (bool, string, error) {
 	// 构建请求URL
-	cfg := config.GetConfig()
-	baseURL := cfg.ApiProxy.BaseURL
+	baseURL := config.GetApiBaseURL()
 	targetURL := fmt.Sprintf("%s/v1/embeddings", baseURL)
 
 	logger.Info("测试embeddings API, 目标URL: %s", targetURL)
@@ -418,6 +426,9 @@ func TestEmbeddings(apiKey string) (bool, string, error) {
 
 	// 设置请求头
 	utils.SetCommonHeaders(req, apiKey)
+	if err := signing.ApplyProviderHeaders(req, apiKey, jsonBody); err != nil {
+		return false, "", err
+	}
 
 	// 创建HTTP客户端
 	client := utils.CreateClient()
@@ -0,0 +1,60 @@
+/**
+  @author: Hanhai
+  @desc: 代理的客户端验证方式，支持不验证、接受任意非空密钥、客户端令牌列表和固定共享密钥
+**/
+
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// 代理验证方式
+const (
+	AuthModeNone        = "none"         // 不验证
+	AuthModeAnyNonEmpty = "any_nonempty" // 要求提供密钥但接受任意值，按密钥哈希区分客户端
+	AuthModeTokenList   = "token_list"   // 只接受客户端令牌列表中的令牌
+	AuthModeFixedSecret = "fixed_secret" // 只接受固定的共享密钥
+)
+
+// ProxySecretEnv 固定共享密钥的环境变量，设置后优先于配置中的API密钥
+const ProxySecretEnv = "FLOWSILICON_API_KEY"
+
+// IsValidAuthMode 检查代理验证方式是否有效
+func IsValidAuthMode(mode string) bool {
+	switch mode {
+	case AuthModeNone, AuthModeAnyNonEmpty, AuthModeTokenList, AuthModeFixedSecret:
+		return true
+	}
+	return false
+}
+
+// GetProxyAuthMode 获取代理的验证方式
+// 旧版本配置没有auth_mode时按api_key_enabled推断，无法识别的值按固定共享密钥处理
+func GetProxyAuthMode(cfg *Config) string {
+	if cfg == nil {
+		return AuthModeNone
+	}
+	if cfg.Security.AuthMode == "" {
+		if cfg.Security.ApiKeyEnabled {
+			return AuthModeFixedSecret
+		}
+		return AuthModeNone
+	}
+	if !IsValidAuthMode(cfg.Security.AuthMode) {
+		return AuthModeFixedSecret
+	}
+	return cfg.Security.AuthMode
+}
+
+// GetProxySecret 获取固定共享密钥，环境变量优先于配置
+func GetProxySecret(cfg *Config) string {
+	if secret := strings.TrimSpace(os.Getenv(ProxySecretEnv)); secret != "" {
+		return secret
+	}
+	if cfg == nil {
+		return ""
+	}
+	return cfg.Security.ApiKey
+}
@@ -0,0 +1,122 @@
+/**
+  @author: Hanhai
+  @desc: 密钥余额历史，每次刷新余额后保存一个余额快照，用于绘制余额趋势图和估算消耗速度
+**/
+
+package config
+
+import (
+	"errors"
+	"flowsilicon/internal/logger"
+	"time"
+)
+
+const (
+	// 余额历史表名
+	balanceHistoryTableName = "key_balance_history"
+	// 余额历史最多保留的天数
+	MaxBalanceHistoryDays = 90
+)
+
+// BalancePoint 一个余额快照
+type BalancePoint struct {
+	Balance   float64 `json:"balance"`    // 余额
+	SampledAt int64   `json:"sampled_at"` // 采样时间（Unix秒）
+}
+
+// initBalanceHistoryTable 创建余额历史表
+func initBalanceHistoryTable() error {
+	query := `CREATE TABLE IF NOT EXISTS ` + balanceHistoryTableName + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key_id INTEGER NOT NULL,
+		balance REAL NOT NULL,
+		sampled_at INTEGER NOT NULL
+	)`
+	if _, err := db.Exec(query); err != nil {
+		logger.Error("创建余额历史表失败: %v", err)
+		return err
+	}
+
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_" + balanceHistoryTableName + "_key_time ON " + balanceHistoryTableName + " (key_id, sampled_at)"); err != nil {
+		logger.Error("创建余额历史索引失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// RecordKeyBalance 保存一个密钥的余额快照，记录分组消耗，并清理该密钥超过保留天数的快照
+func RecordKeyBalance(keyID int, balance float64) error {
+	if keyID <= 0 {
+		return nil
+	}
+
+	// 与上一个快照相比余额下降的部分计入密钥所属分组当天的消耗，余额增加（充值）时不计入
+	var previous float64
+	if db != nil {
+		err := db.QueryRow(
+			"SELECT balance FROM "+balanceHistoryTableName+" WHERE key_id = ? ORDER BY sampled_at DESC, id DESC LIMIT 1",
+			keyID,
+		).Scan(&previous)
+		if err == nil && previous > balance {
+			AddDailyGroupCost(keyID, previous-balance)
+		}
+	}
+
+	now := time.Now()
+	if _, err := ExecWithRetry(
+		"保存余额快照",
+		3,
+		"INSERT INTO "+balanceHistoryTableName+" (key_id, balance, sampled_at) VALUES (?, ?, ?)",
+		keyID, balance, now.Unix(),
+	); err != nil {
+		return err
+	}
+
+	cutoff := now.AddDate(0, 0, -MaxBalanceHistoryDays).Unix()
+	_, err := ExecWithRetry(
+		"清理余额快照",
+		3,
+		"DELETE FROM "+balanceHistoryTableName+" WHERE key_id = ? AND sampled_at < ?",
+		keyID, cutoff,
+	)
+	return err
+}
+
+// GetKeyBalanceHistory 获取密钥最近days天的余额快照，按采样时间升序排列
+func GetKeyBalanceHistory(keyID int, days int) []BalancePoint {
+	points := make([]BalancePoint, 0)
+	if db == nil {
+		logger.Error("获取余额历史失败: %v", errors.New("数据库连接未初始化"))
+		return points
+	}
+	if days <= 0 {
+		days = 7
+	}
+	if days > MaxBalanceHistoryDays {
+		days = MaxBalanceHistoryDays
+	}
+
+	since := time.Now().AddDate(0, 0, -days).Unix()
+	rows, err := db.Query(
+		"SELECT balance, sampled_at FROM "+balanceHistoryTableName+" WHERE key_id = ? AND sampled_at >= ? ORDER BY sampled_at ASC, id ASC",
+		keyID, since,
+	)
+	if err != nil {
+		logger.Error("获取余额历史失败: %v", err)
+		return points
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var point BalancePoint
+		if err := rows.Scan(&point.Balance, &point.SampledAt); err != nil {
+			logger.Error("读取余额历史失败: %v", err)
+			return points
+		}
+		points = append(points, point)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("读取余额历史失败: %v", err)
+	}
+	return points
+}
@@ -0,0 +1,181 @@
+/**
+  @author: Hanhai
+  @desc: 密钥余额模式，支持自动查询、手动维护和不跟踪余额三种方式
+**/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"flowsilicon/internal/logger"
+)
+
+// 密钥余额模式
+const (
+	// BalanceModeAuto 通过余额接口自动查询余额
+	BalanceModeAuto = "auto"
+	// BalanceModeManual 手动设置余额，可按每次请求的预估费用自动扣减
+	BalanceModeManual = "manual"
+	// BalanceModeUntracked 不跟踪余额，不参与任何基于余额的筛选
+	BalanceModeUntracked = "untracked"
+)
+
+// 未跟踪余额的密钥在评分时使用的余额比例，表示余额未知
+const untrackedBalanceRatio = 0.5
+
+// ErrApiKeyNotFound API密钥不存在
+var ErrApiKeyNotFound = errors.New("API密钥未找到")
+
+// IsValidBalanceMode 检查余额模式是否有效，空字符串视为自动模式
+func IsValidBalanceMode(mode string) bool {
+	switch mode {
+	case "", BalanceModeAuto, BalanceModeManual, BalanceModeUntracked:
+		return true
+	default:
+		return false
+	}
+}
+
+// GetBalanceMode 获取密钥的余额模式，未设置时返回自动模式
+func (k ApiKey) GetBalanceMode() string {
+	if k.BalanceMode == "" {
+		return BalanceModeAuto
+	}
+	return k.BalanceMode
+}
+
+// IsBalanceAuto 检查密钥余额是否需要通过余额接口刷新
+func (k ApiKey) IsBalanceAuto() bool {
+	return k.GetBalanceMode() == BalanceModeAuto
+}
+
+// IsBalanceTracked 检查密钥余额是否已知，未跟踪余额的密钥返回false
+func (k ApiKey) IsBalanceTracked() bool {
+	return k.GetBalanceMode() != BalanceModeUntracked
+}
+
+// HasSufficientBalance 检查密钥余额是否满足阈值，未跟踪余额的密钥始终满足
+func (k ApiKey) HasSufficientBalance(threshold float64) bool {
+	if !k.IsBalanceTracked() {
+		return true
+	}
+	return k.Balance >= threshold
+}
+
+// BalanceRatio 计算密钥余额相对于最大余额的比例，用于评分
+// 未跟踪余额的密钥返回中间值，既不优先也不排除
+func (k ApiKey) BalanceRatio(maxBalance float64) float64 {
+	if !k.IsBalanceTracked() {
+		return untrackedBalanceRatio
+	}
+	if maxBalance <= 0 {
+		return 0
+	}
+	return k.Balance / maxBalance
+}
+
+// SetApiKeyBalanceMode 设置密钥的余额模式
+// 手动模式下同时设置余额和每次请求的预估费用，并根据余额阈值更新启用状态
+func SetApiKeyBalanceMode(key string, mode string, balance float64, costPerRequest float64) error {
+	config := GetConfig()
+	if !IsValidBalanceMode(mode) {
+		return fmt.Errorf("无效的余额模式: %s", mode)
+	}
+	if mode == "" {
+		mode = BalanceModeAuto
+	}
+	if costPerRequest < 0 {
+		return fmt.Errorf("每次请求的预估费用不能为负数")
+	}
+
+	var minThreshold float64
+	if config != nil {
+		minThreshold = config.App.MinBalanceThreshold
+	}
+
+	keysMutex.Lock()
+	index := -1
+	for i, k := range apiKeys {
+		if k.Key == key {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		keysMutex.Unlock()
+		return ErrApiKeyNotFound
+	}
+
+	k := &apiKeys[index]
+	wasSufficient := k.HasSufficientBalance(minThreshold)
+	k.BalanceMode = mode
+	if mode == BalanceModeManual {
+		k.Balance = balance
+		k.CostPerRequest = costPerRequest
+	} else {
+		k.CostPerRequest = 0
+	}
+
+	// 根据新的余额状态更新启用状态，因其他原因禁用的密钥保持不变
+	sufficient := k.HasSufficientBalance(minThreshold)
+	if !sufficient && !k.Disabled {
+		k.Disabled = true
+		k.DisabledAt = time.Now().Unix()
+	} else if sufficient && !wasSufficient && k.Disabled {
+		k.Disabled = false
+		k.DisabledAt = 0
+	}
+	updated := *k
+	keysMutex.Unlock()
+
+	// 保存更新到数据库
+	if dbWritable() {
+		_, err := ExecWithRetry(
+			"更新API密钥余额模式",
+			3,
+			"UPDATE "+apikeysTableName+" SET balance_mode = ?, cost_per_request = ?, balance = ?, disabled = ?, disabled_at = ? WHERE key = ?",
+			updated.BalanceMode,
+			updated.CostPerRequest,
+			updated.Balance,
+			updated.Disabled,
+			updated.DisabledAt,
+			key,
+		)
+		if err != nil {
+			logger.Error("更新API密钥余额模式到数据库失败: %v", err)
+			return fmt.Errorf("保存余额模式失败: %w", err)
+		}
+	}
+
+	logger.Info("API密钥 %s 的余额模式已设置为: %s", MaskKey(key), mode)
+	notifyApiKeyChanges()
+	return nil
+}
+
+// deductManualBalanceLocked 按预估费用扣减手动余额模式密钥的余额（已加锁）
+// 返回余额是否发生变化
+func deductManualBalanceLocked(index int) bool {
+	config := GetConfig()
+	k := &apiKeys[index]
+	if k.GetBalanceMode() != BalanceModeManual || k.CostPerRequest <= 0 {
+		return false
+	}
+
+	k.Balance -= k.CostPerRequest
+	if k.Balance < 0 {
+		k.Balance = 0
+	}
+
+	// 余额低于阈值时禁用密钥
+	if config != nil && k.Balance < config.App.MinBalanceThreshold && !k.Disabled {
+		k.Disabled = true
+		k.DisabledAt = time.Now().Unix()
+		logger.Info("API密钥 %s 手动余额 %.2f 低于阈值 %.2f，已自动禁用",
+			MaskKey(k.Key), k.Balance, config.App.MinBalanceThreshold)
+	}
+
+	return true
+}
@@ -0,0 +1,17 @@
+/**
+  @author: Hanhai
+  @desc: 内存缓存的全局内存预算配置
+**/
+
+package config
+
+import "flowsilicon/internal/cache"
+
+// applyCacheMemoryBudget 按配置设置内存缓存的全局内存预算，未配置时使用默认值
+func applyCacheMemoryBudget(cfg *Config) {
+	budget := cache.DefaultMemoryBudget
+	if cfg != nil && cfg.App.CacheMemoryBudgetMB > 0 {
+		budget = int64(cfg.App.CacheMemoryBudgetMB) << 20
+	}
+	cache.SetMemoryBudget(budget)
+}
@@ -0,0 +1,223 @@
+/**
+  @author: Hanhai
+  @desc: 休眠唤醒后的补执行，检测系统时间的大幅跳变，为错过的日期补上无数据的每日统计，错过的定时任务在几分钟内错开补执行一次，避免唤醒时同时执行
+**/
+
+package config
+
+import (
+	"sync"
+	"time"
+
+	"flowsilicon/internal/logger"
+)
+
+const (
+	// 检查系统时间跳变的间隔
+	clockCheckInterval = 30 * time.Second
+	// 系统时间与经过的时间相差超过该值时视为休眠唤醒或时间校正
+	clockJumpThreshold = 2 * time.Minute
+	// 未设置时错过的定时任务超过该时间（小时）不再补执行
+	defaultCatchUpMaxAgeHours = 24
+	// 未设置时补执行的定时任务错开执行的时间范围（分钟）
+	defaultCatchUpSpreadMinutes = 5
+)
+
+// scheduledJob 登记的定时任务
+type scheduledJob struct {
+	name     string
+	interval time.Duration
+	run      func()
+	lastRun  time.Time // 上一次执行或登记的时间
+	pending  bool      // 等待错开补执行，期间跳过定时器的触发
+	running  bool
+}
+
+var (
+	// 获取当前时间，统计数据和补执行使用同一个时钟
+	clockNow = time.Now
+
+	lastClockCheck     time.Time
+	scheduledJobs      []*scheduledJob
+	catchUpMutex       sync.Mutex
+	clockDetectorStart sync.Once
+)
+
+// ScheduledJob 登记一个每隔interval执行一次的定时任务，返回供定时器调用的函数，同名的任务只保留最后一次登记
+// 检测到休眠唤醒后，定时器在唤醒时的触发被跳过，改为在错开的时间补执行一次
+func ScheduledJob(name string, interval time.Duration, run func()) func() {
+	catchUpMutex.Lock()
+	var job *scheduledJob
+	for _, existing := range scheduledJobs {
+		if existing.name == name {
+			job = existing
+			break
+		}
+	}
+	if job == nil {
+		job = &scheduledJob{name: name}
+		scheduledJobs = append(scheduledJobs, job)
+	}
+	job.interval = interval
+	job.run = run
+	job.lastRun = clockNow()
+	catchUpMutex.Unlock()
+
+	startClockJumpDetector()
+
+	return func() {
+		CheckClockJump()
+
+		catchUpMutex.Lock()
+		if job.pending || job.running {
+			catchUpMutex.Unlock()
+			logger.Info("定时任务 %s 正在执行或等待唤醒后的补执行，跳过本次执行", name)
+			return
+		}
+		job.running = true
+		job.lastRun = clockNow()
+		catchUpMutex.Unlock()
+
+		executeScheduledJob(job)
+	}
+}
+
+// executeScheduledJob 执行定时任务并清除正在执行的标记
+func executeScheduledJob(job *scheduledJob) {
+	defer func() {
+		catchUpMutex.Lock()
+		job.running = false
+		catchUpMutex.Unlock()
+	}()
+	job.run()
+}
+
+// startClockJumpDetector 启动定期检查系统时间跳变的协程
+func startClockJumpDetector() {
+	clockDetectorStart.Do(func() {
+		catchUpMutex.Lock()
+		lastClockCheck = clockNow()
+		catchUpMutex.Unlock()
+
+		go func() {
+			ticker := time.NewTicker(clockCheckInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				CheckClockJump()
+			}
+		}()
+	})
+}
+
+// getCatchUpSettings 获取错过的定时任务的最大补执行时间和错开执行的时间范围
+func getCatchUpSettings() (time.Duration, time.Duration) {
+	maxAgeHours, spreadMinutes := defaultCatchUpMaxAgeHours, defaultCatchUpSpreadMinutes
+	if cfg := GetConfig(); cfg != nil {
+		if cfg.App.CatchUpMaxAgeHours > 0 {
+			maxAgeHours = cfg.App.CatchUpMaxAgeHours
+		}
+		if cfg.App.CatchUpSpreadMinutes > 0 {
+			spreadMinutes = cfg.App.CatchUpSpreadMinutes
+		}
+	}
+	return time.Duration(maxAgeHours) * time.Hour, time.Duration(spreadMinutes) * time.Minute
+}
+
+// CheckClockJump 检查距上次检查后系统时间是否跳变，向后跳变时补上错过日期的每日统计并安排补执行错过的定时任务
+// 休眠期间单调时钟停止而系统时间继续，两者之差即为休眠时间；单调时钟也计入休眠的系统按检查的延迟判断
+func CheckClockJump() {
+	now := clockNow()
+
+	catchUpMutex.Lock()
+	last := lastClockCheck
+	lastClockCheck = now
+	if last.IsZero() {
+		catchUpMutex.Unlock()
+		return
+	}
+	elapsed := now.Sub(last)
+	jump := now.Round(0).Sub(last.Round(0)) - elapsed
+	if delay := elapsed - clockCheckInterval; delay > jump {
+		jump = delay
+	}
+
+	if jump < -clockJumpThreshold {
+		catchUpMutex.Unlock()
+		logger.Warn("检测到系统时间向前调整了 %s", (-jump).Round(time.Second))
+		return
+	}
+	if jump < clockJumpThreshold {
+		catchUpMutex.Unlock()
+		return
+	}
+	logger.Warn("检测到系统时间跳变了 %s（休眠唤醒或时间校正），开始补执行错过的任务", jump.Round(time.Second))
+	scheduleCatchUpLocked(now)
+	catchUpMutex.Unlock()
+
+	closeMissedDailyStats()
+}
+
+// scheduleCatchUpLocked 为错过执行的定时任务安排补执行，多次错过的只补执行一次，在设置的时间范围内错开执行（已加锁）
+func scheduleCatchUpLocked(now time.Time) {
+	maxAge, spread := getCatchUpSettings()
+
+	var due []*scheduledJob
+	for _, job := range scheduledJobs {
+		if job.pending || job.interval <= 0 {
+			continue
+		}
+		// 按系统时间计算，单调时钟不包含休眠的时间
+		missed := now.Round(0).Sub(job.lastRun.Round(0)) / job.interval
+		if missed < 1 {
+			continue
+		}
+		latestMissed := job.lastRun.Round(0).Add(missed * job.interval)
+		if age := now.Round(0).Sub(latestMissed); age > maxAge {
+			logger.Warn("定时任务 %s 错过的执行已超过 %s，不再补执行", job.name, age.Round(time.Minute))
+			job.lastRun = now
+			continue
+		}
+		job.pending = true
+		due = append(due, job)
+	}
+
+	for i, job := range due {
+		delay := spread * time.Duration(i) / time.Duration(len(due))
+		logger.Info("定时任务 %s 将在 %s 后补执行", job.name, delay.Round(time.Second))
+		job := job
+		time.AfterFunc(delay, func() {
+			runCatchUpJob(job)
+		})
+	}
+}
+
+// runCatchUpJob 补执行一次定时任务，任务正在执行时不再补执行
+func runCatchUpJob(job *scheduledJob) {
+	catchUpMutex.Lock()
+	job.pending = false
+	if job.running {
+		catchUpMutex.Unlock()
+		return
+	}
+	job.running = true
+	job.lastRun = clockNow()
+	catchUpMutex.Unlock()
+
+	logger.Info("补执行休眠期间错过的定时任务 %s", job.name)
+	executeScheduledJob(job)
+}
+
+// closeMissedDailyStats 为休眠期间错过的日期补上无数据的每日统计，并创建今天的数据
+func closeMissedDailyStats() {
+	dailyDataLock.Lock()
+	if dailyData == nil {
+		dailyDataLock.Unlock()
+		return
+	}
+	ensureTodayDataExistsLocked()
+	dailyDataLock.Unlock()
+
+	if err := saveDailyData(); err != nil {
+		logger.Error("保存每日统计数据失败: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetScheduledJobs 清空登记的定时任务，测试结束后恢复
+func resetScheduledJobs(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		catchUpMutex.Lock()
+		scheduledJobs = nil
+		lastClockCheck = clockNow()
+		catchUpMutex.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// 记录统计的过程中时钟向后跳3天：错过的日期标记为无数据，错过的定时任务错开补执行一次，太久以前错过的不再补执行
+func TestClockJumpCatchUp(t *testing.T) {
+	day0 := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	clock := useStatsClock(t, "UTC", day0)
+	cfg := GetConfig().Clone()
+	cfg.App.CatchUpMaxAgeHours = 12
+	cfg.App.CatchUpSpreadMinutes = 1
+	UpdateConfig(cfg)
+	resetScheduledJobs(t)
+
+	AddDailyRequestStat("", "test-model", 1, 10, 0, true)
+
+	var reportRuns, janitorRuns, staleRuns atomic.Int32
+	reportDone := make(chan struct{}, 1)
+	ScheduledJob("test-report", 24*time.Hour, func() {
+		reportRuns.Add(1)
+		reportDone <- struct{}{}
+	})
+	janitor := ScheduledJob("test-janitor", time.Hour, func() { janitorRuns.Add(1) })
+	stale := ScheduledJob("test-stale", 48*time.Hour, func() { staleRuns.Add(1) })
+
+	// 正常的检查间隔不是跳变
+	*clock = day0.Add(clockCheckInterval)
+	CheckClockJump()
+	if reportRuns.Load()+janitorRuns.Load()+staleRuns.Load() != 0 {
+		t.Fatal("jobs ran without a clock jump")
+	}
+
+	*clock = day0.Add(72 * time.Hour)
+	CheckClockJump()
+
+	for _, date := range []string{"2026-10-02", "2026-10-03"} {
+		if stats := findDailyStats(t, date); !stats.NoData || stats.Requests.Total != 0 {
+			t.Errorf("%s = %+v, want an empty no_data day", date, stats.Requests)
+		}
+	}
+	if first := findDailyStats(t, "2026-10-01"); first.NoData || first.Requests.Total != 1 {
+		t.Errorf("2026-10-01 = %+v, want the recorded request", first.Requests)
+	}
+	if today := findDailyStats(t, "2026-10-04"); today.NoData {
+		t.Error("today is marked no_data")
+	}
+
+	// 第一个补执行的任务立即执行，只执行一次
+	select {
+	case <-reportDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("test-report was not caught up")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := reportRuns.Load(); got != 1 {
+		t.Errorf("test-report ran %d times, want 1", got)
+	}
+
+	// 第二个任务错开到稍后执行，等待期间定时器的触发被跳过
+	janitor()
+	if got := janitorRuns.Load(); got != 0 {
+		t.Errorf("test-janitor ran %d times before its staggered catch-up", got)
+	}
+	catchUpMutex.Lock()
+	pending := map[string]bool{}
+	for _, job := range scheduledJobs {
+		pending[job.name] = job.pending
+	}
+	catchUpMutex.Unlock()
+	if !pending["test-janitor"] || pending["test-report"] || pending["test-stale"] {
+		t.Errorf("pending = %v, want only test-janitor waiting", pending)
+	}
+
+	// 错过的执行超过12小时的任务不补执行，之后按定时器正常执行
+	if got := staleRuns.Load(); got != 0 {
+		t.Errorf("test-stale was caught up %d times, want 0", got)
+	}
+	stale()
+	if got := staleRuns.Load(); got != 1 {
+		t.Errorf("test-stale ran %d times on its next tick, want 1", got)
+	}
+}
+
+// 时钟向前调整只记录日志，不补执行任务
+func TestClockJumpBackward(t *testing.T) {
+	day0 := time.Date(2026, 10, 5, 10, 0, 0, 0, time.UTC)
+	clock := useStatsClock(t, "UTC", day0)
+	resetScheduledJobs(t)
+
+	var runs atomic.Int32
+	ScheduledJob("test-backward", time.Minute, func() { runs.Add(1) })
+
+	*clock = day0.Add(-time.Hour)
+	CheckClockJump()
+	time.Sleep(50 * time.Millisecond)
+	if got := runs.Load(); got != 0 {
+		t.Errorf("job ran %d times after a backward jump, want 0", got)
+	}
+}
@@ -0,0 +1,52 @@
+/**
+  @author: Hanhai
+  @desc: 代理接口的客户端地址白名单，解析允许的地址范围，未设置时只允许本机访问
+**/
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DefaultAllowedClientCIDRs 未设置时允许使用代理接口的客户端地址范围，只允许本机
+var DefaultAllowedClientCIDRs = []string{"127.0.0.1/32", "::1/128"}
+
+// GetAllowedClientCIDRs 获取允许使用代理接口的客户端地址范围，未设置时返回只允许本机的默认值
+func GetAllowedClientCIDRs(cfg *Config) []string {
+	if cfg == nil || len(cfg.Server.AllowedClientCIDRs) == 0 {
+		return DefaultAllowedClientCIDRs
+	}
+	return cfg.Server.AllowedClientCIDRs
+}
+
+// ParseClientCIDRs 解析客户端地址范围，不带前缀长度的地址只匹配该地址，空白的项跳过
+func ParseClientCIDRs(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的客户端地址: %s", value)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				networks = append(networks, &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)})
+			} else {
+				networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+			}
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("无效的客户端地址范围: %s", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
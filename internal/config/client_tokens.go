@@ -0,0 +1,373 @@
+/**
+  @author: Hanhai
+  @desc: 客户端令牌的吊销、恢复和删除，吊销的令牌保留在令牌列表和用量统计中，吊销超过冷却期后才能永久删除
+**/
+
+package config
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/logger"
+)
+
+// DefaultTokenDeleteCoolingHours 未设置时令牌吊销后需要等待多久才能永久删除（小时）
+const DefaultTokenDeleteCoolingHours = 24
+
+// 客户端令牌的状态
+const (
+	ClientTokenActive  = "active"  // 可以通过验证
+	ClientTokenRevoked = "revoked" // 已吊销，验证时返回token_revoked
+	ClientTokenDeleted = "deleted" // 已永久删除，只出现在历史用量中
+)
+
+var (
+	// ErrClientTokenNotFound 令牌不在客户端令牌列表中
+	ErrClientTokenNotFound = errors.New("客户端令牌不存在")
+	// ErrClientTokenNotRevoked 令牌未吊销，不能恢复或删除
+	ErrClientTokenNotRevoked = errors.New("客户端令牌未吊销")
+	// ErrClientTokenCooling 令牌吊销后未超过冷却期，不能永久删除
+	ErrClientTokenCooling = errors.New("客户端令牌吊销后未超过冷却期，不能永久删除")
+)
+
+// RevokedClientToken 已吊销的客户端令牌
+type RevokedClientToken struct {
+	Token     string `mapstructure:"token"`
+	RevokedAt int64  `mapstructure:"revoked_at"` // 吊销时间（Unix秒）
+	Removed   bool   `mapstructure:"removed"`    // 保存设置时从令牌列表中移除，超过冷却期后自动删除
+}
+
+// ClientTokenInfo 客户端令牌的状态和保留天数内的累计用量
+type ClientTokenInfo struct {
+	Token       string      `json:"token"`  // 脱敏后的令牌
+	Client      string      `json:"client"` // 用量统计中的客户端标识
+	Status      string      `json:"status"`
+	RevokedAt   int64       `json:"revoked_at,omitempty"`
+	DeletableAt int64       `json:"deletable_at,omitempty"` // 可以永久删除的时间（Unix秒）
+	Removed     bool        `json:"removed,omitempty"`      // 已从令牌列表中移除，冷却期后自动删除
+	Usage       ClientUsage `json:"usage"`
+}
+
+// 修改令牌状态时保证读取和发布配置之间不被其他修改覆盖
+var clientTokenMutex sync.Mutex
+
+// ClientTokenClient 获取令牌在用量统计中的客户端标识，与middleware.ClientIdentity一致
+func ClientTokenClient(token string) string {
+	return "token:" + MaskKey(token)
+}
+
+// getTokenDeleteCooling 获取令牌吊销后需要等待的冷却期
+func getTokenDeleteCooling(cfg *Config) time.Duration {
+	hours := DefaultTokenDeleteCoolingHours
+	if cfg != nil && cfg.Security.TokenDeleteCoolingHours > 0 {
+		hours = cfg.Security.TokenDeleteCoolingHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// sameToken 以固定时间比较两个令牌，避免通过响应时间猜测令牌
+func sameToken(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// findRevokedToken 查找令牌的吊销记录，不存在时返回-1
+func findRevokedToken(cfg *Config, token string) int {
+	index := -1
+	for i, revoked := range cfg.Security.RevokedClientTokens {
+		if sameToken(token, revoked.Token) {
+			index = i
+		}
+	}
+	return index
+}
+
+// hasClientToken 检查令牌是否在客户端令牌列表中
+func hasClientToken(cfg *Config, token string) bool {
+	return containsToken(cfg.Security.ClientTokens, token)
+}
+
+// IsClientTokenRevoked 检查令牌是否已吊销
+func IsClientTokenRevoked(cfg *Config, token string) bool {
+	return cfg != nil && findRevokedToken(cfg, token) >= 0
+}
+
+// isRemovedClientToken 检查令牌是否在保存设置时被移除
+func isRemovedClientToken(cfg *Config, token string) bool {
+	index := findRevokedToken(cfg, token)
+	return index >= 0 && cfg.Security.RevokedClientTokens[index].Removed
+}
+
+// ListedClientTokens 获取设置页面中显示的令牌列表，不包含已移除、等待冷却期后删除的令牌
+func ListedClientTokens(cfg *Config) []string {
+	tokens := make([]string, 0, len(cfg.Security.ClientTokens))
+	for _, token := range cfg.Security.ClientTokens {
+		if !isRemovedClientToken(cfg, token) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// GetClientTokenMaxChoices 获取客户端令牌每个请求的候选结果数上限，未配置时返回0
+func GetClientTokenMaxChoices(cfg *Config, token string) int {
+	if cfg == nil || token == "" {
+		return 0
+	}
+	limit := 0
+	for configured, maxChoices := range cfg.Security.ClientTokenMaxChoices {
+		if sameToken(token, configured) {
+			limit = maxChoices
+		}
+	}
+	return limit
+}
+
+// ListedClientTokenMaxChoices 获取设置页面中显示的令牌的候选结果数上限
+func ListedClientTokenMaxChoices(cfg *Config) map[string]int {
+	limits := make(map[string]int)
+	for _, token := range ListedClientTokens(cfg) {
+		if limit := GetClientTokenMaxChoices(cfg, token); limit > 0 {
+			limits[token] = limit
+		}
+	}
+	return limits
+}
+
+// ApplySavedClientTokens 用设置页面保存的令牌列表更新配置
+// 列表中没有的令牌不直接删除，而是吊销并标记为已移除，超过冷却期后由PruneRevokedClientTokens删除；
+// 重新加入列表的已移除令牌恢复可用
+func ApplySavedClientTokens(cfg *Config, saved []string, now time.Time) {
+	previous := cfg.Security.ClientTokens
+	tokens := make([]string, 0, len(saved)+len(previous))
+	revoked := make([]RevokedClientToken, 0, len(cfg.Security.RevokedClientTokens))
+	for _, record := range cfg.Security.RevokedClientTokens {
+		if record.Removed && containsToken(saved, record.Token) {
+			logger.Warn("审计: 已移除的客户端令牌 %s 重新加入列表，已恢复", MaskKey(record.Token))
+			continue
+		}
+		revoked = append(revoked, record)
+	}
+	tokens = append(tokens, saved...)
+
+	for _, token := range previous {
+		if containsToken(saved, token) {
+			continue
+		}
+		tokens = append(tokens, token)
+		index := -1
+		for i, record := range revoked {
+			if sameToken(token, record.Token) {
+				index = i
+			}
+		}
+		if index >= 0 {
+			if !revoked[index].Removed {
+				revoked[index].Removed = true
+				logger.Warn("审计: 已从列表中移除已吊销的客户端令牌 %s", MaskKey(token))
+			}
+			continue
+		}
+		revoked = append(revoked, RevokedClientToken{Token: token, RevokedAt: now.Unix(), Removed: true})
+		logger.Warn("审计: 客户端令牌 %s 已从列表中移除，已吊销，冷却期后删除", MaskKey(token))
+	}
+
+	cfg.Security.ClientTokens = tokens
+	cfg.Security.RevokedClientTokens = revoked
+	PruneRevokedClientTokens(cfg, now)
+}
+
+// containsToken 检查令牌是否在列表中
+func containsToken(tokens []string, token string) bool {
+	found := false
+	for _, existing := range tokens {
+		if sameToken(token, existing) {
+			found = true
+		}
+	}
+	return found
+}
+
+// PruneRevokedClientTokens 删除已不在令牌列表中的令牌的吊销记录，
+// 并删除已移除且超过冷却期的令牌，保存设置和修改令牌状态时调用
+func PruneRevokedClientTokens(cfg *Config, now time.Time) {
+	cooling := getTokenDeleteCooling(cfg)
+	expired := make([]string, 0)
+	kept := make([]RevokedClientToken, 0, len(cfg.Security.RevokedClientTokens))
+	for _, revoked := range cfg.Security.RevokedClientTokens {
+		if !hasClientToken(cfg, revoked.Token) {
+			continue
+		}
+		if revoked.Removed && !now.Before(time.Unix(revoked.RevokedAt, 0).Add(cooling)) {
+			expired = append(expired, revoked.Token)
+			logger.Warn("审计: 已移除的客户端令牌 %s 超过冷却期，已永久删除", MaskKey(revoked.Token))
+			continue
+		}
+		kept = append(kept, revoked)
+	}
+	cfg.Security.RevokedClientTokens = kept
+
+	if len(expired) == 0 {
+		return
+	}
+	tokens := make([]string, 0, len(cfg.Security.ClientTokens))
+	for _, token := range cfg.Security.ClientTokens {
+		if !containsToken(expired, token) {
+			tokens = append(tokens, token)
+		}
+	}
+	cfg.Security.ClientTokens = tokens
+}
+
+// updateClientTokens 在配置副本上修改令牌状态，发布并保存到数据库
+func updateClientTokens(modify func(cfg *Config) error) error {
+	clientTokenMutex.Lock()
+	defer clientTokenMutex.Unlock()
+
+	if err := CheckWritable(); err != nil {
+		return err
+	}
+	current := GetConfig()
+	if current == nil {
+		return fmt.Errorf("配置未加载")
+	}
+
+	cfg := current.Clone()
+	if err := modify(cfg); err != nil {
+		return err
+	}
+	PruneRevokedClientTokens(cfg, time.Now())
+	UpdateConfig(cfg)
+	if err := SaveConfigToDB(); err != nil {
+		return fmt.Errorf("保存配置失败: %w", err)
+	}
+	return nil
+}
+
+// RevokeClientToken 吊销客户端令牌，令牌保留在列表中，验证时返回token_revoked，已吊销时不改变吊销时间
+func RevokeClientToken(token string) error {
+	return updateClientTokens(func(cfg *Config) error {
+		if !hasClientToken(cfg, token) {
+			return ErrClientTokenNotFound
+		}
+		if findRevokedToken(cfg, token) >= 0 {
+			return nil
+		}
+		cfg.Security.RevokedClientTokens = append(cfg.Security.RevokedClientTokens, RevokedClientToken{
+			Token:     token,
+			RevokedAt: time.Now().Unix(),
+		})
+		logger.Warn("审计: 已吊销客户端令牌 %s", MaskKey(token))
+		return nil
+	})
+}
+
+// RestoreClientToken 恢复已吊销的客户端令牌
+func RestoreClientToken(token string) error {
+	return updateClientTokens(func(cfg *Config) error {
+		if !hasClientToken(cfg, token) {
+			return ErrClientTokenNotFound
+		}
+		index := findRevokedToken(cfg, token)
+		if index < 0 {
+			return ErrClientTokenNotRevoked
+		}
+		revoked := cfg.Security.RevokedClientTokens
+		cfg.Security.RevokedClientTokens = append(revoked[:index:index], revoked[index+1:]...)
+		logger.Warn("审计: 已恢复客户端令牌 %s", MaskKey(token))
+		return nil
+	})
+}
+
+// DeleteClientToken 永久删除吊销超过冷却期的客户端令牌，同时删除令牌列表中的令牌和吊销记录
+// 历史用量按脱敏后的客户端标识保存，删除后仍然保留，在报表中标记为deleted
+func DeleteClientToken(token string) error {
+	return updateClientTokens(func(cfg *Config) error {
+		if !hasClientToken(cfg, token) {
+			return ErrClientTokenNotFound
+		}
+		index := findRevokedToken(cfg, token)
+		if index < 0 {
+			return ErrClientTokenNotRevoked
+		}
+		revokedAt := time.Unix(cfg.Security.RevokedClientTokens[index].RevokedAt, 0)
+		if deletableAt := revokedAt.Add(getTokenDeleteCooling(cfg)); time.Now().Before(deletableAt) {
+			return fmt.Errorf("%w，%s 后可以删除", ErrClientTokenCooling, deletableAt.Format("2006-01-02 15:04:05"))
+		}
+
+		tokens := make([]string, 0, len(cfg.Security.ClientTokens))
+		for _, existing := range cfg.Security.ClientTokens {
+			if !sameToken(token, existing) {
+				tokens = append(tokens, existing)
+			}
+		}
+		cfg.Security.ClientTokens = tokens
+		logger.Warn("审计: 已永久删除客户端令牌 %s", MaskKey(token))
+		return nil
+	})
+}
+
+// GetClientTokenInfos 获取所有客户端令牌的状态和保留天数内的累计用量
+func GetClientTokenInfos() []ClientTokenInfo {
+	cfg := GetConfig()
+	if cfg == nil {
+		return []ClientTokenInfo{}
+	}
+
+	cooling := getTokenDeleteCooling(cfg)
+	infos := make([]ClientTokenInfo, 0, len(cfg.Security.ClientTokens))
+	for _, token := range cfg.Security.ClientTokens {
+		if token == "" {
+			continue
+		}
+		client := ClientTokenClient(token)
+		info := ClientTokenInfo{
+			Token:  MaskKey(token),
+			Client: client,
+			Status: ClientTokenActive,
+			Usage:  GetClientUsageTotal(client),
+		}
+		if index := findRevokedToken(cfg, token); index >= 0 {
+			info.Status = ClientTokenRevoked
+			info.RevokedAt = cfg.Security.RevokedClientTokens[index].RevokedAt
+			info.DeletableAt = time.Unix(info.RevokedAt, 0).Add(cooling).Unix()
+			info.Removed = cfg.Security.RevokedClientTokens[index].Removed
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// GetClientTokenStatus 获取用量统计中令牌客户端的状态，不是令牌客户端时返回空字符串
+// 令牌列表中找不到对应令牌的客户端视为已删除
+func GetClientTokenStatus(client string) string {
+	if !strings.HasPrefix(client, "token:") {
+		return ""
+	}
+	cfg := GetConfig()
+	if cfg == nil {
+		return ""
+	}
+
+	// 固定密钥验证方式下按固定密钥统计的客户端
+	if secret := GetProxySecret(cfg); secret != "" && ClientTokenClient(secret) == client {
+		return ClientTokenActive
+	}
+
+	status := ClientTokenDeleted
+	for _, token := range cfg.Security.ClientTokens {
+		if token == "" || ClientTokenClient(token) != client {
+			continue
+		}
+		// 脱敏后相同的令牌中有一个可用时视为可用
+		if findRevokedToken(cfg, token) < 0 {
+			return ClientTokenActive
+		}
+		status = ClientTokenRevoked
+	}
+	return status
+}
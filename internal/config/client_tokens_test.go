@@ -0,0 +1,96 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplySavedClientTokensRevokesOmitted(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	cfg := &Config{}
+	cfg.Security.ClientTokens = []string{"tok-a", "tok-b", "tok-c"}
+
+	ApplySavedClientTokens(cfg, []string{"tok-a", "tok-c"}, now)
+
+	if !hasClientToken(cfg, "tok-b") {
+		t.Fatal("省略的令牌被直接删除")
+	}
+	if !IsClientTokenRevoked(cfg, "tok-b") || !isRemovedClientToken(cfg, "tok-b") {
+		t.Fatal("省略的令牌没有被吊销并标记为已移除")
+	}
+	if IsClientTokenRevoked(cfg, "tok-a") || IsClientTokenRevoked(cfg, "tok-c") {
+		t.Fatal("保存的令牌被吊销")
+	}
+	if listed := ListedClientTokens(cfg); len(listed) != 2 || listed[0] != "tok-a" || listed[1] != "tok-c" {
+		t.Fatalf("ListedClientTokens = %v", listed)
+	}
+
+	// 设置页面不显示已移除的令牌，再次保存时仍然保持吊销，吊销时间不变
+	ApplySavedClientTokens(cfg, ListedClientTokens(cfg), now.Add(time.Hour))
+	index := findRevokedToken(cfg, "tok-b")
+	if index < 0 || cfg.Security.RevokedClientTokens[index].RevokedAt != now.Unix() {
+		t.Fatalf("再次保存后吊销记录 = %+v", cfg.Security.RevokedClientTokens)
+	}
+}
+
+func TestPruneRemovesOmittedTokensAfterCooling(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	cfg := &Config{}
+	cfg.Security.TokenDeleteCoolingHours = 24
+	cfg.Security.ClientTokens = []string{"tok-a", "tok-b"}
+
+	ApplySavedClientTokens(cfg, []string{"tok-a"}, now)
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		kept    bool
+	}{
+		{"冷却期内", 23 * time.Hour, true},
+		{"刚好超过冷却期", 24 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cfg.Clone()
+			PruneRevokedClientTokens(c, now.Add(tt.elapsed))
+			if got := hasClientToken(c, "tok-b"); got != tt.kept {
+				t.Fatalf("令牌保留 = %v，期望 %v", got, tt.kept)
+			}
+			if got := findRevokedToken(c, "tok-b") >= 0; got != tt.kept {
+				t.Fatalf("吊销记录保留 = %v，期望 %v", got, tt.kept)
+			}
+			if !hasClientToken(c, "tok-a") {
+				t.Fatal("未移除的令牌被删除")
+			}
+		})
+	}
+}
+
+func TestPruneKeepsExplicitlyRevokedTokens(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	cfg := &Config{}
+	cfg.Security.ClientTokens = []string{"tok-a"}
+	cfg.Security.RevokedClientTokens = []RevokedClientToken{{Token: "tok-a", RevokedAt: now.Unix()}}
+
+	// 只吊销未移除的令牌需要手动删除，不会自动删除
+	PruneRevokedClientTokens(cfg, now.Add(365*24*time.Hour))
+	if !hasClientToken(cfg, "tok-a") || !IsClientTokenRevoked(cfg, "tok-a") {
+		t.Fatal("只吊销的令牌被自动删除")
+	}
+}
+
+func TestApplySavedClientTokensRestoresReadded(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	cfg := &Config{}
+	cfg.Security.ClientTokens = []string{"tok-a", "tok-b"}
+
+	ApplySavedClientTokens(cfg, []string{"tok-a"}, now)
+	ApplySavedClientTokens(cfg, []string{"tok-a", "tok-b"}, now.Add(time.Minute))
+
+	if IsClientTokenRevoked(cfg, "tok-b") {
+		t.Fatal("重新加入列表的令牌仍然处于吊销状态")
+	}
+	if len(cfg.Security.ClientTokens) != 2 {
+		t.Fatalf("令牌列表 = %v", cfg.Security.ClientTokens)
+	}
+}
@@ -0,0 +1,173 @@
+/**
+  @author: Hanhai
+  @desc: 客户端用量统计，按客户端IP或访问令牌汇总每日请求和令牌用量
+**/
+
+package config
+
+import (
+	"sort"
+
+	"flowsilicon/internal/logger"
+)
+
+const (
+	// 每天默认最多单独记录的客户端数量
+	defaultMaxClientUsageEntries = 50
+	// 超出数量上限的客户端统一记录到该条目
+	ClientUsageOther = "other"
+	// 客户端用量保留的天数，与每日统计保持一致
+	clientUsageRetentionDays = 30
+)
+
+// ClientUsage 客户端每日用量统计
+type ClientUsage struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	Tokens           int `json:"tokens"`
+}
+
+// ClientUsageEntry 带客户端标识的用量统计
+type ClientUsageEntry struct {
+	Client string `json:"client"`
+	Status string `json:"status,omitempty"` // 令牌客户端的状态：active、revoked、deleted，其他客户端为空
+	ClientUsage
+}
+
+// IsClientUsageEnabled 检查是否启用客户端用量统计
+func IsClientUsageEnabled() bool {
+	config := GetConfig()
+	return config == nil || !config.App.DisableClientUsage
+}
+
+// getMaxClientUsageEntries 获取每天最多单独记录的客户端数量
+func getMaxClientUsageEntries() int {
+	config := GetConfig()
+	if config != nil && config.App.MaxClientUsageEntries > 0 {
+		return config.App.MaxClientUsageEntries
+	}
+	return defaultMaxClientUsageEntries
+}
+
+// AddDailyClientStat 添加客户端每日用量统计
+// 当天记录的客户端数量达到上限后，新出现的客户端计入other条目
+func AddDailyClientStat(client string, requestCount, promptTokens, completionTokens int) {
+	if client == "" || !IsClientUsageEnabled() {
+		return
+	}
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	// 确保dailyData已初始化
+	if dailyData == nil {
+		dailyData = createDefaultDailyData()
+	}
+	if dailyData.ClientsUsage == nil {
+		dailyData.ClientsUsage = make(map[string]map[string]ClientUsage)
+	}
+
+	today := StatsToday()
+	clients, exists := dailyData.ClientsUsage[today]
+	if !exists {
+		clients = make(map[string]ClientUsage)
+		dailyData.ClientsUsage[today] = clients
+		pruneClientUsageLocked()
+	}
+
+	// 超出数量上限的新客户端计入other
+	if _, exists := clients[client]; !exists {
+		named := len(clients)
+		if _, hasOther := clients[ClientUsageOther]; hasOther {
+			named--
+		}
+		if named >= getMaxClientUsageEntries() {
+			client = ClientUsageOther
+		}
+	}
+
+	usage := clients[client]
+	usage.Requests += requestCount
+	usage.PromptTokens += promptTokens
+	usage.CompletionTokens += completionTokens
+	usage.Tokens += promptTokens + completionTokens
+	clients[client] = usage
+
+	// 异步保存数据
+	go func() {
+		if err := saveDailyData(); err != nil {
+			logger.Error("保存每日统计数据失败: %v", err)
+		}
+	}()
+}
+
+// pruneClientUsageLocked 清理超出保留天数的客户端用量（已加锁）
+func pruneClientUsageLocked() {
+	cutoff := StatsNow().AddDate(0, 0, -clientUsageRetentionDays).Format(StatsDateLayout)
+	for date := range dailyData.ClientsUsage {
+		if date < cutoff {
+			delete(dailyData.ClientsUsage, date)
+		}
+	}
+}
+
+// GetDailyClientStats 获取指定日期按请求数降序排列的客户端用量
+// limit大于0时只返回前limit个客户端，其余合并到other条目
+func GetDailyClientStats(date string, limit int) []ClientUsageEntry {
+	dailyDataLock.RLock()
+	var entries []ClientUsageEntry
+	var other ClientUsage
+	if dailyData != nil {
+		for client, usage := range dailyData.ClientsUsage[date] {
+			if client == ClientUsageOther {
+				other = usage
+				continue
+			}
+			entries = append(entries, ClientUsageEntry{Client: client, Status: GetClientTokenStatus(client), ClientUsage: usage})
+		}
+	}
+	dailyDataLock.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Requests != entries[j].Requests {
+			return entries[i].Requests > entries[j].Requests
+		}
+		return entries[i].Client < entries[j].Client
+	})
+
+	if limit > 0 && len(entries) > limit {
+		for _, entry := range entries[limit:] {
+			other.Requests += entry.Requests
+			other.PromptTokens += entry.PromptTokens
+			other.CompletionTokens += entry.CompletionTokens
+			other.Tokens += entry.Tokens
+		}
+		entries = entries[:limit]
+	}
+
+	if other.Requests > 0 || other.Tokens > 0 {
+		entries = append(entries, ClientUsageEntry{Client: ClientUsageOther, ClientUsage: other})
+	}
+
+	return entries
+}
+
+// GetClientUsageTotal 获取客户端在保留天数内的累计用量
+func GetClientUsageTotal(client string) ClientUsage {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	var total ClientUsage
+	if dailyData == nil {
+		return total
+	}
+	for _, clients := range dailyData.ClientsUsage {
+		usage := clients[client]
+		total.Requests += usage.Requests
+		total.PromptTokens += usage.PromptTokens
+		total.CompletionTokens += usage.CompletionTokens
+		total.Tokens += usage.Tokens
+	}
+	return total
+}
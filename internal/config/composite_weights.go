@@ -0,0 +1,34 @@
+/**
+  @author: Hanhai
+  @desc: 综合加权策略的权重配置，全部为0时使用默认权重
+**/
+
+package config
+
+// CompositeWeights 综合加权策略中余额、成功率和剩余RPM、TPM余量的权重，使用时按总和归一化
+type CompositeWeights struct {
+	Balance float64 `mapstructure:"balance" json:"balance"` // 归一化余额的权重
+	Success float64 `mapstructure:"success" json:"success"` // 成功率的权重
+	RPM     float64 `mapstructure:"rpm" json:"rpm"`         // 剩余RPM余量的权重
+	TPM     float64 `mapstructure:"tpm" json:"tpm"`         // 剩余TPM余量的权重
+}
+
+// DefaultCompositeWeights 未设置权重时使用的默认权重
+var DefaultCompositeWeights = CompositeWeights{Balance: 0.4, Success: 0.4, RPM: 0.1, TPM: 0.1}
+
+// Normalized 获取归一化后的权重，负数按0处理，全部为0时使用默认权重
+func (w CompositeWeights) Normalized() CompositeWeights {
+	clamp := func(v float64) float64 {
+		if v < 0 {
+			return 0
+		}
+		return v
+	}
+	w = CompositeWeights{Balance: clamp(w.Balance), Success: clamp(w.Success), RPM: clamp(w.RPM), TPM: clamp(w.TPM)}
+	total := w.Balance + w.Success + w.RPM + w.TPM
+	if total <= 0 {
+		w = DefaultCompositeWeights
+		total = w.Balance + w.Success + w.RPM + w.TPM
+	}
+	return CompositeWeights{Balance: w.Balance / total, Success: w.Success / total, RPM: w.RPM / total, TPM: w.TPM / total}
+}
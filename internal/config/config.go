@@ -6,18 +6,23 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"flowsilicon/internal/logger"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	config     *Config
-	configOnce sync.Once
-	apiKeys    []ApiKey
-	keysMutex  sync.RWMutex
+	// 当前配置快照，只通过UpdateConfig整体替换，快照本身不会被修改
+	currentConfig atomic.Pointer[Config]
+	configOnce    sync.Once
+	apiKeys       []ApiKey
+	apiKeysLoaded bool // 是否已从数据库或快照加载密钥池，由keysMutex保护
+	keysMutex     keyPoolMutex
 
 	// 请求统计相关
 	requestStats []RequestStats // 保存最近的请求统计数据
@@ -32,10 +37,15 @@ var (
 // Config 应用配置结构
 type Config struct {
 	Server struct {
-		Port int `mapstructure:"port"`
+		Port                   int      `mapstructure:"port" default:"3016"`
+		AllowPortFallback      bool     `mapstructure:"allow_port_fallback"`                   // 端口被占用时是否自动尝试后续10个端口
+		CustomDashboardDir     string   `mapstructure:"custom_dashboard_dir"`                  // 自定义仪表盘目录，设置后目录中的文件挂载到/custom/下
+		ShutdownTimeoutSeconds int      `mapstructure:"shutdown_timeout_seconds" default:"30"` // 退出或重启时等待正在处理的请求完成的最长时间（秒）
+		AllowedClientCIDRs     []string `mapstructure:"allowed_client_cidrs"`                  // 允许使用代理接口的客户端地址范围，为空时只允许本机，0.0.0.0/0表示允许所有地址
+		CorsAllowedOrigins     []string `mapstructure:"cors_allowed_origins"`                  // 允许跨域调用代理接口的来源，为空时不允许跨域调用，*表示允许任意来源
 	} `mapstructure:"server"`
 	ApiProxy struct {
-		BaseURL    string      `mapstructure:"base_url"`
+		BaseURL    string      `mapstructure:"base_url" default:"https://api.siliconflow.cn"`
 		ModelIndex int         `mapstructure:"model_index"` // 当前使用的模型索引
 		Retry      RetryConfig `mapstructure:"retry"`       // 重试配置
 	} `mapstructure:"api_proxy"`
@@ -48,67 +58,181 @@ type Config struct {
 	} `mapstructure:"proxy"`
 	// 添加Security字段，用于存储密码保护相关配置
 	Security struct {
-		PasswordEnabled   bool   `mapstructure:"password_enabled"`   // 是否启用密码保护
-		Password          string `mapstructure:"password"`           // 访问密码
-		ExpirationMinutes int    `mapstructure:"expiration_minutes"` // 登录过期时间（分钟），0表示关闭浏览器即过期
-		ApiKeyEnabled     bool   `mapstructure:"api_key_enabled"`    // 是否启用API密钥验证
-		ApiKey            string `mapstructure:"api_key"`            // API密钥
+		PasswordEnabled   bool     `mapstructure:"password_enabled"`   // 是否启用密码保护
+		Password          string   `mapstructure:"password"`           // 访问密码
+		ExpirationMinutes int      `mapstructure:"expiration_minutes"` // 登录过期时间（分钟），0表示关闭浏览器即过期
+		ApiKeyEnabled     bool     `mapstructure:"api_key_enabled"`    // 是否启用API密钥验证
+		ApiKey            string   `mapstructure:"api_key"`            // API密钥
+		AuthMode          string   `mapstructure:"auth_mode"`          // 代理验证方式，见AuthMode常量，为空时按api_key_enabled推断
+		ClientTokens      []string `mapstructure:"client_tokens"`      // token_list验证方式下允许的客户端令牌
+		// 按客户端令牌配置的每个请求的n或best_of上限，超过时拒绝请求，未配置或为0表示不限制
+		ClientTokenMaxChoices map[string]int `mapstructure:"client_token_max_choices"`
+		// 客户端令牌吊销
+		RevokedClientTokens     []RevokedClientToken `mapstructure:"revoked_client_tokens"`      // 已吊销的客户端令牌，仍保留在client_tokens中
+		TokenDeleteCoolingHours int                  `mapstructure:"token_delete_cooling_hours"` // 令牌吊销后需要等待多久才能永久删除（小时），0表示使用默认值
+		// 凭据紧急轮换
+		SessionSecret string `mapstructure:"session_secret"` // 登录会话的签名密钥，为空时使用内置的默认密钥，紧急轮换时重新生成
+		ProxyLocked   bool   `mapstructure:"proxy_locked"`   // 紧急轮换后锁定代理，所有代理请求返回503，发放新的客户端令牌或API密钥后解除
 	} `mapstructure:"security"`
 	App struct {
-		Title                  string  `mapstructure:"title"`                    // 应用标题
-		MinBalanceThreshold    float64 `mapstructure:"min_balance_threshold"`    // 最低余额阈值
-		MaxBalanceDisplay      float64 `mapstructure:"max_balance_display"`      // 余额显示最大值
-		ItemsPerPage           int     `mapstructure:"items_per_page"`           // 每页显示的密钥数量
-		MaxStatsEntries        int     `mapstructure:"max_stats_entries"`        // 最大统计条目数
-		RecoveryInterval       int     `mapstructure:"recovery_interval"`        // 恢复检查间隔（分钟）
-		MaxConsecutiveFailures int     `mapstructure:"max_consecutive_failures"` // 最大连续失败次数
+		Title                  string  `mapstructure:"title"`                                // 应用标题
+		MinBalanceThreshold    float64 `mapstructure:"min_balance_threshold"`                // 最低余额阈值
+		MaxBalanceDisplay      float64 `mapstructure:"max_balance_display" default:"14"`     // 余额显示最大值
+		ItemsPerPage           int     `mapstructure:"items_per_page" default:"5"`           // 每页显示的密钥数量
+		MaxStatsEntries        int     `mapstructure:"max_stats_entries" default:"60"`       // 最大统计条目数
+		RecoveryInterval       int     `mapstructure:"recovery_interval" default:"10"`       // 已不再使用，禁用密钥按恢复探测计划探测，保留以兼容旧的配置
+		MaxConsecutiveFailures int     `mapstructure:"max_consecutive_failures" default:"5"` // 最大连续失败次数
 		// 权重配置
 		BalanceWeight     float64 `mapstructure:"balance_weight"`      // 余额评分权重
 		SuccessRateWeight float64 `mapstructure:"success_rate_weight"` // 成功率评分权重
 		RPMWeight         float64 `mapstructure:"rpm_weight"`          // RPM评分权重
 		TPMWeight         float64 `mapstructure:"tpm_weight"`          // TPM评分权重
+		// 综合加权策略（策略9）的权重
+		CompositeWeights CompositeWeights `mapstructure:"composite_weights"`
 		// 自动更新配置
-		AutoUpdateInterval        int  `mapstructure:"auto_update_interval"`          // API密钥信息自动更新间隔（秒）
-		StatsRefreshInterval      int  `mapstructure:"stats_refresh_interval"`        // 系统概要自动刷新间隔（秒）
-		RateRefreshInterval       int  `mapstructure:"rate_refresh_interval"`         // 速率监控自动刷新间隔（秒）
-		AutoDeleteZeroBalanceKeys bool `mapstructure:"auto_delete_zero_balance_keys"` // 是否自动删除余额为0的密钥
-		RefreshUsedKeysInterval   int  `mapstructure:"refresh_used_keys_interval"`    // 刷新已使用密钥余额的间隔（分钟）
+		AutoUpdateInterval        int  `mapstructure:"auto_update_interval" default:"3600"`     // API密钥信息自动更新间隔（秒）
+		StatsRefreshInterval      int  `mapstructure:"stats_refresh_interval" default:"3600"`   // 系统概要自动刷新间隔（秒）
+		RateRefreshInterval       int  `mapstructure:"rate_refresh_interval" default:"3600"`    // 速率监控自动刷新间隔（秒）
+		AutoDeleteZeroBalanceKeys bool `mapstructure:"auto_delete_zero_balance_keys"`           // 是否自动删除余额为0的密钥
+		RefreshUsedKeysInterval   int  `mapstructure:"refresh_used_keys_interval" default:"60"` // 刷新已使用密钥余额的间隔（分钟）
 		// 模型特定的密钥选择策略
 		ModelKeyStrategies map[string]int `mapstructure:"model_key_strategies"` // 模型特定的密钥选择策略
+		// 模型级别的请求处理覆盖
+		ModelOverrides map[string]ModelOverride `mapstructure:"model_overrides"` // 按模型ID配置的请求处理覆盖
 		// 系统托盘图标设置
 		HideIcon bool `mapstructure:"hide_icon"` // 是否隐藏系统托盘图标
 		// 禁用的模型列表
 		DisabledModels []string `mapstructure:"disabled_models"` // 禁用的模型ID列表
+		// 密钥分组流量权重
+		KeyGroups []KeyGroupConfig `mapstructure:"key_groups"` // 密钥分组及其流量权重，为空时不分组
+		// 客户端用量统计
+		DisableClientUsage    bool `mapstructure:"disable_client_usage"`     // 是否关闭按客户端IP或令牌的用量统计
+		MaxClientUsageEntries int  `mapstructure:"max_client_usage_entries"` // 每天最多单独记录的客户端数量，0表示使用默认值
+		// 密钥池快照
+		SnapshotMaxAgeMinutes int `mapstructure:"snapshot_max_age_minutes"` // 启动时可直接加载的密钥池快照最大时长（分钟），0表示不使用快照
+		// 单个密钥的限流
+		KeyRPMLimit int `mapstructure:"key_rpm_limit"` // 单个密钥每分钟最大请求数，0表示不限制
+		KeyTPMLimit int `mapstructure:"key_tpm_limit"` // 单个密钥每分钟最大令牌数，0表示不限制
+		// 内存缓存
+		CacheMemoryBudgetMB int `mapstructure:"cache_memory_budget_mb"` // 所有内存缓存共享的内存预算（MB），0表示使用默认值
+		// 多级代理
+		UpstreamProxy      string `mapstructure:"upstream_proxy"`       // 上游FlowSilicon实例的地址，设置后不选择本地密钥，直接将请求转发到上游实例
+		UpstreamProxyToken string `mapstructure:"upstream_proxy_token"` // 转发到上游实例时使用的访问令牌
+		MaxHops            int    `mapstructure:"max_hops"`             // 请求最多经过的FlowSilicon实例数，0表示使用默认值
+		// 虚拟模型
+		ModelMappings      map[string]string `mapstructure:"model_mappings"`       // 虚拟模型名称到上游模型ID的映射，虚拟模型会出现在模型列表中
+		HideUpstreamModels bool              `mapstructure:"hide_upstream_models"` // 是否在模型列表中隐藏被虚拟模型映射的上游模型
+		// 流式响应超时
+		StreamFirstByteTimeoutSeconds int `mapstructure:"stream_first_byte_timeout_seconds"` // 等待上游返回第一条流式数据的最长时间（秒），超时后换密钥重试，0表示不限制
+		StreamIdleTimeoutSeconds      int `mapstructure:"stream_idle_timeout_seconds"`       // 收到第一条数据后两次数据之间的最长等待时间（秒），0表示使用默认值
+		StreamMaxEventKB              int `mapstructure:"stream_max_event_kb"`               // 单个流式事件参与解析的最大大小（KB），超出的事件原样转发不解析，0表示使用默认值
+		// 版本回滚
+		AllowVersionRollback bool   `mapstructure:"allow_version_rollback"` // 是否允许将数据目录的版本号回滚到上一个版本，默认关闭
+		Version              string `mapstructure:"version"`                // 加载配置时数据库中的版本号，数据库不可用时作为版本号显示，不需要手动设置
+		// 客户端错误率限流
+		AbuseThrottleErrorRate   float64 `mapstructure:"abuse_throttle_error_rate"`   // 客户端最近24小时的错误率超过该值时临时降低其限流，0表示不自动限流
+		AbuseThrottleMinRequests int     `mapstructure:"abuse_throttle_min_requests"` // 计算错误率所需的最少请求数，0表示使用默认值
+		AbuseThrottleRPM         int     `mapstructure:"abuse_throttle_rpm"`          // 被限流的客户端每分钟最多请求数，0表示使用默认值
+		AbuseThrottleMinutes     int     `mapstructure:"abuse_throttle_minutes"`      // 限流持续的时间（分钟），0表示使用默认值
+		// 密钥平滑指标
+		MetricsHalfLifeSeconds int `mapstructure:"metrics_half_life_seconds"` // 密钥RPM、TPM、成功率和延迟指数加权平均的半衰期（秒），0表示使用默认值
+		// 上游并发限制
+		MaxConcurrentRequests      int  `mapstructure:"max_concurrent_requests"`       // 同时转发到上游的最大请求数，关闭自适应时生效，0表示不限制
+		AdaptiveConcurrency        bool `mapstructure:"adaptive_concurrency"`          // 是否按上游首字节延迟自动调整并发上限，默认关闭
+		AdaptiveConcurrencyMin     int  `mapstructure:"adaptive_concurrency_min"`      // 自适应并发上限的最小值，0表示使用默认值
+		AdaptiveConcurrencyMax     int  `mapstructure:"adaptive_concurrency_max"`      // 自适应并发上限的最大值，0表示使用max_concurrent_requests或默认值
+		AdaptiveLatencyThresholdMs int  `mapstructure:"adaptive_latency_threshold_ms"` // 首字节延迟P95超过该值时降低并发上限（毫秒），0表示使用默认值
+		// 密钥选择决策日志
+		DecisionLogSampleRate  float64 `mapstructure:"decision_log_sample_rate"`  // 决策日志记录的请求比例（0-1），0表示记录全部请求
+		DecisionLogMaxSizeMB   int     `mapstructure:"decision_log_max_size_mb"`  // 单个决策日志文件的最大大小（MB），0表示使用默认值
+		DecisionLogMaxFiles    int     `mapstructure:"decision_log_max_files"`    // 保留的轮转决策日志文件数量，0表示使用默认值
+		DecisionLogPrivacyMode bool    `mapstructure:"decision_log_privacy_mode"` // 隐私模式，开启后决策日志不记录由请求内容推算的字段
+		// 图片托管
+		ImageHosting           bool   `mapstructure:"image_hosting"`             // 是否把图片生成响应中的base64图片保存到本地，并改写为FlowSilicon提供的图片地址，默认关闭
+		ImageHostingTTLMinutes int    `mapstructure:"image_hosting_ttl_minutes"` // 托管图片的保留时间（分钟），0表示使用默认值
+		ImageHostingQuotaMB    int    `mapstructure:"image_hosting_quota_mb"`    // 托管图片占用的最大磁盘空间（MB），超出时删除最早的图片，0表示使用默认值
+		PublicBaseURL          string `mapstructure:"public_base_url"`           // 客户端访问FlowSilicon的地址，包含协议和路径前缀，为空时按请求的地址生成
+		PrivacyMode            bool   `mapstructure:"privacy_mode"`              // 隐私模式，开启后不在本地磁盘保存生成的内容，图片托管不生效
+		// 统计时区
+		StatsTimezone string `mapstructure:"stats_timezone"` // 每日统计划分日期使用的时区（IANA名称，例如Asia/Shanghai），为空时使用系统时区
+		// 休眠唤醒后的补执行
+		CatchUpMaxAgeHours   int `mapstructure:"catch_up_max_age_hours"`  // 休眠期间错过的定时任务超过该时间（小时）时不再补执行，0表示使用默认值
+		CatchUpSpreadMinutes int `mapstructure:"catch_up_spread_minutes"` // 唤醒后补执行的定时任务错开执行的时间范围（分钟），0表示使用默认值
+		// 换密钥重试
+		MaxRetries               int `mapstructure:"max_retries"`                 // 上游返回429、408、5xx、401或余额不足时最多换几个密钥重试，0表示使用默认值，小于0表示不重试
+		RateLimitCooldownSeconds int `mapstructure:"rate_limit_cooldown_seconds"` // 密钥被上游限流后不参与选择的时间（秒），上游返回Retry-After时以其为准，0表示使用默认值
+		// 密钥断路器
+		CircuitBreakerThreshold         int `mapstructure:"circuit_breaker_threshold"`           // 密钥连续被上游限流的次数达到该值时断开，断开期间不参与选择，0表示不启用
+		CircuitBreakerMaxBackoffMinutes int `mapstructure:"circuit_breaker_max_backoff_minutes"` // 断开时间从30秒开始、每次探测失败后翻倍的最大值（分钟），0表示使用默认值
+		// 禁用密钥的恢复探测
+		RecoveryGiveUpHours int `mapstructure:"recovery_give_up_hours"` // 禁用的密钥超过该时间（小时）仍未恢复时放弃恢复，不再探测，等待手动处理，0表示使用默认值
+		// 上下文长度检查
+		EnforceContextLimits bool `mapstructure:"enforce_context_limits"` // 是否在选择密钥前预估输入令牌数，超过模型上下文长度的请求直接返回400，默认关闭
 	} `mapstructure:"app"`
 	Log struct {
-		MaxSizeMB int    `mapstructure:"max_size_mb"` // 日志文件最大大小（MB）
-		Level     string `mapstructure:"level"`       // 日志等级（debug, info, warn, error, fatal）
+		MaxSizeMB   int    `mapstructure:"max_size_mb" default:"1"` // 日志文件最大大小（MB）
+		Level       string `mapstructure:"level" default:"warn"`    // 日志等级（debug, info, warn, error, fatal）
+		MultiOutput bool   `mapstructure:"multi_output"`            // GUI模式下是否同时输出到标准输出，便于容器运行时收集日志
+		MaxFiles    int    `mapstructure:"max_files" default:"5"`   // 保留的归档日志文件数量
+		MinFiles    int    `mapstructure:"min_files" default:"2"`   // 清理时至少保留的归档日志文件数量，大于MaxFiles时以此为准
+		// 访问日志
+		AccessLogFile   string `mapstructure:"access_log_file"`   // 访问日志文件路径，为空时不记录访问日志
+		AccessLogFormat string `mapstructure:"access_log_format"` // 访问日志格式（combined, json），为空时使用combined
 	} `mapstructure:"log"`
+	// API版本相关配置
+	API struct {
+		DeprecatedPaths map[string]string `mapstructure:"deprecated_paths"` // 即将废弃的接口路径及其下线日期
+	} `mapstructure:"api"`
+	// 影子流量配置
+	ShadowTraffic ShadowTrafficConfig `mapstructure:"shadow_traffic"`
+	// 通知配置
+	Notification NotificationConfig `mapstructure:"notification"`
+	// 公开状态数据配置
+	StatusFeed StatusFeedConfig `mapstructure:"status_feed"`
+	// Prometheus指标接口配置
+	Metrics MetricsConfig `mapstructure:"metrics"`
+	// 发往各服务商的请求附加的请求头和签名
+	Providers []ProviderRequestConfig `mapstructure:"providers"`
 }
 
 // ApiKey API密钥结构
 type ApiKey struct {
+	ID       int     `json:"id"` // 数据库记录ID
 	Key      string  `json:"key"`
 	Balance  float64 `json:"balance"`
 	LastUsed int64   `json:"last_used"` // Unix时间戳
 	// 新增字段
 	TotalCalls          int     `json:"total_calls"`          // 总调用次数
 	SuccessCalls        int     `json:"success_calls"`        // 成功调用次数
-	SuccessRate         float64 `json:"success_rate"`         // 成功率
+	SuccessRate         float64 `json:"success_rate"`         // 成功率，不包括客户端错误
+	ClientErrors        int     `json:"client_errors"`        // 客户端原因导致的错误次数，计入总调用次数但不计入成功率
 	ConsecutiveFailures int     `json:"consecutive_failures"` // 连续失败次数
 	Disabled            bool    `json:"disabled"`             // 是否禁用
 	DisabledAt          int64   `json:"disabled_at"`          // 禁用时间戳
 	LastTested          int64   `json:"last_tested"`          // 最后一次测试时间戳
 	// 新增RPM和TPM统计
-	RequestsPerMinute int            `json:"rpm"` // 每分钟请求数
-	TokensPerMinute   int            `json:"tpm"` // 每分钟令牌数
-	RecentRequests    []RequestStats `json:"-"`   // 最近的请求统计，不序列化
+	RPM            RateLimitWindow `json:"rpm"` // 每分钟请求数窗口
+	TPM            RateLimitWindow `json:"tpm"` // 每分钟令牌数窗口
+	RecentRequests []RequestStats  `json:"-"`   // 最近的请求统计，不序列化
 	// 新增得分字段
 	Score float64 `json:"score"` // 综合得分
 	// 新增删除标记字段
 	Delete bool `json:"delete"` // 是否标记为删除
 	// 新增使用标记字段
 	IsUsed bool `json:"is_used"` // 是否被使用过
+	// 所属分组
+	Group string `json:"group"` // 密钥分组名称，为空表示默认分组
+	// 余额模式
+	BalanceMode    string  `json:"balance_mode"`     // 余额模式：auto、manual、untracked，为空表示auto
+	CostPerRequest float64 `json:"cost_per_request"` // 手动余额模式下每次请求扣减的预估费用，0表示不扣减
+	// 密钥所属的服务商
+	Provider string `json:"provider"` // 服务商类型，默认为openai（OpenAI兼容接口）
+	// 密钥标签，以auto:开头的为自动推断的标签
+	Tags []string `json:"tags"`
+	// 密钥备注名
+	Alias string `json:"alias"`
+	// 添加时间戳，旧版本添加的密钥为0
+	AddedAt int64 `json:"added_at"`
 }
 
 // RequestStats 请求统计结构
@@ -126,8 +250,8 @@ type RetryConfig struct {
 	RetryOnNetworkErrors bool  `yaml:"retry_on_network_errors" mapstructure:"retry_on_network_errors"` // 是否对网络错误进行重试
 }
 
-// standardizeModelKeyStrategies 统一模型名称的大小写处理
-func standardizeModelKeyStrategies() {
+// standardizeModelKeyStrategies 统一模型名称的大小写处理，在配置发布前调用
+func standardizeModelKeyStrategies(config *Config) {
 	if config == nil || config.App.ModelKeyStrategies == nil {
 		return
 	}
@@ -147,17 +271,70 @@ func standardizeModelKeyStrategies() {
 	logger.Info("模型策略配置标准化完成: %v", config.App.ModelKeyStrategies)
 }
 
-// GetConfig 获取配置
+// GetConfig 获取当前配置的只读快照
+// 返回的快照在其他goroutine中也会被读取，调用方不能修改其中的字段、映射和切片，
+// 需要修改配置时先用Clone复制，修改副本后通过UpdateConfig发布；
+// 同一次请求中需要读取多个配置项时只调用一次，使用同一个快照
 func GetConfig() *Config {
+	return currentConfig.Load()
+}
+
+// Clone 深拷贝配置，修改副本不会影响正在使用的快照
+// 配置以JSON保存，按JSON复制可以覆盖所有持久化的字段
+func (c *Config) Clone() *Config {
+	if c == nil {
+		return nil
+	}
+	var clone Config
+	data, err := json.Marshal(c)
+	if err == nil {
+		err = json.Unmarshal(data, &clone)
+	}
+	if err != nil {
+		// 不会发生，配置只包含可以JSON序列化的字段；失败时退回浅拷贝
+		logger.Error("复制配置失败: %v", err)
+		clone = *c
+	}
+	return &clone
+}
+
+// 临时的上游地址覆盖，仅在内存中生效，不会写入数据库
+var upstreamOverride string
 
-	return config
+// SetUpstreamOverride 设置临时的上游地址覆盖，用于将所有上游请求发往模拟上游
+func SetUpstreamOverride(baseURL string) {
+	upstreamOverride = strings.TrimSuffix(baseURL, "/")
 }
 
-// GetApiKeys 获取所有API密钥
-func GetApiKeys() []ApiKey {
+// GetUpstreamOverride 获取临时的上游地址覆盖，未设置时返回空字符串
+func GetUpstreamOverride() string {
+	return upstreamOverride
+}
+
+// GetApiBaseURL 获取上游API基础地址，设置了临时覆盖时优先使用覆盖地址
+func GetApiBaseURL() string {
+	config := GetConfig()
+	if upstreamOverride != "" {
+		return upstreamOverride
+	}
+	if config == nil {
+		return ""
+	}
+	return config.ApiProxy.BaseURL
+}
+
+// ErrKeysNotInitialised 密钥池尚未加载，通常是启动时加载API密钥失败
+var ErrKeysNotInitialised = errors.New("API密钥尚未加载，请检查启动时加载API密钥是否失败")
+
+// GetApiKeys 获取所有API密钥，尚未调用LoadApiKeys加载密钥池时返回ErrKeysNotInitialised
+func GetApiKeys() ([]ApiKey, error) {
 	keysMutex.RLock()
 	defer keysMutex.RUnlock()
 
+	if !apiKeysLoaded {
+		return nil, ErrKeysNotInitialised
+	}
+
 	// 过滤掉标记为删除的密钥
 	filteredKeys := make([]ApiKey, 0, len(apiKeys))
 	for _, key := range apiKeys {
@@ -169,7 +346,18 @@ func GetApiKeys() []ApiKey {
 	// 返回副本以避免外部修改
 	keysCopy := make([]ApiKey, len(filteredKeys))
 	copy(keysCopy, filteredKeys)
-	return keysCopy
+	return keysCopy, nil
+}
+
+// ReplaceApiKeys 用给定的密钥列表替换内存中的密钥池，不写入数据库
+func ReplaceApiKeys(keys []ApiKey) {
+	keysMutex.Lock()
+	apiKeys = make([]ApiKey, len(keys))
+	copy(apiKeys, keys)
+	apiKeysLoaded = true
+	keysMutex.Unlock()
+
+	notifyApiKeyChanges()
 }
 
 // MaskKey 遮盖API密钥，只显示前4位和后4位
@@ -183,22 +371,39 @@ func MaskKey(key string) string {
 	return prefix + "..." + suffix
 }
 
-// AddApiKey 添加新的API密钥
-func AddApiKey(key string, balance float64) {
+// CanonicalApiKey 获取密钥的规范形式，去掉复制时带入的空白和Bearer前缀，保存和比较密钥时使用
+func CanonicalApiKey(key string) string {
+	key = strings.TrimSpace(key)
+	if len(key) > len("Bearer ") && strings.EqualFold(key[:len("Bearer ")], "Bearer ") {
+		key = strings.TrimSpace(key[len("Bearer "):])
+	}
+	return key
+}
+
+// AddApiKey 添加新的API密钥，密钥已存在时更新余额，被删除的密钥会恢复
+// 返回添加或更新后的密钥和密钥是否已存在，检查和添加在同一次加锁中完成，并发添加同一个密钥只会有一条记录
+func AddApiKey(key string, balance float64) (ApiKey, bool) {
+	config := GetConfig()
+	key = CanonicalApiKey(key)
+	// 在释放密钥锁之后通知订阅者
+	defer notifyApiKeyChanges()
+
 	keysMutex.Lock()
 	defer keysMutex.Unlock()
 
 	// 检查密钥是否已存在（包括被逻辑删除的密钥）
 	for i, k := range apiKeys {
-		if k.Key == key {
+		if CanonicalApiKey(k.Key) == key {
+			existed := !apiKeys[i].Delete
 			// 更新现有密钥的余额
 			apiKeys[i].Balance = balance
 			// 如果密钥被标记为删除，恢复它
 			if apiKeys[i].Delete {
 				apiKeys[i].Delete = false
+				apiKeys[i].AddedAt = time.Now().Unix()
 			}
 			// 检查余额并设置禁用状态
-			if balance < config.App.MinBalanceThreshold {
+			if !apiKeys[i].HasSufficientBalance(config.App.MinBalanceThreshold) {
 				apiKeys[i].Disabled = true
 				apiKeys[i].DisabledAt = time.Now().Unix()
 			} else {
@@ -210,30 +415,7 @@ func AddApiKey(key string, balance float64) {
 			if err := AddApiKeyToDB(apiKeys[i]); err != nil {
 				logger.Error("保存API密钥到数据库失败: %v", err)
 			}
-			return
-		}
-	}
-
-	// 检查数据库中是否存在被逻辑删除的密钥
-	if db != nil {
-		var exists bool
-		var isDeleted bool
-		err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM `+apikeysTableName+` WHERE key = ?), 
-			(SELECT is_delete FROM `+apikeysTableName+` WHERE key = ?)`, key, key).Scan(&exists, &isDeleted)
-
-		if err == nil && exists && isDeleted {
-			// 密钥存在但被逻辑删除，恢复它
-			_, err := db.Exec(`UPDATE `+apikeysTableName+` SET is_delete = ?, balance = ? WHERE key = ?`,
-				false, balance, key)
-			if err == nil {
-				// 重新加载密钥
-				if loadErr := LoadApiKeysFromDB(); loadErr != nil {
-					logger.Error("恢复密钥后重新加载密钥失败: %v", loadErr)
-				}
-				return
-			} else {
-				logger.Error("从数据库恢复逻辑删除的密钥失败: %v", err)
-			}
+			return apiKeys[i], existed
 		}
 	}
 
@@ -241,6 +423,14 @@ func AddApiKey(key string, balance float64) {
 	newKey := ApiKey{
 		Key:     key,
 		Balance: balance,
+		AddedAt: time.Now().Unix(),
+	}
+
+	// 数据库中已有但未加载的密钥（例如被逻辑删除或由其他实例添加）沿用原来的记录ID，不替换为新的记录
+	if dbWritable() {
+		if id, err := getApiKeyIDFromDB(key); err == nil {
+			newKey.ID = id
+		}
 	}
 
 	// 检查余额并设置初始禁用状态
@@ -254,11 +444,18 @@ func AddApiKey(key string, balance float64) {
 	// 保存新密钥到数据库
 	if err := AddApiKeyToDB(newKey); err != nil {
 		logger.Error("添加API密钥到数据库失败: %v", err)
+	} else if newKey.ID == 0 {
+		// 记录数据库分配的ID
+		if id, err := getApiKeyIDFromDB(key); err == nil {
+			apiKeys[len(apiKeys)-1].ID = id
+		}
 	}
+	return apiKeys[len(apiKeys)-1], false
 }
 
 // UpdateApiKeyBalance 更新API密钥余额
 func UpdateApiKeyBalance(key string, balance float64) bool {
+	config := GetConfig()
 	keysMutex.Lock()
 	defer keysMutex.Unlock()
 
@@ -280,7 +477,7 @@ func UpdateApiKeyBalance(key string, balance float64) bool {
 	}
 
 	// 余额低于阈值时禁用密钥
-	if balance < config.App.MinBalanceThreshold {
+	if !apiKeys[keyIndex].HasSufficientBalance(config.App.MinBalanceThreshold) {
 		apiKeys[keyIndex].Disabled = true
 		apiKeys[keyIndex].DisabledAt = time.Now().Unix()
 		logger.Info("API密钥 %s 余额 %.2f 低于阈值 %.2f，已自动禁用",
@@ -288,7 +485,7 @@ func UpdateApiKeyBalance(key string, balance float64) bool {
 	}
 
 	// 保存更新到数据库
-	if db != nil {
+	if dbWritable() {
 		result, err := ExecWithRetry(
 			"更新API密钥余额",
 			3,
@@ -323,7 +520,7 @@ func UpdateApiKeyLastUsed(key string, timestamp int64) bool {
 			apiKeys[i].LastUsed = timestamp
 
 			// 保存更新到数据库
-			if db != nil {
+			if dbWritable() {
 				// 添加重试逻辑，最多尝试3次
 				var err error
 				for retries := 0; retries < 3; retries++ {
@@ -367,7 +564,7 @@ func MarkApiKeyAsUsed(key string) bool {
 			apiKeys[i].IsUsed = true
 
 			// 保存更新到数据库
-			if db != nil {
+			if dbWritable() {
 				// 添加重试逻辑，最多尝试3次
 				var err error
 				for retries := 0; retries < 3; retries++ {
@@ -493,7 +690,7 @@ func calculateScore(key ApiKey) float64 {
 
 	// 1. 余额得分（余额越高，得分越高）
 	// 使用归一化的余额值计算得分
-	balanceScore := (key.Balance / maxBalance) * balanceWeight
+	balanceScore := key.BalanceRatio(maxBalance) * balanceWeight
 	if balanceScore > balanceWeight {
 		balanceScore = balanceWeight // 确保不超过权重上限
 	}
@@ -509,10 +706,10 @@ func calculateScore(key ApiKey) float64 {
 
 	// 3. RPM得分（RPM越低，得分越高）
 	rpmScore := 0.0
-	if key.RequestsPerMinute > 0 {
+	if key.RPM.Current() > 0 {
 		// 使用1减去归一化的RPM值，这样RPM越低得分越高
 		// 假设最大RPM为100，可以根据实际情况调整
-		rpmScore = (1 - float64(key.RequestsPerMinute)/100.0) * rpmWeight
+		rpmScore = (1 - float64(key.RPM.Current())/100.0) * rpmWeight
 		if rpmScore < 0 {
 			rpmScore = 0 // 防止负分
 		}
@@ -522,10 +719,10 @@ func calculateScore(key ApiKey) float64 {
 
 	// 4. TPM得分（TPM越低，得分越高）
 	tpmScore := 0.0
-	if key.TokensPerMinute > 0 {
+	if key.TPM.Current() > 0 {
 		// 使用1减去归一化的TPM值，这样TPM越低得分越高
 		// 假设最大TPM为5000，可以根据实际情况调整
-		tpmScore = (1 - float64(key.TokensPerMinute)/5000.0) * tpmWeight
+		tpmScore = (1 - float64(key.TPM.Current())/5000.0) * tpmWeight
 		if tpmScore < 0 {
 			tpmScore = 0 // 防止负分
 		}
@@ -548,11 +745,14 @@ func UpdateApiKeySuccess(key string) bool {
 		if k.Key == key {
 			apiKeys[i].TotalCalls++
 			apiKeys[i].SuccessCalls++
-			apiKeys[i].SuccessRate = float64(apiKeys[i].SuccessCalls) / float64(apiKeys[i].TotalCalls)
+			recomputeSuccessRateLocked(&apiKeys[i])
 			apiKeys[i].ConsecutiveFailures = 0
 
+			// 手动余额模式的密钥按预估费用扣减余额
+			balanceDeducted := deductManualBalanceLocked(i)
+
 			// 保存更新到数据库
-			if db != nil {
+			if dbWritable() {
 				// 添加重试逻辑，最多尝试3次
 				var err error
 				for retries := 0; retries < 3; retries++ {
@@ -579,6 +779,21 @@ func UpdateApiKeySuccess(key string) bool {
 				if err != nil {
 					logger.Error("更新API密钥成功调用统计到数据库失败: %v", err)
 				}
+
+				if balanceDeducted {
+					_, err = ExecWithRetry(
+						"更新API密钥手动余额",
+						3,
+						"UPDATE "+apikeysTableName+" SET balance = ?, disabled = ?, disabled_at = ? WHERE key = ?",
+						apiKeys[i].Balance,
+						apiKeys[i].Disabled,
+						apiKeys[i].DisabledAt,
+						key,
+					)
+					if err != nil {
+						logger.Error("更新API密钥手动余额到数据库失败: %v", err)
+					}
+				}
 			}
 
 			return true
@@ -596,11 +811,11 @@ func UpdateApiKeyFailure(key string) bool {
 	for i, k := range apiKeys {
 		if k.Key == key {
 			apiKeys[i].TotalCalls++
-			apiKeys[i].SuccessRate = float64(apiKeys[i].SuccessCalls) / float64(apiKeys[i].TotalCalls)
+			recomputeSuccessRateLocked(&apiKeys[i])
 			apiKeys[i].ConsecutiveFailures++
 
 			// 保存更新到数据库
-			if db != nil {
+			if dbWritable() {
 				// 添加重试逻辑，最多尝试3次
 				var err error
 				for retries := 0; retries < 3; retries++ {
@@ -672,7 +887,7 @@ func DisableApiKey(key string) bool {
 	keysMutex.Unlock()
 
 	// 保存更新到数据库
-	if db != nil {
+	if dbWritable() {
 		_, err := db.Exec(`UPDATE `+apikeysTableName+` 
 			SET disabled = ?, disabled_at = ? 
 			WHERE key = ?`,
@@ -684,11 +899,13 @@ func DisableApiKey(key string) bool {
 		}
 	}
 
+	notifyApiKeyChanges()
 	return true
 }
 
 // EnableApiKey 启用API密钥
 func EnableApiKey(key string) bool {
+	config := GetConfig()
 	keysMutex.Lock()
 
 	var keyFound bool
@@ -705,7 +922,7 @@ func EnableApiKey(key string) bool {
 			keyFound = true
 
 			// 如果余额不足，不允许启用
-			if k.Balance < minThreshold {
+			if !k.HasSufficientBalance(minThreshold) {
 				logger.Error("无法启用API密钥 %s：余额 %.2f 低于阈值 %.2f",
 					MaskKey(key), k.Balance, minThreshold)
 				keysMutex.Unlock()
@@ -736,7 +953,7 @@ func EnableApiKey(key string) bool {
 	keysMutex.Unlock()
 
 	// 保存更新到数据库
-	if db != nil {
+	if dbWritable() {
 		_, err := db.Exec(`UPDATE `+apikeysTableName+` 
 			SET disabled = ?, disabled_at = ?, consecutive_failures = ? 
 			WHERE key = ?`,
@@ -748,6 +965,7 @@ func EnableApiKey(key string) bool {
 		}
 	}
 
+	notifyApiKeyChanges()
 	return true
 }
 
@@ -768,6 +986,7 @@ func UpdateApiKeyLastTested(key string, timestamp int64) bool {
 
 // SortApiKeysByPriority 按优先级排序API密钥（基于多维度加权评分）
 func SortApiKeysByPriority() {
+	config := GetConfig()
 	keysMutex.Lock()
 	defer keysMutex.Unlock()
 
@@ -776,7 +995,7 @@ func SortApiKeysByPriority() {
 	minBalanceThreshold := config.App.MinBalanceThreshold // 使用MinBalanceThreshold常量
 
 	for _, k := range apiKeys {
-		if !k.Disabled && k.Balance >= minBalanceThreshold {
+		if !k.Disabled && k.HasSufficientBalance(minBalanceThreshold) {
 			activeKeys = append(activeKeys, k)
 		}
 	}
@@ -791,14 +1010,14 @@ func SortApiKeysByPriority() {
 	var maxRPM, maxTPM int
 
 	for _, k := range activeKeys {
-		if k.Balance > maxBalance {
+		if k.IsBalanceTracked() && k.Balance > maxBalance {
 			maxBalance = k.Balance
 		}
-		if k.RequestsPerMinute > maxRPM {
-			maxRPM = k.RequestsPerMinute
+		if k.RPM.Current() > maxRPM {
+			maxRPM = k.RPM.Current()
 		}
-		if k.TokensPerMinute > maxTPM {
-			maxTPM = k.TokensPerMinute
+		if k.TPM.Current() > maxTPM {
+			maxTPM = k.TPM.Current()
 		}
 	}
 
@@ -854,7 +1073,7 @@ func SortApiKeysByPriority() {
 
 	for _, k := range activeKeys {
 		// 1. 余额得分（余额越高，得分越高）
-		balanceScore := (k.Balance / maxBalance) * balanceWeight
+		balanceScore := k.BalanceRatio(maxBalance) * balanceWeight
 
 		// 2. 成功率得分（成功率越高，得分越高）
 		successRateScore := 0.0
@@ -867,16 +1086,16 @@ func SortApiKeysByPriority() {
 
 		// 3. RPM得分（RPM越低，得分越高）
 		rpmScore := 0.0
-		if k.RequestsPerMinute > 0 {
-			rpmScore = (1 - float64(k.RequestsPerMinute)/float64(maxRPM)) * rpmWeight
+		if k.RPM.Current() > 0 {
+			rpmScore = (1 - float64(k.RPM.Current())/float64(maxRPM)) * rpmWeight
 		} else {
 			rpmScore = rpmWeight // 如果RPM为0，给予最高分
 		}
 
 		// 4. TPM得分（TPM越低，得分越高）
 		tpmScore := 0.0
-		if k.TokensPerMinute > 0 {
-			tpmScore = (1 - float64(k.TokensPerMinute)/float64(maxTPM)) * tpmWeight
+		if k.TPM.Current() > 0 {
+			tpmScore = (1 - float64(k.TPM.Current())/float64(maxTPM)) * tpmWeight
 		} else {
 			tpmScore = tpmWeight // 如果TPM为0，给予最高分
 		}
@@ -919,7 +1138,7 @@ func SortApiKeysByPriority() {
 
 	// 将余额不足的密钥添加到禁用密钥之前
 	for _, k := range apiKeys {
-		if !k.Disabled && k.Balance < minBalanceThreshold {
+		if !k.Disabled && !k.HasSufficientBalance(minBalanceThreshold) {
 			sortedKeys = append(sortedKeys, k)
 		}
 	}
@@ -930,12 +1149,17 @@ func SortApiKeysByPriority() {
 
 // GetActiveApiKeys 获取所有未禁用且余额充足的API密钥
 func GetActiveApiKeys() []ApiKey {
-	allKeys := GetApiKeys() // 已经过滤掉标记为删除的密钥
+	config := GetConfig()
+	allKeys, err := GetApiKeys() // 已经过滤掉标记为删除的密钥
+	if err != nil {
+		logger.Error("获取可用的API密钥失败: %v", err)
+		return nil
+	}
 
 	// 筛选出未禁用且余额充足的密钥
 	var activeKeys []ApiKey
 	for _, key := range allKeys {
-		if !key.Disabled && key.Balance >= config.App.MinBalanceThreshold {
+		if !key.Disabled && key.HasSufficientBalance(config.App.MinBalanceThreshold) {
 			activeKeys = append(activeKeys, key)
 		}
 	}
@@ -945,7 +1169,11 @@ func GetActiveApiKeys() []ApiKey {
 
 // GetDisabledApiKeys 获取所有禁用的API密钥
 func GetDisabledApiKeys() []ApiKey {
-	allKeys := GetApiKeys() // 已经过滤掉标记为删除的密钥
+	allKeys, err := GetApiKeys() // 已经过滤掉标记为删除的密钥
+	if err != nil {
+		logger.Error("获取禁用的API密钥失败: %v", err)
+		return nil
+	}
 
 	// 筛选出已禁用的密钥
 	var disabledKeys []ApiKey
@@ -960,6 +1188,7 @@ func GetDisabledApiKeys() []ApiKey {
 
 // AddRequestStat 添加请求统计数据
 func AddRequestStat(requestCount, tokenCount int) {
+	config := GetConfig()
 	statsLock.Lock()
 	defer statsLock.Unlock()
 
@@ -1012,6 +1241,7 @@ func isSameMinute(ts1, ts2 int64) bool {
 
 // UpdateApiKeyRequestStats 更新API密钥的请求系统概要
 func UpdateApiKeyRequestStats(key string, requestCount, tokenCount int) bool {
+	config := GetConfig()
 	keysMutex.Lock()
 	defer keysMutex.Unlock()
 
@@ -1039,35 +1269,23 @@ func UpdateApiKeyRequestStats(key string, requestCount, tokenCount int) bool {
 				apiKeys[i].RecentRequests[lastIdx].TokenCount += tokenCount
 			}
 
-			// 计算最近5分钟的平均RPM和TPM
-			totalRequests := 0
-			totalTokens := 0
-
 			// 清理过期的请求记录（超过5分钟的）
 			fiveMinutesAgo := now - 300 // 5分钟 = 300秒
 			var validRequests []RequestStats
-
 			for _, stat := range apiKeys[i].RecentRequests {
 				if stat.Timestamp >= fiveMinutesAgo {
 					validRequests = append(validRequests, stat)
-					totalRequests += stat.RequestCount
-					totalTokens += stat.TokenCount
 				}
 			}
-
-			// 更新有效的请求记录
 			apiKeys[i].RecentRequests = validRequests
 
-			// 计算平均值
-			minutes := len(apiKeys[i].RecentRequests)
-			if minutes > 0 {
-				apiKeys[i].RequestsPerMinute = totalRequests / minutes
-				apiKeys[i].TokensPerMinute = totalTokens / minutes
-			} else {
-				// 如果没有有效记录，将RPM和TPM设置为0
-				apiKeys[i].RequestsPerMinute = 0
-				apiKeys[i].TokensPerMinute = 0
+			// 累加当前窗口的RPM和TPM，窗口过期时自动清零
+			if config != nil {
+				apiKeys[i].RPM.Limit = config.App.KeyRPMLimit
+				apiKeys[i].TPM.Limit = config.App.KeyTPMLimit
 			}
+			apiKeys[i].RPM.Add(requestCount)
+			apiKeys[i].TPM.Add(tokenCount)
 
 			return true
 		}
@@ -1083,6 +1301,8 @@ func AddKeyRequestStat(key string, requestCount, tokenCount int) {
 
 	// 更新特定密钥的统计
 	UpdateApiKeyRequestStats(key, requestCount, tokenCount)
+	addKeyUsage(key, requestCount)
+	addKeyIntervalUsage(key, requestCount, tokenCount)
 
 	// 每次请求后重新排序密钥，确保轮询算法使用最新的优先级
 	SortApiKeysByPriority()
@@ -1118,8 +1338,13 @@ func GetCurrentRequestStats() (int, int) {
 	return requestCount, tokenCount
 }
 
-// SaveApiKeys 保存API密钥到数据库
+// SaveApiKeys 保存API密钥到数据库，只读数据库模式下不保存
 func SaveApiKeys() error {
+	if IsReadOnlyDatabase() {
+		logger.Debug("配置数据库为只读模式，跳过保存API密钥")
+		return nil
+	}
+
 	err := SaveApiKeysToDB()
 	if err != nil {
 		logger.Error("保存API密钥到数据库失败: %v", err)
@@ -1190,22 +1415,26 @@ func GetCurrentTPD() int {
 	return totalTokens
 }
 
-// UpdateConfig 更新全局配置
+// UpdateConfig 发布新的配置快照，发布的是newConfig的深拷贝
+// 调用方之后修改newConfig中的字段、映射和切片不会影响其他goroutine正在读取的快照
 func UpdateConfig(newConfig *Config) {
+	newConfig = newConfig.Clone()
+
 	keysMutex.Lock()
 	defer keysMutex.Unlock()
 
+	// 标准化模型策略配置，在发布前完成，避免修改其他goroutine正在读取的快照
+	standardizeModelKeyStrategies(newConfig)
+
 	// 更新全局配置
-	config = newConfig
+	currentConfig.Store(newConfig)
 
-	// 标准化模型策略配置
-	standardizeModelKeyStrategies()
+	applyCacheMemoryBudget(newConfig)
 }
 
 // MarkApiKeyForDeletion 标记API密钥为删除状态
 func MarkApiKeyForDeletion(key string) bool {
 	keysMutex.Lock()
-	defer keysMutex.Unlock()
 
 	for i, k := range apiKeys {
 		if k.Key == key {
@@ -1218,10 +1447,13 @@ func MarkApiKeyForDeletion(key string) bool {
 				logger.Error("更新删除标记到数据库失败: %v", err)
 			}
 
+			keysMutex.Unlock()
+			notifyApiKeyChanges()
 			return true
 		}
 	}
 
+	keysMutex.Unlock()
 	return false
 }
 
@@ -1277,6 +1509,11 @@ func EnsureDefaultConfig(dbPath string) error {
 	var configValue string
 	err := db.QueryRow("SELECT value FROM config WHERE key = 'config'").Scan(&configValue)
 
+	// 只读数据库模式下不能插入默认配置
+	if err != nil && IsReadOnlyDatabase() {
+		return fmt.Errorf("只读数据库中没有找到配置: %w", err)
+	}
+
 	// 如果没有找到配置行或者出现其他错误，插入默认配置
 	if err != nil {
 		logger.Info("数据库中没有找到配置或发生错误: %v，将插入默认配置", err)
@@ -1376,7 +1613,11 @@ func LoadApiKeys() error {
 
 // GetUsedApiKeys 获取所有已使用过的API密钥
 func GetUsedApiKeys() []ApiKey {
-	allKeys := GetApiKeys() // 已经过滤掉标记为删除的密钥
+	allKeys, err := GetApiKeys() // 已经过滤掉标记为删除的密钥
+	if err != nil {
+		logger.Error("获取已使用的API密钥失败: %v", err)
+		return nil
+	}
 
 	// 筛选出已使用过的密钥
 	var usedKeys []ApiKey
@@ -1399,7 +1640,7 @@ func MarkApiKeyAsUnused(key string) bool {
 			apiKeys[i].IsUsed = false
 
 			// 保存更新到数据库
-			if db != nil {
+			if dbWritable() {
 				// 添加重试逻辑，最多尝试3次
 				var err error
 				for retries := 0; retries < 3; retries++ {
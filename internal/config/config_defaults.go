@@ -0,0 +1,82 @@
+/**
+  @author: Hanhai
+  @desc: 配置默认值，按字段的default标签补全数据库中缺失的配置项，旧版本数据库升级后新字段不会以零值运行
+**/
+
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// ApplyConfigDefaults 将配置中值为零的字段设置为default标签指定的默认值，返回设置了默认值的字段
+// 只处理字符串和数值字段，布尔值的false无法区分未设置和关闭，不能使用default标签
+// 零值本身有意义的字段（例如0表示不限制）不应设置default标签，否则用户无法将其设置为0
+func ApplyConfigDefaults(cfg *Config) []string {
+	if cfg == nil {
+		return nil
+	}
+	var applied []string
+	applyStructDefaults(reflect.ValueOf(cfg).Elem(), "", &applied)
+	return applied
+}
+
+// applyStructDefaults 递归处理结构体字段的default标签
+func applyStructDefaults(value reflect.Value, prefix string, applied *[]string) {
+	valueType := value.Type()
+	for i := 0; i < value.NumField(); i++ {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldValue := value.Field(i)
+		name := prefix + field.Name
+
+		if field.Type.Kind() == reflect.Struct {
+			applyStructDefaults(fieldValue, name+".", applied)
+			continue
+		}
+
+		defaultValue, ok := field.Tag.Lookup("default")
+		if !ok || !fieldValue.IsZero() {
+			continue
+		}
+		if err := setDefaultValue(fieldValue, defaultValue); err != nil {
+			logger.Error("配置项 %s 的默认值 %q 无效: %v", name, defaultValue, err)
+			continue
+		}
+		*applied = append(*applied, name)
+	}
+}
+
+// setDefaultValue 按字段类型解析并设置默认值
+func setDefaultValue(fieldValue reflect.Value, defaultValue string) error {
+	switch fieldValue.Kind() {
+	case reflect.String:
+		fieldValue.SetString(defaultValue)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(defaultValue, 10, fieldValue.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fieldValue.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(defaultValue, 10, fieldValue.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fieldValue.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(defaultValue, fieldValue.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fieldValue.SetFloat(parsed)
+	default:
+		return fmt.Errorf("不支持%s类型的字段", fieldValue.Kind())
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// 使用go test -race运行：读取快照的同时不断保存设置，不能出现并发读写映射
+func TestConfigSnapshotConcurrentUpdate(t *testing.T) {
+	initial := &Config{}
+	initial.App.ModelKeyStrategies = map[string]int{"model-0": 1}
+	initial.App.DisabledModels = []string{"model-0"}
+	UpdateConfig(initial)
+	t.Cleanup(func() { UpdateConfig(&Config{}) })
+
+	const readers = 8
+	const updates = 50
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				cfg := GetConfig()
+				for modelID, strategyID := range cfg.App.ModelKeyStrategies {
+					_ = modelID
+					_ = strategyID
+				}
+				_ = cfg.App.ModelKeyStrategies["model-0"]
+				_ = len(cfg.App.DisabledModels)
+			}
+		}()
+	}
+
+	for i := 1; i <= updates; i++ {
+		cfg := GetConfig().Clone()
+		cfg.App.ModelKeyStrategies[fmt.Sprintf("model-%d", i)] = i%8 + 1
+		cfg.App.DisabledModels = append(cfg.App.DisabledModels, fmt.Sprintf("model-%d", i))
+		UpdateConfig(cfg)
+
+		// 发布后继续修改传入的配置不影响已发布的快照
+		cfg.App.ModelKeyStrategies["model-0"] = 99
+		cfg.App.DisabledModels[0] = "changed"
+	}
+	close(done)
+	wg.Wait()
+
+	cfg := GetConfig()
+	if got := len(cfg.App.ModelKeyStrategies); got != updates+1 {
+		t.Errorf("len(ModelKeyStrategies) = %d, want %d", got, updates+1)
+	}
+	if got := cfg.App.ModelKeyStrategies["model-0"]; got != 1 {
+		t.Errorf("ModelKeyStrategies[model-0] = %d, want 1", got)
+	}
+	if got := cfg.App.DisabledModels[0]; got != "model-0" {
+		t.Errorf("DisabledModels[0] = %q, want model-0", got)
+	}
+}
@@ -0,0 +1,77 @@
+/**
+  @author: Hanhai
+  @desc: 允许跨域调用代理接口的来源，未设置时不允许跨域调用
+**/
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// CorsAnyOrigin 允许任意来源跨域调用代理接口，此时不允许携带凭证
+const CorsAnyOrigin = "*"
+
+// NormalizeCorsOrigin 将来源统一为小写的 scheme://host[:port]，无效时返回错误
+func NormalizeCorsOrigin(origin string) (string, error) {
+	origin = strings.TrimSpace(origin)
+	if origin == CorsAnyOrigin {
+		return origin, nil
+	}
+	parsed, err := url.Parse(strings.TrimSuffix(origin, "/"))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+		parsed.Path != "" || parsed.RawQuery != "" || parsed.Fragment != "" || parsed.User != nil {
+		return "", fmt.Errorf("无效的跨域来源: %s，格式应为 https://example.com 或 *", origin)
+	}
+	return strings.ToLower(parsed.Scheme + "://" + parsed.Host), nil
+}
+
+// ParseCorsOrigins 校验并整理跨域来源列表，去掉空白和重复的项
+func ParseCorsOrigins(values []string) ([]string, error) {
+	origins := make([]string, 0, len(values))
+	seen := make(map[string]bool)
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		origin, err := NormalizeCorsOrigin(value)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[origin] {
+			seen[origin] = true
+			origins = append(origins, origin)
+		}
+	}
+	return origins, nil
+}
+
+// MatchCorsOrigin 检查请求的来源是否允许跨域调用代理接口
+// 返回Access-Control-Allow-Origin的值，配置了*且请求来源不在列表中时返回*，不允许时返回空字符串
+func MatchCorsOrigin(cfg *Config, origin string) string {
+	if cfg == nil || len(cfg.Server.CorsAllowedOrigins) == 0 {
+		return ""
+	}
+	normalized, err := NormalizeCorsOrigin(origin)
+	if err != nil || normalized == CorsAnyOrigin {
+		normalized = ""
+	}
+
+	anyOrigin := false
+	for _, allowed := range cfg.Server.CorsAllowedOrigins {
+		allowed = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(allowed), "/"))
+		if allowed == CorsAnyOrigin {
+			anyOrigin = true
+			continue
+		}
+		if normalized != "" && allowed == normalized {
+			return origin
+		}
+	}
+	if anyOrigin {
+		return CorsAnyOrigin
+	}
+	return ""
+}
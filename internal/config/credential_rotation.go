@@ -0,0 +1,177 @@
+/**
+  @author: Hanhai
+  @desc: 凭据紧急轮换，一次吊销所有客户端令牌、更换固定API密钥和各接口的访问令牌、更换登录会话的签名密钥，可以同时锁定代理，不修改上游的API密钥
+**/
+
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"flowsilicon/internal/logger"
+)
+
+// SecurityAuditPanic 凭据紧急轮换的审计操作类型
+const SecurityAuditPanic = "panic_rotate"
+
+// PanicOptions 凭据紧急轮换的选项
+type PanicOptions struct {
+	DisableProxy bool // 轮换后锁定代理，不生成新的客户端令牌和API密钥，在设置中发放新的令牌或API密钥后解除
+}
+
+// PanicCredentials 轮换时新生成的凭据，只在轮换结果中返回一次，不写入审计记录
+type PanicCredentials struct {
+	ClientToken     string `json:"client_token,omitempty"`
+	ApiKey          string `json:"api_key,omitempty"`
+	MetricsToken    string `json:"metrics_token,omitempty"`
+	StatusFeedToken string `json:"status_feed_token,omitempty"`
+}
+
+// PanicResult 凭据紧急轮换的结果，令牌都已脱敏
+type PanicResult struct {
+	RotatedAt              int64             `json:"rotated_at"`
+	RevokedClientTokens    []string          `json:"revoked_client_tokens"`     // 本次吊销的客户端令牌
+	ApiKeyRotated          bool              `json:"api_key_rotated"`           // 是否更换了固定API密钥，锁定代理时清空
+	ApiKeyFromEnv          bool              `json:"api_key_from_env"`          // 固定API密钥由环境变量设置，需要手动修改环境变量
+	MetricsTokenRotated    bool              `json:"metrics_token_rotated"`     // 是否更换了/metrics的访问令牌
+	StatusFeedTokenRotated bool              `json:"status_feed_token_rotated"` // 是否更换了/status.json的访问令牌
+	SessionsInvalidated    bool              `json:"sessions_invalidated"`      // 是否更换了登录会话的签名密钥，之前的登录全部失效
+	ProxyLocked            bool              `json:"proxy_locked"`
+	Warnings               []string          `json:"warnings"`
+	Credentials            *PanicCredentials `json:"credentials,omitempty"`
+}
+
+// RotateAllCredentials 紧急轮换所有对外暴露的凭据，保存配置并写入审计记录，actor为操作来源
+// 返回的结果中包含新生成的凭据，凭据不写入审计记录和日志
+func RotateAllCredentials(opts PanicOptions, actor string) (PanicResult, error) {
+	result := PanicResult{
+		RotatedAt:           time.Now().Unix(),
+		RevokedClientTokens: make([]string, 0),
+		Warnings:            make([]string, 0),
+	}
+	credentials := &PanicCredentials{}
+
+	err := updateClientTokens(func(cfg *Config) error {
+		mode := GetProxyAuthMode(cfg)
+
+		// 吊销所有客户端令牌，令牌保留在列表中，验证时返回token_revoked
+		for _, token := range cfg.Security.ClientTokens {
+			if findRevokedToken(cfg, token) >= 0 {
+				continue
+			}
+			cfg.Security.RevokedClientTokens = append(cfg.Security.RevokedClientTokens, RevokedClientToken{
+				Token:     token,
+				RevokedAt: result.RotatedAt,
+			})
+			result.RevokedClientTokens = append(result.RevokedClientTokens, MaskKey(token))
+		}
+		if mode == AuthModeTokenList && !opts.DisableProxy {
+			token, err := newCredential("sk-")
+			if err != nil {
+				return err
+			}
+			cfg.Security.ClientTokens = append(cfg.Security.ClientTokens, token)
+			credentials.ClientToken = token
+		}
+
+		// 更换固定API密钥，锁定代理时清空，由管理员重新设置
+		if cfg.Security.ApiKey != "" || mode == AuthModeFixedSecret {
+			cfg.Security.ApiKey = ""
+			if !opts.DisableProxy {
+				apiKey, err := newCredential("sk-")
+				if err != nil {
+					return err
+				}
+				cfg.Security.ApiKey = apiKey
+				credentials.ApiKey = apiKey
+			}
+			result.ApiKeyRotated = true
+		}
+		if strings.TrimSpace(os.Getenv(ProxySecretEnv)) != "" {
+			result.ApiKeyFromEnv = true
+			result.Warnings = append(result.Warnings, "固定API密钥由环境变量 "+ProxySecretEnv+" 设置，需要手动修改环境变量后重启")
+		}
+
+		// 更换接口的访问令牌，为空表示未使用，保持为空
+		if cfg.Metrics.Token != "" {
+			token, err := newCredential("")
+			if err != nil {
+				return err
+			}
+			cfg.Metrics.Token = token
+			credentials.MetricsToken = token
+			result.MetricsTokenRotated = true
+		}
+		if cfg.StatusFeed.Token != "" {
+			token, err := newCredential("")
+			if err != nil {
+				return err
+			}
+			cfg.StatusFeed.Token = token
+			credentials.StatusFeedToken = token
+			result.StatusFeedTokenRotated = true
+		}
+
+		// 更换登录会话的签名密钥，之前签发的登录Cookie全部失效
+		secret, err := newCredential("")
+		if err != nil {
+			return err
+		}
+		cfg.Security.SessionSecret = secret
+		result.SessionsInvalidated = true
+
+		cfg.Security.ProxyLocked = opts.DisableProxy
+		result.ProxyLocked = opts.DisableProxy
+		return nil
+	})
+	if err != nil {
+		return PanicResult{}, fmt.Errorf("轮换凭据失败: %w", err)
+	}
+
+	logger.Warn("已紧急轮换所有凭据（%s）：吊销 %d 个客户端令牌，代理锁定: %v", actor, len(result.RevokedClientTokens), result.ProxyLocked)
+
+	// 审计记录不包含新生成的凭据
+	if err := RecordSecurityAudit(SecurityAuditPanic, actor, result); err != nil {
+		logger.Error("写入凭据轮换的审计记录失败: %v", err)
+		result.Warnings = append(result.Warnings, "写入审计记录失败: "+err.Error())
+	}
+
+	result.Credentials = credentials
+	return result, nil
+}
+
+// ReleaseProxyLock 代理已锁定时，新配置中发放了新的客户端令牌或更换了固定API密钥则解除锁定，返回是否解除
+// previous为修改前的配置，保存设置时调用
+func ReleaseProxyLock(previous *Config, cfg *Config) bool {
+	if previous == nil || !cfg.Security.ProxyLocked {
+		return false
+	}
+
+	issued := cfg.Security.ApiKey != "" && cfg.Security.ApiKey != previous.Security.ApiKey
+	for _, token := range cfg.Security.ClientTokens {
+		if !hasClientToken(previous, token) && findRevokedToken(cfg, token) < 0 {
+			issued = true
+		}
+	}
+	if !issued {
+		return false
+	}
+
+	cfg.Security.ProxyLocked = false
+	logger.Info("已发放新的代理凭据，解除代理锁定")
+	return true
+}
+
+// newCredential 生成随机凭据
+func newCredential(prefix string) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成随机凭据失败: %w", err)
+	}
+	return prefix + hex.EncodeToString(buf), nil
+}
@@ -17,9 +17,18 @@ import (
 var (
 	dailyData     *DailyData
 	dailyDataLock sync.RWMutex
-	dailyFilePath string // 将在初始化时设置
+
+	// 每日统计数据文件路径，将在初始化时设置，读写时使用单独的锁，不需要等待统计数据的读写
+	dailyFilePath     string
+	dailyFilePathLock sync.RWMutex
 )
 
+// 未设置路径时使用的每日统计数据文件
+const defaultDailyFilePath = "data/daily.json"
+
+// 保留的每日统计天数
+const maxDailyStatsDays = 30
+
 // DailyStats 每日统计数据结构
 type DailyStats struct {
 	Date     string                `json:"date"`
@@ -27,13 +36,19 @@ type DailyStats struct {
 	Tokens   DailyTokenStats       `json:"tokens"`
 	Models   map[string]ModelStats `json:"models"`
 	Hourly   []HourlyStats         `json:"hourly"`
+	NoData   bool                  `json:"no_data,omitempty"` // 服务未运行（例如休眠）的日期，没有统计数据
 }
 
 // DailyRequestStats 每日请求统计
 type DailyRequestStats struct {
-	Total   int `json:"total"`
-	Success int `json:"success"`
-	Failed  int `json:"failed"`
+	Total           int `json:"total"`
+	Success         int `json:"success"`
+	Failed          int `json:"failed"`
+	UpstreamAborted int `json:"upstream_aborted"` // 上游流式响应中途中断的次数，已计入Failed
+	Mirrored        int `json:"mirrored"`         // 影子流量镜像请求次数，不计入Total
+	MultiChoice     int `json:"multi_choice"`     // 请求多个候选结果（n或best_of大于1）的次数，已计入Total
+	ExtraChoices    int `json:"extra_choices"`    // 多个候选结果的请求中除第一个以外的候选结果数之和
+	Retries         int `json:"retries"`          // 上游返回可重试的错误后换密钥重试的次数，不计入Total
 }
 
 // DailyTokenStats 每日令牌统计
@@ -41,6 +56,7 @@ type DailyTokenStats struct {
 	Total      int `json:"total"`
 	Prompt     int `json:"prompt"`
 	Completion int `json:"completion"`
+	Mirrored   int `json:"mirrored"` // 影子流量镜像请求消耗的令牌数，不计入Total
 }
 
 // ModelStats 模型使用统计
@@ -69,14 +85,25 @@ type DailyData struct {
 	LastUpdated string                         `json:"last_updated"`
 	DailyStats  []DailyStats                   `json:"daily_stats"`
 	KeysUsage   map[string]map[string]KeyUsage `json:"keys_usage"`
+	// 按日期记录的客户端用量，键为日期和客户端标识
+	ClientsUsage map[string]map[string]ClientUsage `json:"clients_usage,omitempty"`
+	// 按日期记录的分组用量，键为日期和请求时密钥所属的分组
+	GroupsUsage map[string]map[string]GroupUsage `json:"groups_usage,omitempty"`
 }
 
-// SetDailyFilePath 设置每日统计数据文件路径
+// SetDailyFilePath 设置每日统计数据文件路径，需要在InitDailyStats之前调用，之后修改只影响后续的保存
 func SetDailyFilePath(path string) {
-	dailyDataLock.Lock()
-	defer dailyDataLock.Unlock()
+	dailyFilePathLock.Lock()
 	dailyFilePath = path
-	logger.Info("设置每日统计数据文件路径: %s", dailyFilePath)
+	dailyFilePathLock.Unlock()
+	logger.Info("设置每日统计数据文件路径: %s", path)
+}
+
+// GetDailyFilePath 获取每日统计数据文件路径，未设置时返回空字符串
+func GetDailyFilePath() string {
+	dailyFilePathLock.RLock()
+	defer dailyFilePathLock.RUnlock()
+	return dailyFilePath
 }
 
 // InitDailyStats 初始化每日统计数据
@@ -85,13 +112,15 @@ func InitDailyStats() error {
 	defer dailyDataLock.Unlock()
 
 	// 如果路径未设置，使用默认路径
-	if dailyFilePath == "" {
-		dailyFilePath = "data/daily.json"
-		logger.Info("使用默认的每日统计数据文件路径: %s", dailyFilePath)
+	filePath := GetDailyFilePath()
+	if filePath == "" {
+		filePath = defaultDailyFilePath
+		SetDailyFilePath(filePath)
+		logger.Info("使用默认的每日统计数据文件路径: %s", filePath)
 	}
 
 	// 确保data目录存在
-	dataDir := filepath.Dir(dailyFilePath)
+	dataDir := filepath.Dir(filePath)
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		logger.Error("创建数据目录失败: %v", err)
 		return err
@@ -116,21 +145,26 @@ func InitDailyStats() error {
 		logger.Info("成功加载每日统计数据")
 	}
 
-	// 确保今天的数据存在
+	// 确保今天的数据存在，上次运行后错过的日期补上无数据的标记
 	ensureTodayDataExistsLocked()
 
+	// 检测休眠唤醒，唤醒后补上休眠期间的每日统计
+	startClockJumpDetector()
+
 	return nil
 }
 
 // loadDailyDataLocked 从文件加载每日统计数据（已加锁）
 func loadDailyDataLocked() error {
+	filePath := GetDailyFilePath()
+
 	// 检查文件是否存在
-	if _, err := os.Stat(dailyFilePath); os.IsNotExist(err) {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return err
 	}
 
 	// 读取文件内容
-	data, err := os.ReadFile(dailyFilePath)
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return err
 	}
@@ -146,9 +180,10 @@ func loadDailyDataLocked() error {
 }
 
 // saveDailyData 保存每日统计数据到文件
+// 保存时会更新最后更新时间，需要加写锁，同时避免多个协程同时写入文件
 func saveDailyData() error {
-	dailyDataLock.RLock()
-	defer dailyDataLock.RUnlock()
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
 	return saveDailyDataLocked()
 }
 
@@ -168,22 +203,16 @@ func saveDailyDataLocked() error {
 	}
 
 	// 写入文件
-	return os.WriteFile(dailyFilePath, data, 0644)
+	return os.WriteFile(GetDailyFilePath(), data, 0644)
 }
 
 // createDefaultDailyData 创建默认的每日统计数据结构
 func createDefaultDailyData() *DailyData {
-	today := time.Now().Format("2006-01-02")
-
-	// 创建24小时的统计数据
-	hourlyStats := make([]HourlyStats, 24)
-	for i := 0; i < 24; i++ {
-		hourlyStats[i] = HourlyStats{
-			Hour:     i,
-			Requests: 0,
-			Tokens:   0,
-		}
-	}
+	now := StatsNow()
+	today := now.Format(StatsDateLayout)
+
+	// 按统计时区创建当天的每小时统计
+	hourlyStats := newHourlyStats(now)
 
 	return &DailyData{
 		Version:     "1.0",
@@ -217,7 +246,8 @@ func ensureTodayDataExistsLocked() {
 		return
 	}
 
-	today := time.Now().Format("2006-01-02")
+	now := StatsNow()
+	today := now.Format(StatsDateLayout)
 
 	// 检查今天的数据是否存在
 	for _, stats := range dailyData.DailyStats {
@@ -226,15 +256,42 @@ func ensureTodayDataExistsLocked() {
 		}
 	}
 
-	// 创建24小时的统计数据
-	hourlyStats := make([]HourlyStats, 24)
-	for i := 0; i < 24; i++ {
-		hourlyStats[i] = HourlyStats{
-			Hour:     i,
-			Requests: 0,
-			Tokens:   0,
+	appendTodayStatsLocked(now)
+}
+
+// appendTodayStatsLocked 添加今天的数据，上次有数据的日期和今天之间的日期补上无数据的标记（已加锁）
+func appendTodayStatsLocked(now time.Time) {
+	today := now.Format(StatsDateLayout)
+
+	// 服务休眠或停止期间的日期单独标记为无数据，不合并到今天
+	lastDate := ""
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date > lastDate && stats.Date < today {
+			lastDate = stats.Date
 		}
 	}
+	if last, err := time.ParseInLocation(StatsDateLayout, lastDate, now.Location()); err == nil {
+		first := now.AddDate(0, 0, -maxDailyStatsDays)
+		year, month, day := last.Date()
+		for i := 1; ; i++ {
+			date := time.Date(year, month, day+i, 12, 0, 0, 0, now.Location())
+			if date.Format(StatsDateLayout) >= today {
+				break
+			}
+			if date.Before(first) {
+				continue
+			}
+			dailyData.DailyStats = append(dailyData.DailyStats, DailyStats{
+				Date:   date.Format(StatsDateLayout),
+				Models: make(map[string]ModelStats),
+				Hourly: []HourlyStats{},
+				NoData: true,
+			})
+		}
+	}
+
+	// 按统计时区创建当天的每小时统计
+	hourlyStats := newHourlyStats(now)
 
 	// 添加今天的数据
 	dailyData.DailyStats = append(dailyData.DailyStats, DailyStats{
@@ -254,13 +311,19 @@ func ensureTodayDataExistsLocked() {
 	})
 
 	// 如果数据超过30天，删除最旧的数据
-	if len(dailyData.DailyStats) > 30 {
-		dailyData.DailyStats = dailyData.DailyStats[len(dailyData.DailyStats)-30:]
+	if len(dailyData.DailyStats) > maxDailyStatsDays {
+		dailyData.DailyStats = dailyData.DailyStats[len(dailyData.DailyStats)-maxDailyStatsDays:]
 	}
 }
 
 // AddDailyRequestStat 添加每日请求统计
 func AddDailyRequestStat(apiKey, model string, requestCount, promptTokens, completionTokens int, isSuccess bool) {
+	// 在请求时确定密钥所属的分组，之后调整分组不影响已记录的用量
+	group := ""
+	if apiKey != "" {
+		group = getApiKeyGroup(func(k ApiKey) bool { return k.Key == apiKey })
+	}
+
 	dailyDataLock.Lock()
 	defer dailyDataLock.Unlock()
 
@@ -270,8 +333,8 @@ func AddDailyRequestStat(apiKey, model string, requestCount, promptTokens, compl
 	}
 
 	// 确保今天的数据存在
-	today := time.Now().Format("2006-01-02")
-	currentHour := time.Now().Hour()
+	now := StatsNow()
+	today := now.Format(StatsDateLayout)
 
 	var todayStats *DailyStats
 	var todayIndex int
@@ -287,31 +350,7 @@ func AddDailyRequestStat(apiKey, model string, requestCount, promptTokens, compl
 
 	// 如果今天的数据不存在，创建新的
 	if todayStats == nil {
-		// 创建24小时的统计数据
-		hourlyStats := make([]HourlyStats, 24)
-		for i := 0; i < 24; i++ {
-			hourlyStats[i] = HourlyStats{
-				Hour:     i,
-				Requests: 0,
-				Tokens:   0,
-			}
-		}
-
-		dailyData.DailyStats = append(dailyData.DailyStats, DailyStats{
-			Date: today,
-			Requests: DailyRequestStats{
-				Total:   0,
-				Success: 0,
-				Failed:  0,
-			},
-			Tokens: DailyTokenStats{
-				Total:      0,
-				Prompt:     0,
-				Completion: 0,
-			},
-			Models: make(map[string]ModelStats),
-			Hourly: hourlyStats,
-		})
+		appendTodayStatsLocked(now)
 
 		todayIndex = len(dailyData.DailyStats) - 1
 		todayStats = &dailyData.DailyStats[todayIndex]
@@ -347,8 +386,9 @@ func AddDailyRequestStat(apiKey, model string, requestCount, promptTokens, compl
 	}
 
 	// 更新小时统计
-	todayStats.Hourly[currentHour].Requests += requestCount
-	todayStats.Hourly[currentHour].Tokens += totalTokens
+	hourly := hourlySlotLocked(todayStats, now)
+	hourly.Requests += requestCount
+	hourly.Tokens += totalTokens
 
 	// 更新API密钥使用统计
 	if apiKey != "" {
@@ -376,6 +416,11 @@ func AddDailyRequestStat(apiKey, model string, requestCount, promptTokens, compl
 		dailyData.KeysUsage[maskedKey][today] = keyUsage
 	}
 
+	// 更新分组用量统计
+	if group != "" {
+		addDailyGroupUsageLocked(group, requestCount, totalTokens, 0)
+	}
+
 	// 更新数据库中的数据
 	dailyData.DailyStats[todayIndex] = *todayStats
 
@@ -387,6 +432,143 @@ func AddDailyRequestStat(apiKey, model string, requestCount, promptTokens, compl
 	}()
 }
 
+// AddDailyUpstreamAborted 记录一次上游流式响应中途中断
+// 该请求本身的统计需要另外通过AddDailyRequestStat以失败状态记录
+func AddDailyUpstreamAborted() {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	// 确保今天的数据存在
+	ensureTodayDataExistsLocked()
+
+	today := StatsToday()
+	for i := range dailyData.DailyStats {
+		if dailyData.DailyStats[i].Date == today {
+			dailyData.DailyStats[i].Requests.UpstreamAborted++
+			break
+		}
+	}
+
+	// 异步保存数据
+	go func() {
+		if err := saveDailyData(); err != nil {
+			logger.Error("保存每日统计数据失败: %v", err)
+		}
+	}()
+}
+
+// AddDailyRetry 记录一次换密钥重试
+// 不单独保存，随之后的请求统计一起写入文件
+func AddDailyRetry() {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	// 确保今天的数据存在
+	ensureTodayDataExistsLocked()
+
+	today := StatsToday()
+	for i := range dailyData.DailyStats {
+		if dailyData.DailyStats[i].Date == today {
+			dailyData.DailyStats[i].Requests.Retries++
+			break
+		}
+	}
+}
+
+// AddDailyMultiChoice 记录一次请求多个候选结果的请求，choices为上游生成的候选结果数
+// 不单独保存，随之后的请求统计一起写入文件
+func AddDailyMultiChoice(choices int) {
+	if choices <= 1 {
+		return
+	}
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	// 确保今天的数据存在
+	ensureTodayDataExistsLocked()
+
+	today := StatsToday()
+	for i := range dailyData.DailyStats {
+		if dailyData.DailyStats[i].Date == today {
+			dailyData.DailyStats[i].Requests.MultiChoice++
+			dailyData.DailyStats[i].Requests.ExtraChoices += choices - 1
+			break
+		}
+	}
+}
+
+// TryReserveDailyMirrored 在每日预算内为一次影子流量镜像请求计数
+// 今天的镜像请求数已达到budget时返回false
+func TryReserveDailyMirrored(budget int) bool {
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	// 确保今天的数据存在
+	ensureTodayDataExistsLocked()
+
+	today := StatsToday()
+	reserved := false
+	for i := range dailyData.DailyStats {
+		if dailyData.DailyStats[i].Date == today {
+			if dailyData.DailyStats[i].Requests.Mirrored < budget {
+				dailyData.DailyStats[i].Requests.Mirrored++
+				reserved = true
+			}
+			break
+		}
+	}
+	if !reserved {
+		return false
+	}
+
+	// 异步保存数据
+	go func() {
+		if err := saveDailyData(); err != nil {
+			logger.Error("保存每日统计数据失败: %v", err)
+		}
+	}()
+	return true
+}
+
+// AddDailyMirroredTokens 记录影子流量镜像请求消耗的令牌数
+func AddDailyMirroredTokens(tokens int) {
+	if tokens <= 0 {
+		return
+	}
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	// 确保今天的数据存在
+	ensureTodayDataExistsLocked()
+
+	today := StatsToday()
+	for i := range dailyData.DailyStats {
+		if dailyData.DailyStats[i].Date == today {
+			dailyData.DailyStats[i].Tokens.Mirrored += tokens
+			break
+		}
+	}
+}
+
+// GetDailyMirroredCount 获取今天的影子流量镜像请求次数
+func GetDailyMirroredCount() int {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if dailyData == nil {
+		return 0
+	}
+	today := StatsToday()
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date == today {
+			return stats.Requests.Mirrored
+		}
+	}
+	return 0
+}
+
 // GetDailyStats 获取指定日期的统计数据
 func GetDailyStats(date string) (*DailyStats, error) {
 	dailyDataLock.RLock()
@@ -398,7 +580,7 @@ func GetDailyStats(date string) (*DailyStats, error) {
 
 	// 如果未指定日期，使用今天的日期
 	if date == "" {
-		date = time.Now().Format("2006-01-02")
+		date = StatsToday()
 	}
 
 	// 查找指定日期的数据
@@ -413,6 +595,29 @@ func GetDailyStats(date string) (*DailyStats, error) {
 	return nil, nil
 }
 
+// GetDailyModelStats 获取指定日期各模型的请求数和令牌数，日期为空时为今天，没有数据时返回空的映射
+func GetDailyModelStats(date string) map[string]ModelStats {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	if date == "" {
+		date = StatsToday()
+	}
+	result := make(map[string]ModelStats)
+	if dailyData == nil {
+		return result
+	}
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date == date {
+			for model, usage := range stats.Models {
+				result[model] = usage
+			}
+			break
+		}
+	}
+	return result
+}
+
 // GetAllDailyStats 获取所有日期的统计数据
 func GetAllDailyStats() (map[string]*DailyStats, error) {
 	dailyDataLock.RLock()
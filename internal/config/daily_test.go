@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 使用go test -race运行：50个协程同时设置和读取每日统计文件路径
+func TestDailyFilePathConcurrentAccess(t *testing.T) {
+	previous := GetDailyFilePath()
+	t.Cleanup(func() { SetDailyFilePath(previous) })
+	SetDailyFilePath("data/daily-0.json")
+
+	const goroutines = 50
+	var wg sync.WaitGroup
+	errs := make(chan string, goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if i%2 == 0 {
+					SetDailyFilePath(fmt.Sprintf("data/daily-%d.json", i))
+					continue
+				}
+				if path := GetDailyFilePath(); !strings.HasPrefix(path, "data/daily-") {
+					errs <- path
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for path := range errs {
+		t.Errorf("GetDailyFilePath() = %q during concurrent updates", path)
+	}
+	if path := GetDailyFilePath(); !strings.HasPrefix(path, "data/daily-") {
+		t.Errorf("final path = %q", path)
+	}
+}
@@ -0,0 +1,392 @@
+/**
+  @author: Hanhai
+  @desc: 数据目录归档，将配置数据库（包含API密钥和模型列表）和每日统计导出为一个tar.gz文件，在另一台机器上启动时恢复到数据目录
+**/
+
+package config
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArchiveFormatVersion 数据归档的格式版本，修改归档内容的结构时需要增加该版本号
+const ArchiveFormatVersion = 1
+
+// RestoreFlag 启动时从数据归档恢复数据目录的命令行参数
+const RestoreFlag = "--restore"
+
+// ForceFlag 恢复数据归档时允许覆盖非空的数据目录
+const ForceFlag = "--force"
+
+const (
+	archiveManifestName = "manifest.json"
+	archiveDailyName    = "daily.json"
+	// 恢复时写入的临时文件后缀，全部写入成功后才替换数据目录中的文件
+	archiveRestoringSuffix = ".restoring"
+	// 单个归档文件的最大大小，防止损坏的归档写满磁盘
+	archiveMaxFileSize = 4 << 30
+)
+
+// ErrDataDirNotEmpty 数据目录非空且未指定--force
+var ErrDataDirNotEmpty = errors.New("数据目录不为空，如需覆盖现有数据请同时指定--force")
+
+// ArchiveManifest 数据归档的清单
+type ArchiveManifest struct {
+	Format        int       `json:"format"`         // 归档格式版本
+	AppVersion    string    `json:"app_version"`    // 导出时的程序版本
+	SchemaVersion int       `json:"schema_version"` // 导出时的数据库结构版本
+	CreatedAt     time.Time `json:"created_at"`     // 导出时间
+	Files         []string  `json:"files"`          // 归档中的数据文件
+}
+
+// ParseRestoreFlag 获取命令行参数中--restore指定的归档路径以及是否指定了--force
+// 支持--restore <archive>和--restore=<archive>两种写法，未指定时返回空字符串
+func ParseRestoreFlag(args []string) (string, bool) {
+	var archivePath string
+	var force bool
+	for i, arg := range args {
+		switch {
+		case arg == ForceFlag:
+			force = true
+		case arg == RestoreFlag && i+1 < len(args):
+			archivePath = args[i+1]
+		case strings.HasPrefix(arg, RestoreFlag+"="):
+			archivePath = strings.TrimPrefix(arg, RestoreFlag+"=")
+		}
+	}
+	return archivePath, force
+}
+
+// StripRestoreFlags 去掉命令行参数中的--restore和--force，程序重启时使用，避免重启后再次用归档覆盖数据目录
+func StripRestoreFlags(args []string) []string {
+	stripped := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == ForceFlag, strings.HasPrefix(arg, RestoreFlag+"="):
+			continue
+		case arg == RestoreFlag:
+			i++
+			continue
+		}
+		stripped = append(stripped, arg)
+	}
+	return stripped
+}
+
+// WriteDataArchive 将当前的配置数据库和每日统计写入tar.gz归档
+// 配置数据库通过VACUUM INTO生成一致性副本，不需要停止服务；模型列表保存在同一个数据库中
+// 密钥按数据库中的存储方式原样导出，归档需要与数据目录同等保管
+func WriteDataArchive(w io.Writer) (ArchiveManifest, error) {
+	if db == nil {
+		return ArchiveManifest{}, fmt.Errorf("数据库连接未初始化")
+	}
+
+	tempDir, err := os.MkdirTemp("", "flowsilicon-archive-")
+	if err != nil {
+		return ArchiveManifest{}, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dbCopy := filepath.Join(tempDir, dbFileName)
+	if _, err := db.Exec("VACUUM INTO ?", dbCopy); err != nil {
+		return ArchiveManifest{}, fmt.Errorf("复制配置数据库失败: %w", err)
+	}
+
+	dailyContent, err := marshalDailyData()
+	if err != nil {
+		return ArchiveManifest{}, fmt.Errorf("序列化每日统计失败: %w", err)
+	}
+
+	manifest := ArchiveManifest{
+		Format:     ArchiveFormatVersion,
+		AppVersion: normalizeVersion(GetVersion()),
+		CreatedAt:  time.Now(),
+		Files:      []string{dbFileName},
+	}
+	if schemaValue, ok := readConfigValue(schemaVersionKey); ok {
+		manifest.SchemaVersion, _ = strconv.Atoi(schemaValue)
+	}
+	if dailyContent != nil {
+		manifest.Files = append(manifest.Files, archiveDailyName)
+	}
+
+	manifestContent, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return ArchiveManifest{}, fmt.Errorf("序列化归档清单失败: %w", err)
+	}
+
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	// 清单放在第一个，恢复时先校验版本再写入数据文件
+	if err := writeArchiveBytes(tarWriter, archiveManifestName, manifestContent, manifest.CreatedAt); err != nil {
+		return ArchiveManifest{}, err
+	}
+	if err := writeArchiveFile(tarWriter, dbFileName, dbCopy); err != nil {
+		return ArchiveManifest{}, err
+	}
+	if dailyContent != nil {
+		if err := writeArchiveBytes(tarWriter, archiveDailyName, dailyContent, manifest.CreatedAt); err != nil {
+			return ArchiveManifest{}, err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return ArchiveManifest{}, fmt.Errorf("写入归档失败: %w", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return ArchiveManifest{}, fmt.Errorf("写入归档失败: %w", err)
+	}
+
+	logger.Info("已导出数据归档，程序版本 %s，包含文件: %s", displayVersion(manifest.AppVersion), strings.Join(manifest.Files, ", "))
+	return manifest, nil
+}
+
+// RestoreDataArchive 将归档恢复到数据目录，需要在初始化数据库之前调用
+// 数据目录非空时只有force为true才会覆盖，被覆盖的配置数据库移动到backups目录
+// 恢复后按正常启动流程打开数据库，由数据版本检查和表结构初始化完成迁移
+func RestoreDataArchive(archivePath string, dataDir string, force bool) (ArchiveManifest, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return ArchiveManifest{}, fmt.Errorf("创建数据目录失败: %w", err)
+	}
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return ArchiveManifest{}, fmt.Errorf("读取数据目录失败: %w", err)
+	}
+	if len(entries) > 0 && !force {
+		return ArchiveManifest{}, ErrDataDirNotEmpty
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return ArchiveManifest{}, fmt.Errorf("打开数据归档失败: %w", err)
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return ArchiveManifest{}, fmt.Errorf("读取数据归档失败: %w", err)
+	}
+	defer gzipReader.Close()
+	tarReader := tar.NewReader(gzipReader)
+
+	manifest, err := readArchiveManifest(tarReader)
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+
+	// 先写入临时文件，全部成功后再替换，避免恢复中断时数据目录只有部分文件
+	restored := make(map[string]string)
+	defer func() {
+		for _, tempPath := range restored {
+			os.Remove(tempPath)
+		}
+	}()
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ArchiveManifest{}, fmt.Errorf("读取数据归档失败: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// 只恢复清单中列出的已知文件，不按归档中的路径写入
+		if !isArchiveDataFile(header.Name) || !containsString(manifest.Files, header.Name) {
+			logger.Warn("数据归档中的文件 %s 不是已知的数据文件，已跳过", header.Name)
+			continue
+		}
+
+		tempPath := filepath.Join(dataDir, header.Name+archiveRestoringSuffix)
+		restored[header.Name] = tempPath
+		if err := extractArchiveFile(tarReader, tempPath); err != nil {
+			return ArchiveManifest{}, err
+		}
+	}
+
+	for _, name := range manifest.Files {
+		if _, ok := restored[name]; !ok {
+			return ArchiveManifest{}, fmt.Errorf("数据归档不完整，缺少文件 %s", name)
+		}
+	}
+
+	dbPath := filepath.Join(dataDir, dbFileName)
+	if _, err := os.Stat(dbPath); err == nil {
+		backupPath, err := moveAsideConfigDB(dbPath)
+		if err != nil {
+			return ArchiveManifest{}, err
+		}
+		logger.Warn("恢复数据归档前，已将现有的配置数据库移动到: %s", backupPath)
+	}
+	// 旧数据库的WAL文件会被应用到恢复的数据库上，需要一起删除
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !os.IsNotExist(err) {
+			return ArchiveManifest{}, fmt.Errorf("删除旧数据库日志文件失败: %w", err)
+		}
+	}
+	// 密钥池快照属于被覆盖的数据，保留会在启动时覆盖恢复的密钥状态
+	if err := os.Remove(filepath.Join(dataDir, "keypool_snapshot.json")); err != nil && !os.IsNotExist(err) {
+		return ArchiveManifest{}, fmt.Errorf("删除密钥池快照失败: %w", err)
+	}
+
+	for name, tempPath := range restored {
+		if err := os.Rename(tempPath, filepath.Join(dataDir, name)); err != nil {
+			return ArchiveManifest{}, fmt.Errorf("恢复文件 %s 失败: %w", name, err)
+		}
+		delete(restored, name)
+	}
+
+	logger.Warn("审计: 已从数据归档 %s 恢复数据目录 %s，归档程序版本 %s，导出时间 %s",
+		archivePath, dataDir, displayVersion(manifest.AppVersion), manifest.CreatedAt.Format(time.RFC3339))
+	return manifest, nil
+}
+
+// readArchiveManifest 读取并校验归档开头的清单
+func readArchiveManifest(tarReader *tar.Reader) (ArchiveManifest, error) {
+	header, err := tarReader.Next()
+	if err != nil {
+		return ArchiveManifest{}, fmt.Errorf("读取数据归档失败: %w", err)
+	}
+	if header.Name != archiveManifestName {
+		return ArchiveManifest{}, fmt.Errorf("不是有效的数据归档，缺少%s", archiveManifestName)
+	}
+
+	var manifest ArchiveManifest
+	if err := json.NewDecoder(io.LimitReader(tarReader, 1<<20)).Decode(&manifest); err != nil {
+		return ArchiveManifest{}, fmt.Errorf("解析归档清单失败: %w", err)
+	}
+
+	if manifest.Format <= 0 || manifest.Format > ArchiveFormatVersion {
+		return ArchiveManifest{}, fmt.Errorf("数据归档格式版本 %d 不受支持，当前程序支持的最高版本为 %d，请升级程序后再恢复",
+			manifest.Format, ArchiveFormatVersion)
+	}
+	if manifest.SchemaVersion > CurrentSchemaVersion {
+		return ArchiveManifest{}, fmt.Errorf("数据归档由较新的版本 %s（数据库结构版本 %d）导出，当前程序仅支持数据库结构版本 %d，请升级程序后再恢复",
+			displayVersion(manifest.AppVersion), manifest.SchemaVersion, CurrentSchemaVersion)
+	}
+	if !containsString(manifest.Files, dbFileName) {
+		return ArchiveManifest{}, fmt.Errorf("数据归档中没有配置数据库")
+	}
+	return manifest, nil
+}
+
+// isArchiveDataFile 检查是否为归档中可以恢复的数据文件
+func isArchiveDataFile(name string) bool {
+	return name == dbFileName || name == archiveDailyName
+}
+
+// containsString 检查切片中是否包含指定字符串
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+// extractArchiveFile 将归档中的当前文件写入指定路径，数据文件包含API密钥，只允许当前用户读写
+func extractArchiveFile(tarReader *tar.Reader, path string) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("创建文件 %s 失败: %w", path, err)
+	}
+	written, err := io.Copy(out, io.LimitReader(tarReader, archiveMaxFileSize+1))
+	closeErr := out.Close()
+	if err != nil {
+		return fmt.Errorf("写入文件 %s 失败: %w", path, err)
+	}
+	if written > archiveMaxFileSize {
+		return fmt.Errorf("数据归档中的文件 %s 过大", filepath.Base(path))
+	}
+	if closeErr != nil {
+		return fmt.Errorf("写入文件 %s 失败: %w", path, closeErr)
+	}
+	return nil
+}
+
+// moveAsideConfigDB 将现有的配置数据库移动到数据目录下的backups目录，返回移动后的路径
+func moveAsideConfigDB(dbPath string) (string, error) {
+	backupDir := filepath.Join(filepath.Dir(dbPath), "backups")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return "", fmt.Errorf("创建备份目录失败: %w", err)
+	}
+
+	fileExt := filepath.Ext(dbPath)
+	name := strings.TrimSuffix(filepath.Base(dbPath), fileExt)
+	backupPath := filepath.Join(backupDir, fmt.Sprintf("%s_before_restore_%s%s", name, time.Now().Format("20060102_150405"), fileExt))
+	if err := os.Rename(dbPath, backupPath); err != nil {
+		return "", fmt.Errorf("移动现有的配置数据库失败: %w", err)
+	}
+	return backupPath, nil
+}
+
+// writeArchiveBytes 将内容作为文件写入归档
+func writeArchiveBytes(tarWriter *tar.Writer, name string, content []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(content)),
+		ModTime: modTime,
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return fmt.Errorf("写入归档失败: %w", err)
+	}
+	if _, err := tarWriter.Write(content); err != nil {
+		return fmt.Errorf("写入归档失败: %w", err)
+	}
+	return nil
+}
+
+// writeArchiveFile 将磁盘上的文件写入归档
+func writeArchiveFile(tarWriter *tar.Writer, name string, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("打开文件 %s 失败: %w", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("读取文件 %s 失败: %w", path, err)
+	}
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return fmt.Errorf("写入归档失败: %w", err)
+	}
+	if _, err := io.Copy(tarWriter, file); err != nil {
+		return fmt.Errorf("写入归档失败: %w", err)
+	}
+	return nil
+}
+
+// marshalDailyData 序列化内存中的每日统计，尚未初始化时返回nil
+func marshalDailyData() ([]byte, error) {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+	if dailyData == nil {
+		return nil, nil
+	}
+	return json.MarshalIndent(dailyData, "", "  ")
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// writeArchiveToFile 将当前数据库导出为归档文件
+func writeArchiveToFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "flowsilicon-archive.tar.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := WriteDataArchive(file); err != nil {
+		t.Fatalf("WriteDataArchive 失败: %v", err)
+	}
+	return path
+}
+
+// 导出归档后恢复到另一个数据目录，重新打开数据库后密钥和每日统计与导出前相同
+func TestDataArchiveRoundTrip(t *testing.T) {
+	setupApikeysDB(t)
+	AddApiKey("sk-archive-key", 42)
+	dailyDataLock.Lock()
+	previousDaily := dailyData
+	dailyData = &DailyData{Version: "1.0", DailyStats: []DailyStats{{Date: "2026-10-01", Requests: DailyRequestStats{Total: 7}}}}
+	dailyDataLock.Unlock()
+	t.Cleanup(func() {
+		dailyDataLock.Lock()
+		dailyData = previousDaily
+		dailyDataLock.Unlock()
+	})
+
+	archivePath := writeArchiveToFile(t)
+	CloseConfigDB()
+	ReplaceApiKeys(nil)
+
+	dataDir := t.TempDir()
+	manifest, err := RestoreDataArchive(archivePath, dataDir, false)
+	if err != nil {
+		t.Fatalf("RestoreDataArchive 失败: %v", err)
+	}
+	if manifest.Format != ArchiveFormatVersion || !containsString(manifest.Files, archiveDailyName) {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	for _, name := range []string{dbFileName, archiveDailyName} {
+		info, err := os.Stat(filepath.Join(dataDir, name))
+		if err != nil {
+			t.Fatalf("恢复后缺少 %s: %v", name, err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, want 0600", name, info.Mode().Perm())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, dbFileName+archiveRestoringSuffix)); !os.IsNotExist(err) {
+		t.Errorf("临时文件没有删除: %v", err)
+	}
+
+	var daily DailyData
+	content, err := os.ReadFile(filepath.Join(dataDir, archiveDailyName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(content, &daily); err != nil {
+		t.Fatal(err)
+	}
+	if len(daily.DailyStats) != 1 || daily.DailyStats[0].Requests.Total != 7 {
+		t.Errorf("restored daily stats = %+v", daily.DailyStats)
+	}
+
+	// 按正常启动流程打开恢复的数据库并执行迁移
+	dbPath := filepath.Join(dataDir, dbFileName)
+	if err := InitConfigDB(dbPath); err != nil {
+		t.Fatalf("InitConfigDB 失败: %v", err)
+	}
+	if err := EnsureApikeys(dbPath); err != nil {
+		t.Fatalf("EnsureApikeys 失败: %v", err)
+	}
+	if err := LoadApiKeysFromDB(); err != nil {
+		t.Fatalf("LoadApiKeysFromDB 失败: %v", err)
+	}
+	keys := currentApiKeys(t)
+	if len(keys) != 1 || keys[0].Key != "sk-archive-key" || keys[0].Balance != 42 {
+		t.Fatalf("restored keys = %+v", keys)
+	}
+}
+
+// 数据目录非空时需要指定force，覆盖的配置数据库移动到backups目录
+func TestRestoreDataArchiveNonEmptyDir(t *testing.T) {
+	setupApikeysDB(t)
+	archivePath := writeArchiveToFile(t)
+
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, dbFileName), []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RestoreDataArchive(archivePath, dataDir, false); !errors.Is(err, ErrDataDirNotEmpty) {
+		t.Fatalf("RestoreDataArchive without force = %v, want ErrDataDirNotEmpty", err)
+	}
+	if _, err := RestoreDataArchive(archivePath, dataDir, true); err != nil {
+		t.Fatalf("RestoreDataArchive with force 失败: %v", err)
+	}
+	backups, err := filepath.Glob(filepath.Join(dataDir, "backups", "config_before_restore_*.db"))
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("backups = %v, %v; want one moved config.db", backups, err)
+	}
+	if content, _ := os.ReadFile(backups[0]); string(content) != "old" {
+		t.Errorf("backup content = %q, want the old database", content)
+	}
+}
+
+// 较新版本导出的归档不能恢复
+func TestRestoreDataArchiveRejectsNewerManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest ArchiveManifest
+	}{
+		{"归档格式版本较新", ArchiveManifest{Format: ArchiveFormatVersion + 1, Files: []string{dbFileName}}},
+		{"数据库结构版本较新", ArchiveManifest{Format: ArchiveFormatVersion, SchemaVersion: CurrentSchemaVersion + 1, Files: []string{dbFileName}}},
+		{"没有配置数据库", ArchiveManifest{Format: ArchiveFormatVersion, Files: []string{archiveDailyName}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := json.Marshal(tt.manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			gzipWriter := gzip.NewWriter(&buf)
+			tarWriter := tar.NewWriter(gzipWriter)
+			if err := writeArchiveBytes(tarWriter, archiveManifestName, content, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeArchiveBytes(tarWriter, dbFileName, []byte("db"), time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			tarWriter.Close()
+			gzipWriter.Close()
+
+			archivePath := filepath.Join(t.TempDir(), "archive.tar.gz")
+			if err := os.WriteFile(archivePath, buf.Bytes(), 0600); err != nil {
+				t.Fatal(err)
+			}
+			dataDir := t.TempDir()
+			if _, err := RestoreDataArchive(archivePath, dataDir, false); err == nil {
+				t.Fatal("RestoreDataArchive succeeded, want an error")
+			}
+			if entries, _ := os.ReadDir(dataDir); len(entries) != 0 {
+				t.Errorf("data dir has %d entries after a rejected restore", len(entries))
+			}
+		})
+	}
+}
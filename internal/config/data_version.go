@@ -0,0 +1,278 @@
+/**
+  @author: Hanhai
+  @desc: 数据目录版本检查，新版本程序升级前自动备份数据库，旧版本程序打开新版本数据时进入只读维护模式
+**/
+
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CurrentSchemaVersion 当前程序使用的数据库结构版本
+// 修改表结构且旧版本程序无法安全写入时需要增加该版本号
+const CurrentSchemaVersion = 1
+
+// 数据库中保存数据库结构版本的配置键
+const schemaVersionKey = "schema_version"
+
+// ErrMaintenanceMode 只读维护模式下拒绝写入数据库
+var ErrMaintenanceMode = errors.New("程序处于只读维护模式，不能写入数据库")
+
+// DataVersionStatus 数据目录版本检查结果
+type DataVersionStatus struct {
+	BinaryVersion string `json:"binary_version"`        // 当前程序版本
+	DataVersion   string `json:"data_version"`          // 数据目录中记录的程序版本
+	BinarySchema  int    `json:"binary_schema"`         // 当前程序的数据库结构版本
+	DataSchema    int    `json:"data_schema"`           // 数据目录的数据库结构版本
+	ReadOnly      bool   `json:"read_only"`             // 是否处于只读维护模式
+	Upgraded      bool   `json:"upgraded"`              // 是否从旧版本数据升级
+	BackupPath    string `json:"backup_path,omitempty"` // 升级前的数据库备份路径
+	Message       string `json:"message,omitempty"`     // 版本不一致时的说明
+}
+
+var (
+	dataVersionStatus     DataVersionStatus
+	dataVersionStatusLock sync.RWMutex
+
+	// 当前程序版本，打开配置数据库时用于检查数据目录版本
+	currentBinaryVersion string
+)
+
+// SetBinaryVersion 设置当前程序版本，需要在InitConfigDB之前调用
+func SetBinaryVersion(version string) {
+	currentBinaryVersion = version
+}
+
+// CheckDataVersion 比较当前程序版本和数据目录中记录的版本
+// 程序版本较新时先备份数据库再继续执行迁移；数据库结构版本比程序支持的更新时以只读方式重新打开数据库
+// InitConfigDB在创建表和迁移之前调用，InitConfigDBReadOnly在打开数据库后调用
+func CheckDataVersion(dbPath string, binaryVersion string) DataVersionStatus {
+	status := DataVersionStatus{
+		BinaryVersion: normalizeVersion(binaryVersion),
+		BinarySchema:  CurrentSchemaVersion,
+	}
+	if !configTableExists() {
+		// 新的数据目录，还没有配置表
+		storeDataVersionStatus(status)
+		return status
+	}
+
+	dataVersion, hasVersion := readConfigValue("version")
+	schemaValue, hasSchema := readConfigValue(schemaVersionKey)
+	status.DataVersion = normalizeVersion(dataVersion)
+	if hasSchema {
+		status.DataSchema, _ = strconv.Atoi(schemaValue)
+	}
+
+	switch {
+	case !hasVersion && !hasSchema:
+		// 新的数据目录，无需处理
+
+	case status.DataSchema > CurrentSchemaVersion:
+		status.ReadOnly = true
+		status.Message = fmt.Sprintf("数据目录由较新的版本 %s（数据库结构版本 %d）写入，当前程序 %s 仅支持数据库结构版本 %d，已进入只读维护模式，请升级程序后再修改配置",
+			displayVersion(status.DataVersion), status.DataSchema, status.BinaryVersion, CurrentSchemaVersion)
+		if !IsReadOnlyDatabase() {
+			if err := reopenConfigDBReadOnly(dbPath); err != nil {
+				logger.Error("以只读方式重新打开配置数据库失败: %v", err)
+			}
+		}
+
+	case IsReadOnlyDatabase() && (status.DataSchema < CurrentSchemaVersion || compareVersions(status.BinaryVersion, status.DataVersion) > 0):
+		// 只读数据库由可写实例负责升级，副本实例不备份也不迁移
+		status.Message = fmt.Sprintf("共享数据库由旧版本 %s 写入，当前程序 %s 以只读模式运行，不执行升级",
+			displayVersion(status.DataVersion), status.BinaryVersion)
+
+	case status.DataSchema < CurrentSchemaVersion || compareVersions(status.BinaryVersion, status.DataVersion) > 0:
+		status.Upgraded = true
+		backupPath, err := backupConfigDB(dbPath, status.DataVersion)
+		if err != nil {
+			logger.Error("升级前备份数据库失败: %v", err)
+			status.Message = fmt.Sprintf("数据目录从 %s 升级到 %s，升级前备份数据库失败: %v",
+				displayVersion(status.DataVersion), status.BinaryVersion, err)
+		} else {
+			status.BackupPath = backupPath
+			status.Message = fmt.Sprintf("数据目录从 %s 升级到 %s，升级前的数据库已备份到 %s",
+				displayVersion(status.DataVersion), status.BinaryVersion, backupPath)
+		}
+
+	case compareVersions(status.BinaryVersion, status.DataVersion) < 0:
+		status.Message = fmt.Sprintf("数据目录由较新的版本 %s 写入，当前程序 %s 的数据库结构兼容，继续正常运行",
+			status.DataVersion, status.BinaryVersion)
+	}
+
+	if status.Message != "" {
+		if status.ReadOnly {
+			logger.Error("%s", status.Message)
+		} else {
+			logger.Warn("%s", status.Message)
+		}
+	}
+
+	storeDataVersionStatus(status)
+	return status
+}
+
+// storeDataVersionStatus 保存数据目录版本检查结果
+func storeDataVersionStatus(status DataVersionStatus) {
+	dataVersionStatusLock.Lock()
+	dataVersionStatus = status
+	dataVersionStatusLock.Unlock()
+}
+
+// configTableExists 检查配置表是否存在
+func configTableExists() bool {
+	if db == nil {
+		return false
+	}
+	var count int
+	err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?", configTableName).Scan(&count)
+	return err == nil && count > 0
+}
+
+// GetDataVersionStatus 获取启动时的数据目录版本检查结果
+func GetDataVersionStatus() DataVersionStatus {
+	dataVersionStatusLock.RLock()
+	defer dataVersionStatusLock.RUnlock()
+	return dataVersionStatus
+}
+
+// IsMaintenanceMode 检查程序是否处于只读维护模式
+func IsMaintenanceMode() bool {
+	dataVersionStatusLock.RLock()
+	defer dataVersionStatusLock.RUnlock()
+	return dataVersionStatus.ReadOnly
+}
+
+// SQLiteDSN 获取打开数据库使用的连接字符串，只读数据库模式和只读维护模式下以只读方式打开
+func SQLiteDSN(dbPath string) string {
+	if IsReadOnlyDatabase() {
+		return "file:" + filepath.ToSlash(dbPath) + "?mode=ro&_pragma=query_only(1)"
+	}
+	if IsMaintenanceMode() {
+		return "file:" + filepath.ToSlash(dbPath) + "?mode=ro"
+	}
+	return dbPath
+}
+
+// saveSchemaVersion 保存当前程序的数据库结构版本
+func saveSchemaVersion() error {
+	_, err := db.Exec("INSERT OR REPLACE INTO "+configTableName+" (key, value) VALUES (?, ?)",
+		schemaVersionKey, strconv.Itoa(CurrentSchemaVersion))
+	return err
+}
+
+// readConfigValue 读取配置表中的单个值，不存在时返回false
+func readConfigValue(key string) (string, bool) {
+	if db == nil {
+		return "", false
+	}
+
+	var value string
+	err := db.QueryRow("SELECT value FROM "+configTableName+" WHERE key = ?", key).Scan(&value)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("读取配置项%s失败: %v", key, err)
+		}
+		return "", false
+	}
+	return value, true
+}
+
+// reopenConfigDBReadOnly 关闭当前数据库连接并以只读方式重新打开
+func reopenConfigDBReadOnly(dbPath string) error {
+	if db != nil {
+		_ = db.Close()
+	}
+
+	readOnlyDB, err := sql.Open("sqlite", "file:"+filepath.ToSlash(dbPath)+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	readOnlyDB.SetMaxOpenConns(1)
+	readOnlyDB.SetMaxIdleConns(1)
+	readOnlyDB.SetConnMaxLifetime(30 * time.Minute)
+
+	if err := readOnlyDB.Ping(); err != nil {
+		readOnlyDB.Close()
+		return err
+	}
+
+	db = readOnlyDB
+	closeConfigDBOnce = sync.Once{}
+	return nil
+}
+
+// backupConfigDB 将数据库备份到数据目录下的backups目录，返回备份文件路径
+func backupConfigDB(dbPath string, dataVersion string) (string, error) {
+	backupDir := filepath.Join(filepath.Dir(dbPath), "backups")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return "", fmt.Errorf("创建备份目录失败: %w", err)
+	}
+
+	fileExt := filepath.Ext(dbPath)
+	name := strings.TrimSuffix(filepath.Base(dbPath), fileExt)
+	backupPath := filepath.Join(backupDir, fmt.Sprintf("%s_%s_%s%s",
+		name, displayVersion(dataVersion), time.Now().Format("20060102_150405"), fileExt))
+
+	// VACUUM INTO 会生成包含WAL中数据的一致性副本
+	if _, err := db.Exec("VACUUM INTO ?", backupPath); err != nil {
+		return "", fmt.Errorf("备份数据库失败: %w", err)
+	}
+
+	logger.Info("升级前的数据库已备份到: %s", backupPath)
+	return backupPath, nil
+}
+
+// normalizeVersion 统一版本号格式，添加v前缀
+func normalizeVersion(version string) string {
+	version = strings.TrimSpace(version)
+	if version != "" && !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return version
+}
+
+// displayVersion 获取用于显示的版本号，未记录版本时返回"未知版本"
+func displayVersion(version string) string {
+	if version == "" {
+		return "未知版本"
+	}
+	return version
+}
+
+// compareVersions 比较两个形如v1.3.9的版本号，a较新时返回1，较旧时返回-1，相同或无法比较时返回0
+func compareVersions(a, b string) int {
+	if a == "" || b == "" {
+		return 0
+	}
+
+	partsA := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	partsB := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var na, nb int
+		if i < len(partsA) {
+			na, _ = strconv.Atoi(strings.SplitN(partsA[i], "-", 2)[0])
+		}
+		if i < len(partsB) {
+			nb, _ = strconv.Atoi(strings.SplitN(partsB[i], "-", 2)[0])
+		}
+		if na > nb {
+			return 1
+		}
+		if na < nb {
+			return -1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// writeFixtureDB 创建只有配置表的数据库，模拟由指定版本写入的数据目录
+func writeFixtureDB(t *testing.T, version string, schema int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.db")
+	fixture, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fixture.Close()
+	if _, err := fixture.Exec(`CREATE TABLE ` + configTableName + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key TEXT UNIQUE NOT NULL,
+		value TEXT NOT NULL
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fixture.Exec("INSERT INTO "+configTableName+" (key, value) VALUES ('version', ?), (?, ?)",
+		version, schemaVersionKey, strconv.Itoa(schema)); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// hasTable 用单独的连接检查数据库文件中是否有指定的表
+func hasTable(t *testing.T, path string, table string) bool {
+	t.Helper()
+	conn, err := sql.Open("sqlite", "file:"+filepath.ToSlash(path)+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var count int
+	if err := conn.QueryRow("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?", table).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count > 0
+}
+
+func openFixture(t *testing.T, path string, version string) DataVersionStatus {
+	t.Helper()
+	SetBinaryVersion(version)
+	t.Cleanup(func() {
+		SetBinaryVersion("")
+		CloseConfigDB()
+		storeDataVersionStatus(DataVersionStatus{})
+	})
+	if err := InitConfigDB(path); err != nil {
+		t.Fatalf("InitConfigDB 失败: %v", err)
+	}
+	return GetDataVersionStatus()
+}
+
+func TestInitConfigDBNewerSchemaSkipsDDL(t *testing.T) {
+	path := writeFixtureDB(t, "v9.0.0", CurrentSchemaVersion+1)
+
+	status := openFixture(t, path, "v1.0.0")
+	if !status.ReadOnly || !IsMaintenanceMode() {
+		t.Fatalf("较新的数据库结构没有进入只读维护模式: %+v", status)
+	}
+	// 只读维护模式下不能创建表或执行迁移
+	for _, table := range []string{shadowTrafficTableName, versionHistoryTableName, securityAuditTableName, notificationOutboxTableName} {
+		if hasTable(t, path, table) {
+			t.Errorf("只读维护模式下创建了表 %s", table)
+		}
+	}
+}
+
+func TestInitConfigDBBacksUpBeforeMigrations(t *testing.T) {
+	path := writeFixtureDB(t, "v1.0.0", CurrentSchemaVersion-1)
+
+	status := openFixture(t, path, "v9.0.0")
+	if !status.Upgraded || status.BackupPath == "" {
+		t.Fatalf("旧版本数据没有在升级前备份: %+v", status)
+	}
+	if _, err := os.Stat(status.BackupPath); err != nil {
+		t.Fatalf("备份文件不存在: %v", err)
+	}
+	// 备份在创建表之前完成，只包含升级前的表
+	if hasTable(t, status.BackupPath, shadowTrafficTableName) {
+		t.Error("备份中包含升级后创建的表，备份在迁移之后执行")
+	}
+	if !hasTable(t, path, shadowTrafficTableName) {
+		t.Error("升级后没有创建表")
+	}
+}
+
+func TestInitConfigDBNewDataDir(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.db")
+
+	status := openFixture(t, path, "v1.0.0")
+	if status.ReadOnly || status.Upgraded || status.Message != "" {
+		t.Fatalf("新的数据目录不应有版本提示: %+v", status)
+	}
+	if !hasTable(t, path, configTableName) {
+		t.Fatal("没有创建配置表")
+	}
+}
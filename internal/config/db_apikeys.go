@@ -6,6 +6,7 @@
 package config
 
 import (
+	"database/sql"
 	"errors"
 	"flowsilicon/internal/logger"
 	"fmt"
@@ -43,6 +44,11 @@ func InitApiKeysDB() error {
 		return errors.New("数据库连接未初始化")
 	}
 
+	// 只读数据库模式下不创建表和迁移字段，表结构由可写实例维护
+	if IsReadOnlyDatabase() {
+		return nil
+	}
+
 	// 创建API密钥表如果不存在 - 新表结构
 	query := `CREATE TABLE IF NOT EXISTS ` + apikeysTableName + ` (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -60,10 +66,93 @@ func InitApiKeysDB() error {
 		tpm INTEGER NOT NULL,
 		score REAL NOT NULL,
 		is_delete BOOLEAN NOT NULL,
-		is_used BOOLEAN NOT NULL DEFAULT FALSE
+		is_used BOOLEAN NOT NULL DEFAULT FALSE,
+		key_group TEXT NOT NULL DEFAULT '',
+		balance_mode TEXT NOT NULL DEFAULT '',
+		cost_per_request REAL NOT NULL DEFAULT 0,
+		client_errors INTEGER NOT NULL DEFAULT 0,
+		provider TEXT DEFAULT '` + DefaultKeyProvider + `',
+		tags TEXT NOT NULL DEFAULT '',
+		alias TEXT NOT NULL DEFAULT '',
+		added_at INTEGER NOT NULL DEFAULT 0
 	)`
 	_, err := db.Exec(query)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// 旧版本数据库需要添加后续新增的字段
+	columns := []struct {
+		name       string
+		definition string
+	}{
+		{"key_group", "TEXT NOT NULL DEFAULT ''"},
+		{"balance_mode", "TEXT NOT NULL DEFAULT ''"},
+		{"cost_per_request", "REAL NOT NULL DEFAULT 0"},
+		{"client_errors", "INTEGER NOT NULL DEFAULT 0"},
+		{"provider", "TEXT DEFAULT '" + DefaultKeyProvider + "'"},
+		{"tags", "TEXT NOT NULL DEFAULT ''"},
+		{"alias", "TEXT NOT NULL DEFAULT ''"},
+		{"added_at", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, column := range columns {
+		if err := ensureApikeysColumn(column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	// 按密钥的规范形式添加唯一索引，旧版本保存的带空白或Bearer前缀的密钥先改为规范形式，已有重复记录时不添加
+	// 旧版本的索引只去掉空白，带Bearer前缀的相同密钥可以重复添加，替换为新的索引
+	if _, err := db.Exec("UPDATE " + apikeysTableName + " SET key = " + apikeysCanonicalKeySQL + " WHERE key <> " + apikeysCanonicalKeySQL + " AND " + apikeysCanonicalKeySQL + " NOT IN (SELECT key FROM " + apikeysTableName + ")"); err != nil {
+		logger.Error("将API密钥改为规范形式失败: %v", err)
+	}
+	if _, err := db.Exec("DROP INDEX IF EXISTS idx_" + apikeysTableName + "_key_canonical"); err != nil {
+		logger.Error("删除旧的apikeys密钥唯一索引失败: %v", err)
+	}
+	if _, err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_" + apikeysTableName + "_key_canonical_v2 ON " + apikeysTableName + " (" + apikeysCanonicalKeySQL + ")"); err != nil {
+		logger.Warn("创建apikeys密钥唯一索引失败，数据库中可能有重复的密钥: %v", err)
+	}
+
+	// 为密钥计数查询添加状态索引
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_" + apikeysTableName + "_status ON " + apikeysTableName + " (is_delete, disabled)")
+	if err != nil {
+		logger.Error("创建apikeys状态索引失败: %v", err)
+		return err
+	}
+
+	// 创建余额历史表
+	if err := initBalanceHistoryTable(); err != nil {
+		return err
+	}
+
+	// 创建密钥断路器状态表
+	return initKeyCircuitTable()
+}
+
+// apikeysCanonicalKeySQL 与CanonicalApiKey相同的密钥规范形式：去掉首尾的空白，再去掉不区分大小写的Bearer前缀和其后的空白
+const apikeysCanonicalKeySQL = `(CASE WHEN length(trim(key, ' ' || char(9, 10, 13))) > 7 AND lower(substr(trim(key, ' ' || char(9, 10, 13)), 1, 7)) = 'bearer '
+	THEN trim(substr(trim(key, ' ' || char(9, 10, 13)), 8), ' ' || char(9, 10, 13))
+	ELSE trim(key, ' ' || char(9, 10, 13)) END)`
+
+// ensureApikeysColumn 检查apikeys表中的字段，不存在时添加
+func ensureApikeysColumn(name string, definition string) error {
+	var columnExists int
+	err := db.QueryRow("SELECT count(*) FROM pragma_table_info('"+apikeysTableName+"') WHERE name=?", name).Scan(&columnExists)
+	if err != nil {
+		logger.Error("检查%s字段存在失败: %v", name, err)
+		return err
+	}
+
+	if columnExists == 0 {
+		_, err = db.Exec("ALTER TABLE " + apikeysTableName + " ADD COLUMN " + name + " " + definition)
+		if err != nil {
+			logger.Error("添加%s字段失败: %v", name, err)
+			return err
+		}
+		logger.Info("成功添加%s字段到apikeys表", name)
+	}
+
+	return nil
 }
 
 // LoadApiKeysFromDB 从数据库加载API密钥
@@ -103,15 +192,32 @@ func LoadApiKeysFromDB() error {
 		}
 	}
 
+	// 在读事务中查询（SQLite的BEGIN默认为DEFERRED），整个读取过程使用同一个快照，
+	// 密钥管理器同时保存统计数据时不会读到一部分新数据和一部分旧数据。
+	// 快照的一致性依赖InitConfigDB中db.SetMaxOpenConns(1)：事务占用唯一的连接，
+	// 其他更新和保存要等事务结束后才能执行；放开连接数后需要重新检查这里的隔离级别
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始读取API密钥的事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 共享缓存模式下也不读取其他连接未提交的数据
+	if _, err := tx.Exec("PRAGMA read_uncommitted = false"); err != nil {
+		return fmt.Errorf("设置读取隔离级别失败: %w", err)
+	}
+
 	// 查询所有密钥，包括被逻辑删除的密钥
-	rows, err := db.Query(`SELECT 
-		key, balance, last_used, total_calls, success_calls, success_rate, 
-		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used 
+	rows, err := tx.Query(`SELECT 
+		id, key, balance, last_used, total_calls, success_calls, success_rate, 
+		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used, key_group, balance_mode, cost_per_request, client_errors, provider, tags, alias, added_at 
 		FROM ` + apikeysTableName)
 	if err != nil {
 		// 如果是因为表不存在，尝试重新创建表
 		if strings.Contains(err.Error(), "no such table") {
 			logger.Error("API密钥表不存在，尝试创建")
+			// 先结束读事务，避免创建表时等待
+			tx.Rollback()
 			if initErr := InitApiKeysDB(); initErr != nil {
 				return fmt.Errorf("创建API密钥表失败: %w", initErr)
 			}
@@ -119,6 +225,7 @@ func LoadApiKeysFromDB() error {
 			keysMutex.Lock()
 			defer keysMutex.Unlock()
 			apiKeys = make([]ApiKey, 0)
+			apiKeysLoaded = true
 			logger.Info("已创建API密钥表，但没有密钥数据")
 			return nil
 		}
@@ -126,13 +233,18 @@ func LoadApiKeysFromDB() error {
 	}
 	defer rows.Close()
 
-	// 临时存储加载的密钥
+	// 临时存储加载的密钥，按密钥的规范形式去重
 	var loadedKeys []ApiKey
+	loadedIndex := make(map[string]int)
 
 	// 处理查询结果
 	for rows.Next() {
 		var key ApiKey
+		// 旧版本迁移添加的provider字段允许为NULL
+		var provider sql.NullString
+		var tags string
 		if err := rows.Scan(
+			&key.ID,
 			&key.Key,
 			&key.Balance,
 			&key.LastUsed,
@@ -143,15 +255,37 @@ func LoadApiKeysFromDB() error {
 			&key.Disabled,
 			&key.DisabledAt,
 			&key.LastTested,
-			&key.RequestsPerMinute,
-			&key.TokensPerMinute,
+			&key.RPM.Used,
+			&key.TPM.Used,
 			&key.Score,
 			&key.Delete,
 			&key.IsUsed,
+			&key.Group,
+			&key.BalanceMode,
+			&key.CostPerRequest,
+			&key.ClientErrors,
+			&provider,
+			&tags,
+			&key.Alias,
+			&key.AddedAt,
 		); err != nil {
 			logger.Error("扫描API密钥数据失败: %v", err)
 			continue
 		}
+		key.Provider = provider.String
+		key.Tags = ParseKeyTags(tags)
+
+		// 同一个密钥有多条记录时只加载一条，优先加载未删除的记录
+		canonical := CanonicalApiKey(key.Key)
+		key.Key = canonical
+		if i, exists := loadedIndex[canonical]; exists {
+			logger.Warn("API密钥 %s 在数据库中有多条记录，只加载其中一条", MaskKey(canonical))
+			if loadedKeys[i].Delete && !key.Delete {
+				loadedKeys[i] = key
+			}
+			continue
+		}
+		loadedIndex[canonical] = len(loadedKeys)
 
 		// 添加到加载的密钥列表，包括被标记为删除的密钥
 		loadedKeys = append(loadedKeys, key)
@@ -161,20 +295,28 @@ func LoadApiKeysFromDB() error {
 	if err := rows.Err(); err != nil {
 		return fmt.Errorf("处理API密钥数据时发生错误: %w", err)
 	}
+	rows.Close()
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("结束读取API密钥的事务失败: %w", err)
+	}
 
-	// 更新全局密钥列表
+	// 更新全局密钥列表，释放锁之后通知订阅者
+	defer notifyApiKeyChanges()
 	keysMutex.Lock()
 	defer keysMutex.Unlock()
 
 	// 分配新的切片
 	apiKeys = make([]ApiKey, len(loadedKeys))
 	copy(apiKeys, loadedKeys)
+	apiKeysLoaded = true
 
 	// 初始化每个密钥的运行时数据
 	for i := range apiKeys {
-		apiKeys[i].RequestsPerMinute = 0
-		apiKeys[i].TokensPerMinute = 0
+		apiKeys[i].RPM = RateLimitWindow{}
+		apiKeys[i].TPM = RateLimitWindow{}
 		apiKeys[i].RecentRequests = make([]RequestStats, 0)
+		// 按调用计数重新计算成功率，排除客户端错误
+		recomputeSuccessRateLocked(&apiKeys[i])
 	}
 
 	logger.Info("已从数据库加载 %d 个API密钥（包括 %d 个逻辑删除的密钥）",
@@ -200,6 +342,9 @@ func SaveApiKeysToDB() error {
 		logger.Error("数据库连接未初始化，请先调用InitConfigDB")
 		return errors.New("数据库连接未初始化")
 	}
+	if err := CheckWritable(); err != nil {
+		return err
+	}
 
 	keysMutex.RLock()
 	defer keysMutex.RUnlock()
@@ -219,9 +364,9 @@ func SaveApiKeysToDB() error {
 
 	// 准备插入语句
 	stmt, err := tx.Prepare(`INSERT INTO ` + apikeysTableName + ` 
-		(key, balance, last_used, total_calls, success_calls, success_rate, 
-		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		(id, key, balance, last_used, total_calls, success_calls, success_rate, 
+		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used, key_group, balance_mode, cost_per_request, client_errors, provider, tags, alias, added_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return err
 	}
@@ -237,7 +382,8 @@ func SaveApiKeysToDB() error {
 
 		// 插入数据库
 		_, err = stmt.Exec(
-			keyCopy.Key,
+			nullableKeyID(keyCopy.ID),
+			CanonicalApiKey(keyCopy.Key),
 			keyCopy.Balance,
 			keyCopy.LastUsed,
 			keyCopy.TotalCalls,
@@ -247,11 +393,19 @@ func SaveApiKeysToDB() error {
 			keyCopy.Disabled,
 			keyCopy.DisabledAt,
 			keyCopy.LastTested,
-			keyCopy.RequestsPerMinute,
-			keyCopy.TokensPerMinute,
+			keyCopy.RPM.Current(),
+			keyCopy.TPM.Current(),
 			keyCopy.Score,
 			keyCopy.Delete,
 			keyCopy.IsUsed,
+			keyCopy.Group,
+			keyCopy.BalanceMode,
+			keyCopy.CostPerRequest,
+			keyCopy.ClientErrors,
+			keyCopy.GetProvider(),
+			joinKeyTags(keyCopy.Tags),
+			keyCopy.Alias,
+			keyCopy.AddedAt,
 		)
 		if err != nil {
 			logger.Error("插入API密钥失败: %v", err)
@@ -275,6 +429,9 @@ func AddApiKeyToDB(key ApiKey) error {
 		logger.Error("数据库连接未初始化，请先调用InitConfigDB")
 		return errors.New("数据库连接未初始化")
 	}
+	if err := CheckWritable(); err != nil {
+		return err
+	}
 
 	// 清空RecentRequests数组，不需要存储到数据库
 	keyCopy := key
@@ -282,10 +439,11 @@ func AddApiKeyToDB(key ApiKey) error {
 
 	// 插入到数据库
 	_, err := db.Exec(`INSERT OR REPLACE INTO `+apikeysTableName+` 
-		(key, balance, last_used, total_calls, success_calls, success_rate, 
-		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		keyCopy.Key,
+		(id, key, balance, last_used, total_calls, success_calls, success_rate, 
+		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, is_used, key_group, balance_mode, cost_per_request, client_errors, provider, tags, alias, added_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nullableKeyID(keyCopy.ID),
+		CanonicalApiKey(keyCopy.Key),
 		keyCopy.Balance,
 		keyCopy.LastUsed,
 		keyCopy.TotalCalls,
@@ -295,11 +453,19 @@ func AddApiKeyToDB(key ApiKey) error {
 		keyCopy.Disabled,
 		keyCopy.DisabledAt,
 		keyCopy.LastTested,
-		keyCopy.RequestsPerMinute,
-		keyCopy.TokensPerMinute,
+		keyCopy.RPM.Current(),
+		keyCopy.TPM.Current(),
 		keyCopy.Score,
 		keyCopy.Delete,
 		keyCopy.IsUsed,
+		keyCopy.Group,
+		keyCopy.BalanceMode,
+		keyCopy.CostPerRequest,
+		keyCopy.ClientErrors,
+		keyCopy.GetProvider(),
+		joinKeyTags(keyCopy.Tags),
+		keyCopy.Alias,
+		keyCopy.AddedAt,
 	)
 
 	if err != nil {
@@ -310,3 +476,38 @@ func AddApiKeyToDB(key ApiKey) error {
 	logger.Info("已添加API密钥到数据库: %s", MaskKey(key.Key))
 	return nil
 }
+
+// nullableKeyID 将密钥ID转换为数据库参数，未分配ID时由数据库自动生成
+func nullableKeyID(id int) interface{} {
+	if id <= 0 {
+		return nil
+	}
+	return id
+}
+
+// getApiKeyIDFromDB 从数据库查询密钥对应的记录ID
+func getApiKeyIDFromDB(key string) (int, error) {
+	if db == nil {
+		return 0, errors.New("数据库连接未初始化")
+	}
+
+	var id int
+	err := db.QueryRow("SELECT id FROM "+apikeysTableName+" WHERE key = ?", key).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// GetApiKeyByID 根据数据库记录ID获取API密钥（不包括标记为删除的密钥）
+func GetApiKeyByID(id int) (ApiKey, bool) {
+	keysMutex.RLock()
+	defer keysMutex.RUnlock()
+
+	for _, key := range apiKeys {
+		if key.ID == id && !key.Delete {
+			return key, true
+		}
+	}
+	return ApiKey{}, false
+}
@@ -0,0 +1,326 @@
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// setupApikeysDB 在临时目录中创建配置数据库和apikeys表，并清空内存中的密钥
+func setupApikeysDB(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.db")
+	if err := InitConfigDB(path); err != nil {
+		t.Fatalf("InitConfigDB 失败: %v", err)
+	}
+	t.Cleanup(func() {
+		CloseConfigDB()
+		ReplaceApiKeys(nil)
+		UpdateConfig(&Config{})
+	})
+	if err := EnsureApikeys(path); err != nil {
+		t.Fatalf("EnsureApikeys 失败: %v", err)
+	}
+	UpdateConfig(&Config{})
+	ReplaceApiKeys(nil)
+	return path
+}
+
+// countApikeysRows 统计数据库中规范形式为key的记录数
+func countApikeysRows(t *testing.T, key string) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM "+apikeysTableName+" WHERE "+apikeysCanonicalKeySQL+" = ?", key).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// currentApiKeys 获取内存中的所有密钥
+func currentApiKeys(t *testing.T) []ApiKey {
+	t.Helper()
+	keys, err := GetApiKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// 同一个密钥以不同的形式并发添加50次，内存和数据库中都只有一条记录
+func TestAddApiKeyConcurrentDuplicates(t *testing.T) {
+	setupApikeysDB(t)
+
+	variants := []string{"sk-concurrent-test-key", " sk-concurrent-test-key ", "Bearer sk-concurrent-test-key", "bearer  sk-concurrent-test-key\n"}
+	const adds = 50
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < adds; i++ {
+		wg.Add(1)
+		go func(raw string) {
+			defer wg.Done()
+			if _, existed := AddApiKey(raw, 10); !existed {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}(variants[i%len(variants)])
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("AddApiKey reported %d new keys, want 1", created)
+	}
+	keys := currentApiKeys(t)
+	if len(keys) != 1 {
+		t.Fatalf("len(keys) = %d, want 1", len(keys))
+	}
+	if got := keys[0].Key; got != "sk-concurrent-test-key" {
+		t.Errorf("stored key = %q, want the canonical form", got)
+	}
+	if got := countApikeysRows(t, "sk-concurrent-test-key"); got != 1 {
+		t.Errorf("database rows = %d, want 1", got)
+	}
+
+	if err := SaveApiKeys(); err != nil {
+		t.Fatalf("SaveApiKeys 失败: %v", err)
+	}
+	if err := LoadApiKeysFromDB(); err != nil {
+		t.Fatalf("LoadApiKeysFromDB 失败: %v", err)
+	}
+	if got := len(currentApiKeys(t)); got != 1 {
+		t.Errorf("len(keys) after reload = %d, want 1", got)
+	}
+}
+
+// 唯一索引与CanonicalApiKey使用相同的规范形式，带Bearer前缀的相同密钥不能再写入
+func TestApikeysCanonicalIndex(t *testing.T) {
+	setupApikeysDB(t)
+
+	if err := AddApiKeyToDB(ApiKey{Key: "sk-index-test-key", Balance: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range []string{"Bearer sk-index-test-key", " sk-index-test-key"} {
+		_, err := db.Exec("INSERT INTO "+apikeysTableName+` (key, balance, last_used, total_calls, success_calls, success_rate,
+			consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete)
+			VALUES (?, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)`, raw)
+		if err == nil {
+			t.Errorf("inserting %q succeeded, want a unique constraint error", raw)
+		}
+	}
+	if got := countApikeysRows(t, "sk-index-test-key"); got != 1 {
+		t.Errorf("database rows = %d, want 1", got)
+	}
+}
+
+// 旧版本只按trim(key)建立唯一索引，升级时带Bearer前缀的密钥改为规范形式并替换索引
+func TestApikeysCanonicalMigration(t *testing.T) {
+	setupApikeysDB(t)
+
+	for _, stmt := range []string{
+		"DROP INDEX idx_" + apikeysTableName + "_key_canonical_v2",
+		"CREATE UNIQUE INDEX idx_" + apikeysTableName + "_key_canonical ON " + apikeysTableName + " (trim(key))",
+		"INSERT INTO " + apikeysTableName + ` (key, balance, last_used, total_calls, success_calls, success_rate,
+			consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete)
+			VALUES ('Bearer sk-migrated-key', 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := InitApiKeysDB(); err != nil {
+		t.Fatalf("InitApiKeysDB 失败: %v", err)
+	}
+
+	var key string
+	if err := db.QueryRow("SELECT key FROM " + apikeysTableName).Scan(&key); err != nil {
+		t.Fatal(err)
+	}
+	if key != "sk-migrated-key" {
+		t.Errorf("migrated key = %q, want sk-migrated-key", key)
+	}
+	var index string
+	if err := db.QueryRow("SELECT group_concat(name) FROM sqlite_master WHERE type='index' AND name LIKE ?",
+		"idx_"+apikeysTableName+"_key_canonical%").Scan(&index); err != nil {
+		t.Fatal(err)
+	}
+	if want := "idx_" + apikeysTableName + "_key_canonical_v2"; index != want {
+		t.Errorf("canonical indexes = %q, want %q", index, want)
+	}
+}
+
+// writeLegacyApikeysDB 创建旧版本结构的apikeys表，没有provider等后续新增的字段
+func writeLegacyApikeysDB(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.db")
+	fixture, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fixture.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE ` + apikeysTableName + ` (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			key TEXT UNIQUE NOT NULL,
+			balance REAL NOT NULL,
+			last_used INTEGER NOT NULL,
+			total_calls INTEGER NOT NULL,
+			success_calls INTEGER NOT NULL,
+			success_rate REAL NOT NULL,
+			consecutive_failures INTEGER NOT NULL,
+			disabled BOOLEAN NOT NULL,
+			disabled_at INTEGER NOT NULL,
+			last_tested INTEGER NOT NULL,
+			rpm INTEGER NOT NULL,
+			tpm INTEGER NOT NULL,
+			score REAL NOT NULL,
+			is_delete BOOLEAN NOT NULL,
+			is_used BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+		`INSERT INTO ` + apikeysTableName + ` (key, balance, last_used, total_calls, success_calls, success_rate,
+			consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete)
+			VALUES ('sk-legacy-key', 12.5, 0, 3, 2, 0.67, 0, 0, 0, 0, 0, 0, 0, 0)`,
+	} {
+		if _, err := fixture.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// 旧版本创建的数据库升级后添加provider字段，已有的密钥使用默认提供商，重复执行迁移不报错也不改变数据
+func TestEnsureApikeysMigratesLegacySchema(t *testing.T) {
+	path := writeLegacyApikeysDB(t)
+	if err := InitConfigDB(path); err != nil {
+		t.Fatalf("InitConfigDB 失败: %v", err)
+	}
+	t.Cleanup(func() {
+		CloseConfigDB()
+		ReplaceApiKeys(nil)
+		UpdateConfig(&Config{})
+	})
+	UpdateConfig(&Config{})
+
+	for i := 0; i < 2; i++ {
+		if err := EnsureApikeys(path); err != nil {
+			t.Fatalf("第%d次EnsureApikeys失败: %v", i+1, err)
+		}
+	}
+
+	for _, column := range []string{"provider", "tags", "alias", "added_at", "key_group", "balance_mode", "cost_per_request", "client_errors"} {
+		if !apikeysColumnExists(column) {
+			t.Errorf("迁移后缺少字段 %s", column)
+		}
+	}
+	var provider string
+	if err := db.QueryRow("SELECT provider FROM " + apikeysTableName + " WHERE key = 'sk-legacy-key'").Scan(&provider); err != nil {
+		t.Fatal(err)
+	}
+	if provider != DefaultKeyProvider {
+		t.Errorf("provider = %q, want %q", provider, DefaultKeyProvider)
+	}
+	if got := countApikeysRows(t, "sk-legacy-key"); got != 1 {
+		t.Errorf("database rows = %d, want 1", got)
+	}
+
+	if err := LoadApiKeysFromDB(); err != nil {
+		t.Fatalf("LoadApiKeysFromDB 失败: %v", err)
+	}
+	keys := currentApiKeys(t)
+	if len(keys) != 1 || keys[0].Balance != 12.5 || keys[0].TotalCalls != 3 || keys[0].Provider != DefaultKeyProvider {
+		t.Fatalf("loaded keys = %+v", keys)
+	}
+	if got := GetKeyCount(KeyFilter{Provider: DefaultKeyProvider}); got != 1 {
+		t.Errorf("GetKeyCount(provider=%s) = %d, want 1", DefaultKeyProvider, got)
+	}
+}
+
+// 统计数据更新和保存的同时加载密钥，加载结果中每个密钥只出现一次，调用计数不出现成功次数大于总次数的中间状态
+// 需要在-race下运行，检查加载和更新之间没有数据竞争
+func TestLoadApiKeysConcurrentWithStatUpdates(t *testing.T) {
+	setupApikeysDB(t)
+
+	const keyCount = 5
+	const rounds = 50
+	for i := 0; i < keyCount; i++ {
+		if _, existed := AddApiKey(fmt.Sprintf("sk-load-race-key-%d", i), 10); existed {
+			t.Fatalf("key %d already exists", i)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*rounds)
+	for i := 0; i < keyCount; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				UpdateApiKeySuccess(key)
+				if r%10 == 0 {
+					if err := SaveApiKeys(); err != nil {
+						errs <- fmt.Errorf("SaveApiKeys: %w", err)
+						return
+					}
+				}
+			}
+		}(fmt.Sprintf("sk-load-race-key-%d", i))
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for r := 0; r < rounds; r++ {
+			if err := LoadApiKeysFromDB(); err != nil {
+				errs <- fmt.Errorf("LoadApiKeysFromDB: %w", err)
+				return
+			}
+			keys, err := GetApiKeys()
+			if err != nil {
+				errs <- err
+				return
+			}
+			seen := make(map[string]bool, len(keys))
+			for _, k := range keys {
+				if seen[k.Key] {
+					errs <- fmt.Errorf("key %s loaded twice", k.Key)
+					return
+				}
+				seen[k.Key] = true
+				if k.SuccessCalls > k.TotalCalls {
+					errs <- fmt.Errorf("key %s loaded with %d successes out of %d calls", k.Key, k.SuccessCalls, k.TotalCalls)
+					return
+				}
+			}
+			if len(keys) != keyCount {
+				errs <- fmt.Errorf("loaded %d keys, want %d", len(keys), keyCount)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// 结束后内存中的统计与重新加载的数据库数据一致
+	if err := SaveApiKeys(); err != nil {
+		t.Fatalf("SaveApiKeys 失败: %v", err)
+	}
+	saved := currentApiKeys(t)
+	if err := LoadApiKeysFromDB(); err != nil {
+		t.Fatalf("LoadApiKeysFromDB 失败: %v", err)
+	}
+	loaded := make(map[string]ApiKey)
+	for _, k := range currentApiKeys(t) {
+		loaded[k.Key] = k
+	}
+	for _, k := range saved {
+		if got := loaded[k.Key]; got.TotalCalls != k.TotalCalls || got.SuccessCalls != k.SuccessCalls {
+			t.Errorf("key %s reloaded with %d/%d calls, want %d/%d", k.Key, got.SuccessCalls, got.TotalCalls, k.SuccessCalls, k.TotalCalls)
+		}
+	}
+}
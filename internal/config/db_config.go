@@ -6,7 +6,9 @@
 package config
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flowsilicon/internal/logger"
@@ -14,6 +16,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -29,6 +33,18 @@ const (
 var (
 	// 数据库实例
 	db *sql.DB
+	// 保证数据库只被关闭一次
+	closeConfigDBOnce sync.Once
+	// 程序的构建版本号，数据库和配置中都没有版本号时使用
+	buildVersion atomic.Value
+
+	// 配置数据库文件的绝对路径
+	configDBPath string
+
+	// 配置哈希，用于客户端检测配置变化
+	configHash          string
+	configHashUpdatedAt time.Time
+	configHashLock      sync.RWMutex
 )
 
 // InitConfigDB 初始化配置数据库
@@ -50,9 +66,17 @@ func InitConfigDB(dbPath string) error {
 	if err != nil {
 		return err
 	}
+	if absPath, err := filepath.Abs(dbPath); err == nil {
+		configDBPath = absPath
+	} else {
+		configDBPath = dbPath
+	}
+
+	// 重新打开后允许再次关闭
+	closeConfigDBOnce = sync.Once{}
 
 	// 设置连接池参数
-	db.SetMaxOpenConns(1)                   // 限制最大连接数为1，以减少并发问题
+	db.SetMaxOpenConns(1)                   // 限制最大连接数为1，以减少并发问题，LoadApiKeysFromDB读取快照的一致性依赖于此
 	db.SetMaxIdleConns(1)                   // 最大空闲连接数
 	db.SetConnMaxLifetime(30 * time.Minute) // 连接最大生命周期
 
@@ -68,6 +92,12 @@ func InitConfigDB(dbPath string) error {
 		return err
 	}
 
+	// 在创建表和迁移之前检查数据目录版本，升级前的备份不包含本次迁移的修改
+	// 数据由更新的版本写入时已以只读方式重新打开，不再创建表
+	if CheckDataVersion(dbPath, currentBinaryVersion).ReadOnly {
+		return nil
+	}
+
 	// 创建配置表如果不存在
 	query := `CREATE TABLE IF NOT EXISTS ` + configTableName + ` (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -94,15 +124,36 @@ func InitConfigDB(dbPath string) error {
 	}
 
 	logger.Info("配置表初始化成功")
-	return nil
+
+	// 创建影子流量记录表
+	if err := initShadowTrafficTable(); err != nil {
+		return err
+	}
+
+	// 创建版本历史表
+	if err := initVersionHistoryTable(); err != nil {
+		return err
+	}
+
+	// 创建安全审计表
+	if err := initSecurityAuditTable(); err != nil {
+		return err
+	}
+
+	// 创建通知发送队列表
+	return initNotificationOutboxTable()
 }
 
 // CloseConfigDB 关闭配置数据库
+// 可以安全地重复调用，只有第一次调用会真正关闭连接
 func CloseConfigDB() error {
-	if db != nil {
-		return db.Close()
-	}
-	return nil
+	var err error
+	closeConfigDBOnce.Do(func() {
+		if db != nil {
+			err = db.Close()
+		}
+	})
+	return err
 }
 
 // LoadConfigFromDB 从数据库加载配置
@@ -218,18 +269,42 @@ func LoadConfigFromDB() (*Config, error) {
 		return nil, fmt.Errorf("解析配置失败: %w", err)
 	}
 
+	// 记录数据库中的版本号，之后数据库不可用时GetVersion使用该值
+	if version, ok := readConfigValue("version"); ok && version != "" {
+		cfg.App.Version = version
+	}
+
+	// 旧版本数据库中没有新增的配置项，补全为默认值，只修改内存中的配置，保存设置时才写入数据库
+	if applied := ApplyConfigDefaults(&cfg); len(applied) > 0 {
+		logger.Info("以下配置项未设置，已使用默认值: %s", strings.Join(applied, ", "))
+	}
+	if applyLegacyPayloadDefault(&cfg, []byte(configJSON)) {
+		logger.Warn("已配置的webhook继续按旧版本的格式发送通知，接收程序支持事件信封后可以在设置页面关闭legacy_payload")
+	}
+
 	// 更新全局配置
-	config = &cfg
+	currentConfig.Store(&cfg)
+	applyCacheMemoryBudget(&cfg)
+
+	// 使用重新序列化后的规范JSON计算配置哈希
+	if canonicalJSON, err := json.Marshal(&cfg); err == nil {
+		updateConfigHash(canonicalJSON)
+	}
+
 	logger.Info("成功从数据库加载配置")
 	return &cfg, nil
 }
 
-// SaveConfigToDB 将当前配置保存到数据库
+// SaveConfigToDB 将当前配置保存到数据库，只读数据库模式下不保存
 func SaveConfigToDB() error {
 	cfg := GetConfig()
 	if cfg == nil {
 		return nil
 	}
+	if IsReadOnlyDatabase() {
+		logger.Debug("配置数据库为只读模式，跳过保存配置")
+		return nil
+	}
 
 	// 将配置转换为JSON
 	configJSON, err := json.Marshal(cfg)
@@ -244,15 +319,80 @@ func SaveConfigToDB() error {
 	)
 
 	if err == nil {
+		updateConfigHash(configJSON)
 		logger.Info("配置已成功保存到数据库")
 	}
 
 	return err
 }
 
-// GetVersion 从数据库中获取版本号
-// 如果没有找到version记录，返回空字符串
+// updateConfigHash 根据配置的规范JSON更新配置哈希
+func updateConfigHash(configJSON []byte) {
+	sum := sha256.Sum256(configJSON)
+	hash := hex.EncodeToString(sum[:])
+
+	configHashLock.Lock()
+	defer configHashLock.Unlock()
+
+	// 内容未变化时保留原更新时间
+	if hash == configHash {
+		return
+	}
+	configHash = hash
+	configHashUpdatedAt = time.Now()
+}
+
+// GetConfigHash 获取当前配置的SHA256哈希
+// 如果尚未计算过哈希，则根据当前内存中的配置计算
+func GetConfigHash() string {
+	configHashLock.RLock()
+	hash := configHash
+	configHashLock.RUnlock()
+
+	if hash != "" {
+		return hash
+	}
+
+	cfg := GetConfig()
+	if cfg == nil {
+		return ""
+	}
+
+	configJSON, err := json.Marshal(cfg)
+	if err != nil {
+		logger.Error("序列化配置失败: %v", err)
+		return ""
+	}
+	updateConfigHash(configJSON)
+
+	configHashLock.RLock()
+	defer configHashLock.RUnlock()
+	return configHash
+}
+
+// GetConfigHashUpdatedAt 获取配置哈希最后一次变化的时间
+func GetConfigHashUpdatedAt() time.Time {
+	configHashLock.RLock()
+	defer configHashLock.RUnlock()
+	return configHashUpdatedAt
+}
+
+// GetVersion 获取版本号，依次使用数据库中的版本号、加载配置时记录的版本号和程序的构建版本号
+// 都没有时返回空字符串
 func GetVersion() string {
+	if version := getDBVersion(); version != "" {
+		return version
+	}
+
+	// 数据库不可用时依次使用配置中记录的版本号和程序的构建版本号
+	if cfg := GetConfig(); cfg != nil && cfg.App.Version != "" {
+		return cfg.App.Version
+	}
+	return GetBuildVersion()
+}
+
+// getDBVersion 获取数据库中的版本号，数据库不可用或不存在版本号时返回空字符串
+func getDBVersion() string {
 	if db == nil {
 		logger.Error("数据库连接未初始化，请先调用InitConfigDB")
 		return ""
@@ -273,11 +413,29 @@ func GetVersion() string {
 	return version
 }
 
-// SaveVersion 保存版本号到数据库
+// SetBuildVersion 设置程序的构建版本号，由main在启动时调用，作为GetVersion最后的备选值
+func SetBuildVersion(version string) {
+	if version != "" && !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	buildVersion.Store(version)
+}
+
+// GetBuildVersion 获取程序的构建版本号，未设置时返回空字符串
+func GetBuildVersion() string {
+	version, _ := buildVersion.Load().(string)
+	return version
+}
+
+// SaveVersion 保存版本号和当前程序的数据库结构版本到数据库，版本号变化时记录到版本历史
+// 只读维护模式下不保存，避免旧版本程序覆盖新版本数据的版本记录；只读数据库模式下返回ErrReadOnlyDatabase
 func SaveVersion(version string) error {
 	if db == nil {
 		return errors.New("数据库连接未初始化，请先调用InitConfigDB")
 	}
+	if err := CheckWritable(); err != nil {
+		return err
+	}
 
 	// 检查version键是否已存在
 	var count int
@@ -285,6 +443,7 @@ func SaveVersion(version string) error {
 	if err != nil {
 		return err
 	}
+	previous, _ := readConfigValue("version")
 
 	// 根据键是否存在执行插入或更新操作
 	if count > 0 {
@@ -299,6 +458,15 @@ func SaveVersion(version string) error {
 		return err
 	}
 
+	if err := saveSchemaVersion(); err != nil {
+		return fmt.Errorf("保存数据库结构版本失败: %w", err)
+	}
+
+	// 版本历史只用于回滚，记录失败不影响启动
+	if err := recordVersionHistory(previous, version); err != nil {
+		logger.Error("记录版本历史失败: %v", err)
+	}
+
 	logger.Info("版本号 '%s' 已成功保存到数据库", version)
 	return nil
 }
@@ -317,6 +485,9 @@ func ExecWithRetry(operation string, maxRetries int, stmt string, args ...interf
 	if db == nil {
 		return nil, errors.New("数据库连接未初始化")
 	}
+	if err := CheckWritable(); err != nil {
+		return nil, err
+	}
 
 	var result sql.Result
 	var err error
@@ -344,3 +515,28 @@ func ExecWithRetry(operation string, maxRetries int, stmt string, args ...interf
 
 	return result, err
 }
+
+// ContainsConfigDB 检查目录中是否包含配置数据库，包括当前打开的数据库和目录下名为config.db的文件
+// 用于拒绝把数据目录或其上级目录设为对外提供文件的目录
+func ContainsConfigDB(dir string) bool {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return true
+	}
+	if _, err := os.Stat(filepath.Join(absDir, dbFileName)); err == nil {
+		return true
+	}
+	if configDBPath == "" {
+		return false
+	}
+
+	dbPath := configDBPath
+	if resolved, err := filepath.EvalSymlinks(dbPath); err == nil {
+		dbPath = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(absDir); err == nil {
+		absDir = resolved
+	}
+	rel, err := filepath.Rel(absDir, dbPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
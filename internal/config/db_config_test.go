@@ -0,0 +1,29 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// 退出时主程序和托盘可能都会关闭数据库，第二次关闭不能返回错误或panic
+func TestCloseConfigDBTwice(t *testing.T) {
+	if err := InitConfigDB(filepath.Join(t.TempDir(), "config.db")); err != nil {
+		t.Fatalf("InitConfigDB 失败: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := CloseConfigDB(); err != nil {
+			t.Fatalf("第%d次CloseConfigDB返回错误: %v", i+1, err)
+		}
+	}
+
+	// 重新打开后可以再次关闭
+	if err := InitConfigDB(filepath.Join(t.TempDir(), "config.db")); err != nil {
+		t.Fatalf("InitConfigDB 失败: %v", err)
+	}
+	if err := CloseConfigDB(); err != nil {
+		t.Fatalf("重新打开后CloseConfigDB返回错误: %v", err)
+	}
+	if err := CloseConfigDB(); err != nil {
+		t.Fatalf("重新打开后第二次CloseConfigDB返回错误: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+/**
+  @author: Hanhai
+  @desc: 密钥分组用量统计，按请求时密钥所属的分组汇总每日请求、令牌和余额消耗，分组调整后只影响之后的统计
+**/
+
+package config
+
+import (
+	"sort"
+
+	"flowsilicon/internal/logger"
+)
+
+// 分组用量保留的天数，与每日统计保持一致
+const groupUsageRetentionDays = 30
+
+// GroupUsage 密钥分组每日用量统计
+type GroupUsage struct {
+	Requests int     `json:"requests"`
+	Tokens   int     `json:"tokens"`
+	Cost     float64 `json:"cost"` // 按余额快照下降值估算的消耗
+}
+
+// GroupUsageEntry 带日期和分组名称的用量统计
+type GroupUsageEntry struct {
+	Date  string `json:"date"`
+	Group string `json:"group"`
+	GroupUsage
+}
+
+// getApiKeyGroup 获取密钥当前所属的分组，未找到密钥时返回默认分组
+func getApiKeyGroup(match func(ApiKey) bool) string {
+	keysMutex.RLock()
+	defer keysMutex.RUnlock()
+
+	for _, k := range apiKeys {
+		if match(k) {
+			return GetKeyGroupName(k)
+		}
+	}
+	return DefaultKeyGroup
+}
+
+// addDailyGroupUsageLocked 累加分组当天的用量（已加锁）
+func addDailyGroupUsageLocked(group string, requestCount, tokens int, cost float64) {
+	if dailyData.GroupsUsage == nil {
+		dailyData.GroupsUsage = make(map[string]map[string]GroupUsage)
+	}
+
+	today := StatsToday()
+	groups, exists := dailyData.GroupsUsage[today]
+	if !exists {
+		groups = make(map[string]GroupUsage)
+		dailyData.GroupsUsage[today] = groups
+		pruneGroupUsageLocked()
+	}
+
+	usage := groups[group]
+	usage.Requests += requestCount
+	usage.Tokens += tokens
+	usage.Cost += cost
+	groups[group] = usage
+}
+
+// AddDailyGroupCost 将一次余额下降计入密钥当前所属分组当天的消耗
+func AddDailyGroupCost(keyID int, cost float64) {
+	if cost <= 0 {
+		return
+	}
+	group := getApiKeyGroup(func(k ApiKey) bool { return k.ID == keyID })
+
+	dailyDataLock.Lock()
+	defer dailyDataLock.Unlock()
+
+	// 确保dailyData已初始化
+	if dailyData == nil {
+		dailyData = createDefaultDailyData()
+	}
+	addDailyGroupUsageLocked(group, 0, 0, cost)
+
+	// 异步保存数据
+	go func() {
+		if err := saveDailyData(); err != nil {
+			logger.Error("保存每日统计数据失败: %v", err)
+		}
+	}()
+}
+
+// pruneGroupUsageLocked 清理超出保留天数的分组用量（已加锁）
+func pruneGroupUsageLocked() {
+	cutoff := StatsNow().AddDate(0, 0, -groupUsageRetentionDays).Format(StatsDateLayout)
+	for date := range dailyData.GroupsUsage {
+		if date < cutoff {
+			delete(dailyData.GroupsUsage, date)
+		}
+	}
+}
+
+// GetDailyGroupStats 获取指定日期各分组的用量
+func GetDailyGroupStats(date string) map[string]GroupUsage {
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	result := make(map[string]GroupUsage)
+	if dailyData == nil {
+		return result
+	}
+	for group, usage := range dailyData.GroupsUsage[date] {
+		result[group] = usage
+	}
+	return result
+}
+
+// GetGroupUsageHistory 获取所有保留日期的分组用量，按日期和分组名称升序排列
+func GetGroupUsageHistory() []GroupUsageEntry {
+	dailyDataLock.RLock()
+	entries := make([]GroupUsageEntry, 0)
+	if dailyData != nil {
+		for date, groups := range dailyData.GroupsUsage {
+			for group, usage := range groups {
+				entries = append(entries, GroupUsageEntry{Date: date, Group: group, GroupUsage: usage})
+			}
+		}
+	}
+	dailyDataLock.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Date != entries[j].Date {
+			return entries[i].Date < entries[j].Date
+		}
+		return entries[i].Group < entries[j].Group
+	})
+	return entries
+}
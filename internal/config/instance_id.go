@@ -0,0 +1,61 @@
+/**
+  @author: Hanhai
+  @desc: 实例ID，第一次使用时随机生成并保存在配置数据库中，同一个数据目录的实例ID不变，用于区分发送通知的实例
+**/
+
+package config
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"flowsilicon/internal/logger"
+	"sync"
+)
+
+// 配置表中保存实例ID的键
+const instanceIDKey = "instance_id"
+
+var (
+	instanceID     string
+	instanceIDLock sync.Mutex
+)
+
+// GetInstanceID 获取实例ID，数据库不可用时返回本次运行内不变的临时ID
+func GetInstanceID() string {
+	instanceIDLock.Lock()
+	defer instanceIDLock.Unlock()
+	if instanceID != "" {
+		return instanceID
+	}
+
+	if db != nil {
+		var value string
+		err := db.QueryRow("SELECT value FROM "+configTableName+" WHERE key = ?", instanceIDKey).Scan(&value)
+		if err == nil && value != "" {
+			instanceID = value
+			return instanceID
+		}
+		if err != nil && err != sql.ErrNoRows {
+			logger.Error("获取实例ID失败: %v", err)
+		}
+	}
+
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		logger.Error("生成实例ID失败: %v", err)
+		return ""
+	}
+	id := "fs-" + hex.EncodeToString(buf)
+
+	// 只读模式下不保存，下次启动时重新生成
+	if db != nil && CheckWritable() == nil {
+		if _, err := db.Exec("INSERT INTO "+configTableName+" (key, value) VALUES (?, ?) ON CONFLICT(key) DO NOTHING", instanceIDKey, id); err != nil {
+			logger.Error("保存实例ID失败: %v", err)
+		} else if err := db.QueryRow("SELECT value FROM "+configTableName+" WHERE key = ?", instanceIDKey).Scan(&id); err != nil {
+			logger.Error("获取实例ID失败: %v", err)
+		}
+	}
+	instanceID = id
+	return instanceID
+}
@@ -0,0 +1,82 @@
+/**
+  @author: Hanhai
+  @desc: 密钥断路器状态的持久化，保存断开的密钥的断开时间和恢复时间，重启后断开的密钥不会被重新使用
+**/
+
+package config
+
+import (
+	"errors"
+	"flowsilicon/internal/logger"
+)
+
+// 密钥断路器状态表名
+const keyCircuitTableName = "key_circuit_breakers"
+
+// KeyCircuitState 一个断开的密钥的断路器状态
+type KeyCircuitState struct {
+	KeyID          int   // 密钥的数据库记录ID
+	RateLimited    int   // 断开前连续被限流的次数
+	BackoffSeconds int64 // 当前的断开时间（秒），半开探测失败后翻倍
+	OpenUntil      int64 // 断开结束、允许探测请求的时间（Unix秒）
+}
+
+// initKeyCircuitTable 创建密钥断路器状态表
+func initKeyCircuitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS ` + keyCircuitTableName + ` (
+		key_id INTEGER PRIMARY KEY,
+		rate_limited INTEGER NOT NULL,
+		backoff_seconds INTEGER NOT NULL,
+		open_until INTEGER NOT NULL
+	)`
+	if _, err := db.Exec(query); err != nil {
+		logger.Error("创建密钥断路器状态表失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// LoadKeyCircuitStates 获取所有断开的密钥的断路器状态
+func LoadKeyCircuitStates() ([]KeyCircuitState, error) {
+	if db == nil {
+		return nil, errors.New("数据库连接未初始化")
+	}
+	rows, err := db.Query("SELECT key_id, rate_limited, backoff_seconds, open_until FROM " + keyCircuitTableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []KeyCircuitState
+	for rows.Next() {
+		var state KeyCircuitState
+		if err := rows.Scan(&state.KeyID, &state.RateLimited, &state.BackoffSeconds, &state.OpenUntil); err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
+
+// SaveKeyCircuitState 保存一个密钥的断路器状态，已有记录时覆盖
+func SaveKeyCircuitState(state KeyCircuitState) error {
+	if state.KeyID <= 0 || !dbWritable() {
+		return nil
+	}
+	_, err := ExecWithRetry(
+		"保存密钥断路器状态",
+		3,
+		"INSERT OR REPLACE INTO "+keyCircuitTableName+" (key_id, rate_limited, backoff_seconds, open_until) VALUES (?, ?, ?, ?)",
+		state.KeyID, state.RateLimited, state.BackoffSeconds, state.OpenUntil,
+	)
+	return err
+}
+
+// DeleteKeyCircuitState 删除一个密钥的断路器状态，断路器闭合后调用
+func DeleteKeyCircuitState(keyID int) error {
+	if keyID <= 0 || !dbWritable() {
+		return nil
+	}
+	_, err := ExecWithRetry("删除密钥断路器状态", 3, "DELETE FROM "+keyCircuitTableName+" WHERE key_id = ?", keyID)
+	return err
+}
@@ -0,0 +1,164 @@
+/**
+  @author: Hanhai
+  @desc: API密钥数量统计，直接在数据库中按条件计数，避免遍历整个密钥池
+**/
+
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"strings"
+)
+
+// 密钥状态过滤值
+const (
+	KeyStatusActive   = "active"   // 未禁用且余额不低于最低阈值，与GetActiveApiKeys一致
+	KeyStatusEnabled  = "enabled"  // 未禁用
+	KeyStatusDisabled = "disabled" // 已禁用
+	KeyStatusDeleted  = "deleted"  // 已标记为删除
+)
+
+// KeyFilter 密钥计数和分页查询的过滤条件，零值字段表示不过滤
+type KeyFilter struct {
+	Status     string  // 密钥状态，见KeyStatus常量，为空时统计所有未删除的密钥
+	Provider   string  // 密钥提供商
+	Tag        string  // 密钥标签
+	MinBalance float64 // 最低余额
+}
+
+// GetKeyCount 统计满足过滤条件的API密钥数量
+// 数据库不可用时退回到内存中的密钥列表统计
+func GetKeyCount(filter KeyFilter) int {
+	if db == nil {
+		return countApiKeysInMemory(filter)
+	}
+
+	where, args, ok := keyFilterWhere(filter)
+	if !ok {
+		return 0
+	}
+
+	query := "SELECT COUNT(*) FROM " + apikeysTableName + " WHERE " + where
+
+	var count int
+	if err := db.QueryRow(query, args...).Scan(&count); err != nil {
+		logger.Error("统计API密钥数量失败: %v", err)
+		return countApiKeysInMemory(filter)
+	}
+
+	return count
+}
+
+// keyFilterWhere 根据过滤条件生成apikeys表的WHERE子句和参数
+// 过滤条件所需的字段在旧版本数据库中不存在时ok为false，表示没有满足条件的密钥
+func keyFilterWhere(filter KeyFilter) (string, []interface{}, bool) {
+	config := GetConfig()
+	where := make([]string, 0, 4)
+	args := make([]interface{}, 0, 4)
+
+	switch filter.Status {
+	case KeyStatusActive:
+		threshold := 0.0
+		if config != nil {
+			threshold = config.App.MinBalanceThreshold
+		}
+		where = append(where, "is_delete = 0", "disabled = 0", "(balance >= ? OR balance_mode = ?)")
+		args = append(args, threshold, BalanceModeUntracked)
+	case KeyStatusEnabled:
+		where = append(where, "is_delete = 0", "disabled = 0")
+	case KeyStatusDisabled:
+		where = append(where, "is_delete = 0", "disabled = 1")
+	case KeyStatusDeleted:
+		where = append(where, "is_delete = 1")
+	default:
+		where = append(where, "is_delete = 0")
+	}
+
+	if filter.Provider != "" {
+		if !apikeysColumnExists("provider") {
+			return "", nil, false
+		}
+		where = append(where, "provider = ?")
+		args = append(args, filter.Provider)
+	}
+
+	if filter.Tag != "" {
+		if !apikeysColumnExists("tags") {
+			return "", nil, false
+		}
+		// 标签以逗号分隔存储
+		where = append(where, "(',' || tags || ',') LIKE ?")
+		args = append(args, "%,"+filter.Tag+",%")
+	}
+
+	if filter.MinBalance > 0 {
+		where = append(where, "balance >= ?")
+		args = append(args, filter.MinBalance)
+	}
+
+	return strings.Join(where, " AND "), args, true
+}
+
+// countApiKeysInMemory 在内存中的密钥列表上统计满足条件的密钥数量
+// 内存中的密钥没有提供商和标签信息，设置了这两个条件时返回0
+func countApiKeysInMemory(filter KeyFilter) int {
+	config := GetConfig()
+	if filter.Provider != "" || filter.Tag != "" {
+		return 0
+	}
+
+	keysMutex.RLock()
+	defer keysMutex.RUnlock()
+
+	count := 0
+	for _, k := range apiKeys {
+		if matchKeyFilter(k, filter, config) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// matchKeyFilter 检查内存中的密钥是否满足状态和最低余额条件
+func matchKeyFilter(k ApiKey, filter KeyFilter, config *Config) bool {
+	switch filter.Status {
+	case KeyStatusActive:
+		threshold := 0.0
+		if config != nil {
+			threshold = config.App.MinBalanceThreshold
+		}
+		if k.Delete || k.Disabled || !k.HasSufficientBalance(threshold) {
+			return false
+		}
+	case KeyStatusEnabled:
+		if k.Delete || k.Disabled {
+			return false
+		}
+	case KeyStatusDisabled:
+		if k.Delete || !k.Disabled {
+			return false
+		}
+	case KeyStatusDeleted:
+		if !k.Delete {
+			return false
+		}
+	default:
+		if k.Delete {
+			return false
+		}
+	}
+
+	return filter.MinBalance <= 0 || k.Balance >= filter.MinBalance
+}
+
+// apikeysColumnExists 检查apikeys表中是否存在指定字段
+func apikeysColumnExists(column string) bool {
+	var exists int
+	err := db.QueryRow("SELECT count(*) FROM pragma_table_info('"+apikeysTableName+"') WHERE name=?", column).Scan(&exists)
+	if err != nil {
+		logger.Error("检查%s字段存在失败: %v", column, err)
+		return false
+	}
+	return exists > 0
+}
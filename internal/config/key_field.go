@@ -0,0 +1,160 @@
+/**
+  @author: Hanhai
+  @desc: API密钥单字段更新，按白名单只更新指定字段，避免保存整个密钥
+**/
+
+package config
+
+import (
+	"fmt"
+	"math"
+)
+
+// keyFieldSetter 校验字段值并更新内存中的密钥，返回写入数据库的值
+type keyFieldSetter func(key *ApiKey, value interface{}) (interface{}, error)
+
+// updatableKeyFields 允许通过UpdateKeyField更新的字段，键为数据库字段名
+// 新功能需要单独更新某个字段时在这里添加
+var updatableKeyFields = map[string]keyFieldSetter{
+	"balance": func(key *ApiKey, value interface{}) (interface{}, error) {
+		balance, ok := toFloat64(value)
+		if !ok {
+			return nil, fmt.Errorf("余额必须是数字")
+		}
+		key.Balance = balance
+		return balance, nil
+	},
+	"consecutive_failures": func(key *ApiKey, value interface{}) (interface{}, error) {
+		failures, ok := toInt64(value)
+		if !ok || failures < 0 {
+			return nil, fmt.Errorf("连续失败次数必须是非负整数")
+		}
+		key.ConsecutiveFailures = int(failures)
+		return key.ConsecutiveFailures, nil
+	},
+	"disabled": func(key *ApiKey, value interface{}) (interface{}, error) {
+		disabled, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("禁用状态必须是布尔值")
+		}
+		key.Disabled = disabled
+		return disabled, nil
+	},
+	"disabled_at": func(key *ApiKey, value interface{}) (interface{}, error) {
+		disabledAt, ok := toInt64(value)
+		if !ok {
+			return nil, fmt.Errorf("禁用时间必须是Unix时间戳")
+		}
+		key.DisabledAt = disabledAt
+		return disabledAt, nil
+	},
+	"last_tested": func(key *ApiKey, value interface{}) (interface{}, error) {
+		lastTested, ok := toInt64(value)
+		if !ok {
+			return nil, fmt.Errorf("最后测试时间必须是Unix时间戳")
+		}
+		key.LastTested = lastTested
+		return lastTested, nil
+	},
+	"cost_per_request": func(key *ApiKey, value interface{}) (interface{}, error) {
+		cost, ok := toFloat64(value)
+		if !ok || cost < 0 {
+			return nil, fmt.Errorf("每次请求的预估费用必须是非负数")
+		}
+		key.CostPerRequest = cost
+		return cost, nil
+	},
+}
+
+// UpdateKeyField 更新指定ID的API密钥的单个字段，同时更新内存和数据库
+// field为数据库字段名，只允许更新白名单中的字段
+func UpdateKeyField(keyID int, field string, value interface{}) error {
+	setter, ok := updatableKeyFields[field]
+	if !ok {
+		return fmt.Errorf("不允许更新的字段: %s", field)
+	}
+	if err := CheckWritable(); err != nil {
+		return err
+	}
+
+	keysMutex.Lock()
+	index := -1
+	for i, k := range apiKeys {
+		if k.ID == keyID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		keysMutex.Unlock()
+		return fmt.Errorf("API密钥未找到: %d", keyID)
+	}
+
+	// 先在副本上校验和更新，数据库写入成功后再更新内存
+	updated := apiKeys[index]
+	dbValue, err := setter(&updated, value)
+	if err != nil {
+		keysMutex.Unlock()
+		return fmt.Errorf("更新字段%s失败: %w", field, err)
+	}
+	keysMutex.Unlock()
+
+	if db != nil {
+		_, err = ExecWithRetry(
+			"更新API密钥字段"+field,
+			3,
+			"UPDATE "+apikeysTableName+" SET "+field+" = ? WHERE id = ?",
+			dbValue,
+			keyID,
+		)
+		if err != nil {
+			return fmt.Errorf("保存字段%s到数据库失败: %w", field, err)
+		}
+	}
+
+	// 重新查找密钥，避免写数据库期间密钥列表被替换
+	keysMutex.Lock()
+	for i := range apiKeys {
+		if apiKeys[i].ID == keyID {
+			_, _ = setter(&apiKeys[i], value)
+			break
+		}
+	}
+	keysMutex.Unlock()
+
+	notifyApiKeyChanges()
+	return nil
+}
+
+// toFloat64 将数字类型的值转换为float64
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// toInt64 将整数或不带小数部分的浮点数转换为int64
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		if v != math.Trunc(v) || math.IsInf(v, 0) {
+			return 0, false
+		}
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
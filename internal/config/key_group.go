@@ -0,0 +1,83 @@
+/**
+  @author: Hanhai
+  @desc: 密钥分组配置，提供分组权重定义和密钥分组的设置功能
+**/
+
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"strings"
+)
+
+// DefaultKeyGroup 未设置分组的密钥所属的默认分组
+const DefaultKeyGroup = "default"
+
+// KeyGroupConfig 密钥分组流量权重配置
+type KeyGroupConfig struct {
+	Name         string         `mapstructure:"name"`          // 分组名称
+	Weight       int            `mapstructure:"weight"`        // 流量权重，0表示仅在其他分组不可用时作为备用
+	ModelWeights map[string]int `mapstructure:"model_weights"` // 按模型覆盖的流量权重
+}
+
+// GetKeyGroupName 获取密钥所属的分组名称，未设置时返回默认分组
+func GetKeyGroupName(key ApiKey) string {
+	group := strings.TrimSpace(key.Group)
+	if group == "" {
+		return DefaultKeyGroup
+	}
+	return group
+}
+
+// GetKeyGroupConfigs 获取当前配置的密钥分组列表副本
+func GetKeyGroupConfigs() []KeyGroupConfig {
+	config := GetConfig()
+	if config == nil || len(config.App.KeyGroups) == 0 {
+		return nil
+	}
+
+	groups := make([]KeyGroupConfig, len(config.App.KeyGroups))
+	copy(groups, config.App.KeyGroups)
+	return groups
+}
+
+// SetApiKeyGroup 设置API密钥所属的分组
+func SetApiKeyGroup(key string, group string) bool {
+	group = strings.TrimSpace(group)
+	if group == DefaultKeyGroup {
+		group = ""
+	}
+
+	keysMutex.Lock()
+	found := false
+	for i, k := range apiKeys {
+		if k.Key == key {
+			apiKeys[i].Group = group
+			found = true
+			break
+		}
+	}
+	keysMutex.Unlock()
+
+	if !found {
+		return false
+	}
+
+	// 保存更新到数据库
+	if dbWritable() {
+		_, err := ExecWithRetry(
+			"更新API密钥分组",
+			3,
+			"UPDATE "+apikeysTableName+" SET key_group = ? WHERE key = ?",
+			group,
+			key,
+		)
+		if err != nil {
+			logger.Error("更新API密钥分组到数据库失败: %v", err)
+		}
+	}
+
+	logger.Info("API密钥 %s 的分组已设置为: %s", MaskKey(key), GetKeyGroupName(ApiKey{Group: group}))
+	notifyApiKeyChanges()
+	return true
+}
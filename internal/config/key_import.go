@@ -0,0 +1,155 @@
+/**
+  @author: Hanhai
+  @desc: 批量导入API密钥，检查密钥格式，跳过已存在的密钥，导入的密钥保留备注名、标签、分组和启用状态；恢复备份时可以整体替换现有的密钥
+**/
+
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"flowsilicon/internal/logger"
+)
+
+// 密钥的长度范围
+const (
+	minApiKeyLength = 8
+	maxApiKeyLength = 256
+)
+
+// ValidateApiKeyFormat 检查密钥的格式，密钥需要先转换为规范形式，只允许不含空白、引号和逗号的可见ASCII字符
+func ValidateApiKeyFormat(key string) error {
+	if len(key) < minApiKeyLength || len(key) > maxApiKeyLength {
+		return fmt.Errorf("密钥长度需要在 %d 到 %d 个字符之间", minApiKeyLength, maxApiKeyLength)
+	}
+	for _, c := range key {
+		if c <= ' ' || c > '~' || c == '"' || c == '\'' || c == ',' {
+			return fmt.Errorf("密钥包含无效的字符 %q", c)
+		}
+	}
+	return nil
+}
+
+// ImportApiKeys 批量添加密钥，已存在且未删除的密钥跳过，被删除的密钥按导入的内容恢复
+// 导入的密钥只保留密钥、备注名、余额、启用状态、标签、分组、余额模式、服务商和添加时间，调用统计从零开始
+// 返回添加的密钥和跳过的已存在密钥数
+func ImportApiKeys(keys []ApiKey) ([]ApiKey, int) {
+	cfg := GetConfig()
+	minThreshold := 0.0
+	if cfg != nil {
+		minThreshold = cfg.App.MinBalanceThreshold
+	}
+	now := time.Now().Unix()
+
+	keysMutex.Lock()
+	index := make(map[string]int, len(apiKeys))
+	for i, k := range apiKeys {
+		index[CanonicalApiKey(k.Key)] = i
+	}
+
+	var added []ApiKey
+	duplicates := 0
+	for _, imported := range keys {
+		newKey := ApiKey{
+			Key:            CanonicalApiKey(imported.Key),
+			Alias:          imported.Alias,
+			Balance:        imported.Balance,
+			Disabled:       imported.Disabled,
+			Tags:           imported.Tags,
+			Group:          imported.Group,
+			BalanceMode:    imported.BalanceMode,
+			CostPerRequest: imported.CostPerRequest,
+			Provider:       imported.Provider,
+			AddedAt:        imported.AddedAt,
+		}
+		// 导出的文件中带有添加时间时保留，否则为导入的时间
+		if newKey.AddedAt <= 0 {
+			newKey.AddedAt = now
+		}
+		// 余额不足的密钥与单个添加时一样以禁用状态导入
+		if !newKey.HasSufficientBalance(minThreshold) {
+			newKey.Disabled = true
+		}
+		if newKey.Disabled {
+			newKey.DisabledAt = now
+		}
+
+		i, exists := index[newKey.Key]
+		if exists && !apiKeys[i].Delete {
+			duplicates++
+			continue
+		}
+		if exists {
+			newKey.ID = apiKeys[i].ID
+			apiKeys[i] = newKey
+		} else {
+			// 数据库中已有但未加载的密钥沿用原来的记录ID
+			if dbWritable() {
+				if id, err := getApiKeyIDFromDB(newKey.Key); err == nil {
+					newKey.ID = id
+				}
+			}
+			apiKeys = append(apiKeys, newKey)
+			i = len(apiKeys) - 1
+			index[newKey.Key] = i
+		}
+
+		if dbWritable() {
+			if err := AddApiKeyToDB(newKey); err != nil {
+				logger.Error("导入API密钥到数据库失败: %v", err)
+			} else if newKey.ID == 0 {
+				// 记录数据库分配的ID
+				if id, err := getApiKeyIDFromDB(newKey.Key); err == nil {
+					apiKeys[i].ID = id
+				}
+			}
+		}
+		added = append(added, apiKeys[i])
+	}
+	keysMutex.Unlock()
+
+	if len(added) > 0 {
+		notifyApiKeyChanges()
+	}
+	logger.Info("已导入 %d 个API密钥，跳过 %d 个已存在的密钥", len(added), duplicates)
+	return added, duplicates
+}
+
+// ReplaceAllApiKeys 用导入的密钥整体替换现有的密钥，导入的密钥保留调用统计，与现有密钥相同的沿用原来的记录ID
+// 替换后保存到数据库并重新加载，使新增的密钥获得数据库分配的ID
+func ReplaceAllApiKeys(keys []ApiKey) error {
+	keysMutex.RLock()
+	existingIDs := make(map[string]int, len(apiKeys))
+	for _, k := range apiKeys {
+		existingIDs[CanonicalApiKey(k.Key)] = k.ID
+	}
+	keysMutex.RUnlock()
+
+	replaced := make([]ApiKey, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		k.Key = CanonicalApiKey(k.Key)
+		if seen[k.Key] {
+			continue
+		}
+		seen[k.Key] = true
+		k.ID = existingIDs[k.Key]
+		k.Delete = false
+		k.RecentRequests = nil
+		replaced = append(replaced, k)
+	}
+
+	ReplaceApiKeys(replaced)
+	if !dbWritable() {
+		return nil
+	}
+	if err := SaveApiKeysToDB(); err != nil {
+		return fmt.Errorf("保存导入的API密钥失败: %w", err)
+	}
+	if err := LoadApiKeysFromDB(); err != nil {
+		return fmt.Errorf("重新加载API密钥失败: %w", err)
+	}
+	logger.Info("已用导入的 %d 个API密钥替换现有的密钥", len(replaced))
+	return nil
+}
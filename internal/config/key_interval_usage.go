@@ -0,0 +1,38 @@
+/**
+  @author: Hanhai
+  @desc: 密钥按周期的请求数和令牌数，密钥管理器每个周期读取并清零，用于计算平滑后的RPM/TPM
+**/
+
+package config
+
+import "sync"
+
+// KeyIntervalUsage 密钥在一个周期内的用量
+type KeyIntervalUsage struct {
+	Requests int
+	Tokens   int
+}
+
+var (
+	keyIntervalUsage     = make(map[string]KeyIntervalUsage)
+	keyIntervalUsageLock sync.Mutex
+)
+
+// addKeyIntervalUsage 累加密钥当前周期的请求数和令牌数
+func addKeyIntervalUsage(key string, requestCount, tokenCount int) {
+	keyIntervalUsageLock.Lock()
+	usage := keyIntervalUsage[key]
+	usage.Requests += requestCount
+	usage.Tokens += tokenCount
+	keyIntervalUsage[key] = usage
+	keyIntervalUsageLock.Unlock()
+}
+
+// TakeKeyIntervalUsage 获取各密钥自上次调用以来的用量并清零，只应由密钥管理器的定时任务调用
+func TakeKeyIntervalUsage() map[string]KeyIntervalUsage {
+	keyIntervalUsageLock.Lock()
+	defer keyIntervalUsageLock.Unlock()
+	usage := keyIntervalUsage
+	keyIntervalUsage = make(map[string]KeyIntervalUsage, len(usage))
+	return usage
+}
@@ -0,0 +1,79 @@
+/**
+  @author: Hanhai
+  @desc: 密钥调用结果统计，区分成功、密钥原因的失败和客户端原因的错误，客户端错误不计入成功率
+**/
+
+package config
+
+import (
+	"strings"
+	"time"
+
+	"flowsilicon/internal/logger"
+)
+
+// KeyFailures 获取密钥原因导致的失败次数
+func (k ApiKey) KeyFailures() int {
+	failures := k.TotalCalls - k.SuccessCalls - k.ClientErrors
+	if failures < 0 {
+		return 0
+	}
+	return failures
+}
+
+// recomputeSuccessRateLocked 按成功次数和密钥原因的失败次数重新计算成功率
+// 只有客户端错误、没有可计入的调用时保持原有成功率
+func recomputeSuccessRateLocked(k *ApiKey) {
+	healthCalls := k.SuccessCalls + k.KeyFailures()
+	if healthCalls > 0 {
+		k.SuccessRate = float64(k.SuccessCalls) / float64(healthCalls)
+	}
+}
+
+// UpdateApiKeyClientError 记录一次客户端原因导致的错误
+// 计入总调用次数，但不计入成功率和连续失败次数
+func UpdateApiKeyClientError(key string) bool {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+
+	for i, k := range apiKeys {
+		if k.Key != key {
+			continue
+		}
+
+		apiKeys[i].TotalCalls++
+		apiKeys[i].ClientErrors++
+		recomputeSuccessRateLocked(&apiKeys[i])
+
+		// 保存更新到数据库
+		if dbWritable() {
+			var err error
+			for retries := 0; retries < 3; retries++ {
+				_, err = db.Exec(`UPDATE `+apikeysTableName+`
+					SET total_calls = ?, client_errors = ?, success_rate = ?
+					WHERE key = ?`,
+					apiKeys[i].TotalCalls, apiKeys[i].ClientErrors, apiKeys[i].SuccessRate, key)
+				if err == nil {
+					break
+				}
+
+				// 如果是数据库锁定错误，等待一段时间后重试
+				if strings.Contains(err.Error(), "database is locked") ||
+					strings.Contains(err.Error(), "SQLITE_BUSY") {
+					logger.Warn("更新API密钥客户端错误统计遇到数据库锁定，等待重试 (尝试 %d/3): %v", retries+1, err)
+					time.Sleep(time.Duration(100*(retries+1)) * time.Millisecond)
+					continue
+				}
+				break
+			}
+
+			if err != nil {
+				logger.Error("更新API密钥客户端错误统计到数据库失败: %v", err)
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,41 @@
+package config
+
+import "testing"
+
+// 数据库中保存的成功率按计数重新计算，旧版本把客户端错误计入失败的成功率不会保留
+func TestLoadApiKeysRecomputesSuccessRate(t *testing.T) {
+	setupApikeysDB(t)
+
+	if _, err := db.Exec("INSERT INTO " + apikeysTableName + ` (key, balance, last_used, total_calls, success_calls, success_rate,
+		consecutive_failures, disabled, disabled_at, last_tested, rpm, tpm, score, is_delete, client_errors)
+		VALUES ('sk-history-key', 1, 0, 20, 8, 0.4, 0, 0, 0, 0, 0, 0, 0, 0, 10)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadApiKeysFromDB(); err != nil {
+		t.Fatalf("LoadApiKeysFromDB 失败: %v", err)
+	}
+
+	keys := currentApiKeys(t)
+	if len(keys) != 1 {
+		t.Fatalf("len(keys) = %d, want 1", len(keys))
+	}
+	if got := keys[0].SuccessRate; got != 0.8 {
+		t.Errorf("SuccessRate = %v, want 0.8", got)
+	}
+	if got := keys[0].KeyFailures(); got != 2 {
+		t.Errorf("KeyFailures() = %d, want 2", got)
+	}
+
+	// 客户端错误写入数据库后重新加载，成功率不变
+	if !UpdateApiKeyClientError("sk-history-key") {
+		t.Fatal("UpdateApiKeyClientError returned false")
+	}
+	if err := LoadApiKeysFromDB(); err != nil {
+		t.Fatalf("LoadApiKeysFromDB 失败: %v", err)
+	}
+	keys = currentApiKeys(t)
+	if keys[0].TotalCalls != 21 || keys[0].ClientErrors != 11 || keys[0].SuccessRate != 0.8 {
+		t.Errorf("after a client error: total %d, client %d, rate %v; want 21, 11, 0.8",
+			keys[0].TotalCalls, keys[0].ClientErrors, keys[0].SuccessRate)
+	}
+}
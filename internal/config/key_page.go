@@ -0,0 +1,166 @@
+/**
+  @author: Hanhai
+  @desc: API密钥分页查询，直接在数据库中按条件分页读取，避免大量密钥时为列表页复制整个密钥池
+**/
+
+package config
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// KeyInfo 数据库中保存的密钥信息，不包括RPM、TPM等只在内存中维护的运行时数据
+// 调用统计和得分以最近一次保存到数据库的值为准
+type KeyInfo struct {
+	ID                  int      `json:"id"`
+	Key                 string   `json:"key"`
+	Balance             float64  `json:"balance"`
+	LastUsed            int64    `json:"last_used"`
+	TotalCalls          int      `json:"total_calls"`
+	SuccessCalls        int      `json:"success_calls"`
+	SuccessRate         float64  `json:"success_rate"`
+	ClientErrors        int      `json:"client_errors"`
+	ConsecutiveFailures int      `json:"consecutive_failures"`
+	Disabled            bool     `json:"disabled"`
+	DisabledAt          int64    `json:"disabled_at"`
+	LastTested          int64    `json:"last_tested"`
+	Score               float64  `json:"score"`
+	Delete              bool     `json:"delete"`
+	IsUsed              bool     `json:"is_used"`
+	Group               string   `json:"group"`
+	BalanceMode         string   `json:"balance_mode"`
+	CostPerRequest      float64  `json:"cost_per_request"`
+	Provider            string   `json:"provider"`
+	Tags                []string `json:"tags"`
+	Alias               string   `json:"alias"`
+	AddedAt             int64    `json:"added_at"`
+}
+
+// newKeyInfo 从内存中的密钥生成密钥信息
+func newKeyInfo(k ApiKey) KeyInfo {
+	return KeyInfo{
+		ID:                  k.ID,
+		Key:                 k.Key,
+		Balance:             k.Balance,
+		LastUsed:            k.LastUsed,
+		TotalCalls:          k.TotalCalls,
+		SuccessCalls:        k.SuccessCalls,
+		SuccessRate:         k.SuccessRate,
+		ClientErrors:        k.ClientErrors,
+		ConsecutiveFailures: k.ConsecutiveFailures,
+		Disabled:            k.Disabled,
+		DisabledAt:          k.DisabledAt,
+		LastTested:          k.LastTested,
+		Score:               k.Score,
+		Delete:              k.Delete,
+		IsUsed:              k.IsUsed,
+		Group:               k.Group,
+		BalanceMode:         k.BalanceMode,
+		CostPerRequest:      k.CostPerRequest,
+		Provider:            k.Provider,
+		Tags:                k.Tags,
+		Alias:               k.Alias,
+		AddedAt:             k.AddedAt,
+	}
+}
+
+// GetApiKeysPage 分页获取满足过滤条件的API密钥，按得分降序排列，同时返回满足条件的密钥总数
+// 数据库不可用时退回到内存中的密钥列表分页
+func GetApiKeysPage(offset, limit int, filter KeyFilter) ([]KeyInfo, int, error) {
+	if offset < 0 || limit <= 0 {
+		return nil, 0, fmt.Errorf("无效的分页参数: offset=%d, limit=%d", offset, limit)
+	}
+	if db == nil {
+		items, total := getApiKeysPageInMemory(offset, limit, filter)
+		return items, total, nil
+	}
+
+	where, args, ok := keyFilterWhere(filter)
+	if !ok {
+		return []KeyInfo{}, 0, nil
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM "+apikeysTableName+" WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("统计API密钥数量失败: %w", err)
+	}
+
+	rows, err := db.Query(`SELECT
+		id, key, balance, last_used, total_calls, success_calls, success_rate, client_errors,
+		consecutive_failures, disabled, disabled_at, last_tested, score, is_delete, is_used, key_group, balance_mode, cost_per_request, provider, tags, alias, added_at
+		FROM `+apikeysTableName+` WHERE `+where+` ORDER BY score DESC, id ASC LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("分页查询API密钥失败: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]KeyInfo, 0, limit)
+	for rows.Next() {
+		var info KeyInfo
+		// 旧版本迁移添加的provider字段允许为NULL
+		var provider sql.NullString
+		var tags string
+		if err := rows.Scan(
+			&info.ID,
+			&info.Key,
+			&info.Balance,
+			&info.LastUsed,
+			&info.TotalCalls,
+			&info.SuccessCalls,
+			&info.SuccessRate,
+			&info.ClientErrors,
+			&info.ConsecutiveFailures,
+			&info.Disabled,
+			&info.DisabledAt,
+			&info.LastTested,
+			&info.Score,
+			&info.Delete,
+			&info.IsUsed,
+			&info.Group,
+			&info.BalanceMode,
+			&info.CostPerRequest,
+			&provider,
+			&tags,
+			&info.Alias,
+			&info.AddedAt,
+		); err != nil {
+			return nil, 0, fmt.Errorf("扫描API密钥数据失败: %w", err)
+		}
+		info.Provider = provider.String
+		info.Tags = ParseKeyTags(tags)
+		items = append(items, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("处理API密钥数据时发生错误: %w", err)
+	}
+
+	return items, total, nil
+}
+
+// getApiKeysPageInMemory 在内存中的密钥列表上分页，顺序与密钥池一致
+// 与countApiKeysInMemory相同，设置了提供商或标签条件时不返回密钥
+func getApiKeysPageInMemory(offset, limit int, filter KeyFilter) ([]KeyInfo, int) {
+	items := make([]KeyInfo, 0)
+	if filter.Provider != "" || filter.Tag != "" {
+		return items, 0
+	}
+	config := GetConfig()
+
+	keysMutex.RLock()
+	defer keysMutex.RUnlock()
+
+	total := 0
+	for _, k := range apiKeys {
+		if !matchKeyFilter(k, filter, config) {
+			continue
+		}
+		if total >= offset && len(items) < limit {
+			items = append(items, newKeyInfo(k))
+		}
+		total++
+	}
+
+	return items, total
+}
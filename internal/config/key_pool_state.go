@@ -0,0 +1,50 @@
+/**
+  @author: Hanhai
+  @desc: 密钥池的修改代数，每次修改密钥池后加1，key包据此判断一致性快照是否需要重建
+**/
+
+package config
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// 密钥池的修改代数，只在持有写锁时增加
+var keyPoolGeneration atomic.Uint64
+
+// keyPoolMutex 保护密钥池的读写锁，释放写锁前增加修改代数
+// 所有修改密钥池的地方都持有写锁，不需要在每个修改点单独记录
+type keyPoolMutex struct {
+	sync.RWMutex
+}
+
+// Unlock 增加修改代数后释放写锁，之后获得读锁的调用方都能读到新的代数
+func (m *keyPoolMutex) Unlock() {
+	keyPoolGeneration.Add(1)
+	m.RWMutex.Unlock()
+}
+
+// GetKeyPoolGeneration 获取密钥池当前的修改代数
+func GetKeyPoolGeneration() uint64 {
+	return keyPoolGeneration.Load()
+}
+
+// GetKeyPoolState 在同一个读锁内获取未删除的所有密钥的副本和对应的修改代数
+// 尚未加载密钥池时返回ErrKeysNotInitialised，代数仍然返回，加载后代数变化会触发快照重建
+func GetKeyPoolState() ([]ApiKey, uint64, error) {
+	keysMutex.RLock()
+	defer keysMutex.RUnlock()
+
+	if !apiKeysLoaded {
+		return nil, keyPoolGeneration.Load(), ErrKeysNotInitialised
+	}
+
+	keys := make([]ApiKey, 0, len(apiKeys))
+	for _, key := range apiKeys {
+		if !key.Delete {
+			keys = append(keys, key)
+		}
+	}
+	return keys, keyPoolGeneration.Load(), nil
+}
@@ -0,0 +1,17 @@
+/**
+  @author: Hanhai
+  @desc: API密钥所属的服务商，旧版本数据库中的密钥没有记录服务商，默认为OpenAI兼容接口
+**/
+
+package config
+
+// DefaultKeyProvider 未设置服务商的密钥使用的默认服务商
+const DefaultKeyProvider = "openai"
+
+// GetProvider 获取密钥所属的服务商，未设置时返回默认服务商
+func (k ApiKey) GetProvider() string {
+	if k.Provider == "" {
+		return DefaultKeyProvider
+	}
+	return k.Provider
+}
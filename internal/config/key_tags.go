@@ -0,0 +1,120 @@
+/**
+  @author: Hanhai
+  @desc: API密钥标签，数据库中以逗号分隔保存，自动推断的标签以auto:开头，与手动设置的标签分开维护
+**/
+
+package config
+
+import (
+	"sort"
+	"strings"
+
+	"flowsilicon/internal/logger"
+)
+
+// AutoTagPrefix 自动推断的标签的前缀
+const AutoTagPrefix = "auto:"
+
+// ParseKeyTags 解析以逗号分隔的标签，去掉空白和重复的标签
+func ParseKeyTags(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// joinKeyTags 将标签以逗号分隔保存到数据库
+func joinKeyTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+// IsAutoTag 判断标签是否为自动推断的标签
+func IsAutoTag(tag string) bool {
+	return strings.HasPrefix(tag, AutoTagPrefix)
+}
+
+// SetApiKeyAutoTags 用推断的自动标签替换各密钥原有的自动标签，手动设置的标签保持不变
+// autoTags为密钥到自动标签（不带前缀）的映射，不在映射中的密钥清除所有自动标签，返回新增的自动标签数
+func SetApiKeyAutoTags(autoTags map[string][]string) (int, error) {
+	type tagUpdate struct {
+		key  string
+		tags string
+	}
+
+	keysMutex.Lock()
+	added := 0
+	var updates []tagUpdate
+	for i, k := range apiKeys {
+		if k.Delete {
+			continue
+		}
+		old := make(map[string]bool)
+		tags := make([]string, 0, len(k.Tags)+len(autoTags[k.Key]))
+		for _, tag := range k.Tags {
+			if IsAutoTag(tag) {
+				old[tag] = true
+			} else {
+				tags = append(tags, tag)
+			}
+		}
+
+		inferred := make([]string, 0, len(autoTags[k.Key]))
+		for _, tag := range autoTags[k.Key] {
+			inferred = append(inferred, AutoTagPrefix+tag)
+		}
+		sort.Strings(inferred)
+		changed := len(inferred) != len(old)
+		for _, tag := range inferred {
+			if !old[tag] {
+				added++
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		// 替换切片而不是修改原有元素，密钥池快照中的副本共享原来的切片
+		tags = append(tags, inferred...)
+		if len(tags) == 0 {
+			tags = nil
+		}
+		apiKeys[i].Tags = tags
+		updates = append(updates, tagUpdate{key: k.Key, tags: joinKeyTags(tags)})
+	}
+	keysMutex.Unlock()
+
+	if len(updates) == 0 {
+		return added, nil
+	}
+	notifyApiKeyChanges()
+
+	if !dbWritable() {
+		return added, nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return added, err
+	}
+	defer tx.Rollback()
+	for _, update := range updates {
+		if _, err := tx.Exec("UPDATE "+apikeysTableName+" SET tags = ? WHERE key = ?", update.tags, update.key); err != nil {
+			return added, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return added, err
+	}
+	logger.Info("已更新 %d 个API密钥的自动标签", len(updates))
+	return added, nil
+}
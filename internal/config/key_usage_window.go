@@ -0,0 +1,71 @@
+/**
+  @author: Hanhai
+  @desc: 密钥最近24小时的请求数，按小时分桶累计，用于找出承担过多流量的密钥
+**/
+
+package config
+
+import (
+	"sync"
+	"time"
+)
+
+// 24小时窗口的分桶数量，每个桶对应一个小时
+const keyUsageBuckets = 24
+
+// keyUsageWindow 一个密钥按小时分桶的请求数
+type keyUsageWindow struct {
+	counts [keyUsageBuckets]int
+	hours  [keyUsageBuckets]int64 // 每个桶对应的小时（Unix秒/3600），与当前小时不在窗口内的桶视为0
+}
+
+var (
+	// 各密钥最近24小时的请求数，程序重启后清零
+	keyUsageWindows     = make(map[string]*keyUsageWindow)
+	keyUsageWindowsLock sync.Mutex
+)
+
+// addKeyUsage 在密钥当前小时的桶中累加请求数
+func addKeyUsage(key string, requestCount int) {
+	hour := time.Now().Unix() / 3600
+	idx := hour % keyUsageBuckets
+
+	keyUsageWindowsLock.Lock()
+	defer keyUsageWindowsLock.Unlock()
+
+	window, exists := keyUsageWindows[key]
+	if !exists {
+		window = &keyUsageWindow{}
+		keyUsageWindows[key] = window
+	}
+	if window.hours[idx] != hour {
+		window.hours[idx] = hour
+		window.counts[idx] = 0
+	}
+	window.counts[idx] += requestCount
+}
+
+// GetKeyRequestsLast24h 获取各密钥最近24小时的请求数，键为密钥，没有请求的密钥不返回
+func GetKeyRequestsLast24h() map[string]int {
+	hour := time.Now().Unix() / 3600
+
+	keyUsageWindowsLock.Lock()
+	defer keyUsageWindowsLock.Unlock()
+
+	result := make(map[string]int)
+	for key, window := range keyUsageWindows {
+		total := 0
+		for i := 0; i < keyUsageBuckets; i++ {
+			if hour-window.hours[i] < keyUsageBuckets {
+				total += window.counts[i]
+			}
+		}
+		if total > 0 {
+			result[key] = total
+		} else {
+			// 24小时内没有请求的密钥不再保留
+			delete(keyUsageWindows, key)
+		}
+	}
+	return result
+}
@@ -0,0 +1,59 @@
+/**
+  @author: Hanhai
+  @desc: API密钥变更通知，密钥被添加、修改或删除时回调已注册的订阅者
+**/
+
+package config
+
+import (
+	"flowsilicon/internal/logger"
+	"sync"
+)
+
+var (
+	// 已注册的密钥变更回调
+	apiKeyWatchers      []func([]ApiKey)
+	apiKeyWatchersMutex sync.RWMutex
+)
+
+// WatchApiKeyChanges 注册密钥变更回调，密钥被添加、删除、启用/禁用、修改分组或余额模式时调用
+// 回调参数为变更后未删除的密钥列表副本，回调在变更完成且释放密钥锁之后同步执行
+func WatchApiKeyChanges(callback func([]ApiKey)) {
+	if callback == nil {
+		return
+	}
+
+	apiKeyWatchersMutex.Lock()
+	defer apiKeyWatchersMutex.Unlock()
+
+	apiKeyWatchers = append(apiKeyWatchers, callback)
+}
+
+// notifyApiKeyChanges 通知所有订阅者密钥列表已变更
+// 调用时不能持有keysMutex
+func notifyApiKeyChanges() {
+	apiKeyWatchersMutex.RLock()
+	watchers := make([]func([]ApiKey), len(apiKeyWatchers))
+	copy(watchers, apiKeyWatchers)
+	apiKeyWatchersMutex.RUnlock()
+
+	if len(watchers) == 0 {
+		return
+	}
+
+	// 密钥池加载后会再次通知
+	keys, err := GetApiKeys()
+	if err != nil {
+		return
+	}
+	for _, watcher := range watchers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Error("执行密钥变更回调时发生panic: %v", r)
+				}
+			}()
+			watcher(keys)
+		}()
+	}
+}
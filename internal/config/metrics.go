@@ -0,0 +1,12 @@
+/**
+  @author: Hanhai
+  @desc: Prometheus指标接口的配置，默认关闭，避免无意中公开密钥余额
+**/
+
+package config
+
+// MetricsConfig Prometheus指标接口的配置
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"` // 是否开启/metrics，默认关闭
+	Token   string `mapstructure:"token"`   // 抓取时需要在Authorization请求头中携带的Bearer令牌，为空时不检查
+}
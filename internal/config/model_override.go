@@ -0,0 +1,63 @@
+/**
+  @author: Hanhai
+  @desc: 模型级别的请求处理覆盖配置，按模型开启默认不生效的请求改写行为
+**/
+
+package config
+
+import "time"
+
+// ModelOverride 单个模型的请求处理覆盖配置，未配置的模型保持原样透传
+type ModelOverride struct {
+	InjectDefaultMaxTokens bool `mapstructure:"inject_default_max_tokens"` // 请求未设置max_tokens时注入模型的默认输出令牌数
+	ClampMaxTokens         bool `mapstructure:"clamp_max_tokens"`          // 请求的max_tokens超过模型最大输出令牌数时截断
+	// 上下文过长时的消息截断
+	TruncationPolicy string `mapstructure:"truncation_policy"` // 截断策略（drop_oldest, middle_out），为空时不截断
+	ContextWindow    int    `mapstructure:"context_window"`    // 模型的上下文长度（令牌数），大于0时在发送前预估并主动截断
+	// 流式响应超时，大于0时覆盖全局配置
+	FirstByteTimeoutSeconds int `mapstructure:"first_byte_timeout_seconds"` // 等待第一条流式数据的最长时间（秒）
+	IdleTimeoutSeconds      int `mapstructure:"idle_timeout_seconds"`       // 两次流式数据之间的最长等待时间（秒）
+	// 候选结果数
+	MaxChoices int `mapstructure:"max_choices"` // 每个请求的n或best_of的上限，超过时拒绝请求，0表示不限制
+}
+
+// GetModelOverride 获取指定模型的覆盖配置，未配置时返回false
+func GetModelOverride(model string) (ModelOverride, bool) {
+	config := GetConfig()
+	if config == nil || len(config.App.ModelOverrides) == 0 {
+		return ModelOverride{}, false
+	}
+
+	override, ok := config.App.ModelOverrides[model]
+	return override, ok
+}
+
+// DefaultStreamIdleTimeout 未配置时流式响应两次数据之间的最长等待时间
+const DefaultStreamIdleTimeout = 5 * time.Second
+
+// GetStreamTimeouts 获取模型的流式首字节超时和数据间隔超时，模型覆盖配置优先，首字节超时为0表示不限制
+func GetStreamTimeouts(model string) (time.Duration, time.Duration) {
+	config := GetConfig()
+	firstByte := time.Duration(0)
+	idle := DefaultStreamIdleTimeout
+	if config == nil {
+		return firstByte, idle
+	}
+
+	if config.App.StreamFirstByteTimeoutSeconds > 0 {
+		firstByte = time.Duration(config.App.StreamFirstByteTimeoutSeconds) * time.Second
+	}
+	if config.App.StreamIdleTimeoutSeconds > 0 {
+		idle = time.Duration(config.App.StreamIdleTimeoutSeconds) * time.Second
+	}
+
+	if override, ok := GetModelOverride(model); ok {
+		if override.FirstByteTimeoutSeconds > 0 {
+			firstByte = time.Duration(override.FirstByteTimeoutSeconds) * time.Second
+		}
+		if override.IdleTimeoutSeconds > 0 {
+			idle = time.Duration(override.IdleTimeoutSeconds) * time.Second
+		}
+	}
+	return firstByte, idle
+}
@@ -0,0 +1,504 @@
+/**
+  @author: Hanhai
+  @desc: 通知配置和发送队列，发送失败的通知保存在配置数据库中，按通道顺序重试直到成功或超过保留时间
+**/
+
+package config
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flowsilicon/internal/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 通知发送队列表名
+	notificationOutboxTableName = "notification_outbox"
+	// 配置表中保存被丢弃通知数量的键
+	notificationDroppedKey = "notification_dropped"
+	// DefaultNotificationRetryTTLMinutes 未设置时发送失败的通知最多重试的时间（分钟）
+	DefaultNotificationRetryTTLMinutes = 24 * 60
+	// DefaultNotificationOutboxSize 未设置时发送队列最多保存的通知数
+	DefaultNotificationOutboxSize = 500
+)
+
+// 桌面通知的开启方式
+const (
+	DesktopNotificationAuto = "auto" // 只在GUI模式下发送
+	DesktopNotificationOn   = "on"
+	DesktopNotificationOff  = "off"
+)
+
+// 通知的发送状态
+const (
+	NotificationPending   = "pending"   // 等待发送或等待重试
+	NotificationDelivered = "delivered" // 已发送
+	NotificationExpired   = "expired"   // 超过保留时间仍未发送成功
+)
+
+// NotificationConfig 通知配置
+type NotificationConfig struct {
+	Webhooks        []string `mapstructure:"webhooks"`          // 通知发送的webhook地址，每个地址是一个独立的通道，为空时不发送
+	RetryTTLMinutes int      `mapstructure:"retry_ttl_minutes"` // 发送失败的通知最多重试的时间（分钟），0表示使用默认值
+	OutboxSize      int      `mapstructure:"outbox_size"`       // 发送队列最多保存的通知数，超过时丢弃最早的通知，0表示使用默认值
+	Desktop         string   `mapstructure:"desktop"`           // 桌面通知：auto、on、off，为空表示auto，只在GUI模式下发送
+	DisabledEvents  []string `mapstructure:"disabled_events"`   // 不发送的通知事件，对webhook和桌面通知同时生效
+	// webhook地址对应的签名密钥，设置后每次发送都在X-FlowSilicon-Signature请求头中附带签名
+	WebhookSecrets map[string]string `mapstructure:"webhook_secrets"`
+	// 按旧版本的格式发送webhook通知，兼容还没有改为读取事件信封的接收程序，只保留一个版本
+	LegacyPayload bool `mapstructure:"legacy_payload"`
+	// webhook地址对应的消息格式：generic、feishu、dingtalk，未设置时为generic
+	WebhookFormats map[string]string `mapstructure:"webhook_formats"`
+	// 密钥余额低于该值时发送通知，0表示不发送
+	BalanceThreshold float64 `mapstructure:"balance_threshold"`
+	// 所有启用的密钥余额之和低于该值时发送通知，0表示不发送
+	PoolBalanceFloor float64 `mapstructure:"pool_balance_floor"`
+	// 同一个密钥的同一种告警再次发送的最小间隔（小时），0表示使用默认值
+	AlertCooldownHours int `mapstructure:"alert_cooldown_hours"`
+}
+
+// applyLegacyPayloadDefault 保存的配置中没有legacy_payload且已经配置了webhook时按旧版本的格式发送
+// 升级前已有的接收程序只能解析旧版本的格式，需要在设置页面关闭legacy_payload后才改为发送事件信封；新配置的webhook默认发送事件信封
+func applyLegacyPayloadDefault(cfg *Config, configJSON []byte) bool {
+	if cfg == nil || len(cfg.Notification.Webhooks) == 0 {
+		return false
+	}
+	var saved struct {
+		Notification struct {
+			LegacyPayload *bool
+		}
+	}
+	if err := json.Unmarshal(configJSON, &saved); err != nil || saved.Notification.LegacyPayload != nil {
+		return false
+	}
+	cfg.Notification.LegacyPayload = true
+	return true
+}
+
+// webhook的消息格式
+const (
+	WebhookFormatGeneric  = "generic"  // 事件信封
+	WebhookFormatFeishu   = "feishu"   // 飞书自定义机器人的卡片消息
+	WebhookFormatDingTalk = "dingtalk" // 钉钉自定义机器人的Markdown消息
+)
+
+// DefaultAlertCooldownHours 未设置时同一种告警再次发送的最小间隔（小时）
+const DefaultAlertCooldownHours = 24
+
+// 配置表中保存告警上次发送时间的键
+const notificationAlertStateKey = "notification_alert_state"
+
+// NotificationEntry 发送队列中的一条通知
+type NotificationEntry struct {
+	ID            int64  `json:"id"`
+	Channel       string `json:"channel"`
+	Event         string `json:"event"`
+	Payload       string `json:"payload"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	LastError     string `json:"last_error,omitempty"`
+	CreatedAt     int64  `json:"created_at"`
+	NextAttemptAt int64  `json:"next_attempt_at"`
+	ExpiresAt     int64  `json:"expires_at"`
+	UpdatedAt     int64  `json:"updated_at"`
+}
+
+// GetNotificationWebhooks 获取配置的通知webhook地址，忽略空地址
+func GetNotificationWebhooks() []string {
+	config := GetConfig()
+	webhooks := make([]string, 0)
+	if config == nil {
+		return webhooks
+	}
+	for _, webhook := range config.Notification.Webhooks {
+		if webhook = strings.TrimSpace(webhook); webhook != "" {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks
+}
+
+// GetWebhookSecret 获取webhook地址的签名密钥，未设置时返回空字符串
+func GetWebhookSecret(webhook string) string {
+	config := GetConfig()
+	if config == nil {
+		return ""
+	}
+	return strings.TrimSpace(config.Notification.WebhookSecrets[webhook])
+}
+
+// GetWebhookFormat 获取webhook地址的消息格式，未设置或无效时返回generic
+func GetWebhookFormat(webhook string) string {
+	config := GetConfig()
+	if config == nil {
+		return WebhookFormatGeneric
+	}
+	switch format := strings.ToLower(strings.TrimSpace(config.Notification.WebhookFormats[webhook])); format {
+	case WebhookFormatFeishu, WebhookFormatDingTalk:
+		return format
+	}
+	return WebhookFormatGeneric
+}
+
+// IsValidWebhookFormat 检查webhook的消息格式是否有效，空字符串表示generic
+func IsValidWebhookFormat(format string) bool {
+	switch format {
+	case "", WebhookFormatGeneric, WebhookFormatFeishu, WebhookFormatDingTalk:
+		return true
+	}
+	return false
+}
+
+// GetAlertCooldown 获取同一种告警再次发送的最小间隔
+func GetAlertCooldown() time.Duration {
+	config := GetConfig()
+	hours := DefaultAlertCooldownHours
+	if config != nil && config.Notification.AlertCooldownHours > 0 {
+		hours = config.Notification.AlertCooldownHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// LoadNotificationAlertState 获取告警上次发送的时间（Unix秒），键为告警类型和密钥的组合
+func LoadNotificationAlertState() map[string]int64 {
+	state := make(map[string]int64)
+	if db == nil {
+		return state
+	}
+
+	var value string
+	err := db.QueryRow("SELECT value FROM "+configTableName+" WHERE key = ?", notificationAlertStateKey).Scan(&value)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("获取告警发送记录失败: %v", err)
+		}
+		return state
+	}
+	if err := json.Unmarshal([]byte(value), &state); err != nil {
+		logger.Error("解析告警发送记录失败: %v", err)
+	}
+	return state
+}
+
+// SaveNotificationAlertState 保存告警上次发送的时间，重启后不会重复发送冷却期内的告警
+func SaveNotificationAlertState(state map[string]int64) error {
+	if db == nil {
+		return errors.New("数据库连接未初始化")
+	}
+	if err := CheckWritable(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO `+configTableName+` (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, notificationAlertStateKey, string(data))
+	return err
+}
+
+// GetDesktopNotificationMode 获取桌面通知的开启方式，未设置或无效时返回auto
+func GetDesktopNotificationMode() string {
+	config := GetConfig()
+	if config == nil {
+		return DesktopNotificationAuto
+	}
+	switch mode := strings.ToLower(strings.TrimSpace(config.Notification.Desktop)); mode {
+	case DesktopNotificationOn, DesktopNotificationOff:
+		return mode
+	default:
+		return DesktopNotificationAuto
+	}
+}
+
+// IsNotificationEventEnabled 检查通知事件是否开启，未在disabled_events中的事件都会发送
+func IsNotificationEventEnabled(event string) bool {
+	config := GetConfig()
+	if config == nil {
+		return true
+	}
+	for _, disabled := range config.Notification.DisabledEvents {
+		if strings.TrimSpace(disabled) == event {
+			return false
+		}
+	}
+	return true
+}
+
+// GetNotificationRetryTTL 获取发送失败的通知最多重试的时间
+func GetNotificationRetryTTL() time.Duration {
+	config := GetConfig()
+	minutes := DefaultNotificationRetryTTLMinutes
+	if config != nil && config.Notification.RetryTTLMinutes > 0 {
+		minutes = config.Notification.RetryTTLMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// GetNotificationOutboxSize 获取发送队列最多保存的通知数
+func GetNotificationOutboxSize() int {
+	config := GetConfig()
+	if config == nil || config.Notification.OutboxSize <= 0 {
+		return DefaultNotificationOutboxSize
+	}
+	return config.Notification.OutboxSize
+}
+
+// initNotificationOutboxTable 创建通知发送队列表
+func initNotificationOutboxTable() error {
+	query := `CREATE TABLE IF NOT EXISTS ` + notificationOutboxTableName + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		channel TEXT NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		next_attempt_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`
+	if _, err := db.Exec(query); err != nil {
+		logger.Error("创建通知发送队列表失败: %v", err)
+		return err
+	}
+
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_" + notificationOutboxTableName + "_channel_status ON " + notificationOutboxTableName + " (channel, status, id)"); err != nil {
+		logger.Error("创建通知发送队列索引失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// EnqueueNotification 将一条通知加入发送队列，队列超过上限时丢弃最早的通知
+func EnqueueNotification(channel string, event string, payload string) (int64, error) {
+	if db == nil {
+		return 0, errors.New("数据库连接未初始化")
+	}
+
+	now := time.Now().Unix()
+	result, err := ExecWithRetry(
+		"保存通知",
+		3,
+		`INSERT INTO `+notificationOutboxTableName+`
+		(channel, event, payload, status, created_at, next_attempt_at, expires_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		channel, event, payload, NotificationPending, now, now,
+		time.Now().Add(GetNotificationRetryTTL()).Unix(), now,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := pruneNotificationOutbox(); err != nil {
+		logger.Error("清理通知发送队列失败: %v", err)
+	}
+	return id, nil
+}
+
+// pruneNotificationOutbox 队列超过上限时从最早的通知开始删除，未发送的通知计入丢弃数量
+func pruneNotificationOutbox() error {
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + notificationOutboxTableName).Scan(&total); err != nil {
+		return err
+	}
+
+	excess := total - GetNotificationOutboxSize()
+	if excess <= 0 {
+		return nil
+	}
+
+	var cutoff int64
+	var dropped int
+	err := db.QueryRow(
+		`SELECT MAX(id), SUM(CASE WHEN status = ? THEN 1 ELSE 0 END)
+		FROM (SELECT id, status FROM `+notificationOutboxTableName+` ORDER BY id ASC LIMIT ?)`,
+		NotificationPending, excess,
+	).Scan(&cutoff, &dropped)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ExecWithRetry("清理通知发送队列", 3, "DELETE FROM "+notificationOutboxTableName+" WHERE id <= ?", cutoff); err != nil {
+		return err
+	}
+
+	if dropped > 0 {
+		logger.Warn("通知发送队列已满，丢弃了 %d 条未发送的通知", dropped)
+		_, err = ExecWithRetry(
+			"保存丢弃通知数量",
+			3,
+			`INSERT INTO `+configTableName+` (key, value) VALUES (?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = CAST(CAST(value AS INTEGER) + ? AS TEXT)`,
+			notificationDroppedKey, strconv.Itoa(dropped), dropped,
+		)
+	}
+	return err
+}
+
+// GetDroppedNotificationCount 获取因队列已满被丢弃的未发送通知数量
+func GetDroppedNotificationCount() int {
+	if db == nil {
+		return 0
+	}
+
+	var value string
+	err := db.QueryRow("SELECT value FROM "+configTableName+" WHERE key = ?", notificationDroppedKey).Scan(&value)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("获取丢弃通知数量失败: %v", err)
+		}
+		return 0
+	}
+
+	count, _ := strconv.Atoi(value)
+	return count
+}
+
+// GetDueNotifications 获取每个通道中最早的一条待发送通知，到达重试时间的才返回
+// 同一通道的通知必须在前一条发送成功或过期后才会发送，保证通道内的发送顺序
+func GetDueNotifications(now time.Time) ([]NotificationEntry, error) {
+	if db == nil {
+		return nil, errors.New("数据库连接未初始化")
+	}
+
+	rows, err := db.Query(
+		`SELECT `+notificationColumns+` FROM `+notificationOutboxTableName+` o
+		WHERE o.status = ? AND o.next_attempt_at <= ? AND o.id = (
+			SELECT MIN(id) FROM `+notificationOutboxTableName+` WHERE channel = o.channel AND status = ?
+		)
+		ORDER BY o.id ASC`,
+		NotificationPending, now.Unix(), NotificationPending,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanNotifications(rows)
+}
+
+// GetNotificationOutbox 获取发送队列中最近的通知，按加入时间倒序排列
+func GetNotificationOutbox(limit int) []NotificationEntry {
+	entries := make([]NotificationEntry, 0)
+	if db == nil {
+		logger.Error("获取通知发送队列失败: %v", errors.New("数据库连接未初始化"))
+		return entries
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := db.Query("SELECT "+notificationColumns+" FROM "+notificationOutboxTableName+" ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		logger.Error("获取通知发送队列失败: %v", err)
+		return entries
+	}
+	defer rows.Close()
+
+	scanned, err := scanNotifications(rows)
+	if err != nil {
+		logger.Error("读取通知发送队列失败: %v", err)
+		return entries
+	}
+	return append(entries, scanned...)
+}
+
+// MarkNotificationDelivered 记录通知发送成功
+func MarkNotificationDelivered(id int64, attempts int) error {
+	_, err := ExecWithRetry(
+		"更新通知状态",
+		3,
+		"UPDATE "+notificationOutboxTableName+" SET status = ?, attempts = ?, last_error = '', updated_at = ? WHERE id = ?",
+		NotificationDelivered, attempts, time.Now().Unix(), id,
+	)
+	return err
+}
+
+// MarkNotificationFailed 记录通知发送失败和下次重试时间
+func MarkNotificationFailed(id int64, attempts int, lastError string, nextAttemptAt time.Time) error {
+	_, err := ExecWithRetry(
+		"更新通知状态",
+		3,
+		"UPDATE "+notificationOutboxTableName+" SET attempts = ?, last_error = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?",
+		attempts, lastError, nextAttemptAt.Unix(), time.Now().Unix(), id,
+	)
+	return err
+}
+
+// ExpireNotifications 将超过保留时间仍未发送成功的通知标记为过期，返回过期的数量
+func ExpireNotifications(now time.Time) (int64, error) {
+	result, err := ExecWithRetry(
+		"标记过期通知",
+		3,
+		"UPDATE "+notificationOutboxTableName+" SET status = ?, updated_at = ? WHERE status = ? AND expires_at < ?",
+		NotificationExpired, now.Unix(), NotificationPending, now.Unix(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RetryNotificationNow 将通知重新设为待发送并立即重试，过期的通知重新计算保留时间
+// 同一通道中更早的待发送通知会先于这条通知发送
+func RetryNotificationNow(id int64) error {
+	now := time.Now()
+	result, err := ExecWithRetry(
+		"重试通知",
+		3,
+		`UPDATE `+notificationOutboxTableName+`
+		SET status = ?, next_attempt_at = ?, expires_at = MAX(expires_at, ?), updated_at = ?
+		WHERE id = ? AND status != ?`,
+		NotificationPending, now.Unix(), now.Add(GetNotificationRetryTTL()).Unix(), now.Unix(),
+		id, NotificationDelivered,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("通知不存在或已发送成功")
+	}
+
+	// 同一通道中更早的待发送通知需要先发送，一并提前重试时间以保持顺序
+	_, err = ExecWithRetry(
+		"重试通知",
+		3,
+		`UPDATE `+notificationOutboxTableName+` SET next_attempt_at = ?
+		WHERE status = ? AND id < ? AND channel = (SELECT channel FROM `+notificationOutboxTableName+` WHERE id = ?)`,
+		now.Unix(), NotificationPending, id, id,
+	)
+	return err
+}
+
+// 通知发送队列查询的字段
+const notificationColumns = "id, channel, event, payload, status, attempts, last_error, created_at, next_attempt_at, expires_at, updated_at"
+
+// scanNotifications 读取通知发送队列的查询结果
+func scanNotifications(rows *sql.Rows) ([]NotificationEntry, error) {
+	entries := make([]NotificationEntry, 0)
+	for rows.Next() {
+		var entry NotificationEntry
+		if err := rows.Scan(&entry.ID, &entry.Channel, &entry.Event, &entry.Payload, &entry.Status, &entry.Attempts,
+			&entry.LastError, &entry.CreatedAt, &entry.NextAttemptAt, &entry.ExpiresAt, &entry.UpdatedAt); err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
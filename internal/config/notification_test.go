@@ -0,0 +1,43 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApplyLegacyPayloadDefault(t *testing.T) {
+	tests := []struct {
+		name       string
+		configJSON string
+		want       bool
+	}{
+		{
+			name:       "升级前已配置webhook时按旧版本的格式发送",
+			configJSON: `{"Notification":{"Webhooks":["https://example.com/hook"]}}`,
+			want:       true,
+		},
+		{
+			name:       "已保存legacy_payload时使用保存的值",
+			configJSON: `{"Notification":{"Webhooks":["https://example.com/hook"],"LegacyPayload":false}}`,
+			want:       false,
+		},
+		{
+			name:       "没有webhook时发送事件信封",
+			configJSON: `{"Notification":{}}`,
+			want:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			if err := json.Unmarshal([]byte(tt.configJSON), &cfg); err != nil {
+				t.Fatal(err)
+			}
+			applyLegacyPayloadDefault(&cfg, []byte(tt.configJSON))
+			if cfg.Notification.LegacyPayload != tt.want {
+				t.Errorf("LegacyPayload = %v, want %v", cfg.Notification.LegacyPayload, tt.want)
+			}
+		})
+	}
+}
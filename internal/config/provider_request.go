@@ -0,0 +1,53 @@
+/**
+  @author: Hanhai
+  @desc: 发往各服务商的请求附加的请求头和签名配置，按密钥所属的服务商匹配
+**/
+
+package config
+
+import "strings"
+
+// ProviderRequestConfig 发往一个服务商的请求附加的请求头和签名
+type ProviderRequestConfig struct {
+	Provider string               `mapstructure:"provider"` // 服务商，与密钥的服务商相同，未设置服务商的密钥为openai
+	Headers  map[string]string    `mapstructure:"headers"`  // 附加的固定请求头，与已有的请求头同名时覆盖
+	Signing  RequestSigningConfig `mapstructure:"signing"`  // 请求签名，Type为空时不签名
+}
+
+// RequestSigningConfig 请求签名的配置，各签名方式使用其中的部分字段
+type RequestSigningConfig struct {
+	Type            string `mapstructure:"type"`             // 签名方式，内置hmac-sha256
+	Secret          string `mapstructure:"secret"`           // 签名密钥
+	Header          string `mapstructure:"header"`           // 签名的请求头，为空时使用X-Signature
+	TimestampHeader string `mapstructure:"timestamp_header"` // 时间戳的请求头，为空时使用X-Timestamp
+	Canonical       string `mapstructure:"canonical"`        // 签名内容的模板，支持{timestamp}、{body_sha256}、{method}和{path}，为空时为"{timestamp}\n{body_sha256}"
+}
+
+// GetProviderRequestConfig 获取发往服务商的请求的附加配置，没有配置时返回false
+func GetProviderRequestConfig(cfg *Config, provider string) (ProviderRequestConfig, bool) {
+	if cfg == nil {
+		return ProviderRequestConfig{}, false
+	}
+	if provider == "" {
+		provider = DefaultKeyProvider
+	}
+	for _, rule := range cfg.Providers {
+		if strings.EqualFold(strings.TrimSpace(rule.Provider), provider) {
+			return rule, true
+		}
+	}
+	return ProviderRequestConfig{}, false
+}
+
+// GetApiKeyProvider 获取密钥所属的服务商，密钥不在密钥池中时返回默认服务商
+func GetApiKeyProvider(key string) string {
+	keysMutex.RLock()
+	defer keysMutex.RUnlock()
+
+	for _, k := range apiKeys {
+		if k.Key == key {
+			return k.GetProvider()
+		}
+	}
+	return DefaultKeyProvider
+}
@@ -0,0 +1,123 @@
+/**
+  @author: Hanhai
+  @desc: 代理请求计数器，按模型和返回的状态码累计请求数、失败数和重试次数，使用原子计数，抓取指标时读取快照，程序重启后清零
+**/
+
+package config
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// 计数器中不同模型和状态码组合的最大数量，超过后新的模型计入ProxyCounterOtherModel
+const maxProxyCounterSeries = 500
+
+// ProxyCounterOtherModel 计数器组合数超过上限后新模型使用的名称，避免客户端传入任意模型名导致指标无限增长
+const ProxyCounterOtherModel = "other"
+
+// proxyCounterKey 计数器的模型和状态码
+type proxyCounterKey struct {
+	model  string
+	status int
+}
+
+// proxyCounter 一个模型和状态码组合的计数
+type proxyCounter struct {
+	requests atomic.Uint64
+	failures atomic.Uint64
+}
+
+var (
+	// 按模型和状态码的请求计数，proxyCounterKey -> *proxyCounter
+	proxyCounters      sync.Map
+	proxyCounterSeries atomic.Int64
+	// 按模型的重试次数，string -> *atomic.Uint64
+	proxyRetries     sync.Map
+	proxyRetrySeries atomic.Int64
+)
+
+// ProxyCounterSample 一个模型和状态码组合的累计计数
+type ProxyCounterSample struct {
+	Model    string
+	Status   int
+	Requests uint64 // 代理的请求数
+	Failures uint64 // 重试后仍然失败的请求数
+}
+
+// RecordProxyRequest 记录一次代理请求的最终结果，status为返回给客户端的状态码
+func RecordProxyRequest(model string, status int, success bool) {
+	counter := loadProxyCounter(proxyCounterKey{model: model, status: status})
+	counter.requests.Add(1)
+	if !success {
+		counter.failures.Add(1)
+	}
+}
+
+// RecordProxyRetries 记录一次请求中换密钥重试的次数
+func RecordProxyRetries(model string, count int) {
+	if count <= 0 {
+		return
+	}
+	if value, ok := proxyRetries.Load(model); ok {
+		value.(*atomic.Uint64).Add(uint64(count))
+		return
+	}
+	if proxyRetrySeries.Load() >= maxProxyCounterSeries {
+		model = ProxyCounterOtherModel
+	}
+	value, loaded := proxyRetries.LoadOrStore(model, new(atomic.Uint64))
+	if !loaded {
+		proxyRetrySeries.Add(1)
+	}
+	value.(*atomic.Uint64).Add(uint64(count))
+}
+
+// loadProxyCounter 获取模型和状态码组合的计数器，不存在时创建
+func loadProxyCounter(key proxyCounterKey) *proxyCounter {
+	if value, ok := proxyCounters.Load(key); ok {
+		return value.(*proxyCounter)
+	}
+	if proxyCounterSeries.Load() >= maxProxyCounterSeries {
+		key.model = ProxyCounterOtherModel
+	}
+	value, loaded := proxyCounters.LoadOrStore(key, &proxyCounter{})
+	if !loaded {
+		proxyCounterSeries.Add(1)
+	}
+	return value.(*proxyCounter)
+}
+
+// GetProxyCounters 获取按模型和状态码的累计计数，按模型和状态码排序
+func GetProxyCounters() []ProxyCounterSample {
+	samples := make([]ProxyCounterSample, 0)
+	proxyCounters.Range(func(k, v interface{}) bool {
+		key := k.(proxyCounterKey)
+		counter := v.(*proxyCounter)
+		samples = append(samples, ProxyCounterSample{
+			Model:    key.model,
+			Status:   key.status,
+			Requests: counter.requests.Load(),
+			Failures: counter.failures.Load(),
+		})
+		return true
+	})
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].Model != samples[j].Model {
+			return samples[i].Model < samples[j].Model
+		}
+		return samples[i].Status < samples[j].Status
+	})
+	return samples
+}
+
+// GetProxyRetries 获取按模型的累计重试次数
+func GetProxyRetries() map[string]uint64 {
+	retries := make(map[string]uint64)
+	proxyRetries.Range(func(k, v interface{}) bool {
+		retries[k.(string)] = v.(*atomic.Uint64).Load()
+		return true
+	})
+	return retries
+}
@@ -0,0 +1,94 @@
+/**
+  @author: Hanhai
+  @desc: 固定时间窗口的用量计数，用于密钥的RPM/TPM统计和限流
+**/
+
+package config
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// 未设置窗口长度时使用的默认值（秒）
+const defaultRateLimitWindowSec = 60
+
+// RateLimitWindow 固定时间窗口内的用量计数
+// 每次读取时检查窗口是否已过期，过期的窗口用量视为0，不依赖定时任务清零
+type RateLimitWindow struct {
+	Limit             int       // 窗口内允许的最大用量，0表示不限制
+	Used              int       // 当前窗口内已使用的用量
+	WindowStart       time.Time // 当前窗口的开始时间
+	WindowDurationSec int       // 窗口长度（秒），0表示使用默认的60秒
+}
+
+// duration 获取窗口长度
+func (w RateLimitWindow) duration() time.Duration {
+	if w.WindowDurationSec <= 0 {
+		return defaultRateLimitWindowSec * time.Second
+	}
+	return time.Duration(w.WindowDurationSec) * time.Second
+}
+
+// expired 检查窗口在指定时间是否已过期
+func (w RateLimitWindow) expired(now time.Time) bool {
+	return w.WindowStart.IsZero() || now.After(w.WindowStart.Add(w.duration()))
+}
+
+// Add 在当前窗口中累加用量，窗口已过期时先清零并从当前时间开始新的窗口
+func (w *RateLimitWindow) Add(n int) {
+	now := time.Now()
+	if w.expired(now) {
+		w.Used = 0
+		w.WindowStart = now
+	}
+	w.Used += n
+}
+
+// Current 获取当前窗口内的用量，窗口已过期时返回0
+func (w RateLimitWindow) Current() int {
+	if w.expired(time.Now()) {
+		return 0
+	}
+	return w.Used
+}
+
+// Available 获取当前窗口内剩余可用的用量，未设置上限时返回math.MaxInt
+func (w RateLimitWindow) Available() int {
+	if w.Limit <= 0 {
+		return math.MaxInt
+	}
+	available := w.Limit - w.Current()
+	if available < 0 {
+		return 0
+	}
+	return available
+}
+
+// Remaining 获取距离当前窗口结束的时间，窗口已过期时返回0
+func (w RateLimitWindow) Remaining() time.Duration {
+	now := time.Now()
+	if w.expired(now) {
+		return 0
+	}
+	return w.WindowStart.Add(w.duration()).Sub(now)
+}
+
+// MarshalJSON 序列化为当前窗口内的用量，保持rpm/tpm字段原有的数值格式
+func (w RateLimitWindow) MarshalJSON() ([]byte, error) {
+	return json.Marshal(w.Current())
+}
+
+// UnmarshalJSON 从数值恢复用量，窗口从当前时间开始计算
+func (w *RateLimitWindow) UnmarshalJSON(data []byte) error {
+	var used int
+	if err := json.Unmarshal(data, &used); err != nil {
+		return err
+	}
+	w.Used = used
+	if used > 0 {
+		w.WindowStart = time.Now()
+	}
+	return nil
+}
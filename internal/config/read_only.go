@@ -0,0 +1,101 @@
+/**
+  @author: Hanhai
+  @desc: 只读数据库模式，副本实例从共享数据库读取配置和密钥，但不写入数据库
+**/
+
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReadOnlyFlag 以只读方式打开配置数据库的命令行参数
+const ReadOnlyFlag = "--read-only"
+
+// ErrReadOnlyDatabase 只读数据库模式下拒绝写入数据库
+var ErrReadOnlyDatabase = errors.New("配置数据库以只读模式打开，不能写入数据库")
+
+// 是否以只读模式打开了配置数据库
+var readOnlyDatabase atomic.Bool
+
+// ParseReadOnlyFlag 检查命令行参数中是否包含--read-only
+func ParseReadOnlyFlag(args []string) bool {
+	for _, arg := range args {
+		if arg == ReadOnlyFlag {
+			return true
+		}
+	}
+	return false
+}
+
+// InitConfigDBReadOnly 以只读方式打开配置数据库，供读取共享数据库的副本实例使用
+// 不创建表也不迁移字段，数据库必须已由可写实例初始化
+func InitConfigDBReadOnly(dbPath string) error {
+	if dbPath == "" {
+		dbPath = filepath.Join("data", dbFileName)
+	}
+
+	// mode=ro 以只读方式打开文件，query_only 让SQLite拒绝所有修改语句
+	dsn := "file:" + filepath.ToSlash(dbPath) + "?mode=ro&_pragma=query_only(1)&_pragma=busy_timeout(5000)"
+	readOnlyDB, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return err
+	}
+	readOnlyDB.SetMaxOpenConns(1)
+	readOnlyDB.SetMaxIdleConns(1)
+	readOnlyDB.SetConnMaxLifetime(30 * time.Minute)
+
+	if err := readOnlyDB.Ping(); err != nil {
+		readOnlyDB.Close()
+		return fmt.Errorf("以只读方式打开配置数据库失败: %w", err)
+	}
+
+	// 只读模式下无法创建配置表，表不存在说明数据库尚未初始化
+	var tableExists int
+	err = readOnlyDB.QueryRow("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?", configTableName).Scan(&tableExists)
+	if err != nil {
+		readOnlyDB.Close()
+		return fmt.Errorf("检查配置表存在失败: %w", err)
+	}
+	if tableExists == 0 {
+		readOnlyDB.Close()
+		return fmt.Errorf("配置数据库 %s 尚未初始化，请先以可写模式启动一次", dbPath)
+	}
+
+	db = readOnlyDB
+	closeConfigDBOnce = sync.Once{}
+	readOnlyDatabase.Store(true)
+	CheckDataVersion(dbPath, currentBinaryVersion)
+
+	logger.Info("配置数据库已以只读模式打开: %s", dbPath)
+	return nil
+}
+
+// IsReadOnlyDatabase 检查配置数据库是否以只读模式打开
+func IsReadOnlyDatabase() bool {
+	return readOnlyDatabase.Load()
+}
+
+// CheckWritable 检查当前是否允许写入数据库
+// 只读数据库模式返回ErrReadOnlyDatabase，只读维护模式返回ErrMaintenanceMode
+func CheckWritable() error {
+	if IsReadOnlyDatabase() {
+		return ErrReadOnlyDatabase
+	}
+	if IsMaintenanceMode() {
+		return ErrMaintenanceMode
+	}
+	return nil
+}
+
+// dbWritable 数据库已连接且允许写入时返回true，用于只同步内存状态到数据库的场景
+func dbWritable() bool {
+	return db != nil && CheckWritable() == nil
+}
@@ -0,0 +1,126 @@
+/**
+  @author: Hanhai
+  @desc: 最近15分钟按秒分桶的请求数、错误数和延迟，固定大小的环形缓冲区，内存占用与流量无关
+**/
+
+package config
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// RealtimeWindowSeconds 实时指标保留的秒数
+const RealtimeWindowSeconds = 15 * 60
+
+// 计算当前RPS时平均的秒数
+const realtimeRPSSeconds = 5
+
+// 正在重置的桶的秒数标记
+const realtimeSlotResetting = -1
+
+// realtimeSlot 一秒内的请求统计，second为该桶对应的Unix秒
+type realtimeSlot struct {
+	second    atomic.Int64
+	requests  atomic.Int64
+	errors    atomic.Int64
+	latencyMs atomic.Int64 // 请求耗时之和（毫秒）
+}
+
+// 各秒的请求统计，下标为Unix秒对窗口大小取余，程序重启后清零
+var realtimeSlots [RealtimeWindowSeconds]realtimeSlot
+
+// RealtimePoint 一秒的请求统计
+type RealtimePoint struct {
+	Second       int64   `json:"second"`         // Unix秒
+	Requests     int64   `json:"requests"`       // 请求数
+	Errors       int64   `json:"errors"`         // 失败的请求数
+	AvgLatencyMs float64 `json:"avg_latency_ms"` // 平均耗时（毫秒），没有请求时为0
+}
+
+// RealtimeMetrics 实时指标序列
+type RealtimeMetrics struct {
+	Cursor int64           `json:"cursor"` // 最后一个已结束的秒，下次请求作为since传入只获取新的数据
+	RPS    float64         `json:"rps"`    // 最近5秒的平均每秒请求数
+	Points []RealtimePoint `json:"points"` // 按时间从旧到新排列，只包含已结束的秒
+}
+
+// RecordRealtimeRequest 在当前秒的桶中记录一次代理请求
+func RecordRealtimeRequest(success bool, latency time.Duration) {
+	now := time.Now().Unix()
+	slot := &realtimeSlots[now%RealtimeWindowSeconds]
+
+	for {
+		second := slot.second.Load()
+		if second == now {
+			break
+		}
+		if second == realtimeSlotResetting {
+			// 其他请求正在重置该桶
+			continue
+		}
+		if second > now {
+			// 系统时间回拨，丢弃这次记录
+			return
+		}
+		// 桶中是上一轮的数据，先标记为正在重置，清零后再切换到当前秒
+		if slot.second.CompareAndSwap(second, realtimeSlotResetting) {
+			slot.requests.Store(0)
+			slot.errors.Store(0)
+			slot.latencyMs.Store(0)
+			slot.second.Store(now)
+			break
+		}
+	}
+
+	slot.requests.Add(1)
+	if !success {
+		slot.errors.Add(1)
+	}
+	slot.latencyMs.Add(latency.Milliseconds())
+}
+
+// readRealtimeSlot 读取一秒的统计，桶中不是该秒的数据时返回0
+func readRealtimeSlot(second int64) RealtimePoint {
+	point := RealtimePoint{Second: second}
+	slot := &realtimeSlots[second%RealtimeWindowSeconds]
+	if slot.second.Load() != second {
+		return point
+	}
+	point.Requests = slot.requests.Load()
+	point.Errors = slot.errors.Load()
+	latencyMs := slot.latencyMs.Load()
+	// 读取期间桶被下一轮覆盖时丢弃
+	if slot.second.Load() != second {
+		return RealtimePoint{Second: second}
+	}
+	if point.Requests > 0 {
+		point.AvgLatencyMs = float64(latencyMs) / float64(point.Requests)
+	}
+	return point
+}
+
+// GetRealtimeMetrics 获取since之后到上一秒为止的每秒统计，since为0或早于窗口时返回整个窗口
+func GetRealtimeMetrics(since int64) RealtimeMetrics {
+	cursor := time.Now().Unix() - 1
+	start := cursor - RealtimeWindowSeconds + 1
+	if since >= start {
+		start = since + 1
+	}
+
+	points := make([]RealtimePoint, 0, max(cursor-start+1, 0))
+	for second := start; second <= cursor; second++ {
+		points = append(points, readRealtimeSlot(second))
+	}
+
+	var recent int64
+	for second := cursor - realtimeRPSSeconds + 1; second <= cursor; second++ {
+		recent += readRealtimeSlot(second).Requests
+	}
+
+	return RealtimeMetrics{
+		Cursor: cursor,
+		RPS:    float64(recent) / realtimeRPSSeconds,
+		Points: points,
+	}
+}
@@ -0,0 +1,89 @@
+/**
+  @author: Hanhai
+  @desc: 安全审计记录，保存凭据轮换等安全操作的时间、来源和操作内容，记录中不包含凭据明文
+**/
+
+package config
+
+import (
+	"encoding/json"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"time"
+)
+
+// 安全审计表名
+const securityAuditTableName = "security_audit"
+
+// SecurityAuditRecord 一条安全审计记录
+type SecurityAuditRecord struct {
+	ID        int64           `json:"id"`
+	Action    string          `json:"action"`     // 操作类型
+	Actor     string          `json:"actor"`      // 操作来源，例如客户端地址或托盘菜单
+	Detail    json.RawMessage `json:"detail"`     // 操作内容
+	CreatedAt int64           `json:"created_at"` // 操作时间（Unix秒）
+}
+
+// initSecurityAuditTable 创建安全审计表
+func initSecurityAuditTable() error {
+	query := `CREATE TABLE IF NOT EXISTS ` + securityAuditTableName + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		action TEXT NOT NULL,
+		actor TEXT NOT NULL,
+		detail TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`
+	if _, err := db.Exec(query); err != nil {
+		logger.Error("创建安全审计表失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// RecordSecurityAudit 写入一条安全审计记录，detail序列化为JSON保存
+func RecordSecurityAudit(action string, actor string, detail interface{}) error {
+	if db == nil {
+		return fmt.Errorf("数据库连接未初始化")
+	}
+	if err := CheckWritable(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(detail)
+	if err != nil {
+		return fmt.Errorf("序列化审计内容失败: %w", err)
+	}
+	if _, err := db.Exec("INSERT INTO "+securityAuditTableName+" (action, actor, detail, created_at) VALUES (?, ?, ?, ?)",
+		action, actor, string(data), time.Now().Unix()); err != nil {
+		return fmt.Errorf("写入安全审计记录失败: %w", err)
+	}
+	return nil
+}
+
+// GetSecurityAudit 获取最近的安全审计记录，按时间从新到旧排列
+func GetSecurityAudit(limit int) ([]SecurityAuditRecord, error) {
+	if db == nil {
+		return nil, fmt.Errorf("数据库连接未初始化")
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := db.Query("SELECT id, action, actor, detail, created_at FROM "+securityAuditTableName+" ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询安全审计记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	records := make([]SecurityAuditRecord, 0)
+	for rows.Next() {
+		var record SecurityAuditRecord
+		var detail string
+		if err := rows.Scan(&record.ID, &record.Action, &record.Actor, &detail, &record.CreatedAt); err != nil {
+			return nil, err
+		}
+		record.Detail = json.RawMessage(detail)
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
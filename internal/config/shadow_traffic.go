@@ -0,0 +1,187 @@
+/**
+  @author: Hanhai
+  @desc: 影子流量配置和记录，将部分真实请求镜像到候选模型，保存两个响应的元数据用于离线对比
+**/
+
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"flowsilicon/internal/logger"
+	"strings"
+	"time"
+)
+
+const (
+	// 影子流量记录表名
+	shadowTrafficTableName = "shadow_requests"
+	// DefaultShadowDailyBudget 未设置每日预算时每天最多镜像的请求数
+	DefaultShadowDailyBudget = 100
+)
+
+// ShadowTrafficConfig 影子流量配置
+type ShadowTrafficConfig struct {
+	Rules        []ShadowRule `mapstructure:"rules"`         // 镜像规则，为空时不镜像
+	DailyBudget  int          `mapstructure:"daily_budget"`  // 每天最多镜像的请求数，0表示使用默认值
+	StoreContent bool         `mapstructure:"store_content"` // 审计存储，是否保存请求和两个响应的内容
+}
+
+// ShadowRule 影子流量镜像规则
+type ShadowRule struct {
+	Model       string  `mapstructure:"model"`        // 匹配的请求模型
+	ShadowModel string  `mapstructure:"shadow_model"` // 镜像到的候选模型
+	Percentage  float64 `mapstructure:"percentage"`   // 镜像的请求比例（0-100）
+	Key         string  `mapstructure:"key"`          // 镜像请求使用的API密钥，为空时按分组选择
+	Group       string  `mapstructure:"group"`        // 镜像请求使用的密钥分组，与Key都为空时使用默认选择策略
+}
+
+// ShadowRecord 一次影子流量的主请求和镜像请求记录
+type ShadowRecord struct {
+	ID                     int64  `json:"id"`
+	RequestID              string `json:"request_id"`
+	CreatedAt              int64  `json:"created_at"`
+	Model                  string `json:"model"`
+	ShadowModel            string `json:"shadow_model"`
+	PrimaryStatus          int    `json:"primary_status"`
+	PrimaryLatencyMs       int64  `json:"primary_latency_ms"`
+	PrimaryBytes           int    `json:"primary_bytes"`
+	ShadowStatus           int    `json:"shadow_status"`
+	ShadowLatencyMs        int64  `json:"shadow_latency_ms"`
+	ShadowBytes            int    `json:"shadow_bytes"`
+	ShadowPromptTokens     int    `json:"shadow_prompt_tokens"`
+	ShadowCompletionTokens int    `json:"shadow_completion_tokens"`
+	ShadowError            string `json:"shadow_error,omitempty"`
+	RequestBody            string `json:"request_body,omitempty"`
+	PrimaryResponse        string `json:"primary_response,omitempty"`
+	ShadowResponse         string `json:"shadow_response,omitempty"`
+}
+
+// GetShadowRule 获取匹配指定模型的影子流量规则，未配置时返回false
+func GetShadowRule(model string) (ShadowRule, bool) {
+	config := GetConfig()
+	if config == nil || model == "" {
+		return ShadowRule{}, false
+	}
+
+	for _, rule := range config.ShadowTraffic.Rules {
+		if rule.Model == model && rule.ShadowModel != "" && rule.ShadowModel != model && rule.Percentage > 0 {
+			return rule, true
+		}
+	}
+	return ShadowRule{}, false
+}
+
+// GetShadowDailyBudget 获取每天最多镜像的请求数
+func GetShadowDailyBudget() int {
+	config := GetConfig()
+	if config == nil || config.ShadowTraffic.DailyBudget <= 0 {
+		return DefaultShadowDailyBudget
+	}
+	return config.ShadowTraffic.DailyBudget
+}
+
+// IsShadowContentStored 检查是否保存影子流量的请求和响应内容
+func IsShadowContentStored() bool {
+	config := GetConfig()
+	return config != nil && config.ShadowTraffic.StoreContent
+}
+
+// initShadowTrafficTable 创建影子流量记录表
+func initShadowTrafficTable() error {
+	query := `CREATE TABLE IF NOT EXISTS ` + shadowTrafficTableName + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		request_id TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		model TEXT NOT NULL,
+		shadow_model TEXT NOT NULL,
+		primary_status INTEGER NOT NULL DEFAULT 0,
+		primary_latency_ms INTEGER NOT NULL DEFAULT 0,
+		primary_bytes INTEGER NOT NULL DEFAULT 0,
+		shadow_status INTEGER NOT NULL DEFAULT 0,
+		shadow_latency_ms INTEGER NOT NULL DEFAULT 0,
+		shadow_bytes INTEGER NOT NULL DEFAULT 0,
+		shadow_prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		shadow_completion_tokens INTEGER NOT NULL DEFAULT 0,
+		shadow_error TEXT NOT NULL DEFAULT '',
+		request_body TEXT NOT NULL DEFAULT '',
+		primary_response TEXT NOT NULL DEFAULT '',
+		shadow_response TEXT NOT NULL DEFAULT ''
+	)`
+	if _, err := db.Exec(query); err != nil {
+		logger.Error("创建影子流量记录表失败: %v", err)
+		return err
+	}
+
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_" + shadowTrafficTableName + "_request_id ON " + shadowTrafficTableName + " (request_id)"); err != nil {
+		logger.Error("创建影子流量记录索引失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// SaveShadowRecord 保存一条影子流量记录
+func SaveShadowRecord(record ShadowRecord) error {
+	if db == nil {
+		return errors.New("数据库连接未初始化")
+	}
+	if record.CreatedAt == 0 {
+		record.CreatedAt = time.Now().Unix()
+	}
+
+	_, err := ExecWithRetry(
+		"保存影子流量记录",
+		3,
+		`INSERT INTO `+shadowTrafficTableName+`
+		(request_id, created_at, model, shadow_model, primary_status, primary_latency_ms, primary_bytes,
+		shadow_status, shadow_latency_ms, shadow_bytes, shadow_prompt_tokens, shadow_completion_tokens, shadow_error,
+		request_body, primary_response, shadow_response)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.RequestID, record.CreatedAt, record.Model, record.ShadowModel,
+		record.PrimaryStatus, record.PrimaryLatencyMs, record.PrimaryBytes,
+		record.ShadowStatus, record.ShadowLatencyMs, record.ShadowBytes,
+		record.ShadowPromptTokens, record.ShadowCompletionTokens, record.ShadowError,
+		record.RequestBody, record.PrimaryResponse, record.ShadowResponse,
+	)
+	return err
+}
+
+// GetShadowRecords 获取最近的影子流量记录，requestID不为空时只返回该请求的记录
+func GetShadowRecords(requestID string, limit int) ([]ShadowRecord, error) {
+	if db == nil {
+		return nil, errors.New("数据库连接未初始化")
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	query := `SELECT id, request_id, created_at, model, shadow_model, primary_status, primary_latency_ms, primary_bytes,
+		shadow_status, shadow_latency_ms, shadow_bytes, shadow_prompt_tokens, shadow_completion_tokens, shadow_error,
+		request_body, primary_response, shadow_response FROM ` + shadowTrafficTableName
+	var rows *sql.Rows
+	var err error
+	requestID = strings.TrimSpace(requestID)
+	if requestID != "" {
+		rows, err = db.Query(query+" WHERE request_id = ? ORDER BY id DESC LIMIT ?", requestID, limit)
+	} else {
+		rows, err = db.Query(query+" ORDER BY id DESC LIMIT ?", limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]ShadowRecord, 0)
+	for rows.Next() {
+		var r ShadowRecord
+		if err := rows.Scan(&r.ID, &r.RequestID, &r.CreatedAt, &r.Model, &r.ShadowModel,
+			&r.PrimaryStatus, &r.PrimaryLatencyMs, &r.PrimaryBytes,
+			&r.ShadowStatus, &r.ShadowLatencyMs, &r.ShadowBytes,
+			&r.ShadowPromptTokens, &r.ShadowCompletionTokens, &r.ShadowError,
+			&r.RequestBody, &r.PrimaryResponse, &r.ShadowResponse); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
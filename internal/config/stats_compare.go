@@ -0,0 +1,274 @@
+/**
+  @author: Hanhai
+  @desc: 统计周期对比，按统计时区比较本周与上周或今天与之前某天的请求数、令牌数和消耗，当前周期未结束时只比较已经过的相同部分
+**/
+
+package config
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// 可以对比的统计指标和周期
+const (
+	CompareMetricRequests = "requests"
+	CompareMetricTokens   = "tokens"
+	CompareMetricCost     = "cost"
+	ComparePeriodDay      = "day"
+	ComparePeriodWeek     = "week"
+)
+
+// StatsComparison 当前周期与之前周期的对比
+type StatsComparison struct {
+	Metric        string           `json:"metric"`
+	Period        string           `json:"period"`
+	Offset        int              `json:"offset"`
+	Timezone      string           `json:"timezone"`
+	Current       StatsPeriodTotal `json:"current"`
+	Previous      StatsPeriodTotal `json:"previous"`
+	Delta         float64          `json:"delta"`
+	DeltaPercent  *float64         `json:"delta_percent"` // 之前周期为0时为null
+	Partial       bool             `json:"partial"`       // 当前周期未结束，两个周期都只比较到今天的第ComparedHours个小时
+	ComparedHours int              `json:"compared_hours"`
+	// 之前周期中与今天对应的那一天，没有每小时数据的消耗和模型用量按该天每小时请求数的比例估算
+	PreviousEstimated bool                   `json:"previous_estimated"`
+	Days              []StatsDayComparison   `json:"days"`
+	Models            []StatsModelComparison `json:"models"`
+}
+
+// StatsPeriodTotal 一个周期参与对比的日期范围和合计
+type StatsPeriodTotal struct {
+	Start string  `json:"start"`
+	End   string  `json:"end"` // 参与对比的最后一天，当前周期未结束时为今天
+	Total float64 `json:"total"`
+}
+
+// StatsDayComparison 两个周期中对应的一天
+type StatsDayComparison struct {
+	CurrentDate    string   `json:"current_date"`
+	PreviousDate   string   `json:"previous_date"`
+	Current        float64  `json:"current"`
+	Previous       float64  `json:"previous"`
+	DeltaPercent   *float64 `json:"delta_percent"`
+	Partial        bool     `json:"partial"` // 今天，只比较已经过的小时
+	CurrentNoData  bool     `json:"current_no_data,omitempty"`
+	PreviousNoData bool     `json:"previous_no_data,omitempty"`
+}
+
+// StatsModelComparison 一个模型在两个周期中的用量，消耗没有按模型的统计，对比消耗时没有模型数据
+type StatsModelComparison struct {
+	Model        string   `json:"model"`
+	Current      float64  `json:"current"`
+	Previous     float64  `json:"previous"`
+	DeltaPercent *float64 `json:"delta_percent"`
+}
+
+// CompareStats 对比当前周期与offset个周期之前的统计，period为day或week（从周一开始），metric为requests、tokens或cost
+func CompareStats(metric, period string, offset int) (*StatsComparison, error) {
+	switch metric {
+	case CompareMetricRequests, CompareMetricTokens, CompareMetricCost:
+	default:
+		return nil, fmt.Errorf("不支持的统计指标: %s", metric)
+	}
+	days := 1
+	switch period {
+	case ComparePeriodDay:
+	case ComparePeriodWeek:
+		days = 7
+	default:
+		return nil, fmt.Errorf("不支持的统计周期: %s", period)
+	}
+	if offset < 1 {
+		return nil, fmt.Errorf("对比的周期数必须大于0")
+	}
+
+	now := StatsNow()
+	todayStart, _ := statsDayBounds(now)
+	year, month, day := now.Date()
+	todayIndex := 0
+	if period == ComparePeriodWeek {
+		todayIndex = (int(now.Weekday()) + 6) % 7
+	}
+	// 日期按中午计算，避免夏令时切换的当天加减天数落到相邻的日期
+	dateAt := func(shift int) string {
+		return time.Date(year, month, day+shift, 12, 0, 0, 0, now.Location()).Format(StatsDateLayout)
+	}
+	// 部分超出保留天数的日期按无数据处理
+	previousShift := -offset * days
+	if -previousShift >= maxDailyStatsDays {
+		return nil, fmt.Errorf("之前的周期超出了保留的 %d 天统计数据", maxDailyStatsDays)
+	}
+	// 今天已经过的小时数，当前小时计入对比
+	comparedHours := int(now.Sub(todayStart)/time.Hour) + 1
+
+	result := &StatsComparison{
+		Metric:        metric,
+		Period:        period,
+		Offset:        offset,
+		Timezone:      GetStatsLocation().String(),
+		Partial:       true,
+		ComparedHours: comparedHours,
+		Days:          make([]StatsDayComparison, 0, todayIndex+1),
+		Models:        make([]StatsModelComparison, 0),
+	}
+
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+
+	statsByDate := make(map[string]*DailyStats)
+	if dailyData != nil {
+		for i := range dailyData.DailyStats {
+			statsByDate[dailyData.DailyStats[i].Date] = &dailyData.DailyStats[i]
+		}
+	}
+
+	currentModels := make(map[string]float64)
+	previousModels := make(map[string]float64)
+	for i := 0; i <= todayIndex; i++ {
+		currentDate := dateAt(i - todayIndex)
+		previousDate := dateAt(i - todayIndex + previousShift)
+		currentStats, previousStats := statsByDate[currentDate], statsByDate[previousDate]
+
+		// 今天只有已经过的部分，之前周期的对应日期只取相同的小时数
+		ratio := 1.0
+		partial := i == todayIndex
+		if partial && previousStats != nil {
+			ratio = hourlyRatioLocked(previousStats, comparedHours)
+			if metric == CompareMetricCost || len(previousStats.Models) > 0 {
+				result.PreviousEstimated = result.PreviousEstimated || ratio < 1
+			}
+		}
+
+		entry := StatsDayComparison{
+			CurrentDate:    currentDate,
+			PreviousDate:   previousDate,
+			Current:        dayMetricLocked(currentStats, currentDate, metric, 0),
+			Previous:       dayMetricLocked(previousStats, previousDate, metric, comparedHoursIf(partial, comparedHours)),
+			Partial:        partial,
+			CurrentNoData:  currentStats == nil || currentStats.NoData,
+			PreviousNoData: previousStats == nil || previousStats.NoData,
+		}
+		if partial && metric == CompareMetricCost {
+			entry.Previous = roundCompareValue(entry.Previous * ratio)
+		}
+		entry.DeltaPercent = comparePercent(entry.Current, entry.Previous)
+		result.Days = append(result.Days, entry)
+		result.Current.Total += entry.Current
+		result.Previous.Total += entry.Previous
+
+		if metric != CompareMetricCost {
+			addModelMetricLocked(currentModels, currentStats, metric, 1)
+			addModelMetricLocked(previousModels, previousStats, metric, ratio)
+		}
+	}
+
+	result.Current.Start, result.Current.End = dateAt(-todayIndex), dateAt(0)
+	result.Previous.Start, result.Previous.End = dateAt(-todayIndex+previousShift), dateAt(previousShift)
+	result.Current.Total = roundCompareValue(result.Current.Total)
+	result.Previous.Total = roundCompareValue(result.Previous.Total)
+	result.Delta = roundCompareValue(result.Current.Total - result.Previous.Total)
+	result.DeltaPercent = comparePercent(result.Current.Total, result.Previous.Total)
+
+	for model := range currentModels {
+		if _, exists := previousModels[model]; !exists {
+			previousModels[model] = 0
+		}
+	}
+	for model, previous := range previousModels {
+		current := currentModels[model]
+		previous = roundCompareValue(previous)
+		result.Models = append(result.Models, StatsModelComparison{
+			Model:        model,
+			Current:      current,
+			Previous:     previous,
+			DeltaPercent: comparePercent(current, previous),
+		})
+	}
+	sort.Slice(result.Models, func(i, j int) bool {
+		if result.Models[i].Current != result.Models[j].Current {
+			return result.Models[i].Current > result.Models[j].Current
+		}
+		return result.Models[i].Model < result.Models[j].Model
+	})
+	return result, nil
+}
+
+// comparedHoursIf partial为true时返回hours，否则返回0表示整天
+func comparedHoursIf(partial bool, hours int) int {
+	if partial {
+		return hours
+	}
+	return 0
+}
+
+// dayMetricLocked 获取一天的统计指标，hours大于0时请求数和令牌数只取前hours个小时，消耗没有每小时数据，总是取整天（已加锁）
+func dayMetricLocked(stats *DailyStats, date string, metric string, hours int) float64 {
+	if metric == CompareMetricCost {
+		cost := 0.0
+		if dailyData == nil {
+			return cost
+		}
+		for _, usage := range dailyData.GroupsUsage[date] {
+			cost += usage.Cost
+		}
+		return cost
+	}
+	if stats == nil {
+		return 0
+	}
+	if hours <= 0 {
+		if metric == CompareMetricTokens {
+			return float64(stats.Tokens.Total)
+		}
+		return float64(stats.Requests.Total)
+	}
+	total := 0
+	for i := 0; i < hours && i < len(stats.Hourly); i++ {
+		if metric == CompareMetricTokens {
+			total += stats.Hourly[i].Tokens
+		} else {
+			total += stats.Hourly[i].Requests
+		}
+	}
+	return float64(total)
+}
+
+// hourlyRatioLocked 获取一天前hours个小时的请求数占全天请求数的比例（已加锁）
+func hourlyRatioLocked(stats *DailyStats, hours int) float64 {
+	if stats.Requests.Total <= 0 {
+		return 1
+	}
+	requests := dayMetricLocked(stats, stats.Date, CompareMetricRequests, hours)
+	return math.Min(1, requests/float64(stats.Requests.Total))
+}
+
+// addModelMetricLocked 将一天各模型的用量乘以ratio后累加到models（已加锁）
+func addModelMetricLocked(models map[string]float64, stats *DailyStats, metric string, ratio float64) {
+	if stats == nil {
+		return
+	}
+	for model, usage := range stats.Models {
+		value := usage.Requests
+		if metric == CompareMetricTokens {
+			value = usage.Tokens
+		}
+		models[model] += float64(value) * ratio
+	}
+}
+
+// comparePercent 计算current相对previous的变化百分比，previous为0时返回nil
+func comparePercent(current, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	percent := roundCompareValue((current - previous) / previous * 100)
+	return &percent
+}
+
+// roundCompareValue 保留两位小数
+func roundCompareValue(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,107 @@
+/**
+  @author: Hanhai
+  @desc: 统计数据使用的时区，按所在时区的午夜划分日期，夏令时切换的当天为23或25小时，每小时统计按实际经过的小时分桶
+**/
+
+package config
+
+import (
+	"sync"
+	"time"
+
+	"flowsilicon/internal/logger"
+)
+
+// StatsDateLayout 统计数据中日期的格式
+const StatsDateLayout = "2006-01-02"
+
+var (
+	// 已加载的统计时区，时区名称不变时不重复加载
+	statsLocationName string
+	statsLocation     = time.Local
+	statsLocationLock sync.Mutex
+)
+
+// IsValidStatsTimezone 检查统计时区是否有效，为空表示使用系统时区
+func IsValidStatsTimezone(name string) bool {
+	if name == "" {
+		return true
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// GetStatsLocation 获取统计数据使用的时区，未设置或无效时使用系统时区
+func GetStatsLocation() *time.Location {
+	name := ""
+	if cfg := GetConfig(); cfg != nil {
+		name = cfg.App.StatsTimezone
+	}
+
+	statsLocationLock.Lock()
+	defer statsLocationLock.Unlock()
+
+	if name == statsLocationName {
+		return statsLocation
+	}
+	statsLocationName = name
+	statsLocation = time.Local
+	if name != "" {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			// 同一个无效的时区只提示一次
+			logger.Error("加载统计时区 %s 失败，使用系统时区: %v", name, err)
+		} else {
+			statsLocation = location
+		}
+	}
+	return statsLocation
+}
+
+// StatsNow 获取统计时区的当前时间
+func StatsNow() time.Time {
+	return clockNow().In(GetStatsLocation())
+}
+
+// StatsToday 获取统计时区的今天的日期
+func StatsToday() string {
+	return StatsNow().Format(StatsDateLayout)
+}
+
+// statsDayBounds 获取t所在的日期在其时区的开始时间和下一天的开始时间
+// 按日期计算而不是加24小时，夏令时切换的当天不是24小时
+func statsDayBounds(t time.Time) (time.Time, time.Time) {
+	year, month, day := t.Date()
+	start := time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	end := time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+	return start, end
+}
+
+// newHourlyStats 创建t所在日期的每小时统计，每个桶是从当天开始经过的一个小时，Hour为桶开始时的钟点
+// 夏令时开始的当天没有跳过的钟点，结束的当天重复的钟点有两个桶
+func newHourlyStats(t time.Time) []HourlyStats {
+	start, end := statsDayBounds(t)
+	hours := int(end.Sub(start) / time.Hour)
+	hourly := make([]HourlyStats, hours)
+	for i := range hourly {
+		hourly[i] = HourlyStats{Hour: start.Add(time.Duration(i) * time.Hour).Hour()}
+	}
+	return hourly
+}
+
+// hourlySlotLocked 获取t在当天每小时统计中的桶，旧版本数据固定24个桶，当天更长时补齐（已加锁）
+func hourlySlotLocked(stats *DailyStats, t time.Time) *HourlyStats {
+	start, _ := statsDayBounds(t)
+	index := int(t.Sub(start) / time.Hour)
+	if index >= len(stats.Hourly) {
+		full := newHourlyStats(t)
+		for i := len(stats.Hourly); i < len(full) && i <= index; i++ {
+			stats.Hourly = append(stats.Hourly, full[i])
+		}
+	}
+	if index >= len(stats.Hourly) {
+		// 不会发生，一天最多25个小时
+		index = len(stats.Hourly) - 1
+	}
+	return &stats.Hourly[index]
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+	_ "time/tzdata" // 测试环境可能没有系统时区数据
+)
+
+// useStatsClock 使用固定的统计时区和可以调整的时钟，并清空每日统计
+func useStatsClock(t *testing.T, timezone string, now time.Time) *time.Time {
+	t.Helper()
+	cfg := &Config{}
+	cfg.App.StatsTimezone = timezone
+	UpdateConfig(cfg)
+
+	current := now
+	previousClock := clockNow
+	clockNow = func() time.Time { return current }
+
+	dailyDataLock.Lock()
+	previousDaily := dailyData
+	dailyData = nil
+	dailyDataLock.Unlock()
+	// 记录统计后异步保存，写入临时目录
+	SetDailyFilePath(filepath.Join(t.TempDir(), "daily.json"))
+
+	t.Cleanup(func() {
+		clockNow = previousClock
+		dailyDataLock.Lock()
+		dailyData = previousDaily
+		dailyDataLock.Unlock()
+		UpdateConfig(&Config{})
+	})
+	return &current
+}
+
+// findDailyStats 获取指定日期的每日统计
+func findDailyStats(t *testing.T, date string) DailyStats {
+	t.Helper()
+	dailyDataLock.RLock()
+	defer dailyDataLock.RUnlock()
+	for _, stats := range dailyData.DailyStats {
+		if stats.Date == date {
+			return stats
+		}
+	}
+	t.Fatalf("没有 %s 的每日统计", date)
+	return DailyStats{}
+}
+
+func TestStatsDayBoundsDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		day       time.Time
+		wantHours int
+		wantClock []int // 每小时统计桶开始时的钟点
+	}{
+		{"夏令时开始", time.Date(2024, 3, 10, 12, 0, 0, 0, newYork), 23, []int{0, 1, 3, 4}},
+		{"夏令时结束", time.Date(2024, 11, 3, 12, 0, 0, 0, newYork), 25, []int{0, 1, 1, 2}},
+		{"普通日期", time.Date(2024, 6, 1, 12, 0, 0, 0, newYork), 24, []int{0, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := statsDayBounds(tt.day)
+			if got := end.Sub(start); got != time.Duration(tt.wantHours)*time.Hour {
+				t.Errorf("day length = %v, want %dh", got, tt.wantHours)
+			}
+			if start.Hour() != 0 || end.Hour() != 0 {
+				t.Errorf("bounds = %v - %v, want local midnight", start, end)
+			}
+			hourly := newHourlyStats(tt.day)
+			if len(hourly) != tt.wantHours {
+				t.Fatalf("len(hourly) = %d, want %d", len(hourly), tt.wantHours)
+			}
+			for i, hour := range tt.wantClock {
+				if hourly[i].Hour != hour {
+					t.Errorf("hourly[%d].Hour = %d, want %d", i, hourly[i].Hour, hour)
+				}
+			}
+			if last := hourly[len(hourly)-1].Hour; last != 23 {
+				t.Errorf("last slot hour = %d, want 23", last)
+			}
+		})
+	}
+}
+
+// 夏令时结束的当天，重复的1点分别计入两个桶，午夜按纽约时间而不是UTC切换日期
+func TestDailyStatsRolloverOnDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2024-11-03 01:30 EDT，一小时后的UTC时间同样是当地的01:30（EST）
+	firstOneThirty := time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC)
+	clock := useStatsClock(t, "America/New_York", firstOneThirty)
+
+	record := func(at time.Time) {
+		*clock = at
+		AddDailyRequestStat("", "test-model", 1, 10, 0, true)
+	}
+	record(firstOneThirty)
+	record(firstOneThirty.Add(time.Hour))
+	record(time.Date(2024, 11, 3, 23, 30, 0, 0, newYork))
+	// 当地时间11月4日00:30，UTC已经是11月4日05:30
+	record(time.Date(2024, 11, 4, 0, 30, 0, 0, newYork))
+
+	day := findDailyStats(t, "2024-11-03")
+	if len(day.Hourly) != 25 {
+		t.Fatalf("len(Hourly) = %d, want 25", len(day.Hourly))
+	}
+	if day.Requests.Total != 3 {
+		t.Errorf("2024-11-03 requests = %d, want 3", day.Requests.Total)
+	}
+	for index, want := range map[int]int{1: 1, 2: 1, 24: 1} {
+		if got := day.Hourly[index].Requests; got != want {
+			t.Errorf("Hourly[%d] (hour %d) requests = %d, want %d", index, day.Hourly[index].Hour, got, want)
+		}
+	}
+	if next := findDailyStats(t, "2024-11-04"); next.Requests.Total != 1 || len(next.Hourly) != 24 {
+		t.Errorf("2024-11-04 = %d requests, %d slots; want 1, 24", next.Requests.Total, len(next.Hourly))
+	}
+
+	// 夏令时开始的当天，3点的数据在第3个桶
+	record(time.Date(2024, 3, 10, 3, 15, 0, 0, newYork))
+	spring := findDailyStats(t, "2024-03-10")
+	if len(spring.Hourly) != 23 || spring.Hourly[2].Hour != 3 || spring.Hourly[2].Requests != 1 {
+		t.Errorf("2024-03-10 hourly = %+v", spring.Hourly)
+	}
+}
+
+// 旧版本保存的数据固定24个桶，25小时的当天最后一个小时补齐桶后记录
+func TestHourlySlotPadsLegacyData(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := &DailyStats{Date: "2024-11-03", Hourly: make([]HourlyStats, 24)}
+	for i := range stats.Hourly {
+		stats.Hourly[i].Hour = i
+	}
+	slot := hourlySlotLocked(stats, time.Date(2024, 11, 3, 23, 30, 0, 0, newYork))
+	slot.Requests++
+	if len(stats.Hourly) != 25 || stats.Hourly[24].Hour != 23 || stats.Hourly[24].Requests != 1 {
+		t.Errorf("hourly after padding = %+v", stats.Hourly[22:])
+	}
+}
@@ -0,0 +1,21 @@
+/**
+  @author: Hanhai
+  @desc: 公开状态数据的配置，供外部状态页读取密钥池的粗略健康状况，每个字段是否返回单独设置
+**/
+
+package config
+
+// StatusFeedConfig 公开状态数据的配置
+// 布尔值无法设置默认值，所有字段默认不返回，由管理员决定公开哪些信息
+type StatusFeedConfig struct {
+	Enabled            bool    `mapstructure:"enabled"`                            // 是否开启/status.json，默认关闭
+	Token              string  `mapstructure:"token"`                              // 访问/status.json的令牌，与管理界面的登录密码和代理访问令牌无关，为空时不能访问
+	RateLimitPerMinute int     `mapstructure:"rate_limit_per_minute" default:"60"` // 每个IP每分钟最多请求数
+	CacheSeconds       int     `mapstructure:"cache_seconds" default:"60"`         // 允许CDN和浏览器缓存的时间（秒）
+	BalanceTarget      float64 `mapstructure:"balance_target"`                     // 总余额的目标值，设置后余额按目标值的百分比返回，否则按区间返回
+	IncludeService     bool    `mapstructure:"include_service"`                    // 是否返回服务是否运行
+	IncludeKeys        bool    `mapstructure:"include_keys"`                       // 是否返回可用密钥数的区间
+	IncludeBalance     bool    `mapstructure:"include_balance"`                    // 是否返回总余额的区间或百分比
+	IncludeRequests    bool    `mapstructure:"include_requests"`                   // 是否返回今天的请求数（取整）
+	IncludeUpstream    bool    `mapstructure:"include_upstream"`                   // 是否返回最近5分钟的上游健康状况
+}
@@ -0,0 +1,164 @@
+/**
+  @author: Hanhai
+  @desc: 程序版本历史，SaveVersion切换版本时记录，降级到旧版本程序前可以将数据目录的版本号回滚到上一个版本
+**/
+
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"time"
+)
+
+// 版本历史表名
+const versionHistoryTableName = "version_history"
+
+// ErrVersionRollbackDisabled 未开启版本回滚时拒绝回滚
+var ErrVersionRollbackDisabled = errors.New("未开启版本回滚，请先在配置中设置allow_version_rollback")
+
+// ErrNoPreviousVersion 版本历史中没有可以回滚到的版本
+var ErrNoPreviousVersion = errors.New("版本历史中没有上一个版本")
+
+// VersionRecord 一条版本历史记录
+type VersionRecord struct {
+	Version    string `json:"version"`     // 程序版本号
+	RecordedAt int64  `json:"recorded_at"` // 切换到该版本的时间（Unix秒）
+}
+
+// initVersionHistoryTable 创建版本历史表
+func initVersionHistoryTable() error {
+	query := `CREATE TABLE IF NOT EXISTS ` + versionHistoryTableName + ` (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version TEXT NOT NULL,
+		recorded_at INTEGER NOT NULL
+	)`
+	if _, err := db.Exec(query); err != nil {
+		logger.Error("创建版本历史表失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// recordVersionHistory 版本号与最近一条历史记录不同时追加记录
+// 历史为空时先补记数据库中原有的版本号，使升级前的版本也可以回滚
+func recordVersionHistory(previous, version string) error {
+	var last string
+	err := db.QueryRow("SELECT version FROM " + versionHistoryTableName + " ORDER BY id DESC LIMIT 1").Scan(&last)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == sql.ErrNoRows && previous != "" && previous != version {
+		if _, err := db.Exec("INSERT INTO "+versionHistoryTableName+" (version, recorded_at) VALUES (?, ?)", previous, 0); err != nil {
+			return err
+		}
+		last = previous
+	}
+	if last == version {
+		return nil
+	}
+	_, err = db.Exec("INSERT INTO "+versionHistoryTableName+" (version, recorded_at) VALUES (?, ?)", version, time.Now().Unix())
+	return err
+}
+
+// GetVersionHistory 获取版本历史，按时间从新到旧排列
+func GetVersionHistory() ([]VersionRecord, error) {
+	if db == nil {
+		return nil, errors.New("数据库连接未初始化，请先调用InitConfigDB")
+	}
+
+	rows, err := db.Query("SELECT version, recorded_at FROM " + versionHistoryTableName + " ORDER BY id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("查询版本历史失败: %w", err)
+	}
+	defer rows.Close()
+
+	records := make([]VersionRecord, 0)
+	for rows.Next() {
+		var record VersionRecord
+		if err := rows.Scan(&record.Version, &record.RecordedAt); err != nil {
+			return nil, fmt.Errorf("读取版本历史失败: %w", err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// GetPreviousVersion 获取当前版本号和版本历史中可以回滚到的上一个版本，没有上一个版本时返回ErrNoPreviousVersion
+func GetPreviousVersion() (string, string, error) {
+	if db == nil {
+		return "", "", errors.New("数据库连接未初始化，请先调用InitConfigDB")
+	}
+
+	current, _ := readConfigValue("version")
+	var previous string
+	err := db.QueryRow(
+		"SELECT version FROM "+versionHistoryTableName+" WHERE version <> ? ORDER BY id DESC LIMIT 1",
+		current,
+	).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return current, "", ErrNoPreviousVersion
+	}
+	if err != nil {
+		return current, "", fmt.Errorf("查询上一个版本失败: %w", err)
+	}
+	return current, previous, nil
+}
+
+// RollbackVersion 将数据库中的版本号回滚到版本历史中的上一个版本，并删除之后的历史记录，然后重新加载配置
+// 只回滚版本号，不修改配置、密钥和数据库结构版本；需要开启App.AllowVersionRollback
+func RollbackVersion() error {
+	if db == nil {
+		return errors.New("数据库连接未初始化，请先调用InitConfigDB")
+	}
+	if cfg := GetConfig(); cfg == nil || !cfg.App.AllowVersionRollback {
+		return ErrVersionRollbackDisabled
+	}
+	if err := CheckWritable(); err != nil {
+		return err
+	}
+
+	current, previous, err := GetPreviousVersion()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始回滚版本事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 删除上一个版本之后的所有历史记录，再次回滚时继续向前回滚
+	_, err = tx.Exec(
+		"DELETE FROM "+versionHistoryTableName+" WHERE id > (SELECT MAX(id) FROM "+versionHistoryTableName+" WHERE version = ?)",
+		previous,
+	)
+	if err != nil {
+		return fmt.Errorf("删除版本历史失败: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE "+configTableName+" SET value = ? WHERE key = 'version'", previous); err != nil {
+		return fmt.Errorf("更新版本号失败: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交回滚版本事务失败: %w", err)
+	}
+
+	dataVersionStatusLock.Lock()
+	dataVersionStatus.DataVersion = normalizeVersion(previous)
+	dataVersionStatusLock.Unlock()
+
+	logger.Warn("审计: 数据目录版本号已从 %s 回滚到 %s", displayVersion(current), previous)
+
+	// 重新加载配置并更新应用标题中的版本号
+	cfg, err := LoadConfigFromDB()
+	if err != nil {
+		return fmt.Errorf("回滚版本后重新加载配置失败: %w", err)
+	}
+	cfg = cfg.Clone()
+	cfg.App.Title = fmt.Sprintf("流动硅基 FlowSilicon %s", normalizeVersion(previous))
+	UpdateConfig(cfg)
+	return nil
+}
@@ -0,0 +1,79 @@
+/**
+  @author: Hanhai
+  @desc: 根据密钥的余额、调用次数和延迟推断自动标签，由密钥管理器每天夜间重新计算
+**/
+
+package key
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"time"
+)
+
+// 自动标签名，保存时加上auto:前缀
+const (
+	AutoTagFree         = "free"
+	AutoTagHighBalance  = "high-balance"
+	AutoTagBattleTested = "battle-tested"
+	AutoTagFast         = "fast"
+)
+
+// 推断自动标签的阈值
+const (
+	// 余额超过该值时标记为high-balance
+	autoTagHighBalance = 10.0
+	// 累计调用超过该次数时标记为battle-tested
+	autoTagBattleTestedCalls = 10000
+	// 最近延迟的P95低于该值时标记为fast
+	autoTagFastLatency = 500 * time.Millisecond
+	// 计算P95至少需要的延迟样本数，样本太少时不标记fast
+	autoTagMinLatencySamples = 20
+)
+
+// 每天重新计算自动标签的时间（统计时区）
+const autoTagSchedule = "30 3 * * *"
+
+// inferAutoTags 推断密钥的自动标签（不带前缀）
+// 跟踪余额且余额已用完的密钥只能调用免费模型，标记为free
+func inferAutoTags(k config.ApiKey) []string {
+	var tags []string
+	if k.IsBalanceTracked() && k.Balance <= 0 {
+		tags = append(tags, AutoTagFree)
+	}
+	if k.Balance > autoTagHighBalance {
+		tags = append(tags, AutoTagHighBalance)
+	}
+	if k.TotalCalls > autoTagBattleTestedCalls {
+		tags = append(tags, AutoTagBattleTested)
+	}
+	if p95, samples := GetKeyLatencyP95(k.Key); samples >= autoTagMinLatencySamples && p95 < autoTagFastLatency {
+		tags = append(tags, AutoTagFast)
+	}
+	return tags
+}
+
+// AutoTagKeys 重新推断所有密钥的自动标签，替换原有的auto:标签，手动设置的标签保持不变，返回新增的自动标签数
+func AutoTagKeys() (int, error) {
+	keys := GetKeyPool().Keys()
+	autoTags := make(map[string][]string, len(keys))
+	for _, k := range keys {
+		if tags := inferAutoTags(k); len(tags) > 0 {
+			autoTags[k.Key] = tags
+		}
+	}
+
+	added, err := config.SetApiKeyAutoTags(autoTags)
+	if err != nil {
+		return added, err
+	}
+	logger.Info("已重新推断 %d 个API密钥的自动标签，新增 %d 个标签", len(keys), added)
+	return added, nil
+}
+
+// runAutoTagKeys 定时任务中重新推断自动标签
+func runAutoTagKeys() {
+	if _, err := AutoTagKeys(); err != nil {
+		logger.Error("推断API密钥的自动标签失败: %v", err)
+	}
+}
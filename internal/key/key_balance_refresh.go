@@ -0,0 +1,141 @@
+/**
+  @author: Hanhai
+  @desc: 启动时后台刷新API密钥余额，限速并按使用频率优先刷新，刷新期间使用上次保存的余额继续提供服务
+**/
+
+package key
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+)
+
+const (
+	// 后台刷新余额的并发数
+	backgroundRefreshConcurrency = 5
+	// 后台刷新余额时相邻两次查询的最小间隔，避免短时间内向上游发送大量请求
+	backgroundRefreshInterval = 100 * time.Millisecond
+)
+
+// BalanceRefreshStatus 后台余额刷新进度
+type BalanceRefreshStatus struct {
+	Running    bool  `json:"running"`     // 是否正在刷新
+	Total      int   `json:"total"`       // 需要刷新的密钥数量
+	Completed  int   `json:"completed"`   // 已完成刷新的密钥数量，包括失败的
+	Failed     int   `json:"failed"`      // 刷新失败的密钥数量
+	StartedAt  int64 `json:"started_at"`  // 开始时间戳
+	FinishedAt int64 `json:"finished_at"` // 完成时间戳，未完成时为0
+}
+
+var (
+	balanceRefreshStatus     BalanceRefreshStatus
+	balanceRefreshStatusLock sync.RWMutex
+)
+
+// StartBackgroundBalanceRefresh 在后台刷新所有自动余额模式密钥的余额，立即返回
+// 最近使用次数多的密钥优先刷新，每个结果返回后立即更新到密钥池
+// 已有后台刷新在进行时返回false
+func StartBackgroundBalanceRefresh() bool {
+	keys := GetKeyPool().Keys()
+
+	// 只刷新自动余额模式的密钥
+	var pending []config.ApiKey
+	for _, k := range keys {
+		if k.IsBalanceAuto() && !k.Delete {
+			pending = append(pending, k)
+		}
+	}
+
+	// 按调用次数和最后使用时间排序，最可能被选中的密钥优先刷新
+	sort.SliceStable(pending, func(i, j int) bool {
+		if pending[i].TotalCalls != pending[j].TotalCalls {
+			return pending[i].TotalCalls > pending[j].TotalCalls
+		}
+		return pending[i].LastUsed > pending[j].LastUsed
+	})
+
+	balanceRefreshStatusLock.Lock()
+	if balanceRefreshStatus.Running {
+		balanceRefreshStatusLock.Unlock()
+		return false
+	}
+	balanceRefreshStatus = BalanceRefreshStatus{
+		Running:   true,
+		Total:     len(pending),
+		StartedAt: time.Now().Unix(),
+	}
+	balanceRefreshStatusLock.Unlock()
+
+	logger.Info("开始在后台刷新 %d 个API密钥的余额，刷新期间使用上次保存的余额", len(pending))
+	go runBackgroundBalanceRefresh(pending)
+	return true
+}
+
+// GetBalanceRefreshStatus 获取后台余额刷新进度
+func GetBalanceRefreshStatus() BalanceRefreshStatus {
+	balanceRefreshStatusLock.RLock()
+	defer balanceRefreshStatusLock.RUnlock()
+	return balanceRefreshStatus
+}
+
+// runBackgroundBalanceRefresh 按顺序限速刷新密钥余额
+func runBackgroundBalanceRefresh(keys []config.ApiKey) {
+	jobs := make(chan config.ApiKey)
+	var wg sync.WaitGroup
+
+	for w := 0; w < backgroundRefreshConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				err := refreshKeyBalance(key)
+				if err != nil {
+					logger.Error("后台刷新: %v", err)
+				}
+
+				balanceRefreshStatusLock.Lock()
+				balanceRefreshStatus.Completed++
+				if err != nil {
+					balanceRefreshStatus.Failed++
+				}
+				balanceRefreshStatusLock.Unlock()
+			}
+		}()
+	}
+
+	// 按优先级顺序分发任务，限制查询频率
+	ticker := time.NewTicker(backgroundRefreshInterval)
+	for i, key := range keys {
+		if i > 0 {
+			<-ticker.C
+		}
+		jobs <- key
+	}
+	ticker.Stop()
+	close(jobs)
+	wg.Wait()
+
+	// 保存更新后的密钥状态
+	if err := config.SaveApiKeys(); err != nil {
+		logger.Error("后台刷新: 保存API密钥状态失败: %v", err)
+	}
+
+	// 从JSON中删除标记为删除的密钥
+	config.RemoveMarkedApiKeys()
+
+	// 重新排序 API 密钥（按照综合得分从高到低）
+	config.SortApiKeysByBalance()
+
+	balanceRefreshStatusLock.Lock()
+	balanceRefreshStatus.Running = false
+	balanceRefreshStatus.FinishedAt = time.Now().Unix()
+	status := balanceRefreshStatus
+	balanceRefreshStatusLock.Unlock()
+
+	logger.Info("后台刷新API密钥余额完成，共 %d 个，失败 %d 个，耗时 %d 秒",
+		status.Total, status.Failed, status.FinishedAt-status.StartedAt)
+}
@@ -0,0 +1,56 @@
+package key
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/mockupstream"
+	"flowsilicon/internal/signing"
+)
+
+func TestCheckKeyBalanceSignsRequest(t *testing.T) {
+	upstream := mockupstream.NewServer()
+	upstream.SetSigning(mockupstream.SigningConfig{Secret: "upstream-secret"})
+	ts := httptest.NewServer(upstream.Handler())
+	defer ts.Close()
+
+	config.SetUpstreamOverride(ts.URL)
+	t.Cleanup(func() { config.SetUpstreamOverride("") })
+
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr bool
+	}{
+		{"签名密钥正确", "upstream-secret", false},
+		{"签名密钥错误", "wrong-secret", true},
+		{"未配置签名", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			if tt.secret != "" {
+				cfg.Providers = []config.ProviderRequestConfig{{
+					Provider: config.DefaultKeyProvider,
+					Signing:  config.RequestSigningConfig{Type: signing.TypeHMACSHA256, Secret: tt.secret},
+				}}
+			}
+			config.UpdateConfig(cfg)
+
+			balance, err := CheckKeyBalance("sk-balance-test")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("模拟上游接受了签名不正确的请求，余额 %v", balance)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CheckKeyBalance 失败: %v", err)
+			}
+			if balance != mockupstream.DefaultBalance {
+				t.Fatalf("余额 = %v，期望 %v", balance, mockupstream.DefaultBalance)
+			}
+		})
+	}
+}
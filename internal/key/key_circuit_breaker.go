@@ -0,0 +1,253 @@
+/**
+  @author: Hanhai
+  @desc: 密钥断路器，密钥连续被上游限流达到设置的次数后断开，断开期间不参与任何策略的选择，断开时间结束后半开只允许一个探测请求，成功则闭合，失败则断开时间翻倍，断开的状态保存到数据库
+**/
+
+package key
+
+import (
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+)
+
+// 断路器的状态
+const (
+	CircuitClosed   = "closed"    // 正常参与选择
+	CircuitOpen     = "open"      // 断开，不参与选择
+	CircuitHalfOpen = "half_open" // 断开时间已结束，允许一个探测请求
+)
+
+const (
+	// 第一次断开的时间
+	circuitInitialBackoff = 30 * time.Second
+	// 未设置时断开时间的最大值（分钟）
+	defaultCircuitMaxBackoffMinutes = 30
+	// 探测请求超过该时间没有结果时允许再次探测
+	circuitProbeTimeout = 5 * time.Minute
+)
+
+// keyCircuit 一个密钥的断路器
+type keyCircuit struct {
+	keyID        int
+	rateLimited  int           // 连续被限流的次数
+	backoff      time.Duration // 当前的断开时间，0表示闭合
+	openUntil    time.Time     // 断开结束的时间
+	probeStarted time.Time     // 半开状态下探测请求开始的时间
+}
+
+var (
+	keyCircuits     = make(map[string]*keyCircuit)
+	keyCircuitMutex sync.Mutex
+)
+
+// getCircuitBreakerThreshold 获取断开前连续被限流的次数，小于等于0表示不启用断路器
+func getCircuitBreakerThreshold() int {
+	if cfg := config.GetConfig(); cfg != nil {
+		return cfg.App.CircuitBreakerThreshold
+	}
+	return 0
+}
+
+// getCircuitMaxBackoff 获取断开时间的最大值
+func getCircuitMaxBackoff() time.Duration {
+	minutes := defaultCircuitMaxBackoffMinutes
+	if cfg := config.GetConfig(); cfg != nil && cfg.App.CircuitBreakerMaxBackoffMinutes > 0 {
+		minutes = cfg.App.CircuitBreakerMaxBackoffMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// stateAt 获取断路器在now时的状态
+func (c *keyCircuit) stateAt(now time.Time) string {
+	switch {
+	case c.backoff == 0:
+		return CircuitClosed
+	case now.Before(c.openUntil):
+		return CircuitOpen
+	default:
+		return CircuitHalfOpen
+	}
+}
+
+// openLocked 断开断路器，backoff为本次的断开时间（已加锁）
+func (c *keyCircuit) openLocked(backoff time.Duration, now time.Time) config.KeyCircuitState {
+	if maxBackoff := getCircuitMaxBackoff(); backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	c.backoff = backoff
+	c.openUntil = now.Add(backoff)
+	c.probeStarted = time.Time{}
+	return config.KeyCircuitState{
+		KeyID:          c.keyID,
+		RateLimited:    c.rateLimited,
+		BackoffSeconds: int64(backoff / time.Second),
+		OpenUntil:      c.openUntil.Unix(),
+	}
+}
+
+// filterOpenCircuitKeys 过滤掉断路器断开的密钥和正在探测的半开密钥，未启用断路器时原样返回
+func filterOpenCircuitKeys(keys []config.ApiKey) []config.ApiKey {
+	if getCircuitBreakerThreshold() <= 0 {
+		return keys
+	}
+
+	keyCircuitMutex.Lock()
+	defer keyCircuitMutex.Unlock()
+
+	if len(keyCircuits) == 0 {
+		return keys
+	}
+	now := time.Now()
+	available := make([]config.ApiKey, 0, len(keys))
+	for _, k := range keys {
+		circuit, ok := keyCircuits[k.Key]
+		if ok {
+			state := circuit.stateAt(now)
+			if state == CircuitOpen {
+				continue
+			}
+			if state == CircuitHalfOpen && !circuit.probeStarted.IsZero() && now.Sub(circuit.probeStarted) < circuitProbeTimeout {
+				continue
+			}
+		}
+		available = append(available, k)
+	}
+	return available
+}
+
+// markCircuitProbe 选中半开状态的密钥时记录探测请求开始，结果返回前不再选择该密钥
+func markCircuitProbe(apiKey string) {
+	keyCircuitMutex.Lock()
+	defer keyCircuitMutex.Unlock()
+
+	if circuit, ok := keyCircuits[apiKey]; ok && circuit.stateAt(time.Now()) == CircuitHalfOpen {
+		circuit.probeStarted = time.Now()
+		logger.Info("密钥 %s 的断路器半开，发送探测请求", MaskKey(apiKey))
+	}
+}
+
+// recordCircuitResponse 根据上游响应更新密钥的断路器
+// 闭合时连续被限流达到设置的次数后断开，其他响应重新计数；半开时探测请求成功则闭合，密钥原因的失败则断开时间翻倍
+func recordCircuitResponse(apiKey string, category ResponseCategory) {
+	threshold := getCircuitBreakerThreshold()
+	if threshold <= 0 {
+		return
+	}
+	keyID := 0
+	if k, ok := GetKeyPool().Find(apiKey); ok {
+		keyID = k.ID
+	}
+
+	keyCircuitMutex.Lock()
+	now := time.Now()
+	circuit, ok := keyCircuits[apiKey]
+	if !ok {
+		if category != CategoryRateLimited {
+			keyCircuitMutex.Unlock()
+			return
+		}
+		circuit = &keyCircuit{}
+		keyCircuits[apiKey] = circuit
+	}
+	if keyID > 0 {
+		circuit.keyID = keyID
+	}
+
+	switch circuit.stateAt(now) {
+	case CircuitClosed:
+		if category != CategoryRateLimited {
+			delete(keyCircuits, apiKey)
+			keyCircuitMutex.Unlock()
+			return
+		}
+		circuit.rateLimited++
+		if circuit.rateLimited < threshold {
+			keyCircuitMutex.Unlock()
+			return
+		}
+		state := circuit.openLocked(circuitInitialBackoff, now)
+		keyCircuitMutex.Unlock()
+		logger.Warn("密钥 %s 连续 %d 次被上游限流，断路器断开 %s", MaskKey(apiKey), state.RateLimited, circuitInitialBackoff)
+		saveKeyCircuitState(state)
+
+	case CircuitOpen:
+		// 断开前已经发出的请求返回的结果，不改变断路器
+		keyCircuitMutex.Unlock()
+
+	case CircuitHalfOpen:
+		if OutcomeOf(category) == OutcomeKeyFailure {
+			state := circuit.openLocked(circuit.backoff*2, now)
+			keyCircuitMutex.Unlock()
+			logger.Warn("密钥 %s 的探测请求失败（%s），断路器再次断开 %s", MaskKey(apiKey), category, time.Duration(state.BackoffSeconds)*time.Second)
+			saveKeyCircuitState(state)
+			return
+		}
+		delete(keyCircuits, apiKey)
+		keyCircuitMutex.Unlock()
+		logger.Info("密钥 %s 的探测请求成功，断路器闭合", MaskKey(apiKey))
+		if err := config.DeleteKeyCircuitState(circuit.keyID); err != nil {
+			logger.Error("删除密钥断路器状态失败: %v", err)
+		}
+	}
+}
+
+// recordCircuitRequestError 发送请求失败时更新密钥的断路器，只有半开时的探测请求失败会再次断开
+func recordCircuitRequestError(apiKey string) {
+	if getCircuitBreakerThreshold() <= 0 {
+		return
+	}
+
+	keyCircuitMutex.Lock()
+	circuit, ok := keyCircuits[apiKey]
+	if !ok || circuit.stateAt(time.Now()) != CircuitHalfOpen {
+		keyCircuitMutex.Unlock()
+		return
+	}
+	state := circuit.openLocked(circuit.backoff*2, time.Now())
+	keyCircuitMutex.Unlock()
+	logger.Warn("密钥 %s 的探测请求发送失败，断路器再次断开 %s", MaskKey(apiKey), time.Duration(state.BackoffSeconds)*time.Second)
+	saveKeyCircuitState(state)
+}
+
+// saveKeyCircuitState 保存断开的断路器状态，重启后继续生效
+func saveKeyCircuitState(state config.KeyCircuitState) {
+	if err := config.SaveKeyCircuitState(state); err != nil {
+		logger.Error("保存密钥断路器状态失败: %v", err)
+	}
+}
+
+// loadKeyCircuits 从数据库加载断开的断路器，已删除的密钥的状态一并清理
+func loadKeyCircuits() {
+	states, err := config.LoadKeyCircuitStates()
+	if err != nil {
+		logger.Error("加载密钥断路器状态失败: %v", err)
+		return
+	}
+
+	loaded := 0
+	keyCircuitMutex.Lock()
+	for _, state := range states {
+		k, ok := config.GetApiKeyByID(state.KeyID)
+		if !ok || state.BackoffSeconds <= 0 {
+			if err := config.DeleteKeyCircuitState(state.KeyID); err != nil {
+				logger.Error("删除密钥断路器状态失败: %v", err)
+			}
+			continue
+		}
+		keyCircuits[k.Key] = &keyCircuit{
+			keyID:       state.KeyID,
+			rateLimited: state.RateLimited,
+			backoff:     time.Duration(state.BackoffSeconds) * time.Second,
+			openUntil:   time.Unix(state.OpenUntil, 0),
+		}
+		loaded++
+	}
+	keyCircuitMutex.Unlock()
+
+	if loaded > 0 {
+		logger.Info("已加载 %d 个密钥的断路器状态", loaded)
+	}
+}
@@ -0,0 +1,83 @@
+package key
+
+import (
+	"testing"
+	"time"
+
+	"flowsilicon/internal/config"
+)
+
+// 断路器断开的密钥不能从任何选择入口返回
+func TestOpenCircuitKeysNotSelected(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.CircuitBreakerThreshold = 1
+	config.UpdateConfig(cfg)
+	config.ReplaceApiKeys([]config.ApiKey{
+		{ID: 1, Key: "sk-circuit-open", Balance: 100},
+		{ID: 2, Key: "sk-circuit-closed", Balance: 10},
+	})
+
+	keyCircuitMutex.Lock()
+	keyCircuits["sk-circuit-open"] = &keyCircuit{keyID: 1, backoff: time.Minute, openUntil: time.Now().Add(time.Minute)}
+	keyCircuitMutex.Unlock()
+	t.Cleanup(func() {
+		keyCircuitMutex.Lock()
+		delete(keyCircuits, "sk-circuit-open")
+		keyCircuitMutex.Unlock()
+		SetKeyMode(KeyModeAll, nil)
+		config.ReplaceApiKeys(nil)
+		config.UpdateConfig(&config.Config{})
+	})
+
+	entryPoints := []struct {
+		name string
+		mode KeyMode
+		keys []string
+		pick func() (string, error)
+	}{
+		{name: "GetOptimalApiKeyWithRoundRobin", pick: GetOptimalApiKeyWithRoundRobin},
+		{name: "GetOptimalApiKeyWithScore", pick: func() (string, error) {
+			key, _, err := GetOptimalApiKeyWithScore()
+			return key, err
+		}},
+		{name: "GetKeyFromGroup", pick: func() (string, error) { return GetKeyFromGroup(config.DefaultKeyGroup) }},
+		{name: "GetModelSpecificKey", pick: func() (string, error) {
+			key, _, err := GetModelSpecificKey("test-model")
+			return key, err
+		}},
+		{name: "GetNextApiKey/all", mode: KeyModeAll, pick: GetNextApiKey},
+		{name: "GetNextApiKey/selected", mode: KeyModeSelected, keys: []string{"sk-circuit-open", "sk-circuit-closed"}, pick: GetNextApiKey},
+		{name: "SelectKeyWithDecision", pick: func() (string, error) {
+			key, _, err := SelectKeyWithDecision("chat", "test-model", 0, nil)
+			return key, err
+		}},
+	}
+
+	for _, tt := range entryPoints {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mode != "" {
+				if err := SetKeyMode(tt.mode, tt.keys); err != nil {
+					t.Fatal(err)
+				}
+				defer SetKeyMode(KeyModeAll, nil)
+			}
+			for i := 0; i < 4; i++ {
+				key, err := tt.pick()
+				if err != nil {
+					t.Fatalf("select: %v", err)
+				}
+				if key == "sk-circuit-open" {
+					t.Fatalf("selected the key with an open circuit")
+				}
+			}
+		})
+	}
+
+	// 单个密钥模式下选中的密钥断路器断开时返回错误
+	if err := SetKeyMode(KeyModeSingle, []string{"sk-circuit-open"}); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := GetNextApiKey(); err == nil {
+		t.Errorf("GetNextApiKey in single mode = %s, want an error", key)
+	}
+}
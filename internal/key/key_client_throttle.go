@@ -0,0 +1,138 @@
+/**
+  @author: Hanhai
+  @desc: 客户端错误率限流，最近24小时错误率超过阈值的客户端在一段时间内使用更低的每分钟请求数上限
+**/
+
+package key
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/notify"
+)
+
+const (
+	// 未设置时计算错误率所需的最少请求数
+	defaultAbuseThrottleMinRequests = 20
+	// 未设置时被限流的客户端每分钟最多请求数
+	defaultAbuseThrottleRPM = 10
+	// 未设置时限流持续的时间（分钟）
+	defaultAbuseThrottleMinutes = 30
+)
+
+// clientThrottle 一个被限流的客户端
+type clientThrottle struct {
+	until  time.Time
+	window config.RateLimitWindow
+}
+
+var (
+	clientThrottles     = make(map[string]*clientThrottle)
+	clientThrottleMutex sync.Mutex
+)
+
+// abuseThrottleSettings 获取自动限流的配置，未启用时返回false
+func abuseThrottleSettings() (float64, int, int, time.Duration, bool) {
+	cfg := config.GetConfig()
+	if cfg == nil || cfg.App.AbuseThrottleErrorRate <= 0 {
+		return 0, 0, 0, 0, false
+	}
+	minRequests := cfg.App.AbuseThrottleMinRequests
+	if minRequests <= 0 {
+		minRequests = defaultAbuseThrottleMinRequests
+	}
+	rpm := cfg.App.AbuseThrottleRPM
+	if rpm <= 0 {
+		rpm = defaultAbuseThrottleRPM
+	}
+	minutes := cfg.App.AbuseThrottleMinutes
+	if minutes <= 0 {
+		minutes = defaultAbuseThrottleMinutes
+	}
+	return cfg.App.AbuseThrottleErrorRate, minRequests, rpm, time.Duration(minutes) * time.Minute, true
+}
+
+// checkClientThrottle 客户端的错误率超过阈值且未被限流时开始限流并发送通知
+// 超出数量上限统一计入other的客户端不限流，避免影响其他正常客户端
+func checkClientThrottle(stats ClientErrorStats) {
+	threshold, minRequests, rpm, duration, enabled := abuseThrottleSettings()
+	if !enabled || stats.Client == config.ClientUsageOther || stats.Requests < minRequests || stats.ErrorRate < threshold {
+		return
+	}
+
+	clientThrottleMutex.Lock()
+	if throttle, ok := clientThrottles[stats.Client]; ok && time.Now().Before(throttle.until) {
+		clientThrottleMutex.Unlock()
+		return
+	}
+	until := time.Now().Add(duration)
+	clientThrottles[stats.Client] = &clientThrottle{
+		until:  until,
+		window: config.RateLimitWindow{Limit: rpm},
+	}
+	clientThrottleMutex.Unlock()
+
+	message := fmt.Sprintf("客户端 %s 最近24小时的错误率为 %.1f%%（%d/%d），已限流为每分钟 %d 次请求，持续到 %s",
+		stats.Client, stats.ErrorRate*100, stats.Errors, stats.Requests, rpm, until.Format("2006-01-02 15:04:05"))
+	logger.Warn("%s", message)
+	go notify.Send(notify.EventClientThrottled, message, map[string]interface{}{
+		"client":          stats.Client,
+		"error_rate":      stats.ErrorRate,
+		"errors":          stats.Errors,
+		"requests":        stats.Requests,
+		"rpm":             rpm,
+		"throttled_until": until.Unix(),
+	})
+}
+
+// AllowClientRequest 检查被限流的客户端当前窗口内是否还能发送请求，允许时计入用量
+// 未被限流的客户端总是允许；不允许时返回距离下一个窗口的时间
+func AllowClientRequest(client string) (bool, time.Duration) {
+	clientThrottleMutex.Lock()
+	defer clientThrottleMutex.Unlock()
+
+	throttle, ok := clientThrottles[client]
+	if !ok {
+		return true, 0
+	}
+	if !time.Now().Before(throttle.until) {
+		delete(clientThrottles, client)
+		return true, 0
+	}
+	if throttle.window.Available() <= 0 {
+		return false, throttle.window.Remaining()
+	}
+	throttle.window.Add(1)
+	return true, 0
+}
+
+// getClientThrottle 获取客户端限流的结束时间，未被限流时返回false
+func getClientThrottle(client string) (time.Time, bool) {
+	clientThrottleMutex.Lock()
+	defer clientThrottleMutex.Unlock()
+
+	throttle, ok := clientThrottles[client]
+	if !ok || !time.Now().Before(throttle.until) {
+		return time.Time{}, false
+	}
+	return throttle.until, true
+}
+
+// ClearClientThrottle 手动解除客户端的限流并清空其错误率统计，客户端未被限流时返回false
+func ClearClientThrottle(client string) bool {
+	clientThrottleMutex.Lock()
+	throttle, ok := clientThrottles[client]
+	delete(clientThrottles, client)
+	clientThrottleMutex.Unlock()
+
+	resetClientOutcomes(client)
+	if !ok || !time.Now().Before(throttle.until) {
+		return false
+	}
+	logger.Warn("已手动解除客户端 %s 的限流", client)
+	return true
+}
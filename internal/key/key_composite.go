@@ -0,0 +1,131 @@
+/**
+  @author: Hanhai
+  @desc: 综合加权策略（策略9），按归一化余额、成功率和剩余RPM、TPM余量加权打分，选择得分最高的密钥，得分相同时轮询
+**/
+
+package key
+
+import (
+	"time"
+
+	"flowsilicon/internal/common"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+)
+
+const (
+	// 还没有RPM或TPM统计数据的密钥在该维度上的得分，避免新密钥因为没有数据永远不被选中
+	compositeNeutralScore = 0.5
+	// 得分差距小于该值时视为相同，在这些密钥之间轮询
+	compositeScoreEpsilon = 1e-6
+)
+
+// getCompositeKey 获取综合加权得分最高的密钥
+func getCompositeKey(activeKeys []config.ApiKey, modelName string) (string, error) {
+	if len(activeKeys) == 0 {
+		return "", common.ErrNoActiveKeys
+	}
+
+	cfg := config.GetConfig()
+	var candidates []config.ApiKey
+	for _, k := range activeKeys {
+		if k.HasSufficientBalance(cfg.App.MinBalanceThreshold) {
+			candidates = append(candidates, k)
+		}
+	}
+	if len(candidates) == 0 {
+		return getAnyAvailableKey(activeKeys)
+	}
+
+	weights := cfg.App.CompositeWeights.Normalized()
+	scores := compositeKeyScores(candidates, weights)
+
+	bestScore := -1.0
+	for _, score := range scores {
+		if score > bestScore {
+			bestScore = score
+		}
+	}
+	var bestKeys []config.ApiKey
+	for i, k := range candidates {
+		if bestScore-scores[i] < compositeScoreEpsilon {
+			bestKeys = append(bestKeys, k)
+		}
+	}
+
+	logger.Info("综合加权策略: 权重 余额=%.2f 成功率=%.2f RPM=%.2f TPM=%.2f, 最高分=%.4f, 共%d个密钥",
+		weights.Balance, weights.Success, weights.RPM, weights.TPM, bestScore, len(bestKeys))
+
+	strategyKey := "composite"
+	if modelName != "" {
+		strategyKey = "composite_" + modelName
+	}
+	selectedKey := selectKeyByRoundRobin(bestKeys, strategyKey)
+	logger.Info("综合加权策略选择密钥: %s", utils.MaskKey(selectedKey))
+
+	config.UpdateApiKeyLastUsed(selectedKey, time.Now().Unix())
+	return selectedKey, nil
+}
+
+// compositeKeyScores 计算每个密钥的综合加权得分（0-1），与keys的顺序对应
+// 余额按候选密钥中的最高余额归一化，未跟踪余额的密钥按固定比例计算；
+// 没有调用记录的密钥成功率按100%计算；设置了上限的RPM、TPM按剩余比例计算，未设置上限时按候选密钥中的最高用量比较
+func compositeKeyScores(keys []config.ApiKey, weights config.CompositeWeights) []float64 {
+	var maxBalance float64
+	var maxRPM, maxTPM int
+	for _, k := range keys {
+		if k.IsBalanceTracked() && k.Balance > maxBalance {
+			maxBalance = k.Balance
+		}
+		if k.RPM.Current() > maxRPM {
+			maxRPM = k.RPM.Current()
+		}
+		if k.TPM.Current() > maxTPM {
+			maxTPM = k.TPM.Current()
+		}
+	}
+
+	scores := make([]float64, len(keys))
+	for i, k := range keys {
+		balanceScore := clampScore(k.BalanceRatio(maxBalance))
+
+		successScore := 1.0
+		if k.TotalCalls > 0 {
+			successScore = clampScore(k.SuccessRate)
+		}
+
+		rpm, tpm := currentLimitWindows(k)
+		scores[i] = balanceScore*weights.Balance +
+			successScore*weights.Success +
+			windowHeadroomScore(rpm, maxRPM)*weights.RPM +
+			windowHeadroomScore(tpm, maxTPM)*weights.TPM
+	}
+	return scores
+}
+
+// windowHeadroomScore 计算RPM或TPM窗口的剩余余量得分，还没有统计数据时返回中间值
+// window的Limit需要是当前配置的上限，maxUsed为候选密钥中的最高用量，用于没有设置上限的窗口
+func windowHeadroomScore(window config.RateLimitWindow, maxUsed int) float64 {
+	if window.WindowStart.IsZero() {
+		return compositeNeutralScore
+	}
+	if window.Limit > 0 {
+		return clampScore(float64(window.Available()) / float64(window.Limit))
+	}
+	if maxUsed <= 0 {
+		return 1
+	}
+	return clampScore(1 - float64(window.Current())/float64(maxUsed))
+}
+
+// clampScore 将得分限制在0到1之间
+func clampScore(score float64) float64 {
+	if score < 0 {
+		return 0
+	}
+	if score > 1 {
+		return 1
+	}
+	return score
+}
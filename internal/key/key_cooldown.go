@@ -0,0 +1,94 @@
+/**
+  @author: Hanhai
+  @desc: 密钥冷却，上游对密钥返回429后在冷却时间内选择密钥时跳过该密钥，冷却只保存在内存中，不修改密钥的启用状态
+**/
+
+package key
+
+import (
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+)
+
+// 未设置时密钥被上游限流后的冷却时间（秒）
+const defaultRateLimitCooldownSeconds = 60
+
+var (
+	// 各密钥冷却结束的时间
+	keyCooldowns     = make(map[string]time.Time)
+	keyCooldownMutex sync.Mutex
+)
+
+// getRateLimitCooldown 获取密钥被上游限流后的默认冷却时间
+func getRateLimitCooldown() time.Duration {
+	seconds := defaultRateLimitCooldownSeconds
+	if cfg := config.GetConfig(); cfg != nil && cfg.App.RateLimitCooldownSeconds > 0 {
+		seconds = cfg.App.RateLimitCooldownSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// CoolDownKey 将被上游限流的密钥标记为冷却，duration为上游要求等待的时间，小于等于0时使用设置的冷却时间
+// 密钥已经在冷却且结束时间更晚时保留原来的结束时间
+func CoolDownKey(apiKey string, duration time.Duration) {
+	if duration <= 0 {
+		duration = getRateLimitCooldown()
+	}
+	until := time.Now().Add(duration)
+
+	keyCooldownMutex.Lock()
+	defer keyCooldownMutex.Unlock()
+
+	// 顺便清理已经结束的冷却
+	now := time.Now()
+	for k, end := range keyCooldowns {
+		if !end.After(now) {
+			delete(keyCooldowns, k)
+		}
+	}
+	if end, ok := keyCooldowns[apiKey]; ok && end.After(until) {
+		return
+	}
+	keyCooldowns[apiKey] = until
+	logger.Warn("密钥 %s 被上游限流，冷却 %s", utils.MaskKey(apiKey), duration.Round(time.Second))
+}
+
+// GetKeyCooldown 获取密钥剩余的冷却时间，不在冷却中时返回0
+func GetKeyCooldown(apiKey string) time.Duration {
+	keyCooldownMutex.Lock()
+	defer keyCooldownMutex.Unlock()
+
+	if end, ok := keyCooldowns[apiKey]; ok {
+		if remaining := time.Until(end); remaining > 0 {
+			return remaining
+		}
+	}
+	return 0
+}
+
+// filterCoolingDownKeys 过滤掉正在冷却的密钥
+// 所有密钥都在冷却时返回原列表，避免请求在本地直接失败
+func filterCoolingDownKeys(keys []config.ApiKey) []config.ApiKey {
+	keyCooldownMutex.Lock()
+	defer keyCooldownMutex.Unlock()
+
+	if len(keyCooldowns) == 0 {
+		return keys
+	}
+	now := time.Now()
+	available := make([]config.ApiKey, 0, len(keys))
+	for _, k := range keys {
+		if end, ok := keyCooldowns[k.Key]; !ok || !end.After(now) {
+			available = append(available, k)
+		}
+	}
+	if len(available) == 0 && len(keys) > 0 {
+		logger.Warn("所有可用密钥都在限流冷却中，忽略冷却")
+		return keys
+	}
+	return available
+}
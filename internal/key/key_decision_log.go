@@ -0,0 +1,317 @@
+/**
+  @author: Hanhai
+  @desc: 密钥选择决策日志，按采样比例把每次选择的策略、候选密钥的指标和最终结果以NDJSON格式异步写入数据目录，用于离线调整选择策略
+**/
+
+package key
+
+import (
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DecisionLogSchemaVersion 决策日志每行记录的格式版本，字段含义改变或删除字段时递增，只新增字段时不变
+const DecisionLogSchemaVersion = 1
+
+const (
+	// 决策日志的文件名，轮转后的文件名为decisions_时间.ndjson，时间精确到毫秒，避免同一秒内轮转时覆盖
+	decisionLogPrefix = "decisions"
+	decisionLogExt    = ".ndjson"
+	// 未设置时单个日志文件的最大大小（MB）
+	defaultDecisionLogMaxSizeMB = 10
+	// 未设置时保留的轮转文件数量
+	defaultDecisionLogMaxFiles = 5
+	// 等待写入的记录数上限，超出时丢弃新记录，不阻塞请求
+	decisionLogQueueSize = 1024
+)
+
+// DecisionCandidate 参与选择的密钥在选择时的指标
+type DecisionCandidate struct {
+	ID          int        `json:"id"`
+	Key         string     `json:"key"` // 脱敏后的密钥
+	Group       string     `json:"group,omitempty"`
+	Balance     float64    `json:"balance"`
+	SuccessRate float64    `json:"success_rate"`
+	RPM         int        `json:"rpm"` // 当前窗口内的请求数
+	TPM         int        `json:"tpm"` // 当前窗口内的令牌数
+	Score       float64    `json:"score"`
+	Metrics     KeyMetrics `json:"metrics"`
+}
+
+// Decision 一次密钥选择的完整记录，即决策日志中的一行
+// 隐私模式下不记录由请求内容推算的字段（预估令牌数），任何模式下都不记录客户端身份和请求内容
+type Decision struct {
+	Schema        int                 `json:"schema"`
+	Time          int64               `json:"time"` // 选择密钥的时间（Unix毫秒）
+	RequestType   string              `json:"request_type"`
+	Model         string              `json:"model,omitempty"`
+	TokenEstimate int                 `json:"token_estimate,omitempty"`
+	Strategy      string              `json:"strategy,omitempty"`
+	Candidates    []DecisionCandidate `json:"candidates"`
+	ChosenID      int                 `json:"chosen_id,omitempty"`
+	Chosen        string              `json:"chosen,omitempty"` // 脱敏后的选中密钥
+	Error         string              `json:"error,omitempty"`  // 选择失败的原因
+	Outcome       string              `json:"outcome"`          // 上游响应的分类，或request_error、selection_failed
+	LatencyMs     int64               `json:"latency_ms"`       // 从选择密钥到得到结果的时间
+
+	selectedAt time.Time
+	finished   atomic.Bool
+}
+
+// DecisionLogStatus 决策日志的运行状态
+type DecisionLogStatus struct {
+	Enabled       bool    `json:"enabled"`
+	Until         int64   `json:"until,omitempty"` // 自动关闭的时间（Unix秒）
+	SampleRate    float64 `json:"sample_rate"`
+	PrivacyMode   bool    `json:"privacy_mode"`
+	SchemaVersion int     `json:"schema_version"`
+	Path          string  `json:"path"`
+	Written       int64   `json:"written"` // 本次开启后写入的记录数
+	Dropped       int64   `json:"dropped"` // 写入队列已满被丢弃的记录数
+}
+
+var (
+	decisionLogDir     string
+	decisionLogDirMu   sync.RWMutex
+	decisionLogUntil   atomic.Int64 // 自动关闭的时间（Unix纳秒），0表示未开启
+	decisionLogWritten atomic.Int64
+	decisionLogDropped atomic.Int64
+	decisionLogQueue   chan *Decision
+	decisionLogOnce    sync.Once
+)
+
+// SetDecisionLogDir 设置决策日志所在的目录
+func SetDecisionLogDir(dir string) {
+	decisionLogDirMu.Lock()
+	decisionLogDir = dir
+	decisionLogDirMu.Unlock()
+}
+
+// getDecisionLogDir 获取决策日志所在的目录
+func getDecisionLogDir() string {
+	decisionLogDirMu.RLock()
+	defer decisionLogDirMu.RUnlock()
+	return decisionLogDir
+}
+
+// EnableDecisionLog 开启决策日志，duration后自动关闭，程序重启后不会保持开启
+func EnableDecisionLog(duration time.Duration) error {
+	if getDecisionLogDir() == "" {
+		return fmt.Errorf("未设置决策日志目录")
+	}
+	if duration <= 0 {
+		return fmt.Errorf("开启时长必须大于0")
+	}
+	decisionLogOnce.Do(func() {
+		decisionLogQueue = make(chan *Decision, decisionLogQueueSize)
+		go runDecisionLogWriter()
+	})
+	until := time.Now().Add(duration)
+	decisionLogWritten.Store(0)
+	decisionLogDropped.Store(0)
+	decisionLogUntil.Store(until.UnixNano())
+	logger.Info("已开启密钥选择决策日志，将于 %s 自动关闭", until.Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// DisableDecisionLog 关闭决策日志，已进入写入队列的记录仍会写入
+func DisableDecisionLog() {
+	if decisionLogUntil.Swap(0) != 0 {
+		logger.Info("已关闭密钥选择决策日志")
+	}
+}
+
+// isDecisionLogActive 检查决策日志是否开启，到期时自动关闭
+func isDecisionLogActive() bool {
+	until := decisionLogUntil.Load()
+	if until == 0 {
+		return false
+	}
+	if time.Now().UnixNano() >= until {
+		if decisionLogUntil.CompareAndSwap(until, 0) {
+			logger.Info("密钥选择决策日志已到期，自动关闭")
+		}
+		return false
+	}
+	return true
+}
+
+// decisionLogSampleRate 获取决策日志的采样比例，未设置或超出范围时记录全部请求
+func decisionLogSampleRate() float64 {
+	cfg := config.GetConfig()
+	if cfg == nil || cfg.App.DecisionLogSampleRate <= 0 || cfg.App.DecisionLogSampleRate > 1 {
+		return 1
+	}
+	return cfg.App.DecisionLogSampleRate
+}
+
+// GetDecisionLogStatus 获取决策日志的运行状态
+func GetDecisionLogStatus() DecisionLogStatus {
+	status := DecisionLogStatus{
+		Enabled:       isDecisionLogActive(),
+		SampleRate:    decisionLogSampleRate(),
+		SchemaVersion: DecisionLogSchemaVersion,
+		Written:       decisionLogWritten.Load(),
+		Dropped:       decisionLogDropped.Load(),
+	}
+	if cfg := config.GetConfig(); cfg != nil {
+		status.PrivacyMode = cfg.App.DecisionLogPrivacyMode
+	}
+	if dir := getDecisionLogDir(); dir != "" {
+		status.Path = filepath.Join(dir, decisionLogPrefix+decisionLogExt)
+	}
+	if status.Enabled {
+		status.Until = decisionLogUntil.Load() / int64(time.Second)
+	}
+	return status
+}
+
+// newDecision 决策日志开启且命中采样时创建本次选择的记录，否则返回nil
+func newDecision(requestType string, modelName string, tokenEstimate int, apiKey string, selection keySelection, err error) *Decision {
+	if !isDecisionLogActive() {
+		return nil
+	}
+	if rate := decisionLogSampleRate(); rate < 1 && rand.Float64() >= rate {
+		return nil
+	}
+
+	now := time.Now()
+	decision := &Decision{
+		Schema:      DecisionLogSchemaVersion,
+		Time:        now.UnixMilli(),
+		RequestType: requestType,
+		Model:       modelName,
+		Strategy:    selection.strategy,
+		Candidates:  make([]DecisionCandidate, 0, len(selection.candidates)),
+		selectedAt:  now,
+	}
+	if cfg := config.GetConfig(); cfg == nil || !cfg.App.DecisionLogPrivacyMode {
+		decision.TokenEstimate = tokenEstimate
+	}
+
+	keyMetricsMutex.Lock()
+	for _, k := range selection.candidates {
+		candidate := DecisionCandidate{
+			ID:          k.ID,
+			Key:         utils.MaskKey(k.Key),
+			Group:       k.Group,
+			Balance:     k.Balance,
+			SuccessRate: k.SuccessRate,
+			RPM:         k.RPM.Current(),
+			TPM:         k.TPM.Current(),
+			Score:       k.Score,
+		}
+		if state, ok := keyMetricsStates[k.Key]; ok {
+			candidate.Metrics = state.metrics
+		}
+		if k.Key == apiKey {
+			decision.ChosenID = k.ID
+		}
+		decision.Candidates = append(decision.Candidates, candidate)
+	}
+	keyMetricsMutex.Unlock()
+
+	if apiKey != "" {
+		decision.Chosen = utils.MaskKey(apiKey)
+	}
+	if err != nil {
+		decision.Error = err.Error()
+	}
+	return decision
+}
+
+// FinishDecision 记录本次选择的最终结果并放入写入队列，同一记录只写入一次，decision为nil时忽略
+func FinishDecision(decision *Decision, outcome string) {
+	if decision == nil || !decision.finished.CompareAndSwap(false, true) {
+		return
+	}
+	decision.Outcome = outcome
+	decision.LatencyMs = time.Since(decision.selectedAt).Milliseconds()
+
+	select {
+	case decisionLogQueue <- decision:
+	default:
+		decisionLogDropped.Add(1)
+	}
+}
+
+// decisionLogLimits 获取单个日志文件的最大大小和保留的轮转文件数量
+func decisionLogLimits() (int64, int) {
+	maxSizeMB, maxFiles := defaultDecisionLogMaxSizeMB, defaultDecisionLogMaxFiles
+	if cfg := config.GetConfig(); cfg != nil {
+		if cfg.App.DecisionLogMaxSizeMB > 0 {
+			maxSizeMB = cfg.App.DecisionLogMaxSizeMB
+		}
+		if cfg.App.DecisionLogMaxFiles > 0 {
+			maxFiles = cfg.App.DecisionLogMaxFiles
+		}
+	}
+	return int64(maxSizeMB) * 1024 * 1024, maxFiles
+}
+
+// runDecisionLogWriter 从写入队列中取出记录追加到日志文件，文件超过大小上限时轮转
+func runDecisionLogWriter() {
+	for decision := range decisionLogQueue {
+		line, err := json.Marshal(decision)
+		if err != nil {
+			logger.Error("序列化决策日志失败: %v", err)
+			continue
+		}
+		if err := appendDecisionLine(append(line, '\n')); err != nil {
+			logger.Error("写入决策日志失败: %v", err)
+			continue
+		}
+		decisionLogWritten.Add(1)
+	}
+}
+
+// appendDecisionLine 追加一行记录，写入前文件已达到大小上限时先轮转
+func appendDecisionLine(line []byte) error {
+	dir := getDecisionLogDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建决策日志目录失败: %w", err)
+	}
+	path := filepath.Join(dir, decisionLogPrefix+decisionLogExt)
+
+	maxSize, maxFiles := decisionLogLimits()
+	if info, err := os.Stat(path); err == nil && info.Size()+int64(len(line)) > maxSize {
+		rotated := filepath.Join(dir, fmt.Sprintf("%s_%s%s", decisionLogPrefix, time.Now().Format("20060102_150405.000"), decisionLogExt))
+		if err := os.Rename(path, rotated); err != nil {
+			return fmt.Errorf("轮转决策日志失败: %w", err)
+		}
+		cleanOldDecisionLogs(dir, maxFiles)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开决策日志失败: %w", err)
+	}
+	defer file.Close()
+	_, err = file.Write(line)
+	return err
+}
+
+// cleanOldDecisionLogs 删除超出保留数量的最旧的轮转文件
+func cleanOldDecisionLogs(dir string, maxFiles int) {
+	matches, err := filepath.Glob(filepath.Join(dir, decisionLogPrefix+"_*"+decisionLogExt))
+	if err != nil || len(matches) <= maxFiles {
+		return
+	}
+	// 时间戳在文件名中，按文件名排序即按时间排序
+	sort.Strings(matches)
+	for _, path := range matches[:len(matches)-maxFiles] {
+		if err := os.Remove(path); err != nil {
+			logger.Error("删除旧的决策日志 %s 失败: %v", path, err)
+		}
+	}
+}
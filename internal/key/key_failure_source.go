@@ -0,0 +1,244 @@
+/**
+  @author: Hanhai
+  @desc: 密钥失败来源统计，按小时分桶记录最近24小时内各客户端在每个密钥上引发的错误分类，用于定位导致密钥出错的客户端
+**/
+
+package key
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+)
+
+const (
+	// 失败来源统计的时间窗口（小时）
+	failureSourceWindowHours = 24
+	// 每个密钥最多单独记录的客户端数量，超出的客户端计入other
+	maxFailureSourcesPerKey = 20
+	// 最多单独记录错误率的客户端数量，超出的客户端计入other
+	maxTrackedClients = 500
+)
+
+// categoryCounts 各响应分类的次数
+type categoryCounts map[ResponseCategory]int
+
+// hourlyCategoryCounts 最近24小时按小时分桶的响应分类次数，桶按小时数对窗口大小取余复用
+type hourlyCategoryCounts struct {
+	hours  [failureSourceWindowHours]int64
+	counts [failureSourceWindowHours]categoryCounts
+}
+
+// add 在当前小时的桶中记录一次响应
+func (h *hourlyCategoryCounts) add(now time.Time, category ResponseCategory) {
+	hour := now.Unix() / 3600
+	index := hour % failureSourceWindowHours
+	if h.hours[index] != hour || h.counts[index] == nil {
+		h.hours[index] = hour
+		h.counts[index] = make(categoryCounts)
+	}
+	h.counts[index][category]++
+}
+
+// sum 汇总时间窗口内的响应分类次数
+func (h *hourlyCategoryCounts) sum(now time.Time) categoryCounts {
+	current := now.Unix() / 3600
+	total := make(categoryCounts)
+	for i, hour := range h.hours {
+		if hour <= current-failureSourceWindowHours || hour > current {
+			continue
+		}
+		for category, count := range h.counts[i] {
+			total[category] += count
+		}
+	}
+	return total
+}
+
+// empty 检查时间窗口内是否没有任何记录
+func (h *hourlyCategoryCounts) empty(now time.Time) bool {
+	return len(h.sum(now)) == 0
+}
+
+var (
+	// 各密钥上按客户端记录的失败分类
+	keyFailureSources = make(map[string]map[string]*hourlyCategoryCounts)
+	// 各客户端的全部响应分类，用于计算错误率
+	clientOutcomes     = make(map[string]*hourlyCategoryCounts)
+	failureSourceMutex sync.Mutex
+)
+
+// FailureSource 一个客户端在密钥上引发的失败
+type FailureSource struct {
+	Client     string                   `json:"client"`
+	Failures   int                      `json:"failures"`
+	Categories map[ResponseCategory]int `json:"categories"`
+}
+
+// ClientErrorStats 客户端最近24小时的请求和错误统计
+type ClientErrorStats struct {
+	Client         string                   `json:"client"`
+	Requests       int                      `json:"requests"`
+	Errors         int                      `json:"errors"`     // 客户端原因的错误和限流次数
+	ErrorRate      float64                  `json:"error_rate"` // Errors占Requests的比例
+	Categories     map[ResponseCategory]int `json:"categories"` // 所有失败的分类，包括上游服务错误
+	Throttled      bool                     `json:"throttled"`  // 是否正在被限流
+	ThrottledUntil int64                    `json:"throttled_until,omitempty"`
+}
+
+// isClientAttributable 检查失败是否可以归因于客户端
+// 除客户端原因的错误外，限流通常也是客户端请求过多导致的
+func isClientAttributable(category ResponseCategory) bool {
+	return OutcomeOf(category) == OutcomeClientError || category == CategoryRateLimited
+}
+
+// RecordFailureSource 记录客户端的一次上游响应，失败时同时记录到该密钥的失败来源中
+// 客户端原因的错误会检查客户端的错误率，超过配置的阈值时自动限流
+// 超出数量上限计入other的客户端只用于统计，不按other的错误率限流，避免一个客户端的错误导致其他客户端被限流
+func RecordFailureSource(apiKey string, client string, category ResponseCategory) {
+	if client == "" {
+		return
+	}
+	now := time.Now()
+
+	failureSourceMutex.Lock()
+	clientCounts, trackedAs := trackedCounts(clientOutcomes, client, maxTrackedClients, now)
+	clientCounts.add(now, category)
+	evaluate := isClientAttributable(category) && trackedAs == client && client != config.ClientUsageOther
+	var stats ClientErrorStats
+	if evaluate {
+		stats = clientErrorStatsLocked(client, clientCounts, now)
+	}
+	if category != CategorySuccess && apiKey != "" {
+		sources, ok := keyFailureSources[apiKey]
+		if !ok {
+			sources = make(map[string]*hourlyCategoryCounts)
+			keyFailureSources[apiKey] = sources
+		}
+		counts, _ := trackedCounts(sources, client, maxFailureSourcesPerKey, now)
+		counts.add(now, category)
+	}
+	failureSourceMutex.Unlock()
+
+	if evaluate {
+		checkClientThrottle(stats)
+	}
+}
+
+// trackedCounts 获取客户端的计数和计数所属的名称，记录数达到上限时先清理窗口内没有记录的客户端，仍然超出时计入other
+func trackedCounts(entries map[string]*hourlyCategoryCounts, client string, limit int, now time.Time) (*hourlyCategoryCounts, string) {
+	if counts, ok := entries[client]; ok {
+		return counts, client
+	}
+	if len(entries) >= limit {
+		for name, counts := range entries {
+			if counts.empty(now) {
+				delete(entries, name)
+			}
+		}
+	}
+	if len(entries) >= limit {
+		client = config.ClientUsageOther
+		if counts, ok := entries[client]; ok {
+			return counts, client
+		}
+	}
+	counts := &hourlyCategoryCounts{}
+	entries[client] = counts
+	return counts, client
+}
+
+// clientErrorStatsLocked 计算客户端的错误统计（已加锁）
+func clientErrorStatsLocked(client string, counts *hourlyCategoryCounts, now time.Time) ClientErrorStats {
+	stats := ClientErrorStats{Client: client, Categories: make(map[ResponseCategory]int)}
+	for category, count := range counts.sum(now) {
+		stats.Requests += count
+		if category == CategorySuccess {
+			continue
+		}
+		stats.Categories[category] = count
+		if isClientAttributable(category) {
+			stats.Errors += count
+		}
+	}
+	if stats.Requests > 0 {
+		stats.ErrorRate = float64(stats.Errors) / float64(stats.Requests)
+	}
+	return stats
+}
+
+// GetKeyFailureSources 获取最近24小时在密钥上引发失败的客户端，按失败次数从多到少排列
+func GetKeyFailureSources(apiKey string, limit int) []FailureSource {
+	now := time.Now()
+
+	failureSourceMutex.Lock()
+	result := make([]FailureSource, 0, len(keyFailureSources[apiKey]))
+	for client, counts := range keyFailureSources[apiKey] {
+		source := FailureSource{Client: client, Categories: counts.sum(now)}
+		for _, count := range source.Categories {
+			source.Failures += count
+		}
+		if source.Failures > 0 {
+			result = append(result, source)
+		}
+	}
+	failureSourceMutex.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Failures != result[j].Failures {
+			return result[i].Failures > result[j].Failures
+		}
+		return result[i].Client < result[j].Client
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// GetAbuseStats 获取最近24小时请求数不少于minRequests的客户端，按错误率从高到低排列
+func GetAbuseStats(minRequests int, limit int) []ClientErrorStats {
+	now := time.Now()
+
+	failureSourceMutex.Lock()
+	result := make([]ClientErrorStats, 0, len(clientOutcomes))
+	for client, counts := range clientOutcomes {
+		stats := clientErrorStatsLocked(client, counts, now)
+		if stats.Requests == 0 || stats.Requests < minRequests {
+			continue
+		}
+		result = append(result, stats)
+	}
+	failureSourceMutex.Unlock()
+
+	for i := range result {
+		if until, ok := getClientThrottle(result[i].Client); ok {
+			result[i].Throttled = true
+			result[i].ThrottledUntil = until.Unix()
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ErrorRate != result[j].ErrorRate {
+			return result[i].ErrorRate > result[j].ErrorRate
+		}
+		if result[i].Errors != result[j].Errors {
+			return result[i].Errors > result[j].Errors
+		}
+		return result[i].Client < result[j].Client
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// resetClientOutcomes 清空客户端的错误率统计，手动解除限流时调用，避免下一次错误立即再次触发限流
+// 各密钥上的失败来源保留，用于事后排查
+func resetClientOutcomes(client string) {
+	failureSourceMutex.Lock()
+	delete(clientOutcomes, client)
+	failureSourceMutex.Unlock()
+}
@@ -0,0 +1,85 @@
+package key
+
+import (
+	"fmt"
+	"testing"
+
+	"flowsilicon/internal/config"
+)
+
+// resetFailureSources 清空失败来源和限流状态，并开启自动限流
+func resetFailureSources(t *testing.T) {
+	t.Helper()
+	failureSourceMutex.Lock()
+	keyFailureSources = make(map[string]map[string]*hourlyCategoryCounts)
+	clientOutcomes = make(map[string]*hourlyCategoryCounts)
+	failureSourceMutex.Unlock()
+	clientThrottleMutex.Lock()
+	clientThrottles = make(map[string]*clientThrottle)
+	clientThrottleMutex.Unlock()
+
+	cfg := &config.Config{}
+	cfg.App.AbuseThrottleErrorRate = 0.5
+	cfg.App.AbuseThrottleMinRequests = 5
+	config.UpdateConfig(cfg)
+}
+
+func isThrottled(client string) bool {
+	_, ok := getClientThrottle(client)
+	return ok
+}
+
+func TestOverflowClientsAreNotThrottled(t *testing.T) {
+	resetFailureSources(t)
+
+	// 填满单独记录的客户端，之后的客户端计入other
+	for i := 0; i < maxTrackedClients; i++ {
+		RecordFailureSource("sk-key", fmt.Sprintf("client-%d", i), CategorySuccess)
+	}
+
+	// 超出上限的客户端持续出错，other的错误率很高
+	for i := 0; i < 50; i++ {
+		RecordFailureSource("sk-key", "bad-client", CategoryInvalidRequest)
+	}
+	// 另一个超出上限的正常客户端只发送了一次错误请求
+	RecordFailureSource("sk-key", "good-client", CategoryInvalidRequest)
+
+	for _, client := range []string{"bad-client", "good-client", config.ClientUsageOther} {
+		if isThrottled(client) {
+			t.Errorf("%s must not be throttled on the pooled other bucket", client)
+		}
+	}
+
+	// other仍然出现在统计中
+	found := false
+	for _, stats := range GetAbuseStats(1, 0) {
+		if stats.Client == config.ClientUsageOther {
+			found = true
+			if stats.Errors != 51 {
+				t.Errorf("other bucket errors = %d, want 51", stats.Errors)
+			}
+			if stats.Throttled {
+				t.Error("other bucket must not be reported as throttled")
+			}
+		}
+	}
+	if !found {
+		t.Error("other bucket should still be reported")
+	}
+}
+
+func TestTrackedClientIsThrottled(t *testing.T) {
+	resetFailureSources(t)
+
+	for i := 0; i < 10; i++ {
+		RecordFailureSource("sk-key", "noisy", CategoryInvalidRequest)
+	}
+	RecordFailureSource("sk-key", "quiet", CategorySuccess)
+
+	if !isThrottled("noisy") {
+		t.Error("client with a high error rate should be throttled")
+	}
+	if isThrottled("quiet") {
+		t.Error("client without errors must not be throttled")
+	}
+}
@@ -0,0 +1,354 @@
+/**
+  @author: Hanhai
+  @desc: 密钥分组流量分配，按分组权重选择参与本次请求的密钥，并统计各分组的实际流量
+**/
+
+package key
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+)
+
+// 分组流量统计的时间窗口
+const keyGroupStatsWindow = time.Hour
+
+var (
+	// 各分组最近被选中的时间戳
+	groupSelections     = make(map[string][]int64)
+	groupSelectionsLock sync.Mutex
+)
+
+// KeyGroupStats 密钥分组统计信息
+type KeyGroupStats struct {
+	Name             string  `json:"name"`               // 分组名称
+	Weight           int     `json:"weight"`             // 配置的流量权重
+	KeyCount         int     `json:"key_count"`          // 分组内的密钥数量
+	ActiveKeyCount   int     `json:"active_key_count"`   // 分组内可用的密钥数量
+	RequestsLastHour int     `json:"requests_last_hour"` // 最近一小时被选中的次数
+	Percentage       float64 `json:"percentage"`         // 最近一小时的流量占比
+}
+
+// selectKeyGroupKeys 按分组权重选出参与本次选择的可用密钥，跳过excluded中的密钥、正在冷却和断路器断开的密钥
+// 未配置分组时返回所有可用密钥
+func selectKeyGroupKeys(modelName string, excluded map[string]bool) []config.ApiKey {
+	activeKeys := selectableKeys(excludeKeys(GetKeyPool().ActiveKeys(), excluded))
+
+	groups := config.GetKeyGroupConfigs()
+	if len(groups) == 0 || len(activeKeys) == 0 {
+		return activeKeys
+	}
+
+	selected, keys := pickKeyGroup(groups, activeKeys, modelName, rand.Intn)
+	recordGroupSelection(selected)
+	logger.Debug("分组选择: 模型=%s, 选择分组=%s, 分组内可用密钥数=%d", modelName, selected, len(keys))
+	return keys
+}
+
+// pickKeyGroup 按分组权重选择分组，返回分组名称和分组内的可用密钥，intn用于按权重随机
+// 所属分组未配置的密钥和未设置分组的密钥一起按默认分组计算：配置了默认分组时使用默认分组的权重，
+// 否则在没有权重大于0的可用分组时优先使用，之后才使用权重为0的备用分组
+func pickKeyGroup(groups []config.KeyGroupConfig, activeKeys []config.ApiKey, modelName string, intn func(int) int) (string, []config.ApiKey) {
+	configured := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		configured[group.Name] = true
+	}
+
+	// 按分组归类可用密钥
+	keysByGroup := make(map[string][]config.ApiKey)
+	for _, k := range activeKeys {
+		name := config.GetKeyGroupName(k)
+		if !configured[name] {
+			name = config.DefaultKeyGroup
+		}
+		keysByGroup[name] = append(keysByGroup[name], k)
+	}
+
+	// 计算各分组在该模型下的权重，只考虑有可用密钥的分组
+	type weightedGroup struct {
+		name   string
+		weight int
+	}
+	var candidates []weightedGroup
+	totalWeight := 0
+	for _, group := range groups {
+		if len(keysByGroup[group.Name]) == 0 {
+			continue
+		}
+		weight := group.Weight
+		if modelWeight, ok := group.ModelWeights[modelName]; ok {
+			weight = modelWeight
+		}
+		if weight <= 0 {
+			continue
+		}
+		candidates = append(candidates, weightedGroup{name: group.Name, weight: weight})
+		totalWeight += weight
+	}
+
+	if totalWeight > 0 {
+		// 按权重随机选择分组
+		r := intn(totalWeight)
+		for _, candidate := range candidates {
+			if r < candidate.weight {
+				return candidate.name, keysByGroup[candidate.name]
+			}
+			r -= candidate.weight
+		}
+	}
+
+	// 没有权重大于0的分组可用，先使用未配置分组的密钥，再按配置顺序使用备用分组
+	selected := ""
+	if !configured[config.DefaultKeyGroup] && len(keysByGroup[config.DefaultKeyGroup]) > 0 {
+		selected = config.DefaultKeyGroup
+	} else {
+		for _, group := range groups {
+			if len(keysByGroup[group.Name]) > 0 {
+				selected = group.Name
+				break
+			}
+		}
+	}
+	logger.Debug("没有权重大于0的可用分组，使用备用分组: %s", selected)
+	return selected, keysByGroup[selected]
+}
+
+// GetKeyFromGroup 在指定分组的可用密钥中轮询选择一个，不计入分组流量统计
+func GetKeyFromGroup(group string) (string, error) {
+	pool := GetKeyPool()
+	if err := pool.Err(); err != nil {
+		return "", err
+	}
+	var groupKeys []config.ApiKey
+	for _, k := range selectableKeys(pool.ActiveKeys()) {
+		if config.GetKeyGroupName(k) == group {
+			groupKeys = append(groupKeys, k)
+		}
+	}
+	if len(groupKeys) == 0 {
+		return "", fmt.Errorf("分组 %s 中没有可用的API密钥", group)
+	}
+
+	return selectKeyByRoundRobin(groupKeys, "group_"+group), nil
+}
+
+// recordGroupSelection 记录一次分组选择
+func recordGroupSelection(group string) {
+	now := time.Now().Unix()
+
+	groupSelectionsLock.Lock()
+	defer groupSelectionsLock.Unlock()
+
+	groupSelections[group] = append(pruneGroupSelections(groupSelections[group], now), now)
+}
+
+// pruneGroupSelections 清理统计窗口之外的选择记录
+func pruneGroupSelections(timestamps []int64, now int64) []int64 {
+	cutoff := now - int64(keyGroupStatsWindow/time.Second)
+	i := 0
+	for i < len(timestamps) && timestamps[i] < cutoff {
+		i++
+	}
+	return timestamps[i:]
+}
+
+// GetKeyGroupStats 获取各密钥分组的配置和最近一小时的实际流量分布
+func GetKeyGroupStats() []KeyGroupStats {
+	now := time.Now().Unix()
+
+	// 统计每个分组的密钥数量
+	keyCounts := make(map[string]int)
+	activeCounts := make(map[string]int)
+	keyPool := GetKeyPool()
+	for _, k := range keyPool.Keys() {
+		keyCounts[config.GetKeyGroupName(k)]++
+	}
+	for _, k := range keyPool.ActiveKeys() {
+		activeCounts[config.GetKeyGroupName(k)]++
+	}
+
+	// 汇总最近一小时的选择次数
+	requestCounts := make(map[string]int)
+	totalRequests := 0
+	groupSelectionsLock.Lock()
+	for name, timestamps := range groupSelections {
+		groupSelections[name] = pruneGroupSelections(timestamps, now)
+		requestCounts[name] = len(groupSelections[name])
+		totalRequests += requestCounts[name]
+	}
+	groupSelectionsLock.Unlock()
+
+	// 先列出已配置的分组，再列出未配置但存在密钥的分组
+	var stats []KeyGroupStats
+	seen := make(map[string]bool)
+	addStats := func(name string, weight int) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		item := KeyGroupStats{
+			Name:             name,
+			Weight:           weight,
+			KeyCount:         keyCounts[name],
+			ActiveKeyCount:   activeCounts[name],
+			RequestsLastHour: requestCounts[name],
+		}
+		if totalRequests > 0 {
+			item.Percentage = float64(requestCounts[name]) / float64(totalRequests) * 100
+		}
+		stats = append(stats, item)
+	}
+
+	for _, group := range config.GetKeyGroupConfigs() {
+		addStats(group.Name, group.Weight)
+	}
+
+	var others []string
+	for name := range keyCounts {
+		if !seen[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		addStats(name, 0)
+	}
+
+	return stats
+}
+
+// 估算分组每日消耗时使用的天数
+const groupBurnWindowDays = 7
+
+// KeyGroupUsage 密钥分组的余额和今日用量汇总
+type KeyGroupUsage struct {
+	Name               string  `json:"name"`                 // 分组名称，pool表示全部密钥
+	KeyCount           int     `json:"key_count"`            // 密钥数量
+	ActiveKeyCount     int     `json:"active_key_count"`     // 可用的密钥数量
+	Balance            float64 `json:"balance"`              // 未删除密钥的余额合计
+	TodayRequests      int     `json:"today_requests"`       // 今日请求数
+	TodayTokens        int     `json:"today_tokens"`         // 今日令牌数
+	TodayCost          float64 `json:"today_cost"`           // 今日余额消耗
+	TrafficShare       float64 `json:"traffic_share"`        // 今日请求数占比
+	DailyBurn          float64 `json:"daily_burn"`           // 最近7天平均每日消耗
+	DaysUntilExhausted float64 `json:"days_until_exhausted"` // 按平均消耗估算的剩余天数，-1表示无法估算
+	ExhaustionDate     string  `json:"exhaustion_date"`      // 预计余额耗尽的日期，无法估算时为空
+}
+
+// KeyGroupDashboard 各密钥分组和整个密钥池的余额与用量
+type KeyGroupDashboard struct {
+	Groups []KeyGroupUsage `json:"groups"`
+	Pool   KeyGroupUsage   `json:"pool"`
+}
+
+// GetKeyGroupDashboard 获取各密钥分组和整个密钥池的余额、今日用量、流量占比和预计耗尽时间
+// 用量按请求时密钥所属的分组统计，未设置分组的密钥归入默认分组
+func GetKeyGroupDashboard() KeyGroupDashboard {
+	now := config.StatsNow()
+	today := now.Format(config.StatsDateLayout)
+	windowStart := now.AddDate(0, 0, -(groupBurnWindowDays - 1)).Format(config.StatsDateLayout)
+
+	usages := make(map[string]*KeyGroupUsage)
+	getUsage := func(name string) *KeyGroupUsage {
+		if usages[name] == nil {
+			usages[name] = &KeyGroupUsage{Name: name}
+		}
+		return usages[name]
+	}
+	for _, group := range config.GetKeyGroupConfigs() {
+		getUsage(group.Name)
+	}
+
+	pool := KeyGroupUsage{Name: "pool"}
+	keyPool := GetKeyPool()
+	for _, k := range keyPool.Keys() {
+		usage := getUsage(config.GetKeyGroupName(k))
+		usage.KeyCount++
+		pool.KeyCount++
+		if !k.Delete {
+			usage.Balance += k.Balance
+			pool.Balance += k.Balance
+		}
+	}
+	for _, k := range keyPool.ActiveKeys() {
+		getUsage(config.GetKeyGroupName(k)).ActiveKeyCount++
+		pool.ActiveKeyCount++
+	}
+
+	for name, stats := range config.GetDailyGroupStats(today) {
+		usage := getUsage(name)
+		usage.TodayRequests = stats.Requests
+		usage.TodayTokens = stats.Tokens
+		usage.TodayCost = stats.Cost
+		pool.TodayRequests += stats.Requests
+		pool.TodayTokens += stats.Tokens
+		pool.TodayCost += stats.Cost
+	}
+
+	// 按有记录的天数计算平均每日消耗，避免刚开始统计时低估
+	windowCost := make(map[string]float64)
+	windowDays := make(map[string]bool)
+	for _, entry := range config.GetGroupUsageHistory() {
+		if entry.Date < windowStart || entry.Date > today {
+			continue
+		}
+		windowDays[entry.Date] = true
+		windowCost[entry.Group] += entry.Cost
+	}
+	days := float64(len(windowDays))
+	if days == 0 {
+		days = 1
+	}
+
+	finish := func(usage *KeyGroupUsage, cost float64) {
+		if pool.TodayRequests > 0 {
+			usage.TrafficShare = float64(usage.TodayRequests) / float64(pool.TodayRequests) * 100
+		}
+		usage.DailyBurn = cost / days
+		usage.DaysUntilExhausted = -1
+		if usage.DailyBurn > 0 {
+			usage.DaysUntilExhausted = usage.Balance / usage.DailyBurn
+			usage.ExhaustionDate = now.Add(time.Duration(usage.DaysUntilExhausted * float64(24*time.Hour))).Format("2006-01-02")
+		}
+	}
+
+	// 先列出已配置的分组，再按名称列出其他分组
+	dashboard := KeyGroupDashboard{Groups: make([]KeyGroupUsage, 0, len(usages))}
+	seen := make(map[string]bool)
+	addGroup := func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		usage := usages[name]
+		finish(usage, windowCost[name])
+		dashboard.Groups = append(dashboard.Groups, *usage)
+	}
+	for _, group := range config.GetKeyGroupConfigs() {
+		addGroup(group.Name)
+	}
+	var others []string
+	for name := range usages {
+		if !seen[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		addGroup(name)
+	}
+
+	var poolCost float64
+	for _, cost := range windowCost {
+		poolCost += cost
+	}
+	finish(&pool, poolCost)
+	dashboard.Pool = pool
+	return dashboard
+}
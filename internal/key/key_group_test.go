@@ -0,0 +1,104 @@
+package key
+
+import (
+	"testing"
+
+	"flowsilicon/internal/config"
+)
+
+func TestPickKeyGroup(t *testing.T) {
+	keys := []config.ApiKey{
+		{Key: "sk-paid", Group: "paid"},
+		{Key: "sk-free", Group: "free"},
+		{Key: "sk-ungrouped"},
+		{Key: "sk-unknown", Group: "legacy"}, // 分组未配置
+	}
+	only := func(names ...string) []config.ApiKey {
+		var result []config.ApiKey
+		for _, k := range keys {
+			for _, name := range names {
+				if k.Key == name {
+					result = append(result, k)
+				}
+			}
+		}
+		return result
+	}
+
+	tests := []struct {
+		name      string
+		groups    []config.KeyGroupConfig
+		keys      []config.ApiKey
+		model     string
+		roll      int // 按权重随机时返回的值
+		wantGroup string
+		wantKeys  []string
+	}{
+		{
+			name:      "按权重选择已配置的分组",
+			groups:    []config.KeyGroupConfig{{Name: "paid", Weight: 80}, {Name: "free", Weight: 20}},
+			keys:      keys,
+			roll:      85,
+			wantGroup: "free",
+			wantKeys:  []string{"sk-free"},
+		},
+		{
+			name:      "配置了默认分组时未配置分组的密钥使用默认分组的权重",
+			groups:    []config.KeyGroupConfig{{Name: "paid", Weight: 50}, {Name: config.DefaultKeyGroup, Weight: 50}},
+			keys:      keys,
+			roll:      60,
+			wantGroup: config.DefaultKeyGroup,
+			wantKeys:  []string{"sk-free", "sk-ungrouped", "sk-unknown"},
+		},
+		{
+			name:      "已配置的分组没有可用密钥时使用未配置分组的密钥",
+			groups:    []config.KeyGroupConfig{{Name: "paid", Weight: 100}},
+			keys:      only("sk-ungrouped", "sk-unknown"),
+			wantGroup: config.DefaultKeyGroup,
+			wantKeys:  []string{"sk-ungrouped", "sk-unknown"},
+		},
+		{
+			name:      "未配置分组的密钥优先于权重为0的备用分组",
+			groups:    []config.KeyGroupConfig{{Name: "paid", Weight: 100}, {Name: "free", Weight: 0}},
+			keys:      only("sk-free", "sk-unknown"),
+			wantGroup: config.DefaultKeyGroup,
+			wantKeys:  []string{"sk-unknown"},
+		},
+		{
+			name:      "只剩权重为0的备用分组",
+			groups:    []config.KeyGroupConfig{{Name: "paid", Weight: 100}, {Name: "free", Weight: 0}},
+			keys:      only("sk-free"),
+			wantGroup: "free",
+			wantKeys:  []string{"sk-free"},
+		},
+		{
+			name: "按模型覆盖权重",
+			groups: []config.KeyGroupConfig{
+				{Name: "paid", Weight: 100},
+				{Name: "free", Weight: 0, ModelWeights: map[string]int{"free-model": 1}},
+			},
+			keys:      keys,
+			model:     "free-model",
+			roll:      100,
+			wantGroup: "free",
+			wantKeys:  []string{"sk-free"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intn := func(n int) int { return tt.roll % n }
+			group, got := pickKeyGroup(tt.groups, tt.keys, tt.model, intn)
+			if group != tt.wantGroup {
+				t.Fatalf("分组 = %q，期望 %q", group, tt.wantGroup)
+			}
+			if len(got) != len(tt.wantKeys) {
+				t.Fatalf("密钥 = %v，期望 %v", got, tt.wantKeys)
+			}
+			for i, k := range got {
+				if k.Key != tt.wantKeys[i] {
+					t.Fatalf("密钥 = %v，期望 %v", got, tt.wantKeys)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+/**
+  @author: Hanhai
+  @desc: 密钥池容量模拟，按当前密钥的成功率、限流和余额进行蒙特卡洛模拟，估算给定RPS下的错误率、延迟、费用和密钥耗尽概率
+**/
+
+package key
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"flowsilicon/internal/config"
+)
+
+const (
+	// 所有模拟轮次合计最多模拟的请求数，避免一次模拟占用过多CPU
+	maxSimulatedRequests = 10_000_000
+	// 最多模拟的轮次
+	maxSimulationRuns = 200
+	// 最长模拟时长
+	maxSimulationDuration = 24 * time.Hour
+	// 模拟使用的单次上游请求基准延迟，实际延迟在基准的0.5到1.5倍之间
+	simulatedBaseLatencyMs = 1000
+	// 没有调用记录的密钥使用的成功率
+	defaultSimulatedSuccessRate = 0.99
+	// 没有统计数据时每次请求的令牌数
+	defaultSimulatedTokensPerRequest = 1000
+)
+
+// LoadSimResult 负载模拟结果
+type LoadSimResult struct {
+	RPS                      int     `json:"rps"`                         // 模拟的每秒请求数
+	DurationSeconds          int64   `json:"duration_seconds"`            // 模拟时长（秒）
+	Model                    string  `json:"model,omitempty"`             // 用于估算每次请求令牌数的模型
+	Runs                     int     `json:"runs"`                        // 模拟轮次
+	ActiveKeys               int     `json:"active_keys"`                 // 参与模拟的可用密钥数量
+	TokensPerRequest         int     `json:"tokens_per_request"`          // 每次请求的令牌数假设
+	BaseLatencyMs            int     `json:"base_latency_ms"`             // 单次上游请求的基准延迟假设
+	ExpectedErrorRate        float64 `json:"expected_error_rate"`         // 重试后仍失败的请求比例
+	RateLimitedRate          float64 `json:"rate_limited_rate"`           // 所有密钥都达到限流上限的请求尝试比例
+	ExpectedAvgLatencyMs     float64 `json:"expected_avg_latency_ms"`     // 包括重试的平均请求延迟
+	ProjectedDailyCost       float64 `json:"projected_daily_cost"`        // 按模拟速率估算的每日费用，只包括设置了每次请求费用的密钥
+	KeyExhaustionProbability float64 `json:"key_exhaustion_probability"`  // 模拟期间出现没有可用密钥的概率
+	MeanTimeToExhaustionSec  float64 `json:"mean_time_to_exhaustion_sec"` // 出现密钥耗尽的轮次中首次耗尽的平均时间，未耗尽时为0
+}
+
+// simKey 模拟中的密钥状态
+type simKey struct {
+	successRate   float64
+	balance       float64
+	tracked       bool
+	cost          float64
+	rpmLimit      int
+	tpmLimit      int
+	minuteCalls   int
+	minuteTokens  int
+	failures      int
+	disabledUntil int64
+}
+
+// simRunResult 单轮模拟结果
+type simRunResult struct {
+	requests     int64
+	errors       int64
+	attempts     int64
+	rateLimited  int64
+	latencyMs    float64
+	cost         float64
+	exhaustedAt  int64
+	wasExhausted bool
+}
+
+// SimulateLoad 使用当前密钥状态模拟指定RPS和时长的负载，不发送任何真实请求
+func SimulateLoad(rps int, duration time.Duration) LoadSimResult {
+	result, _ := SimulateLoadForModel(rps, duration, "")
+	return result
+}
+
+// SimulateLoadForModel 与SimulateLoad相同，使用指定模型的历史统计估算每次请求的令牌数
+func SimulateLoadForModel(rps int, duration time.Duration, model string) (LoadSimResult, error) {
+	result := LoadSimResult{
+		RPS:             rps,
+		DurationSeconds: int64(duration / time.Second),
+		Model:           model,
+		BaseLatencyMs:   simulatedBaseLatencyMs,
+	}
+	if rps <= 0 || result.DurationSeconds <= 0 {
+		return result, fmt.Errorf("RPS和模拟时长必须大于0")
+	}
+	if duration > maxSimulationDuration {
+		return result, fmt.Errorf("模拟时长不能超过 %v", maxSimulationDuration)
+	}
+
+	perRun := int64(rps) * result.DurationSeconds
+	if perRun > maxSimulatedRequests {
+		return result, fmt.Errorf("模拟的请求总数 %d 超过上限 %d，请降低RPS或缩短时长", perRun, maxSimulatedRequests)
+	}
+	result.Runs = int(maxSimulatedRequests / perRun)
+	if result.Runs > maxSimulationRuns {
+		result.Runs = maxSimulationRuns
+	}
+
+	activeKeys := GetKeyPool().ActiveKeys()
+	result.ActiveKeys = len(activeKeys)
+	result.TokensPerRequest = simulatedTokensPerRequest(model)
+
+	cfg := config.GetConfig()
+	params := simParams{
+		rps:              rps,
+		duration:         result.DurationSeconds,
+		tokensPerRequest: result.TokensPerRequest,
+		maxFailures:      5,
+		recoverySec:      int64(recoveryProbeInterval(0) / time.Second),
+	}
+	if cfg != nil {
+		params.minBalance = cfg.App.MinBalanceThreshold
+		params.maxRetries = cfg.ApiProxy.Retry.MaxRetries
+		params.retryDelayMs = cfg.ApiProxy.Retry.RetryDelayMs
+		if cfg.App.MaxConsecutiveFailures > 0 {
+			params.maxFailures = cfg.App.MaxConsecutiveFailures
+		}
+	}
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var requests, errors, attempts, rateLimited int64
+	var latency, cost, exhaustedTime float64
+	exhaustedRuns := 0
+	for run := 0; run < result.Runs; run++ {
+		r := runLoadSimulation(rng, newSimKeys(activeKeys), params)
+		requests += r.requests
+		errors += r.errors
+		attempts += r.attempts
+		rateLimited += r.rateLimited
+		latency += r.latencyMs
+		cost += r.cost
+		if r.wasExhausted {
+			exhaustedRuns++
+			exhaustedTime += float64(r.exhaustedAt)
+		}
+	}
+
+	if requests > 0 {
+		result.ExpectedErrorRate = float64(errors) / float64(requests)
+		result.ExpectedAvgLatencyMs = latency / float64(requests)
+	}
+	if attempts > 0 {
+		result.RateLimitedRate = float64(rateLimited) / float64(attempts)
+	}
+	result.ProjectedDailyCost = cost / float64(result.Runs) / float64(result.DurationSeconds) * 86400
+	result.KeyExhaustionProbability = float64(exhaustedRuns) / float64(result.Runs)
+	if exhaustedRuns > 0 {
+		result.MeanTimeToExhaustionSec = exhaustedTime / float64(exhaustedRuns)
+	}
+	return result, nil
+}
+
+// simParams 模拟参数
+type simParams struct {
+	rps              int
+	duration         int64
+	tokensPerRequest int
+	minBalance       float64
+	maxRetries       int
+	retryDelayMs     int
+	maxFailures      int
+	recoverySec      int64
+}
+
+// newSimKeys 根据当前密钥状态创建模拟密钥
+func newSimKeys(keys []config.ApiKey) []simKey {
+	simKeys := make([]simKey, 0, len(keys))
+	for _, k := range keys {
+		successRate := k.SuccessRate
+		if k.TotalCalls == 0 {
+			successRate = defaultSimulatedSuccessRate
+		}
+		rpm, tpm := currentLimitWindows(k)
+		simKeys = append(simKeys, simKey{
+			successRate: successRate,
+			balance:     k.Balance,
+			tracked:     k.IsBalanceTracked(),
+			cost:        k.CostPerRequest,
+			rpmLimit:    rpm.Limit,
+			tpmLimit:    tpm.Limit,
+		})
+	}
+	return simKeys
+}
+
+// runLoadSimulation 按秒模拟一轮负载，请求按泊松分布到达，按轮询选择密钥，失败时按重试配置换密钥重试
+func runLoadSimulation(rng *rand.Rand, keys []simKey, params simParams) simRunResult {
+	var result simRunResult
+	cursor := 0
+
+	for sec := int64(0); sec < params.duration; sec++ {
+		// 每分钟开始新的限流窗口
+		if sec%60 == 0 {
+			for i := range keys {
+				keys[i].minuteCalls = 0
+				keys[i].minuteTokens = 0
+			}
+		}
+
+		arrivals := poisson(rng, float64(params.rps))
+		for n := 0; n < arrivals; n++ {
+			result.requests++
+			requestLatency := 0.0
+			succeeded := false
+
+			for attempt := 0; attempt <= params.maxRetries; attempt++ {
+				index, limited := pickSimKey(keys, &cursor, sec, params)
+				if index < 0 {
+					// 没有可用密钥
+					if !result.wasExhausted {
+						result.wasExhausted = true
+						result.exhaustedAt = sec
+					}
+					break
+				}
+
+				k := &keys[index]
+				result.attempts++
+				k.minuteCalls++
+				k.minuteTokens += params.tokensPerRequest
+				requestLatency += simulatedBaseLatencyMs * (0.5 + rng.Float64())
+				if limited {
+					result.rateLimited++
+				}
+
+				if !limited && rng.Float64() < k.successRate {
+					k.failures = 0
+					if k.cost > 0 {
+						result.cost += k.cost
+						if k.tracked {
+							k.balance -= k.cost
+						}
+					}
+					succeeded = true
+					break
+				}
+
+				// 连续失败达到上限的密钥被禁用，恢复检查间隔后重新启用
+				k.failures++
+				if k.failures >= params.maxFailures {
+					k.disabledUntil = sec + params.recoverySec
+					k.failures = 0
+				}
+				if attempt < params.maxRetries {
+					requestLatency += float64(params.retryDelayMs)
+				}
+			}
+
+			result.latencyMs += requestLatency
+			if !succeeded {
+				result.errors++
+			}
+		}
+	}
+	return result
+}
+
+// pickSimKey 轮询选择一个可用的模拟密钥，优先选择未达到限流上限的密钥
+// 所有可用密钥都达到上限时仍返回一个密钥，并标记为被限流，与实际选择逻辑一致；没有可用密钥时返回-1
+func pickSimKey(keys []simKey, cursor *int, sec int64, params simParams) (int, bool) {
+	fallback := -1
+	for i := 0; i < len(keys); i++ {
+		index := (*cursor + i) % len(keys)
+		k := keys[index]
+		if k.disabledUntil > sec || (k.tracked && k.balance < params.minBalance) {
+			continue
+		}
+		if (k.rpmLimit > 0 && k.minuteCalls >= k.rpmLimit) || (k.tpmLimit > 0 && k.minuteTokens+params.tokensPerRequest > k.tpmLimit) {
+			if fallback < 0 {
+				fallback = index
+			}
+			continue
+		}
+		*cursor = (index + 1) % len(keys)
+		return index, false
+	}
+
+	if fallback >= 0 {
+		*cursor = (fallback + 1) % len(keys)
+		return fallback, true
+	}
+	return -1, false
+}
+
+// poisson 生成均值为lambda的泊松分布随机数，均值较大时使用正态近似
+func poisson(rng *rand.Rand, lambda float64) int {
+	if lambda > 30 {
+		n := int(math.Round(lambda + math.Sqrt(lambda)*rng.NormFloat64()))
+		if n < 0 {
+			return 0
+		}
+		return n
+	}
+
+	limit := math.Exp(-lambda)
+	n := 0
+	p := rng.Float64()
+	for p > limit {
+		n++
+		p *= rng.Float64()
+	}
+	return n
+}
+
+// simulatedTokensPerRequest 根据今天的统计估算每次请求的令牌数，优先使用指定模型的统计
+func simulatedTokensPerRequest(model string) int {
+	stats, err := config.GetDailyStats(config.StatsToday())
+	if err != nil || stats == nil {
+		return defaultSimulatedTokensPerRequest
+	}
+
+	if modelStats, ok := stats.Models[model]; ok && modelStats.Requests > 0 && modelStats.Tokens > 0 {
+		return modelStats.Tokens / modelStats.Requests
+	}
+	if stats.Requests.Total > 0 && stats.Tokens.Total > 0 {
+		return stats.Tokens.Total / stats.Requests.Total
+	}
+	return defaultSimulatedTokensPerRequest
+}
@@ -9,7 +9,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,6 +22,8 @@ import (
 	"flowsilicon/internal/common"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/logger"
+	"flowsilicon/internal/signing"
+	"flowsilicon/pkg/utils"
 )
 
 // KeyMode 定义 API 密钥使用模式
@@ -51,6 +56,49 @@ var (
 func init() {
 	client = resty.New()
 	client.SetTimeout(30 * time.Second)
+	// 发送前按密钥所属的服务商附加请求头并签名，与代理请求使用相同的配置
+	client.SetPreRequestHook(signUpstreamRequest)
+
+	// 密钥列表变更时同步更新选中的密钥
+	config.WatchApiKeyChanges(handleApiKeyChanges)
+}
+
+// handleApiKeyChanges 密钥列表变更时移除已删除的选中密钥
+// 选中的密钥全部被删除时回退到轮询所有密钥模式
+func handleApiKeyChanges(keys []config.ApiKey) {
+	existing := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		existing[k.Key] = true
+	}
+
+	modeMutex.Lock()
+	if len(selectedKeys) == 0 {
+		modeMutex.Unlock()
+		return
+	}
+
+	remaining := make([]string, 0, len(selectedKeys))
+	for _, k := range selectedKeys {
+		if existing[k] {
+			remaining = append(remaining, k)
+		}
+	}
+	if len(remaining) == len(selectedKeys) {
+		modeMutex.Unlock()
+		return
+	}
+
+	removed := len(selectedKeys) - len(remaining)
+	selectedKeys = remaining
+	if len(remaining) == 0 && currentMode != KeyModeAll {
+		logger.Warn("选中的API密钥已全部删除，密钥使用模式从 %s 切换为 %s", currentMode, KeyModeAll)
+		currentMode = KeyModeAll
+	} else {
+		logger.Info("已从选中的密钥中移除 %d 个已删除的密钥", removed)
+	}
+	modeMutex.Unlock()
+
+	ResetCurrentKeyIndex()
 }
 
 // StartKeyManager 启动 API 密钥管理器
@@ -71,16 +119,19 @@ func StartKeyManager() {
 		checkIntervalMinutes = 60 // 最小1分钟
 	}
 
-	// 创建定时任务
+	// 加载重启前断开的断路器
+	loadKeyCircuits()
+
+	// 创建定时任务，余额检查等任务在休眠唤醒后错开补执行
 	cronScheduler = cron.New()
 
 	// 添加定时任务，每隔指定时间检查一次 API 密钥余额
 	spec := fmt.Sprintf("@every %dm", checkIntervalMinutes)
-	cronScheduler.AddFunc(spec, checkAllKeysBalance)
+	cronScheduler.AddFunc(spec, config.ScheduledJob("check_all_keys_balance", time.Duration(checkIntervalMinutes)*time.Minute, checkAllKeysBalance))
 
-	// 添加定时任务，每隔 RecoveryInterval 分钟尝试恢复被禁用的密钥
-	recoverySpec := fmt.Sprintf("@every %dm", cfg.App.RecoveryInterval)
-	cronScheduler.AddFunc(recoverySpec, tryRecoverDisabledKeys)
+	// 添加定时任务，每分钟按各密钥的恢复探测计划尝试恢复被禁用的密钥
+	recoverySpec := fmt.Sprintf("@every %s", recoveryProbeTick)
+	cronScheduler.AddFunc(recoverySpec, config.ScheduledJob("recover_disabled_keys", recoveryProbeTick, tryRecoverDisabledKeys))
 
 	// 添加定时任务，定时刷新已使用过的API密钥余额
 	refreshUsedKeysInterval := cfg.App.RefreshUsedKeysInterval
@@ -89,7 +140,16 @@ func StartKeyManager() {
 		refreshUsedKeysInterval = 60 // 默认每60分钟刷新一次
 	}
 	refreshUsedKeysSpec := fmt.Sprintf("@every %dm", refreshUsedKeysInterval)
-	cronScheduler.AddFunc(refreshUsedKeysSpec, RefreshUsedKeysBalance)
+	cronScheduler.AddFunc(refreshUsedKeysSpec, config.ScheduledJob("refresh_used_keys_balance", time.Duration(refreshUsedKeysInterval)*time.Minute, RefreshUsedKeysBalance))
+
+	// 添加定时任务，每分钟更新密钥的平滑指标
+	cronScheduler.AddFunc(fmt.Sprintf("@every %s", keyMetricsInterval), updateKeyMetrics)
+
+	// 添加定时任务，定时检查密钥余额是否低于通知阈值
+	cronScheduler.AddFunc(fmt.Sprintf("@every %s", balanceAlertInterval), checkBalanceAlerts)
+
+	// 添加定时任务，每天夜间按统计时区重新推断密钥的自动标签
+	cronScheduler.AddFunc(fmt.Sprintf("CRON_TZ=%s %s", config.GetStatsLocation(), autoTagSchedule), runAutoTagKeys)
 
 	// 启动定时任务
 	cronScheduler.Start()
@@ -106,7 +166,7 @@ func StopKeyManager() {
 
 // checkAllKeysBalance 检查所有 API 密钥的余额
 func checkAllKeysBalance() {
-	keys := config.GetApiKeys()
+	keys := GetKeyPool().Keys()
 	logger.Info("开始检查 %d 个API密钥的余额", len(keys))
 
 	// 创建一个等待组，用于等待所有检查完成
@@ -117,6 +177,11 @@ func checkAllKeysBalance() {
 		go func(key config.ApiKey) {
 			defer wg.Done()
 
+			// 非自动余额模式的密钥不通过接口查询余额
+			if !key.IsBalanceAuto() {
+				return
+			}
+
 			// 检查余额
 			balance, err := CheckKeyBalance(key.Key)
 			if err != nil {
@@ -126,6 +191,11 @@ func checkAllKeysBalance() {
 
 			logger.Info("API密钥 %s 余额: %.2f", MaskKey(key.Key), balance)
 
+			// 保存余额快照，用于余额趋势图
+			if err := config.RecordKeyBalance(key.ID, balance); err != nil {
+				logger.Error("保存API密钥 %s 的余额快照失败: %v", MaskKey(key.Key), err)
+			}
+
 			// 如果余额为0或负数，根据配置决定是否标记为删除
 			if balance <= 0 {
 				if config.GetConfig().App.AutoDeleteZeroBalanceKeys {
@@ -177,12 +247,34 @@ func checkAllKeysBalance() {
 	logger.Info("API密钥余额检查完成")
 }
 
+// signUpstreamRequest 按Authorization中的密钥为发往上游的请求附加服务商的请求头并签名
+func signUpstreamRequest(_ *resty.Client, req *http.Request) error {
+	var body []byte
+	if req.GetBody != nil {
+		reader, err := req.GetBody()
+		if err != nil {
+			return fmt.Errorf("读取请求体失败: %w", err)
+		}
+		if reader != nil {
+			defer reader.Close()
+			if body, err = io.ReadAll(reader); err != nil {
+				return fmt.Errorf("读取请求体失败: %w", err)
+			}
+		}
+	}
+	apiKey := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return signing.ApplyProviderHeaders(req, apiKey, body)
+}
+
 // CheckKeyBalance 检查 API 密钥余额
 // TODO 等待优化
 func CheckKeyBalance(key string) (float64, error) {
 
 	// 使用硅基流动 API 的用户信息接口
 	userInfoURL := "https://api.siliconflow.cn/v1/user/info"
+	if override := config.GetUpstreamOverride(); override != "" {
+		userInfoURL = override + "/v1/user/info"
+	}
 
 	resp, err := client.R().
 		SetHeader("Authorization", fmt.Sprintf("Bearer %s", key)).
@@ -240,6 +332,13 @@ type SiliconFlowUserInfoResponse struct {
 
 // GetNextApiKey 获取下一个要使用的 API 密钥
 func GetNextApiKey() (string, error) {
+	if IsKeySelectionPaused() {
+		return "", ErrSelectionPaused
+	}
+	if err := GetKeyPool().Err(); err != nil {
+		return "", err
+	}
+
 	modeMutex.RLock()
 	mode := currentMode
 	keys := selectedKeys
@@ -254,11 +353,15 @@ func GetNextApiKey() (string, error) {
 		}
 
 		// 检查选中的密钥是否存在且未禁用
-		allKeys := config.GetApiKeys()
+		allKeys := GetKeyPool().Keys()
 		for _, k := range allKeys {
 			if k.Key == keys[0] && !k.Disabled {
+				// 断路器断开时不使用该密钥，冷却和限流只有一个密钥时不生效
+				if len(selectableKeys([]config.ApiKey{k})) == 0 {
+					return "", common.NewApiError("selected key circuit is open", 503)
+				}
 				// 检查余额是否充足
-				if k.Balance < config.GetConfig().App.MinBalanceThreshold {
+				if !k.HasSufficientBalance(config.GetConfig().App.MinBalanceThreshold) {
 					return "", common.NewApiError("selected key has insufficient balance", 500)
 				}
 
@@ -284,13 +387,14 @@ func GetNextApiKey() (string, error) {
 
 		// 过滤出选中的且未禁用的密钥，且余额充足
 		var selectedKeysList []config.ApiKey
-		allKeys := config.GetApiKeys()
+		allKeys := GetKeyPool().Keys()
 		for _, k := range allKeys {
-			if keyMap[k.Key] && !k.Disabled && k.Balance >= config.GetConfig().App.MinBalanceThreshold {
+			if keyMap[k.Key] && !k.Disabled && k.HasSufficientBalance(config.GetConfig().App.MinBalanceThreshold) {
 				selectedKeysList = append(selectedKeysList, k)
 			}
 		}
 
+		selectedKeysList = selectableKeys(selectedKeysList)
 		if len(selectedKeysList) == 0 {
 			return "", common.NewApiError("no active selected keys with sufficient balance found", 500)
 		}
@@ -397,7 +501,11 @@ func CheckKeyBalanceManually(apiKey string) (float64, error) {
 
 // tryRecoverDisabledKeys 尝试恢复被禁用的密钥
 func tryRecoverDisabledKeys() {
-	disabledKeys := config.GetDisabledApiKeys()
+	// 只探测按恢复探测计划到了探测时间的密钥
+	disabledKeys := dueRecoveryProbes(GetKeyPool().DisabledKeys(), time.Now())
+	if len(disabledKeys) == 0 {
+		return
+	}
 
 	// 创建一个等待组，用于等待所有检查完成
 	var wg sync.WaitGroup
@@ -407,22 +515,21 @@ func tryRecoverDisabledKeys() {
 		go func(key config.ApiKey) {
 			defer wg.Done()
 
-			// 检查是否已经过了足够的时间
 			now := time.Now().Unix()
-			if now-key.DisabledAt < int64(config.GetConfig().App.RecoveryInterval*60) {
-				// 还没到恢复检查时间
-				return
-			}
 
-			// 首先检查密钥余额是否满足最低阈值要求
-			balance, err := CheckKeyBalance(key.Key)
-			if err != nil {
-				logger.Error("恢复检查: 检查API密钥 %s 余额失败: %v", MaskKey(key.Key), err)
-				return
+			// 首先检查密钥余额是否满足最低阈值要求，非自动余额模式的密钥使用已记录的余额
+			balance := key.Balance
+			if key.IsBalanceAuto() {
+				var err error
+				balance, err = CheckKeyBalance(key.Key)
+				if err != nil {
+					logger.Error("恢复检查: 检查API密钥 %s 余额失败: %v", MaskKey(key.Key), err)
+					return
+				}
 			}
 
 			// 如果余额低于最低阈值，不恢复该密钥
-			if balance < config.GetConfig().App.MinBalanceThreshold {
+			if key.IsBalanceTracked() && balance < config.GetConfig().App.MinBalanceThreshold {
 				logger.Info("恢复检查: API密钥 %s 余额 %.2f 低于阈值 %.2f，不恢复该密钥",
 					MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
 
@@ -473,13 +580,15 @@ func UpdateApiKeyStatus(key string, success bool) {
 		config.UpdateApiKeyFailure(key)
 
 		// 获取密钥信息
-		allKeys := config.GetApiKeys()
+		allKeys := GetKeyPool().Keys()
 		for _, k := range allKeys {
 			if k.Key == key {
 				// 检查连续失败次数是否超过阈值
 				if k.ConsecutiveFailures >= config.GetConfig().App.MaxConsecutiveFailures {
-					// 禁用密钥
-					config.DisableApiKey(key)
+					// 禁用密钥，本次失败导致禁用时发送通知
+					if config.DisableApiKey(key) && !k.Disabled {
+						go notifyKeyDisabled(k)
+					}
 				}
 				break
 			}
@@ -490,13 +599,104 @@ func UpdateApiKeyStatus(key string, success bool) {
 	config.SortApiKeysByPriority()
 }
 
+// RecordRequestError 记录发送请求失败
+// 证书校验失败时先检测系统时钟，时钟偏差导致的证书错误不计入密钥失败，避免所有密钥被禁用
+func RecordRequestError(key string, err error) {
+	if utils.IsCertificateError(err) {
+		if !utils.IsClockSkewed() {
+			if baseURL := config.GetApiBaseURL(); baseURL != "" {
+				utils.ProbeClockSkew(baseURL)
+			}
+		}
+		if utils.IsClockSkewed() {
+			logger.Warn("系统时钟存在偏差，API密钥 %s 的证书校验失败不计入失败次数", MaskKey(key))
+			return
+		}
+	}
+
+	UpdateApiKeyStatus(key, false)
+	recordCircuitRequestError(key)
+}
+
 // ForceRefreshAllKeysBalance 强制刷新所有API密钥的余额
-// 在程序启动时调用，确保所有API密钥的余额都是最新的
+// 用于手动刷新，等待所有密钥刷新完成后返回；程序启动时使用StartBackgroundBalanceRefresh在后台刷新
 // 设置30秒超时限制，如果超时则报错
 func ForceRefreshAllKeysBalance() error {
-	keys := config.GetApiKeys()
+	keys := GetKeyPool().Keys()
 	logger.Info("启动时强制刷新 %d 个API密钥的余额", len(keys))
 
+	refreshErr := runBalanceChecks(keys, func(key config.ApiKey) {
+		// 刷新单个密钥的余额，单个密钥失败不影响整体结果
+		var err error
+		if key.ID > 0 {
+			err = ForceRefreshKeyBalance(key.ID)
+		} else {
+			err = refreshKeyBalance(key)
+		}
+		if err != nil {
+			logger.Error("强制刷新: %v", err)
+		}
+	})
+
+	// 保存更新后的密钥状态
+	if err := config.SaveApiKeys(); err != nil {
+		logger.Error("强制刷新: 保存API密钥状态失败: %v", err)
+		if refreshErr == nil {
+			refreshErr = err
+		}
+	} else {
+		logger.Info("强制刷新: 保存API密钥状态成功")
+	}
+
+	// 从JSON中删除标记为删除的密钥
+	config.RemoveMarkedApiKeys()
+
+	// 重新排序 API 密钥（按照综合得分从高到低）
+	config.SortApiKeysByBalance()
+
+	logger.Info("强制刷新API密钥余额完成")
+	return refreshErr
+}
+
+// KeyBalanceCheck 查询一个密钥余额的结果，Err不为nil表示密钥无效或查询失败
+type KeyBalanceCheck struct {
+	Key     string
+	Balance float64
+	Err     error
+}
+
+// CheckKeysBalance 查询多个密钥的余额，不修改密钥池，用于导入前验证密钥
+// 与ForceRefreshAllKeysBalance使用相同的并发数和30秒超时，超时前没有查询的密钥返回超时错误
+func CheckKeysBalance(keys []string) []KeyBalanceCheck {
+	results := make([]KeyBalanceCheck, len(keys))
+	jobs := make([]config.ApiKey, len(keys))
+	for i, k := range keys {
+		results[i] = KeyBalanceCheck{Key: k, Err: fmt.Errorf("查询余额超时")}
+		// 借用ID字段记录结果的位置
+		jobs[i] = config.ApiKey{ID: i, Key: k}
+	}
+
+	// 超时返回后仍在进行的查询不再写入结果
+	var mu sync.Mutex
+	finished := false
+	runBalanceChecks(jobs, func(job config.ApiKey) {
+		balance, err := CheckKeyBalance(job.Key)
+		mu.Lock()
+		if !finished {
+			results[job.ID] = KeyBalanceCheck{Key: job.Key, Balance: balance, Err: err}
+		}
+		mu.Unlock()
+	})
+
+	mu.Lock()
+	finished = true
+	mu.Unlock()
+	return results
+}
+
+// runBalanceChecks 并发对每个密钥执行check，等待全部完成或超过30秒后返回，超时时返回错误
+// 超时后还没有开始的密钥不再执行check
+func runBalanceChecks(keys []config.ApiKey, check func(config.ApiKey)) error {
 	// 创建一个等待组，用于等待所有检查完成
 	var wg sync.WaitGroup
 
@@ -511,77 +711,43 @@ func ForceRefreshAllKeysBalance() error {
 	var refreshErr error
 	var errMu sync.Mutex
 
-	// 限制并发数，避免并发过高导致请求失败
+	// 使用固定数量的工作协程，避免并发过高导致请求失败
 	// 每次最多同时处理50个请求
 	const maxConcurrency = 50
-	semaphore := make(chan struct{}, maxConcurrency)
+	workerCount := maxConcurrency
+	if len(keys) < workerCount {
+		workerCount = len(keys)
+	}
 
+	jobs := make(chan config.ApiKey, len(keys))
 	for i := range keys {
-		wg.Add(1)
-		go func(key config.ApiKey) {
-			// 获取信号量
-			semaphore <- struct{}{}
-			defer func() {
-				// 释放信号量
-				<-semaphore
-				wg.Done()
-			}()
-
-			// 检查上下文是否已取消
-			select {
-			case <-ctx.Done():
-				errMu.Lock()
-				if refreshErr == nil {
-					refreshErr = fmt.Errorf("刷新余额超时了")
-				}
-				errMu.Unlock()
-				logger.Error("强制刷新: 检查API密钥 %s 时上下文已取消", MaskKey(key.Key))
-				return
-			default:
-				// 继续执行
-			}
-
-			// 检查余额
-			balance, err := CheckKeyBalance(key.Key)
-			if err != nil {
-				logger.Error("强制刷新: 检查API密钥 %s 余额失败: %v", MaskKey(key.Key), err)
-				return
-			}
+		jobs <- keys[i]
+	}
+	close(jobs)
 
-			logger.Info("强制刷新: API密钥 %s 余额: %.2f", MaskKey(key.Key), balance)
+	for w := 0; w < workerCount; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
 
-			// 如果余额为0或负数，根据配置决定是否标记为删除
-			if balance <= 0 {
-				if config.GetConfig().App.AutoDeleteZeroBalanceKeys {
-					logger.Info("强制刷新: API密钥 %s 余额为 %.2f，标记为删除", MaskKey(key.Key), balance)
-					config.MarkApiKeyForDeletion(key.Key)
-				} else {
-					logger.Info("强制刷新: API密钥 %s 余额为 %.2f，但自动删除已禁用", MaskKey(key.Key), balance)
-					// 更新余额
-					config.UpdateApiKeyBalance(key.Key, balance)
+			for key := range jobs {
+				// 检查上下文是否已取消
+				select {
+				case <-ctx.Done():
+					errMu.Lock()
+					if refreshErr == nil {
+						refreshErr = fmt.Errorf("刷新余额超时了")
+					}
+					errMu.Unlock()
+					logger.Error("强制刷新: 检查API密钥 %s 时上下文已取消", MaskKey(key.Key))
+					continue
+				default:
+					// 继续执行
 				}
-				return
-			}
-
-			// 如果余额低于阈值但状态为启用，禁用它
-			if balance < config.GetConfig().App.MinBalanceThreshold && !key.Disabled {
-				logger.Info("强制刷新: API密钥 %s 余额 %.2f 低于阈值 %.2f，禁用该密钥",
-					MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
-				config.DisableApiKey(key.Key)
-				return
-			}
 
-			// 如果余额高于阈值但状态为禁用，启用它
-			if balance >= config.GetConfig().App.MinBalanceThreshold && key.Disabled {
-				logger.Info("强制刷新: API密钥 %s 余额 %.2f 高于阈值 %.2f，启用该密钥",
-					MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
-				config.EnableApiKey(key.Key)
-				return
+				check(key)
 			}
-
-			// 更新余额
-			config.UpdateApiKeyBalance(key.Key, balance)
-		}(keys[i])
+		}()
 	}
 
 	// 在一个goroutine中等待所有检查完成
@@ -596,29 +762,80 @@ func ForceRefreshAllKeysBalance() error {
 		logger.Info("所有API密钥余额检查已完成")
 	case <-ctx.Done():
 		logger.Warn("API密钥余额检查超时，超过30秒限制")
+		errMu.Lock()
 		if refreshErr == nil {
 			refreshErr = fmt.Errorf("刷新余额超时了，请稍后再试")
 		}
+		errMu.Unlock()
 	}
+	return refreshErr
+}
 
-	// 保存更新后的密钥状态
-	if err := config.SaveApiKeys(); err != nil {
-		logger.Error("强制刷新: 保存API密钥状态失败: %v", err)
-		if refreshErr == nil {
-			refreshErr = err
+// ForceRefreshKeyBalance 强制刷新指定ID的API密钥余额，并更新内存和数据库中的状态
+func ForceRefreshKeyBalance(keyID int) error {
+	key, found := config.GetApiKeyByID(keyID)
+	if !found {
+		return fmt.Errorf("ID为 %d 的API密钥不存在", keyID)
+	}
+
+	return refreshKeyBalance(key)
+}
+
+// refreshKeyBalance 查询单个密钥的余额，并根据余额更新其状态
+func refreshKeyBalance(key config.ApiKey) error {
+	// 非自动余额模式的密钥不通过接口查询余额
+	if !key.IsBalanceAuto() {
+		logger.Info("强制刷新: API密钥 %s 的余额模式为 %s，跳过余额查询", MaskKey(key.Key), key.GetBalanceMode())
+		return nil
+	}
+
+	// 检查余额
+	balance, err := CheckKeyBalance(key.Key)
+	if err != nil {
+		return fmt.Errorf("检查API密钥 %s 余额失败: %w", MaskKey(key.Key), err)
+	}
+
+	logger.Info("强制刷新: API密钥 %s 余额: %.2f", MaskKey(key.Key), balance)
+
+	// 保存余额快照，用于余额趋势图
+	if err := config.RecordKeyBalance(key.ID, balance); err != nil {
+		logger.Error("保存API密钥 %s 的余额快照失败: %v", MaskKey(key.Key), err)
+	}
+
+	// 如果余额为0或负数，根据配置决定是否标记为删除
+	if balance <= 0 {
+		if config.GetConfig().App.AutoDeleteZeroBalanceKeys {
+			logger.Info("强制刷新: API密钥 %s 余额为 %.2f，标记为删除", MaskKey(key.Key), balance)
+			config.MarkApiKeyForDeletion(key.Key)
+		} else {
+			logger.Info("强制刷新: API密钥 %s 余额为 %.2f，但自动删除已禁用", MaskKey(key.Key), balance)
+			// 更新余额
+			config.UpdateApiKeyBalance(key.Key, balance)
 		}
-	} else {
-		logger.Info("强制刷新: 保存API密钥状态成功")
+		return nil
 	}
 
-	// 从JSON中删除标记为删除的密钥
-	config.RemoveMarkedApiKeys()
+	// 如果余额低于阈值但状态为启用，禁用它
+	if balance < config.GetConfig().App.MinBalanceThreshold && !key.Disabled {
+		logger.Info("强制刷新: API密钥 %s 余额 %.2f 低于阈值 %.2f，禁用该密钥",
+			MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
+		config.UpdateApiKeyBalance(key.Key, balance)
+		config.DisableApiKey(key.Key)
+		return nil
+	}
 
-	// 重新排序 API 密钥（按照综合得分从高到低）
-	config.SortApiKeysByBalance()
+	// 如果余额高于阈值但状态为禁用，启用它
+	if balance >= config.GetConfig().App.MinBalanceThreshold && key.Disabled {
+		logger.Info("强制刷新: API密钥 %s 余额 %.2f 高于阈值 %.2f，启用该密钥",
+			MaskKey(key.Key), balance, config.GetConfig().App.MinBalanceThreshold)
+		config.UpdateApiKeyBalance(key.Key, balance)
+		config.EnableApiKey(key.Key)
+		return nil
+	}
 
-	logger.Info("强制刷新API密钥余额完成")
-	return refreshErr
+	// 更新余额
+	config.UpdateApiKeyBalance(key.Key, balance)
+	return nil
 }
 
 // RefreshUsedKeysBalance 刷新已使用过的API密钥的余额
@@ -666,6 +883,11 @@ func RefreshUsedKeysBalance() {
 		go func(key config.ApiKey) {
 			defer wg.Done()
 
+			// 非自动余额模式的密钥不通过接口查询余额
+			if !key.IsBalanceAuto() {
+				return
+			}
+
 			// 检查余额
 			balance, err := CheckKeyBalance(key.Key)
 			if err != nil {
@@ -675,6 +897,11 @@ func RefreshUsedKeysBalance() {
 
 			logger.Info("刷新已使用密钥: API密钥 %s 余额: %.2f", MaskKey(key.Key), balance)
 
+			// 保存余额快照，用于余额趋势图
+			if err := config.RecordKeyBalance(key.ID, balance); err != nil {
+				logger.Error("保存API密钥 %s 的余额快照失败: %v", MaskKey(key.Key), err)
+			}
+
 			// 如果余额为0或负数，根据配置决定是否标记为删除
 			if balance <= 0 {
 				if config.GetConfig().App.AutoDeleteZeroBalanceKeys {
@@ -0,0 +1,233 @@
+/**
+  @author: Hanhai
+  @desc: 密钥平滑指标，密钥管理器每分钟用上一周期的原始计数更新RPM、TPM、成功率和延迟的指数加权移动平均
+**/
+
+package key
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+)
+
+const (
+	// 更新平滑指标的周期
+	keyMetricsInterval = time.Minute
+	// 未设置时指数加权平均的半衰期（秒）
+	defaultMetricsHalfLifeSeconds = 300
+	// 每个密钥保留的最近延迟样本数，用于计算P95
+	recentLatencySamples = 200
+)
+
+// LatencyHistogramBuckets 上游响应延迟直方图各区间的上限（秒）
+var LatencyHistogramBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// LatencyHistogram 密钥启动以来的上游响应延迟直方图
+type LatencyHistogram struct {
+	Buckets []uint64 // 延迟不超过LatencyHistogramBuckets中对应上限的累计次数
+	Count   uint64   // 总次数
+	Sum     float64  // 延迟之和（秒）
+}
+
+// KeyMetrics 密钥的指数加权平均指标
+type KeyMetrics struct {
+	EWMARPM         float64 `json:"ewma_rpm"`          // 每分钟请求数
+	EWMATPM         float64 `json:"ewma_tpm"`          // 每分钟令牌数
+	EWMASuccessRate float64 `json:"ewma_success_rate"` // 成功率，不包括客户端错误
+	EWMALatency     float64 `json:"ewma_latency_ms"`   // 上游响应延迟（毫秒）
+	UpdatedAt       int64   `json:"updated_at"`        // 最后一次更新的时间，从未更新时为0
+}
+
+// keyMetricsState 密钥平滑指标的计算状态
+type keyMetricsState struct {
+	metrics      KeyMetrics
+	hasRate      bool // 是否已有成功率样本
+	hasLatency   bool // 是否已有延迟样本
+	successCalls int  // 上一周期结束时的成功调用次数
+	keyCalls     int  // 上一周期结束时计入成功率的调用次数
+	latencySum   time.Duration
+	latencyCount int
+	// 最近的延迟样本，环形缓冲区
+	recentLatencies []time.Duration
+	latencyNext     int
+	// 启动以来的延迟直方图，不随平滑指标的周期清零
+	histogram LatencyHistogram
+}
+
+var (
+	keyMetricsStates = make(map[string]*keyMetricsState)
+	lastMetricsTick  time.Time
+	keyMetricsMutex  sync.Mutex
+)
+
+// RecordKeyLatency 记录一次上游请求从发出到收到响应头的时间
+func RecordKeyLatency(apiKey string, latency time.Duration) {
+	keyMetricsMutex.Lock()
+	defer keyMetricsMutex.Unlock()
+
+	state := keyMetricsStateLocked(apiKey)
+	state.latencySum += latency
+	state.latencyCount++
+	if len(state.recentLatencies) < recentLatencySamples {
+		state.recentLatencies = append(state.recentLatencies, latency)
+	} else {
+		state.recentLatencies[state.latencyNext] = latency
+		state.latencyNext = (state.latencyNext + 1) % recentLatencySamples
+	}
+
+	if state.histogram.Buckets == nil {
+		state.histogram.Buckets = make([]uint64, len(LatencyHistogramBuckets))
+	}
+	seconds := latency.Seconds()
+	for i, bound := range LatencyHistogramBuckets {
+		if seconds <= bound {
+			state.histogram.Buckets[i]++
+		}
+	}
+	state.histogram.Count++
+	state.histogram.Sum += seconds
+}
+
+// GetKeyLatencyHistograms 获取各密钥的上游响应延迟直方图，键为密钥，没有记录过延迟的密钥不包括在内
+func GetKeyLatencyHistograms() map[string]LatencyHistogram {
+	keyMetricsMutex.Lock()
+	defer keyMetricsMutex.Unlock()
+
+	result := make(map[string]LatencyHistogram, len(keyMetricsStates))
+	for apiKey, state := range keyMetricsStates {
+		if state.histogram.Count == 0 {
+			continue
+		}
+		histogram := state.histogram
+		histogram.Buckets = append([]uint64(nil), state.histogram.Buckets...)
+		result[apiKey] = histogram
+	}
+	return result
+}
+
+// GetKeyLatencyP95 获取密钥最近的上游响应延迟的P95和样本数，没有样本时返回0
+func GetKeyLatencyP95(apiKey string) (time.Duration, int) {
+	keyMetricsMutex.Lock()
+	state, ok := keyMetricsStates[apiKey]
+	if !ok || len(state.recentLatencies) == 0 {
+		keyMetricsMutex.Unlock()
+		return 0, 0
+	}
+	samples := make([]time.Duration, len(state.recentLatencies))
+	copy(samples, state.recentLatencies)
+	keyMetricsMutex.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	index := int(math.Ceil(float64(len(samples))*0.95)) - 1
+	if index < 0 {
+		index = 0
+	}
+	return samples[index], len(samples)
+}
+
+// keyMetricsStateLocked 获取密钥的计算状态，不存在时创建（已加锁）
+func keyMetricsStateLocked(apiKey string) *keyMetricsState {
+	state, ok := keyMetricsStates[apiKey]
+	if !ok {
+		state = &keyMetricsState{successCalls: -1}
+		keyMetricsStates[apiKey] = state
+	}
+	return state
+}
+
+// metricsHalfLife 获取指数加权平均的半衰期
+func metricsHalfLife() time.Duration {
+	cfg := config.GetConfig()
+	if cfg != nil && cfg.App.MetricsHalfLifeSeconds > 0 {
+		return time.Duration(cfg.App.MetricsHalfLifeSeconds) * time.Second
+	}
+	return defaultMetricsHalfLifeSeconds * time.Second
+}
+
+// ewma 按经过的时间和半衰期计算新的平均值，没有历史值时直接使用样本
+func ewma(previous, sample float64, hasPrevious bool, elapsed, halfLife time.Duration) float64 {
+	if !hasPrevious {
+		return sample
+	}
+	alpha := 1 - math.Pow(2, -elapsed.Seconds()/halfLife.Seconds())
+	return alpha*sample + (1-alpha)*previous
+}
+
+// updateKeyMetrics 用上一周期的原始计数更新所有密钥的平滑指标，由密钥管理器的定时任务调用
+// 周期内没有请求的密钥RPM/TPM按0更新，成功率和延迟没有新样本时保持不变
+func updateKeyMetrics() {
+	now := time.Now()
+	usage := config.TakeKeyIntervalUsage()
+	keys := GetKeyPool().Keys()
+	halfLife := metricsHalfLife()
+
+	keyMetricsMutex.Lock()
+	defer keyMetricsMutex.Unlock()
+
+	elapsed := keyMetricsInterval
+	if !lastMetricsTick.IsZero() {
+		elapsed = now.Sub(lastMetricsTick)
+	}
+	lastMetricsTick = now
+	minutes := elapsed.Minutes()
+	if minutes <= 0 {
+		return
+	}
+
+	current := make(map[string]*keyMetricsState, len(keys))
+	for _, k := range keys {
+		state := keyMetricsStateLocked(k.Key)
+		current[k.Key] = state
+		hasMetrics := state.metrics.UpdatedAt > 0
+
+		interval := usage[k.Key]
+		state.metrics.EWMARPM = ewma(state.metrics.EWMARPM, float64(interval.Requests)/minutes, hasMetrics, elapsed, halfLife)
+		state.metrics.EWMATPM = ewma(state.metrics.EWMATPM, float64(interval.Tokens)/minutes, hasMetrics, elapsed, halfLife)
+
+		// 成功率按调用次数的增量计算，首次更新时只记录基准值
+		keyCalls := k.TotalCalls - k.ClientErrors
+		if state.successCalls >= 0 {
+			deltaCalls := keyCalls - state.keyCalls
+			deltaSuccess := k.SuccessCalls - state.successCalls
+			if deltaCalls > 0 && deltaSuccess >= 0 && deltaSuccess <= deltaCalls {
+				rate := float64(deltaSuccess) / float64(deltaCalls)
+				state.metrics.EWMASuccessRate = ewma(state.metrics.EWMASuccessRate, rate, state.hasRate, elapsed, halfLife)
+				state.hasRate = true
+			}
+		}
+		state.successCalls = k.SuccessCalls
+		state.keyCalls = keyCalls
+
+		if state.latencyCount > 0 {
+			latencyMs := float64(state.latencySum.Milliseconds()) / float64(state.latencyCount)
+			state.metrics.EWMALatency = ewma(state.metrics.EWMALatency, latencyMs, state.hasLatency, elapsed, halfLife)
+			state.hasLatency = true
+			state.latencySum = 0
+			state.latencyCount = 0
+		}
+
+		state.metrics.UpdatedAt = now.Unix()
+	}
+
+	// 删除已移除的密钥
+	keyMetricsStates = current
+}
+
+// GetKeyMetrics 获取密钥当前的平滑指标，密钥不存在或尚未更新时返回零值
+func GetKeyMetrics(keyID int) KeyMetrics {
+	k, ok := config.GetApiKeyByID(keyID)
+	if !ok {
+		return KeyMetrics{}
+	}
+
+	keyMetricsMutex.Lock()
+	defer keyMetricsMutex.Unlock()
+	if state, ok := keyMetricsStates[k.Key]; ok {
+		return state.metrics
+	}
+	return KeyMetrics{}
+}
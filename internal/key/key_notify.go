@@ -0,0 +1,203 @@
+/**
+  @author: Hanhai
+  @desc: 密钥相关的通知，同一类通知在最小间隔内只发送一次，避免请求高峰时重复发送
+         余额不足和自动禁用的告警按密钥分别记录发送时间，在冷却时间内只发送一次，发送时间保存在配置数据库中
+**/
+
+package key
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/notify"
+)
+
+// 检查余额告警的间隔
+const balanceAlertInterval = 5 * time.Minute
+
+// 同一类密钥通知的最小发送间隔
+const keyNotifyInterval = 10 * time.Minute
+
+var (
+	// 每类通知上次发送的时间
+	lastKeyNotifyAt = make(map[string]time.Time)
+	keyNotifyMutex  sync.Mutex
+
+	// 每个告警上次发送的时间（Unix秒），第一次使用时从配置数据库加载
+	alertSentAt     map[string]int64
+	alertSentAtLock sync.Mutex
+)
+
+// shouldNotify 检查指定的通知是否超过最小发送间隔，超过时记录本次发送时间
+func shouldNotify(event string) bool {
+	keyNotifyMutex.Lock()
+	defer keyNotifyMutex.Unlock()
+
+	now := time.Now()
+	if last, ok := lastKeyNotifyAt[event]; ok && now.Sub(last) < keyNotifyInterval {
+		return false
+	}
+	lastKeyNotifyAt[event] = now
+	return true
+}
+
+// notifyKeysExhausted 没有可用的API密钥时发送通知
+func notifyKeysExhausted(modelName string) {
+	if !shouldNotify(notify.EventKeysExhausted) {
+		return
+	}
+
+	message := "没有可用的API密钥，请求无法转发"
+	if modelName != "" {
+		message = fmt.Sprintf("请求模型 %s 时没有可用的API密钥，请求无法转发", modelName)
+	}
+	go notify.Send(notify.EventKeysExhausted, message, map[string]interface{}{
+		"model": modelName,
+	})
+}
+
+// notifyKeyDisabled 密钥连续失败后被自动禁用时发送通知，在单独的协程中调用，不阻塞请求
+func notifyKeyDisabled(k config.ApiKey) {
+	if !alertDue(notify.EventKeyDisabled, keyAlertID(k)) {
+		return
+	}
+
+	notify.Send(notify.EventKeyDisabled,
+		fmt.Sprintf("API密钥 %s%s 连续失败 %d 次，已被自动禁用", MaskKey(k.Key), aliasSuffix(k), k.ConsecutiveFailures),
+		map[string]interface{}{
+			"key":                  MaskKey(k.Key),
+			"alias":                k.Alias,
+			"consecutive_failures": k.ConsecutiveFailures,
+			"balance":              k.Balance,
+		})
+}
+
+// checkBalanceAlerts 检查余额低于通知阈值的密钥和启用密钥的总余额，由定时任务调用，不等待通知发送
+func checkBalanceAlerts() {
+	settings := config.GetConfig().Notification
+	if settings.BalanceThreshold <= 0 && settings.PoolBalanceFloor <= 0 {
+		return
+	}
+
+	var totalBalance float64
+	activeKeys := 0
+	for _, k := range GetKeyPool().Keys() {
+		if k.Delete || !k.IsBalanceTracked() {
+			continue
+		}
+		if !k.Disabled {
+			totalBalance += k.Balance
+			activeKeys++
+		}
+
+		if settings.BalanceThreshold <= 0 {
+			continue
+		}
+		id := keyAlertID(k)
+		if k.Balance >= settings.BalanceThreshold {
+			clearAlert(notify.EventKeyLowBalance, id)
+			continue
+		}
+		if !alertDue(notify.EventKeyLowBalance, id) {
+			continue
+		}
+		go notify.Send(notify.EventKeyLowBalance,
+			fmt.Sprintf("API密钥 %s%s 的余额为 %.2f，低于通知阈值 %.2f", MaskKey(k.Key), aliasSuffix(k), k.Balance, settings.BalanceThreshold),
+			map[string]interface{}{
+				"key":       MaskKey(k.Key),
+				"alias":     k.Alias,
+				"balance":   k.Balance,
+				"threshold": settings.BalanceThreshold,
+			})
+	}
+
+	if settings.PoolBalanceFloor <= 0 || activeKeys == 0 {
+		return
+	}
+	if totalBalance >= settings.PoolBalanceFloor {
+		clearAlert(notify.EventPoolLowBalance, "pool")
+		return
+	}
+	if !alertDue(notify.EventPoolLowBalance, "pool") {
+		return
+	}
+	go notify.Send(notify.EventPoolLowBalance,
+		fmt.Sprintf("%d 个启用的API密钥余额合计 %.2f，低于通知阈值 %.2f", activeKeys, totalBalance, settings.PoolBalanceFloor),
+		map[string]interface{}{
+			"total_balance": totalBalance,
+			"floor":         settings.PoolBalanceFloor,
+			"active_keys":   activeKeys,
+		})
+}
+
+// alertDue 检查告警是否超过冷却时间，超过时记录本次发送时间
+// 余额恢复后清除记录，再次降到阈值以下时重新发送
+func alertDue(event string, id string) bool {
+	alertSentAtLock.Lock()
+	defer alertSentAtLock.Unlock()
+	loadAlertSentAt()
+
+	now := time.Now()
+	name := event + ":" + id
+	if last, ok := alertSentAt[name]; ok && now.Sub(time.Unix(last, 0)) < config.GetAlertCooldown() {
+		return false
+	}
+	alertSentAt[name] = now.Unix()
+	saveAlertSentAt(now)
+	return true
+}
+
+// clearAlert 告警条件不再成立时清除发送记录
+func clearAlert(event string, id string) {
+	alertSentAtLock.Lock()
+	defer alertSentAtLock.Unlock()
+	loadAlertSentAt()
+
+	name := event + ":" + id
+	if _, ok := alertSentAt[name]; !ok {
+		return
+	}
+	delete(alertSentAt, name)
+	saveAlertSentAt(time.Now())
+}
+
+// loadAlertSentAt 第一次使用时从配置数据库加载告警发送时间，调用前需要持有alertSentAtLock
+func loadAlertSentAt() {
+	if alertSentAt == nil {
+		alertSentAt = config.LoadNotificationAlertState()
+	}
+}
+
+// saveAlertSentAt 保存告警发送时间，超过冷却时间的记录不再保存，调用前需要持有alertSentAtLock
+func saveAlertSentAt(now time.Time) {
+	cooldown := config.GetAlertCooldown()
+	for name, last := range alertSentAt {
+		if now.Sub(time.Unix(last, 0)) >= cooldown {
+			delete(alertSentAt, name)
+		}
+	}
+	if err := config.SaveNotificationAlertState(alertSentAt); err != nil {
+		logger.Warn("保存告警发送记录失败: %v", err)
+	}
+}
+
+// keyAlertID 获取密钥在告警记录中的标识，使用数据库记录ID，不保存密钥本身
+func keyAlertID(k config.ApiKey) string {
+	if k.ID > 0 {
+		return strconv.Itoa(k.ID)
+	}
+	return MaskKey(k.Key)
+}
+
+// aliasSuffix 获取通知消息中的密钥别名，未设置别名时为空字符串
+func aliasSuffix(k config.ApiKey) string {
+	if k.Alias == "" {
+		return ""
+	}
+	return "（" + k.Alias + "）"
+}
@@ -0,0 +1,185 @@
+/**
+  @author: Hanhai
+  @desc: 上游响应分类，区分密钥原因的失败和客户端原因的错误，客户端错误不影响密钥的成功率和连续失败次数
+**/
+
+package key
+
+import (
+	"net/http"
+	"strings"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+)
+
+// ResponseCategory 上游响应的分类
+type ResponseCategory string
+
+// 上游响应的分类
+const (
+	CategorySuccess             ResponseCategory = "success"              // 请求成功
+	CategoryInvalidRequest      ResponseCategory = "invalid_request"      // 请求参数错误，如格式错误的工具定义
+	CategoryContextLength       ResponseCategory = "context_length"       // 上下文过长
+	CategoryContentPolicy       ResponseCategory = "content_policy"       // 内容审核拒绝
+	CategoryNotFound            ResponseCategory = "not_found"            // 模型或接口不存在
+	CategoryAuth                ResponseCategory = "auth"                 // 密钥无效或无权限
+	CategoryInsufficientBalance ResponseCategory = "insufficient_balance" // 密钥余额不足
+	CategoryRateLimited         ResponseCategory = "rate_limited"         // 密钥被限流
+	CategoryServerError         ResponseCategory = "server_error"         // 上游服务错误
+	CategoryUnknown             ResponseCategory = "unknown"              // 无法分类的错误
+)
+
+// KeyOutcome 一次调用对密钥健康状态的影响
+type KeyOutcome int
+
+const (
+	OutcomeSuccess     KeyOutcome = iota // 计入成功
+	OutcomeKeyFailure                    // 计入密钥失败
+	OutcomeClientError                   // 客户端错误，不计入成功率
+)
+
+// categoryOutcomes 响应分类对密钥健康状态的影响，新增分类时在这里添加
+var categoryOutcomes = map[ResponseCategory]KeyOutcome{
+	CategorySuccess:             OutcomeSuccess,
+	CategoryInvalidRequest:      OutcomeClientError,
+	CategoryContextLength:       OutcomeClientError,
+	CategoryContentPolicy:       OutcomeClientError,
+	CategoryNotFound:            OutcomeClientError,
+	CategoryAuth:                OutcomeKeyFailure,
+	CategoryInsufficientBalance: OutcomeKeyFailure,
+	CategoryRateLimited:         OutcomeKeyFailure,
+	CategoryServerError:         OutcomeKeyFailure,
+	CategoryUnknown:             OutcomeKeyFailure,
+}
+
+// 上游返回的上下文过长错误中常见的描述
+var contextLengthErrorPatterns = []string{
+	"context length",
+	"context_length",
+	"context window",
+	"maximum context",
+	"too many tokens",
+	"prompt is too long",
+	"input is too long",
+	"reduce the length",
+	"上下文长度",
+}
+
+// 上游返回的内容审核错误中常见的描述
+var contentPolicyErrorPatterns = []string{
+	"content_policy",
+	"content policy",
+	"content_filter",
+	"safety system",
+	"sensitive",
+	"敏感",
+	"内容安全",
+}
+
+// 400错误中表示密钥本身有问题的描述，这类错误仍计入密钥失败
+var keyErrorPatterns = []string{
+	"insufficient balance",
+	"insufficient_balance",
+	"balance is insufficient",
+	"余额不足",
+	"invalid api key",
+	"invalid_api_key",
+	"api key is invalid",
+}
+
+// ClassifyResponse 根据状态码和响应内容对上游响应分类
+func ClassifyResponse(statusCode int, body []byte) ResponseCategory {
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		return CategorySuccess
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		// 硅基流动余额不足时返回403
+		if mentionsBalance(strings.ToLower(string(body))) {
+			return CategoryInsufficientBalance
+		}
+		return CategoryAuth
+	case statusCode == http.StatusPaymentRequired:
+		return CategoryInsufficientBalance
+	case statusCode == http.StatusTooManyRequests:
+		return CategoryRateLimited
+	case statusCode == http.StatusRequestEntityTooLarge:
+		return CategoryContextLength
+	case statusCode == http.StatusNotFound:
+		return CategoryNotFound
+	case statusCode == http.StatusUnavailableForLegalReasons:
+		return CategoryContentPolicy
+	case statusCode >= 500:
+		return CategoryServerError
+	}
+
+	if statusCode != http.StatusBadRequest && statusCode != http.StatusUnprocessableEntity {
+		return CategoryUnknown
+	}
+
+	lower := strings.ToLower(string(body))
+	if containsAny(lower, keyErrorPatterns) {
+		if mentionsBalance(lower) {
+			return CategoryInsufficientBalance
+		}
+		return CategoryAuth
+	}
+	if containsAny(lower, contextLengthErrorPatterns) {
+		return CategoryContextLength
+	}
+	if containsAny(lower, contentPolicyErrorPatterns) {
+		return CategoryContentPolicy
+	}
+	return CategoryInvalidRequest
+}
+
+// OutcomeOf 获取响应分类对密钥健康状态的影响，未配置的分类计入密钥失败
+func OutcomeOf(category ResponseCategory) KeyOutcome {
+	if outcome, ok := categoryOutcomes[category]; ok {
+		return outcome
+	}
+	return OutcomeKeyFailure
+}
+
+// IsKeyInvalidResponse 判断上游的响应是否说明密钥已失效（401或余额不足），403可能只是没有该模型的权限，不视为失效
+func IsKeyInvalidResponse(statusCode int, category ResponseCategory) bool {
+	if category == CategoryInsufficientBalance {
+		return true
+	}
+	return category == CategoryAuth && statusCode != http.StatusForbidden
+}
+
+// RecordResponseOutcome 根据上游响应更新密钥状态和断路器，客户端错误只计入总调用次数
+// 密钥已失效时立即禁用，不等待下一次余额检查
+func RecordResponseOutcome(key string, statusCode int, body []byte) ResponseCategory {
+	category := ClassifyResponse(statusCode, body)
+	switch OutcomeOf(category) {
+	case OutcomeSuccess:
+		UpdateApiKeyStatus(key, true)
+	case OutcomeClientError:
+		config.UpdateApiKeyClientError(key)
+	default:
+		UpdateApiKeyStatus(key, false)
+	}
+	recordCircuitResponse(key, category)
+	if IsKeyInvalidResponse(statusCode, category) {
+		logger.Warn("密钥 %s 返回 %s（状态码 %d），立即禁用该密钥", MaskKey(key), category, statusCode)
+		config.DisableApiKey(key)
+	}
+	return category
+}
+
+// mentionsBalance 检查错误描述是否与余额有关
+func mentionsBalance(lower string) bool {
+	return strings.Contains(lower, "balance") || strings.Contains(lower, "余额")
+}
+
+// containsAny 检查文本中是否包含任一描述
+func containsAny(text string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.Contains(text, pattern) {
+			return true
+		}
+	}
+	return false
+}
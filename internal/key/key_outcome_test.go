@@ -0,0 +1,100 @@
+package key
+
+import (
+	"net/http"
+	"testing"
+
+	"flowsilicon/internal/config"
+)
+
+func TestClassifyResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   ResponseCategory
+	}{
+		{"成功", http.StatusOK, `{}`, CategorySuccess},
+		{"格式错误的工具定义", http.StatusBadRequest, `{"message":"invalid tools schema"}`, CategoryInvalidRequest},
+		{"上下文过长", http.StatusBadRequest, `{"message":"This model's maximum context length is 32768 tokens"}`, CategoryContextLength},
+		{"请求体过大", http.StatusRequestEntityTooLarge, ``, CategoryContextLength},
+		{"内容审核", http.StatusBadRequest, `{"message":"blocked by content_filter"}`, CategoryContentPolicy},
+		{"451内容审核", http.StatusUnavailableForLegalReasons, ``, CategoryContentPolicy},
+		{"模型不存在", http.StatusNotFound, `{"message":"model not found"}`, CategoryNotFound},
+		{"400中的余额不足", http.StatusBadRequest, `{"message":"Insufficient balance"}`, CategoryInsufficientBalance},
+		{"400中的无效密钥", http.StatusBadRequest, `{"message":"Invalid API key"}`, CategoryAuth},
+		{"401", http.StatusUnauthorized, ``, CategoryAuth},
+		{"403余额不足", http.StatusForbidden, `{"message":"账户余额不足"}`, CategoryInsufficientBalance},
+		{"402", http.StatusPaymentRequired, ``, CategoryInsufficientBalance},
+		{"限流", http.StatusTooManyRequests, ``, CategoryRateLimited},
+		{"服务错误", http.StatusBadGateway, ``, CategoryServerError},
+		{"其他状态码", http.StatusConflict, ``, CategoryUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyResponse(tt.status, []byte(tt.body)); got != tt.want {
+				t.Errorf("ClassifyResponse(%d, %s) = %s, want %s", tt.status, tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+// 分类对密钥健康状态的影响只在categoryOutcomes中配置
+func TestCategoryOutcomes(t *testing.T) {
+	want := map[ResponseCategory]KeyOutcome{
+		CategorySuccess:             OutcomeSuccess,
+		CategoryInvalidRequest:      OutcomeClientError,
+		CategoryContextLength:       OutcomeClientError,
+		CategoryContentPolicy:       OutcomeClientError,
+		CategoryNotFound:            OutcomeClientError,
+		CategoryAuth:                OutcomeKeyFailure,
+		CategoryInsufficientBalance: OutcomeKeyFailure,
+		CategoryRateLimited:         OutcomeKeyFailure,
+		CategoryServerError:         OutcomeKeyFailure,
+		CategoryUnknown:             OutcomeKeyFailure,
+	}
+	if len(categoryOutcomes) != len(want) {
+		t.Errorf("categoryOutcomes has %d categories, want %d", len(categoryOutcomes), len(want))
+	}
+	for category, outcome := range want {
+		if got := OutcomeOf(category); got != outcome {
+			t.Errorf("OutcomeOf(%s) = %d, want %d", category, got, outcome)
+		}
+	}
+	if got := OutcomeOf("new_category"); got != OutcomeKeyFailure {
+		t.Errorf("OutcomeOf(unconfigured) = %d, want OutcomeKeyFailure", got)
+	}
+}
+
+// 客户端错误计入总调用次数，不影响成功率和连续失败次数
+func TestRecordResponseOutcomeClientErrors(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.MaxConsecutiveFailures = 5
+	config.UpdateConfig(cfg)
+	config.ReplaceApiKeys([]config.ApiKey{{ID: 1, Key: "sk-outcome", Balance: 10}})
+	t.Cleanup(func() {
+		config.ReplaceApiKeys(nil)
+		config.UpdateConfig(&config.Config{})
+	})
+
+	RecordResponseOutcome("sk-outcome", http.StatusOK, nil)
+	for i := 0; i < 10; i++ {
+		RecordResponseOutcome("sk-outcome", http.StatusBadRequest, []byte(`{"message":"invalid tools schema"}`))
+	}
+	RecordResponseOutcome("sk-outcome", http.StatusInternalServerError, nil)
+
+	k, ok := GetKeyPool().Find("sk-outcome")
+	if !ok {
+		t.Fatal("key not found")
+	}
+	if k.TotalCalls != 12 || k.SuccessCalls != 1 || k.ClientErrors != 10 || k.KeyFailures() != 1 {
+		t.Errorf("counters = total %d, success %d, client %d, key failures %d; want 12, 1, 10, 1",
+			k.TotalCalls, k.SuccessCalls, k.ClientErrors, k.KeyFailures())
+	}
+	if k.SuccessRate != 0.5 {
+		t.Errorf("SuccessRate = %v, want 0.5", k.SuccessRate)
+	}
+	if k.ConsecutiveFailures != 1 || k.Disabled {
+		t.Errorf("ConsecutiveFailures = %d, Disabled = %v; want 1, false", k.ConsecutiveFailures, k.Disabled)
+	}
+}
@@ -0,0 +1,51 @@
+/**
+  @author: Hanhai
+  @desc: 暂停和恢复密钥选择，维护期间停止向任何密钥分发请求，不修改各密钥的启用状态
+**/
+
+package key
+
+import (
+	"flowsilicon/internal/common"
+	"flowsilicon/internal/logger"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSelectionPaused 密钥选择已暂停
+var ErrSelectionPaused = common.NewApiError("密钥选择已暂停，服务正在维护", 503)
+
+var (
+	selectionPaused   atomic.Bool
+	selectionPausedAt atomic.Int64 // 暂停时间（Unix秒）
+)
+
+// PauseKeySelection 暂停密钥选择，之后选择密钥时返回ErrSelectionPaused，程序重启后恢复
+func PauseKeySelection() {
+	if selectionPaused.CompareAndSwap(false, true) {
+		selectionPausedAt.Store(time.Now().Unix())
+		logger.Warn("已暂停密钥选择，代理请求将被拒绝，直到恢复密钥选择")
+	}
+}
+
+// ResumeKeySelection 恢复密钥选择
+func ResumeKeySelection() {
+	if selectionPaused.CompareAndSwap(true, false) {
+		pausedFor := time.Since(time.Unix(selectionPausedAt.Load(), 0)).Round(time.Second)
+		selectionPausedAt.Store(0)
+		logger.Warn("已恢复密钥选择，暂停了%s", pausedFor)
+	}
+}
+
+// IsKeySelectionPaused 检查密钥选择是否已暂停
+func IsKeySelectionPaused() bool {
+	return selectionPaused.Load()
+}
+
+// GetKeySelectionPausedAt 获取暂停密钥选择的时间（Unix秒），未暂停时返回0
+func GetKeySelectionPausedAt() int64 {
+	if !selectionPaused.Load() {
+		return 0
+	}
+	return selectionPausedAt.Load()
+}
@@ -0,0 +1,156 @@
+/**
+  @author: Hanhai
+  @desc: 密钥池的一致性快照，同一次处理中读取的密钥列表、可用密钥和按密钥查找的结果来自同一时刻的密钥池
+**/
+
+package key
+
+import (
+	"flowsilicon/internal/config"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KeyPoolSnapshot 某一时刻密钥池的只读快照，复制快照只复制指针
+// 快照中的切片被所有调用方共享，不能修改元素，追加元素时会复制到新的数组
+type KeyPoolSnapshot struct {
+	state *keyPoolState
+}
+
+// keyPoolState 快照的内容，创建后不再修改
+type keyPoolState struct {
+	generation   uint64
+	createdAt    time.Time
+	minBalance   float64 // 计算可用密钥时使用的最低余额阈值
+	keys         []config.ApiKey
+	activeKeys   []config.ApiKey
+	disabledKeys []config.ApiKey
+	index        map[string]int // 密钥到keys下标的映射
+	err          error          // 密钥池尚未加载时为config.ErrKeysNotInitialised
+}
+
+var (
+	// 最近一次创建的快照，密钥池的修改代数和最低余额阈值都未变化时直接返回
+	currentKeyPool atomic.Value // *keyPoolState
+	// 保证同一代数的快照只创建一次
+	keyPoolBuildMutex sync.Mutex
+)
+
+// GetKeyPool 获取密钥池的一致性快照，密钥池未修改时只复制指针
+// 密钥池修改后的第一次调用复制一次密钥池，之后的调用共享该快照
+func GetKeyPool() KeyPoolSnapshot {
+	minBalance := getMinBalanceThreshold()
+	if state, ok := currentKeyPool.Load().(*keyPoolState); ok && isKeyPoolStateCurrent(state, minBalance) {
+		return KeyPoolSnapshot{state: state}
+	}
+
+	keyPoolBuildMutex.Lock()
+	defer keyPoolBuildMutex.Unlock()
+
+	// 等待锁期间其他调用可能已经创建了快照
+	if state, ok := currentKeyPool.Load().(*keyPoolState); ok && isKeyPoolStateCurrent(state, minBalance) {
+		return KeyPoolSnapshot{state: state}
+	}
+
+	state := buildKeyPoolState(minBalance)
+	currentKeyPool.Store(state)
+	return KeyPoolSnapshot{state: state}
+}
+
+// isKeyPoolStateCurrent 检查快照是否与密钥池当前的修改代数和最低余额阈值一致
+func isKeyPoolStateCurrent(state *keyPoolState, minBalance float64) bool {
+	return state.generation == config.GetKeyPoolGeneration() && state.minBalance == minBalance
+}
+
+// getMinBalanceThreshold 获取当前配置的最低余额阈值
+func getMinBalanceThreshold() float64 {
+	if cfg := config.GetConfig(); cfg != nil {
+		return cfg.App.MinBalanceThreshold
+	}
+	return 0
+}
+
+// buildKeyPoolState 复制密钥池并按同一份副本计算可用密钥、禁用密钥和索引
+func buildKeyPoolState(minBalance float64) *keyPoolState {
+	keys, generation, err := config.GetKeyPoolState()
+	state := &keyPoolState{
+		generation:   generation,
+		err:          err,
+		createdAt:    time.Now(),
+		minBalance:   minBalance,
+		keys:         keys,
+		activeKeys:   make([]config.ApiKey, 0, len(keys)),
+		disabledKeys: make([]config.ApiKey, 0),
+		index:        make(map[string]int, len(keys)),
+	}
+	for i, k := range keys {
+		state.index[k.Key] = i
+		if k.Disabled {
+			state.disabledKeys = append(state.disabledKeys, k)
+		} else if k.HasSufficientBalance(minBalance) {
+			state.activeKeys = append(state.activeKeys, k)
+		}
+	}
+	return state
+}
+
+// Err 密钥池尚未加载时返回config.ErrKeysNotInitialised，此时快照中没有密钥
+func (s KeyPoolSnapshot) Err() error {
+	if s.state == nil {
+		return config.ErrKeysNotInitialised
+	}
+	return s.state.err
+}
+
+// Generation 获取快照对应的密钥池修改代数
+func (s KeyPoolSnapshot) Generation() uint64 {
+	if s.state == nil {
+		return 0
+	}
+	return s.state.generation
+}
+
+// CreatedAt 获取快照的创建时间
+func (s KeyPoolSnapshot) CreatedAt() time.Time {
+	if s.state == nil {
+		return time.Time{}
+	}
+	return s.state.createdAt
+}
+
+// Keys 获取未删除的所有密钥，与config.GetApiKeys相同，但不能修改
+func (s KeyPoolSnapshot) Keys() []config.ApiKey {
+	if s.state == nil {
+		return nil
+	}
+	return s.state.keys[:len(s.state.keys):len(s.state.keys)]
+}
+
+// ActiveKeys 获取未禁用且余额充足的密钥，与config.GetActiveApiKeys相同，但不能修改
+func (s KeyPoolSnapshot) ActiveKeys() []config.ApiKey {
+	if s.state == nil {
+		return nil
+	}
+	return s.state.activeKeys[:len(s.state.activeKeys):len(s.state.activeKeys)]
+}
+
+// DisabledKeys 获取禁用的密钥，与config.GetDisabledApiKeys相同，但不能修改
+func (s KeyPoolSnapshot) DisabledKeys() []config.ApiKey {
+	if s.state == nil {
+		return nil
+	}
+	return s.state.disabledKeys[:len(s.state.disabledKeys):len(s.state.disabledKeys)]
+}
+
+// Find 按密钥查找快照中的密钥
+func (s KeyPoolSnapshot) Find(apiKey string) (config.ApiKey, bool) {
+	if s.state == nil {
+		return config.ApiKey{}, false
+	}
+	i, ok := s.state.index[apiKey]
+	if !ok {
+		return config.ApiKey{}, false
+	}
+	return s.state.keys[i], true
+}
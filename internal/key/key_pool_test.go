@@ -0,0 +1,57 @@
+package key
+
+import (
+	"errors"
+	"testing"
+
+	"flowsilicon/internal/config"
+)
+
+func TestKeyPoolNotInitialised(t *testing.T) {
+	config.UpdateConfig(&config.Config{})
+	if GetKeyPool().Err() == nil {
+		t.Skip("密钥池已被其他测试加载")
+	}
+
+	selections := map[string]func() error{
+		"SelectKeyWithDecision": func() error {
+			_, _, err := SelectKeyWithDecision("completion", "", 0, nil)
+			return err
+		},
+		"GetOptimalApiKeyWithRoundRobin": func() error {
+			_, err := GetOptimalApiKeyWithRoundRobin()
+			return err
+		},
+		"GetOptimalApiKeyWithScore": func() error {
+			_, _, err := GetOptimalApiKeyWithScore()
+			return err
+		},
+		"GetNextApiKey": func() error {
+			_, err := GetNextApiKey()
+			return err
+		},
+		"GetKeyFromGroup": func() error {
+			_, err := GetKeyFromGroup("default")
+			return err
+		},
+	}
+	for name, selection := range selections {
+		if err := selection(); !errors.Is(err, config.ErrKeysNotInitialised) {
+			t.Errorf("%s 返回 %v，期望 ErrKeysNotInitialised", name, err)
+		}
+	}
+
+	// 加载密钥池后修改代数变化，快照重建后不再返回错误
+	config.ReplaceApiKeys([]config.ApiKey{{ID: 1, Key: "sk-loaded", Balance: 10}})
+	pool := GetKeyPool()
+	if err := pool.Err(); err != nil {
+		t.Fatalf("加载后 Err() = %v", err)
+	}
+	if len(pool.Keys()) != 1 {
+		t.Fatalf("加载后密钥数量 = %d，期望 1", len(pool.Keys()))
+	}
+	key, err := GetOptimalApiKeyWithRoundRobin()
+	if err != nil || key != "sk-loaded" {
+		t.Fatalf("加载后选择密钥 = %q, %v", key, err)
+	}
+}
@@ -0,0 +1,74 @@
+/**
+  @author: Hanhai
+  @desc: 密钥限流，按固定窗口的RPM/TPM用量过滤已达到上限的密钥
+**/
+
+package key
+
+import (
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+)
+
+// RateLimitWindow 密钥的固定窗口用量计数，定义在config包中以便作为ApiKey的字段
+type RateLimitWindow = config.RateLimitWindow
+
+// filterRateLimitedKeys 过滤掉当前窗口内RPM或TPM已达到上限的密钥
+// 所有密钥都达到上限时返回原列表，由上游决定是否限流，避免请求在本地直接失败
+func filterRateLimitedKeys(keys []config.ApiKey) []config.ApiKey {
+	cfg := config.GetConfig()
+	if cfg == nil || (cfg.App.KeyRPMLimit <= 0 && cfg.App.KeyTPMLimit <= 0) {
+		return keys
+	}
+
+	available := make([]config.ApiKey, 0, len(keys))
+	for _, k := range keys {
+		rpm, tpm := currentLimitWindows(k)
+		if rpm.Available() > 0 && tpm.Available() > 0 {
+			available = append(available, k)
+		}
+	}
+
+	if len(available) == 0 && len(keys) > 0 {
+		logger.Warn("所有可用密钥都已达到每分钟限流上限 (RPM: %d, TPM: %d)，忽略本地限流",
+			cfg.App.KeyRPMLimit, cfg.App.KeyTPMLimit)
+		return keys
+	}
+	return available
+}
+
+// IsKeyRateLimited 检查密钥当前窗口内RPM或TPM是否已达到上限
+// 已达到上限时返回true和距离可再次使用的时间，未达到上限或密钥不存在时返回false和0
+func IsKeyRateLimited(keyID int) (bool, time.Duration) {
+	k, ok := config.GetApiKeyByID(keyID)
+	if !ok {
+		return false, 0
+	}
+
+	rpm, tpm := currentLimitWindows(k)
+	var wait time.Duration
+	limited := false
+	for _, window := range []RateLimitWindow{rpm, tpm} {
+		if window.Available() > 0 {
+			continue
+		}
+		limited = true
+		if remaining := window.Remaining(); remaining > wait {
+			wait = remaining
+		}
+	}
+	return limited, wait
+}
+
+// currentLimitWindows 获取按当前配置的RPM/TPM上限设置Limit的窗口副本
+// 窗口中的Limit只在记录用量时更新，没有使用过的密钥为0，修改上限后在下一次调用前仍是旧值
+func currentLimitWindows(k config.ApiKey) (RateLimitWindow, RateLimitWindow) {
+	rpm, tpm := k.RPM, k.TPM
+	if cfg := config.GetConfig(); cfg != nil {
+		rpm.Limit = cfg.App.KeyRPMLimit
+		tpm.Limit = cfg.App.KeyTPMLimit
+	}
+	return rpm, tpm
+}
@@ -0,0 +1,47 @@
+package key
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"flowsilicon/internal/config"
+)
+
+// 窗口中的Limit只在记录用量时更新，限流、模拟和综合加权得分都需要使用当前配置的上限
+func TestRateLimitUsesConfiguredLimit(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.KeyRPMLimit = 10
+	cfg.App.KeyTPMLimit = 1000
+	config.UpdateConfig(cfg)
+	t.Cleanup(func() { config.UpdateConfig(&config.Config{}) })
+
+	now := time.Now()
+	unused := config.ApiKey{ID: 1, Key: "sk-unused"}
+	full := config.ApiKey{ID: 2, Key: "sk-full", RPM: RateLimitWindow{Used: 10, WindowStart: now}}
+	stale := config.ApiKey{ID: 3, Key: "sk-stale", RPM: RateLimitWindow{Used: 5, WindowStart: now, Limit: 100}}
+	config.ReplaceApiKeys([]config.ApiKey{unused, full, stale})
+
+	available := filterRateLimitedKeys([]config.ApiKey{unused, full, stale})
+	if len(available) != 2 || available[0].Key != "sk-unused" || available[1].Key != "sk-stale" {
+		t.Fatalf("filterRateLimitedKeys = %v, want sk-unused and sk-stale", available)
+	}
+
+	if limited, wait := IsKeyRateLimited(full.ID); !limited || wait <= 0 {
+		t.Errorf("IsKeyRateLimited(full) = %v, %v, want true and a positive wait", limited, wait)
+	}
+	if limited, _ := IsKeyRateLimited(unused.ID); limited {
+		t.Errorf("IsKeyRateLimited(unused) = true, want false")
+	}
+
+	for _, sk := range newSimKeys([]config.ApiKey{unused, stale}) {
+		if sk.rpmLimit != 10 || sk.tpmLimit != 1000 {
+			t.Errorf("sim key limits = %d/%d, want 10/1000", sk.rpmLimit, sk.tpmLimit)
+		}
+	}
+
+	rpm, _ := currentLimitWindows(stale)
+	if score := windowHeadroomScore(rpm, 5); math.Abs(score-0.5) > 1e-9 {
+		t.Errorf("windowHeadroomScore(stale) = %v, want 0.5", score)
+	}
+}
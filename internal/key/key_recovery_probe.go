@@ -0,0 +1,212 @@
+/**
+  @author: Hanhai
+  @desc: 禁用密钥的恢复探测计划，刚禁用时频繁探测，之后间隔逐渐延长到每天一次，禁用原因变化时重新开始，超过设置的时间仍未恢复时放弃恢复，等待手动处理
+**/
+
+package key
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+)
+
+// 恢复探测的间隔，依次使用，用完后保持最后一个间隔
+var recoveryProbeIntervals = []time.Duration{
+	1 * time.Minute,
+	2 * time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	1 * time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+
+const (
+	// 检查是否有密钥需要探测的间隔，不大于最短的探测间隔
+	recoveryProbeTick = time.Minute
+	// 未设置时放弃恢复的时间（小时）
+	defaultRecoveryGiveUpHours = 168
+)
+
+// 密钥的禁用原因，由密钥当前的状态推断
+const (
+	DisableReasonLowBalance = "low_balance" // 余额低于最低阈值
+	DisableReasonFailures   = "failures"    // 连续失败或上游返回密钥失效
+)
+
+// 恢复探测的状态
+const (
+	RecoveryStatusProbing = "探测中"
+	RecoveryStatusGaveUp  = "放弃恢复"
+)
+
+// recoveryProbe 一个禁用密钥的恢复探测计划
+type recoveryProbe struct {
+	keyID      int
+	disabledAt int64     // 计划对应的禁用时间，重新禁用时重新开始
+	reason     string    // 计划对应的禁用原因，变化时重新开始
+	since      time.Time // 计划开始的时间，放弃恢复的时间从这里开始计算
+	attempts   int       // 已经探测的次数
+	nextProbe  time.Time // 下一次探测的时间
+	gaveUp     bool      // 是否已放弃恢复
+}
+
+// RecoveryProbeInfo 禁用密钥的恢复探测计划，用于密钥列表接口
+type RecoveryProbeInfo struct {
+	KeyID           int    `json:"key_id"`
+	Reason          string `json:"reason"`
+	Status          string `json:"status"`
+	Attempts        int    `json:"attempts"`
+	ScheduleMinutes []int  `json:"schedule_minutes"` // 各次探测的间隔（分钟），用完后保持最后一个间隔
+	Since           int64  `json:"since"`
+	NextProbeAt     int64  `json:"next_probe_at"` // 放弃恢复后为0
+	GiveUpAt        int64  `json:"give_up_at"`
+}
+
+var (
+	recoveryProbes     = make(map[string]*recoveryProbe)
+	recoveryProbeMutex sync.Mutex
+)
+
+// getRecoveryGiveUpPeriod 获取放弃恢复的时间
+func getRecoveryGiveUpPeriod() time.Duration {
+	hours := defaultRecoveryGiveUpHours
+	if cfg := config.GetConfig(); cfg != nil && cfg.App.RecoveryGiveUpHours > 0 {
+		hours = cfg.App.RecoveryGiveUpHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// recoveryProbeInterval 获取第attempts次探测之后到下一次探测的间隔
+func recoveryProbeInterval(attempts int) time.Duration {
+	if attempts >= len(recoveryProbeIntervals) {
+		return recoveryProbeIntervals[len(recoveryProbeIntervals)-1]
+	}
+	return recoveryProbeIntervals[attempts]
+}
+
+// disableReasonOf 推断密钥的禁用原因，跟踪余额且余额低于阈值时为余额不足，否则为连续失败
+func disableReasonOf(k config.ApiKey) string {
+	threshold := 0.0
+	if cfg := config.GetConfig(); cfg != nil {
+		threshold = cfg.App.MinBalanceThreshold
+	}
+	if k.IsBalanceTracked() && k.Balance < threshold {
+		return DisableReasonLowBalance
+	}
+	return DisableReasonFailures
+}
+
+// newRecoveryProbe 为禁用的密钥创建探测计划，计划从禁用时间开始，重启前已经过去的探测不再补做，只在有错过的探测时立即探测一次
+func newRecoveryProbe(k config.ApiKey, reason string, now time.Time) *recoveryProbe {
+	since := time.Unix(k.DisabledAt, 0)
+	if k.DisabledAt <= 0 || since.After(now) {
+		since = now
+	}
+	probe := &recoveryProbe{keyID: k.ID, disabledAt: k.DisabledAt, reason: reason, since: since}
+
+	next := since.Add(recoveryProbeInterval(0))
+	for !next.After(now) {
+		probe.attempts++
+		next = next.Add(recoveryProbeInterval(probe.attempts))
+	}
+	if probe.attempts > 0 {
+		probe.attempts--
+		next = now
+	}
+	probe.nextProbe = next
+	return probe
+}
+
+// dueRecoveryProbes 更新禁用密钥的探测计划，返回now时需要探测的密钥，返回的密钥的下一次探测时间已按计划推后
+// 不再禁用的密钥删除探测计划，禁用时间或禁用原因变化的密钥重新开始探测计划
+func dueRecoveryProbes(disabledKeys []config.ApiKey, now time.Time) []config.ApiKey {
+	giveUp := getRecoveryGiveUpPeriod()
+
+	recoveryProbeMutex.Lock()
+	defer recoveryProbeMutex.Unlock()
+
+	seen := make(map[string]bool, len(disabledKeys))
+	var due []config.ApiKey
+	for _, k := range disabledKeys {
+		if k.Delete {
+			continue
+		}
+		seen[k.Key] = true
+		reason := disableReasonOf(k)
+
+		probe, ok := recoveryProbes[k.Key]
+		switch {
+		case !ok || probe.disabledAt != k.DisabledAt:
+			probe = newRecoveryProbe(k, reason, now)
+			recoveryProbes[k.Key] = probe
+		case probe.reason != reason:
+			logger.Info("恢复探测: API密钥 %s 的禁用原因从 %s 变为 %s，重新开始探测计划", MaskKey(k.Key), probe.reason, reason)
+			probe.reason = reason
+			probe.since = now
+			probe.attempts = 0
+			probe.nextProbe = now
+			probe.gaveUp = false
+		}
+
+		if probe.gaveUp {
+			continue
+		}
+		if now.Sub(probe.since) >= giveUp {
+			probe.gaveUp = true
+			logger.Warn("恢复探测: API密钥 %s 禁用超过 %v 仍未恢复，放弃恢复，等待手动处理", MaskKey(k.Key), giveUp)
+			continue
+		}
+		if now.Before(probe.nextProbe) {
+			continue
+		}
+
+		probe.nextProbe = now.Add(recoveryProbeInterval(probe.attempts + 1))
+		probe.attempts++
+		due = append(due, k)
+	}
+
+	for apiKey := range recoveryProbes {
+		if !seen[apiKey] {
+			delete(recoveryProbes, apiKey)
+		}
+	}
+	return due
+}
+
+// GetRecoveryProbes 获取禁用密钥的恢复探测计划，按密钥ID排序，还没有检查过的禁用密钥不包括在内
+func GetRecoveryProbes() []RecoveryProbeInfo {
+	giveUp := getRecoveryGiveUpPeriod()
+	schedule := make([]int, len(recoveryProbeIntervals))
+	for i, interval := range recoveryProbeIntervals {
+		schedule[i] = int(interval / time.Minute)
+	}
+
+	recoveryProbeMutex.Lock()
+	infos := make([]RecoveryProbeInfo, 0, len(recoveryProbes))
+	for _, probe := range recoveryProbes {
+		info := RecoveryProbeInfo{
+			KeyID:           probe.keyID,
+			Reason:          probe.reason,
+			Status:          RecoveryStatusProbing,
+			Attempts:        probe.attempts,
+			ScheduleMinutes: schedule,
+			Since:           probe.since.Unix(),
+			NextProbeAt:     probe.nextProbe.Unix(),
+			GiveUpAt:        probe.since.Add(giveUp).Unix(),
+		}
+		if probe.gaveUp {
+			info.Status = RecoveryStatusGaveUp
+			info.NextProbeAt = 0
+		}
+		infos = append(infos, info)
+	}
+	recoveryProbeMutex.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].KeyID < infos[j].KeyID })
+	return infos
+}
@@ -0,0 +1,191 @@
+package key
+
+import (
+	"testing"
+	"time"
+
+	"flowsilicon/internal/config"
+)
+
+// 测试使用的固定时间，探测计划按传入的now计算，不依赖系统时间
+var probeEpoch = time.Unix(1700000000, 0)
+
+// resetRecoveryProbes 清空探测计划并设置放弃恢复的时间
+func resetRecoveryProbes(t *testing.T, giveUpHours int, minBalance float64) {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.App.RecoveryGiveUpHours = giveUpHours
+	cfg.App.MinBalanceThreshold = minBalance
+	config.UpdateConfig(cfg)
+
+	reset := func() {
+		recoveryProbeMutex.Lock()
+		recoveryProbes = make(map[string]*recoveryProbe)
+		recoveryProbeMutex.Unlock()
+	}
+	reset()
+	t.Cleanup(func() {
+		reset()
+		config.UpdateConfig(&config.Config{})
+	})
+}
+
+func TestRecoveryProbeInterval(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{2, 5 * time.Minute},
+		{3, 15 * time.Minute},
+		{6, 24 * time.Hour},
+		{7, 24 * time.Hour},
+		{100, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := recoveryProbeInterval(tt.attempts); got != tt.want {
+			t.Errorf("recoveryProbeInterval(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestNewRecoveryProbe(t *testing.T) {
+	resetRecoveryProbes(t, 0, 0)
+
+	tests := []struct {
+		name         string
+		disabledAt   time.Time
+		wantAttempts int
+		wantNext     time.Time
+	}{
+		{
+			name:       "刚禁用时1分钟后探测",
+			disabledAt: probeEpoch,
+			wantNext:   probeEpoch.Add(time.Minute),
+		},
+		{
+			name:       "没有禁用时间时从当前时间开始",
+			disabledAt: time.Time{},
+			wantNext:   probeEpoch.Add(time.Minute),
+		},
+		{
+			name:       "禁用时间晚于当前时间时从当前时间开始",
+			disabledAt: probeEpoch.Add(time.Hour),
+			wantNext:   probeEpoch.Add(time.Minute),
+		},
+		{
+			name:         "重启前错过的探测只立即补做一次",
+			disabledAt:   probeEpoch.Add(-10 * time.Minute),
+			wantAttempts: 2, // 错过了第1、3、8分钟的探测
+			wantNext:     probeEpoch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := config.ApiKey{ID: 1, Key: "sk-probe", Disabled: true}
+			if !tt.disabledAt.IsZero() {
+				k.DisabledAt = tt.disabledAt.Unix()
+			}
+			probe := newRecoveryProbe(k, DisableReasonFailures, probeEpoch)
+			if probe.attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", probe.attempts, tt.wantAttempts)
+			}
+			if !probe.nextProbe.Equal(tt.wantNext) {
+				t.Errorf("nextProbe = %v, want %v", probe.nextProbe.Sub(probeEpoch), tt.wantNext.Sub(probeEpoch))
+			}
+		})
+	}
+}
+
+// 按分钟推进时间，探测时间依次为禁用后1、3、8、23分钟，之后间隔逐渐延长
+func TestDueRecoveryProbesSchedule(t *testing.T) {
+	resetRecoveryProbes(t, 0, 0)
+
+	k := config.ApiKey{ID: 1, Key: "sk-probe", Disabled: true, DisabledAt: probeEpoch.Unix()}
+	var probedAt []int
+	for minute := 0; minute <= 90; minute++ {
+		now := probeEpoch.Add(time.Duration(minute) * time.Minute)
+		if len(dueRecoveryProbes([]config.ApiKey{k}, now)) > 0 {
+			probedAt = append(probedAt, minute)
+		}
+	}
+
+	want := []int{1, 3, 8, 23, 83}
+	if len(probedAt) != len(want) {
+		t.Fatalf("probed at minutes %v, want %v", probedAt, want)
+	}
+	for i := range want {
+		if probedAt[i] != want[i] {
+			t.Fatalf("probed at minutes %v, want %v", probedAt, want)
+		}
+	}
+}
+
+// 禁用原因变化时重新开始探测计划，立即探测一次
+func TestDueRecoveryProbesReasonChange(t *testing.T) {
+	resetRecoveryProbes(t, 0, 1)
+
+	k := config.ApiKey{ID: 1, Key: "sk-probe", Disabled: true, DisabledAt: probeEpoch.Unix(), Balance: 0, BalanceMode: config.BalanceModeUntracked}
+	for minute := 0; minute <= 30; minute++ {
+		dueRecoveryProbes([]config.ApiKey{k}, probeEpoch.Add(time.Duration(minute)*time.Minute))
+	}
+
+	// 开始跟踪余额后余额低于阈值，禁用原因从连续失败变为余额不足
+	k.BalanceMode = ""
+	now := probeEpoch.Add(31 * time.Minute)
+	if due := dueRecoveryProbes([]config.ApiKey{k}, now); len(due) != 1 {
+		t.Fatalf("due after reason change = %d keys, want 1", len(due))
+	}
+
+	probes := GetRecoveryProbes()
+	if len(probes) != 1 {
+		t.Fatalf("len(GetRecoveryProbes()) = %d, want 1", len(probes))
+	}
+	if probes[0].Reason != DisableReasonLowBalance || probes[0].Attempts != 1 || probes[0].Since != now.Unix() {
+		t.Errorf("probe = %+v, want a restarted low_balance schedule", probes[0])
+	}
+	if want := now.Add(2 * time.Minute).Unix(); probes[0].NextProbeAt != want {
+		t.Errorf("NextProbeAt = %d, want %d", probes[0].NextProbeAt, want)
+	}
+}
+
+// 超过放弃恢复的时间后不再探测，重新启用的密钥删除探测计划
+func TestDueRecoveryProbesGiveUp(t *testing.T) {
+	resetRecoveryProbes(t, 1, 0)
+
+	k := config.ApiKey{ID: 1, Key: "sk-probe", Disabled: true, DisabledAt: probeEpoch.Unix()}
+	dueRecoveryProbes([]config.ApiKey{k}, probeEpoch)
+
+	tests := []struct {
+		name       string
+		offset     time.Duration
+		wantDue    bool
+		wantStatus string
+	}{
+		{"放弃恢复前按计划探测", 59 * time.Minute, true, RecoveryStatusProbing},
+		{"超过放弃恢复的时间", 60 * time.Minute, false, RecoveryStatusGaveUp},
+		{"放弃恢复后不再探测", 48 * time.Hour, false, RecoveryStatusGaveUp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			due := dueRecoveryProbes([]config.ApiKey{k}, probeEpoch.Add(tt.offset))
+			if (len(due) > 0) != tt.wantDue {
+				t.Errorf("due = %v, want %v", len(due) > 0, tt.wantDue)
+			}
+			probes := GetRecoveryProbes()
+			if len(probes) != 1 || probes[0].Status != tt.wantStatus {
+				t.Fatalf("probes = %+v, want status %s", probes, tt.wantStatus)
+			}
+			if tt.wantStatus == RecoveryStatusGaveUp && probes[0].NextProbeAt != 0 {
+				t.Errorf("NextProbeAt = %d, want 0 after giving up", probes[0].NextProbeAt)
+			}
+		})
+	}
+
+	dueRecoveryProbes(nil, probeEpoch.Add(49*time.Hour))
+	if probes := GetRecoveryProbes(); len(probes) != 0 {
+		t.Errorf("probes after the key was enabled = %+v, want none", probes)
+	}
+}
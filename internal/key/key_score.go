@@ -28,7 +28,7 @@ func CalculateKeyScores(allKeys []config.ApiKey) []KeyWithScore {
 	// 先过滤出未禁用且余额充足的密钥
 	var activeKeys []config.ApiKey
 	for _, k := range allKeys {
-		if !k.Disabled && k.Balance >= minBalanceThreshold {
+		if !k.Disabled && k.HasSufficientBalance(minBalanceThreshold) {
 			activeKeys = append(activeKeys, k)
 		}
 	}
@@ -42,11 +42,11 @@ func CalculateKeyScores(allKeys []config.ApiKey) []KeyWithScore {
 	var maxRPM, maxTPM int
 
 	for _, k := range activeKeys {
-		if k.RequestsPerMinute > maxRPM {
-			maxRPM = k.RequestsPerMinute
+		if k.RPM.Current() > maxRPM {
+			maxRPM = k.RPM.Current()
 		}
-		if k.TokensPerMinute > maxTPM {
-			maxTPM = k.TokensPerMinute
+		if k.TPM.Current() > maxTPM {
+			maxTPM = k.TPM.Current()
 		}
 	}
 
@@ -100,7 +100,7 @@ func CalculateKeyScores(allKeys []config.ApiKey) []KeyWithScore {
 	// 计算每个活跃密钥的得分
 	for _, k := range activeKeys {
 		// 1. 余额得分（余额越高，得分越高）
-		balanceScore := (k.Balance / maxBalance) * balanceWeight
+		balanceScore := k.BalanceRatio(maxBalance) * balanceWeight
 		if balanceScore > balanceWeight {
 			balanceScore = balanceWeight // 确保不超过权重上限
 		}
@@ -116,16 +116,16 @@ func CalculateKeyScores(allKeys []config.ApiKey) []KeyWithScore {
 
 		// 3. RPM得分（RPM越低，得分越高）
 		rpmScore := 0.0
-		if k.RequestsPerMinute > 0 {
-			rpmScore = (1 - float64(k.RequestsPerMinute)/float64(maxRPM)) * rpmWeight
+		if k.RPM.Current() > 0 {
+			rpmScore = (1 - float64(k.RPM.Current())/float64(maxRPM)) * rpmWeight
 		} else {
 			rpmScore = rpmWeight // 如果RPM为0，给予最高分
 		}
 
 		// 4. TPM得分（TPM越低，得分越高）
 		tpmScore := 0.0
-		if k.TokensPerMinute > 0 {
-			tpmScore = (1 - float64(k.TokensPerMinute)/float64(maxTPM)) * tpmWeight
+		if k.TPM.Current() > 0 {
+			tpmScore = (1 - float64(k.TPM.Current())/float64(maxTPM)) * tpmWeight
 		} else {
 			tpmScore = tpmWeight // 如果TPM为0，给予最高分
 		}
@@ -150,7 +150,7 @@ func CalculateKeyScores(allKeys []config.ApiKey) []KeyWithScore {
 
 	// 将禁用的密钥和余额不足的密钥添加到末尾
 	for _, k := range allKeys {
-		if k.Disabled || k.Balance < minBalanceThreshold {
+		if k.Disabled || !k.HasSufficientBalance(minBalanceThreshold) {
 			isExist := false
 			for _, ks := range keysWithScores {
 				if ks.Key.Key == k.Key {
@@ -173,7 +173,14 @@ func CalculateKeyScores(allKeys []config.ApiKey) []KeyWithScore {
 
 // GetOptimalApiKeyWithScore 获取得分最高的API密钥
 func GetOptimalApiKeyWithScore() (string, float64, error) {
-	activeKeys := config.GetActiveApiKeys()
+	if IsKeySelectionPaused() {
+		return "", 0, ErrSelectionPaused
+	}
+	pool := GetKeyPool()
+	if err := pool.Err(); err != nil {
+		return "", 0, err
+	}
+	activeKeys := selectableKeys(pool.ActiveKeys())
 
 	if len(activeKeys) == 0 {
 		return "", 0, common.ErrNoActiveKeys
@@ -0,0 +1,66 @@
+/**
+  @author: Hanhai
+  @desc: 密钥得分分布，将可用密钥按得分划分到等宽区间，用于判断密钥池的得分是否过于集中
+**/
+
+package key
+
+// 得分分布区间数量的默认值和上限
+const (
+	DefaultScoreBuckets = 10
+	MaxScoreBuckets     = 50
+)
+
+// KeyGroup 一个得分区间内的密钥
+type KeyGroup struct {
+	ScoreMin float64 `json:"score_min"` // 区间下限（包含）
+	ScoreMax float64 `json:"score_max"` // 区间上限，只有最后一个区间包含上限
+	KeyCount int     `json:"key_count"`
+	Keys     []int   `json:"keys"` // 区间内的密钥ID
+}
+
+// GroupKeysByScore 将可用密钥按得分划分到buckets个等宽区间，区间覆盖最低分到最高分
+// 所有密钥得分相同时只返回一个区间；buckets超出范围时使用默认值或上限
+func GroupKeysByScore(buckets int) []KeyGroup {
+	if buckets <= 0 {
+		buckets = DefaultScoreBuckets
+	}
+	if buckets > MaxScoreBuckets {
+		buckets = MaxScoreBuckets
+	}
+
+	scored := CalculateKeyScores(GetKeyPool().Keys())
+	if len(scored) == 0 {
+		return []KeyGroup{}
+	}
+
+	// CalculateKeyScores按得分降序返回
+	maxScore := scored[0].Score
+	minScore := scored[len(scored)-1].Score
+	if maxScore == minScore {
+		buckets = 1
+	}
+	width := (maxScore - minScore) / float64(buckets)
+
+	groups := make([]KeyGroup, buckets)
+	for i := range groups {
+		groups[i].ScoreMin = minScore + width*float64(i)
+		groups[i].ScoreMax = minScore + width*float64(i+1)
+		groups[i].Keys = make([]int, 0)
+	}
+	groups[buckets-1].ScoreMax = maxScore
+
+	for _, ks := range scored {
+		index := buckets - 1
+		if width > 0 {
+			index = int((ks.Score - minScore) / width)
+			if index >= buckets {
+				index = buckets - 1
+			}
+		}
+		groups[index].KeyCount++
+		groups[index].Keys = append(groups[index].Keys, ks.Key.ID)
+	}
+
+	return groups
+}
@@ -6,10 +6,12 @@
 package key
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
+	"flowsilicon/internal/cache"
 	"flowsilicon/internal/common"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/logger"
@@ -18,8 +20,11 @@ import (
 
 // 添加用于轮询的全局变量
 var (
-	// 记录每种策略的当前轮询索引
-	strategyRoundRobinIndex map[string]int = make(map[string]int)
+	// 记录每种策略的当前轮询索引，键中包含请求的模型名称，限制条目数避免随模型名称无限增长
+	strategyRoundRobinIndex = cache.New[string, int]("key_round_robin_index", cache.Options{
+		MaxEntries: 1000,
+		TTL:        24 * time.Hour,
+	}, nil)
 	// 互斥锁保护轮询索引的并发访问
 	rrMutex sync.Mutex
 )
@@ -35,8 +40,7 @@ func GetOptimalApiKey() (string, error) {
 type RequestType string
 
 // 获取任意可用密钥
-func getAnyAvailableKey() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getAnyAvailableKey(activeKeys []config.ApiKey) (string, error) {
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
@@ -44,17 +48,19 @@ func getAnyAvailableKey() (string, error) {
 }
 
 // 获取余额最高的密钥
-func getHighestBalanceKey() (string, error) {
-	return getHighestBalanceKeyWithRoundRobin()
+func getHighestBalanceKey(activeKeys []config.ApiKey) (string, error) {
+	return getHighestBalanceKeyWithRoundRobin(activeKeys)
 }
 
 // 获取余额最高的密钥（支持轮询）
-func getHighestBalanceKeyWithRoundRobin() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getHighestBalanceKeyWithRoundRobin(activeKeys []config.ApiKey) (string, error) {
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
 
+	// 未跟踪余额的密钥无法比较余额，只在没有其他密钥时参与选择
+	activeKeys = balanceTrackedKeys(activeKeys)
+
 	// 先找出最高余额值
 	var highestBalance float64 = -1
 	for _, key := range activeKeys {
@@ -88,7 +94,7 @@ func getHighestBalanceKeyWithRoundRobin() (string, error) {
 
 	// 记录当前轮询索引
 	rrMutex.Lock()
-	currentIndex := strategyRoundRobinIndex["high_balance"]
+	currentIndex, _ := strategyRoundRobinIndex.Get("high_balance")
 	rrMutex.Unlock()
 
 	logger.Info("轮询选择: 策略=high_balance, 当前索引=%d, 总密钥数=%d",
@@ -102,7 +108,7 @@ func getHighestBalanceKeyWithRoundRobin() (string, error) {
 
 	// 记录选中的密钥和更新后的索引
 	rrMutex.Lock()
-	newIndex := strategyRoundRobinIndex["high_balance"]
+	newIndex, _ := strategyRoundRobinIndex.Get("high_balance")
 	rrMutex.Unlock()
 
 	logger.Info("轮询结果: 策略=high_balance, 选择密钥=%s, 新索引=%d",
@@ -113,9 +119,22 @@ func getHighestBalanceKeyWithRoundRobin() (string, error) {
 	return selectedKey, nil
 }
 
+// balanceTrackedKeys 过滤出余额已知的密钥，全部未跟踪余额时返回原列表
+func balanceTrackedKeys(keys []config.ApiKey) []config.ApiKey {
+	tracked := make([]config.ApiKey, 0, len(keys))
+	for _, key := range keys {
+		if key.IsBalanceTracked() {
+			tracked = append(tracked, key)
+		}
+	}
+	if len(tracked) == 0 {
+		return keys
+	}
+	return tracked
+}
+
 // 获取历史成功率高的密钥
-func getHighSuccessRateKey(modelName string) (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getHighSuccessRateKey(activeKeys []config.ApiKey, modelName string) (string, error) {
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
@@ -123,7 +142,7 @@ func getHighSuccessRateKey(modelName string) (string, error) {
 	// 找出最高成功率
 	var bestRate float64 = -1
 	for _, key := range activeKeys {
-		if key.Balance < config.GetConfig().App.MinBalanceThreshold {
+		if !key.HasSufficientBalance(config.GetConfig().App.MinBalanceThreshold) {
 			continue
 		}
 
@@ -135,13 +154,13 @@ func getHighSuccessRateKey(modelName string) (string, error) {
 	// 收集所有具有最高成功率的密钥
 	var highSuccessKeys []config.ApiKey
 	for _, key := range activeKeys {
-		if key.Balance >= config.GetConfig().App.MinBalanceThreshold && key.SuccessRate == bestRate {
+		if key.HasSufficientBalance(config.GetConfig().App.MinBalanceThreshold) && key.SuccessRate == bestRate {
 			highSuccessKeys = append(highSuccessKeys, key)
 		}
 	}
 
 	if len(highSuccessKeys) == 0 {
-		return getAnyAvailableKey()
+		return getAnyAvailableKey(activeKeys)
 	}
 
 	// 增加详细日志
@@ -167,7 +186,7 @@ func getHighSuccessRateKey(modelName string) (string, error) {
 
 	// 记录当前轮询索引
 	rrMutex.Lock()
-	currentIndex := strategyRoundRobinIndex[strategyKey]
+	currentIndex, _ := strategyRoundRobinIndex.Get(strategyKey)
 	rrMutex.Unlock()
 
 	logger.Info("轮询选择: 策略=%s, 当前索引=%d, 总密钥数=%d",
@@ -177,7 +196,7 @@ func getHighSuccessRateKey(modelName string) (string, error) {
 
 	// 记录选中的密钥和更新后的索引
 	rrMutex.Lock()
-	newIndex := strategyRoundRobinIndex[strategyKey]
+	newIndex, _ := strategyRoundRobinIndex.Get(strategyKey)
 	rrMutex.Unlock()
 
 	logger.Info("轮询结果: 策略=%s, 选择密钥=%s, 新索引=%d",
@@ -188,14 +207,13 @@ func getHighSuccessRateKey(modelName string) (string, error) {
 }
 
 // 获取响应速度快的密钥
-func getFastResponseKey() (string, error) {
+func getFastResponseKey(activeKeys []config.ApiKey) (string, error) {
 	// 使用低RPM策略
-	return getLowRPMKey()
+	return getLowRPMKey(activeKeys)
 }
 
 // getLowRPMKey 获取RPM最低的密钥
-func getLowRPMKey() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getLowRPMKey(activeKeys []config.ApiKey) (string, error) {
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
@@ -203,25 +221,25 @@ func getLowRPMKey() (string, error) {
 	// 找出最低RPM值
 	var lowestRPM int = 999999
 	for _, key := range activeKeys {
-		if key.Balance < config.GetConfig().App.MinBalanceThreshold {
+		if !key.HasSufficientBalance(config.GetConfig().App.MinBalanceThreshold) {
 			continue
 		}
 
-		if key.RequestsPerMinute < lowestRPM {
-			lowestRPM = key.RequestsPerMinute
+		if key.RPM.Current() < lowestRPM {
+			lowestRPM = key.RPM.Current()
 		}
 	}
 
 	// 收集所有RPM最低的密钥
 	var lowestRPMKeys []config.ApiKey
 	for _, key := range activeKeys {
-		if key.Balance >= config.GetConfig().App.MinBalanceThreshold && key.RequestsPerMinute == lowestRPM {
+		if key.HasSufficientBalance(config.GetConfig().App.MinBalanceThreshold) && key.RPM.Current() == lowestRPM {
 			lowestRPMKeys = append(lowestRPMKeys, key)
 		}
 	}
 
 	if len(lowestRPMKeys) == 0 {
-		return getAnyAvailableKey()
+		return getAnyAvailableKey(activeKeys)
 	}
 
 	// 增加详细日志
@@ -241,7 +259,7 @@ func getLowRPMKey() (string, error) {
 
 	// 记录当前轮询索引
 	rrMutex.Lock()
-	currentIndex := strategyRoundRobinIndex["low_rpm"]
+	currentIndex, _ := strategyRoundRobinIndex.Get("low_rpm")
 	rrMutex.Unlock()
 
 	logger.Info("轮询选择: 策略=low_rpm, 当前索引=%d, 总密钥数=%d",
@@ -252,7 +270,7 @@ func getLowRPMKey() (string, error) {
 
 	// 记录选中的密钥和更新后的索引
 	rrMutex.Lock()
-	newIndex := strategyRoundRobinIndex["low_rpm"]
+	newIndex, _ := strategyRoundRobinIndex.Get("low_rpm")
 	rrMutex.Unlock()
 
 	logger.Info("轮询结果: 策略=low_rpm, 选择密钥=%s, 新索引=%d",
@@ -263,8 +281,7 @@ func getLowRPMKey() (string, error) {
 }
 
 // getLowTPMKey 获取TPM最低的密钥
-func getLowTPMKey() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getLowTPMKey(activeKeys []config.ApiKey) (string, error) {
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
@@ -272,25 +289,25 @@ func getLowTPMKey() (string, error) {
 	// 找出最低TPM值
 	var lowestTPM int = 999999
 	for _, key := range activeKeys {
-		if key.Balance < config.GetConfig().App.MinBalanceThreshold {
+		if !key.HasSufficientBalance(config.GetConfig().App.MinBalanceThreshold) {
 			continue
 		}
 
-		if key.TokensPerMinute < lowestTPM {
-			lowestTPM = key.TokensPerMinute
+		if key.TPM.Current() < lowestTPM {
+			lowestTPM = key.TPM.Current()
 		}
 	}
 
 	// 收集所有TPM最低的密钥
 	var lowestTPMKeys []config.ApiKey
 	for _, key := range activeKeys {
-		if key.Balance >= config.GetConfig().App.MinBalanceThreshold && key.TokensPerMinute == lowestTPM {
+		if key.HasSufficientBalance(config.GetConfig().App.MinBalanceThreshold) && key.TPM.Current() == lowestTPM {
 			lowestTPMKeys = append(lowestTPMKeys, key)
 		}
 	}
 
 	if len(lowestTPMKeys) == 0 {
-		return getAnyAvailableKey()
+		return getAnyAvailableKey(activeKeys)
 	}
 
 	// 增加详细日志
@@ -310,7 +327,7 @@ func getLowTPMKey() (string, error) {
 
 	// 记录当前轮询索引
 	rrMutex.Lock()
-	currentIndex := strategyRoundRobinIndex["low_tpm"]
+	currentIndex, _ := strategyRoundRobinIndex.Get("low_tpm")
 	rrMutex.Unlock()
 
 	logger.Info("轮询选择: 策略=low_tpm, 当前索引=%d, 总密钥数=%d",
@@ -321,7 +338,7 @@ func getLowTPMKey() (string, error) {
 
 	// 记录选中的密钥和更新后的索引
 	rrMutex.Lock()
-	newIndex := strategyRoundRobinIndex["low_tpm"]
+	newIndex, _ := strategyRoundRobinIndex.Get("low_tpm")
 	rrMutex.Unlock()
 
 	logger.Info("轮询结果: 策略=low_tpm, 选择密钥=%s, 新索引=%d",
@@ -331,33 +348,95 @@ func getLowTPMKey() (string, error) {
 	return selectedKey, nil
 }
 
-// GetBestKeyForRequest 根据请求类型选择最佳密钥
+// GetBestKeyForRequest 根据请求类型选择最佳密钥，没有可用密钥时发送通知
 func GetBestKeyForRequest(requestType string, modelName string, tokenEstimate int) (string, error) {
+	key, _, err := SelectKeyWithDecision(requestType, modelName, tokenEstimate, nil)
+	return key, err
+}
+
+// SelectKeyWithDecision 根据请求类型选择最佳密钥，决策日志开启且本次请求命中采样时同时返回选择过程，否则返回nil
+// excluded为本次请求中已经失败的密钥，换密钥重试时跳过
+func SelectKeyWithDecision(requestType string, modelName string, tokenEstimate int, excluded map[string]bool) (string, *Decision, error) {
+	if IsKeySelectionPaused() {
+		return "", nil, ErrSelectionPaused
+	}
+	if err := GetKeyPool().Err(); err != nil {
+		return "", nil, err
+	}
+	key, selection, err := selectBestKeyForRequest(requestType, modelName, tokenEstimate, excluded)
+	if err == nil {
+		markCircuitProbe(key)
+	}
+	// 只是跳过了已经失败的密钥时不发送密钥耗尽的通知
+	if errors.Is(err, common.ErrNoActiveKeys) && len(excluded) == 0 {
+		notifyKeysExhausted(modelName)
+	}
+	return key, newDecision(requestType, modelName, tokenEstimate, key, selection, err), err
+}
+
+// keySelection 一次密钥选择使用的策略和参与选择的密钥
+type keySelection struct {
+	strategy   string
+	candidates []config.ApiKey
+}
+
+// selectBestKeyForRequest 根据请求类型选择最佳密钥
+func selectBestKeyForRequest(requestType string, modelName string, tokenEstimate int, excluded map[string]bool) (string, keySelection, error) {
 
 	// 添加调试日志
 	logger.Info("GetBestKeyForRequest被调用: 模型=%s, 请求类型=%s, 预估token=%d", modelName, requestType, tokenEstimate)
 
+	// 按分组权重选出本次参与选择的密钥
+	activeKeys := selectKeyGroupKeys(modelName, excluded)
+	selection := keySelection{candidates: activeKeys}
+
 	// 检查是否有针对该模型的特定策略配置
-	key, found, err := GetModelSpecificKey(modelName)
+	key, found, err := getModelSpecificKeyFrom(activeKeys, modelName)
 	logger.Info("模型特定策略查找结果: 模型=%s, 找到策略=%v", modelName, found)
 
 	if found {
 		logger.Info("使用模型特定策略: 模型=%s, 选择密钥=%s", modelName, utils.MaskKey(key))
-		return key, err
+		selection.strategy = "model_specific"
+		return key, selection, err
 	}
 
 	// 对于大型请求，选择余额高的密钥
 	if tokenEstimate > 5000 {
-		return getHighestBalanceKey()
+		selection.strategy = "high_balance"
+		key, err = getHighestBalanceKey(activeKeys)
+		return key, selection, err
 	}
 
 	// 对于流式请求，选择响应速度快的密钥
 	if requestType == "streaming" {
-		return getFastResponseKey()
+		selection.strategy = "fast_response"
+		key, err = getFastResponseKey(activeKeys)
+		return key, selection, err
 	}
 
 	// 默认使用普通轮询策略（而不是智能负载均衡策略）
-	return getRoundRobinKey()
+	selection.strategy = "round_robin"
+	key, err = getRoundRobinKey(activeKeys)
+	return key, selection, err
+}
+
+// selectableKeys 过滤掉断路器断开、正在冷却和当前窗口内已达到限流上限的密钥，所有密钥选择入口共用
+func selectableKeys(keys []config.ApiKey) []config.ApiKey {
+	return filterRateLimitedKeys(filterCoolingDownKeys(filterOpenCircuitKeys(keys)))
+}
+
+// excludeKeys 去掉excluded中的密钥，excluded为空时原样返回
+func excludeKeys(keys []config.ApiKey, excluded map[string]bool) []config.ApiKey {
+	if len(excluded) == 0 {
+		return keys
+	}
+	remaining := make([]config.ApiKey, 0, len(keys))
+	for _, k := range keys {
+		if !excluded[k.Key] {
+			remaining = append(remaining, k)
+		}
+	}
+	return remaining
 }
 
 // selectKeyByRoundRobin 使用轮询方式从密钥列表中选择一个
@@ -376,7 +455,7 @@ func selectKeyByRoundRobin(keys []config.ApiKey, strategyName string) string {
 	rrMutex.Lock()
 
 	// 确保索引存在
-	index, exists := strategyRoundRobinIndex[strategyName]
+	index, exists := strategyRoundRobinIndex.Get(strategyName)
 	if !exists {
 		logger.Info("轮询: 策略=%s 首次使用，初始化索引为0", strategyName)
 		index = 0
@@ -393,11 +472,11 @@ func selectKeyByRoundRobin(keys []config.ApiKey, strategyName string) string {
 	selectedKey := keys[index].Key
 
 	// 更新索引
-	strategyRoundRobinIndex[strategyName] = (index + 1) % len(keys)
+	nextIndex := (index + 1) % len(keys)
+	strategyRoundRobinIndex.Set(strategyName, nextIndex)
 
 	logger.Info("轮询: 策略=%s 从索引%d选择密钥%s, 下次索引更新为%d",
-		strategyName, index, utils.MaskKey(selectedKey),
-		strategyRoundRobinIndex[strategyName])
+		strategyName, index, utils.MaskKey(selectedKey), nextIndex)
 
 	rrMutex.Unlock()
 
@@ -406,7 +485,18 @@ func selectKeyByRoundRobin(keys []config.ApiKey, strategyName string) string {
 
 // GetOptimalApiKeyWithRoundRobin 获取得分最高的API密钥，带轮询功能
 func GetOptimalApiKeyWithRoundRobin() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+	if IsKeySelectionPaused() {
+		return "", ErrSelectionPaused
+	}
+	pool := GetKeyPool()
+	if err := pool.Err(); err != nil {
+		return "", err
+	}
+	return getOptimalKeyWithRoundRobin(selectableKeys(pool.ActiveKeys()))
+}
+
+// getOptimalKeyWithRoundRobin 从指定密钥中获取得分最高的密钥，带轮询功能
+func getOptimalKeyWithRoundRobin(activeKeys []config.ApiKey) (string, error) {
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
@@ -445,7 +535,7 @@ func GetOptimalApiKeyWithRoundRobin() (string, error) {
 
 	// 记录当前轮询索引
 	rrMutex.Lock()
-	currentIndex := strategyRoundRobinIndex["high_score"]
+	currentIndex, _ := strategyRoundRobinIndex.Get("high_score")
 	rrMutex.Unlock()
 
 	logger.Info("轮询选择: 策略=high_score, 当前索引=%d, 总密钥数=%d",
@@ -459,7 +549,7 @@ func GetOptimalApiKeyWithRoundRobin() (string, error) {
 
 	// 记录选中的密钥和更新后的索引
 	rrMutex.Lock()
-	newIndex := strategyRoundRobinIndex["high_score"]
+	newIndex, _ := strategyRoundRobinIndex.Get("high_score")
 	rrMutex.Unlock()
 
 	logger.Info("轮询结果: 策略=high_score, 选择密钥=%s, 新索引=%d",
@@ -472,8 +562,7 @@ func GetOptimalApiKeyWithRoundRobin() (string, error) {
 }
 
 // getRoundRobinKey 实现普通轮询策略，轮询所有可用的API密钥
-func getRoundRobinKey() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getRoundRobinKey(activeKeys []config.ApiKey) (string, error) {
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
@@ -495,7 +584,7 @@ func getRoundRobinKey() (string, error) {
 
 	// 记录当前轮询索引
 	rrMutex.Lock()
-	currentIndex := strategyRoundRobinIndex["round_robin"]
+	currentIndex, _ := strategyRoundRobinIndex.Get("round_robin")
 	rrMutex.Unlock()
 
 	logger.Info("轮询选择: 策略=round_robin, 当前索引=%d, 总密钥数=%d",
@@ -509,7 +598,7 @@ func getRoundRobinKey() (string, error) {
 
 	// 记录选中的密钥和更新后的索引
 	rrMutex.Lock()
-	newIndex := strategyRoundRobinIndex["round_robin"]
+	newIndex, _ := strategyRoundRobinIndex.Get("round_robin")
 	rrMutex.Unlock()
 
 	logger.Info("轮询结果: 策略=round_robin, 选择密钥=%s, 新索引=%d",
@@ -521,12 +610,14 @@ func getRoundRobinKey() (string, error) {
 }
 
 // 获取余额最低的密钥（支持轮询）
-func getLowestBalanceKeyWithRoundRobin() (string, error) {
-	activeKeys := config.GetActiveApiKeys()
+func getLowestBalanceKeyWithRoundRobin(activeKeys []config.ApiKey) (string, error) {
 	if len(activeKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
 
+	// 未跟踪余额的密钥无法比较余额，只在没有其他密钥时参与选择
+	activeKeys = balanceTrackedKeys(activeKeys)
+
 	// 先找出最低余额值
 	var lowestBalance float64 = 999999.0
 	for _, key := range activeKeys {
@@ -560,7 +651,7 @@ func getLowestBalanceKeyWithRoundRobin() (string, error) {
 
 	// 记录当前轮询索引
 	rrMutex.Lock()
-	currentIndex := strategyRoundRobinIndex["low_balance"]
+	currentIndex, _ := strategyRoundRobinIndex.Get("low_balance")
 	rrMutex.Unlock()
 
 	logger.Info("轮询选择: 策略=low_balance, 当前索引=%d, 总密钥数=%d",
@@ -574,7 +665,7 @@ func getLowestBalanceKeyWithRoundRobin() (string, error) {
 
 	// 记录选中的密钥和更新后的索引
 	rrMutex.Lock()
-	newIndex := strategyRoundRobinIndex["low_balance"]
+	newIndex, _ := strategyRoundRobinIndex.Get("low_balance")
 	rrMutex.Unlock()
 
 	logger.Info("轮询结果: 策略=low_balance, 选择密钥=%s, 新索引=%d",
@@ -586,15 +677,15 @@ func getLowestBalanceKeyWithRoundRobin() (string, error) {
 }
 
 // getLowestBalanceKey 获取余额最低的密钥
-func getLowestBalanceKey() (string, error) {
-	return getLowestBalanceKeyWithRoundRobin()
+func getLowestBalanceKey(activeKeys []config.ApiKey) (string, error) {
+	return getLowestBalanceKeyWithRoundRobin(activeKeys)
 }
 
 // getFreeModelKey 实现免费模型的策略
 // 先轮询is_delete为1的密钥，再轮询disabled为1的密钥，再轮询is_used为0的密钥，最后使用低余额策略
-func getFreeModelKey() (string, error) {
+func getFreeModelKey(activeKeys []config.ApiKey) (string, error) {
 	// 获取所有API密钥（包括禁用的，但不包括已标记为删除的）
-	allKeys := config.GetApiKeys()
+	allKeys := GetKeyPool().Keys()
 	if len(allKeys) == 0 {
 		return "", common.ErrNoActiveKeys
 	}
@@ -654,7 +745,7 @@ func getFreeModelKey() (string, error) {
 
 	// 4. 最后尝试使用低余额策略
 	logger.Info("尝试使用低余额策略选择密钥")
-	return getLowestBalanceKey()
+	return getLowestBalanceKey(activeKeys)
 }
 
 // getDeletedApiKeys 获取所有标记为已删除的API密钥
@@ -687,8 +778,8 @@ func getDeletedApiKeys() ([]config.ApiKey, error) {
 			&key.Disabled,
 			&key.DisabledAt,
 			&key.LastTested,
-			&key.RequestsPerMinute,
-			&key.TokensPerMinute,
+			&key.RPM.Used,
+			&key.TPM.Used,
 			&key.Score,
 			&key.Delete,
 			&key.IsUsed,
@@ -0,0 +1,162 @@
+/**
+  @author: Hanhai
+  @desc: 密钥池快照，导出和恢复内存中的密钥状态，用于重启时快速恢复
+**/
+
+package key
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+)
+
+// 快照格式版本
+const keyPoolSnapshotVersion = 1
+
+// keyPoolSnapshotFile 保存到文件的密钥池快照
+type keyPoolSnapshotFile struct {
+	Version        int                              `json:"version"`
+	CreatedAt      int64                            `json:"created_at"`      // 快照创建时间戳
+	Keys           []config.ApiKey                  `json:"keys"`            // 密钥及其得分、RPM/TPM等状态
+	RecentRequests map[string][]config.RequestStats `json:"recent_requests"` // 各密钥最近的请求统计，用于恢复RPM/TPM计数
+	Mode           KeyMode                          `json:"mode"`            // 密钥使用模式
+	SelectedKeys   []string                         `json:"selected_keys"`   // 选中的密钥
+	RoundRobin     map[string]int                   `json:"round_robin"`     // 各策略的轮询索引
+}
+
+// ExportKeyPoolSnapshot 将内存中的密钥池序列化为JSON
+func ExportKeyPoolSnapshot() ([]byte, error) {
+	keys := GetKeyPool().Keys()
+
+	snapshot := keyPoolSnapshotFile{
+		Version:        keyPoolSnapshotVersion,
+		CreatedAt:      time.Now().Unix(),
+		Keys:           keys,
+		RecentRequests: make(map[string][]config.RequestStats),
+		RoundRobin:     make(map[string]int),
+	}
+
+	for _, k := range keys {
+		if len(k.RecentRequests) > 0 {
+			snapshot.RecentRequests[k.Key] = k.RecentRequests
+		}
+	}
+
+	modeMutex.RLock()
+	snapshot.Mode = currentMode
+	snapshot.SelectedKeys = append([]string(nil), selectedKeys...)
+	modeMutex.RUnlock()
+
+	rrMutex.Lock()
+	strategyRoundRobinIndex.Range(func(strategy string, index int) bool {
+		snapshot.RoundRobin[strategy] = index
+		return true
+	})
+	rrMutex.Unlock()
+
+	return json.Marshal(snapshot)
+}
+
+// ImportKeyPoolSnapshot 从JSON快照恢复内存中的密钥池
+func ImportKeyPoolSnapshot(data []byte) error {
+	var snapshot keyPoolSnapshotFile
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("解析密钥池快照失败: %w", err)
+	}
+
+	if snapshot.Version != keyPoolSnapshotVersion {
+		return fmt.Errorf("不支持的密钥池快照版本: %d", snapshot.Version)
+	}
+
+	keys := make([]config.ApiKey, len(snapshot.Keys))
+	for i, k := range snapshot.Keys {
+		k.RecentRequests = snapshot.RecentRequests[k.Key]
+		keys[i] = k
+	}
+	config.ReplaceApiKeys(keys)
+
+	modeMutex.Lock()
+	if snapshot.Mode != "" {
+		currentMode = snapshot.Mode
+	}
+	selectedKeys = snapshot.SelectedKeys
+	modeMutex.Unlock()
+
+	rrMutex.Lock()
+	for strategy, index := range snapshot.RoundRobin {
+		strategyRoundRobinIndex.Set(strategy, index)
+	}
+	rrMutex.Unlock()
+
+	logger.Info("已从快照恢复 %d 个API密钥的状态", len(keys))
+	return nil
+}
+
+// SaveKeyPoolSnapshot 将密钥池快照保存到文件
+func SaveKeyPoolSnapshot(path string) error {
+	data, err := ExportKeyPoolSnapshot()
+	if err != nil {
+		return fmt.Errorf("导出密钥池快照失败: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建快照目录失败: %w", err)
+	}
+
+	// 先写入临时文件再重命名，避免写入中断导致快照损坏
+	// 快照中包含完整的密钥，只允许当前用户读写
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("写入密钥池快照失败: %w", err)
+	}
+	// WriteFile不会修改已存在文件的权限，旧版本留下的临时文件也改为只允许当前用户读写
+	if err := os.Chmod(tmpPath, 0600); err != nil {
+		return fmt.Errorf("设置密钥池快照权限失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("保存密钥池快照失败: %w", err)
+	}
+
+	return nil
+}
+
+// LoadKeyPoolSnapshot 在快照存在且未超过配置的最大时长时从文件恢复密钥池
+// 返回是否已从快照恢复，未启用快照或快照过期时返回false
+func LoadKeyPoolSnapshot(path string) (bool, error) {
+	cfg := config.GetConfig()
+	if cfg == nil || cfg.App.SnapshotMaxAgeMinutes <= 0 {
+		return false, nil
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("读取密钥池快照信息失败: %w", err)
+	}
+
+	maxAge := time.Duration(cfg.App.SnapshotMaxAgeMinutes) * time.Minute
+	if age := time.Since(info.ModTime()); age > maxAge {
+		logger.Info("密钥池快照已过期（%v），将重新计算密钥状态", age.Round(time.Second))
+		return false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("读取密钥池快照失败: %w", err)
+	}
+
+	if err := ImportKeyPoolSnapshot(data); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
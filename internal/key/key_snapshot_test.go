@@ -0,0 +1,35 @@
+package key
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"flowsilicon/internal/config"
+)
+
+func TestSaveKeyPoolSnapshotIsPrivate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows不使用Unix文件权限")
+	}
+	config.UpdateConfig(&config.Config{})
+	config.ReplaceApiKeys([]config.ApiKey{{ID: 1, Key: "sk-snapshot-secret", Balance: 10}})
+
+	path := filepath.Join(t.TempDir(), "keypool_snapshot.json")
+	// 旧版本以0644写入的临时文件
+	if err := os.WriteFile(path+".tmp", []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveKeyPoolSnapshot(path); err != nil {
+		t.Fatalf("SaveKeyPoolSnapshot 失败: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Fatalf("快照文件权限 = %o，期望 600", perm)
+	}
+}
@@ -0,0 +1,82 @@
+/**
+  @author: Hanhai
+  @desc: 密钥用量排名，按最近24小时的请求数排序，用于发现承担过多流量的热点密钥
+**/
+
+package key
+
+import (
+	"sort"
+
+	"flowsilicon/internal/config"
+)
+
+// 请求数超过平均值的倍数时视为热点密钥
+const hotKeyFactor = 2.0
+
+// KeyUsageRankInfo 密钥用量排名信息
+type KeyUsageRankInfo struct {
+	Ranks    map[int]int `json:"ranks"`    // 密钥ID到排名的映射，1表示请求最多
+	Requests map[int]int `json:"requests"` // 密钥ID到最近24小时请求数的映射
+	Hot      []int       `json:"hot"`      // 请求数超过可用密钥平均值2倍的密钥ID
+}
+
+// GetKeyUsageRank 获取密钥按最近24小时请求数的排名，1表示请求最多
+// 请求数相同的密钥排名相同，24小时内没有请求的密钥不参与排名
+func GetKeyUsageRank() map[int]int {
+	return GetKeyUsageRankInfo().Ranks
+}
+
+// GetKeyUsageRankInfo 获取密钥的用量排名、请求数和热点密钥
+func GetKeyUsageRankInfo() KeyUsageRankInfo {
+	usage := config.GetKeyRequestsLast24h()
+
+	type keyRequests struct {
+		id       int
+		requests int
+	}
+	var items []keyRequests
+	keyPool := GetKeyPool()
+	for _, k := range keyPool.Keys() {
+		if requests := usage[k.Key]; requests > 0 && k.ID > 0 {
+			items = append(items, keyRequests{id: k.ID, requests: requests})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].requests != items[j].requests {
+			return items[i].requests > items[j].requests
+		}
+		return items[i].id < items[j].id
+	})
+
+	info := KeyUsageRankInfo{
+		Ranks:    make(map[int]int, len(items)),
+		Requests: make(map[int]int, len(items)),
+		Hot:      make([]int, 0),
+	}
+	total := 0
+	for i, item := range items {
+		rank := i + 1
+		if i > 0 && item.requests == items[i-1].requests {
+			rank = info.Ranks[items[i-1].id]
+		}
+		info.Ranks[item.id] = rank
+		info.Requests[item.id] = item.requests
+		total += item.requests
+	}
+
+	// 按可用密钥数计算平均值，没有请求的可用密钥也计入；只有一个密钥时不存在分配不均
+	keyCount := len(items)
+	if active := config.GetKeyCount(config.KeyFilter{Status: config.KeyStatusActive}); active > keyCount {
+		keyCount = active
+	}
+	if keyCount > 1 {
+		average := float64(total) / float64(keyCount)
+		for _, item := range items {
+			if float64(item.requests) > average*hotKeyFactor {
+				info.Hot = append(info.Hot, item.id)
+			}
+		}
+	}
+	return info
+}
@@ -17,6 +17,11 @@ type KeySelectionStrategy int
 
 // GetModelSpecificKey 根据模型名称获取特定的密钥
 func GetModelSpecificKey(modelName string) (string, bool, error) {
+	return getModelSpecificKeyFrom(selectableKeys(GetKeyPool().ActiveKeys()), modelName)
+}
+
+// getModelSpecificKeyFrom 根据模型名称从指定密钥中获取特定的密钥
+func getModelSpecificKeyFrom(activeKeys []config.ApiKey, modelName string) (string, bool, error) {
 	logger.Info("检查模型特定策略: 模型=%s", modelName)
 
 	// 首先从models表中获取模型的策略
@@ -24,22 +29,22 @@ func GetModelSpecificKey(modelName string) (string, bool, error) {
 	if err != nil {
 		logger.Error("从数据库获取模型策略失败: %v", err)
 		// 如果获取失败，回退到配置文件中查找
-		return getModelStrategyFromConfig(modelName)
+		return getModelStrategyFromConfig(activeKeys, modelName)
 	}
 
 	// 如果找到策略（strategyID > 0），应用它
 	if strategyID > 0 {
 		logger.Info("从数据库找到模型特定策略: 模型=%s, 策略ID=%d", modelName, strategyID)
-		return applyModelStrategy(modelName, strategyID)
+		return applyModelStrategy(activeKeys, modelName, strategyID)
 	}
 
 	// 如果数据库中没有指定策略，回退到配置文件中查找
 	logger.Info("数据库中没有模型策略，回退到配置查找: 模型=%s", modelName)
-	return getModelStrategyFromConfig(modelName)
+	return getModelStrategyFromConfig(activeKeys, modelName)
 }
 
 // getModelStrategyFromConfig 从配置文件中获取模型策略（为了向后兼容）
-func getModelStrategyFromConfig(modelName string) (string, bool, error) {
+func getModelStrategyFromConfig(activeKeys []config.ApiKey, modelName string) (string, bool, error) {
 	// 检查是否有针对该模型的特定策略配置
 	cfg := config.GetConfig()
 
@@ -57,7 +62,7 @@ func getModelStrategyFromConfig(modelName string) (string, bool, error) {
 			logger.Error("更新模型策略到数据库失败: %v", err)
 		}
 
-		return applyModelStrategy(modelName, strategyID)
+		return applyModelStrategy(activeKeys, modelName, strategyID)
 	}
 
 	// 如果精确匹配失败，尝试不区分大小写的匹配
@@ -73,7 +78,7 @@ func getModelStrategyFromConfig(modelName string) (string, bool, error) {
 				logger.Error("更新模型策略到数据库失败: %v", err)
 			}
 
-			return applyModelStrategy(modelName, strategyID)
+			return applyModelStrategy(activeKeys, modelName, strategyID)
 		}
 	}
 
@@ -83,43 +88,76 @@ func getModelStrategyFromConfig(modelName string) (string, bool, error) {
 }
 
 // applyModelStrategy 应用模型特定策略
-func applyModelStrategy(modelName string, strategyID int) (string, bool, error) {
+func applyModelStrategy(activeKeys []config.ApiKey, modelName string, strategyID int) (string, bool, error) {
 	switch strategyID {
 	case 1: // 高成功率策略
 		logger.Info("使用高成功率策略选择密钥: 模型=%s", modelName)
-		key, err := getHighSuccessRateKey(modelName)
+		key, err := getHighSuccessRateKey(activeKeys, modelName)
 		return key, true, err
 	case 2: // 高分数策略
 		logger.Info("使用高分数策略选择密钥: 模型=%s", modelName)
-		key, err := GetOptimalApiKeyWithRoundRobin()
+		key, err := getOptimalKeyWithRoundRobin(activeKeys)
 		return key, true, err
 	case 3: // 低RPM策略
 		logger.Info("使用低RPM策略选择密钥: 模型=%s", modelName)
-		key, err := getLowRPMKey()
+		key, err := getLowRPMKey(activeKeys)
 		return key, true, err
 	case 4: // 低TPM策略
 		logger.Info("使用低TPM策略选择密钥: 模型=%s", modelName)
-		key, err := getLowTPMKey()
+		key, err := getLowTPMKey(activeKeys)
 		return key, true, err
 	case 5: // 高余额策略
 		logger.Info("使用高余额策略选择密钥: 模型=%s", modelName)
-		key, err := getHighestBalanceKey()
+		key, err := getHighestBalanceKey(activeKeys)
 		return key, true, err
 	case 6: // 普通轮询策略
 		logger.Info("使用普通轮询策略选择密钥: 模型=%s", modelName)
-		key, err := getRoundRobinKey()
+		key, err := getRoundRobinKey(activeKeys)
 		return key, true, err
 	case 7: // 低余额策略
 		logger.Info("使用低余额策略选择密钥: 模型=%s", modelName)
-		key, err := getLowestBalanceKey()
+		key, err := getLowestBalanceKey(activeKeys)
 		return key, true, err
 	case 8: // 免费模型策略
 		logger.Info("使用免费模型策略选择密钥: 模型=%s", modelName)
-		key, err := getFreeModelKey()
+		key, err := getFreeModelKey(activeKeys)
+		return key, true, err
+	case 9: // 综合加权策略
+		logger.Info("使用综合加权策略选择密钥: 模型=%s", modelName)
+		key, err := getCompositeKey(activeKeys, modelName)
 		return key, true, err
 	default:
 		logger.Info("使用默认策略(普通轮询)选择密钥: 模型=%s", modelName)
-		key, err := getRoundRobinKey()
+		key, err := getRoundRobinKey(activeKeys)
 		return key, true, err
 	}
 }
+
+// unknownStrategyName 无效的策略ID对应的名称
+const unknownStrategyName = "normal"
+
+// GetStrategyName 获取模型特定策略的名称，无效的策略ID返回normal，与按普通轮询策略处理的行为对应
+func GetStrategyName(strategyID int) string {
+	switch strategyID {
+	case 1:
+		return "高成功率"
+	case 2:
+		return "高分数"
+	case 3:
+		return "低RPM"
+	case 4:
+		return "低TPM"
+	case 5:
+		return "高余额"
+	case 6:
+		return "普通"
+	case 7:
+		return "低余额"
+	case 8:
+		return "免费"
+	case 9:
+		return "综合加权"
+	default:
+		return unknownStrategyName
+	}
+}
@@ -0,0 +1,23 @@
+package key
+
+import "testing"
+
+func TestGetStrategyName(t *testing.T) {
+	seen := make(map[string]int)
+	for id := MinStrategyID; id <= MaxStrategyID; id++ {
+		name := GetStrategyName(id)
+		if name == "" || name == unknownStrategyName {
+			t.Errorf("GetStrategyName(%d) = %q, want a strategy name", id, name)
+		}
+		if other, ok := seen[name]; ok {
+			t.Errorf("GetStrategyName(%d) = %q, same as strategy %d", id, name, other)
+		}
+		seen[name] = id
+	}
+
+	for _, id := range []int{MinStrategyID - 1, -1, MaxStrategyID + 1, 99} {
+		if name := GetStrategyName(id); name != unknownStrategyName {
+			t.Errorf("GetStrategyName(%d) = %q, want %q", id, name, unknownStrategyName)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/**
+  @author: Hanhai
+  @desc: 模型策略、覆盖配置、禁用列表和虚拟模型映射的检查，找出无效的策略ID、不存在的模型和互相冲突的规则
+**/
+
+package key
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/model"
+)
+
+// 模型特定策略ID的有效范围，与applyModelStrategy中的策略对应
+const (
+	MinStrategyID = 1
+	MaxStrategyID = 9
+)
+
+// 模型规则问题的级别
+const (
+	ModelRuleError   = "error"   // 规则无效，保存时会被拒绝
+	ModelRuleWarning = "warning" // 规则不会按预期生效
+)
+
+// ModelRuleIssue 模型规则检查发现的问题
+type ModelRuleIssue struct {
+	Level   string `json:"level"`   // 问题级别，见ModelRule常量
+	Rule    string `json:"rule"`    // 所在的配置项
+	Model   string `json:"model"`   // 相关的模型名称
+	Message string `json:"message"` // 问题说明和修改建议
+}
+
+// IsValidStrategyID 检查模型特定策略ID是否有效
+func IsValidStrategyID(strategyID int) bool {
+	return strategyID >= MinStrategyID && strategyID <= MaxStrategyID
+}
+
+// ValidateModelRules 检查配置中的模型规则，模型列表获取失败时不检查模型是否存在
+func ValidateModelRules(cfg *config.Config) []ModelRuleIssue {
+	var known map[string]bool
+	if models, err := model.GetAllModels(); err == nil {
+		known = make(map[string]bool, len(models))
+		for _, m := range models {
+			known[m.ID] = true
+		}
+	}
+	return validateModelRules(cfg, known)
+}
+
+// validateModelRules 按给定的模型列表检查模型规则，known为nil表示模型列表不可用
+func validateModelRules(cfg *config.Config, known map[string]bool) []ModelRuleIssue {
+	issues := make([]ModelRuleIssue, 0)
+	if cfg == nil {
+		return issues
+	}
+	add := func(level, rule, modelID, format string, args ...interface{}) {
+		issues = append(issues, ModelRuleIssue{
+			Level:   level,
+			Rule:    rule,
+			Model:   modelID,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if known == nil {
+		add(ModelRuleWarning, "", "", "无法获取模型列表，未检查规则中的模型名称是否存在")
+	}
+
+	// 规则中的模型不在模型列表中时给出提示，大小写不同时给出建议的名称
+	checkExists := func(rule, label, modelID string, ignoreCase bool) {
+		if known == nil || known[modelID] {
+			return
+		}
+		suggestion := ""
+		for id := range known {
+			if strings.EqualFold(id, modelID) {
+				if ignoreCase {
+					return
+				}
+				suggestion = id
+				break
+			}
+		}
+		if suggestion != "" {
+			add(ModelRuleWarning, rule, modelID, "%s %s 不在模型列表中，该规则不会生效，是否应为 %s", label, modelID, suggestion)
+			return
+		}
+		add(ModelRuleWarning, rule, modelID, "%s %s 不在模型列表中，该规则不会生效，请检查模型名称或先同步模型列表", label, modelID)
+	}
+
+	disabled := make(map[string]bool, len(cfg.App.DisabledModels))
+	for _, modelID := range cfg.App.DisabledModels {
+		disabled[modelID] = true
+	}
+
+	// 模型特定策略，查找时不区分大小写
+	for _, modelID := range sortedModelKeys(cfg.App.ModelKeyStrategies) {
+		strategyID := cfg.App.ModelKeyStrategies[modelID]
+		if !IsValidStrategyID(strategyID) {
+			add(ModelRuleError, "model_key_strategies", modelID,
+				"模型 %s 的策略ID %d 无效，应在%d到%d之间，当前按普通轮询策略处理", modelID, strategyID, MinStrategyID, MaxStrategyID)
+		}
+		checkExists("model_key_strategies", "模型策略中的模型", modelID, true)
+		if disabled[modelID] {
+			add(ModelRuleWarning, "model_key_strategies", modelID, "模型 %s 已被禁用，为其配置的密钥策略不会生效", modelID)
+		}
+	}
+
+	// 模型覆盖配置
+	for _, modelID := range sortedModelKeys(cfg.App.ModelOverrides) {
+		checkExists("model_overrides", "模型覆盖配置中的模型", modelID, false)
+		if disabled[modelID] {
+			add(ModelRuleWarning, "model_overrides", modelID, "模型 %s 已被禁用，为其配置的覆盖规则不会生效", modelID)
+		}
+	}
+
+	// 禁用模型列表
+	disabledModels := append([]string(nil), cfg.App.DisabledModels...)
+	sort.Strings(disabledModels)
+	for _, modelID := range disabledModels {
+		if _, isAlias := cfg.App.ModelMappings[modelID]; isAlias {
+			continue
+		}
+		checkExists("disabled_models", "禁用模型列表中的模型", modelID, false)
+	}
+
+	// 虚拟模型映射
+	for _, alias := range sortedModelKeys(cfg.App.ModelMappings) {
+		target := cfg.App.ModelMappings[alias]
+		if next, chained := cfg.App.ModelMappings[target]; chained && target != alias {
+			add(ModelRuleWarning, "model_mappings", alias, "虚拟模型 %s 映射到另一个虚拟模型 %s，映射只替换一次，请求会以 %s 发往上游而不是 %s", alias, target, target, next)
+		} else {
+			checkExists("model_mappings", "虚拟模型 "+alias+" 映射的模型", target, false)
+		}
+		if disabled[target] {
+			add(ModelRuleWarning, "model_mappings", alias, "虚拟模型 %s 映射的模型 %s 已被禁用，使用该虚拟模型的请求会被拒绝", alias, target)
+		}
+		if known != nil && known[alias] {
+			add(ModelRuleWarning, "model_mappings", alias, "虚拟模型 %s 与上游模型同名，请求会被映射到 %s，无法再直接使用上游的 %s", alias, target, alias)
+		}
+	}
+
+	return issues
+}
+
+// sortedModelKeys 返回按名称排序的模型名称
+func sortedModelKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
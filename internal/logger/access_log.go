@@ -0,0 +1,165 @@
+/**
+  @author: Hanhai
+  @desc: HTTP访问日志，独立于应用日志写入单独的文件，并支持单独轮转
+**/
+
+package logger
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 可轮转的日志文件
+const (
+	RotateTargetApp    = "app"    // 应用日志
+	RotateTargetAccess = "access" // 访问日志
+)
+
+var (
+	accessLogFile *os.File
+	accessLogPath string
+	// 访问日志使用单独的锁，避免写访问日志时阻塞应用日志
+	accessLogMu sync.Mutex
+)
+
+// WriteAccessLog 写入一行访问日志，path为访问日志文件路径
+// 路径与当前打开的文件不同时会切换到新文件，路径为空时关闭访问日志
+func WriteAccessLog(path string, line string) {
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+
+	if path != accessLogPath {
+		if err := openAccessLogLocked(path); err != nil {
+			log.Printf("打开访问日志文件失败: %v", err)
+			return
+		}
+	}
+
+	if accessLogFile == nil {
+		return
+	}
+
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	if _, err := accessLogFile.WriteString(line); err != nil {
+		log.Printf("写入访问日志失败: %v", err)
+	}
+}
+
+// openAccessLogLocked 关闭当前访问日志并打开新的文件（已加锁）
+func openAccessLogLocked(path string) error {
+	if accessLogFile != nil {
+		_ = accessLogFile.Close()
+		accessLogFile = nil
+	}
+	accessLogPath = path
+
+	if path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建访问日志目录失败: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开访问日志文件失败: %w", err)
+	}
+	accessLogFile = file
+	return nil
+}
+
+// Rotate 立即轮转指定的日志文件，target为RotateTargetApp或RotateTargetAccess
+// 应用日志和访问日志分别轮转，互不影响
+func Rotate(target string) error {
+	switch target {
+	case RotateTargetApp:
+		if !initialized {
+			return fmt.Errorf("日志系统未初始化")
+		}
+		rotateAndCreateNewLog(filepath.Join("logs", "app.log"))
+		return nil
+	case RotateTargetAccess:
+		return rotateAccessLog()
+	default:
+		return fmt.Errorf("未知的日志类型: %s", target)
+	}
+}
+
+// rotateAccessLog 将当前访问日志归档为带时间戳的文件并重新打开
+func rotateAccessLog() error {
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+
+	if accessLogFile == nil || accessLogPath == "" {
+		return fmt.Errorf("访问日志未启用")
+	}
+
+	path := accessLogPath
+	if err := accessLogFile.Close(); err != nil {
+		return fmt.Errorf("关闭访问日志文件失败: %w", err)
+	}
+	accessLogFile = nil
+
+	logDir := filepath.Dir(path)
+	fileExt := filepath.Ext(path)
+	fileNameWithoutExt := strings.TrimSuffix(filepath.Base(path), fileExt)
+	archiveFileName := fmt.Sprintf("%s_%s%s", fileNameWithoutExt, time.Now().Format("20060102_150405"), fileExt)
+
+	renameErr := os.Rename(path, filepath.Join(logDir, archiveFileName))
+
+	// 无论归档是否成功都重新打开访问日志，避免后续请求丢失日志
+	if err := openAccessLogLocked(path); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return fmt.Errorf("重命名访问日志文件失败: %w", renameErr)
+	}
+
+	go cleanOldLogFiles(logDir, fileNameWithoutExt, fileExt)
+
+	log.Printf("访问日志已轮转完成，旧日志已归档为 %s", archiveFileName)
+	return nil
+}
+
+// safeRotateAccessLog 访问日志超过日志文件大小限制时自动轮转
+func safeRotateAccessLog() {
+	accessLogMu.Lock()
+	if accessLogFile == nil {
+		accessLogMu.Unlock()
+		return
+	}
+	fileInfo, err := accessLogFile.Stat()
+	accessLogMu.Unlock()
+	if err != nil {
+		log.Printf("获取访问日志文件信息失败: %v", err)
+		return
+	}
+
+	if fileInfo.Size() <= int64(maxLogSizeMB)*1024*1024 {
+		return
+	}
+
+	if err := rotateAccessLog(); err != nil {
+		log.Printf("轮转访问日志失败: %v", err)
+	}
+}
+
+// closeAccessLog 关闭访问日志文件
+func closeAccessLog() {
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+
+	if accessLogFile != nil {
+		_ = accessLogFile.Close()
+		accessLogFile = nil
+	}
+	accessLogPath = ""
+}
@@ -46,6 +46,9 @@ var (
 	maxLogSizeMB  int    = 10     // 默认日志文件最大大小为10MB
 	logLevel      string = "warn" // 默认日志等级为warn
 	isGuiMode     bool            // 是否是GUI模式
+	multiOutput   bool            // GUI模式下是否同时输出到标准输出
+	maxLogFiles   int    = 5      // 默认保留的归档日志文件数量
+	minLogFiles   int    = 2      // 默认至少保留的归档日志文件数量
 )
 
 // SetGuiMode 设置是否为GUI模式
@@ -53,6 +56,39 @@ func SetGuiMode(mode bool) {
 	isGuiMode = mode
 }
 
+// IsGuiMode 检查是否为GUI模式
+func IsGuiMode() bool {
+	return isGuiMode
+}
+
+// SetMultiOutput 设置GUI模式下是否同时将日志写入文件和标准输出，已初始化时立即生效
+// 控制台模式下始终同时写入文件和标准输出
+func SetMultiOutput(enabled bool) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+
+	multiOutput = enabled
+	if initialized && logFile != nil {
+		writer := newLogWriter(logFile)
+		logger = log.New(writer, "", 0)
+		log.SetOutput(writer)
+	}
+}
+
+// newLogWriter 根据运行模式创建日志输出
+func newLogWriter(file *os.File) io.Writer {
+	if !isGuiMode {
+		// 控制台模式下同时写入文件和控制台
+		return io.MultiWriter(os.Stdout, file)
+	}
+	if multiOutput {
+		// GUI模式下标准输出可能不可用，先写入文件，避免写标准输出失败时丢失文件日志
+		return io.MultiWriter(file, os.Stdout)
+	}
+	// GUI模式下只写入文件
+	return file
+}
+
 // SetLogLevel 设置日志等级
 func SetLogLevel(level string) {
 	// 将输入的日志等级转换为小写，并验证有效性
@@ -96,6 +132,12 @@ func Init() error {
 	loggerMu.Lock()
 	defer loggerMu.Unlock()
 
+	return initLocked()
+}
+
+// initLocked 初始化日志系统，调用方需要持有loggerMu
+// 未调用Init就记录日志时在日志函数中延迟初始化，不能再调用Init重复加锁
+func initLocked() error {
 	if initialized {
 		return nil
 	}
@@ -116,14 +158,7 @@ func Init() error {
 	// 设置日志输出
 	logFile = file
 
-	var writer io.Writer
-	if isGuiMode {
-		// GUI模式下只写入文件
-		writer = file
-	} else {
-		// 控制台模式下同时写入文件和控制台
-		writer = io.MultiWriter(os.Stdout, file)
-	}
+	writer := newLogWriter(file)
 
 	logger = log.New(writer, "", 0) // 不添加前缀，我们将在自定义格式中添加
 
@@ -157,6 +192,19 @@ func SetMaxLogSize(sizeMB int) {
 	log.Printf("日志文件最大大小已设置为 %d MB", sizeMB)
 }
 
+// SetLogFileLimits 设置保留的归档日志文件数量，minFiles大于maxFiles时至少保留minFiles个
+func SetLogFileLimits(maxFiles int, minFiles int) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+
+	if maxFiles > 0 {
+		maxLogFiles = maxFiles
+	}
+	if minFiles >= 0 {
+		minLogFiles = minFiles
+	}
+}
+
 // startLogCleaner 启动日志清理定时任务
 func startLogCleaner() {
 	if cronScheduler != nil {
@@ -170,6 +218,7 @@ func startLogCleaner() {
 	_, err := cronScheduler.AddFunc("0 */1 * * * *", func() {
 		// 在独立的goroutine中执行清理任务，避免阻塞cron调度器
 		go safeCleanLogs()
+		go safeRotateAccessLog()
 	})
 
 	if err != nil {
@@ -194,8 +243,8 @@ func stopLogCleaner() {
 	}
 }
 
-// CleanLogsNow 立即清理日志文件
-func CleanLogsNow() {
+// CleanLogsNow 立即清理日志文件，至少保留minFiles个最近的归档日志文件，minFiles小于0时使用配置的值
+func CleanLogsNow(minFiles int) {
 	if !initialized {
 		return
 	}
@@ -207,6 +256,9 @@ func CleanLogsNow() {
 
 		// 使用更加安全的清理方式
 		safeCleanLogs()
+
+		// 按保留数量清理归档日志，日志未超过大小没有轮转时也会执行
+		cleanOldLogFilesKeeping("logs", "app", ".log", minFiles)
 	}()
 }
 
@@ -317,14 +369,7 @@ func rotateAndCreateNewLog(logFilePath string) {
 	logFile = newFile
 
 	// 重新设置日志输出
-	var writer io.Writer
-	if isGuiMode {
-		// GUI模式下只写入文件
-		writer = newFile
-	} else {
-		// 控制台模式下同时写入文件和控制台
-		writer = io.MultiWriter(os.Stdout, newFile)
-	}
+	writer := newLogWriter(newFile)
 
 	logger = log.New(writer, "", 0)
 	log.SetOutput(writer)
@@ -338,8 +383,21 @@ func rotateAndCreateNewLog(logFilePath string) {
 
 // cleanOldLogFiles 清理过老的日志文件，保留最近的几个
 func cleanOldLogFiles(logDir, fileNamePrefix, fileExt string) {
-	// 保留的日志文件数量
-	const maxLogFiles = 5
+	cleanOldLogFilesKeeping(logDir, fileNamePrefix, fileExt, -1)
+}
+
+// cleanOldLogFilesKeeping 清理过老的日志文件，保留最近的maxLogFiles个，且不少于minFiles个
+// minFiles小于0时使用配置的值，避免清理策略过于激进时日志目录中没有可用于排查问题的归档
+func cleanOldLogFilesKeeping(logDir, fileNamePrefix, fileExt string, minFiles int) {
+	loggerMu.Lock()
+	keepFiles := maxLogFiles
+	if minFiles < 0 {
+		minFiles = minLogFiles
+	}
+	loggerMu.Unlock()
+	if keepFiles < minFiles {
+		keepFiles = minFiles
+	}
 
 	// 查找所有匹配的日志文件
 	pattern := filepath.Join(logDir, fileNamePrefix+"_*"+fileExt)
@@ -350,7 +408,7 @@ func cleanOldLogFiles(logDir, fileNamePrefix, fileExt string) {
 	}
 
 	// 如果日志文件数量未超过限制，不需要清理
-	if len(matches) <= maxLogFiles {
+	if len(matches) <= keepFiles {
 		return
 	}
 
@@ -358,7 +416,7 @@ func cleanOldLogFiles(logDir, fileNamePrefix, fileExt string) {
 	sort.Strings(matches)
 
 	// 删除多余的最旧的日志文件
-	for i := 0; i < len(matches)-maxLogFiles; i++ {
+	for i := 0; i < len(matches)-keepFiles; i++ {
 		if err := os.Remove(matches[i]); err != nil {
 			log.Printf("删除旧日志文件 %s 失败: %v", matches[i], err)
 		} else {
@@ -397,6 +455,31 @@ func formatLog(apiKey, format string, args ...interface{}) string {
 	return fmt.Sprintf("%s - %s", timeStr, apiKey)
 }
 
+// Debug 记录调试日志
+func Debug(format string, args ...interface{}) {
+	// 如果格式字符串为空且没有参数，不记录日志
+	if format == "" && len(args) == 0 {
+		return
+	}
+
+	// 检查当前日志等级是否允许记录debug级别的日志
+	if !shouldLog(LevelDebug) {
+		return
+	}
+
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+
+	if !initialized {
+		if err := initLocked(); err != nil {
+			log.Printf("初始化日志系统失败: %v", err)
+			return
+		}
+	}
+
+	logger.Println(formatLog("", "DEBUG: "+format, args...))
+}
+
 // Info 记录普通信息日志
 func Info(format string, args ...interface{}) {
 	// 如果格式字符串为空，不记录日志
@@ -413,7 +496,7 @@ func Info(format string, args ...interface{}) {
 	defer loggerMu.Unlock()
 
 	if !initialized {
-		if err := Init(); err != nil {
+		if err := initLocked(); err != nil {
 			log.Printf("初始化日志系统失败: %v", err)
 			return
 		}
@@ -438,7 +521,7 @@ func InfoWithKey(apiKey, format string, args ...interface{}) {
 	defer loggerMu.Unlock()
 
 	if !initialized {
-		if err := Init(); err != nil {
+		if err := initLocked(); err != nil {
 			log.Printf("初始化日志系统失败: %v", err)
 			return
 		}
@@ -463,7 +546,7 @@ func Warn(format string, args ...interface{}) {
 	defer loggerMu.Unlock()
 
 	if !initialized {
-		if err := Init(); err != nil {
+		if err := initLocked(); err != nil {
 			log.Printf("初始化日志系统失败: %v", err)
 			return
 		}
@@ -488,7 +571,7 @@ func Error(format string, args ...interface{}) {
 	defer loggerMu.Unlock()
 
 	if !initialized {
-		if err := Init(); err != nil {
+		if err := initLocked(); err != nil {
 			log.Printf("初始化日志系统失败: %v", err)
 			return
 		}
@@ -511,7 +594,7 @@ func Fatal(format string, args ...interface{}) {
 	defer loggerMu.Unlock()
 
 	if !initialized {
-		if err := Init(); err != nil {
+		if err := initLocked(); err != nil {
 			log.Fatalf("初始化日志系统失败: %v", err)
 			return
 		}
@@ -540,6 +623,7 @@ func CloseLogger() {
 		_ = logFile.Close()
 		logFile = nil
 	}
+	closeAccessLog()
 
 	log.Println("日志系统已关闭")
 }
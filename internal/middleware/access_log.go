@@ -0,0 +1,116 @@
+/**
+  @author: Hanhai
+  @desc: 访问日志中间件，按Apache Combined或JSON格式为每个请求记录一行访问日志
+**/
+
+package middleware
+
+import (
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 访问日志格式
+const (
+	AccessLogFormatCombined = "combined"
+	AccessLogFormatJSON     = "json"
+)
+
+// ChoicesContextKey 请求的候选结果数在gin上下文中的键，代理处理请求时设置，只记录大于1的值
+const ChoicesContextKey = "choices"
+
+// accessLogEntry JSON格式的访问日志条目
+type accessLogEntry struct {
+	RemoteIP   string  `json:"remote_ip"`
+	Time       string  `json:"time"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Protocol   string  `json:"protocol"`
+	Status     int     `json:"status"`
+	Bytes      int     `json:"bytes"`
+	Referer    string  `json:"referer"`
+	UserAgent  string  `json:"user_agent"`
+	DurationMs float64 `json:"duration_ms"`
+	Choices    int     `json:"choices,omitempty"` // 请求的n或best_of大于1时的候选结果数
+}
+
+// AccessLogMiddleware 访问日志中间件，未配置访问日志文件时不做任何处理
+// 需要在其他路由和中间件之前注册，才能记录被认证拦截的请求
+func AccessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		cfg := config.GetConfig()
+		if cfg == nil || cfg.Log.AccessLogFile == "" {
+			// 关闭之前打开的访问日志
+			logger.WriteAccessLog("", "")
+			return
+		}
+
+		entry := accessLogEntry{
+			RemoteIP:   c.ClientIP(),
+			Time:       start.Format(time.RFC3339),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.RequestURI(),
+			Protocol:   c.Request.Proto,
+			Status:     c.Writer.Status(),
+			Bytes:      c.Writer.Size(),
+			Referer:    c.Request.Referer(),
+			UserAgent:  c.Request.UserAgent(),
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if entry.Bytes < 0 {
+			entry.Bytes = 0
+		}
+		if choices, ok := c.Get(ChoicesContextKey); ok {
+			entry.Choices, _ = choices.(int)
+		}
+
+		var line string
+		if cfg.Log.AccessLogFormat == AccessLogFormatJSON {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return
+			}
+			line = string(data)
+		} else {
+			line = formatCombinedLog(entry, start)
+		}
+
+		logger.WriteAccessLog(cfg.Log.AccessLogFile, line)
+	}
+}
+
+// formatCombinedLog 按Apache Combined Log Format格式化访问日志
+// %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+func formatCombinedLog(entry accessLogEntry, start time.Time) string {
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = strconv.Itoa(entry.Bytes)
+	}
+
+	return fmt.Sprintf("%s - - [%s] %s %d %s %s %s",
+		entry.RemoteIP,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(entry.Method+" "+entry.Path+" "+entry.Protocol),
+		entry.Status,
+		bytes,
+		quoteOrDash(entry.Referer),
+		quoteOrDash(entry.UserAgent),
+	)
+}
+
+// quoteOrDash 为日志字段加引号，空值记录为"-"
+func quoteOrDash(value string) string {
+	if value == "" {
+		return `"-"`
+	}
+	return strconv.Quote(value)
+}
@@ -6,6 +6,9 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/logger"
 	"net/http"
@@ -14,6 +17,12 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// ClientTokenContextKey 上下文中保存已验证的客户端令牌的键名
+const ClientTokenContextKey = "client_token"
+
+// ClientHashContextKey 上下文中保存任意非空密钥方式下客户端凭据哈希的键名
+const ClientHashContextKey = "client_hash"
+
 // APIKeyMiddleware 检查API请求是否包含有效的API密钥
 func APIKeyMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -32,8 +41,9 @@ func APIKeyMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 检查是否启用了API密钥验证
-		if !cfg.Security.ApiKeyEnabled {
+		// 检查代理验证方式，每次请求读取当前配置，修改后立即生效
+		mode := config.GetProxyAuthMode(cfg)
+		if mode == config.AuthModeNone {
 			// 未启用API密钥验证，直接放行
 			c.Next()
 			return
@@ -54,8 +64,24 @@ func APIKeyMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 接受任意非空密钥时只记录密钥哈希，用于区分客户端
+		if mode == config.AuthModeAnyNonEmpty {
+			hash := hashClientCredential(apiKey)
+			logger.Info("API请求使用客户端凭据: %s", hash)
+			c.Set(ClientHashContextKey, hash)
+			c.Next()
+			return
+		}
+
 		// 验证API密钥
-		if apiKey != cfg.Security.ApiKey {
+		var valid bool
+		if mode == config.AuthModeTokenList {
+			valid = matchClientToken(apiKey, cfg.Security.ClientTokens)
+		} else {
+			secret := config.GetProxySecret(cfg)
+			valid = secret != "" && subtle.ConstantTimeCompare([]byte(apiKey), []byte(secret)) == 1
+		}
+		if !valid {
 			logger.Info("API请求提供了无效的API密钥")
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": gin.H{
@@ -68,11 +94,43 @@ func APIKeyMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// API密钥验证通过，继续处理请求
+		// 吊销的令牌返回单独的错误类型，便于客户端区分令牌无效和已被吊销
+		if mode == config.AuthModeTokenList && config.IsClientTokenRevoked(cfg, apiKey) {
+			logger.Info("API请求使用了已吊销的客户端令牌: %s", config.MaskKey(apiKey))
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{
+					"message": "客户端令牌已被吊销",
+					"type":    "token_revoked",
+					"code":    401,
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		// API密钥验证通过，记录客户端令牌后继续处理请求
+		c.Set(ClientTokenContextKey, apiKey)
 		c.Next()
 	}
 }
 
+// matchClientToken 检查密钥是否在客户端令牌列表中
+func matchClientToken(apiKey string, tokens []string) bool {
+	matched := false
+	for _, token := range tokens {
+		if token != "" && subtle.ConstantTimeCompare([]byte(apiKey), []byte(token)) == 1 {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// hashClientCredential 计算客户端凭据的哈希，日志和用量统计中不出现原始值
+func hashClientCredential(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
 // extractAPIKey 从请求中提取API密钥
 func extractAPIKey(c *gin.Context) string {
 	// 尝试从Authorization头部获取API密钥
@@ -100,3 +158,15 @@ func extractAPIKey(c *gin.Context) string {
 
 	return ""
 }
+
+// ClientIdentity 获取用于用量统计的客户端标识
+// 启用API密钥验证时按令牌区分客户端，接受任意非空密钥时按密钥哈希区分，否则按客户端IP区分
+func ClientIdentity(c *gin.Context) string {
+	if token := c.GetString(ClientTokenContextKey); token != "" {
+		return "token:" + config.MaskKey(token)
+	}
+	if hash := c.GetString(ClientHashContextKey); hash != "" {
+		return "client:" + hash
+	}
+	return "ip:" + c.ClientIP()
+}
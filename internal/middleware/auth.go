@@ -54,9 +54,7 @@ func AuthMiddleware() gin.HandlerFunc {
 			logger.Info("用户未认证，重定向到登录页面: %s", c.Request.URL.Path)
 
 			// 如果是API请求，返回401错误
-			if strings.HasPrefix(c.Request.URL.Path, "/api/") ||
-				strings.HasPrefix(c.Request.URL.Path, "/settings/") ||
-				strings.HasPrefix(c.Request.URL.Path, "/keys/") {
+			if isApiRequest(c) {
 				c.JSON(http.StatusUnauthorized, gin.H{
 					"code":    401,
 					"message": "请先登录",
@@ -67,7 +65,7 @@ func AuthMiddleware() gin.HandlerFunc {
 
 			// 否则重定向到登录页面
 			// 保存原始请求路径，以便登录后重定向回来
-			c.SetCookie("redirect_after_login", c.Request.URL.Path, 300, "/", "", false, false)
+			c.SetCookie("redirect_after_login", c.Request.URL.RequestURI(), 300, "/", "", false, false)
 			// 重定向到登录页面
 			c.Redirect(http.StatusFound, "/login")
 			c.Abort()
@@ -83,9 +81,7 @@ func AuthMiddleware() gin.HandlerFunc {
 			c.SetCookie(AuthCookieName, "", -1, "/", "", false, true)
 
 			// 如果是API请求，返回401错误
-			if strings.HasPrefix(c.Request.URL.Path, "/api/") ||
-				strings.HasPrefix(c.Request.URL.Path, "/settings/") ||
-				strings.HasPrefix(c.Request.URL.Path, "/keys/") {
+			if isApiRequest(c) {
 				c.JSON(http.StatusUnauthorized, gin.H{
 					"code":    401,
 					"message": "认证已过期，请重新登录",
@@ -95,7 +91,7 @@ func AuthMiddleware() gin.HandlerFunc {
 			}
 
 			// 保存原始请求路径，以便登录后重定向回来
-			c.SetCookie("redirect_after_login", c.Request.URL.Path, 300, "/", "", false, false)
+			c.SetCookie("redirect_after_login", c.Request.URL.RequestURI(), 300, "/", "", false, false)
 			// 重定向到登录页面
 			c.Redirect(http.StatusFound, "/login")
 			c.Abort()
@@ -107,6 +103,24 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// isApiRequest 检查未认证的请求是否应返回401而不是重定向到登录页面
+// 浏览器直接打开的深层链接页面（如/keys/:id）仍然重定向到登录页面
+func isApiRequest(c *gin.Context) bool {
+	path := c.Request.URL.Path
+	if !strings.HasPrefix(path, "/api/") &&
+		!strings.HasPrefix(path, "/settings/") &&
+		!strings.HasPrefix(path, "/keys/") {
+		return false
+	}
+	return !IsPageRequest(c)
+}
+
+// IsPageRequest 检查请求是否是浏览器的页面访问，而不是脚本发起的数据请求
+func IsPageRequest(c *gin.Context) bool {
+	return c.Request.Method == http.MethodGet &&
+		strings.Contains(c.GetHeader("Accept"), "text/html")
+}
+
 // isWhitelistPath 检查路径是否在白名单中
 func isWhitelistPath(path string) bool {
 	// 白名单路径列表
@@ -0,0 +1,80 @@
+/**
+  @author: Hanhai
+  @desc: 代理接口的客户端地址白名单中间件，拒绝不在允许的地址范围内的客户端，管理界面和健康检查不经过该中间件
+**/
+
+package middleware
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 已解析的客户端地址范围，设置修改后重新解析
+var (
+	clientNetworks      []*net.IPNet
+	clientNetworksValue string
+	clientNetworksMutex sync.Mutex
+)
+
+// ClientWhitelistMiddleware 检查客户端地址是否在允许使用代理接口的范围内，不在范围内时返回403
+// 每次请求读取当前配置，修改后立即生效
+func ClientWhitelistMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := net.ParseIP(c.ClientIP())
+		if ip != nil && isClientAllowed(ip, config.GetAllowedClientCIDRs(config.GetConfig())) {
+			c.Next()
+			return
+		}
+
+		logger.Warn("拒绝来自 %s 的代理请求，客户端地址不在允许的范围内", c.ClientIP())
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"message": "客户端地址不在允许的范围内",
+				"type":    "forbidden",
+				"code":    403,
+			},
+		})
+		c.Abort()
+	}
+}
+
+// isClientAllowed 判断客户端地址是否在允许的范围内，前缀长度为0的范围（如0.0.0.0/0）允许所有IPv4和IPv6地址
+func isClientAllowed(ip net.IP, cidrs []string) bool {
+	for _, network := range getClientNetworks(cidrs) {
+		if ones, _ := network.Mask.Size(); ones == 0 || network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// getClientNetworks 获取解析后的客户端地址范围，设置没有变化时使用上次的结果
+// 设置中无效的地址范围在保存时已经检查，这里解析失败时只保留有效的部分
+func getClientNetworks(cidrs []string) []*net.IPNet {
+	value := strings.Join(cidrs, ",")
+
+	clientNetworksMutex.Lock()
+	defer clientNetworksMutex.Unlock()
+
+	if clientNetworks != nil && value == clientNetworksValue {
+		return clientNetworks
+	}
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		parsed, err := config.ParseClientCIDRs([]string{cidr})
+		if err != nil {
+			logger.Error("忽略无效的客户端地址范围: %v", err)
+			continue
+		}
+		networks = append(networks, parsed...)
+	}
+	clientNetworks, clientNetworksValue = networks, value
+	return networks
+}
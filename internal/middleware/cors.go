@@ -6,9 +6,40 @@
 package middleware
 
 import (
+	"flowsilicon/internal/config"
+	"net/http"
+	"strconv"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 )
 
+// 代理接口允许跨域调用的HTTP方法
+var proxyCorsMethods = []string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodHead,
+}
+
+// 代理接口允许浏览器读取的响应头
+var proxyCorsExposeHeaders = []string{
+	"Retry-After",
+	"X-Request-ID",
+	"X-FS-Retries",
+	"X-FS-Clamped",
+	"X-FS-Truncated",
+	"X-Ratelimit-Limit-Requests",
+	"X-Ratelimit-Remaining-Requests",
+	"X-Ratelimit-Limit-Tokens",
+	"X-Ratelimit-Remaining-Tokens",
+}
+
+// 浏览器缓存预检结果的时间（秒）
+const proxyPreflightMaxAge = 600
+
 // CorsMiddleware 创建一个处理跨域请求的中间件
 func CorsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -81,3 +112,61 @@ func isBalanceRelatedPath(path string) bool {
 
 	return false
 }
+
+// ProxyCorsMiddleware 为代理接口处理跨域请求，只允许server.cors_allowed_origins中的来源，未设置时不返回跨域响应头
+// 代理接口使用令牌验证，不返回Access-Control-Allow-Credentials，浏览器不会附带Cookie
+// 预检请求直接返回，不转发到上游；必须在API密钥验证之前注册，浏览器发送预检请求时不会带上Authorization头
+func ProxyCorsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			// 不是跨域请求
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		allowOrigin := config.MatchCorsOrigin(config.GetConfig(), origin)
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if allowOrigin == "" {
+			if preflight {
+				// 不允许的来源，预检请求不带跨域响应头，浏览器会拒绝实际请求
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		header.Set("Access-Control-Allow-Origin", allowOrigin)
+		if !preflight {
+			// 实际请求，允许浏览器读取限流和请求ID等响应头
+			header.Set("Access-Control-Expose-Headers", strings.Join(proxyCorsExposeHeaders, ", "))
+			c.Next()
+			return
+		}
+
+		// 预检请求，按请求的方法和请求头返回允许的范围
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", getPreflightMethods(c.GetHeader("Access-Control-Request-Method")))
+		if requestHeaders := c.GetHeader("Access-Control-Request-Headers"); requestHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", requestHeaders)
+		}
+		header.Set("Access-Control-Max-Age", strconv.Itoa(proxyPreflightMaxAge))
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// getPreflightMethods 获取预检响应中允许的方法，请求的方法被允许时只返回该方法，否则返回全部允许的方法，由浏览器拒绝请求
+func getPreflightMethods(requestMethod string) string {
+	requestMethod = strings.ToUpper(strings.TrimSpace(requestMethod))
+	for _, method := range proxyCorsMethods {
+		if method == requestMethod {
+			return method
+		}
+	}
+	return strings.Join(proxyCorsMethods, ", ")
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"flowsilicon/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCorsRouter(origins []string) *gin.Engine {
+	cfg := &config.Config{}
+	cfg.Server.CorsAllowedOrigins = origins
+	config.UpdateConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Any("/api/*path", ProxyCorsMiddleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, "proxied")
+	})
+	return router
+}
+
+func TestProxyCorsMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		origin      string
+		preflight   bool
+		wantStatus  int
+		wantAllowed string
+	}{
+		{"empty allowlist, request", nil, "https://evil.example", false, http.StatusOK, ""},
+		{"empty allowlist, preflight", nil, "https://evil.example", true, http.StatusForbidden, ""},
+		{"listed origin, request", []string{"https://chat.example.com"}, "https://chat.example.com", false, http.StatusOK, "https://chat.example.com"},
+		{"listed origin, preflight", []string{"https://chat.example.com"}, "https://chat.example.com", true, http.StatusNoContent, "https://chat.example.com"},
+		{"listed origin, case and slash", []string{"https://Chat.Example.com/"}, "https://chat.example.com", false, http.StatusOK, "https://chat.example.com"},
+		{"unlisted origin", []string{"https://chat.example.com"}, "https://evil.example", false, http.StatusOK, ""},
+		{"wildcard", []string{"*"}, "https://any.example", false, http.StatusOK, "*"},
+		{"same origin request", nil, "", false, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newCorsRouter(tt.origins)
+			method := http.MethodPost
+			if tt.preflight {
+				method = http.MethodOptions
+			}
+			req := httptest.NewRequest(method, "/api/v1/chat/completions", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+				req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowed {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllowed)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want none", got)
+			}
+			if got := w.Header().Get("Access-Control-Expose-Headers"); got == "*" {
+				t.Error("Access-Control-Expose-Headers must not be *")
+			}
+		})
+	}
+}
+
+func TestParseCorsOrigins(t *testing.T) {
+	origins, err := config.ParseCorsOrigins([]string{" https://A.example.com/ ", "https://a.example.com", "", "*", "http://localhost:3000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://a.example.com", "*", "http://localhost:3000"}
+	if len(origins) != len(want) {
+		t.Fatalf("got %v, want %v", origins, want)
+	}
+	for i := range want {
+		if origins[i] != want[i] {
+			t.Errorf("got %v, want %v", origins, want)
+		}
+	}
+
+	for _, invalid := range []string{"chat.example.com", "https://a.example.com/path", "ftp://a.example.com", "https://"} {
+		if _, err := config.ParseCorsOrigins([]string{invalid}); err == nil {
+			t.Errorf("ParseCorsOrigins(%q) should fail", invalid)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+/**
+  @author: Hanhai
+  @desc: NDJSON响应格式，客户端请求Accept: application/x-ndjson时将上游的SSE流式响应转换为每行一个JSON对象
+**/
+
+package middleware
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// NDJSONContentType NDJSON响应的内容类型
+	NDJSONContentType = "application/x-ndjson"
+	// SSE响应的内容类型
+	sseContentType = "text/event-stream"
+)
+
+// NDJSONMiddleware 检测客户端是否请求NDJSON格式，是则转换SSE流式响应
+// 上游只支持SSE，转发前将Accept中的NDJSON替换为SSE；非流式响应保持不变
+func NDJSONMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accept := c.GetHeader("Accept")
+		if !strings.Contains(accept, NDJSONContentType) {
+			c.Next()
+			return
+		}
+
+		c.Request.Header.Set("Accept", strings.ReplaceAll(accept, NDJSONContentType, sseContentType))
+
+		writer := &ndjsonWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		writer.finish()
+	}
+}
+
+// ndjsonWriter 将写入的SSE事件转换为NDJSON行，响应不是SSE时原样写入
+type ndjsonWriter struct {
+	gin.ResponseWriter
+	// 流式处理中心跳协程和主流程会同时写入
+	mu        sync.Mutex
+	decided   bool
+	transcode bool
+	line      []byte   // 未读到换行符的半行数据
+	data      [][]byte // 当前事件已读取的data行
+}
+
+// decide 在响应头写出前根据内容类型决定是否转换
+func (w *ndjsonWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+
+	header := w.ResponseWriter.Header()
+	if strings.HasPrefix(header.Get("Content-Type"), sseContentType) {
+		w.transcode = true
+		header.Set("Content-Type", NDJSONContentType)
+		header.Del("Content-Length")
+	}
+}
+
+// WriteHeader 写入状态码前决定是否转换
+func (w *ndjsonWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.decide()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// WriteHeaderNow 立即写出响应头前决定是否转换
+func (w *ndjsonWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.decide()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Write 转换SSE数据后写入
+func (w *ndjsonWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.decide()
+	if !w.transcode {
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.line = append(w.line, data...)
+	for {
+		idx := bytes.IndexByte(w.line, '\n')
+		if idx < 0 {
+			break
+		}
+		line := bytes.TrimSuffix(w.line[:idx], []byte("\r"))
+		if err := w.processLine(line); err != nil {
+			return 0, err
+		}
+		w.line = w.line[idx+1:]
+	}
+	// 剩余的半行复制出来，避免持有调用方的缓冲区
+	w.line = append([]byte(nil), w.line...)
+	return len(data), nil
+}
+
+// WriteString 转换SSE数据后写入
+func (w *ndjsonWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 刷新已转换的数据
+func (w *ndjsonWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.decide()
+	w.ResponseWriter.Flush()
+}
+
+// processLine 处理一行SSE数据，空行表示事件结束
+// 注释、event、id和retry行在NDJSON中没有对应的内容，直接丢弃
+func (w *ndjsonWriter) processLine(line []byte) error {
+	switch {
+	case len(line) == 0:
+		return w.writeEvent()
+	case bytes.HasPrefix(line, []byte("data:")):
+		value := bytes.TrimPrefix(line[len("data:"):], []byte(" "))
+		w.data = append(w.data, append([]byte(nil), value...))
+	case line[0] == ':',
+		bytes.HasPrefix(line, []byte("event:")),
+		bytes.HasPrefix(line, []byte("id:")),
+		bytes.HasPrefix(line, []byte("retry:")):
+	default:
+		// 没有data前缀的行视为上一行data的延续
+		w.data = append(w.data, append([]byte(nil), line...))
+	}
+	return nil
+}
+
+// writeEvent 将当前事件的data行拼接为一个JSON对象写出，[DONE]事件不写出
+func (w *ndjsonWriter) writeEvent() error {
+	if len(w.data) == 0 {
+		return nil
+	}
+	payload := bytes.TrimSpace(bytes.Join(w.data, nil))
+	w.data = w.data[:0]
+	if len(payload) == 0 || bytes.Equal(payload, []byte("[DONE]")) {
+		return nil
+	}
+
+	_, err := w.ResponseWriter.Write(append(payload, '\n'))
+	return err
+}
+
+// finish 请求处理结束后写出没有以空行结束的最后一个事件
+func (w *ndjsonWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.transcode {
+		return
+	}
+	if len(w.line) > 0 {
+		w.processLine(bytes.TrimSuffix(w.line, []byte("\r")))
+		w.line = nil
+	}
+	if err := w.writeEvent(); err == nil {
+		w.ResponseWriter.Flush()
+	}
+}
@@ -0,0 +1,32 @@
+/**
+  @author: Hanhai
+  @desc: 代理锁定中间件，紧急轮换凭据并锁定代理后，所有代理接口在验证和转发之前返回503
+**/
+
+package middleware
+
+import (
+	"flowsilicon/internal/config"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProxyLockMiddleware 代理已锁定时拒绝请求，发放新的客户端令牌或API密钥后解除
+// /api/*和OpenAI兼容接口都需要注册，锁定时不会使用密钥池中的密钥转发请求
+func ProxyLockMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg := config.GetConfig(); cfg != nil && cfg.Security.ProxyLocked {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": gin.H{
+					"message": "代理已在紧急轮换凭据后锁定，请联系管理员获取新的API密钥",
+					"type":    "proxy_locked",
+					"code":    503,
+				},
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
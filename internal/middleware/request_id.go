@@ -0,0 +1,59 @@
+/**
+  @author: Hanhai
+  @desc: 请求ID中间件，沿用客户端传入的X-Request-ID或生成新的请求ID，并在响应头中返回
+**/
+
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RequestIDHeader 请求ID的请求头和响应头名称
+	RequestIDHeader = "X-Request-ID"
+	// 请求ID在gin上下文中的键
+	requestIDContextKey = "request_id"
+	// 客户端传入的请求ID的最大长度
+	maxRequestIDLength = 128
+)
+
+// RequestIDMiddleware 为每个请求设置请求ID
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := strings.TrimSpace(c.GetHeader(RequestIDHeader))
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = newRequestID()
+		}
+
+		c.Set(requestIDContextKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// RequestID 获取当前请求的请求ID，未经过RequestIDMiddleware时生成新的请求ID
+func RequestID(c *gin.Context) string {
+	if value, exists := c.Get(requestIDContextKey); exists {
+		if requestID, ok := value.(string); ok {
+			return requestID
+		}
+	}
+
+	requestID := newRequestID()
+	c.Set(requestIDContextKey, requestID)
+	return requestID
+}
+
+// newRequestID 生成32位十六进制的随机请求ID
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,466 @@
+/**
+  @author: Hanhai
+  @desc: 模拟上游的接口实现，对相同的输入始终返回相同的结果
+**/
+
+package mockupstream
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 模型列表接口返回的模型
+var mockModels = []string{"mock-chat", "mock-embedding", "mock-rerank"}
+
+// 未指定维度时embedding向量的长度
+const defaultEmbeddingDimensions = 8
+
+// chatRequest 对话请求中模拟上游关心的字段
+type chatRequest struct {
+	Model     string            `json:"model"`
+	Messages  []json.RawMessage `json:"messages"`
+	Stream    bool              `json:"stream"`
+	MaxTokens int               `json:"max_tokens"`
+}
+
+// handleChatCompletions 处理对话请求，回复内容由模型名和最后一条消息确定
+func (s *Server) handleChatCompletions(c *gin.Context) {
+	if _, ok := requireAuth(c); !ok {
+		return
+	}
+
+	var req chatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	behavior := s.behaviorFor(c, req.Model)
+	if !applyBehavior(c, behavior) {
+		return
+	}
+
+	var promptTokens int
+	var lastContent string
+	for _, raw := range req.Messages {
+		content := messageContent(raw)
+		promptTokens += countTokens(content)
+		lastContent = content
+	}
+
+	words := strings.Fields(fmt.Sprintf("[mock:%s] %s", req.Model, lastContent))
+	if req.MaxTokens > 0 && len(words) > req.MaxTokens {
+		words = words[:req.MaxTokens]
+	}
+	finishReason := "stop"
+	if req.MaxTokens > 0 && len(words) == req.MaxTokens {
+		finishReason = "length"
+	}
+
+	id := "chatcmpl-" + shortHash(req.Model+lastContent)
+	created := time.Now().Unix()
+	usage := gin.H{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": len(words),
+		"total_tokens":      promptTokens + len(words),
+	}
+
+	if !req.Stream {
+		c.JSON(http.StatusOK, gin.H{
+			"id":      id,
+			"object":  "chat.completion",
+			"created": created,
+			"model":   req.Model,
+			"choices": []gin.H{{
+				"index":         0,
+				"message":       gin.H{"role": "assistant", "content": strings.Join(words, " ")},
+				"finish_reason": finishReason,
+			}},
+			"usage": usage,
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	writeChunk := func(delta gin.H, finish interface{}, withUsage bool) bool {
+		chunk := gin.H{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   req.Model,
+			"choices": []gin.H{{"index": 0, "delta": delta, "finish_reason": finish}},
+		}
+		if withUsage {
+			chunk["usage"] = usage
+		}
+		data, _ := json.Marshal(chunk)
+		if _, err := fmt.Fprintf(c.Writer, "data: %s\n\n", data); err != nil {
+			return false
+		}
+		c.Writer.Flush()
+		return true
+	}
+
+	if !writeChunk(gin.H{"role": "assistant", "content": ""}, nil, false) {
+		return
+	}
+	for i, word := range words {
+		if behavior.ChunkDelayMs > 0 {
+			select {
+			case <-time.After(time.Duration(behavior.ChunkDelayMs) * time.Millisecond):
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+		if i > 0 {
+			word = " " + word
+		}
+		if !writeChunk(gin.H{"content": word}, nil, false) {
+			return
+		}
+	}
+	if !writeChunk(gin.H{}, finishReason, true) {
+		return
+	}
+	fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	c.Writer.Flush()
+}
+
+// handleCompletions 处理文本补全请求
+func (s *Server) handleCompletions(c *gin.Context) {
+	if _, ok := requireAuth(c); !ok {
+		return
+	}
+
+	var req struct {
+		Model  string `json:"model"`
+		Prompt string `json:"prompt"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	if !applyBehavior(c, s.behaviorFor(c, req.Model)) {
+		return
+	}
+
+	text := fmt.Sprintf("[mock:%s] %s", req.Model, req.Prompt)
+	promptTokens := countTokens(req.Prompt)
+	completionTokens := countTokens(text)
+	c.JSON(http.StatusOK, gin.H{
+		"id":      "cmpl-" + shortHash(req.Model+req.Prompt),
+		"object":  "text_completion",
+		"created": time.Now().Unix(),
+		"model":   req.Model,
+		"choices": []gin.H{{"index": 0, "text": text, "finish_reason": "stop"}},
+		"usage": gin.H{
+			"prompt_tokens":     promptTokens,
+			"completion_tokens": completionTokens,
+			"total_tokens":      promptTokens + completionTokens,
+		},
+	})
+}
+
+// handleEmbeddings 处理embedding请求，向量由模型名和输入文本的哈希生成
+func (s *Server) handleEmbeddings(c *gin.Context) {
+	if _, ok := requireAuth(c); !ok {
+		return
+	}
+
+	var req struct {
+		Model      string      `json:"model"`
+		Input      interface{} `json:"input"`
+		Dimensions int         `json:"dimensions"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	if !applyBehavior(c, s.behaviorFor(c, req.Model)) {
+		return
+	}
+
+	var inputs []string
+	switch v := req.Input.(type) {
+	case string:
+		inputs = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			inputs = append(inputs, fmt.Sprint(item))
+		}
+	default:
+		badRequest(c, "input must be a string or an array of strings")
+		return
+	}
+
+	dimensions := req.Dimensions
+	if dimensions <= 0 {
+		dimensions = defaultEmbeddingDimensions
+	}
+
+	var promptTokens int
+	data := make([]gin.H, 0, len(inputs))
+	for i, input := range inputs {
+		promptTokens += countTokens(input)
+		data = append(data, gin.H{
+			"object":    "embedding",
+			"index":     i,
+			"embedding": embeddingVector(req.Model+"\x00"+input, dimensions),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"model":  req.Model,
+		"data":   data,
+		"usage":  gin.H{"prompt_tokens": promptTokens, "total_tokens": promptTokens},
+	})
+}
+
+// handleRerank 处理重排序请求，按文档与查询共有的词数排序
+func (s *Server) handleRerank(c *gin.Context) {
+	if _, ok := requireAuth(c); !ok {
+		return
+	}
+
+	var req struct {
+		Model     string   `json:"model"`
+		Query     string   `json:"query"`
+		Documents []string `json:"documents"`
+		TopN      int      `json:"top_n"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	if !applyBehavior(c, s.behaviorFor(c, req.Model)) {
+		return
+	}
+
+	queryWords := make(map[string]bool)
+	for _, w := range strings.Fields(strings.ToLower(req.Query)) {
+		queryWords[w] = true
+	}
+
+	type result struct {
+		index int
+		score float64
+	}
+	results := make([]result, len(req.Documents))
+	for i, doc := range req.Documents {
+		words := strings.Fields(strings.ToLower(doc))
+		matched := 0
+		for _, w := range words {
+			if queryWords[w] {
+				matched++
+			}
+		}
+		score := 0.0
+		if len(words) > 0 {
+			score = float64(matched) / float64(len(words))
+		}
+		results[i] = result{index: i, score: score}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].score > results[j].score })
+	if req.TopN > 0 && req.TopN < len(results) {
+		results = results[:req.TopN]
+	}
+
+	items := make([]gin.H, 0, len(results))
+	for _, r := range results {
+		items = append(items, gin.H{"index": r.index, "relevance_score": r.score})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      "rerank-" + shortHash(req.Model+req.Query),
+		"results": items,
+	})
+}
+
+// handleModels 返回固定的模型列表
+func (s *Server) handleModels(c *gin.Context) {
+	if _, ok := requireAuth(c); !ok {
+		return
+	}
+
+	data := make([]gin.H, 0, len(mockModels))
+	for _, id := range mockModels {
+		data = append(data, gin.H{"id": id, "object": "model", "owned_by": "mock"})
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
+
+// handleUserInfo 按硅基流动用户信息接口的格式返回密钥的模拟余额
+func (s *Server) handleUserInfo(c *gin.Context) {
+	key, ok := requireAuth(c)
+	if !ok {
+		return
+	}
+
+	balance := strconv.FormatFloat(s.balanceFor(key), 'f', 4, 64)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    20000,
+		"message": "OK",
+		"status":  true,
+		"data": gin.H{
+			"id":            "mock-" + shortHash(key),
+			"name":          "mock",
+			"balance":       balance,
+			"chargeBalance": "0",
+			"totalBalance":  balance,
+			"status":        "normal",
+		},
+	})
+}
+
+// handleGetControl 返回当前的模拟行为和余额配置
+func (s *Server) handleGetControl(c *gin.Context) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"models":          s.behaviors,
+		"balances":        s.balances,
+		"default_balance": s.defaultBalance,
+		"signing": gin.H{
+			"enabled":  s.signing.Secret != "",
+			"signed":   s.signedRequests,
+			"rejected": s.rejectedRequests,
+		},
+	})
+}
+
+// handleSetModelBehavior 设置模型的模拟行为
+func (s *Server) handleSetModelBehavior(c *gin.Context) {
+	var req struct {
+		Model string `json:"model"`
+		ModelBehavior
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if req.Model == "" {
+		req.Model = anyModel
+	}
+
+	s.SetModelBehavior(req.Model, req.ModelBehavior)
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+// handleSetBalance 设置密钥的模拟余额
+func (s *Server) handleSetBalance(c *gin.Context) {
+	var req struct {
+		Key     string  `json:"key"`
+		Balance float64 `json:"balance"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	s.SetBalance(req.Key, req.Balance)
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+// handleReset 清除所有模拟配置
+func (s *Server) handleReset(c *gin.Context) {
+	s.Reset()
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+// messageContent 提取消息中的文本内容，支持字符串和多段内容两种格式
+func messageContent(raw json.RawMessage) string {
+	var msg struct {
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return ""
+	}
+
+	var text string
+	if err := json.Unmarshal(msg.Content, &text); err == nil {
+		return text
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(msg.Content, &parts); err != nil {
+		return ""
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+// countTokens 按空白分隔的词数估算token数
+func countTokens(text string) int {
+	return len(strings.Fields(text))
+}
+
+// embeddingVector 由文本哈希生成取值在[-1, 1]之间的确定性向量
+func embeddingVector(seed string, dimensions int) []float64 {
+	vector := make([]float64, dimensions)
+	sum := sha256.Sum256([]byte(seed))
+	for i := range vector {
+		if i > 0 && i%8 == 0 {
+			sum = sha256.Sum256(sum[:])
+		}
+		offset := (i % 8) * 4
+		value := binary.BigEndian.Uint32(sum[offset : offset+4])
+		vector[i] = float64(value)/float64(^uint32(0))*2 - 1
+	}
+	return vector
+}
+
+// shortHash 返回文本哈希的前12位十六进制字符
+func shortHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return fmt.Sprintf("%x", sum[:6])
+}
+
+// queryInt 读取整数类型的请求参数
+func queryInt(c *gin.Context, name string) (int, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, false
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// badRequest 返回400错误
+func badRequest(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    "invalid_request_error",
+			"code":    http.StatusBadRequest,
+		},
+	})
+}
@@ -0,0 +1,258 @@
+/**
+  @author: Hanhai
+  @desc: 模拟上游服务，提供确定性的OpenAI兼容接口，用于开发和无需消耗额度的测试
+**/
+
+package mockupstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// FlagName 启用模拟上游的命令行参数
+	FlagName = "--mock-upstream"
+	// DefaultAddr 未指定地址时模拟上游的监听地址
+	DefaultAddr = "127.0.0.1:18080"
+	// DefaultBalance 未单独设置余额的密钥返回的余额
+	DefaultBalance = 100.0
+	// 对所有模型生效的行为配置名称
+	anyModel = "*"
+)
+
+// ModelBehavior 模拟上游针对单个模型的行为配置
+type ModelBehavior struct {
+	LatencyMs    int    `json:"latency_ms"`     // 返回响应前的延迟
+	ChunkDelayMs int    `json:"chunk_delay_ms"` // 流式响应每个数据块之间的延迟
+	ErrorStatus  int    `json:"error_status"`   // 非0时直接返回该状态码的错误
+	ErrorMessage string `json:"error_message"`  // 错误信息
+}
+
+// Server 模拟上游服务
+type Server struct {
+	mu             sync.RWMutex
+	behaviors      map[string]ModelBehavior
+	balances       map[string]float64
+	defaultBalance float64
+
+	// 要求的请求签名，以及验证通过和被拒绝的请求数
+	signing          SigningConfig
+	signedRequests   int
+	rejectedRequests int
+
+	httpServer *http.Server
+}
+
+// NewServer 创建模拟上游服务
+func NewServer() *Server {
+	return &Server{
+		behaviors:      make(map[string]ModelBehavior),
+		balances:       make(map[string]float64),
+		defaultBalance: DefaultBalance,
+	}
+}
+
+// ParseFlag 从命令行参数中解析模拟上游的监听地址
+// 支持 --mock-upstream 和 --mock-upstream=地址 两种形式，未指定时返回false
+func ParseFlag(args []string) (string, bool) {
+	for _, arg := range args {
+		if arg == FlagName {
+			return DefaultAddr, true
+		}
+		if strings.HasPrefix(arg, FlagName+"=") {
+			addr := strings.TrimPrefix(arg, FlagName+"=")
+			if addr == "" {
+				addr = DefaultAddr
+			}
+			return addr, true
+		}
+	}
+	return "", false
+}
+
+// Start 在指定地址启动模拟上游，返回可用作上游地址的URL
+// 只允许监听本机回环地址，避免模拟服务被外部访问
+func (s *Server) Start(addr string) (string, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("无效的模拟上游地址 %s: %w", addr, err)
+	}
+	if !isLoopbackHost(host) {
+		return "", fmt.Errorf("模拟上游只能监听本机回环地址，当前地址: %s", addr)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("模拟上游监听失败: %w", err)
+	}
+
+	s.httpServer = &http.Server{Handler: s.Handler()}
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("模拟上游服务异常退出: %v", err)
+		}
+	}()
+
+	baseURL := "http://" + listener.Addr().String()
+	logger.Info("模拟上游已启动: %s", baseURL)
+	return baseURL, nil
+}
+
+// Stop 停止模拟上游
+func (s *Server) Stop(ctx context.Context) error {
+	if s.httpServer == nil {
+		return nil
+	}
+	return s.httpServer.Shutdown(ctx)
+}
+
+// Handler 返回模拟上游的HTTP处理器
+func (s *Server) Handler() http.Handler {
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	v1 := router.Group("/v1")
+	v1.Use(s.signatureMiddleware())
+	v1.POST("/chat/completions", s.handleChatCompletions)
+	v1.POST("/completions", s.handleCompletions)
+	v1.POST("/embeddings", s.handleEmbeddings)
+	v1.POST("/rerank", s.handleRerank)
+	v1.GET("/models", s.handleModels)
+	v1.GET("/user/info", s.handleUserInfo)
+
+	// 控制接口，用于在测试过程中调整模拟行为
+	control := router.Group("/mock")
+	control.GET("/config", s.handleGetControl)
+	control.PUT("/models", s.handleSetModelBehavior)
+	control.PUT("/balances", s.handleSetBalance)
+	control.PUT("/signing", s.handleSetSigning)
+	control.POST("/reset", s.handleReset)
+
+	return router
+}
+
+// SetModelBehavior 设置模型的模拟行为，模型为*时对所有未单独配置的模型生效
+func (s *Server) SetModelBehavior(model string, behavior ModelBehavior) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.behaviors[model] = behavior
+}
+
+// SetBalance 设置密钥的模拟余额，密钥为空或*时设置默认余额
+func (s *Server) SetBalance(key string, balance float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key == "" || key == anyModel {
+		s.defaultBalance = balance
+		return
+	}
+	s.balances[key] = balance
+}
+
+// Reset 清除所有模拟行为、余额和签名设置
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.behaviors = make(map[string]ModelBehavior)
+	s.balances = make(map[string]float64)
+	s.defaultBalance = DefaultBalance
+	s.signing = SigningConfig{}
+	s.signedRequests, s.rejectedRequests = 0, 0
+}
+
+// behaviorFor 获取本次请求的模拟行为，请求参数优先于控制接口的配置
+func (s *Server) behaviorFor(c *gin.Context, model string) ModelBehavior {
+	s.mu.RLock()
+	behavior, ok := s.behaviors[model]
+	if !ok {
+		behavior = s.behaviors[anyModel]
+	}
+	s.mu.RUnlock()
+
+	if v, ok := queryInt(c, "mock_latency_ms"); ok {
+		behavior.LatencyMs = v
+	}
+	if v, ok := queryInt(c, "mock_chunk_delay_ms"); ok {
+		behavior.ChunkDelayMs = v
+	}
+	if v, ok := queryInt(c, "mock_error_status"); ok {
+		behavior.ErrorStatus = v
+	}
+	if msg := c.Query("mock_error_message"); msg != "" {
+		behavior.ErrorMessage = msg
+	}
+	return behavior
+}
+
+// balanceFor 获取密钥的模拟余额
+func (s *Server) balanceFor(key string) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if balance, ok := s.balances[key]; ok {
+		return balance
+	}
+	return s.defaultBalance
+}
+
+// applyBehavior 按配置延迟并注入错误，已返回错误时结果为false
+func applyBehavior(c *gin.Context, behavior ModelBehavior) bool {
+	if behavior.LatencyMs > 0 {
+		select {
+		case <-time.After(time.Duration(behavior.LatencyMs) * time.Millisecond):
+		case <-c.Request.Context().Done():
+			return false
+		}
+	}
+
+	if behavior.ErrorStatus != 0 {
+		message := behavior.ErrorMessage
+		if message == "" {
+			message = fmt.Sprintf("mock upstream error %d", behavior.ErrorStatus)
+		}
+		c.JSON(behavior.ErrorStatus, gin.H{
+			"error": gin.H{
+				"message": message,
+				"type":    "mock_error",
+				"code":    behavior.ErrorStatus,
+			},
+		})
+		return false
+	}
+	return true
+}
+
+// requireAuth 检查请求是否携带了密钥，未携带时返回401
+func requireAuth(c *gin.Context) (string, bool) {
+	key := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if key == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{
+				"message": "missing api key",
+				"type":    "invalid_request_error",
+				"code":    http.StatusUnauthorized,
+			},
+		})
+		return "", false
+	}
+	return key, true
+}
+
+// isLoopbackHost 检查主机名是否是本机回环地址
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,99 @@
+/**
+  @author: Hanhai
+  @desc: 模拟上游的请求签名验证，设置签名密钥后/v1接口只接受签名正确的请求，用于验证附加请求头和签名的配置
+**/
+
+package mockupstream
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/signing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SigningConfig 模拟上游要求的HMAC-SHA256请求签名，Secret为空时不验证签名
+type SigningConfig struct {
+	Secret          string `json:"secret"`
+	Header          string `json:"header"`
+	TimestampHeader string `json:"timestamp_header"`
+	Canonical       string `json:"canonical"`
+}
+
+// SetSigning 设置要求的请求签名，Secret为空时关闭签名验证
+func (s *Server) SetSigning(cfg SigningConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signing = cfg
+	s.signedRequests, s.rejectedRequests = 0, 0
+}
+
+// signatureMiddleware 验证请求签名，签名不正确时返回401
+func (s *Server) signatureMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.mu.RLock()
+		cfg := s.signing
+		s.mu.RUnlock()
+		if cfg.Secret == "" {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			var err error
+			if body, err = io.ReadAll(c.Request.Body); err != nil {
+				badRequest(c, fmt.Sprintf("failed to read request body: %v", err))
+				c.Abort()
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		err := signing.VerifyHMACSHA256(c.Request, body, config.RequestSigningConfig{
+			Type:            signing.TypeHMACSHA256,
+			Secret:          cfg.Secret,
+			Header:          cfg.Header,
+			TimestampHeader: cfg.TimestampHeader,
+			Canonical:       cfg.Canonical,
+		}, 0)
+
+		s.mu.Lock()
+		if err != nil {
+			s.rejectedRequests++
+		} else {
+			s.signedRequests++
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{
+					"message": fmt.Sprintf("invalid request signature: %v", err),
+					"type":    "authentication_error",
+					"code":    http.StatusUnauthorized,
+				},
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// handleSetSigning 设置要求的请求签名
+func (s *Server) handleSetSigning(c *gin.Context) {
+	var req SigningConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	s.SetSigning(req)
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
@@ -0,0 +1,84 @@
+/**
+  @author: Hanhai
+  @desc: 内置模型列表，模型数据库初始化失败时从程序内嵌的models.json加载常用模型的类型和能力，保证请求转换和密钥策略仍然可用
+**/
+
+package model
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"flowsilicon/internal/logger"
+)
+
+//go:embed models.json
+var bundledModelsJSON []byte
+
+var (
+	// 模型数据库不可用时使用的内置模型列表
+	bundledModels      map[string]Model
+	bundledModelsMutex sync.RWMutex
+)
+
+// UseBundledModels 模型数据库初始化失败时改用内置模型列表，此后模型查询不再访问数据库
+func UseBundledModels(cause error) error {
+	var models []Model
+	if err := json.Unmarshal(bundledModelsJSON, &models); err != nil {
+		return fmt.Errorf("解析内置模型列表失败: %w", err)
+	}
+
+	// 初始化失败时数据库可能已经打开，关闭后由查询函数回退到内置列表
+	if modelDB != nil {
+		CloseModelDB()
+		modelDB = nil
+	}
+
+	byID := make(map[string]Model, len(models))
+	for _, m := range models {
+		byID[m.ID] = m
+	}
+
+	bundledModelsMutex.Lock()
+	bundledModels = byID
+	bundledModelsMutex.Unlock()
+
+	logger.Warn("模型数据库不可用（%v），使用内置模型列表，共 %d 个模型，模型配置的修改不会保存", cause, len(byID))
+	return nil
+}
+
+// IsUsingBundledModels 检查当前是否使用内置模型列表
+func IsUsingBundledModels() bool {
+	bundledModelsMutex.RLock()
+	defer bundledModelsMutex.RUnlock()
+	return bundledModels != nil
+}
+
+// getBundledModel 从内置模型列表中获取模型
+func getBundledModel(modelId string) (Model, bool) {
+	bundledModelsMutex.RLock()
+	defer bundledModelsMutex.RUnlock()
+	m, ok := bundledModels[modelId]
+	return m, ok
+}
+
+// getBundledModels 获取按模型ID排序的内置模型列表，未使用内置列表时返回false
+func getBundledModels() ([]Model, bool) {
+	bundledModelsMutex.RLock()
+	defer bundledModelsMutex.RUnlock()
+	if bundledModels == nil {
+		return nil, false
+	}
+
+	models := make([]Model, 0, len(bundledModels))
+	for _, m := range bundledModels {
+		models = append(models, m)
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].ID < models[j].ID
+	})
+	return models, true
+}
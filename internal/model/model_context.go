@@ -0,0 +1,147 @@
+/**
+  @author: Hanhai
+  @desc: 模型上下文长度，同步模型列表时从上游返回的信息中获取，查询结果缓存在内存中，用于转发前检查请求是否超过上下文长度
+**/
+
+package model
+
+import (
+	"database/sql"
+	"flowsilicon/internal/logger"
+	"sync"
+)
+
+// 上游模型列表中可能表示上下文长度的字段，按优先级排列
+var contextWindowFields = []string{"context_length", "context_window", "max_context_length", "max_model_len"}
+
+var (
+	// 最近一次从上游获取的模型上下文长度，保存模型列表时写入数据库
+	pendingContextWindows     map[string]int
+	pendingContextWindowsLock sync.Mutex
+
+	// 模型上下文长度的缓存，为nil时下次查询从数据库重新加载
+	modelContextCache     map[string]int
+	modelContextCacheLock sync.RWMutex
+)
+
+// ensureModelContextColumn 为旧版本数据库添加上下文长度字段
+func ensureModelContextColumn() error {
+	var columnExists int
+	err := modelDB.QueryRow("SELECT count(*) FROM pragma_table_info('models') WHERE name='context_window'").Scan(&columnExists)
+	if err != nil {
+		logger.Error("检查context_window字段存在失败: %v", err)
+		return err
+	}
+	if columnExists > 0 {
+		return nil
+	}
+
+	if _, err := modelDB.Exec("ALTER TABLE models ADD COLUMN context_window INTEGER DEFAULT 0 NOT NULL"); err != nil {
+		logger.Error("添加context_window字段失败: %v", err)
+		return err
+	}
+	logger.Info("成功添加context_window字段到models表")
+	return nil
+}
+
+// GetModelContext 获取模型的最大上下文长度（令牌数），未知时返回0
+// 第一次查询时从数据库加载所有模型的上下文长度，之后使用缓存，同步模型列表后重新加载
+func GetModelContext(modelID string) int {
+	if modelDB == nil {
+		if IsUsingBundledModels() {
+			m, _ := getBundledModel(modelID)
+			return m.ContextWindow
+		}
+		return 0
+	}
+
+	modelContextCacheLock.RLock()
+	cache := modelContextCache
+	modelContextCacheLock.RUnlock()
+	if cache != nil {
+		return cache[modelID]
+	}
+
+	modelContextCacheLock.Lock()
+	defer modelContextCacheLock.Unlock()
+	// 等待锁期间其他调用可能已经加载了缓存
+	if modelContextCache == nil {
+		cache, err := loadModelContexts()
+		if err != nil {
+			logger.Error("加载模型上下文长度失败: %v", err)
+			return 0
+		}
+		modelContextCache = cache
+	}
+	return modelContextCache[modelID]
+}
+
+// loadModelContexts 从数据库加载设置了上下文长度的模型
+func loadModelContexts() (map[string]int, error) {
+	rows, err := modelDB.Query("SELECT id, context_window FROM models WHERE deleted_at IS NULL AND context_window > 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contexts := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var contextWindow int
+		if err := rows.Scan(&id, &contextWindow); err != nil {
+			return nil, err
+		}
+		contexts[id] = contextWindow
+	}
+	return contexts, rows.Err()
+}
+
+// invalidateModelContextCache 清空上下文长度缓存，下次查询时重新加载
+func invalidateModelContextCache() {
+	modelContextCacheLock.Lock()
+	modelContextCache = nil
+	modelContextCacheLock.Unlock()
+}
+
+// RecordRemoteContextWindows 从上游模型列表的条目中提取上下文长度，保存模型列表时写入
+// 返回提取到的数量
+func RecordRemoteContextWindows(items []interface{}) int {
+	windows := make(map[string]int)
+	for _, item := range items {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, ok := entry["id"].(string)
+		if !ok {
+			continue
+		}
+		for _, field := range contextWindowFields {
+			if window := positiveInt(entry[field]); window > 0 {
+				windows[id] = window
+				break
+			}
+		}
+	}
+
+	pendingContextWindowsLock.Lock()
+	pendingContextWindows = windows
+	pendingContextWindowsLock.Unlock()
+
+	return len(windows)
+}
+
+// applyPendingContextWindows 将上游提供的上下文长度写入模型，上游没有提供的模型保留原来的值
+func applyPendingContextWindows(tx *sql.Tx) error {
+	pendingContextWindowsLock.Lock()
+	windows := pendingContextWindows
+	pendingContextWindows = nil
+	pendingContextWindowsLock.Unlock()
+
+	for id, window := range windows {
+		if _, err := tx.Exec("UPDATE models SET context_window = ? WHERE id = ?", window, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -11,27 +11,34 @@ import (
 	"encoding/json"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/logger"
+	"flowsilicon/internal/signing"
 	"flowsilicon/pkg/utils"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
 var (
 	// 数据库实例
 	modelDB *sql.DB
+	// 保证数据库只被关闭一次
+	closeModelDBOnce sync.Once
 )
 
 // InitModelDB 初始化模型数据库
 func InitModelDB(dbPath string) error {
 	var err error
-	modelDB, err = sql.Open("sqlite", dbPath)
+	modelDB, err = sql.Open("sqlite", config.SQLiteDSN(dbPath))
 	if err != nil {
 		return err
 	}
 
+	// 重新打开后允许再次关闭
+	closeModelDBOnce = sync.Once{}
+
 	// 设置连接池参数
 	modelDB.SetMaxOpenConns(1)                   // 限制最大连接数为1，以减少并发问题
 	modelDB.SetMaxIdleConns(1)                   // 最大空闲连接数
@@ -49,6 +56,12 @@ func InitModelDB(dbPath string) error {
 		return err
 	}
 
+	// 只读数据库模式和只读维护模式下不创建表和迁移字段
+	if err := config.CheckWritable(); err != nil {
+		logger.Warn("%v，模型数据库以只读方式打开", err)
+		return nil
+	}
+
 	// 创建模型表
 	query := `CREATE TABLE IF NOT EXISTS models (
 		id TEXT PRIMARY KEY,
@@ -134,6 +147,16 @@ func InitModelDB(dbPath string) error {
 		logger.Info("成功添加call_count字段到models表")
 	}
 
+	// 添加输出令牌数限制字段
+	if err := ensureModelTokenColumns(); err != nil {
+		return err
+	}
+
+	// 添加上下文长度字段
+	if err := ensureModelContextColumn(); err != nil {
+		return err
+	}
+
 	// 更新所有免费模型的策略为8（免费策略），默认策略为6（普通策略）
 	_, err = modelDB.Exec(`UPDATE models SET 
 							strategy_id = CASE 
@@ -155,17 +178,24 @@ func InitModelDB(dbPath string) error {
 }
 
 // CloseModelDB 关闭模型数据库
+// 可以安全地重复调用，只有第一次调用会真正关闭连接
 func CloseModelDB() error {
-	if modelDB != nil {
-		return modelDB.Close()
-	}
-	return nil
+	var err error
+	closeModelDBOnce.Do(func() {
+		if modelDB != nil {
+			err = modelDB.Close()
+		}
+	})
+	return err
 }
 
 // GetAllModels 获取所有模型
 func GetAllModels() ([]Model, error) {
-	// 确保数据库连接已经初始化
+	// 确保数据库连接已经初始化，数据库不可用时使用内置模型列表
 	if modelDB == nil {
+		if models, ok := getBundledModels(); ok {
+			return models, nil
+		}
 		return nil, fmt.Errorf("数据库连接未初始化")
 	}
 
@@ -181,8 +211,7 @@ func GetAllModels() ([]Model, error) {
 		return nil, err
 	}
 
-	cfg := config.GetConfig()
-	baseURL := cfg.ApiProxy.BaseURL
+	baseURL := config.GetApiBaseURL()
 
 	if modelsCount_ == 0 {
 		modelIds, _, err := fetchRemoteModels(baseURL)
@@ -194,7 +223,7 @@ func GetAllModels() ([]Model, error) {
 	}
 
 	// 查询所有未删除的模型
-	query := `SELECT id, is_free, is_giftable, strategy_id, type, call_count FROM models WHERE deleted_at IS NULL`
+	query := `SELECT id, is_free, is_giftable, strategy_id, type, call_count, default_max_tokens, max_output_tokens, context_window FROM models WHERE deleted_at IS NULL`
 	rows, err := modelDB.Query(query)
 	if err != nil {
 		return nil, err
@@ -204,7 +233,8 @@ func GetAllModels() ([]Model, error) {
 	var models []Model
 	for rows.Next() {
 		var model Model
-		if err := rows.Scan(&model.ID, &model.IsFree, &model.IsGiftable, &model.StrategyID, &model.Type, &model.CallCount); err != nil {
+		if err := rows.Scan(&model.ID, &model.IsFree, &model.IsGiftable, &model.StrategyID, &model.Type, &model.CallCount,
+			&model.DefaultMaxTokens, &model.MaxOutputTokens, &model.ContextWindow); err != nil {
 			return nil, err
 		}
 		models = append(models, model)
@@ -232,6 +262,9 @@ func fetchRemoteModels(baseURL string) ([]string, int, error) {
 
 	apikeys := config.GetActiveApiKeys()
 	utils.SetCommonHeaders(req, apikeys[0].Key)
+	if err := signing.ApplyProviderHeaders(req, apikeys[0].Key, nil); err != nil {
+		return nil, 0, err
+	}
 
 	// 发送请求
 	client := &http.Client{}
@@ -262,6 +295,10 @@ func fetchRemoteModels(baseURL string) ([]string, int, error) {
 		return nil, 0, nil
 	}
 
+	// 记录上游提供的最大输出令牌数和上下文长度
+	RecordRemoteTokenLimits(data)
+	RecordRemoteContextWindows(data)
+
 	// 提取模型ID
 	var modelIds []string
 	for _, item := range data {
@@ -290,6 +327,9 @@ func SaveModels(modelIds []string) (int, error) {
 	if modelDB == nil {
 		return 0, fmt.Errorf("数据库连接未初始化")
 	}
+	if err := config.CheckWritable(); err != nil {
+		return 0, err
+	}
 
 	// 开始事务
 	tx, err := modelDB.Begin()
@@ -350,18 +390,32 @@ func SaveModels(modelIds []string) (int, error) {
 		count++
 	}
 
+	// 写入上游提供的最大输出令牌数
+	if err = applyPendingTokenLimits(tx); err != nil {
+		return 0, err
+	}
+
+	// 写入上游提供的上下文长度
+	if err = applyPendingContextWindows(tx); err != nil {
+		return 0, err
+	}
+
 	// 提交事务
 	if err = tx.Commit(); err != nil {
 		return 0, err
 	}
+	invalidateModelContextCache()
 
 	return count, nil
 }
 
 // GetModelsCount 获取模型数量
 func GetModelsCount() (int, error) {
-	// 确保数据库连接已经初始化
+	// 确保数据库连接已经初始化，数据库不可用时使用内置模型列表
 	if modelDB == nil {
+		if models, ok := getBundledModels(); ok {
+			return len(models), nil
+		}
 		return 0, fmt.Errorf("数据库连接未初始化")
 	}
 
@@ -409,6 +463,9 @@ func UpdateModelStrategy(modelId string, strategyId int) error {
 	if modelDB == nil {
 		return fmt.Errorf("数据库连接未初始化")
 	}
+	if err := config.CheckWritable(); err != nil {
+		return err
+	}
 
 	// 更新模型策略
 	_, err := modelDB.Exec(
@@ -426,6 +483,10 @@ func UpdateModelStrategy(modelId string, strategyId int) error {
 // GetModelStrategy 获取模型策略
 func GetModelStrategy(modelId string) (int, error) {
 	if modelDB == nil {
+		if IsUsingBundledModels() {
+			m, _ := getBundledModel(modelId)
+			return m.StrategyID, nil // 内置列表中没有的模型返回默认策略0
+		}
 		return 0, fmt.Errorf("数据库连接未初始化")
 	}
 
@@ -449,6 +510,9 @@ func UpdateModelType(modelId string, modelType int) error {
 	if modelDB == nil {
 		return fmt.Errorf("数据库连接未初始化")
 	}
+	if err := config.CheckWritable(); err != nil {
+		return err
+	}
 
 	// 更新模型类型
 	_, err := modelDB.Exec(
@@ -466,6 +530,12 @@ func UpdateModelType(modelId string, modelType int) error {
 // GetModelType 获取模型类型
 func GetModelType(modelId string) (int, error) {
 	if modelDB == nil {
+		if IsUsingBundledModels() {
+			if m, ok := getBundledModel(modelId); ok {
+				return m.Type, nil
+			}
+			return 1, nil // 内置列表中没有的模型返回默认类型1（对话）
+		}
 		return 0, fmt.Errorf("数据库连接未初始化")
 	}
 
@@ -489,6 +559,9 @@ func BeginTransaction() (*sql.Tx, error) {
 	if modelDB == nil {
 		return nil, fmt.Errorf("数据库连接未初始化")
 	}
+	if err := config.CheckWritable(); err != nil {
+		return nil, err
+	}
 	return modelDB.Begin()
 }
 
@@ -497,6 +570,9 @@ func DeleteModelStrategy(modelId string) error {
 	if modelDB == nil {
 		return fmt.Errorf("数据库连接未初始化")
 	}
+	if err := config.CheckWritable(); err != nil {
+		return err
+	}
 
 	// 从数据库中删除模型策略记录
 	_, err := modelDB.Exec(
@@ -630,6 +706,9 @@ func ModelDBExecWithRetry(operation string, maxRetries int, stmt string, args ..
 	if modelDB == nil {
 		return nil, fmt.Errorf("数据库连接未初始化")
 	}
+	if err := config.CheckWritable(); err != nil {
+		return nil, err
+	}
 
 	var result sql.Result
 	var err error
@@ -664,6 +743,11 @@ func UpdateModelCallCount(modelId string) error {
 		return fmt.Errorf("数据库连接未初始化")
 	}
 
+	// 只读数据库模式下不记录调用次数
+	if config.IsReadOnlyDatabase() {
+		return nil
+	}
+
 	// 验证模型ID
 	if modelId == "" {
 		return fmt.Errorf("模型ID不能为空")
@@ -688,6 +772,10 @@ func UpdateModelCallCount(modelId string) error {
 // GetTopModels 获取调用次数最多的模型
 func GetTopModels(limit int) ([]Model, error) {
 	if modelDB == nil {
+		// 内置模型列表没有调用次数
+		if IsUsingBundledModels() {
+			return []Model{}, nil
+		}
 		return nil, fmt.Errorf("数据库连接未初始化")
 	}
 
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// 退出时主程序和托盘可能都会关闭数据库，第二次关闭不能返回错误或panic
+func TestCloseModelDBTwice(t *testing.T) {
+	if err := InitModelDB(filepath.Join(t.TempDir(), "config.db")); err != nil {
+		t.Fatalf("InitModelDB 失败: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := CloseModelDB(); err != nil {
+			t.Fatalf("第%d次CloseModelDB返回错误: %v", i+1, err)
+		}
+	}
+
+	// 重新打开后可以再次关闭，并发关闭也只关闭一次
+	if err := InitModelDB(filepath.Join(t.TempDir(), "config.db")); err != nil {
+		t.Fatalf("InitModelDB 失败: %v", err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- CloseModelDB()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("并发CloseModelDB返回错误: %v", err)
+		}
+	}
+}
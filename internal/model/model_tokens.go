@@ -0,0 +1,162 @@
+/**
+  @author: Hanhai
+  @desc: 模型输出令牌数限制，保存每个模型的默认和最大输出令牌数，同步模型列表时从上游返回的信息中获取初始值
+**/
+
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"sync"
+)
+
+var (
+	// 最近一次从上游获取的模型最大输出令牌数，保存模型列表时写入数据库
+	pendingTokenLimits     map[string]int
+	pendingTokenLimitsLock sync.Mutex
+)
+
+// ensureModelTokenColumns 为旧版本数据库添加输出令牌数限制字段
+func ensureModelTokenColumns() error {
+	columns := []struct {
+		name       string
+		definition string
+	}{
+		{"default_max_tokens", "INTEGER DEFAULT 0 NOT NULL"},
+		{"max_output_tokens", "INTEGER DEFAULT 0 NOT NULL"},
+	}
+
+	for _, column := range columns {
+		var columnExists int
+		err := modelDB.QueryRow("SELECT count(*) FROM pragma_table_info('models') WHERE name=?", column.name).Scan(&columnExists)
+		if err != nil {
+			logger.Error("检查%s字段存在失败: %v", column.name, err)
+			return err
+		}
+		if columnExists > 0 {
+			continue
+		}
+
+		if _, err := modelDB.Exec("ALTER TABLE models ADD COLUMN " + column.name + " " + column.definition); err != nil {
+			logger.Error("添加%s字段失败: %v", column.name, err)
+			return err
+		}
+		logger.Info("成功添加%s字段到models表", column.name)
+	}
+
+	return nil
+}
+
+// GetModelTokenLimits 获取模型的默认和最大输出令牌数，0表示未设置
+func GetModelTokenLimits(modelId string) (int, int, error) {
+	if modelDB == nil {
+		if IsUsingBundledModels() {
+			m, _ := getBundledModel(modelId)
+			return m.DefaultMaxTokens, m.MaxOutputTokens, nil
+		}
+		return 0, 0, fmt.Errorf("数据库连接未初始化")
+	}
+
+	var defaultMaxTokens, maxOutputTokens int
+	err := modelDB.QueryRow(
+		"SELECT default_max_tokens, max_output_tokens FROM models WHERE id = ? AND deleted_at IS NULL",
+		modelId).Scan(&defaultMaxTokens, &maxOutputTokens)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+
+	return defaultMaxTokens, maxOutputTokens, nil
+}
+
+// UpdateModelTokenLimits 更新模型的默认和最大输出令牌数，0表示不设置
+func UpdateModelTokenLimits(modelId string, defaultMaxTokens int, maxOutputTokens int) error {
+	if modelDB == nil {
+		return fmt.Errorf("数据库连接未初始化")
+	}
+	if defaultMaxTokens < 0 || maxOutputTokens < 0 {
+		return fmt.Errorf("输出令牌数不能为负数")
+	}
+	if maxOutputTokens > 0 && defaultMaxTokens > maxOutputTokens {
+		return fmt.Errorf("默认输出令牌数 %d 不能大于最大输出令牌数 %d", defaultMaxTokens, maxOutputTokens)
+	}
+
+	result, err := ModelDBExecWithRetry(
+		"更新模型输出令牌数",
+		3,
+		"UPDATE models SET default_max_tokens = ?, max_output_tokens = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL",
+		defaultMaxTokens, maxOutputTokens, modelId)
+	if err != nil {
+		logger.Error("更新模型输出令牌数失败: %v", err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("模型 %s 不存在", modelId)
+	}
+
+	logger.Info("已更新模型 %s 的输出令牌数: 默认=%d, 最大=%d", modelId, defaultMaxTokens, maxOutputTokens)
+	return nil
+}
+
+// RecordRemoteTokenLimits 从上游模型列表的条目中提取最大输出令牌数，保存模型列表时作为初始值写入
+// 返回提取到的数量
+func RecordRemoteTokenLimits(items []interface{}) int {
+	limits := make(map[string]int)
+	for _, item := range items {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, ok := entry["id"].(string)
+		if !ok {
+			continue
+		}
+		for _, field := range []string{"max_output_tokens", "max_completion_tokens", "max_tokens"} {
+			if limit := positiveInt(entry[field]); limit > 0 {
+				limits[id] = limit
+				break
+			}
+		}
+	}
+
+	pendingTokenLimitsLock.Lock()
+	pendingTokenLimits = limits
+	pendingTokenLimitsLock.Unlock()
+
+	return len(limits)
+}
+
+// applyPendingTokenLimits 将上游提供的最大输出令牌数写入尚未设置的模型，不覆盖手动设置的值
+func applyPendingTokenLimits(tx *sql.Tx) error {
+	pendingTokenLimitsLock.Lock()
+	limits := pendingTokenLimits
+	pendingTokenLimits = nil
+	pendingTokenLimitsLock.Unlock()
+
+	for id, limit := range limits {
+		if _, err := tx.Exec("UPDATE models SET max_output_tokens = ? WHERE id = ? AND max_output_tokens = 0", limit, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// positiveInt 将JSON中的数字转换为正整数，无法转换时返回0
+func positiveInt(v interface{}) int {
+	switch n := v.(type) {
+	case float64:
+		if n > 0 {
+			return int(n)
+		}
+	case json.Number:
+		if i, err := n.Int64(); err == nil && i > 0 {
+			return int(i)
+		}
+	}
+	return 0
+}
@@ -11,15 +11,19 @@ import (
 
 // Model 模型信息
 type Model struct {
-	ID         string     `json:"id"`          // 模型ID
-	IsFree     bool       `json:"is_free"`     // 是否免费
-	IsGiftable bool       `json:"is_giftable"` // 是否可用赠费
-	StrategyID int        `json:"strategy_id"` // 模型使用的策略ID
-	Type       int        `json:"type"`        // 模型类型：1-对话，2-生图，3-视频，4-语音，5-嵌入，6-重排序，7-推理
-	CallCount  int        `json:"call_count"`  // 调用次数
-	CreatedAt  time.Time  `json:"created_at"`  // 创建时间
-	UpdatedAt  time.Time  `json:"updated_at"`  // 更新时间
-	DeletedAt  *time.Time `json:"deleted_at"`  // 删除时间（软删除）
+	ID         string `json:"id"`          // 模型ID
+	IsFree     bool   `json:"is_free"`     // 是否免费
+	IsGiftable bool   `json:"is_giftable"` // 是否可用赠费
+	StrategyID int    `json:"strategy_id"` // 模型使用的策略ID
+	Type       int    `json:"type"`        // 模型类型：1-对话，2-生图，3-视频，4-语音，5-嵌入，6-重排序，7-推理
+	CallCount  int    `json:"call_count"`  // 调用次数
+	// 输出令牌数限制，需要在模型覆盖配置中启用后才生效
+	DefaultMaxTokens int        `json:"default_max_tokens"` // 请求未设置max_tokens时使用的默认值，0表示不设置
+	MaxOutputTokens  int        `json:"max_output_tokens"`  // 允许的最大max_tokens，0表示不限制
+	ContextWindow    int        `json:"context_window"`     // 上下文长度（令牌数），同步模型列表时从上游获取，0表示未知
+	CreatedAt        time.Time  `json:"created_at"`         // 创建时间
+	UpdatedAt        time.Time  `json:"updated_at"`         // 更新时间
+	DeletedAt        *time.Time `json:"deleted_at"`         // 删除时间（软删除）
 }
 
 // TableName 指定表名
@@ -0,0 +1,96 @@
+/**
+  @author: Hanhai
+  @desc: 桌面通知通道，调用系统自带的通知程序显示通知，同一事件在最小间隔内只显示一次，没有可用的通知程序时只记录日志
+**/
+
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+)
+
+const (
+	// 桌面通知的标题
+	desktopTitle = "流动硅基 FlowSilicon"
+	// 同一事件桌面通知的最小间隔
+	desktopNotifyInterval = time.Minute
+	// 调用通知程序的超时时间
+	desktopTimeout = 10 * time.Second
+)
+
+var (
+	// 每个事件上次显示桌面通知的时间
+	lastDesktopNotifyAt = make(map[string]time.Time)
+	desktopMutex        sync.Mutex
+	// 是否已记录过通知程序不可用，只记录一次警告
+	desktopUnavailableLogged bool
+)
+
+// desktopEnabled 检查是否发送桌面通知，auto模式下只在GUI模式下发送
+func desktopEnabled() bool {
+	switch config.GetDesktopNotificationMode() {
+	case config.DesktopNotificationOn:
+		return true
+	case config.DesktopNotificationOff:
+		return false
+	default:
+		return logger.IsGuiMode()
+	}
+}
+
+// sendDesktop 显示事件的桌面通知，未开启或未超过最小间隔时忽略
+func sendDesktop(event string, message string) {
+	if !desktopEnabled() {
+		return
+	}
+
+	desktopMutex.Lock()
+	now := time.Now()
+	if last, ok := lastDesktopNotifyAt[event]; ok && now.Sub(last) < desktopNotifyInterval {
+		desktopMutex.Unlock()
+		return
+	}
+	lastDesktopNotifyAt[event] = now
+	desktopMutex.Unlock()
+
+	go func() {
+		if err := showDesktop(message); err != nil {
+			logDesktopFailure(err)
+		}
+	}()
+}
+
+// SendDesktopTest 立即显示一条测试用的桌面通知，不受开启方式和最小间隔限制
+func SendDesktopTest() error {
+	err := showDesktop("这是一条测试通知，桌面通知工作正常")
+	if err != nil {
+		logDesktopFailure(err)
+	}
+	return err
+}
+
+// showDesktop 调用当前平台的通知程序显示通知
+func showDesktop(message string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), desktopTimeout)
+	defer cancel()
+	return showDesktopNotification(ctx, desktopTitle, message)
+}
+
+// logDesktopFailure 记录桌面通知失败，通知程序不可用时只警告一次，之后降为信息日志
+func logDesktopFailure(err error) {
+	desktopMutex.Lock()
+	logged := desktopUnavailableLogged
+	desktopUnavailableLogged = true
+	desktopMutex.Unlock()
+
+	if logged {
+		logger.Info("显示桌面通知失败: %v", err)
+		return
+	}
+	logger.Warn("显示桌面通知失败，之后的失败只记录信息日志: %v", err)
+}
@@ -0,0 +1,41 @@
+//go:build darwin
+// +build darwin
+
+/**
+  @author: Hanhai
+  @desc: macOS平台的桌面通知，优先使用terminal-notifier，未安装时使用osascript
+**/
+
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// showDesktopNotification 显示通知中心通知
+func showDesktopNotification(ctx context.Context, title string, message string) error {
+	var cmd *exec.Cmd
+	if notifier, err := exec.LookPath("terminal-notifier"); err == nil {
+		cmd = exec.CommandContext(ctx, notifier, "-title", title, "-message", message)
+	} else if osascript, err := exec.LookPath("osascript"); err == nil {
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+		cmd = exec.CommandContext(ctx, osascript, "-e", script)
+	} else {
+		return fmt.Errorf("未找到terminal-notifier或osascript")
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("显示通知失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// appleScriptString 将文本转换为AppleScript字符串字面量
+func appleScriptString(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	text = strings.ReplaceAll(text, `"`, `\"`)
+	return `"` + text + `"`
+}
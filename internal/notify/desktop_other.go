@@ -0,0 +1,31 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+/**
+  @author: Hanhai
+  @desc: Linux等平台的桌面通知，通过notify-send发送到桌面环境的通知服务
+**/
+
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// showDesktopNotification 通过notify-send显示通知
+func showDesktopNotification(ctx context.Context, title string, message string) error {
+	notifySend, err := exec.LookPath("notify-send")
+	if err != nil {
+		return fmt.Errorf("未找到notify-send: %w", err)
+	}
+
+	// 以--开始参数，避免以-开头的内容被当作选项
+	cmd := exec.CommandContext(ctx, notifySend, "--app-name=FlowSilicon", "--", title, message)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("显示通知失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build windows
+// +build windows
+
+/**
+  @author: Hanhai
+  @desc: Windows平台的桌面通知，通过PowerShell调用系统的Toast通知
+**/
+
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// toastScript 显示Toast通知的PowerShell脚本，标题和内容通过环境变量传入，避免转义问题
+const toastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$texts = $template.GetElementsByTagName('text')
+$texts.Item(0).AppendChild($template.CreateTextNode($env:FLOWSILICON_NOTIFY_TITLE)) > $null
+$texts.Item(1).AppendChild($template.CreateTextNode($env:FLOWSILICON_NOTIFY_MESSAGE)) > $null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('FlowSilicon').Show($toast)`
+
+// showDesktopNotification 显示Toast通知
+func showDesktopNotification(ctx context.Context, title string, message string) error {
+	powershell, err := exec.LookPath("powershell.exe")
+	if err != nil {
+		return fmt.Errorf("未找到PowerShell: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, powershell, "-NoProfile", "-NonInteractive", "-Command", toastScript)
+	cmd.Env = append(cmd.Environ(), "FLOWSILICON_NOTIFY_TITLE="+title, "FLOWSILICON_NOTIFY_MESSAGE="+message)
+	// 不显示PowerShell窗口
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("显示Toast通知失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
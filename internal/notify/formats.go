@@ -0,0 +1,119 @@
+/**
+  @author: Hanhai
+  @desc: 飞书和钉钉自定义机器人的消息格式，设置了签名密钥时按机器人的加签方式签名，签名在发送时计算，重试时重新签名
+**/
+
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"flowsilicon/internal/config"
+)
+
+// 未在事件格式说明中设置标题时使用的消息标题
+const defaultEventTitle = "流动硅基通知"
+
+// formatPayload 按webhook的消息格式生成请求体，generic格式使用envelope
+func formatPayload(format string, event string, message string, data map[string]interface{}, envelope []byte) ([]byte, error) {
+	switch format {
+	case config.WebhookFormatFeishu:
+		return json.Marshal(map[string]interface{}{
+			"msg_type": "interactive",
+			"card": map[string]interface{}{
+				"header": map[string]interface{}{
+					"title":    map[string]string{"tag": "plain_text", "content": eventTitle(event)},
+					"template": "orange",
+				},
+				"elements": []interface{}{
+					map[string]interface{}{
+						"tag":  "div",
+						"text": map[string]string{"tag": "lark_md", "content": markdownBody(event, message, data)},
+					},
+				},
+			},
+		})
+	case config.WebhookFormatDingTalk:
+		title := eventTitle(event)
+		return json.Marshal(map[string]interface{}{
+			"msgtype": "markdown",
+			"markdown": map[string]string{
+				"title": title,
+				"text":  "### " + title + "\n\n" + markdownBody(event, message, data),
+			},
+		})
+	}
+	return envelope, nil
+}
+
+// markdownBody 生成卡片消息的正文，事件数据按字段名排序
+func markdownBody(event string, message string, data map[string]interface{}) string {
+	var b strings.Builder
+	b.WriteString(message)
+	b.WriteString("\n\n")
+
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "- **%s**: %v\n", name, data[name])
+	}
+	fmt.Fprintf(&b, "\n事件: %s  实例: %s", event, config.GetInstanceID())
+	return b.String()
+}
+
+// eventTitle 获取事件的消息标题
+func eventTitle(event string) string {
+	for _, schema := range eventSchemas {
+		if schema.Type == event && schema.Title != "" {
+			return schema.Title
+		}
+	}
+	return defaultEventTitle
+}
+
+// signFeishu 按飞书机器人的加签方式在请求体中加入timestamp和sign字段
+func signFeishu(secret string, now time.Time, payload string) (string, error) {
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &body); err != nil {
+		return "", fmt.Errorf("解析通知内容失败: %w", err)
+	}
+	ts := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(ts+"\n"+secret))
+	body["timestamp"] = ts
+	body["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// signDingTalk 按钉钉机器人的加签方式在webhook地址中加入timestamp和sign参数
+func signDingTalk(secret string, now time.Time, webhook string) (string, error) {
+	parsed, err := url.Parse(webhook)
+	if err != nil {
+		return "", fmt.Errorf("解析webhook地址失败: %w", err)
+	}
+	ts := strconv.FormatInt(now.UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "\n" + secret))
+
+	query := parsed.Query()
+	query.Set("timestamp", ts)
+	query.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
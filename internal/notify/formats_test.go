@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 签名时间为2023-11-14 22:13:20 UTC，期望签名按飞书和钉钉文档中的算法单独计算
+var signTime = time.Unix(1700000000, 0)
+
+// 飞书在请求体中加入秒级timestamp和sign字段，签名密钥为 "<timestamp>\n<secret>"，签名内容为空，原有字段保持不变
+func TestSignFeishu(t *testing.T) {
+	payload := `{"msg_type":"interactive","card":{"header":{"title":{"content":"通知"}}}}`
+	signed, err := signFeishu("feishu-secret", signTime, payload)
+	if err != nil {
+		t.Fatalf("signFeishu 失败: %v", err)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(signed), &body); err != nil {
+		t.Fatalf("signed payload is not JSON: %v", err)
+	}
+	if body["timestamp"] != "1700000000" {
+		t.Errorf("timestamp = %v, want the Unix seconds as a string", body["timestamp"])
+	}
+	if want := "OrBzY1Y01Gq+HgJsl+7OfWcMVwc7YocohQm5iiZwjhU="; body["sign"] != want {
+		t.Errorf("sign = %v, want %s", body["sign"], want)
+	}
+	if body["msg_type"] != "interactive" || body["card"] == nil {
+		t.Errorf("signed payload = %s, want the original fields kept", signed)
+	}
+
+	if _, err := signFeishu("feishu-secret", signTime, "not json"); err == nil {
+		t.Errorf("signFeishu(not json) returned no error")
+	}
+}
+
+// 钉钉在webhook地址中加入毫秒级timestamp和sign参数，签名内容为 "<timestamp>\n<secret>"，原有参数保持不变
+func TestSignDingTalk(t *testing.T) {
+	target, err := signDingTalk("dingtalk-secret", signTime, "https://oapi.dingtalk.com/robot/send?access_token=token-1")
+	if err != nil {
+		t.Fatalf("signDingTalk 失败: %v", err)
+	}
+
+	parsed, err := url.Parse(target)
+	if err != nil {
+		t.Fatalf("signed webhook %q is not a URL: %v", target, err)
+	}
+	if parsed.Host != "oapi.dingtalk.com" || parsed.Path != "/robot/send" {
+		t.Errorf("signed webhook = %s, want the original address", target)
+	}
+	query := parsed.Query()
+	if got := query.Get("access_token"); got != "token-1" {
+		t.Errorf("access_token = %q, want token-1", got)
+	}
+	if got := query.Get("timestamp"); got != "1700000000000" {
+		t.Errorf("timestamp = %q, want the Unix milliseconds", got)
+	}
+	if want := "aZWZ1LWtrkaSNZD9QlCG8Mkr0hz60n0eLGQfc+tq7xo="; query.Get("sign") != want {
+		t.Errorf("sign = %q, want %s", query.Get("sign"), want)
+	}
+	// base64中的+必须编码，否则钉钉会解析为空格
+	if strings.Contains(parsed.RawQuery, "+") {
+		t.Errorf("query %q contains an unescaped +", parsed.RawQuery)
+	}
+
+	if _, err := signDingTalk("dingtalk-secret", signTime, "://missing-scheme"); err == nil {
+		t.Errorf("signDingTalk(invalid URL) returned no error")
+	}
+}
@@ -0,0 +1,320 @@
+/**
+  @author: Hanhai
+  @desc: 通知发送，通知先写入配置数据库中的发送队列，再由后台协程发送到配置的webhook，发送失败时按退避时间重试，同时显示桌面通知
+         webhook通知使用带版本的事件信封，设置了密钥的webhook在请求头中附带签名，飞书和钉钉机器人使用各自的消息格式和加签方式
+**/
+
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/client"
+	"flowsilicon/pkg/utils"
+)
+
+const (
+	// 后台协程检查待发送通知的间隔
+	pollInterval = 5 * time.Second
+	// 单次发送的超时时间
+	deliveryTimeout = 10 * time.Second
+	// 重试的起始间隔和最大间隔
+	minRetryDelay = 5 * time.Second
+	maxRetryDelay = 10 * time.Minute
+)
+
+// 通知事件类型
+const (
+	EventKeysExhausted   = "keys_exhausted"   // 没有可用的API密钥
+	EventClientThrottled = "client_throttled" // 客户端错误率过高被临时限流
+	EventKeyLowBalance   = "key_low_balance"  // 密钥余额低于通知阈值
+	EventKeyDisabled     = "key_disabled"     // 密钥连续失败后被自动禁用
+	EventPoolLowBalance  = "pool_low_balance" // 所有启用密钥的余额之和低于通知阈值
+)
+
+// TestResult 测试通知发送到一个webhook的结果
+type TestResult struct {
+	Webhook string `json:"webhook"`
+	Format  string `json:"format"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Payload 旧版本发送到webhook的通知内容，开启legacy_payload时使用
+type Payload struct {
+	Event     string                 `json:"event"`
+	Message   string                 `json:"message"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+	// text字段兼容Slack等只读取text的webhook
+	Text string `json:"text"`
+}
+
+var (
+	// 唤醒后台协程立即发送
+	wakeChan  = make(chan struct{}, 1)
+	startOnce sync.Once
+)
+
+// StartNotifier 启动后台发送协程，发送上次运行时未完成的通知和新加入队列的通知
+func StartNotifier() {
+	startOnce.Do(func() {
+		go run()
+		logger.Info("通知发送协程已启动")
+	})
+}
+
+// Send 将通知加入所有webhook通道的发送队列并显示桌面通知，事件在disabled_events中时不发送
+func Send(event string, message string, data map[string]interface{}) {
+	if !config.IsNotificationEventEnabled(event) {
+		return
+	}
+	sendDesktop(event, message)
+
+	webhooks := config.GetNotificationWebhooks()
+	if len(webhooks) == 0 {
+		return
+	}
+
+	envelope, err := buildPayload(event, message, data)
+	if err != nil {
+		logger.Error("序列化通知失败: %v", err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		payload, err := formatPayload(config.GetWebhookFormat(webhook), event, message, data, envelope)
+		if err != nil {
+			logger.Error("序列化通知失败: %v", err)
+			continue
+		}
+		if _, err := config.EnqueueNotification(webhook, event, string(payload)); err != nil {
+			// 无法写入队列时直接发送一次，失败后不再重试
+			logger.Error("通知加入发送队列失败，直接发送: %v", err)
+			go func(webhook string, payload string) {
+				if err := deliver(webhook, event, payload); err != nil {
+					logger.Error("发送通知 %s 失败: %v", event, err)
+				}
+			}(webhook, string(payload))
+		}
+	}
+	wake()
+}
+
+// buildPayload 生成发送到webhook的通知内容，开启legacy_payload时使用旧版本的格式
+func buildPayload(event string, message string, data map[string]interface{}) ([]byte, error) {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Notification.LegacyPayload {
+		return json.Marshal(Payload{
+			Event:     event,
+			Message:   message,
+			Data:      data,
+			Timestamp: time.Now().Unix(),
+			Text:      fmt.Sprintf("[FlowSilicon] %s", message),
+		})
+	}
+
+	envelope, err := newEnvelope(event, message, data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope)
+}
+
+// SendTest 将事件的示例通知直接发送到所有webhook并返回每个webhook的结果，不经过发送队列，不检查disabled_events
+func SendTest(event string) ([]TestResult, error) {
+	var schema *EventSchema
+	for i := range eventSchemas {
+		if eventSchemas[i].Type == event {
+			schema = &eventSchemas[i]
+			break
+		}
+	}
+	if schema == nil {
+		return nil, fmt.Errorf("未知的事件类型: %s", event)
+	}
+
+	message := "[测试] " + schema.sampleMessage
+	envelope, err := buildPayload(event, message, schema.sampleData)
+	if err != nil {
+		return nil, fmt.Errorf("序列化通知失败: %w", err)
+	}
+
+	webhooks := config.GetNotificationWebhooks()
+	results := make([]TestResult, len(webhooks))
+	var wg sync.WaitGroup
+	for i, webhook := range webhooks {
+		format := config.GetWebhookFormat(webhook)
+		results[i] = TestResult{Webhook: webhook, Format: format}
+		payload, err := formatPayload(format, event, message, schema.sampleData, envelope)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func(result *TestResult, payload string) {
+			defer wg.Done()
+			if err := deliver(result.Webhook, event, payload); err != nil {
+				result.Error = err.Error()
+				return
+			}
+			result.Success = true
+		}(&results[i], string(payload))
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// RetryNow 立即重试发送队列中的一条通知
+func RetryNow(id int64) error {
+	if err := config.RetryNotificationNow(id); err != nil {
+		return err
+	}
+	wake()
+	return nil
+}
+
+// wake 唤醒后台协程，协程正在处理时忽略
+func wake() {
+	select {
+	case wakeChan <- struct{}{}:
+	default:
+	}
+}
+
+// run 后台发送协程
+func run() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		processOutbox()
+		select {
+		case <-ticker.C:
+		case <-wakeChan:
+		}
+	}
+}
+
+// processOutbox 标记过期的通知，并发送每个通道中到达重试时间的第一条通知
+// 发送成功后继续处理同一通道的下一条，直到没有可发送的通知
+func processOutbox() {
+	for {
+		now := time.Now()
+		if expired, err := config.ExpireNotifications(now); err != nil {
+			logger.Error("标记过期通知失败: %v", err)
+		} else if expired > 0 {
+			logger.Warn("%d 条通知超过保留时间仍未发送成功，已停止重试", expired)
+		}
+
+		entries, err := config.GetDueNotifications(now)
+		if err != nil {
+			logger.Error("获取待发送通知失败: %v", err)
+			return
+		}
+		if len(entries) == 0 {
+			return
+		}
+
+		delivered := false
+		for _, entry := range entries {
+			attempts := entry.Attempts + 1
+			if err := deliver(entry.Channel, entry.Event, entry.Payload); err != nil {
+				nextAttempt := now.Add(retryDelay(attempts))
+				logger.Warn("发送通知 %s 失败（第 %d 次），%s 后重试: %v", entry.Event, attempts, nextAttempt.Format("15:04:05"), err)
+				if err := config.MarkNotificationFailed(entry.ID, attempts, err.Error(), nextAttempt); err != nil {
+					logger.Error("更新通知状态失败: %v", err)
+				}
+				continue
+			}
+
+			if err := config.MarkNotificationDelivered(entry.ID, attempts); err != nil {
+				logger.Error("更新通知状态失败: %v", err)
+				continue
+			}
+			delivered = true
+		}
+
+		if !delivered {
+			return
+		}
+	}
+}
+
+// retryDelay 按发送次数计算下次重试的间隔，每次失败后间隔加倍
+func retryDelay(attempts int) time.Duration {
+	delay := minRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// deliver 将通知内容POST到webhook，2xx状态码视为发送成功
+// 请求头中附带事件类型和事件信封的发送ID，设置了密钥时按发送时间签名，重试时重新签名
+func deliver(webhook string, event string, payload string) error {
+	target := webhook
+	signature := ""
+	if secret := config.GetWebhookSecret(webhook); secret != "" {
+		now := time.Now()
+		var err error
+		switch config.GetWebhookFormat(webhook) {
+		case config.WebhookFormatFeishu:
+			payload, err = signFeishu(secret, now, payload)
+		case config.WebhookFormatDingTalk:
+			target, err = signDingTalk(secret, now, webhook)
+		default:
+			signature = client.SignWebhook(secret, now, []byte(payload))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewBufferString(payload))
+	if err != nil {
+		return fmt.Errorf("创建通知请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(client.HeaderWebhookEvent, event)
+	if id := deliveryID(payload); id != "" {
+		req.Header.Set(client.HeaderWebhookDelivery, id)
+	}
+	if signature != "" {
+		req.Header.Set(client.HeaderWebhookSignature, signature)
+	}
+
+	resp, err := utils.CreateClientWithTimeout(deliveryTimeout).Do(req)
+	if err != nil {
+		return fmt.Errorf("发送通知请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook返回状态码 %d: %s", resp.StatusCode, string(body))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// deliveryID 获取事件信封中的发送ID，旧版本格式的通知没有发送ID
+func deliveryID(payload string) string {
+	var envelope struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(payload), &envelope); err != nil {
+		return ""
+	}
+	return envelope.ID
+}
@@ -0,0 +1,157 @@
+/**
+  @author: Hanhai
+  @desc: webhook通知的事件信封和各事件的格式说明，格式说明和示例事件供接收程序测试使用
+**/
+
+package notify
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/pkg/client"
+)
+
+// EventSchema 一种事件的格式说明
+type EventSchema struct {
+	Type        string            `json:"type"`
+	Title       string            `json:"title"` // 飞书和钉钉消息的标题
+	Description string            `json:"description"`
+	Fields      map[string]string `json:"fields"` // payload.data中的字段和说明
+	// 示例事件的payload
+	sampleMessage string
+	sampleData    map[string]interface{}
+}
+
+// 所有事件的格式说明，新增事件时在这里添加
+var eventSchemas = []EventSchema{
+	{
+		Type:        EventKeysExhausted,
+		Title:       "没有可用的API密钥",
+		Description: "没有可用的API密钥，请求无法转发，同一事件10分钟内最多发送一次",
+		Fields: map[string]string{
+			"model": "请求的模型，未知时为空字符串",
+		},
+		sampleData:    map[string]interface{}{"model": "deepseek-ai/DeepSeek-V3"},
+		sampleMessage: "请求模型 deepseek-ai/DeepSeek-V3 时没有可用的API密钥，请求无法转发",
+	},
+	{
+		Type:        EventClientThrottled,
+		Title:       "客户端被临时限流",
+		Description: "客户端最近24小时的错误率过高，被临时限流",
+		Fields: map[string]string{
+			"client":          "客户端标识",
+			"error_rate":      "最近24小时的错误率（0-1）",
+			"errors":          "最近24小时的错误请求数",
+			"requests":        "最近24小时的请求数",
+			"rpm":             "限流后每分钟允许的请求数",
+			"throttled_until": "限流结束的时间（Unix秒）",
+		},
+		sampleData: map[string]interface{}{
+			"client":          "token:sk-a...b1c2",
+			"error_rate":      0.62,
+			"errors":          310,
+			"requests":        500,
+			"rpm":             5,
+			"throttled_until": 1700000000,
+		},
+		sampleMessage: "客户端 token:sk-a...b1c2 最近24小时的错误率为 62.0%（310/500），已限流为每分钟 5 次请求",
+	},
+	{
+		Type:        EventKeyLowBalance,
+		Title:       "API密钥余额不足",
+		Description: "密钥余额低于balance_threshold，余额降到阈值以下时发送，之后同一个密钥在冷却时间内最多发送一次",
+		Fields: map[string]string{
+			"key":       "脱敏后的密钥",
+			"alias":     "密钥别名，未设置时为空字符串",
+			"balance":   "密钥的余额",
+			"threshold": "通知阈值",
+		},
+		sampleData: map[string]interface{}{
+			"key":       "sk-a...b1c2",
+			"alias":     "主账号",
+			"balance":   0.85,
+			"threshold": 1.0,
+		},
+		sampleMessage: "API密钥 sk-a...b1c2（主账号）的余额为 0.85，低于通知阈值 1.00",
+	},
+	{
+		Type:        EventKeyDisabled,
+		Title:       "API密钥已被自动禁用",
+		Description: "密钥连续失败的次数达到max_consecutive_failures后被自动禁用，同一个密钥在冷却时间内最多发送一次",
+		Fields: map[string]string{
+			"key":                  "脱敏后的密钥",
+			"alias":                "密钥别名，未设置时为空字符串",
+			"consecutive_failures": "连续失败的次数",
+			"balance":              "密钥的余额",
+		},
+		sampleData: map[string]interface{}{
+			"key":                  "sk-a...b1c2",
+			"alias":                "主账号",
+			"consecutive_failures": 5,
+			"balance":              12.3,
+		},
+		sampleMessage: "API密钥 sk-a...b1c2（主账号）连续失败 5 次，已被自动禁用",
+	},
+	{
+		Type:        EventPoolLowBalance,
+		Title:       "密钥池余额不足",
+		Description: "所有启用的密钥余额之和低于pool_balance_floor，降到阈值以下时发送，之后在冷却时间内最多发送一次",
+		Fields: map[string]string{
+			"total_balance": "所有启用的密钥余额之和，不含未跟踪余额的密钥",
+			"floor":         "通知阈值",
+			"active_keys":   "启用的密钥数量",
+		},
+		sampleData: map[string]interface{}{
+			"total_balance": 8.5,
+			"floor":         20.0,
+			"active_keys":   3,
+		},
+		sampleMessage: "3 个启用的API密钥余额合计 8.50，低于通知阈值 20.00",
+	},
+}
+
+// GetEventSchemas 获取所有事件的格式说明
+func GetEventSchemas() []EventSchema {
+	return eventSchemas
+}
+
+// SampleEvent 生成事件的示例信封，时间戳为当前时间，事件不存在时返回false
+func SampleEvent(event string) (client.WebhookEnvelope, bool) {
+	for _, schema := range eventSchemas {
+		if schema.Type == event {
+			envelope, err := newEnvelope(event, schema.sampleMessage, schema.sampleData)
+			return envelope, err == nil
+		}
+	}
+	return client.WebhookEnvelope{}, false
+}
+
+// newEnvelope 创建事件信封，每个信封有新的发送ID，重试时使用队列中保存的同一个信封
+func newEnvelope(event string, message string, data map[string]interface{}) (client.WebhookEnvelope, error) {
+	id, err := newDeliveryID()
+	if err != nil {
+		return client.WebhookEnvelope{}, err
+	}
+	return client.WebhookEnvelope{
+		ID:            id,
+		Type:          event,
+		SchemaVersion: client.WebhookSchemaVersion,
+		Timestamp:     time.Now().Unix(),
+		InstanceID:    config.GetInstanceID(),
+		Payload:       client.EventPayload{Message: message, Data: data},
+		Text:          fmt.Sprintf("[FlowSilicon] %s", message),
+	}, nil
+}
+
+// newDeliveryID 生成随机的发送ID
+func newDeliveryID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成发送ID失败: %w", err)
+	}
+	return "evt_" + hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,322 @@
+/**
+  @author: Hanhai
+  @desc: 上游并发限制，关闭自适应时使用固定上限；开启时按上游首字节延迟的P95用AIMD算法调整上限，延迟正常且上限不够用时逐步增加，延迟超过阈值时按比例降低
+**/
+
+package proxy
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 未设置时自适应并发上限的最小值和最大值
+	defaultAdaptiveMinLimit = 4
+	defaultAdaptiveMaxLimit = 256
+	// 开启自适应时的初始上限
+	defaultAdaptiveInitialLimit = 32
+	// 未设置时首字节延迟P95的阈值（毫秒）
+	defaultAdaptiveLatencyThresholdMs = 3000
+	// 每收集多少个延迟样本调整一次上限
+	adaptiveWindowSize = 20
+	// 延迟超过阈值时上限乘以该系数
+	adaptiveDecreaseFactor = 0.9
+	// 延迟低于阈值的该比例时才增加上限，两者之间保持不变，避免上限在阈值附近来回振荡
+	adaptiveHealthyRatio = 0.8
+	// 保留的最近调整记录数量
+	maxConcurrencyAdjustments = 20
+	// 达到并发上限时请求最多排队等待的时间
+	concurrencyQueueTimeout = 10 * time.Second
+)
+
+// ConcurrencyAdjustment 一次并发上限调整
+type ConcurrencyAdjustment struct {
+	Time   int64   `json:"time"`
+	From   int     `json:"from"`
+	To     int     `json:"to"`
+	P95Ms  float64 `json:"p95_ms"`
+	Reason string  `json:"reason"` // increase或decrease
+}
+
+// ConcurrencyStatus 上游并发限制的当前状态
+type ConcurrencyStatus struct {
+	Adaptive           bool                    `json:"adaptive"`
+	Limit              int                     `json:"limit"` // 当前上限，0表示不限制
+	InFlight           int                     `json:"in_flight"`
+	Queued             int                     `json:"queued"`
+	Rejected           int64                   `json:"rejected"` // 排队超时被拒绝的请求数
+	LatencyThresholdMs int                     `json:"latency_threshold_ms,omitempty"`
+	LastP95Ms          float64                 `json:"last_p95_ms,omitempty"`
+	Adjustments        []ConcurrencyAdjustment `json:"adjustments"`
+}
+
+// adaptiveLimiter 上游并发限制器
+type adaptiveLimiter struct {
+	mu          sync.Mutex
+	limit       float64   // 自适应上限，增加时按小数累积
+	inFlight    int       // 正在处理的请求数
+	queued      int       // 正在排队的请求数
+	rejected    int64     // 排队超时被拒绝的请求数
+	saturated   bool      // 本周期内是否有请求因达到上限而排队
+	samples     []float64 // 本周期的首字节延迟（毫秒）
+	lastP95     float64   // 上一次调整时的P95
+	adjustments []ConcurrencyAdjustment
+	changed     chan struct{} // 释放名额或上限变化时关闭，唤醒排队的请求
+}
+
+var upstreamLimiter = &adaptiveLimiter{
+	limit:   defaultAdaptiveInitialLimit,
+	changed: make(chan struct{}),
+}
+
+// adaptiveSettings 自适应并发的配置
+type adaptiveSettings struct {
+	enabled     bool
+	staticLimit int // 关闭自适应时的固定上限，0表示不限制
+	minLimit    int
+	maxLimit    int
+	thresholdMs int
+}
+
+// getAdaptiveSettings 读取当前配置中的并发限制设置，未设置的项使用默认值
+func getAdaptiveSettings() adaptiveSettings {
+	settings := adaptiveSettings{
+		minLimit:    defaultAdaptiveMinLimit,
+		maxLimit:    defaultAdaptiveMaxLimit,
+		thresholdMs: defaultAdaptiveLatencyThresholdMs,
+	}
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return settings
+	}
+	settings.enabled = cfg.App.AdaptiveConcurrency
+	settings.staticLimit = cfg.App.MaxConcurrentRequests
+	if cfg.App.AdaptiveConcurrencyMin > 0 {
+		settings.minLimit = cfg.App.AdaptiveConcurrencyMin
+	}
+	if cfg.App.AdaptiveConcurrencyMax > 0 {
+		settings.maxLimit = cfg.App.AdaptiveConcurrencyMax
+	} else if cfg.App.MaxConcurrentRequests > 0 {
+		// 未设置最大值时不超过固定上限
+		settings.maxLimit = cfg.App.MaxConcurrentRequests
+	}
+	if settings.maxLimit < settings.minLimit {
+		settings.maxLimit = settings.minLimit
+	}
+	if cfg.App.AdaptiveLatencyThresholdMs > 0 {
+		settings.thresholdMs = cfg.App.AdaptiveLatencyThresholdMs
+	}
+	return settings
+}
+
+// currentLimitLocked 获取当前生效的上限，0表示不限制（已加锁）
+func (l *adaptiveLimiter) currentLimitLocked(settings adaptiveSettings) int {
+	if !settings.enabled {
+		return settings.staticLimit
+	}
+	limit := int(l.limit)
+	if limit < settings.minLimit {
+		limit = settings.minLimit
+	}
+	if limit > settings.maxLimit {
+		limit = settings.maxLimit
+	}
+	return limit
+}
+
+// notifyLocked 唤醒所有排队的请求重新检查名额（已加锁）
+func (l *adaptiveLimiter) notifyLocked() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// acquire 获取一个上游请求名额，达到上限时排队等待，ctx结束或等待超时返回false
+func (l *adaptiveLimiter) acquire(ctx context.Context) bool {
+	timer := time.NewTimer(concurrencyQueueTimeout)
+	defer timer.Stop()
+
+	l.mu.Lock()
+	queued := false
+	for {
+		limit := l.currentLimitLocked(getAdaptiveSettings())
+		if limit <= 0 || l.inFlight < limit {
+			l.inFlight++
+			if queued {
+				l.queued--
+			}
+			l.mu.Unlock()
+			return true
+		}
+		if !queued {
+			queued = true
+			l.queued++
+		}
+		l.saturated = true
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+			l.mu.Lock()
+		case <-timer.C:
+			l.mu.Lock()
+			l.queued--
+			l.rejected++
+			l.mu.Unlock()
+			return false
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.queued--
+			l.mu.Unlock()
+			return false
+		}
+	}
+}
+
+// release 释放一个上游请求名额
+func (l *adaptiveLimiter) release() {
+	l.mu.Lock()
+	if l.inFlight > 0 {
+		l.inFlight--
+	}
+	l.notifyLocked()
+	l.mu.Unlock()
+}
+
+// observe 记录一次上游首字节延迟，收集满一个周期后调整自适应上限
+func (l *adaptiveLimiter) observe(latency time.Duration) {
+	settings := getAdaptiveSettings()
+	if !settings.enabled {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.samples = append(l.samples, float64(latency.Milliseconds()))
+	if len(l.samples) < adaptiveWindowSize {
+		return
+	}
+
+	p95 := percentile(l.samples, 0.95)
+	l.samples = l.samples[:0]
+	l.lastP95 = p95
+	saturated := l.saturated
+	l.saturated = false
+
+	from := l.currentLimitLocked(settings)
+	threshold := float64(settings.thresholdMs)
+	reason := ""
+	switch {
+	case p95 > threshold:
+		// 乘性降低
+		l.limit = math.Max(float64(settings.minLimit), float64(from)*adaptiveDecreaseFactor)
+		reason = "decrease"
+	case p95 < threshold*adaptiveHealthyRatio && saturated:
+		// 加性增加，只有上限不够用时才增加，空闲时上限不会无限增长
+		l.limit = math.Min(float64(settings.maxLimit), math.Max(l.limit, float64(from))+1)
+		reason = "increase"
+	default:
+		return
+	}
+
+	to := l.currentLimitLocked(settings)
+	if to == from {
+		return
+	}
+	l.adjustments = append(l.adjustments, ConcurrencyAdjustment{
+		Time:   time.Now().Unix(),
+		From:   from,
+		To:     to,
+		P95Ms:  p95,
+		Reason: reason,
+	})
+	if len(l.adjustments) > maxConcurrencyAdjustments {
+		l.adjustments = l.adjustments[len(l.adjustments)-maxConcurrencyAdjustments:]
+	}
+	if reason == "decrease" {
+		logger.Warn("上游首字节延迟P95为%.0fms，超过阈值%dms，并发上限从%d降低到%d", p95, settings.thresholdMs, from, to)
+	} else {
+		logger.Info("上游首字节延迟P95为%.0fms，并发上限从%d增加到%d", p95, from, to)
+		l.notifyLocked()
+	}
+}
+
+// status 获取限制器的当前状态
+func (l *adaptiveLimiter) status() ConcurrencyStatus {
+	settings := getAdaptiveSettings()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status := ConcurrencyStatus{
+		Adaptive:    settings.enabled,
+		Limit:       l.currentLimitLocked(settings),
+		InFlight:    l.inFlight,
+		Queued:      l.queued,
+		Rejected:    l.rejected,
+		Adjustments: append([]ConcurrencyAdjustment{}, l.adjustments...),
+	}
+	if settings.enabled {
+		status.LatencyThresholdMs = settings.thresholdMs
+		status.LastP95Ms = l.lastP95
+	}
+	return status
+}
+
+// percentile 计算样本的百分位数，会对样本排序
+func percentile(samples []float64, p float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sort.Float64s(samples)
+	index := int(math.Ceil(p*float64(len(samples)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return samples[index]
+}
+
+// GetConcurrencyStatus 获取上游并发限制的当前状态
+func GetConcurrencyStatus() ConcurrencyStatus {
+	return upstreamLimiter.status()
+}
+
+// acquireUpstreamSlot 获取上游请求名额，排队超时时返回503并返回false，获取成功时调用方处理完请求后必须调用releaseUpstreamSlot
+func acquireUpstreamSlot(c *gin.Context) bool {
+	if upstreamLimiter.acquire(c.Request.Context()) {
+		return true
+	}
+	c.Header("Retry-After", strconv.Itoa(int(concurrencyQueueTimeout.Seconds())))
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": map[string]interface{}{
+			"message": "上游并发请求数已达到上限，请稍后重试",
+			"type":    "server_overloaded",
+			"code":    http.StatusServiceUnavailable,
+		},
+	})
+	return false
+}
+
+// releaseUpstreamSlot 释放上游请求名额
+func releaseUpstreamSlot() {
+	upstreamLimiter.release()
+}
+
+// recordUpstreamLatency 记录密钥的上游首字节延迟，同时用于调整自适应并发上限
+func recordUpstreamLatency(apiKey string, latency time.Duration) {
+	key.RecordKeyLatency(apiKey, latency)
+	upstreamLimiter.observe(latency)
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"flowsilicon/internal/config"
+)
+
+// newTestLimiter 创建独立的限制器并发布并发限制配置
+func newTestLimiter(t *testing.T, limit float64, configure func(cfg *config.Config)) *adaptiveLimiter {
+	t.Helper()
+	cfg := &config.Config{}
+	configure(cfg)
+	config.UpdateConfig(cfg)
+	t.Cleanup(func() { config.UpdateConfig(&config.Config{}) })
+	return &adaptiveLimiter{limit: limit, changed: make(chan struct{})}
+}
+
+// fakeUpstreamLatency 模拟上游的首字节延迟：并发不超过capacity时为1秒，超过后每多一个请求增加150毫秒
+func fakeUpstreamLatency(inFlight, capacity int) time.Duration {
+	latency := time.Second
+	if inFlight > capacity {
+		latency += time.Duration(inFlight-capacity) * 150 * time.Millisecond
+	}
+	return latency
+}
+
+// 模拟请求数始终超过上限的情况：上游延迟随并发增加而变高，中途上游降级后可承受的并发减半
+// 上限应收敛到延迟阈值附近并保持不变，而不是来回振荡
+func TestAdaptiveLimitConverges(t *testing.T) {
+	limiter := newTestLimiter(t, 200, func(cfg *config.Config) {
+		cfg.App.AdaptiveConcurrency = true
+		cfg.App.AdaptiveConcurrencyMax = 256
+		cfg.App.AdaptiveLatencyThresholdMs = 3000
+	})
+
+	const demand = 500
+	phases := []struct {
+		name      string
+		capacity  int
+		rounds    int
+		wantLimit [2]int // 收敛后上限的范围
+	}{
+		{"上游正常", 20, 150, [2]int{30, 33}},
+		{"上游降级", 10, 150, [2]int{20, 23}},
+	}
+
+	for _, phase := range phases {
+		var history []int
+		for round := 0; round < phase.rounds; round++ {
+			status := limiter.status()
+			inFlight := status.Limit
+			if inFlight > demand {
+				inFlight = demand
+			}
+			// 请求数超过上限，每个周期都有请求排队
+			limiter.mu.Lock()
+			limiter.saturated = true
+			limiter.mu.Unlock()
+			for i := 0; i < adaptiveWindowSize; i++ {
+				limiter.observe(fakeUpstreamLatency(inFlight, phase.capacity))
+			}
+			history = append(history, limiter.status().Limit)
+		}
+
+		// 后一半周期内上限不再变化
+		settled := history[len(history)/2:]
+		for _, limit := range settled {
+			if limit != settled[0] {
+				t.Fatalf("%s: limit did not settle, history %v", phase.name, history)
+			}
+		}
+		if settled[0] < phase.wantLimit[0] || settled[0] > phase.wantLimit[1] {
+			t.Errorf("%s: settled limit = %d, want %d-%d (history %v)", phase.name, settled[0], phase.wantLimit[0], phase.wantLimit[1], history)
+		}
+		p95 := limiter.status().LastP95Ms
+		if p95 > 3000 || p95 < 3000*adaptiveHealthyRatio {
+			t.Errorf("%s: P95 = %.0fms, want inside the %.0f-3000ms band", phase.name, p95, 3000*adaptiveHealthyRatio)
+		}
+	}
+
+	// 从高上限降到稳定值的过程中只有降低，没有先降后升的振荡
+	for _, adjustment := range limiter.status().Adjustments {
+		if adjustment.Reason != "decrease" {
+			t.Errorf("unexpected adjustment %+v", adjustment)
+		}
+	}
+}
+
+// 延迟正常时只有请求排队才增加上限，空闲时上限不增长
+func TestAdaptiveLimitGrowsOnlyWhenSaturated(t *testing.T) {
+	limiter := newTestLimiter(t, 10, func(cfg *config.Config) {
+		cfg.App.AdaptiveConcurrency = true
+	})
+
+	for i := 0; i < adaptiveWindowSize; i++ {
+		limiter.observe(100 * time.Millisecond)
+	}
+	if got := limiter.status().Limit; got != 10 {
+		t.Errorf("limit without queueing = %d, want 10", got)
+	}
+
+	limiter.mu.Lock()
+	limiter.saturated = true
+	limiter.mu.Unlock()
+	for i := 0; i < adaptiveWindowSize; i++ {
+		limiter.observe(100 * time.Millisecond)
+	}
+	if got := limiter.status().Limit; got != 11 {
+		t.Errorf("limit after a saturated window = %d, want 11", got)
+	}
+}
+
+// 关闭自适应时使用固定上限，延迟样本不影响上限
+func TestStaticLimitWhenAdaptiveDisabled(t *testing.T) {
+	limiter := newTestLimiter(t, 200, func(cfg *config.Config) {
+		cfg.App.MaxConcurrentRequests = 1
+	})
+
+	for i := 0; i < adaptiveWindowSize; i++ {
+		limiter.observe(time.Minute)
+	}
+	status := limiter.status()
+	if status.Adaptive || status.Limit != 1 || len(status.Adjustments) != 0 {
+		t.Fatalf("status = %+v, want the static limit 1 without adjustments", status)
+	}
+
+	if !limiter.acquire(context.Background()) {
+		t.Fatal("first acquire failed")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if limiter.acquire(ctx) {
+		t.Fatal("second acquire succeeded over the static limit")
+	}
+	limiter.release()
+	if !limiter.acquire(context.Background()) {
+		t.Fatal("acquire after release failed")
+	}
+	if status := limiter.status(); status.InFlight != 1 || status.Queued != 0 {
+		t.Errorf("status = %+v, want 1 in flight and none queued", status)
+	}
+}
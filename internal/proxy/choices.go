@@ -0,0 +1,164 @@
+/**
+  @author: Hanhai
+  @desc: 请求多个候选结果（n或best_of大于1）的处理，按候选数估算输出令牌、按模型和客户端令牌限制候选数，并跟踪流式响应中各候选的结束状态
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/middleware"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestChoiceCounts 获取请求返回的候选结果数n和上游生成的候选结果数，未设置或无效时为1
+// best_of会让上游生成best_of个候选后只返回n个，但按best_of消耗令牌，因此生成数取n和best_of中较大的值
+func requestChoiceCounts(body []byte) (int, int) {
+	requestData, ok := decodeChoiceFields(body)
+	if !ok {
+		return 1, 1
+	}
+
+	returned := 1
+	if value, ok := jsonInt(requestData["n"]); ok && value > 1 {
+		returned = int(value)
+	}
+	generated := returned
+	if value, ok := jsonInt(requestData["best_of"]); ok && int(value) > generated {
+		generated = int(value)
+	}
+	return returned, generated
+}
+
+// estimateChoicesTokens 按候选结果数增加令牌估算，n为1时原样返回
+// 每个额外候选按请求的max_tokens估算输出，未设置max_tokens时按输入令牌数估算
+func estimateChoicesTokens(tokenEstimate int, body []byte, choiceCount int) int {
+	if choiceCount <= 1 {
+		return tokenEstimate
+	}
+
+	perChoice := tokenEstimate
+	if requestData, ok := decodeChoiceFields(body); ok {
+		for _, field := range maxTokensFields {
+			if value, ok := jsonInt(requestData[field]); ok && value > 0 {
+				perChoice = int(value)
+				break
+			}
+		}
+	}
+	return tokenEstimate + perChoice*(choiceCount-1)
+}
+
+// checkChoiceLimit 检查候选结果数是否超过模型或客户端令牌配置的上限，超过时返回错误说明
+// token为已验证的客户端令牌，未使用令牌验证时为空
+func checkChoiceLimit(modelName, token string, choiceCount int) error {
+	if choiceCount <= 1 {
+		return nil
+	}
+	if modelName != "" {
+		if override, ok := config.GetModelOverride(modelName); ok && override.MaxChoices > 0 && choiceCount > override.MaxChoices {
+			return fmt.Errorf("模型 %s 每个请求最多生成 %d 个候选结果，请求的n或best_of为 %d", modelName, override.MaxChoices, choiceCount)
+		}
+	}
+	if limit := config.GetClientTokenMaxChoices(config.GetConfig(), token); limit > 0 && choiceCount > limit {
+		return fmt.Errorf("当前客户端令牌每个请求最多生成 %d 个候选结果，请求的n或best_of为 %d", limit, choiceCount)
+	}
+	return nil
+}
+
+// applyChoiceCount 处理请求的候选结果数：超过模型或客户端令牌的上限时返回400并返回false，否则按候选数调整令牌估算
+// 候选结果数大于1时记录到访问日志和每日统计
+func applyChoiceCount(c *gin.Context, body []byte, modelName string, tokenEstimate int) (int, bool) {
+	_, generated := requestChoiceCounts(body)
+	if generated <= 1 {
+		return tokenEstimate, true
+	}
+
+	if err := checkChoiceLimit(modelName, c.GetString(middleware.ClientTokenContextKey), generated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": map[string]interface{}{
+				"message": err.Error(),
+				"type":    "invalid_request_error",
+				"code":    400,
+			},
+		})
+		return tokenEstimate, false
+	}
+
+	c.Set(middleware.ChoicesContextKey, generated)
+	config.AddDailyMultiChoice(generated)
+
+	estimate := estimateChoicesTokens(tokenEstimate, body, generated)
+	logger.Info("请求生成%d个候选结果，令牌估算从%d调整为%d", generated, tokenEstimate, estimate)
+	return estimate, true
+}
+
+// decodeChoiceFields 解析请求体，数字保留为json.Number
+func decodeChoiceFields(body []byte) (map[string]interface{}, bool) {
+	if len(body) == 0 {
+		return nil, false
+	}
+	var requestData map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&requestData); err != nil {
+		return nil, false
+	}
+	return requestData, true
+}
+
+// jsonInt 读取json.Number或float64类型的整数
+func jsonInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// streamChoiceTracker 跟踪流式响应中各候选结果的结束状态
+// 多个候选结果的事件按index交错返回，所有候选都收到结束原因后才算上游正常结束
+type streamChoiceTracker struct {
+	want     int
+	finished map[int]bool
+}
+
+// newStreamChoiceTracker 创建候选结果跟踪，want为请求的候选结果数
+func newStreamChoiceTracker(want int) *streamChoiceTracker {
+	if want < 1 {
+		want = 1
+	}
+	return &streamChoiceTracker{want: want, finished: make(map[int]bool, want)}
+}
+
+// observe 记录事件中已结束的候选结果，所有候选都已结束时返回true
+func (t *streamChoiceTracker) observe(event map[string]interface{}) bool {
+	choices, ok := event["choices"].([]interface{})
+	if !ok {
+		return len(t.finished) >= t.want
+	}
+	for position, item := range choices {
+		choice, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if reason, ok := choice["finish_reason"].(string); !ok || reason == "" {
+			continue
+		}
+		index := position
+		if value, ok := jsonInt(choice["index"]); ok {
+			index = int(value)
+		}
+		t.finished[index] = true
+	}
+	return len(t.finished) >= t.want
+}
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"flowsilicon/internal/config"
+)
+
+func TestRequestChoiceCounts(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantReturned  int
+		wantGenerated int
+	}{
+		{"未设置n", `{"model":"m"}`, 1, 1},
+		{"n为3", `{"model":"m","n":3}`, 3, 3},
+		{"best_of大于n时按best_of生成", `{"model":"m","n":2,"best_of":5}`, 2, 5},
+		{"best_of小于n时按n生成", `{"model":"m","n":4,"best_of":2}`, 4, 4},
+		{"无效的n", `{"model":"m","n":"3"}`, 1, 1},
+		{"无效的请求体", `not json`, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			returned, generated := requestChoiceCounts([]byte(tt.body))
+			if returned != tt.wantReturned || generated != tt.wantGenerated {
+				t.Errorf("requestChoiceCounts = (%d, %d), want (%d, %d)", returned, generated, tt.wantReturned, tt.wantGenerated)
+			}
+		})
+	}
+}
+
+func TestEstimateChoicesTokens(t *testing.T) {
+	if got := estimateChoicesTokens(100, []byte(`{"max_tokens":50}`), 3); got != 200 {
+		t.Errorf("with max_tokens = %d, want 200", got)
+	}
+	if got := estimateChoicesTokens(100, []byte(`{}`), 3); got != 300 {
+		t.Errorf("without max_tokens = %d, want 300", got)
+	}
+	if got := estimateChoicesTokens(100, []byte(`{"max_tokens":50}`), 1); got != 100 {
+		t.Errorf("single choice = %d, want 100", got)
+	}
+}
+
+// 模型和客户端令牌都可以限制候选结果数，取两者中更严格的限制
+func TestCheckChoiceLimit(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.ModelOverrides = map[string]config.ModelOverride{"limited-model": {MaxChoices: 4}}
+	cfg.Security.ClientTokens = []string{"sk-client-limited", "sk-client-free"}
+	cfg.Security.ClientTokenMaxChoices = map[string]int{"sk-client-limited": 2}
+	config.UpdateConfig(cfg)
+	t.Cleanup(func() { config.UpdateConfig(&config.Config{}) })
+
+	tests := []struct {
+		name    string
+		model   string
+		token   string
+		choices int
+		wantErr bool
+	}{
+		{"单个候选不受限制", "limited-model", "sk-client-limited", 1, false},
+		{"未超过模型上限", "limited-model", "", 4, false},
+		{"超过模型上限", "limited-model", "", 5, true},
+		{"未超过令牌上限", "other-model", "sk-client-limited", 2, false},
+		{"超过令牌上限", "other-model", "sk-client-limited", 3, true},
+		{"令牌上限比模型上限更严格", "limited-model", "sk-client-limited", 3, true},
+		{"未配置上限的令牌", "other-model", "sk-client-free", 10, false},
+		{"未使用令牌验证", "other-model", "", 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkChoiceLimit(tt.model, tt.token, tt.choices)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkChoiceLimit(%q, %q, %d) = %v, wantErr %v", tt.model, tt.token, tt.choices, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 读取按index交错返回三个候选结果的流式响应，逐个事件转换并跟踪结束状态
+// 每个候选的内容按index拼接后保持完整，所有候选都结束后才算上游正常结束
+func TestInterleavedChoicesStream(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/interleaved_choices.sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	choiceCount, _ := requestChoiceCounts([]byte(`{"model":"deepseek-ai/deepseek-r1","n":3,"stream":true}`))
+	tracker := newStreamChoiceTracker(choiceCount)
+
+	content := make(map[int]string)
+	reasoning := make(map[int]string)
+	finishReasons := make(map[int]string)
+	var finishedAt []int
+
+	scanner := bufio.NewScanner(bytes.NewReader(fixture))
+	event := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		data := []byte(strings.TrimPrefix(line, "data: "))
+		transformed, err := TransformStreamEvent(data)
+		if err != nil {
+			t.Fatalf("TransformStreamEvent: %v", err)
+		}
+		event++
+		if string(transformed) == "[DONE]" {
+			continue
+		}
+
+		var parsed map[string]interface{}
+		if err := json.Unmarshal(transformed, &parsed); err != nil {
+			t.Fatalf("event %d is not JSON after transform: %v", event, err)
+		}
+		if tracker.observe(parsed) {
+			finishedAt = append(finishedAt, event)
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Index        int               `json:"index"`
+				Delta        map[string]string `json:"delta"`
+				FinishReason *string           `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal(transformed, &chunk); err != nil {
+			t.Fatal(err)
+		}
+		for _, choice := range chunk.Choices {
+			// 推理模型的每个choice都补全content字段，不只是第一个
+			if _, ok := choice.Delta["content"]; !ok && len(choice.Delta) > 0 {
+				t.Errorf("event %d choice %d has no content field after transform", event, choice.Index)
+			}
+			content[choice.Index] += choice.Delta["content"]
+			reasoning[choice.Index] += choice.Delta["reasoning_content"]
+			if choice.FinishReason != nil {
+				finishReasons[choice.Index] = *choice.FinishReason
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	wantContent := map[int]string{0: "Aa", 1: "Bb", 2: "Cc"}
+	wantReasoning := map[int]string{0: "想", 1: "思", 2: ""}
+	wantFinish := map[int]string{0: "stop", 1: "stop", 2: "length"}
+	for index := 0; index < 3; index++ {
+		if content[index] != wantContent[index] {
+			t.Errorf("choice %d content = %q, want %q", index, content[index], wantContent[index])
+		}
+		if reasoning[index] != wantReasoning[index] {
+			t.Errorf("choice %d reasoning = %q, want %q", index, reasoning[index], wantReasoning[index])
+		}
+		if finishReasons[index] != wantFinish[index] {
+			t.Errorf("choice %d finish_reason = %q, want %q", index, finishReasons[index], wantFinish[index])
+		}
+	}
+	// 第4、5个事件中分别有候选结束，只有第6个事件之后所有候选都结束
+	if len(finishedAt) == 0 || finishedAt[0] != 6 {
+		t.Errorf("tracker reported all choices finished at events %v, want first at event 6", finishedAt)
+	}
+}
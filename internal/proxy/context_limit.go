@@ -0,0 +1,87 @@
+/**
+  @author: Hanhai
+  @desc: 上下文长度检查，开启后在选择密钥前预估输入令牌数，超过模型上下文长度的请求直接拒绝，不消耗密钥的调用次数
+**/
+
+package proxy
+
+import (
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/model"
+	"flowsilicon/pkg/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// enforceContextLimit 开启上下文长度检查时，输入令牌数超过模型上下文长度的请求返回400
+// 返回false表示已经返回了错误响应；模型的上下文长度未知或无法估算令牌数时放行
+func enforceContextLimit(c *gin.Context, body []byte, modelName string) bool {
+	cfg := config.GetConfig()
+	if cfg == nil || !cfg.App.EnforceContextLimits || modelName == "" {
+		return true
+	}
+
+	contextWindow := modelContextWindow(modelName)
+	if contextWindow <= 0 {
+		return true
+	}
+
+	inputTokens := estimateInputTokens(body)
+	if inputTokens <= contextWindow {
+		return true
+	}
+
+	logger.Info("模型 %s 的请求预估输入令牌数 %d 超过上下文长度 %d，已拒绝", modelName, inputTokens, contextWindow)
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": map[string]interface{}{
+			"message":          fmt.Sprintf("请求的输入预估为 %d 个令牌，超过模型 %s 的上下文长度 %d，请减少消息内容后重试", inputTokens, modelName, contextWindow),
+			"type":             "invalid_request_error",
+			"code":             400,
+			"estimated_tokens": inputTokens,
+			"context_window":   contextWindow,
+		},
+	})
+	return false
+}
+
+// modelContextWindow 获取模型的上下文长度，模型覆盖配置中设置的值优先于同步的模型信息
+func modelContextWindow(modelName string) int {
+	if override, ok := config.GetModelOverride(modelName); ok && override.ContextWindow > 0 {
+		return override.ContextWindow
+	}
+	return model.GetModelContext(modelName)
+}
+
+// estimateInputTokens 估算请求的输入令牌数，对话请求按消息估算，补全请求按prompt估算，其他请求返回0
+func estimateInputTokens(body []byte) int {
+	if tokens := estimateRequestTokens(body); tokens > 0 {
+		return tokens
+	}
+
+	var requestData struct {
+		Prompt interface{} `json:"prompt"`
+	}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return 0
+	}
+	switch prompt := requestData.Prompt.(type) {
+	case string:
+		return utils.EstimateStringTokens(prompt)
+	case []interface{}:
+		// 多个prompt分别生成，按最长的一个检查
+		longest := 0
+		for _, item := range prompt {
+			if text, ok := item.(string); ok {
+				if tokens := utils.EstimateStringTokens(text); tokens > longest {
+					longest = tokens
+				}
+			}
+		}
+		return longest
+	}
+	return 0
+}
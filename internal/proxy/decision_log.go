@@ -0,0 +1,55 @@
+/**
+  @author: Hanhai
+  @desc: 代理请求的密钥选择决策日志，选择密钥时保存选择过程，收到上游响应后补充结果写入决策日志
+**/
+
+package proxy
+
+import (
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// decisionContextKey 本次请求中尚未写入结果的密钥选择记录
+	decisionContextKey = "key_decision"
+	// 没有收到上游响应的选择，例如发送请求失败或读取响应失败后换密钥重试
+	decisionOutcomeRequestError = "request_error"
+	// 没有选出密钥
+	decisionOutcomeSelectionFailed = "selection_failed"
+)
+
+// selectKeyForRequest 根据请求类型选择最佳密钥，决策日志开启时保存本次选择的记录
+// 上一次选择的记录还没有结果时说明没有收到上游响应，按request_error写入，本次请求中已经失败的密钥不再选择
+func selectKeyForRequest(c *gin.Context, requestType string, modelName string, tokenEstimate int) (string, error) {
+	finishDecision(c, decisionOutcomeRequestError)
+
+	apiKey, decision, err := key.SelectKeyWithDecision(requestType, modelName, tokenEstimate, failedRequestKeys(c))
+	if err != nil {
+		key.FinishDecision(decision, decisionOutcomeSelectionFailed)
+		if errors.Is(err, config.ErrKeysNotInitialised) {
+			logger.Error("选择密钥失败: %v", err)
+		}
+		return "", err
+	}
+	if decision != nil {
+		c.Set(decisionContextKey, decision)
+	}
+	return apiKey, nil
+}
+
+// finishDecision 用最终结果写入本次请求尚未写入的选择记录
+func finishDecision(c *gin.Context, outcome string) {
+	value, exists := c.Get(decisionContextKey)
+	if !exists {
+		return
+	}
+	if decision, ok := value.(*key.Decision); ok && decision != nil {
+		key.FinishDecision(decision, outcome)
+		c.Set(decisionContextKey, (*key.Decision)(nil))
+	}
+}
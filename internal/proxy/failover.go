@@ -0,0 +1,187 @@
+/**
+  @author: Hanhai
+  @desc: 换密钥重试，上游返回429、408、5xx或密钥失效且还没有向客户端返回任何内容时，跳过本次请求中失败的密钥，按模型的策略换下一个密钥重新发送，返回429的密钥进入冷却
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 未设置时最多换密钥重试的次数
+const defaultMaxRetries = 2
+
+// failoverKeysContextKey 本次请求中返回可重试错误的密钥，换密钥重试时跳过
+const failoverKeysContextKey = "failover_keys"
+
+// RetriesHeader 发生换密钥重试时响应中的重试次数
+const RetriesHeader = "X-FS-Retries"
+
+// 上游返回的Retry-After的上限，避免异常的值让密钥长时间不参与选择
+const maxRetryAfter = 300 * time.Second
+
+// getMaxRetries 获取上游返回可重试的错误时最多换密钥重试的次数
+func getMaxRetries() int {
+	cfg := config.GetConfig()
+	if cfg == nil || cfg.App.MaxRetries == 0 {
+		return defaultMaxRetries
+	}
+	if cfg.App.MaxRetries < 0 {
+		return 0
+	}
+	return cfg.App.MaxRetries
+}
+
+// isRetryableResponse 判断上游的响应是否换密钥重试，限流、超时、上游服务错误和密钥失效时换一个密钥可能成功
+func isRetryableResponse(statusCode int, category key.ResponseCategory) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout ||
+		(statusCode >= 500 && statusCode <= 599) || key.IsKeyInvalidResponse(statusCode, category)
+}
+
+// failoverKeys 获取本次请求中返回可重试错误的密钥
+func failoverKeys(c *gin.Context) map[string]bool {
+	if value, exists := c.Get(failoverKeysContextKey); exists {
+		if failed, ok := value.(map[string]bool); ok {
+			return failed
+		}
+	}
+	return nil
+}
+
+// failedRequestKeys 获取本次请求中已经失败的密钥，包括返回可重试错误和首字节超时的密钥，重新选择密钥时跳过
+func failedRequestKeys(c *gin.Context) map[string]bool {
+	failover, stalled := failoverKeys(c), stalledStreamKeys(c)
+	if len(stalled) == 0 {
+		return failover
+	}
+	if len(failover) == 0 {
+		return stalled
+	}
+	failed := make(map[string]bool, len(failover)+len(stalled))
+	for apiKey := range failover {
+		failed[apiKey] = true
+	}
+	for apiKey := range stalled {
+		failed[apiKey] = true
+	}
+	return failed
+}
+
+// markFailoverKey 记录返回可重试错误的密钥，返回是否还可以换密钥重试，返回429的密钥按上游的Retry-After或设置的时间冷却
+// 密钥的失败由recordResponseOutcome计入，已经向客户端返回内容、客户端已断开、达到重试次数或没有其他可用密钥时不再重试
+// 重试时在响应头中设置已重试的次数，并计入每日统计
+func markFailoverKey(c *gin.Context, apiKey string, statusCode int, header http.Header) bool {
+	if statusCode == http.StatusTooManyRequests {
+		key.CoolDownKey(apiKey, parseRetryAfter(header))
+	}
+	if c.Writer.Written() || c.Request.Context().Err() != nil {
+		return false
+	}
+	failed := failoverKeys(c)
+	if failed == nil {
+		failed = make(map[string]bool)
+		c.Set(failoverKeysContextKey, failed)
+	}
+	failed[apiKey] = true
+
+	maxRetries := getMaxRetries()
+	if len(failed) > maxRetries {
+		if maxRetries > 0 {
+			logger.Warn("已尝试 %d 个密钥，最后一次返回状态码 %d，达到最大重试次数，返回上游的响应", len(failed), statusCode)
+		}
+		return false
+	}
+
+	excluded := failedRequestKeys(c)
+	remaining := 0
+	for _, k := range key.GetKeyPool().ActiveKeys() {
+		if !excluded[k.Key] {
+			remaining++
+		}
+	}
+	if remaining == 0 {
+		logger.Warn("已尝试 %d 个密钥，最后一次返回状态码 %d，没有其他可用的密钥，返回上游的响应", len(failed), statusCode)
+		return false
+	}
+
+	logger.Warn("密钥 %s 返回状态码 %d，换密钥重试（第 %d 次，最多 %d 次）", utils.MaskKey(apiKey), statusCode, len(failed), maxRetries)
+	c.Header(RetriesHeader, strconv.Itoa(len(failed)))
+	config.AddDailyRetry()
+	return true
+}
+
+// recordProxyCounters 请求结束后按模型和返回的状态码计入代理请求计数器，换密钥重试的次数从响应头中读取
+func recordProxyCounters(c *gin.Context, modelName string, success bool) {
+	config.RecordProxyRequest(modelName, c.Writer.Status(), success)
+	if retries, err := strconv.Atoi(c.Writer.Header().Get(RetriesHeader)); err == nil {
+		config.RecordProxyRetries(modelName, retries)
+	}
+}
+
+// parseRetryAfter 解析上游返回的Retry-After，支持秒数和HTTP日期，没有或无效时返回0，超过上限时返回上限
+func parseRetryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// 先按秒数比较，避免很大的值换算为时间时溢出
+		if seconds > int64(maxRetryAfter/time.Second) {
+			return maxRetryAfter
+		}
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = time.Until(at)
+	}
+
+	if wait > maxRetryAfter {
+		return maxRetryAfter
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// streamErrorStatus 获取流式响应第一条数据中错误的状态码，不是错误或错误中没有数字状态码时返回0
+func streamErrorStatus(line []byte) int {
+	payload := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+	if len(payload) == 0 || payload[0] != '{' {
+		return 0
+	}
+	var event struct {
+		Code    json.RawMessage `json:"code"`
+		Choices json.RawMessage `json:"choices"`
+		Error   *struct {
+			Code json.RawMessage `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil || len(event.Choices) > 0 {
+		return 0
+	}
+	code := event.Code
+	if event.Error != nil {
+		code = event.Error.Code
+	} else if len(code) == 0 {
+		return 0
+	}
+	status, err := strconv.Atoi(string(bytes.Trim(code, `"`)))
+	if err != nil || status < 400 || status > 599 {
+		return 0
+	}
+	return status
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "没有Retry-After", value: "", want: 0},
+		{name: "秒数", value: "120", want: 120 * time.Second},
+		{name: "等于上限", value: "300", want: maxRetryAfter},
+		{name: "超过上限的秒数", value: "86400", want: maxRetryAfter},
+		{name: "换算时会溢出的秒数", value: "9223372036854775807", want: maxRetryAfter},
+		{name: "负数", value: "-5", want: 0},
+		{name: "无效的值", value: "soon", want: 0},
+		{name: "很久以后的HTTP日期", value: time.Now().Add(48 * time.Hour).UTC().Format(http.TimeFormat), want: maxRetryAfter},
+		{name: "已经过去的HTTP日期", value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.value != "" {
+				header.Set("Retry-After", tt.value)
+			}
+			if got := parseRetryAfter(header); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	// HTTP日期只精确到秒，在上限内时按剩余时间返回
+	header := http.Header{}
+	header.Set("Retry-After", time.Now().Add(2*time.Minute).UTC().Format(http.TimeFormat))
+	if got := parseRetryAfter(header); got <= time.Minute || got > 2*time.Minute {
+		t.Errorf("parseRetryAfter(date in 2m) = %v, want about 2m", got)
+	}
+}
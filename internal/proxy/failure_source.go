@@ -0,0 +1,47 @@
+/**
+  @author: Hanhai
+  @desc: 按客户端记录上游响应，用于统计密钥失败的来源，错误率过高被限流的客户端在限流期间超出每分钟上限时返回429
+**/
+
+package proxy
+
+import (
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/middleware"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordResponseOutcome 根据上游响应更新密钥状态，并记录发起请求的客户端
+func recordResponseOutcome(c *gin.Context, apiKey string, statusCode int, body []byte) key.ResponseCategory {
+	category := key.RecordResponseOutcome(apiKey, statusCode, body)
+	key.RecordFailureSource(apiKey, middleware.ClientIdentity(c), category)
+	finishDecision(c, string(category))
+	return category
+}
+
+// recordClientSuccess 记录客户端的一次成功请求，用于计算客户端的错误率
+func recordClientSuccess(c *gin.Context, apiKey string) {
+	key.RecordFailureSource(apiKey, middleware.ClientIdentity(c), key.CategorySuccess)
+	finishDecision(c, string(key.CategorySuccess))
+}
+
+// rejectIfClientThrottled 客户端被限流且当前窗口内的请求数已达到上限时返回429并返回true
+func rejectIfClientThrottled(c *gin.Context) bool {
+	allowed, wait := key.AllowClientRequest(middleware.ClientIdentity(c))
+	if allowed {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": map[string]interface{}{
+			"message": "客户端最近的错误率过高，已被临时限流，请稍后重试",
+			"type":    "rate_limit_error",
+			"code":    http.StatusTooManyRequests,
+		},
+	})
+	return true
+}
@@ -0,0 +1,98 @@
+/**
+  @author: Hanhai
+  @desc: 流式请求的首字节超时，上游在限定时间内没有返回任何流式数据时换密钥重试，开始返回数据后只受数据间隔超时限制
+**/
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stalledKeysContextKey 本次请求中首字节超时的密钥，重试时跳过
+const stalledKeysContextKey = "stream_stalled_keys"
+
+// prefixedBody 将已读取的首段数据和剩余的响应体拼接为新的响应体
+type prefixedBody struct {
+	io.Reader
+	body io.Closer
+}
+
+func (p *prefixedBody) Close() error {
+	return p.body.Close()
+}
+
+// waitFirstStreamData 等待上游返回第一条data行，同时返回该行，超时时关闭响应体并返回false，timeout为0时不限制等待时间
+// 返回的响应体包含等待期间已读取的内容，上游在返回数据前结束时也返回true，由后续流程处理
+func waitFirstStreamData(body io.ReadCloser, timeout time.Duration) (io.ReadCloser, []byte, bool) {
+	reader := bufio.NewReaderSize(body, 65536)
+	var prefix bytes.Buffer
+	var first []byte
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for {
+			// 超长的行只读取限制内的部分，剩余部分由后续流程转发
+			line, oversized, err := readSSELine(reader, StreamMaxEventBytes())
+			prefix.Write(line)
+			if bytes.HasPrefix(line, []byte("data:")) {
+				first = line
+			}
+			if err != nil || oversized || first != nil {
+				return
+			}
+		}
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-done:
+		return &prefixedBody{Reader: io.MultiReader(&prefix, reader), body: body}, first, true
+	case <-expired:
+		body.Close()
+		return nil, nil, false
+	}
+}
+
+// stalledStreamKeys 获取本次请求中首字节超时的密钥
+func stalledStreamKeys(c *gin.Context) map[string]bool {
+	if value, exists := c.Get(stalledKeysContextKey); exists {
+		if stalled, ok := value.(map[string]bool); ok {
+			return stalled
+		}
+	}
+	return nil
+}
+
+// markStreamKeyStalled 记录首字节超时的密钥并计入密钥失败，返回是否还可以重试
+func markStreamKeyStalled(c *gin.Context, apiKey string) bool {
+	stalled := stalledStreamKeys(c)
+	if stalled == nil {
+		stalled = make(map[string]bool)
+		c.Set(stalledKeysContextKey, stalled)
+	}
+	stalled[apiKey] = true
+	key.UpdateApiKeyStatus(apiKey, false)
+
+	// 未配置重试次数时至少换一个密钥重试一次
+	maxRetries := 1
+	if cfg := config.GetConfig(); cfg != nil && cfg.ApiProxy.Retry.MaxRetries > 0 {
+		maxRetries = cfg.ApiProxy.Retry.MaxRetries
+	}
+	return len(stalled) <= maxRetries
+}
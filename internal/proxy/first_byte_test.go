@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"flowsilicon/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+const firstChunk = "data: {\"id\":\"chatcmpl-stall\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"first\"}}]}\n\n"
+
+// stallUntilClosed 保持连接直到代理关闭请求，最多等待5秒
+func stallUntilClosed(r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// 首字节超时只在上游返回第一条数据前重试，开始返回数据后上游停顿只受数据间隔超时限制，不再重试
+func TestStreamFirstByteTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("等待超时需要数秒，-short时跳过")
+	}
+
+	tests := []struct {
+		name         string
+		stall        func(w http.ResponseWriter, r *http.Request) // 第一次请求的行为
+		wantAttempts int
+		wantContent  string
+	}{
+		{
+			name: "第一条数据前停顿时换密钥重试",
+			stall: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				stallUntilClosed(r)
+			},
+			wantAttempts: 2,
+			wantContent:  "retried",
+		},
+		{
+			name: "返回数据后停顿时不重试",
+			stall: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Write([]byte(firstChunk))
+				w.(http.Flusher).Flush()
+				stallUntilClosed(r)
+			},
+			wantAttempts: 1,
+			wantContent:  "first",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var keys []string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				keys = append(keys, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+				first := len(keys) == 1
+				mu.Unlock()
+
+				if first {
+					tt.stall(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Write([]byte("data: {\"id\":\"chatcmpl-retry\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"retried\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"))
+			}))
+			defer upstream.Close()
+
+			cfg := &config.Config{}
+			cfg.App.StreamFirstByteTimeoutSeconds = 1
+			cfg.App.StreamIdleTimeoutSeconds = 1
+			config.UpdateConfig(cfg)
+			config.SetUpstreamOverride(upstream.URL)
+			config.ReplaceApiKeys([]config.ApiKey{
+				{ID: 1, Key: "sk-stall-key-1", Balance: 10},
+				{ID: 2, Key: "sk-stall-key-2", Balance: 10},
+			})
+			t.Cleanup(func() {
+				config.SetUpstreamOverride("")
+				config.ReplaceApiKeys(nil)
+				config.UpdateConfig(&config.Config{})
+			})
+
+			// 与服务器相同的路由，处理函数按path参数分析请求
+			router := gin.New()
+			router.Any("/v1/*path", HandleOpenAIProxy)
+			body := `{"model":"test-model","stream":true,"messages":[{"role":"user","content":"hello"}]}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			start := time.Now()
+			router.ServeHTTP(w, req)
+			elapsed := time.Since(start)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(keys) != tt.wantAttempts {
+				t.Errorf("upstream received %d requests, want %d", len(keys), tt.wantAttempts)
+			}
+			if len(keys) == 2 && keys[0] == keys[1] {
+				t.Errorf("retry used the stalled key %s", keys[0])
+			}
+			if !strings.Contains(w.Body.String(), tt.wantContent) {
+				t.Errorf("response = %q, want it to contain %q", w.Body.String(), tt.wantContent)
+			}
+			// 超时后应立即结束等待，而不是等上游最多5秒的停顿
+			if elapsed > 4*time.Second {
+				t.Errorf("request took %v, want the timeout to end the stall", elapsed)
+			}
+		})
+	}
+}
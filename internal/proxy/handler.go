@@ -10,10 +10,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/key"
 	"flowsilicon/internal/logger"
+	"flowsilicon/internal/middleware"
 	"flowsilicon/internal/model"
+	"flowsilicon/internal/signing"
 	"flowsilicon/pkg/utils"
 	"fmt"
 	"io"
@@ -62,9 +65,21 @@ func HandleApiProxy(c *gin.Context) {
 		return
 	}
 
-	// 获取配置
-	cfg := config.GetConfig()
-	baseURL := cfg.ApiProxy.BaseURL
+	if rejectIfSelectionPaused(c) || rejectIfClientThrottled(c) {
+		return
+	}
+	// 达到上游并发上限时排队等待
+	if !acquireUpstreamSlot(c) {
+		return
+	}
+	defer releaseUpstreamSlot()
+	// 写入没有收到上游响应的选择记录
+	defer finishDecision(c, decisionOutcomeRequestError)
+
+	startTime := time.Now()
+
+	// 获取上游地址
+	baseURL := config.GetApiBaseURL()
 
 	// 获取请求路径
 	path := c.Param("path")
@@ -73,7 +88,7 @@ func HandleApiProxy(c *gin.Context) {
 	targetURL := fmt.Sprintf("%s%s", baseURL, path)
 
 	// 读取请求体
-	bodyBytes, err := io.ReadAll(c.Request.Body)
+	bodyBytes, err := getRequestBody(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("Failed to read request body: %v", err),
@@ -96,8 +111,21 @@ func HandleApiProxy(c *gin.Context) {
 		return
 	}
 
+	// 请求多个候选结果时按候选数估算令牌，超过模型的候选数上限时拒绝
+	tokenEstimate, ok := applyChoiceCount(c, bodyBytes, modelName, tokenEstimate)
+	if !ok {
+		return
+	}
+
+	// 开启上下文长度检查时，超过模型上下文长度的请求在选择密钥前拒绝
+	if !enforceContextLimit(c, bodyBytes, modelName) {
+		return
+	}
+
 	// 调用处理请求的函数，包含重试逻辑
 	success := handleApiProxyWithRetry(c, targetURL, bodyBytes, requestType, modelName, tokenEstimate)
+	config.RecordRealtimeRequest(success, time.Since(startTime))
+	recordProxyCounters(c, modelName, success)
 
 	// 如果请求成功且有模型名称，更新模型调用次数
 	if success && modelName != "" {
@@ -139,8 +167,8 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 		return true
 	}
 
-	// 检查是否需要重试
-	if !shouldRetry(err, retryConfig) {
+	// 已经返回了响应（包括换密钥重试后的上游错误）时不再重试，检查是否需要重试
+	if c.Writer.Written() || !shouldRetry(err, retryConfig) {
 		return false
 	}
 
@@ -153,9 +181,10 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 
 		// 记录重试信息
 		logger.Warn("API请求第%d次重试: %s, 错误: %v", i+1, targetURL, err)
+		config.RecordProxyRetries(modelName, 1)
 
 		// 获取另一个API密钥进行重试
-		apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
+		apiKey, err := selectKeyForRequest(c, requestType, modelName, tokenEstimate)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "No suitable API keys available for retry",
@@ -167,7 +196,7 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 		maskedKey := utils.MaskKey(apiKey)
 		logger.Info("使用新的API密钥重试请求: %s", maskedKey)
 
-		// 创建新的请求
+		// 创建新的请求，原样使用首次请求的请求体，seed等参数不会改变
 		req, err := http.NewRequest(c.Request.Method, targetURL, bytes.NewBuffer(bodyBytes))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -189,21 +218,30 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 
 		// 设置 Authorization header
 		utils.SetCommonHeaders(req, apiKey)
+		// 按密钥所属的服务商附加请求头和签名，请求体已经完成所有改写
+		if err := signing.ApplyProviderHeaders(req, apiKey, bodyBytes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("Failed to sign request: %v", err),
+			})
+			return false
+		}
 
 		// 创建 HTTP 客户端
 		client := utils.CreateClient()
 
 		// 发送请求
+		upstreamStart := time.Now()
 		resp, err := client.Do(req)
 		if err != nil {
 			// 更新密钥失败记录
-			key.UpdateApiKeyStatus(apiKey, false)
+			key.RecordRequestError(apiKey, err)
 
 			// 记录错误并继续重试
 			logger.Error("发送请求失败: %v", err)
 			continue
 		}
 		defer resp.Body.Close()
+		recordUpstreamLatency(apiKey, time.Since(upstreamStart))
 
 		// 记录请求信息
 		logger.InfoWithKey(maskedKey, "API请求重试: %s %s", c.Request.Method, c.Request.URL.Path)
@@ -219,8 +257,8 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 		// 检查响应状态码
 		success := resp.StatusCode >= 200 && resp.StatusCode < 300
 
-		// 更新密钥状态
-		key.UpdateApiKeyStatus(apiKey, success)
+		// 更新密钥状态，客户端原因的错误不计入密钥失败
+		recordResponseOutcome(c, apiKey, resp.StatusCode, respBody)
 
 		// 统计请求数据
 		tokenCount := utils.EstimateTokenCount(bodyBytes, respBody)
@@ -234,6 +272,7 @@ func handleApiProxyWithRetry(c *gin.Context, targetURL string, bodyBytes []byte,
 			completionTokensCount = tokenCount - promptTokensCount
 		}
 		config.AddDailyRequestStat(apiKey, modelNameForStats, 1, promptTokensCount, completionTokensCount, success)
+		config.AddDailyClientStat(middleware.ClientIdentity(c), 1, promptTokensCount, completionTokensCount)
 
 		// 复制响应 headers
 		for name, values := range resp.Header {
@@ -272,7 +311,7 @@ func processApiRequest(c *gin.Context, targetURL string, bodyBytes []byte, reque
 	}
 
 	// 根据请求类型选择最佳的API密钥
-	apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
+	apiKey, err := selectKeyForRequest(c, requestType, modelName, tokenEstimate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "No suitable API keys available",
@@ -302,19 +341,28 @@ func processApiRequest(c *gin.Context, targetURL string, bodyBytes []byte, reque
 
 	// 设置 Authorization header
 	utils.SetCommonHeaders(req, apiKey)
+	// 按密钥所属的服务商附加请求头和签名，请求体已经完成所有改写
+	if err := signing.ApplyProviderHeaders(req, apiKey, bodyBytes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to sign request: %v", err),
+		})
+		return false, err
+	}
 
 	// 创建 HTTP 客户端
 	client := utils.CreateClient()
 
 	// 发送请求
+	upstreamStart := time.Now()
 	resp, err := client.Do(req)
 
 	if err != nil {
 		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
+		key.RecordRequestError(apiKey, err)
 		return false, err
 	}
 	defer resp.Body.Close()
+	recordUpstreamLatency(apiKey, time.Since(upstreamStart))
 
 	// 记录请求信息
 	maskedKey := utils.MaskKey(apiKey)
@@ -337,13 +385,29 @@ func processApiRequest(c *gin.Context, targetURL string, bodyBytes []byte, reque
 
 	// 如果请求失败，返回错误
 	if !success {
-		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
+		// 更新密钥失败记录，客户端原因的错误不计入密钥失败
+		category := recordResponseOutcome(c, apiKey, resp.StatusCode, respBody)
+
+		// 可重试的错误换下一个密钥重试，重试的结果作为本次请求的结果
+		if isRetryableResponse(resp.StatusCode, category) && markFailoverKey(c, apiKey, resp.StatusCode, resp.Header) {
+			return processApiRequest(c, targetURL, bodyBytes, requestType, modelName, tokenEstimate)
+		}
+
+		// 不再重试时原样返回上游的错误响应
+		for name, values := range resp.Header {
+			for _, value := range values {
+				c.Header(name, value)
+			}
+		}
+		setRetryAfterHeader(c, apiKey, resp.StatusCode, resp.Header)
+		c.Status(resp.StatusCode)
+		c.Writer.Write(respBody)
 		return false, fmt.Errorf("API请求失败，状态码: %d", resp.StatusCode)
 	}
 
 	// 更新密钥状态
 	key.UpdateApiKeyStatus(apiKey, success)
+	recordClientSuccess(c, apiKey)
 
 	// 统计请求数据
 	tokenCount := utils.EstimateTokenCount(bodyBytes, respBody)
@@ -361,6 +425,7 @@ func processApiRequest(c *gin.Context, targetURL string, bodyBytes []byte, reque
 	}
 	// 添加到每日统计
 	config.AddDailyRequestStat(apiKey, modelNameForStats, 1, promptTokensCount, completionTokensCount, success)
+	config.AddDailyClientStat(middleware.ClientIdentity(c), 1, promptTokensCount, completionTokensCount)
 
 	// 复制响应 headers
 	for name, values := range resp.Header {
@@ -387,12 +452,24 @@ func HandleOpenAIProxy(c *gin.Context) {
 		return
 	}
 
+	if rejectIfSelectionPaused(c) || rejectIfClientThrottled(c) {
+		return
+	}
+	// 达到上游并发上限时排队等待
+	if !acquireUpstreamSlot(c) {
+		return
+	}
+	defer releaseUpstreamSlot()
+	// 写入没有收到上游响应的选择记录
+	defer finishDecision(c, decisionOutcomeRequestError)
+
+	startTime := time.Now()
+
 	// 对于流式请求，设置较长的超时时间
 	if strings.Contains(c.Request.URL.Path, "/chat/completions") || strings.Contains(c.Request.URL.Path, "/completions") {
 		// 检查是否可能是流式请求
 		var requestData map[string]interface{}
-		bodyBytes, _ := io.ReadAll(c.Request.Body)
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes)) // 恢复body
+		bodyBytes, _ := getRequestBody(c)
 
 		if err := json.Unmarshal(bodyBytes, &requestData); err == nil {
 			if stream, ok := requestData["stream"].(bool); ok && stream {
@@ -446,9 +523,8 @@ func HandleOpenAIProxy(c *gin.Context) {
 		}
 	}
 
-	// 获取配置
-	cfg := config.GetConfig()
-	baseURL := cfg.ApiProxy.BaseURL
+	// 获取上游地址
+	baseURL := config.GetApiBaseURL()
 
 	// 获取请求路径
 	path := c.Param("path")
@@ -492,7 +568,7 @@ func HandleOpenAIProxy(c *gin.Context) {
 	}
 
 	// 读取请求体
-	bodyBytes, err := io.ReadAll(c.Request.Body)
+	bodyBytes, err := getRequestBody(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("Failed to read request body: %v", err),
@@ -528,6 +604,9 @@ func HandleOpenAIProxy(c *gin.Context) {
 				return
 			}
 		}
+
+		// 将虚拟模型名称替换为映射的上游模型，后续的密钥选择和禁用检查都使用上游模型
+		bodyBytes = resolveModelAlias(bodyBytes)
 	}
 
 	// 检查chat/completions请求中是否缺少必要字段
@@ -656,6 +735,12 @@ func HandleOpenAIProxy(c *gin.Context) {
 	}
 	requestType, modelName, tokenEstimate := AnalyzeOpenAIRequest(requestPath, bodyBytes)
 
+	// 请求多个候选结果时按候选数估算令牌，超过模型的候选数上限时拒绝
+	tokenEstimate, ok := applyChoiceCount(c, bodyBytes, modelName, tokenEstimate)
+	if !ok {
+		return
+	}
+
 	// 转换请求体为硅基流动格式
 	transformedBody, err := TransformRequestBody(bodyBytes, requestPath)
 	if err != nil {
@@ -665,8 +750,29 @@ func HandleOpenAIProxy(c *gin.Context) {
 		return
 	}
 
+	// 按模型配置注入或截断max_tokens，响应头需要在开始返回响应前设置
+	transformedBody, clamped := applyMaxTokensGuard(transformedBody, modelName)
+	if clamped {
+		c.Header(ClampedHeader, "max_tokens")
+	}
+
+	// 模型配置了截断策略和上下文长度时，预估超出上下文长度的请求在发送前截断
+	transformedBody = applyProactiveTruncation(c, transformedBody, modelName)
+
+	// 开启上下文长度检查时，截断后仍超过模型上下文长度的请求在选择密钥前拒绝
+	if !enforceContextLimit(c, transformedBody, modelName) {
+		return
+	}
+
+	// 按影子流量规则抽样，主响应完成后再镜像到候选模型
+	mirror := prepareShadowMirror(c, requestPath, modelName)
+
 	// 调用带重试逻辑的函数处理OpenAI格式请求
 	success := processOpenAIRequestWithRetry(c, targetURL, transformedBody, bodyBytes, requestType, modelName, tokenEstimate, requestPath)
+	config.RecordRealtimeRequest(success, time.Since(startTime))
+	recordProxyCounters(c, modelName, success)
+
+	mirror.dispatch(c, targetURL, transformedBody, success)
 
 	// 如果请求成功且有模型名称，更新模型调用次数
 	if success && modelName != "" {
@@ -698,10 +804,9 @@ func processOpenAIRequestWithRetry(c *gin.Context, targetURL string, transformed
 		}
 	}
 
-	// 流式请求需要特殊处理，暂不支持重试
+	// 流式请求在开始返回数据前换密钥重试，见handleOpenAIStreamRequest
 	if isStreamRequest {
-		handleOpenAIStreamRequest(c, targetURL, transformedBody, requestType, modelName, tokenEstimate, originalBody)
-		return true
+		return handleOpenAIStreamRequest(c, targetURL, transformedBody, requestType, modelName, tokenEstimate, originalBody)
 	}
 
 	// 如果最大重试次数为0，直接处理一次请求
@@ -717,8 +822,8 @@ func processOpenAIRequestWithRetry(c *gin.Context, targetURL string, transformed
 		return true
 	}
 
-	// 检查是否需要重试
-	if !shouldRetry(err, retryConfig) {
+	// 已经返回了响应（包括换密钥重试后的上游错误）时不再重试，检查是否需要重试
+	if c.Writer.Written() || !shouldRetry(err, retryConfig) {
 		return false
 	}
 
@@ -731,9 +836,10 @@ func processOpenAIRequestWithRetry(c *gin.Context, targetURL string, transformed
 
 		// 记录重试信息
 		logger.Warn("OpenAI格式API请求第%d次重试: %s, 错误: %v", i+1, targetURL, err)
+		config.RecordProxyRetries(modelName, 1)
 
 		// 获取另一个API密钥进行重试
-		apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
+		apiKey, err := selectKeyForRequest(c, requestType, modelName, tokenEstimate)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "No suitable API keys available for retry",
@@ -745,7 +851,8 @@ func processOpenAIRequestWithRetry(c *gin.Context, targetURL string, transformed
 		maskedKey := utils.MaskKey(apiKey)
 		logger.Info("使用新的API密钥重试OpenAI格式请求: %s", maskedKey)
 
-		// 创建新的请求
+		// 创建新的请求，请求体与首次请求完全相同（包括seed等参数），
+		// 只更换API密钥，保证带seed的请求在新密钥上得到可复现的输出
 		req, err := http.NewRequest(c.Request.Method, targetURL, bytes.NewBuffer(transformedBody))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -767,11 +874,19 @@ func processOpenAIRequestWithRetry(c *gin.Context, targetURL string, transformed
 
 		// 设置 Authorization header
 		utils.SetCommonHeaders(req, apiKey)
+		// 按密钥所属的服务商附加请求头和签名，请求体已经完成所有改写
+		if err := signing.ApplyProviderHeaders(req, apiKey, transformedBody); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("Failed to sign request: %v", err),
+			})
+			return false
+		}
 
 		// 创建 HTTP 客户端
 		client := utils.CreateClient()
 
 		// 发送请求
+		upstreamStart := time.Now()
 		resp, err := client.Do(req)
 		if err != nil {
 			// 区分连接错误和其他错误类型
@@ -796,10 +911,11 @@ func processOpenAIRequestWithRetry(c *gin.Context, targetURL string, transformed
 			}
 
 			// 更新密钥失败记录
-			key.UpdateApiKeyStatus(apiKey, false)
+			key.RecordRequestError(apiKey, err)
 			continue
 		}
 		defer resp.Body.Close()
+		recordUpstreamLatency(apiKey, time.Since(upstreamStart))
 
 		// 记录请求信息
 		logger.InfoWithKey(maskedKey, "OpenAI格式API请求重试: %s %s", c.Request.Method, c.Request.URL.Path)
@@ -815,8 +931,8 @@ func processOpenAIRequestWithRetry(c *gin.Context, targetURL string, transformed
 		// 检查响应状态码
 		success := resp.StatusCode >= 200 && resp.StatusCode < 300
 
-		// 更新密钥状态
-		key.UpdateApiKeyStatus(apiKey, success)
+		// 更新密钥状态，客户端原因的错误不计入密钥失败
+		recordResponseOutcome(c, apiKey, resp.StatusCode, respBody)
 
 		// 统计请求数据
 		tokenCount := utils.EstimateTokenCount(originalBody, respBody)
@@ -831,6 +947,12 @@ func processOpenAIRequestWithRetry(c *gin.Context, targetURL string, transformed
 
 		// 添加到每日统计
 		config.AddDailyRequestStat(apiKey, modelName, 1, promptTokensCount, completionTokensCount, success)
+		config.AddDailyClientStat(middleware.ClientIdentity(c), 1, promptTokensCount, completionTokensCount)
+
+		// 图片托管生效时把base64图片改写为图片地址
+		if success {
+			respBody = hostImagesInResponse(c, path, respBody)
+		}
 
 		// 转换响应为OpenAI格式
 		openAIResponse, err := TransformResponseBody(respBody, path)
@@ -878,13 +1000,13 @@ func shouldRetry(err error, retryConfig config.RetryConfig) bool {
 	return false
 }
 
-// 处理OpenAI流式请求
-func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody []byte, requestType string, modelName string, tokenEstimate int, originalBody []byte) {
+// 处理OpenAI流式请求，返回请求是否成功：上游返回错误、流式响应中途中断或没有可用密钥时为false
+func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody []byte, requestType string, modelName string, tokenEstimate int, originalBody []byte) bool {
 	// 检查是否有直接从以前的流式响应中设置的标志
 	if streamCompleted, exists := c.Get("stream_completed"); exists && streamCompleted.(bool) {
 		logger.Info("检测到从流式响应完成后的后续请求，直接返回OK")
 		c.Status(http.StatusOK)
-		return
+		return true
 	}
 
 	// 检查请求体中的stream字段是否为true
@@ -895,14 +1017,14 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 			if streamBool, ok := stream.(bool); ok && !streamBool {
 				logger.Info("检测到请求中stream=false，转为非流式请求处理")
 				// 处理为非流式请求
-				_, err := processOpenAIRequest(c, targetURL, transformedBody, originalBody, requestType, modelName, tokenEstimate, c.Request.URL.Path)
+				success, err := processOpenAIRequest(c, targetURL, transformedBody, originalBody, requestType, modelName, tokenEstimate, c.Request.URL.Path)
 				if err != nil {
 					logger.Error("处理非流式请求失败: %v", err)
 					c.JSON(http.StatusInternalServerError, gin.H{
 						"error": fmt.Sprintf("处理请求失败: %v", err),
 					})
 				}
-				return
+				return success
 			}
 		}
 	}
@@ -916,16 +1038,16 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 				"code":    403,
 			},
 		})
-		return
+		return false
 	}
 
-	// 根据请求类型选择最佳的API密钥
-	apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
+	// 根据请求类型选择最佳的API密钥，跳过本次请求中已经失败的密钥
+	apiKey, err := selectKeyForRequest(c, requestType, modelName, tokenEstimate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "No suitable API keys available",
 		})
-		return
+		return false
 	}
 
 	// 检查是否是推理模型（类型为7）
@@ -959,7 +1081,7 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("Failed to create request: %v", err),
 		})
-		return
+		return false
 	}
 
 	// 复制原始请求的 headers
@@ -975,6 +1097,13 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 
 	// 设置 Authorization header 和其他通用头
 	utils.SetCommonHeaders(req, apiKey)
+	// 按密钥所属的服务商附加请求头和签名，请求体已经完成所有改写
+	if err := signing.ApplyProviderHeaders(req, apiKey, transformedBody); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to sign request: %v", err),
+		})
+		return false
+	}
 
 	// 为推理模型添加特殊请求头
 	if isReasonModelType {
@@ -1002,16 +1131,21 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 	logger.Info("跳过重复的响应头设置")
 	// utils.SetStreamResponseHeaders(c.Writer)
 
-	// 监听客户端连接关闭
+	// 监听客户端连接关闭，请求处理结束后退出，gin会复用上下文，协程中不能再读取c.Request
 	clientCtx, clientCancel := context.WithCancel(ctx)
+	requestCtx := c.Request.Context()
 	go func() {
-		<-c.Request.Context().Done()
-		logger.Info("检测到客户端已断开连接，取消流式请求")
-		clientCancel() // 取消请求
+		select {
+		case <-requestCtx.Done():
+			logger.Info("检测到客户端已断开连接，取消流式请求")
+			clientCancel() // 取消请求
+		case <-clientCtx.Done():
+		}
 	}()
 	defer clientCancel()
 
 	// 发送请求，使用上下文控制超时
+	upstreamStart := time.Now()
 	resp, err := client.Do(req.WithContext(clientCtx))
 	if err != nil {
 		// 区分连接错误和其他错误类型
@@ -1036,15 +1170,13 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 		}
 
 		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
-		return
+		key.RecordRequestError(apiKey, err)
+		return false
 	}
+	recordUpstreamLatency(apiKey, time.Since(upstreamStart))
 
 	// 检查状态码
 	if resp.StatusCode != http.StatusOK {
-		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
-
 		// 尝试读取错误消息
 		errBody, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
@@ -1060,6 +1192,22 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 			logger.Error("流式请求返回非200状态码: %d, 响应: %s", resp.StatusCode, string(errBody))
 		}
 
+		// 上下文过长且模型开启了截断策略时，截断消息后重试一次
+		if isContextLengthError(resp.StatusCode, errBody) {
+			if truncatedBody, ok := truncateForContextError(c, transformedBody, modelName, errBody); ok {
+				return handleOpenAIStreamRequest(c, targetURL, truncatedBody, requestType, modelName, tokenEstimate, originalBody)
+			}
+		}
+
+		// 更新密钥失败记录，客户端原因的错误不计入密钥失败
+		category := recordResponseOutcome(c, apiKey, resp.StatusCode, errBody)
+
+		// 可重试的错误，还没有开始返回流式数据，换下一个密钥重试
+		if isRetryableResponse(resp.StatusCode, category) && markFailoverKey(c, apiKey, resp.StatusCode, resp.Header) {
+			clientCancel()
+			return handleOpenAIStreamRequest(c, targetURL, transformedBody, requestType, modelName, tokenEstimate, originalBody)
+		}
+
 		// 尝试解析JSON错误消息
 		var errorResponse struct {
 			Code    int    `json:"code"`
@@ -1103,7 +1251,8 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 			errorCode = resp.StatusCode
 		}
 
-		// 以结构化方式返回错误
+		// 以结构化方式返回错误，限流时告知客户端需要等待的时间
+		setRetryAfterHeader(c, apiKey, resp.StatusCode, resp.Header)
 		c.JSON(resp.StatusCode, gin.H{
 			"error": gin.H{
 				"message": errorMessage,
@@ -1111,14 +1260,43 @@ func handleOpenAIStreamRequest(c *gin.Context, targetURL string, transformedBody
 				"code":    errorCode,
 			},
 		})
-		return
+		return false
+	}
+
+	// 等待上游返回第一条数据，在此之前还没有向客户端写入任何内容，超时或第一条数据是错误时可以换密钥重试
+	// 开始转发后上游再出错时不再重试，以upstream_aborted事件结束响应
+	firstByteTimeout, _ := config.GetStreamTimeouts(modelName)
+	responseBody, firstData, ok := waitFirstStreamData(resp.Body, firstByteTimeout)
+	if !ok {
+		clientCancel()
+		logger.Warn("密钥 %s 的流式响应在 %v 内没有返回数据", utils.MaskKey(apiKey), firstByteTimeout)
+		if markStreamKeyStalled(c, apiKey) {
+			return handleOpenAIStreamRequest(c, targetURL, transformedBody, requestType, modelName, tokenEstimate, originalBody)
+		}
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error": gin.H{
+				"message": fmt.Sprintf("上游在 %v 内没有返回数据，已达到最大重试次数", firstByteTimeout),
+				"type":    "timeout_error",
+				"code":    "first_byte_timeout",
+			},
+		})
+		return false
+	}
+	status := streamErrorStatus(firstData)
+	if status > 0 &&
+		isRetryableResponse(status, key.ClassifyResponse(status, firstData)) && markFailoverKey(c, apiKey, status, resp.Header) {
+		responseBody.Close()
+		clientCancel()
+		recordResponseOutcome(c, apiKey, status, firstData)
+		return handleOpenAIStreamRequest(c, targetURL, transformedBody, requestType, modelName, tokenEstimate, originalBody)
 	}
 
 	// 记录成功启动流式响应
 	logger.Info("成功启动流式响应，正在处理响应流...")
 
-	// 处理流式响应，传递与当前请求相同的超时上下文
-	HandleStreamResponse(c, resp.Body, apiKey, originalBody)
+	// 处理流式响应，传递与当前请求相同的超时上下文，第一条数据是不再重试的错误时原样转发，请求记为失败
+	completed := HandleStreamResponse(c, responseBody, apiKey, originalBody)
+	return completed && status == 0
 }
 
 // 处理非流式OpenAI请求，返回是否成功处理和可能的错误
@@ -1144,7 +1322,7 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 	}
 
 	// 根据请求类型选择最佳的API密钥
-	apiKey, err := key.GetBestKeyForRequest(requestType, modelName, tokenEstimate)
+	apiKey, err := selectKeyForRequest(c, requestType, modelName, tokenEstimate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "No suitable API keys available",
@@ -1174,19 +1352,28 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 
 	// 设置 Authorization header
 	utils.SetCommonHeaders(req, apiKey)
+	// 按密钥所属的服务商附加请求头和签名，请求体已经完成所有改写
+	if err := signing.ApplyProviderHeaders(req, apiKey, transformedBody); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to sign request: %v", err),
+		})
+		return false, err
+	}
 
 	// 创建 HTTP 客户端
 	client := utils.CreateClient()
 
 	// 发送请求
+	upstreamStart := time.Now()
 	resp, err := client.Do(req)
 
 	if err != nil {
 		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
+		key.RecordRequestError(apiKey, err)
 		return false, err
 	}
 	defer resp.Body.Close()
+	recordUpstreamLatency(apiKey, time.Since(upstreamStart))
 
 	// 记录请求信息
 	maskedKey := utils.MaskKey(apiKey)
@@ -1209,8 +1396,20 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 
 	// 如果请求失败，返回错误
 	if !success {
-		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
+		// 上下文过长且模型开启了截断策略时，截断消息后重试一次
+		if isContextLengthError(resp.StatusCode, respBody) {
+			if truncatedBody, ok := truncateForContextError(c, transformedBody, modelName, respBody); ok {
+				return processOpenAIRequest(c, targetURL, truncatedBody, originalBody, requestType, modelName, tokenEstimate, path)
+			}
+		}
+
+		// 更新密钥失败记录，客户端原因的错误不计入密钥失败
+		category := recordResponseOutcome(c, apiKey, resp.StatusCode, respBody)
+
+		// 可重试的错误换下一个密钥重试，重试的结果作为本次请求的结果
+		if isRetryableResponse(resp.StatusCode, category) && markFailoverKey(c, apiKey, resp.StatusCode, resp.Header) {
+			return processOpenAIRequest(c, targetURL, transformedBody, originalBody, requestType, modelName, tokenEstimate, path)
+		}
 
 		// 尝试解析JSON错误消息
 		var errorResponse struct {
@@ -1251,7 +1450,8 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 		// 记录详细错误信息
 		logger.Error("OpenAI请求失败，状态码: %d, 错误: %s", resp.StatusCode, errorMessage)
 
-		// 以结构化方式返回错误
+		// 以结构化方式返回错误，限流时告知客户端需要等待的时间
+		setRetryAfterHeader(c, apiKey, resp.StatusCode, resp.Header)
 		c.JSON(resp.StatusCode, gin.H{
 			"error": gin.H{
 				"message": errorMessage,
@@ -1265,6 +1465,7 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 
 	// 更新密钥状态
 	key.UpdateApiKeyStatus(apiKey, success)
+	recordClientSuccess(c, apiKey)
 
 	// 统计请求数据
 	tokenCount := utils.EstimateTokenCount(originalBody, respBody)
@@ -1280,6 +1481,10 @@ func processOpenAIRequest(c *gin.Context, targetURL string, transformedBody []by
 
 	// 添加到每日统计
 	config.AddDailyRequestStat(apiKey, modelName, 1, promptTokensCount, completionTokensCount, success)
+	config.AddDailyClientStat(middleware.ClientIdentity(c), 1, promptTokensCount, completionTokensCount)
+
+	// 图片托管生效时把base64图片改写为图片地址
+	respBody = hostImagesInResponse(c, path, respBody)
 
 	// 转换响应为OpenAI格式
 	openAIResponse, err := TransformResponseBody(respBody, path)
@@ -1314,9 +1519,8 @@ func HandleModelsRequest(c *gin.Context, apiKey string) {
 
 	logger.Info("处理模型列表请求")
 
-	// 获取配置
-	cfg := config.GetConfig()
-	baseURL := cfg.ApiProxy.BaseURL
+	// 获取上游地址
+	baseURL := config.GetApiBaseURL()
 	targetURL := fmt.Sprintf("%s/v1/models", baseURL)
 
 	logger.Info("获取模型列表,目标URL: %s", targetURL)
@@ -1333,6 +1537,14 @@ func HandleModelsRequest(c *gin.Context, apiKey string) {
 
 	// 设置请求头
 	utils.SetCommonHeaders(req, apiKey)
+	// 按密钥所属的服务商附加请求头和签名，请求体已经完成所有改写
+	if err := signing.ApplyProviderHeaders(req, apiKey, nil); err != nil {
+		logger.Error("设置请求签名失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to sign request: %v", err),
+		})
+		return
+	}
 	// 创建HTTP客户端
 	client := utils.CreateClient()
 
@@ -1379,6 +1591,8 @@ func HandleModelsRequest(c *gin.Context, apiKey string) {
 	var modelsResponse map[string]interface{}
 	if err := json.Unmarshal(respBody, &modelsResponse); err == nil {
 		if models, ok := modelsResponse["data"].([]interface{}); ok {
+			// 先合并虚拟模型，再统一过滤被禁用的模型
+			models = mergeVirtualModels(models)
 			var filteredModels []interface{}
 			for _, model := range models {
 				if modelObj, ok := model.(map[string]interface{}); ok {
@@ -1413,8 +1627,8 @@ func HandleModelsRequest(c *gin.Context, apiKey string) {
 	logger.Info("成功返回模型列表")
 }
 
-// 处理流式响应
-func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey string, requestBody []byte) {
+// 处理流式响应，返回上游是否正常结束，中途中断时为false
+func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey string, requestBody []byte) bool {
 	logger.Info("开始处理流式响应")
 
 	// 创建缓冲读取器，增加缓冲区大小以处理大型响应
@@ -1427,15 +1641,17 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Streaming not supported",
 		})
-		return
+		return false
 	}
 
 	// 创建带超时的上下文，而不是使用无限期的background上下文
 	// 检查请求体中是否包含Deepseek R1模型
 	var isDeepseekR1 bool
 	var requestData map[string]interface{}
+	var requestModel string
 	if err := json.Unmarshal(requestBody, &requestData); err == nil {
 		if model, ok := requestData["model"].(string); ok {
+			requestModel = model
 			if strings.Contains(strings.ToLower(model), "deepseek") && strings.Contains(model, "r1") {
 				isDeepseekR1 = true
 				logger.Info("检测到Deepseek R1模型请求，启用特殊处理模式")
@@ -1453,6 +1669,12 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 		logger.Info("为普通模型流式响应设置10分钟超时")
 	}
 
+	// 两次数据之间的最长等待时间，可按模型配置
+	_, idleTimeout := config.GetStreamTimeouts(requestModel)
+
+	// 单个事件参与解析的最大大小，超出的事件原样转发
+	maxEventBytes := StreamMaxEventBytes()
+
 	// 使用带超时的上下文，确保有明确的超时控制
 	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
 	defer cancel()
@@ -1501,12 +1723,21 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 	// 连接已断开标志
 	var connectionClosed atomic.Bool
 
-	// 监听客户端连接关闭
+	// 上游是否正常结束：收到[DONE]事件或所有候选结果都收到了finish_reason
+	var upstreamFinished atomic.Bool
+	choiceCount, _ := requestChoiceCounts(requestBody)
+	choiceTracker := newStreamChoiceTracker(choiceCount)
+
+	// 监听客户端连接关闭，流式响应处理结束后退出
+	requestCtx := c.Request.Context()
 	go func() {
-		<-c.Request.Context().Done()
-		connectionClosed.Store(true)
-		cancel() // 取消我们的上下文
-		logger.Info("检测到客户端连接已关闭")
+		select {
+		case <-requestCtx.Done():
+			connectionClosed.Store(true)
+			cancel() // 取消我们的上下文
+			logger.Info("检测到客户端连接已关闭")
+		case <-ctx.Done():
+		}
 	}()
 
 	// 监听我们自己的上下文超时
@@ -1591,7 +1822,7 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 			select {
 			case <-ctx.Done():
 				if ctx.Err() == context.DeadlineExceeded {
-					errorChan <- fmt.Errorf("流式响应处理超时: %v", ctx.Err())
+					errorChan <- fmt.Errorf("流式响应处理超时: %w", ctx.Err())
 				} else {
 					errorChan <- ctx.Err()
 				}
@@ -1611,16 +1842,40 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 			}
 
 			// 使用带超时的上下文创建一个读取操作
-			readCtx, readCancel := context.WithTimeout(ctx, 5*time.Second)
+			readCtx, readCancel := context.WithTimeout(ctx, idleTimeout)
 
 			// 使用goroutine包装读取操作
 			go func() {
-				line, err := reader.ReadBytes('\n')
+				line, oversized, err := readSSELine(reader, maxEventBytes)
 				if err != nil {
 					readTimeoutChan <- err
 					return
 				}
 
+				// 超长事件不解析，先发送缓冲区中的数据，再将整行原样转发，不在内存中保留
+				if oversized {
+					eventCount++
+					recordStreamAnomaly(apiKey, true)
+					logger.Warn("事件#%d超过%d字节，不解析直接转发", eventCount, maxEventBytes)
+
+					var out io.Writer = io.Discard
+					if !connectionClosed.Load() {
+						out = c.Writer
+						if buffer.Len() > 0 {
+							c.Writer.Write(buffer.Bytes())
+							buffer.Reset()
+						}
+						c.Writer.Write(line)
+					}
+					err := relaySSELineRest(reader, out)
+					if !connectionClosed.Load() {
+						flusher.Flush()
+					}
+					lastFlushTime = time.Now()
+					readTimeoutChan <- err
+					return
+				}
+
 				// 处理接收到的行
 				if len(bytes.TrimSpace(line)) == 0 {
 					// 空行不处理
@@ -1635,8 +1890,27 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 					// 解析事件数据
 					data := bytes.TrimPrefix(line, []byte("data: "))
 
+					// 格式异常的事件原样转发，不参与转换和令牌估算
+					if !bytes.Equal(bytes.TrimSpace(data), []byte("[DONE]")) && isMalformedSSEData(data) {
+						recordStreamAnomaly(apiKey, false)
+						buffer.Write(bytes.TrimRight(line, "\r\n"))
+						buffer.WriteString("\n\n")
+						if !connectionClosed.Load() {
+							if _, writeErr := c.Writer.Write(buffer.Bytes()); writeErr != nil {
+								readTimeoutChan <- writeErr
+								return
+							}
+							buffer.Reset()
+							flusher.Flush()
+							lastFlushTime = time.Now()
+						}
+						readTimeoutChan <- nil
+						return
+					}
+
 					// 检查是否是[DONE]事件
 					if bytes.Equal(bytes.TrimSpace(data), []byte("[DONE]")) {
+						upstreamFinished.Store(true)
 						// 发送[DONE]事件
 						buffer.WriteString("data: [DONE]\n\n")
 						if !connectionClosed.Load() {
@@ -1661,6 +1935,11 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 					// 更新token估算
 					var jsonData map[string]interface{}
 					if err := json.Unmarshal(transformedData, &jsonData); err == nil {
+						// 记录是否收到了结束原因，请求多个候选结果时所有候选都结束才算正常结束
+						if choiceTracker.observe(jsonData) {
+							upstreamFinished.Store(true)
+						}
+
 						// 首先尝试从usage中获取total_tokens
 						if usage, ok := jsonData["usage"].(map[string]interface{}); ok {
 							if tt, ok := usage["total_tokens"].(float64); ok {
@@ -1674,64 +1953,65 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 							}
 						} else if choices, ok := jsonData["choices"].([]interface{}); ok && len(choices) > 0 {
 							// 如果没有usage字段，继续使用原来的估算方法
-							if choice, ok := choices[0].(map[string]interface{}); ok {
-								if delta, ok := choice["delta"].(map[string]interface{}); ok {
-									if content, ok := delta["content"].(string); ok {
-										// 简单估算：每个字符约为0.25个token
-										tokenEstimate := int(float64(len(content)) * 0.2)
-										if tokenEstimate == 0 && len(content) > 0 {
-											tokenEstimate = 1 // 确保至少有1个token
-										}
-										totalTokens += tokenEstimate
+							// 请求多个候选结果时一个事件可能包含多个choice，逐个估算
+							for _, item := range choices {
+								if choice, ok := item.(map[string]interface{}); ok {
+									if delta, ok := choice["delta"].(map[string]interface{}); ok {
+										if content, ok := delta["content"].(string); ok {
+											// 简单估算：每个字符约为0.25个token
+											tokenEstimate := int(float64(len(content)) * 0.2)
+											if tokenEstimate == 0 && len(content) > 0 {
+												tokenEstimate = 1 // 确保至少有1个token
+											}
+											totalTokens += tokenEstimate
 
-										// 每100个事件记录一次token统计情况
-										if eventCount%100 == 0 || eventCount <= 3 {
-											logger.Info("事件#%d: 内容长度=%d字符, 估计tokens=%d, 累计tokens=%d",
-												eventCount, len(content), tokenEstimate, totalTokens)
+											// 每100个事件记录一次token统计情况
+											if eventCount%100 == 0 || eventCount <= 3 {
+												logger.Info("事件#%d: 内容长度=%d字符, 估计tokens=%d, 累计tokens=%d",
+													eventCount, len(content), tokenEstimate, totalTokens)
+											}
+										} else {
+											// 如果无法提取content但delta不为空，尝试其他方式估算
+											deltaJSON, _ := json.Marshal(delta)
+											deltaStr := string(deltaJSON)
+											if len(deltaStr) > 0 {
+												// 记录无法直接提取content的情况
+												if eventCount <= 10 || eventCount%100 == 0 {
+													logger.Info("事件#%d: 无法提取content，delta=%s", eventCount, deltaStr)
+												}
+
+												// 仍然尝试估算token
+												tokenEstimate := int(float64(len(deltaStr)) * 0.1) // 对JSON格式的内容降低估算比例
+												if tokenEstimate == 0 && len(deltaStr) > 0 {
+													tokenEstimate = 1
+												}
+												totalTokens += tokenEstimate
+											}
 										}
 									} else {
-										// 如果无法提取content但delta不为空，尝试其他方式估算
-										deltaJSON, _ := json.Marshal(delta)
-										deltaStr := string(deltaJSON)
-										if len(deltaStr) > 0 {
-											// 记录无法直接提取content的情况
-											if eventCount <= 10 || eventCount%100 == 0 {
-												logger.Info("事件#%d: 无法提取content，delta=%s", eventCount, deltaStr)
-											}
+										// 如果无法提取delta但choice不为空，记录问题
+										if eventCount <= 10 || eventCount%100 == 0 {
+											choiceJSON, _ := json.Marshal(choice)
+											logger.Info("事件#%d: 无法提取delta，choice=%s", eventCount, string(choiceJSON))
+										}
 
-											// 仍然尝试估算token
-											tokenEstimate := int(float64(len(deltaStr)) * 0.1) // 对JSON格式的内容降低估算比例
-											if tokenEstimate == 0 && len(deltaStr) > 0 {
-												tokenEstimate = 1
-											}
-											totalTokens += tokenEstimate
+										// 确保每个事件至少计算一些token
+										if eventCount%5 == 0 { // 每5个事件增加1个token（保守估计）
+											totalTokens += 1
 										}
 									}
 								} else {
-									// 如果无法提取delta但choice不为空，记录问题
+									// 如果无法正确解析choice，记录问题
 									if eventCount <= 10 || eventCount%100 == 0 {
-										choiceJSON, _ := json.Marshal(choice)
-										logger.Info("事件#%d: 无法提取delta，choice=%s", eventCount, string(choiceJSON))
+										choiceData, _ := json.Marshal(item)
+										logger.Info("事件#%d: choice格式异常，原始数据=%s", eventCount, string(choiceData))
 									}
 
-									// 确保每个事件至少计算一些token
-									if eventCount%5 == 0 { // 每5个事件增加1个token（保守估计）
+									// 确保计数不为零
+									if eventCount%5 == 0 {
 										totalTokens += 1
 									}
 								}
-							} else {
-								// 如果无法正确解析choice，记录问题
-								if eventCount <= 10 || eventCount%100 == 0 {
-									if len(choices) > 0 {
-										choiceData, _ := json.Marshal(choices[0])
-										logger.Info("事件#%d: choice格式异常，原始数据=%s", eventCount, string(choiceData))
-									}
-								}
-
-								// 确保计数不为零
-								if eventCount%5 == 0 {
-									totalTokens += 1
-								}
 							}
 						} else {
 							// 如果无法提取choices，尝试直接从原始数据估算
@@ -1809,7 +2089,10 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 						lastFlushTime = time.Now()
 					}
 				} else {
-					// 处理其他SSE事件(注释等)
+					// 处理其他SSE事件(注释等)，不是SSE字段的行原样转发并计入格式异常
+					if !isKnownSSEField(line) {
+						recordStreamAnomaly(apiKey, false)
+					}
 					buffer.Write(line)
 					buffer.WriteString("\n")
 
@@ -1839,10 +2122,7 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 
 					// 对于Deepseek R1，特殊处理超时和上下文取消
 					if isDeepseekR1 {
-						if err == context.Canceled ||
-							strings.Contains(err.Error(), "context canceled") ||
-							strings.Contains(err.Error(), "deadline exceeded") ||
-							strings.Contains(err.Error(), "timeout") {
+						if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || isTimeoutError(err) {
 							// 记录为信息而不是错误
 							logger.Info("Deepseek R1读取超时或取消，继续处理: %v", err)
 							// 发送一个空的delta事件保持连接活跃
@@ -1879,7 +2159,7 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 					continue
 				} else {
 					// 非Deepseek模型，读取超时视为错误
-					errorChan <- fmt.Errorf("读取操作超时: %v", readCtx.Err())
+					errorChan <- fmt.Errorf("读取操作超时: %w", readCtx.Err())
 					return
 				}
 			case <-ctx.Done():
@@ -1899,7 +2179,7 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 				}
 
 				if ctx.Err() == context.DeadlineExceeded {
-					errorChan <- fmt.Errorf("流式响应处理总时间超出限制: %v", ctx.Err())
+					errorChan <- fmt.Errorf("流式响应处理总时间超出限制: %w", ctx.Err())
 				} else {
 					errorChan <- ctx.Err()
 				}
@@ -1919,7 +2199,7 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 	case <-ctx.Done():
 		// 上下文取消
 		if ctx.Err() == context.DeadlineExceeded {
-			err = fmt.Errorf("流式响应处理超时: %v", ctx.Err())
+			err = fmt.Errorf("流式响应处理超时: %w", ctx.Err())
 		} else {
 			err = ctx.Err()
 		}
@@ -1931,12 +2211,24 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 		flusher.Flush()
 	}
 
+	// 检查上游是否在未发送结束标记的情况下中断
+	upstreamAborted := isUpstreamAborted(err, upstreamFinished.Load(), connectionClosed.Load())
+
 	// 处理错误信息
-	if err == nil || err == io.EOF {
+	if upstreamAborted {
+		logger.Error("上游流式响应异常中断: 已处理 %d 个事件, 错误: %v", eventCount, err)
+
+		// 向客户端发送带有错误信息的最终事件，然后正常结束流
+		if !connectionClosed.Load() {
+			c.Writer.Write(buildUpstreamAbortedEvent(requestData, err))
+			c.Writer.Write([]byte("data: [DONE]\n\n"))
+			flusher.Flush()
+		}
+	} else if err == nil || err == io.EOF {
 		logger.Info("流式响应正常完成")
-	} else if err == context.Canceled || connectionClosed.Load() {
+	} else if errors.Is(err, context.Canceled) || connectionClosed.Load() {
 		logger.Info("客户端取消了连接")
-	} else if strings.Contains(err.Error(), "deadline exceeded") {
+	} else if errors.Is(err, context.DeadlineExceeded) {
 		if isDeepseekR1 {
 			// 对于Deepseek R1，超时结束也视为正常
 			logger.Info("Deepseek R1流式响应由于超时而结束: %v", err)
@@ -1995,15 +2287,25 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 	promptTokensCount := totalTokens / 3                     // 估计输入占1/3
 	completionTokensCount := totalTokens - promptTokensCount // 估计输出占2/3
 
-	// 添加到每日统计
-	config.AddDailyRequestStat(apiKey, modelNameForStats, 1, promptTokensCount, completionTokensCount, true)
+	// 添加到每日统计，上游中断的请求记为失败
+	config.AddDailyRequestStat(apiKey, modelNameForStats, 1, promptTokensCount, completionTokensCount, !upstreamAborted)
+	config.AddDailyClientStat(middleware.ClientIdentity(c), 1, promptTokensCount, completionTokensCount)
+	if upstreamAborted {
+		config.AddDailyUpstreamAborted()
+		// 上游中断计入密钥的失败记录
+		key.UpdateApiKeyStatus(apiKey, false)
+		key.RecordFailureSource(apiKey, middleware.ClientIdentity(c), key.CategoryServerError)
+		finishDecision(c, string(key.CategoryServerError))
+	} else {
+		recordClientSuccess(c, apiKey)
+	}
 
 	logger.Info("流式响应完成，总tokens=%d (prompt=%d, completion=%d)，处理了 %d 个事件",
 		totalTokens, promptTokensCount, completionTokensCount, eventCount)
 
 	// 确保响应已经完成并标记为结束
 	// 检查是否已经发送了[DONE]事件，如果没有，发送一个
-	if !bytes.Contains(buffer.Bytes(), []byte("data: [DONE]")) && !connectionClosed.Load() {
+	if !upstreamAborted && !bytes.Contains(buffer.Bytes(), []byte("data: [DONE]")) && !connectionClosed.Load() {
 		// 发送最终的[DONE]事件
 		logger.Info("发送最终的[DONE]事件以确保客户端知道流已结束")
 		c.Writer.Write([]byte("data: [DONE]\n\n"))
@@ -2013,6 +2315,67 @@ func HandleStreamResponse(c *gin.Context, responseBody io.ReadCloser, apiKey str
 	// 设置响应完成标志，防止后续请求误判为403
 	// 注意：这里由于客户端可能在流式响应完成后自动发送结束请求，需要确保这个请求不会被错误处理
 	c.Set("stream_completed", true)
+	return !upstreamAborted
+}
+
+// isUpstreamAborted 判断流式响应是否因上游连接中断而异常结束
+// 客户端主动断开和超时不视为上游中断
+func isUpstreamAborted(err error, upstreamFinished bool, connectionClosed bool) bool {
+	if upstreamFinished || connectionClosed {
+		return false
+	}
+	if err == nil || err == io.EOF {
+		// 读到EOF但没有收到结束标记，说明上游提前关闭了连接
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return true
+}
+
+// isTimeoutError 判断错误是否为网络读写超时
+func isTimeoutError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// buildUpstreamAbortedEvent 构建上游中断时发送给客户端的最终SSE事件
+// 事件包含finish_reason为error的choice和OpenAI SDK能够识别的error字段
+func buildUpstreamAbortedEvent(requestData map[string]interface{}, cause error) []byte {
+	modelName := "unknown"
+	if requestData != nil {
+		if model, ok := requestData["model"].(string); ok && model != "" {
+			modelName = model
+		}
+	}
+
+	message := "上游服务连接中断，响应内容不完整"
+	if cause != nil && cause != io.EOF {
+		message = fmt.Sprintf("%s: %v", message, cause)
+	}
+
+	event := map[string]interface{}{
+		"id":      fmt.Sprintf("chatcmpl-aborted-%d", time.Now().UnixNano()),
+		"object":  "chat.completion.chunk",
+		"created": time.Now().Unix(),
+		"model":   modelName,
+		"choices": []map[string]interface{}{
+			{
+				"index":         0,
+				"delta":         map[string]interface{}{},
+				"finish_reason": "error",
+			},
+		},
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    "upstream_error",
+			"code":    "upstream_aborted",
+		},
+	}
+
+	data, _ := json.Marshal(event)
+	return []byte("data: " + string(data) + "\n\n")
 }
 
 // extractModelName 从请求和响应中提取模型名称
@@ -2114,6 +2477,13 @@ func forwardUserInfoRequest(c *gin.Context, targetURL string) {
 
 	// 设置 Authorization header
 	utils.SetCommonHeaders(req, apiKey)
+	// 按密钥所属的服务商附加请求头和签名，请求体已经完成所有改写
+	if err := signing.ApplyProviderHeaders(req, apiKey, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to sign request: %v", err),
+		})
+		return
+	}
 
 	// 创建 HTTP 客户端
 	client := utils.CreateClient()
@@ -2122,7 +2492,7 @@ func forwardUserInfoRequest(c *gin.Context, targetURL string) {
 	resp, err := client.Do(req)
 	if err != nil {
 		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
+		key.RecordRequestError(apiKey, err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("Failed to send request: %v", err),
 		})
@@ -2150,8 +2520,8 @@ func forwardUserInfoRequest(c *gin.Context, targetURL string) {
 
 	// 如果请求失败，返回错误
 	if !success {
-		// 更新密钥失败记录
-		key.UpdateApiKeyStatus(apiKey, false)
+		// 更新密钥失败记录，客户端原因的错误不计入密钥失败
+		recordResponseOutcome(c, apiKey, resp.StatusCode, respBody)
 		c.JSON(resp.StatusCode, gin.H{
 			"error": fmt.Sprintf("API请求失败，状态码: %d", resp.StatusCode),
 		})
@@ -2160,6 +2530,7 @@ func forwardUserInfoRequest(c *gin.Context, targetURL string) {
 
 	// 更新密钥状态
 	key.UpdateApiKeyStatus(apiKey, success)
+	recordClientSuccess(c, apiKey)
 
 	// 复制响应 headers
 	for name, values := range resp.Header {
@@ -0,0 +1,339 @@
+/**
+  @author: Hanhai
+  @desc: 图片托管，把图片生成响应中的base64图片保存到数据目录，并改写为FlowSilicon提供的图片地址，避免响应超过部分客户端的消息大小限制
+**/
+
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// HostedImagePathPrefix 托管图片的访问路径前缀，后面是图片ID
+	HostedImagePathPrefix = "/v1/files/images/"
+	// 未设置时托管图片的保留时间（分钟）
+	defaultImageHostingTTLMinutes = 60
+	// 未设置时托管图片占用的最大磁盘空间（MB）
+	defaultImageHostingQuotaMB = 512
+	// 清理过期图片的间隔
+	imageCleanupInterval = 5 * time.Minute
+)
+
+// 图片ID为32位十六进制随机数，检查ID格式避免通过路径访问其他文件
+var hostedImageIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+var (
+	hostedImageDir   string
+	hostedImageMutex sync.Mutex // 保存、清理和淘汰图片时加锁，保证磁盘占用的计算不被并发写入打乱
+	imageCleanupOnce sync.Once
+)
+
+// hostedImageFile 数据目录中的一个托管图片文件
+type hostedImageFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// SetHostedImageDir 设置托管图片所在的目录，并启动清理过期图片的后台协程
+// 清理协程在启动时就运行，上次运行时保存的图片即使之后没有新的图片生成请求也会按保留时间删除
+func SetHostedImageDir(dir string) {
+	hostedImageMutex.Lock()
+	hostedImageDir = dir
+	hostedImageMutex.Unlock()
+
+	imageCleanupOnce.Do(func() {
+		go runHostedImageCleanup()
+	})
+}
+
+// imageHostingSettings 获取图片托管是否生效、图片的保留时间和磁盘配额
+// 隐私模式下不在本地保存生成的图片
+func imageHostingSettings() (bool, time.Duration, int64) {
+	ttlMinutes, quotaMB := defaultImageHostingTTLMinutes, defaultImageHostingQuotaMB
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return false, 0, 0
+	}
+	if cfg.App.ImageHostingTTLMinutes > 0 {
+		ttlMinutes = cfg.App.ImageHostingTTLMinutes
+	}
+	if cfg.App.ImageHostingQuotaMB > 0 {
+		quotaMB = cfg.App.ImageHostingQuotaMB
+	}
+	enabled := cfg.App.ImageHosting && !cfg.App.PrivacyMode
+	return enabled, time.Duration(ttlMinutes) * time.Minute, int64(quotaMB) * 1024 * 1024
+}
+
+// hostImagesInResponse 图片托管生效时把图片生成响应中的base64图片保存到本地，并改写为图片地址
+// 保存失败的图片保留原来的base64内容，响应无法解析时原样返回
+func hostImagesInResponse(c *gin.Context, path string, body []byte) []byte {
+	if !strings.Contains(path, "/images/generations") {
+		return body
+	}
+	enabled, _, _ := imageHostingSettings()
+	if !enabled {
+		return body
+	}
+
+	var responseData map[string]interface{}
+	if err := json.Unmarshal(body, &responseData); err != nil {
+		return body
+	}
+
+	baseURL := getPublicBaseURL(c)
+	rewritten := 0
+	// OpenAI格式使用data字段，硅基流动格式使用images字段
+	for _, field := range []string{"data", "images"} {
+		items, ok := responseData[field].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range items {
+			image, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			encoded, ok := image["b64_json"].(string)
+			if !ok || encoded == "" {
+				continue
+			}
+
+			id, err := storeHostedImage(encoded)
+			if err != nil {
+				logger.Error("保存托管图片失败: %v", err)
+				continue
+			}
+			image["url"] = baseURL + HostedImagePathPrefix + id
+			delete(image, "b64_json")
+			rewritten++
+		}
+	}
+	if rewritten == 0 {
+		return body
+	}
+
+	rewrittenBody, err := json.Marshal(responseData)
+	if err != nil {
+		logger.Error("序列化改写后的图片生成响应失败: %v", err)
+		return body
+	}
+	logger.Info("已将 %d 张base64图片改写为托管图片地址", rewritten)
+	return rewrittenBody
+}
+
+// getPublicBaseURL 获取客户端访问FlowSilicon的地址，未设置时按请求的协议和主机生成
+func getPublicBaseURL(c *gin.Context) string {
+	if cfg := config.GetConfig(); cfg != nil && cfg.App.PublicBaseURL != "" {
+		return strings.TrimRight(cfg.App.PublicBaseURL, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// storeHostedImage 解码base64图片并保存到托管目录，返回图片ID，保存前按磁盘配额删除最早的图片
+func storeHostedImage(encoded string) (string, error) {
+	// 部分上游返回带data URI前缀的内容
+	if strings.HasPrefix(encoded, "data:") {
+		if idx := strings.Index(encoded, ","); idx >= 0 {
+			encoded = encoded[idx+1:]
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("解码base64图片失败: %w", err)
+	}
+
+	_, _, quota := imageHostingSettings()
+	if int64(len(data)) > quota {
+		return "", fmt.Errorf("图片大小 %d 字节超过托管图片的磁盘配额", len(data))
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", fmt.Errorf("生成图片ID失败: %w", err)
+	}
+	id := hex.EncodeToString(idBytes)
+
+	hostedImageMutex.Lock()
+	defer hostedImageMutex.Unlock()
+
+	if hostedImageDir == "" {
+		return "", fmt.Errorf("未设置托管图片目录")
+	}
+	if err := os.MkdirAll(hostedImageDir, 0700); err != nil {
+		return "", fmt.Errorf("创建托管图片目录失败: %w", err)
+	}
+
+	evictHostedImagesLocked(quota - int64(len(data)))
+
+	// 图片只通过HandleHostedImage访问，文件只允许当前用户读写
+	path := filepath.Join(hostedImageDir, id+imageExtension(data))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("写入托管图片失败: %w", err)
+	}
+	return id, nil
+}
+
+// imageExtension 按图片内容获取文件扩展名，访问时按扩展名返回Content-Type
+func imageExtension(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".png"
+	}
+}
+
+// listHostedImagesLocked 列出托管目录中的图片，按修改时间从早到晚排序（已加锁）
+func listHostedImagesLocked() []hostedImageFile {
+	entries, err := os.ReadDir(hostedImageDir)
+	if err != nil {
+		return nil
+	}
+	files := make([]hostedImageFile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, hostedImageFile{
+			path:    filepath.Join(hostedImageDir, entry.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	return files
+}
+
+// evictHostedImagesLocked 从最早的图片开始删除，直到已有图片的总大小不超过limit（已加锁）
+func evictHostedImagesLocked(limit int64) {
+	files := listHostedImagesLocked()
+	var total int64
+	for _, file := range files {
+		total += file.size
+	}
+	for _, file := range files {
+		if total <= limit {
+			return
+		}
+		if err := os.Remove(file.path); err != nil {
+			logger.Error("删除托管图片 %s 失败: %v", file.path, err)
+			continue
+		}
+		total -= file.size
+		logger.Info("托管图片超过磁盘配额，已删除最早的图片 %s", filepath.Base(file.path))
+	}
+}
+
+// cleanExpiredHostedImages 删除超过保留时间的托管图片
+func cleanExpiredHostedImages() {
+	_, ttl, _ := imageHostingSettings()
+	if ttl <= 0 {
+		ttl = defaultImageHostingTTLMinutes * time.Minute
+	}
+
+	hostedImageMutex.Lock()
+	defer hostedImageMutex.Unlock()
+
+	expireBefore := time.Now().Add(-ttl)
+	for _, file := range listHostedImagesLocked() {
+		if !file.modTime.Before(expireBefore) {
+			// 按修改时间排序，之后的图片都未过期
+			return
+		}
+		if err := os.Remove(file.path); err != nil {
+			logger.Error("删除过期的托管图片 %s 失败: %v", file.path, err)
+		}
+	}
+}
+
+// runHostedImageCleanup 启动时删除一次过期的托管图片，之后定期删除
+func runHostedImageCleanup() {
+	cleanExpiredHostedImages()
+	ticker := time.NewTicker(imageCleanupInterval)
+	defer ticker.Stop()
+	cleanup := config.ScheduledJob("hosted_image_cleanup", imageCleanupInterval, cleanExpiredHostedImages)
+	for range ticker.C {
+		cleanup()
+	}
+}
+
+// findHostedImage 按图片ID查找未过期的托管图片文件
+func findHostedImage(id string) (string, bool) {
+	if !hostedImageIDPattern.MatchString(id) {
+		return "", false
+	}
+	_, ttl, _ := imageHostingSettings()
+	if ttl <= 0 {
+		ttl = defaultImageHostingTTLMinutes * time.Minute
+	}
+
+	hostedImageMutex.Lock()
+	defer hostedImageMutex.Unlock()
+
+	if hostedImageDir == "" {
+		return "", false
+	}
+	matches, err := filepath.Glob(filepath.Join(hostedImageDir, id+".*"))
+	if err != nil || len(matches) == 0 {
+		return "", false
+	}
+	info, err := os.Stat(matches[0])
+	if err != nil {
+		return "", false
+	}
+	// 清理任务还没有删除的过期图片也不再返回
+	if time.Since(info.ModTime()) > ttl {
+		os.Remove(matches[0])
+		return "", false
+	}
+	return matches[0], true
+}
+
+// HandleHostedImage 返回托管的图片，图片ID由随机数生成，访问时不需要访问令牌
+func HandleHostedImage(c *gin.Context, id string) {
+	path, ok := findHostedImage(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": map[string]interface{}{
+				"message": "图片不存在或已过期",
+				"type":    "invalid_request_error",
+				"code":    http.StatusNotFound,
+			},
+		})
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.File(path)
+}
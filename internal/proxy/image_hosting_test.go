@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"flowsilicon/internal/config"
+)
+
+// setupImageHosting 开启图片托管并使用临时目录，返回托管目录
+func setupImageHosting(t *testing.T) string {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.App.ImageHosting = true
+	config.UpdateConfig(cfg)
+	t.Cleanup(func() { config.UpdateConfig(&config.Config{}) })
+
+	dir := filepath.Join(t.TempDir(), "images")
+	imageCleanupOnce = sync.Once{}
+	SetHostedImageDir(dir)
+	t.Cleanup(func() { SetHostedImageDir("") })
+	return dir
+}
+
+func TestStoreHostedImagePermissions(t *testing.T) {
+	dir := setupImageHosting(t)
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+	id, err := storeHostedImage(base64.StdEncoding.EncodeToString(png))
+	if err != nil {
+		t.Fatalf("storeHostedImage: %v", err)
+	}
+
+	path, ok := findHostedImage(id)
+	if !ok {
+		t.Fatalf("findHostedImage(%s) not found", id)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("image file mode = %o, want 600", perm)
+	}
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := dirInfo.Mode().Perm(); perm != 0700 {
+		t.Errorf("image dir mode = %o, want 700", perm)
+	}
+}
+
+// 上次运行时保存的过期图片在设置目录后就被清理，不需要等到下一次保存图片
+func TestHostedImageCleanupStartsWithDir(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.ImageHosting = true
+	cfg.App.ImageHostingTTLMinutes = 10
+	config.UpdateConfig(cfg)
+	t.Cleanup(func() { config.UpdateConfig(&config.Config{}) })
+
+	dir := t.TempDir()
+	expired := filepath.Join(dir, "0123456789abcdef0123456789abcdef.png")
+	fresh := filepath.Join(dir, "fedcba9876543210fedcba9876543210.png")
+	for _, path := range []string{expired, fresh} {
+		if err := os.WriteFile(path, []byte("image"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(expired, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	imageCleanupOnce = sync.Once{}
+	SetHostedImageDir(dir)
+	t.Cleanup(func() { SetHostedImageDir("") })
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(expired); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired image was not removed after SetHostedImageDir")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("fresh image removed: %v", err)
+	}
+}
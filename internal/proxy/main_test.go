@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 日志只写入文件，不影响测试输出
+// 在所有测试开始前设置一次，测试中重复设置会与上一个测试留下的后台协程并发读写
+// 模型数据库同样只打开一次，请求成功后会在后台更新模型调用次数，测试中重新打开会与其竞争
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	logger.SetGuiMode(true)
+
+	dir, err := os.MkdirTemp("", "proxy-test")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "创建临时目录失败: %v\n", err)
+		os.Exit(1)
+	}
+	if err := model.InitModelDB(filepath.Join(dir, "config.db")); err != nil {
+		fmt.Fprintf(os.Stderr, "InitModelDB 失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	model.CloseModelDB()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
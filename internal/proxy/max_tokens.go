@@ -0,0 +1,93 @@
+/**
+  @author: Hanhai
+  @desc: 输出令牌数保护，按模型配置为未设置max_tokens的请求注入默认值，并截断超过模型上限的max_tokens
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/model"
+	"strconv"
+)
+
+// ClampedHeader 请求参数被截断时添加的响应头
+const ClampedHeader = "X-FS-Clamped"
+
+// 客户端可能用来设置最大输出令牌数的字段，按优先级排列
+var maxTokensFields = []string{"max_tokens", "max_completion_tokens"}
+
+// applyMaxTokensGuard 按模型覆盖配置处理请求体中的max_tokens
+// 返回处理后的请求体，以及max_tokens是否被截断；未开启覆盖或无需修改时原样返回
+func applyMaxTokensGuard(body []byte, modelName string) ([]byte, bool) {
+	if modelName == "" || len(body) == 0 {
+		return body, false
+	}
+
+	override, ok := config.GetModelOverride(modelName)
+	if !ok || (!override.InjectDefaultMaxTokens && !override.ClampMaxTokens) {
+		return body, false
+	}
+
+	defaultMaxTokens, maxOutputTokens, err := model.GetModelTokenLimits(modelName)
+	if err != nil {
+		logger.Error("获取模型 %s 的输出令牌数限制失败: %v", modelName, err)
+		return body, false
+	}
+
+	// 使用UseNumber避免大整数和其他数字字段在重新序列化时丢失精度
+	var requestData map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&requestData); err != nil {
+		return body, false
+	}
+
+	field := ""
+	var requested int64
+	for _, name := range maxTokensFields {
+		value, exists := requestData[name]
+		if !exists || value == nil {
+			continue
+		}
+		field = name
+		if number, ok := value.(json.Number); ok {
+			requested, _ = strconv.ParseInt(number.String(), 10, 64)
+		}
+		break
+	}
+
+	changed := false
+	clamped := false
+	switch {
+	case field == "":
+		if override.InjectDefaultMaxTokens && defaultMaxTokens > 0 {
+			injected := defaultMaxTokens
+			if override.ClampMaxTokens && maxOutputTokens > 0 && injected > maxOutputTokens {
+				injected = maxOutputTokens
+			}
+			requestData["max_tokens"] = injected
+			changed = true
+			logger.Info("请求未设置max_tokens，为模型 %s 注入默认值 %d", modelName, injected)
+		}
+	case override.ClampMaxTokens && maxOutputTokens > 0 && requested > int64(maxOutputTokens):
+		requestData[field] = maxOutputTokens
+		changed = true
+		clamped = true
+		logger.Info("模型 %s 请求的%s为 %d，超过最大输出令牌数，已截断为 %d", modelName, field, requested, maxOutputTokens)
+	}
+
+	if !changed {
+		return body, false
+	}
+
+	newBody, err := json.Marshal(requestData)
+	if err != nil {
+		logger.Error("序列化处理max_tokens后的请求体失败: %v", err)
+		return body, false
+	}
+	return newBody, clamped
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 流式和非流式请求按模型覆盖配置注入默认max_tokens、截断超过上限的max_tokens，未配置的模型原样透传
+func TestMaxTokensGuard(t *testing.T) {
+	if _, err := model.SaveModels([]string{"guarded-model", "plain-model"}); err != nil {
+		t.Fatalf("SaveModels 失败: %v", err)
+	}
+	for _, id := range []string{"guarded-model", "plain-model"} {
+		if err := model.UpdateModelTokenLimits(id, 1024, 4096); err != nil {
+			t.Fatalf("UpdateModelTokenLimits 失败: %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	var forwarded map[string]json.RawMessage
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var data map[string]json.RawMessage
+		json.Unmarshal(body, &data)
+		mu.Lock()
+		forwarded = data
+		mu.Unlock()
+
+		if string(data["stream"]) == "true" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"id\":\"chatcmpl-guard\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"chatcmpl-guard","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{}
+	cfg.App.ModelOverrides = map[string]config.ModelOverride{
+		"guarded-model": {InjectDefaultMaxTokens: true, ClampMaxTokens: true},
+	}
+	config.UpdateConfig(cfg)
+	config.SetUpstreamOverride(upstream.URL)
+	config.ReplaceApiKeys([]config.ApiKey{{ID: 1, Key: "sk-max-tokens", Balance: 10}})
+	t.Cleanup(func() {
+		config.SetUpstreamOverride("")
+		config.ReplaceApiKeys(nil)
+		config.UpdateConfig(&config.Config{})
+	})
+
+	// 与服务器相同的路由，处理函数按path参数分析请求
+	router := gin.New()
+	router.Any("/v1/*path", HandleOpenAIProxy)
+
+	tests := []struct {
+		name        string
+		model       string
+		params      string // 追加到请求体中的max_tokens参数
+		wantField   string
+		wantValue   string // 为空表示上游收到的请求中没有该字段
+		wantClamped bool
+	}{
+		{name: "未设置时注入默认值", model: "guarded-model", wantField: "max_tokens", wantValue: "1024"},
+		{name: "超过上限时截断", model: "guarded-model", params: `,"max_tokens":100000`, wantField: "max_tokens", wantValue: "4096", wantClamped: true},
+		{name: "max_completion_tokens超过上限时截断", model: "guarded-model", params: `,"max_completion_tokens":100000`, wantField: "max_completion_tokens", wantValue: "4096", wantClamped: true},
+		{name: "未超过上限时不修改", model: "guarded-model", params: `,"max_tokens":2000`, wantField: "max_tokens", wantValue: "2000"},
+		{name: "未配置覆盖的模型不注入", model: "plain-model", wantField: "max_tokens"},
+		{name: "未配置覆盖的模型不截断", model: "plain-model", params: `,"max_tokens":100000`, wantField: "max_tokens", wantValue: "100000"},
+	}
+
+	for _, stream := range []bool{false, true} {
+		for _, tt := range tests {
+			name := tt.name
+			if stream {
+				name = "流式/" + name
+			}
+			t.Run(name, func(t *testing.T) {
+				body := `{"model":"` + tt.model + `","messages":[{"role":"user","content":"hello"}]` + tt.params
+				if stream {
+					body += `,"stream":true`
+				}
+				body += "}"
+
+				req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+				}
+				mu.Lock()
+				got, exists := forwarded[tt.wantField]
+				mu.Unlock()
+				if tt.wantValue == "" {
+					if exists {
+						t.Errorf("forwarded %s = %s, want it absent", tt.wantField, got)
+					}
+				} else if string(got) != tt.wantValue {
+					t.Errorf("forwarded %s = %s, want %s", tt.wantField, got, tt.wantValue)
+				}
+
+				header := w.Header().Get(ClampedHeader)
+				if tt.wantClamped && header != "max_tokens" {
+					t.Errorf("%s = %q, want max_tokens", ClampedHeader, header)
+				}
+				if !tt.wantClamped && header != "" {
+					t.Errorf("%s = %q, want no header", ClampedHeader, header)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/**
+  @author: Hanhai
+  @desc: 虚拟模型，按配置的模型映射将虚拟模型名称替换为上游模型，并将虚拟模型合并到模型列表中
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+)
+
+// virtualModelOwner 虚拟模型在模型列表中的所属方
+const virtualModelOwner = "flowsilicon"
+
+// resolveModelAlias 将请求体中的虚拟模型名称替换为映射的上游模型，未命中映射时返回原请求体
+func resolveModelAlias(bodyBytes []byte) []byte {
+	cfg := config.GetConfig()
+	if cfg == nil || len(cfg.App.ModelMappings) == 0 {
+		return bodyBytes
+	}
+
+	// 使用UseNumber避免seed等大整数字段在重新序列化时丢失精度
+	var requestData map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(bodyBytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&requestData); err != nil {
+		return bodyBytes
+	}
+
+	model, ok := requestData["model"].(string)
+	if !ok {
+		return bodyBytes
+	}
+	target, mapped := cfg.App.ModelMappings[model]
+	if !mapped || target == "" || target == model {
+		return bodyBytes
+	}
+
+	requestData["model"] = target
+	newBody, err := json.Marshal(requestData)
+	if err != nil {
+		logger.Error("替换虚拟模型 %s 失败: %v", model, err)
+		return bodyBytes
+	}
+
+	logger.Info("虚拟模型 %s 映射到上游模型 %s", model, target)
+	return newBody
+}
+
+// mergeVirtualModels 将映射到已有上游模型的虚拟模型追加到模型列表
+// 开启隐藏上游模型时，移除被映射的上游模型；与上游模型同名的虚拟模型不重复添加
+func mergeVirtualModels(models []interface{}) []interface{} {
+	cfg := config.GetConfig()
+	if cfg == nil || len(cfg.App.ModelMappings) == 0 {
+		return models
+	}
+
+	upstreamIDs := make(map[string]bool, len(models))
+	for _, model := range models {
+		if modelObj, ok := model.(map[string]interface{}); ok {
+			if modelID, ok := modelObj["id"].(string); ok {
+				upstreamIDs[modelID] = true
+			}
+		}
+	}
+
+	aliases := make([]string, 0, len(cfg.App.ModelMappings))
+	for alias := range cfg.App.ModelMappings {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	hidden := make(map[string]bool)
+	var virtualModels []interface{}
+	for _, alias := range aliases {
+		target := cfg.App.ModelMappings[alias]
+		if !upstreamIDs[target] {
+			logger.Debug("虚拟模型 %s 映射的上游模型 %s 不在模型列表中，跳过", alias, target)
+			continue
+		}
+		hidden[target] = true
+		if upstreamIDs[alias] {
+			continue
+		}
+		virtualModels = append(virtualModels, map[string]interface{}{
+			"id":       alias,
+			"object":   "model",
+			"owned_by": virtualModelOwner,
+		})
+	}
+
+	merged := make([]interface{}, 0, len(models)+len(virtualModels))
+	for _, model := range models {
+		if cfg.App.HideUpstreamModels {
+			if modelObj, ok := model.(map[string]interface{}); ok {
+				if modelID, ok := modelObj["id"].(string); ok && hidden[modelID] {
+					// 与虚拟模型同名的上游模型代表该虚拟模型，保留在列表中
+					if _, isAlias := cfg.App.ModelMappings[modelID]; !isAlias {
+						continue
+					}
+				}
+			}
+		}
+		merged = append(merged, model)
+	}
+	return append(merged, virtualModels...)
+}
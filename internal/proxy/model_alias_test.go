@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"flowsilicon/internal/config"
+)
+
+func TestResolveModelAlias(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.ModelMappings = map[string]string{"fast": "Qwen/Qwen2.5-7B-Instruct"}
+	config.UpdateConfig(cfg)
+	t.Cleanup(func() { config.UpdateConfig(&config.Config{}) })
+
+	tests := []struct {
+		name      string
+		body      string
+		wantModel string
+		unchanged bool
+	}{
+		{
+			name:      "虚拟模型替换为上游模型",
+			body:      `{"model":"fast","messages":[]}`,
+			wantModel: "Qwen/Qwen2.5-7B-Instruct",
+		},
+		{
+			name:      "未命中映射时返回原请求体",
+			body:      `{"model":"other","seed":9007199254740993}`,
+			unchanged: true,
+		},
+		{
+			name:      "请求体不是JSON时返回原请求体",
+			body:      `not json`,
+			unchanged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveModelAlias([]byte(tt.body))
+			if tt.unchanged {
+				if string(got) != tt.body {
+					t.Fatalf("body = %s, want unchanged", got)
+				}
+				return
+			}
+			var data map[string]interface{}
+			if err := json.Unmarshal(got, &data); err != nil {
+				t.Fatal(err)
+			}
+			if data["model"] != tt.wantModel {
+				t.Errorf("model = %v, want %s", data["model"], tt.wantModel)
+			}
+		})
+	}
+}
+
+// 替换模型名称时其他数字字段保持原值，大于2^53的整数不丢失精度
+func TestResolveModelAliasKeepsNumbers(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.ModelMappings = map[string]string{"fast": "Qwen/Qwen2.5-7B-Instruct"}
+	config.UpdateConfig(cfg)
+	t.Cleanup(func() { config.UpdateConfig(&config.Config{}) })
+
+	got := resolveModelAlias([]byte(`{"model":"fast","seed":9007199254740993,"temperature":0.1,"max_tokens":1024}`))
+	for _, want := range []string{`"seed":9007199254740993`, `"temperature":0.1`, `"max_tokens":1024`, `"model":"Qwen/Qwen2.5-7B-Instruct"`} {
+		if !bytes.Contains(got, []byte(want)) {
+			t.Errorf("body = %s, want it to contain %s", got, want)
+		}
+	}
+}
+
+func TestMergeVirtualModels(t *testing.T) {
+	upstream := func() []interface{} {
+		return []interface{}{
+			map[string]interface{}{"id": "Qwen/Qwen2.5-7B-Instruct", "object": "model"},
+			map[string]interface{}{"id": "deepseek-ai/DeepSeek-V3", "object": "model"},
+		}
+	}
+	mappings := map[string]string{
+		"fast":    "Qwen/Qwen2.5-7B-Instruct",
+		"missing": "not/in-list",
+	}
+
+	tests := []struct {
+		name    string
+		hide    bool
+		wantIDs []string
+	}{
+		{
+			name:    "追加映射到已有上游模型的虚拟模型",
+			wantIDs: []string{"Qwen/Qwen2.5-7B-Instruct", "deepseek-ai/DeepSeek-V3", "fast"},
+		},
+		{
+			name:    "隐藏被映射的上游模型",
+			hide:    true,
+			wantIDs: []string{"deepseek-ai/DeepSeek-V3", "fast"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.ModelMappings = mappings
+			cfg.App.HideUpstreamModels = tt.hide
+			config.UpdateConfig(cfg)
+			t.Cleanup(func() { config.UpdateConfig(&config.Config{}) })
+
+			merged := mergeVirtualModels(upstream())
+			var ids []string
+			for _, model := range merged {
+				modelObj := model.(map[string]interface{})
+				ids = append(ids, modelObj["id"].(string))
+				if modelObj["id"] == "fast" && modelObj["owned_by"] != virtualModelOwner {
+					t.Errorf("virtual model owned_by = %v, want %s", modelObj["owned_by"], virtualModelOwner)
+				}
+			}
+			if len(ids) != len(tt.wantIDs) {
+				t.Fatalf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantIDs[i] {
+					t.Fatalf("ids = %v, want %v", ids, tt.wantIDs)
+				}
+			}
+		})
+	}
+}
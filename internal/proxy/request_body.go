@@ -0,0 +1,34 @@
+/**
+  @author: Hanhai
+  @desc: 代理请求体的缓存，请求体只读取一次，换密钥重试和检查请求内容时都使用缓存的副本
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CachedBodyContextKey 缓存的原始请求体
+// 由web包的请求体缓存中间件写入，proxy包不能导入web包，所以在这里定义
+const CachedBodyContextKey = "cached_request_body"
+
+// getRequestBody 获取本次请求的原始请求体，没有经过缓存中间件时读取请求体并缓存
+func getRequestBody(c *gin.Context) ([]byte, error) {
+	if cached, ok := c.Get(CachedBodyContextKey); ok {
+		if body, ok := cached.([]byte); ok {
+			return body, nil
+		}
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Set(CachedBodyContextKey, body)
+	return body, nil
+}
@@ -0,0 +1,34 @@
+/**
+  @author: Hanhai
+  @desc: 限流响应的Retry-After，密钥在本地达到RPM/TPM上限时按窗口剩余时间设置，否则沿用上游返回的值
+**/
+
+package proxy
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"flowsilicon/internal/key"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setRetryAfterHeader 为429响应设置Retry-After（秒），其他状态码不处理
+func setRetryAfterHeader(c *gin.Context, apiKey string, statusCode int, upstreamHeader http.Header) {
+	if statusCode != http.StatusTooManyRequests {
+		return
+	}
+
+	if k, ok := key.GetKeyPool().Find(apiKey); ok {
+		if limited, wait := key.IsKeyRateLimited(k.ID); limited && wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return
+		}
+	}
+
+	if retryAfter := upstreamHeader.Get("Retry-After"); retryAfter != "" {
+		c.Header("Retry-After", retryAfter)
+	}
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"flowsilicon/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upstreamAttempt 模拟上游收到的一次请求
+type upstreamAttempt struct {
+	apiKey string
+	body   string
+}
+
+// 带seed的请求在第一个密钥上失败后换密钥重试，第二个密钥收到的请求体与第一次完全相同
+func TestRetryPreservesSeed(t *testing.T) {
+	var mu sync.Mutex
+	var attempts []upstreamAttempt
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		attempts = append(attempts, upstreamAttempt{apiKey: strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), body: string(body)})
+		first := len(attempts) == 1
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if first {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"message":"upstream unavailable"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"chatcmpl-seed","object":"chat.completion","model":"test-model","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+	}))
+	defer upstream.Close()
+
+	config.UpdateConfig(&config.Config{})
+	config.SetUpstreamOverride(upstream.URL)
+	config.ReplaceApiKeys([]config.ApiKey{
+		{ID: 1, Key: "sk-seed-key-1", Balance: 10},
+		{ID: 2, Key: "sk-seed-key-2", Balance: 10},
+	})
+	t.Cleanup(func() {
+		config.SetUpstreamOverride("")
+		config.ReplaceApiKeys(nil)
+		config.UpdateConfig(&config.Config{})
+	})
+
+	// 超过2^53的seed，按float64解析会丢失精度
+	const seed = "9007199254740993"
+	body := `{"model":"test-model","seed":` + seed + `,"temperature":0.7,"messages":[{"role":"user","content":"hello"}]}`
+
+	// 与服务器相同的路由，处理函数按path参数分析请求
+	router := gin.New()
+	router.Any("/v1/*path", HandleOpenAIProxy)
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != 2 {
+		t.Fatalf("upstream received %d requests, want 2", len(attempts))
+	}
+	if attempts[0].apiKey == attempts[1].apiKey {
+		t.Errorf("retry used the same key %s", attempts[0].apiKey)
+	}
+	if attempts[0].body != attempts[1].body {
+		t.Errorf("retry body differs:\nfirst:  %s\nsecond: %s", attempts[0].body, attempts[1].body)
+	}
+	var forwarded map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(attempts[1].body), &forwarded); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(forwarded["seed"]); got != seed {
+		t.Errorf("forwarded seed = %s, want %s", got, seed)
+	}
+}
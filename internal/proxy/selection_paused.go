@@ -0,0 +1,32 @@
+/**
+  @author: Hanhai
+  @desc: 密钥选择暂停期间拒绝代理请求，返回503让客户端稍后重试
+**/
+
+package proxy
+
+import (
+	"flowsilicon/internal/key"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 密钥选择暂停时建议客户端等待的秒数
+const selectionPausedRetryAfter = "30"
+
+// rejectIfSelectionPaused 密钥选择已暂停时返回503并返回true
+func rejectIfSelectionPaused(c *gin.Context) bool {
+	if !key.IsKeySelectionPaused() {
+		return false
+	}
+	c.Header("Retry-After", selectionPausedRetryAfter)
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": map[string]interface{}{
+			"message": key.ErrSelectionPaused.Error(),
+			"type":    "service_unavailable",
+			"code":    http.StatusServiceUnavailable,
+		},
+	})
+	return true
+}
@@ -0,0 +1,227 @@
+/**
+  @author: Hanhai
+  @desc: 影子流量镜像，按规则抽样部分对话请求，在主响应完成后异步发送到候选模型，不影响返回给用户的响应
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/middleware"
+	"flowsilicon/internal/signing"
+	"flowsilicon/pkg/utils"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计存储时每个请求体和响应最多保存的字节数
+const maxShadowContentBytes = 1 << 20
+
+// shadowCaptureWriter 在写入主响应的同时保存响应内容，用于审计存储
+type shadowCaptureWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+// Write 写入响应并保存副本
+func (w *shadowCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString 写入字符串响应并保存副本
+func (w *shadowCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// capture 保存响应内容，超过上限的部分丢弃
+func (w *shadowCaptureWriter) capture(data []byte) {
+	remaining := maxShadowContentBytes - w.buf.Len()
+	if remaining <= 0 {
+		return
+	}
+	if len(data) > remaining {
+		data = data[:remaining]
+	}
+	w.buf.Write(data)
+}
+
+// shadowMirror 一次被抽中的影子流量
+type shadowMirror struct {
+	rule      config.ShadowRule
+	requestID string
+	start     time.Time
+	capture   *shadowCaptureWriter
+}
+
+// prepareShadowMirror 按影子流量规则抽样对话请求，未抽中或今日预算已用完时返回nil
+// 开启审计存储时替换c.Writer以保存主响应内容
+func prepareShadowMirror(c *gin.Context, requestPath string, modelName string) *shadowMirror {
+	if !strings.Contains(requestPath, "/chat/completions") {
+		return nil
+	}
+
+	rule, ok := config.GetShadowRule(modelName)
+	if !ok || rand.Float64()*100 >= rule.Percentage {
+		return nil
+	}
+	if config.GetDailyMirroredCount() >= config.GetShadowDailyBudget() {
+		return nil
+	}
+
+	mirror := &shadowMirror{
+		rule:      rule,
+		requestID: middleware.RequestID(c),
+		start:     time.Now(),
+	}
+	if config.IsShadowContentStored() {
+		mirror.capture = &shadowCaptureWriter{ResponseWriter: c.Writer}
+		c.Writer = mirror.capture
+	}
+	return mirror
+}
+
+// dispatch 主响应完成后异步发送镜像请求，只镜像成功的请求
+func (m *shadowMirror) dispatch(c *gin.Context, targetURL string, body []byte, success bool) {
+	if m == nil || !success {
+		return
+	}
+
+	record := config.ShadowRecord{
+		RequestID:        m.requestID,
+		Model:            m.rule.Model,
+		ShadowModel:      m.rule.ShadowModel,
+		PrimaryStatus:    c.Writer.Status(),
+		PrimaryLatencyMs: time.Since(m.start).Milliseconds(),
+		PrimaryBytes:     c.Writer.Size(),
+	}
+	if m.capture != nil {
+		record.RequestBody = truncateShadowContent(body)
+		record.PrimaryResponse = m.capture.buf.String()
+	}
+
+	// 在发送前计入每日预算，并发请求也不会超过预算
+	if !config.TryReserveDailyMirrored(config.GetShadowDailyBudget()) {
+		logger.Info("今日影子流量预算已用完，跳过镜像请求: %s", m.requestID)
+		return
+	}
+
+	go sendShadowRequest(targetURL, body, m.rule, record)
+}
+
+// sendShadowRequest 将请求发送到候选模型并保存两个响应的记录
+// 镜像请求不更新密钥状态和常规请求统计
+func sendShadowRequest(targetURL string, body []byte, rule config.ShadowRule, record config.ShadowRecord) {
+	shadowBody, err := buildShadowRequestBody(body, rule.ShadowModel)
+	if err != nil {
+		record.ShadowError = err.Error()
+		saveShadowRecord(record)
+		return
+	}
+
+	apiKey, err := selectShadowKey(rule)
+	if err != nil {
+		record.ShadowError = fmt.Sprintf("选择影子流量密钥失败: %v", err)
+		saveShadowRecord(record)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, targetURL, bytes.NewReader(shadowBody))
+	if err != nil {
+		record.ShadowError = fmt.Sprintf("创建影子流量请求失败: %v", err)
+		saveShadowRecord(record)
+		return
+	}
+	utils.SetCommonHeaders(req, apiKey)
+	if err := signing.ApplyProviderHeaders(req, apiKey, shadowBody); err != nil {
+		record.ShadowError = err.Error()
+		saveShadowRecord(record)
+		return
+	}
+
+	start := time.Now()
+	resp, err := utils.CreateClient().Do(req)
+	if err != nil {
+		record.ShadowLatencyMs = time.Since(start).Milliseconds()
+		record.ShadowError = fmt.Sprintf("发送影子流量请求失败: %v", err)
+		saveShadowRecord(record)
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	record.ShadowLatencyMs = time.Since(start).Milliseconds()
+	record.ShadowStatus = resp.StatusCode
+	record.ShadowBytes = len(respBody)
+	if err != nil {
+		record.ShadowError = fmt.Sprintf("读取影子流量响应失败: %v", err)
+	}
+
+	record.ShadowPromptTokens, record.ShadowCompletionTokens = extractTokenCounts(respBody)
+	config.AddDailyMirroredTokens(record.ShadowPromptTokens + record.ShadowCompletionTokens)
+
+	if config.IsShadowContentStored() {
+		record.ShadowResponse = truncateShadowContent(respBody)
+	}
+
+	logger.Info("影子流量请求完成: 请求ID=%s, 模型=%s -> %s, 状态=%d, 主请求耗时=%dms, 镜像耗时=%dms",
+		record.RequestID, record.Model, record.ShadowModel, record.ShadowStatus,
+		record.PrimaryLatencyMs, record.ShadowLatencyMs)
+	saveShadowRecord(record)
+}
+
+// buildShadowRequestBody 替换请求中的模型，并改为非流式请求以便记录完整响应
+func buildShadowRequestBody(body []byte, shadowModel string) ([]byte, error) {
+	var requestData map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&requestData); err != nil {
+		return nil, fmt.Errorf("解析影子流量请求体失败: %w", err)
+	}
+
+	requestData["model"] = shadowModel
+	delete(requestData, "stream")
+	delete(requestData, "stream_options")
+
+	return json.Marshal(requestData)
+}
+
+// selectShadowKey 按规则选择镜像请求使用的密钥：指定密钥、指定分组或默认的轮询选择
+func selectShadowKey(rule config.ShadowRule) (string, error) {
+	if rule.Key != "" {
+		return rule.Key, nil
+	}
+	if rule.Group != "" {
+		return key.GetKeyFromGroup(rule.Group)
+	}
+	return key.GetOptimalApiKeyWithRoundRobin()
+}
+
+// saveShadowRecord 保存影子流量记录，失败时只记录日志
+func saveShadowRecord(record config.ShadowRecord) {
+	if record.ShadowError != "" {
+		logger.Warn("影子流量请求 %s 失败: %s", record.RequestID, record.ShadowError)
+	}
+	if err := config.SaveShadowRecord(record); err != nil {
+		logger.Error("保存影子流量记录失败: %v", err)
+	}
+}
+
+// truncateShadowContent 截断超过审计存储上限的内容
+func truncateShadowContent(data []byte) string {
+	if len(data) > maxShadowContentBytes {
+		data = data[:maxShadowContentBytes]
+	}
+	return string(data)
+}
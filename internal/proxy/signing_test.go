@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/mockupstream"
+	"flowsilicon/internal/model"
+	"flowsilicon/internal/signing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 签名内容包含请求方法和路径，上游用同一模板验证
+const proxySigningCanonical = "{method}\n{path}\n{timestamp}\n{body_sha256}"
+
+// 经过模型映射和max_tokens注入改写后的请求按实际发送的请求体签名，流式和非流式请求都能通过上游的签名验证，签名密钥错误时上游返回401
+func TestProxySignsRewrittenRequest(t *testing.T) {
+	if _, err := model.SaveModels([]string{"upstream-model"}); err != nil {
+		t.Fatalf("SaveModels 失败: %v", err)
+	}
+	if err := model.UpdateModelTokenLimits("upstream-model", 1024, 4096); err != nil {
+		t.Fatalf("UpdateModelTokenLimits 失败: %v", err)
+	}
+
+	upstream := mockupstream.NewServer()
+	upstream.SetSigning(mockupstream.SigningConfig{Secret: "upstream-secret", Canonical: proxySigningCanonical})
+	ts := httptest.NewServer(upstream.Handler())
+	defer ts.Close()
+
+	config.SetUpstreamOverride(ts.URL)
+	t.Cleanup(func() {
+		config.SetUpstreamOverride("")
+		config.ReplaceApiKeys(nil)
+		config.UpdateConfig(&config.Config{})
+	})
+
+	// 与服务器相同的路由，处理函数按path参数分析请求
+	router := gin.New()
+	router.Any("/v1/*path", HandleOpenAIProxy)
+
+	tests := []struct {
+		name       string
+		secret     string
+		wantStatus int
+	}{
+		{name: "签名密钥正确", secret: "upstream-secret", wantStatus: http.StatusOK},
+		{name: "签名密钥错误", secret: "wrong-secret", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, stream := range []bool{false, true} {
+		for _, tt := range tests {
+			name := tt.name
+			if stream {
+				name = "流式/" + name
+			}
+			t.Run(name, func(t *testing.T) {
+				cfg := &config.Config{}
+				cfg.App.MaxConsecutiveFailures = 5
+				cfg.App.ModelMappings = map[string]string{"fast": "upstream-model"}
+				cfg.App.ModelOverrides = map[string]config.ModelOverride{
+					"upstream-model": {InjectDefaultMaxTokens: true},
+				}
+				cfg.Providers = []config.ProviderRequestConfig{{
+					Provider: config.DefaultKeyProvider,
+					Signing: config.RequestSigningConfig{
+						Type:      signing.TypeHMACSHA256,
+						Secret:    tt.secret,
+						Canonical: proxySigningCanonical,
+					},
+				}}
+				config.UpdateConfig(cfg)
+				config.ReplaceApiKeys([]config.ApiKey{{ID: 1, Key: "sk-signing-key", Balance: 10}})
+
+				body := `{"model":"fast","messages":[{"role":"user","content":"hello"}]`
+				if stream {
+					body += `,"stream":true`
+				}
+				body += "}"
+				req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				if w.Code != tt.wantStatus {
+					t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+				}
+				if tt.wantStatus != http.StatusOK {
+					if !strings.Contains(w.Body.String(), "invalid request signature") {
+						t.Errorf("response = %s, want the upstream signature error", w.Body.String())
+					}
+					return
+				}
+				// 模拟上游在回答中带上收到的模型名称，说明签名的是映射后的请求体
+				if !strings.Contains(w.Body.String(), "[mock:upstream-model]") {
+					t.Errorf("response = %s, want the mapped model upstream-model", w.Body.String())
+				}
+			})
+		}
+	}
+}
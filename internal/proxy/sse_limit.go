@@ -0,0 +1,146 @@
+/**
+  @author: Hanhai
+  @desc: 流式事件的大小限制和异常统计，超长事件和格式异常的事件原样转发不解析，并按密钥统计出现次数
+**/
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+)
+
+// DefaultStreamMaxEventBytes 未配置时单个流式事件参与解析的最大字节数
+const DefaultStreamMaxEventBytes = 4 << 20
+
+// StreamAnomalyStats 一个密钥的流式事件异常统计
+type StreamAnomalyStats struct {
+	KeyID     int    `json:"key_id"`
+	Key       string `json:"key"`       // 遮盖后的密钥
+	Oversized int    `json:"oversized"` // 超过大小限制的事件数
+	Malformed int    `json:"malformed"` // 格式异常的事件数
+	LastSeen  int64  `json:"last_seen"` // 最近一次出现异常的时间（Unix秒）
+}
+
+var (
+	// 按密钥记录的流式事件异常，程序重启后清零
+	streamAnomalies     = make(map[string]*StreamAnomalyStats)
+	streamAnomaliesLock sync.Mutex
+)
+
+// StreamMaxEventBytes 获取单个流式事件参与解析的最大字节数
+func StreamMaxEventBytes() int {
+	if cfg := config.GetConfig(); cfg != nil && cfg.App.StreamMaxEventKB > 0 {
+		return cfg.App.StreamMaxEventKB * 1024
+	}
+	return DefaultStreamMaxEventBytes
+}
+
+// readSSELine 读取一行流式数据，超过limit时返回已读取的部分和true，该行的剩余部分留在reader中
+// 返回的部分最多比limit多一个reader缓冲区的大小
+func readSSELine(reader *bufio.Reader, limit int) ([]byte, bool, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			if len(line) > limit {
+				return line, true, nil
+			}
+			continue
+		}
+		return line, false, err
+	}
+}
+
+// relaySSELineRest 将超长行的剩余部分原样写入w，不在内存中保留
+func relaySSELineRest(reader *bufio.Reader, w io.Writer) error {
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(chunk) > 0 {
+			if _, writeErr := w.Write(chunk); writeErr != nil {
+				return writeErr
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return err
+	}
+}
+
+// isMalformedSSEData 检查data行的内容是否无法按JSON解析，包括行中间出现的多余回车
+func isMalformedSSEData(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return bytes.IndexByte(data, '\r') >= 0 || !json.Valid(data)
+}
+
+// isKnownSSEField 检查不以data开头的行是否是SSE注释或其他字段
+func isKnownSSEField(line []byte) bool {
+	return bytes.HasPrefix(line, []byte(":")) ||
+		bytes.HasPrefix(line, []byte("data:")) ||
+		bytes.HasPrefix(line, []byte("event:")) ||
+		bytes.HasPrefix(line, []byte("id:")) ||
+		bytes.HasPrefix(line, []byte("retry:"))
+}
+
+// recordStreamAnomaly 记录一次超长或格式异常的流式事件
+func recordStreamAnomaly(apiKey string, oversized bool) {
+	if apiKey == "" {
+		return
+	}
+
+	streamAnomaliesLock.Lock()
+	defer streamAnomaliesLock.Unlock()
+
+	stats, exists := streamAnomalies[apiKey]
+	if !exists {
+		stats = &StreamAnomalyStats{Key: config.MaskKey(apiKey)}
+		streamAnomalies[apiKey] = stats
+	}
+	if oversized {
+		stats.Oversized++
+	} else {
+		stats.Malformed++
+	}
+	stats.LastSeen = time.Now().Unix()
+}
+
+// GetStreamAnomalies 获取各密钥的流式事件异常统计，按异常总数降序排列
+func GetStreamAnomalies() []StreamAnomalyStats {
+	streamAnomaliesLock.Lock()
+	result := make([]StreamAnomalyStats, 0, len(streamAnomalies))
+	keys := make([]string, 0, len(streamAnomalies))
+	for apiKey, stats := range streamAnomalies {
+		result = append(result, *stats)
+		keys = append(keys, apiKey)
+	}
+	streamAnomaliesLock.Unlock()
+
+	// 密钥ID在输出时查询，密钥被删除后为0
+	ids := make(map[string]int)
+	for _, k := range key.GetKeyPool().Keys() {
+		ids[k.Key] = k.ID
+	}
+	for i := range result {
+		result[i].KeyID = ids[keys[i]]
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		ti := result[i].Oversized + result[i].Malformed
+		tj := result[j].Oversized + result[j].Malformed
+		if ti != tj {
+			return ti > tj
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// relayAll 按流式转发的方式逐行读取：超长行写入已读取的部分后原样转发剩余部分，返回转发的内容和每次读取的最大长度
+func relayAll(t *testing.T, input []byte, bufferSize, limit int) ([]byte, int, int) {
+	t.Helper()
+	reader := bufio.NewReaderSize(bytes.NewReader(input), bufferSize)
+	var out bytes.Buffer
+	longest, oversized := 0, 0
+	for {
+		line, tooLong, err := readSSELine(reader, limit)
+		if len(line) > longest {
+			longest = len(line)
+		}
+		out.Write(line)
+		if tooLong {
+			oversized++
+			if err := relaySSELineRest(reader, &out); err != nil && err != io.EOF {
+				t.Fatalf("relaySSELineRest: %v", err)
+			}
+			continue
+		}
+		if err == io.EOF {
+			return out.Bytes(), longest, oversized
+		}
+		if err != nil {
+			t.Fatalf("readSSELine: %v", err)
+		}
+	}
+}
+
+func TestReadSSELineLimit(t *testing.T) {
+	huge := "data: " + strings.Repeat("x", 10000) + "\n"
+	input := []byte("data: {\"a\":1}\n\n" + huge + "data: [DONE]\n\n")
+
+	out, longest, oversized := relayAll(t, input, 64, 256)
+	if !bytes.Equal(out, input) {
+		t.Fatal("relayed output differs from the input")
+	}
+	if oversized != 1 {
+		t.Errorf("oversized lines = %d, want 1", oversized)
+	}
+	// 超长行只在内存中保留不超过limit加一个缓冲区的部分
+	if longest > 256+64 {
+		t.Errorf("longest buffered line = %d bytes, want at most %d", longest, 256+64)
+	}
+}
+
+func TestIsMalformedSSEData(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{`{"choices":[]}`, false},
+		{" {\"choices\":[]}\r", false},
+		{`[DONE]`, true},
+		{`{"choices":`, true},
+		{"{\"a\":\r1}", true},
+		{``, true},
+	}
+	for _, tt := range tests {
+		if got := isMalformedSSEData([]byte(tt.data)); got != tt.want {
+			t.Errorf("isMalformedSSEData(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+// 任意输入按行读取并转发后与原始输入完全相同，读取的单行长度有上限，解析函数不会出错
+func FuzzSSERelay(f *testing.F) {
+	f.Add([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n"), 32)
+	f.Add([]byte("data: {\"a\":\r1}\r\n\r\n: comment\nevent: x\n"), 16)
+	f.Add([]byte("garbage without newline"), 1)
+	f.Add([]byte(strings.Repeat("data: "+strings.Repeat("y", 100), 3)), 8)
+	f.Add([]byte("\n\n\n\x00\xff\xfe"), 0)
+
+	f.Fuzz(func(t *testing.T, input []byte, limit int) {
+		if limit < 0 {
+			limit = -limit
+		}
+		limit %= 1024
+		const bufferSize = 16
+
+		out, longest, _ := relayAll(t, input, bufferSize, limit)
+		if !bytes.Equal(out, input) {
+			t.Fatalf("relayed output differs from the input")
+		}
+		if longest > limit+bufferSize && longest > bufferSize {
+			t.Fatalf("buffered %d bytes for one line, limit %d", longest, limit)
+		}
+
+		for _, line := range bytes.Split(input, []byte("\n")) {
+			isKnownSSEField(line)
+			data := bytes.TrimPrefix(line, []byte("data:"))
+			if !isMalformedSSEData(data) {
+				if _, err := TransformStreamEvent(bytes.TrimSpace(data)); err != nil {
+					t.Fatalf("TransformStreamEvent(%q): %v", data, err)
+				}
+			}
+		}
+	})
+}
+
+func TestRecordStreamAnomaly(t *testing.T) {
+	streamAnomaliesLock.Lock()
+	streamAnomalies = make(map[string]*StreamAnomalyStats)
+	streamAnomaliesLock.Unlock()
+	t.Cleanup(func() {
+		streamAnomaliesLock.Lock()
+		streamAnomalies = make(map[string]*StreamAnomalyStats)
+		streamAnomaliesLock.Unlock()
+	})
+
+	recordStreamAnomaly("sk-anomaly-a", true)
+	recordStreamAnomaly("sk-anomaly-a", false)
+	recordStreamAnomaly("sk-anomaly-a", false)
+	recordStreamAnomaly("sk-anomaly-b", true)
+	recordStreamAnomaly("", true)
+
+	stats := GetStreamAnomalies()
+	if len(stats) != 2 {
+		t.Fatalf("len(stats) = %d, want 2", len(stats))
+	}
+	if stats[0].Oversized != 1 || stats[0].Malformed != 2 || stats[1].Oversized != 1 || stats[1].Malformed != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if strings.Contains(stats[0].Key, "sk-anomaly-a") {
+		t.Errorf("stats expose the full key: %s", stats[0].Key)
+	}
+}
@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"flowsilicon/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	abortChunk  = "data: {\"id\":\"chatcmpl-abort\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"part\"},\"finish_reason\":null}]}\n\n"
+	finishChunk = "data: {\"id\":\"chatcmpl-abort\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"
+)
+
+// todayUpstreamAborted 获取今天的上游中断次数
+func todayUpstreamAborted(t *testing.T) int {
+	t.Helper()
+	stats, err := config.GetDailyStats("")
+	if err != nil {
+		t.Fatalf("GetDailyStats 失败: %v", err)
+	}
+	if stats == nil {
+		return 0
+	}
+	return stats.Requests.UpstreamAborted
+}
+
+// lastStreamEvent 获取响应中[DONE]之前的最后一个data事件
+func lastStreamEvent(body string) map[string]interface{} {
+	var last map[string]interface{}
+	for _, line := range strings.Split(body, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var event map[string]interface{}
+		if json.Unmarshal([]byte(data), &event) == nil {
+			last = event
+		}
+	}
+	return last
+}
+
+// 上游在事件中途断开或未发送结束标记就关闭连接时，以finish_reason为error的事件结束响应，并计入上游中断和密钥失败
+func TestStreamUpstreamAborted(t *testing.T) {
+	tests := []struct {
+		name        string
+		upstream    func(w http.ResponseWriter)
+		wantAborted bool
+	}{
+		{
+			name: "事件中途断开",
+			upstream: func(w http.ResponseWriter) {
+				w.Write([]byte(abortChunk))
+				w.Write([]byte("data: {\"id\":\"chatcmpl-abort\",\"choi"))
+				w.(http.Flusher).Flush()
+				// 不结束分块编码直接断开连接
+				panic(http.ErrAbortHandler)
+			},
+			wantAborted: true,
+		},
+		{
+			name: "没有结束标记就关闭连接",
+			upstream: func(w http.ResponseWriter) {
+				w.Write([]byte(abortChunk))
+				w.Write([]byte(abortChunk))
+			},
+			wantAborted: true,
+		},
+		{
+			name: "正常结束",
+			upstream: func(w http.ResponseWriter) {
+				w.Write([]byte(abortChunk))
+				w.Write([]byte(finishChunk))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				tt.upstream(w)
+			}))
+			defer upstream.Close()
+
+			cfg := &config.Config{}
+			cfg.App.MaxConsecutiveFailures = 5
+			config.UpdateConfig(cfg)
+			config.SetUpstreamOverride(upstream.URL)
+			config.ReplaceApiKeys([]config.ApiKey{{ID: 1, Key: "sk-abort-key", Balance: 10}})
+			t.Cleanup(func() {
+				config.SetUpstreamOverride("")
+				config.ReplaceApiKeys(nil)
+				config.UpdateConfig(&config.Config{})
+			})
+
+			// 与服务器相同的路由，处理函数按path参数分析请求
+			router := gin.New()
+			router.Any("/v1/*path", HandleOpenAIProxy)
+			body := `{"model":"test-model","stream":true,"messages":[{"role":"user","content":"hello"}]}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			abortedBefore := todayUpstreamAborted(t)
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+			if !strings.HasSuffix(w.Body.String(), "data: [DONE]\n\n") {
+				t.Errorf("response does not end with [DONE]: %q", w.Body.String())
+			}
+
+			event := lastStreamEvent(w.Body.String())
+			choices, _ := event["choices"].([]interface{})
+			if len(choices) != 1 {
+				t.Fatalf("last event = %v, want one choice", event)
+			}
+			finishReason := choices[0].(map[string]interface{})["finish_reason"]
+			var errorCode interface{}
+			if errorField, ok := event["error"].(map[string]interface{}); ok {
+				errorCode = errorField["code"]
+			}
+			if tt.wantAborted {
+				if finishReason != "error" || errorCode != "upstream_aborted" {
+					t.Errorf("last event finish_reason = %v, error code = %v, want error and upstream_aborted", finishReason, errorCode)
+				}
+			} else if finishReason != "stop" || errorCode != nil {
+				t.Errorf("last event finish_reason = %v, error code = %v, want stop and no error", finishReason, errorCode)
+			}
+
+			wantAbortedCount, wantFailures := 0, 0
+			if tt.wantAborted {
+				wantAbortedCount, wantFailures = 1, 1
+			}
+			if got := todayUpstreamAborted(t) - abortedBefore; got != wantAbortedCount {
+				t.Errorf("upstream_aborted increased by %d, want %d", got, wantAbortedCount)
+			}
+			apiKey, _ := config.GetApiKeyByID(1)
+			if apiKey.ConsecutiveFailures != wantFailures {
+				t.Errorf("ConsecutiveFailures = %d, want %d", apiKey.ConsecutiveFailures, wantFailures)
+			}
+			if tt.wantAborted && apiKey.TotalCalls != 1 {
+				t.Errorf("TotalCalls = %d, want the aborted request counted", apiKey.TotalCalls)
+			}
+		})
+	}
+}
+
+// 客户端断开和超时不视为上游中断，包装后的上下文错误也能识别
+func TestIsUpstreamAborted(t *testing.T) {
+	tests := []struct {
+		name             string
+		err              error
+		upstreamFinished bool
+		connectionClosed bool
+		want             bool
+	}{
+		{name: "没有结束标记就读到EOF", err: io.EOF, want: true},
+		{name: "连接错误", err: io.ErrUnexpectedEOF, want: true},
+		{name: "已收到结束标记", err: io.ErrUnexpectedEOF, upstreamFinished: true},
+		{name: "客户端已断开", err: io.ErrUnexpectedEOF, connectionClosed: true},
+		{name: "客户端取消", err: context.Canceled},
+		{name: "包装后的读取超时", err: fmt.Errorf("读取操作超时: %w", context.DeadlineExceeded)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUpstreamAborted(tt.err, tt.upstreamFinished, tt.connectionClosed); got != tt.want {
+				t.Errorf("isUpstreamAborted(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
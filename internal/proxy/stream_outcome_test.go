@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"flowsilicon/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// proxyCounterFor 获取模型在代理请求计数器中的请求数和失败数
+func proxyCounterFor(modelName string) (requests, failures uint64) {
+	for _, sample := range config.GetProxyCounters() {
+		if sample.Model == modelName {
+			requests += sample.Requests
+			failures += sample.Failures
+		}
+	}
+	return requests, failures
+}
+
+// 流式请求按实际结果计入代理请求计数器：上游返回错误、中途中断或没有可用密钥时记为失败
+func TestStreamOutcomeRecorded(t *testing.T) {
+	tests := []struct {
+		name        string
+		upstream    func(w http.ResponseWriter)
+		noKeys      bool
+		wantFailure bool
+	}{
+		{
+			name: "正常结束",
+			upstream: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Write([]byte(abortChunk))
+				w.Write([]byte(finishChunk))
+			},
+		},
+		{
+			name: "中途中断",
+			upstream: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Write([]byte(abortChunk))
+			},
+			wantFailure: true,
+		},
+		{
+			name: "上游返回错误状态码",
+			upstream: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"message":"invalid request"}`))
+			},
+			wantFailure: true,
+		},
+		{
+			name:        "没有可用密钥",
+			noKeys:      true,
+			wantFailure: true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.upstream(w)
+			}))
+			defer upstream.Close()
+
+			cfg := &config.Config{}
+			cfg.App.MaxConsecutiveFailures = 5
+			config.UpdateConfig(cfg)
+			config.SetUpstreamOverride(upstream.URL)
+			if !tt.noKeys {
+				config.ReplaceApiKeys([]config.ApiKey{{ID: 1, Key: "sk-outcome-key", Balance: 10}})
+			}
+			t.Cleanup(func() {
+				config.SetUpstreamOverride("")
+				config.ReplaceApiKeys(nil)
+				config.UpdateConfig(&config.Config{})
+			})
+
+			// 每个用例使用不同的模型名，计数器按模型区分
+			modelName := "outcome-model-" + string(rune('a'+i))
+			router := gin.New()
+			router.Any("/v1/*path", HandleOpenAIProxy)
+			body := `{"model":"` + modelName + `","stream":true,"messages":[{"role":"user","content":"hello"}]}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			// 计数器在进程内累计，按本次请求前后的差值判断
+			requestsBefore, failuresBefore := proxyCounterFor(modelName)
+			router.ServeHTTP(httptest.NewRecorder(), req)
+			requests, failures := proxyCounterFor(modelName)
+			requests, failures = requests-requestsBefore, failures-failuresBefore
+			wantFailures := uint64(0)
+			if tt.wantFailure {
+				wantFailures = 1
+			}
+			if requests != 1 || failures != wantFailures {
+				t.Errorf("proxy counters = %d requests, %d failures, want 1 request, %d failures", requests, failures, wantFailures)
+			}
+		})
+	}
+}
@@ -34,15 +34,19 @@ func isReasonModel(modelName string) bool {
 }
 
 // TransformRequestBody 转换请求体，处理OpenAI和硅基流动API之间的差异
+// 数字字段按原样保留，避免seed等大整数在转换时丢失精度，
+// 转换后的请求体在重试时原样复用，保证seed相同的请求在不同密钥上得到可复现的输出
 func TransformRequestBody(body []byte, path string) ([]byte, error) {
 	// 如果请求体为空，直接返回
 	if len(body) == 0 {
 		return body, nil
 	}
 
-	// 解析JSON
+	// 解析JSON，使用json.Number保留数字的原始精度
 	var requestData map[string]interface{}
-	if err := json.Unmarshal(body, &requestData); err != nil {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&requestData); err != nil {
 		return nil, err
 	}
 
@@ -72,7 +76,7 @@ func TransformRequestBody(body []byte, path string) ([]byte, error) {
 					// 如果未设置max_tokens，设置默认值16000
 					requestData["max_tokens"] = 16000
 					logger.Info("为推理模型%s自动设置max_tokens=16000", model)
-				} else if maxTokenValue, ok := maxTokens.(float64); ok && maxTokenValue < 1000 {
+				} else if maxTokenValue, ok := numberValue(maxTokens); ok && maxTokenValue < 1000 {
 					// 如果设置了但值太小，调整到更合理的值
 					requestData["max_tokens"] = 16000
 					logger.Info("推理模型%s检测到过小的max_tokens值(%v)，自动调整为16000", model, maxTokenValue)
@@ -112,7 +116,7 @@ func TransformRequestBody(body []byte, path string) ([]byte, error) {
 					// 如果未设置max_tokens，设置默认值16000
 					requestData["max_tokens"] = 16000
 					logger.Info("为推理模型%s自动设置max_tokens=16000", model)
-				} else if maxTokenValue, ok := maxTokens.(float64); ok && maxTokenValue < 1000 {
+				} else if maxTokenValue, ok := numberValue(maxTokens); ok && maxTokenValue < 1000 {
 					// 如果设置了但值太小，调整到更合理的值
 					requestData["max_tokens"] = 16000
 					logger.Info("推理模型%s检测到过小的max_tokens值(%v)，自动调整为16000", model, maxTokenValue)
@@ -270,6 +274,19 @@ func TransformRequestBody(body []byte, path string) ([]byte, error) {
 	return json.Marshal(requestData)
 }
 
+// numberValue 将请求中解析出的数字字段转换为float64
+func numberValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
 // TransformResponseBody 转换响应体，处理硅基流动API和OpenAI之间的差异
 func TransformResponseBody(body []byte, path string) ([]byte, error) {
 	// 如果响应体为空，直接返回
@@ -659,37 +676,32 @@ func TransformStreamEvent(data []byte) ([]byte, error) {
 					return data, nil
 				}
 
-				// 获取首个choice
-				choice, ok := choices[0].(map[string]interface{})
-				if !ok {
-					return data, nil
-				}
+				// 请求多个候选结果时一个事件可能包含多个choice，逐个处理
+				modified := false
+				for _, item := range choices {
+					choice, ok := item.(map[string]interface{})
+					if !ok {
+						continue
+					}
 
-				// 确保delta存在
-				if delta, hasDelta := choice["delta"].(map[string]interface{}); hasDelta {
-					// 确保content存在，即使是空字符串
-					if _, hasContent := delta["content"]; !hasContent {
-						delta["content"] = ""
-						choice["delta"] = delta
-						choices[0] = choice
-						eventData["choices"] = choices
-
-						// 重新编码修改后的事件
-						modifiedData, err := json.Marshal(eventData)
-						if err != nil {
-							return data, nil
+					// 确保delta存在
+					if delta, hasDelta := choice["delta"].(map[string]interface{}); hasDelta {
+						// 确保content存在，即使是空字符串
+						if _, hasContent := delta["content"]; !hasContent {
+							delta["content"] = ""
+							modified = true
 						}
-						return modifiedData, nil
 					}
-				}
 
-				// 将finish_reason为null或缺少的情况处理为明确的null
-				if _, hasFinishReason := choice["finish_reason"]; !hasFinishReason {
-					choice["finish_reason"] = nil
-					choices[0] = choice
-					eventData["choices"] = choices
+					// 将finish_reason为null或缺少的情况处理为明确的null
+					if _, hasFinishReason := choice["finish_reason"]; !hasFinishReason {
+						choice["finish_reason"] = nil
+						modified = true
+					}
+				}
 
-					// 重新编码确保finish_reason存在
+				if modified {
+					// 重新编码修改后的事件
 					modifiedData, err := json.Marshal(eventData)
 					if err != nil {
 						return data, nil
@@ -0,0 +1,336 @@
+/**
+  @author: Hanhai
+  @desc: 上下文过长时的消息截断，按模型配置的策略删除较早的对话消息后重试，保留系统消息和最新的用户消息
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TruncatedHeader 请求消息被截断时添加的响应头，值为删除的消息数量
+const TruncatedHeader = "X-FS-Truncated"
+
+// 消息截断策略
+const (
+	TruncationDropOldest = "drop_oldest" // 从最早的消息开始删除
+	TruncationMiddleOut  = "middle_out"  // 保留开头和结尾，从中间开始删除
+)
+
+const (
+	// 已因上游返回上下文过长而截断重试过的请求，保证只重试一次
+	contextRetriedKey = "context_truncation_retried"
+	// 本次请求已删除的消息数量
+	truncatedMessagesKey = "truncated_messages"
+)
+
+// 从上游错误信息中提取上下文长度上限
+var contextLimitPattern = regexp.MustCompile(`(?i)(?:maximum context length|context length|context window|max_model_len)\D{0,40}(\d{3,8})`)
+
+// messageUnit 截断时必须一起保留或删除的一组连续消息
+// 带tool_calls的助手消息和其后的工具结果消息属于同一组，避免留下没有结果的工具调用或没有调用的工具结果
+type messageUnit struct {
+	start     int  // 第一条消息的下标
+	end       int  // 最后一条消息之后的下标
+	tokens    int  // 估算的令牌数
+	protected bool // 是否不允许删除
+}
+
+// isContextLengthError 判断上游错误是否为上下文过长
+func isContextLengthError(statusCode int, body []byte) bool {
+	return key.ClassifyResponse(statusCode, body) == key.CategoryContextLength
+}
+
+// applyProactiveTruncation 模型配置了上下文长度时，在发送前预估令牌数并截断超出的消息
+func applyProactiveTruncation(c *gin.Context, body []byte, modelName string) []byte {
+	override, ok := config.GetModelOverride(modelName)
+	if !ok || !isTruncationPolicy(override.TruncationPolicy) || override.ContextWindow <= 0 {
+		return body
+	}
+
+	target := override.ContextWindow - requestedMaxTokens(body)
+	if target <= 0 {
+		return body
+	}
+
+	newBody, dropped := truncateMessages(body, override.TruncationPolicy, target)
+	if dropped == 0 {
+		return body
+	}
+
+	logger.Info("模型 %s 的请求预估超过上下文长度 %d，已按%s策略删除 %d 条消息",
+		modelName, override.ContextWindow, override.TruncationPolicy, dropped)
+	markTruncated(c, dropped)
+	return newBody
+}
+
+// truncateForContextError 上游返回上下文过长时截断消息，返回截断后的请求体
+// 未开启截断、已经重试过或没有可删除的消息时返回false
+func truncateForContextError(c *gin.Context, body []byte, modelName string, errBody []byte) ([]byte, bool) {
+	override, ok := config.GetModelOverride(modelName)
+	if !ok || !isTruncationPolicy(override.TruncationPolicy) {
+		return body, false
+	}
+	if retried, exists := c.Get(contextRetriedKey); exists && retried.(bool) {
+		return body, false
+	}
+	c.Set(contextRetriedKey, true)
+
+	current := estimateRequestTokens(body)
+	maxTokens := requestedMaxTokens(body)
+
+	// 目标令牌数：优先使用配置的上下文长度，其次使用错误信息中的上限，都没有时减少四分之一
+	target := 0
+	if override.ContextWindow > 0 {
+		target = override.ContextWindow - maxTokens
+	} else if match := contextLimitPattern.FindSubmatch(errBody); match != nil {
+		if limit, err := strconv.Atoi(string(match[1])); err == nil {
+			target = limit - maxTokens
+		}
+	}
+	// 估算值可能偏小，目标不小于当前估算值时同样减少四分之一
+	if target <= 0 || target >= current {
+		target = current * 3 / 4
+	}
+
+	newBody, dropped := truncateMessages(body, override.TruncationPolicy, target)
+	if dropped == 0 {
+		return body, false
+	}
+
+	logger.Info("上游返回上下文过长，模型 %s 的请求已按%s策略删除 %d 条消息后重试",
+		modelName, override.TruncationPolicy, dropped)
+	markTruncated(c, dropped)
+	return newBody, true
+}
+
+// markTruncated 累计本次请求删除的消息数量并设置响应头
+func markTruncated(c *gin.Context, dropped int) {
+	total := dropped
+	if previous, exists := c.Get(truncatedMessagesKey); exists {
+		total += previous.(int)
+	}
+	c.Set(truncatedMessagesKey, total)
+	c.Header(TruncatedHeader, strconv.Itoa(total))
+}
+
+// isTruncationPolicy 检查是否为支持的截断策略
+func isTruncationPolicy(policy string) bool {
+	return policy == TruncationDropOldest || policy == TruncationMiddleOut
+}
+
+// truncateMessages 按策略删除消息直到估算的令牌数不超过target，返回新的请求体和删除的消息数量
+// 系统消息、最后一条用户消息及其之后的消息不会被删除
+func truncateMessages(body []byte, policy string, target int) ([]byte, int) {
+	requestData, messages, ok := decodeChatMessages(body)
+	if !ok {
+		return body, 0
+	}
+
+	units := buildMessageUnits(messages)
+	total := 3
+	var candidates []int
+	for i, unit := range units {
+		total += unit.tokens
+		if !unit.protected {
+			candidates = append(candidates, i)
+		}
+	}
+
+	dropped := make(map[int]bool)
+	for total > target && len(candidates) > 0 {
+		pick := 0
+		if policy == TruncationMiddleOut {
+			pick = len(candidates) / 2
+		}
+		unitIndex := candidates[pick]
+		candidates = append(candidates[:pick], candidates[pick+1:]...)
+
+		dropped[unitIndex] = true
+		total -= units[unitIndex].tokens
+	}
+	if len(dropped) == 0 {
+		return body, 0
+	}
+
+	kept := make([]interface{}, 0, len(messages))
+	droppedMessages := 0
+	for i, unit := range units {
+		if dropped[i] {
+			droppedMessages += unit.end - unit.start
+			continue
+		}
+		kept = append(kept, messages[unit.start:unit.end]...)
+	}
+
+	requestData["messages"] = kept
+	newBody, err := json.Marshal(requestData)
+	if err != nil {
+		logger.Error("序列化截断后的请求体失败: %v", err)
+		return body, 0
+	}
+	return newBody, droppedMessages
+}
+
+// buildMessageUnits 将消息分组，并标记不允许删除的分组
+func buildMessageUnits(messages []interface{}) []messageUnit {
+	lastUser := -1
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messageRole(messages[i]) == "user" {
+			lastUser = i
+			break
+		}
+	}
+
+	var units []messageUnit
+	for i := 0; i < len(messages); {
+		role := messageRole(messages[i])
+		end := i + 1
+		// 工具调用和紧随其后的工具结果作为一组；没有对应调用的工具结果也连续成组
+		if (role == "assistant" && hasToolCalls(messages[i])) || isToolResultRole(role) {
+			for end < len(messages) && isToolResultRole(messageRole(messages[end])) {
+				end++
+			}
+		}
+
+		unit := messageUnit{start: i, end: end}
+		for j := i; j < end; j++ {
+			unit.tokens += estimateMessageTokens(messages[j])
+			switch messageRole(messages[j]) {
+			case "system", "developer":
+				unit.protected = true
+			}
+		}
+		// 最后一条用户消息及之后的消息属于当前轮对话，不能删除
+		if lastUser < 0 || end > lastUser {
+			unit.protected = true
+		}
+
+		units = append(units, unit)
+		i = end
+	}
+	return units
+}
+
+// decodeChatMessages 解析请求体中的消息列表
+func decodeChatMessages(body []byte) (map[string]interface{}, []interface{}, bool) {
+	var requestData map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&requestData); err != nil {
+		return nil, nil, false
+	}
+
+	messages, ok := requestData["messages"].([]interface{})
+	if !ok || len(messages) == 0 {
+		return nil, nil, false
+	}
+	return requestData, messages, true
+}
+
+// estimateRequestTokens 估算请求中所有消息的令牌数
+func estimateRequestTokens(body []byte) int {
+	_, messages, ok := decodeChatMessages(body)
+	if !ok {
+		return 0
+	}
+
+	total := 3
+	for _, msg := range messages {
+		total += estimateMessageTokens(msg)
+	}
+	return total
+}
+
+// estimateMessageTokens 估算单条消息的令牌数，包括文本内容、工具调用参数和每条消息的固定开销
+func estimateMessageTokens(msg interface{}) int {
+	msgMap, ok := msg.(map[string]interface{})
+	if !ok {
+		return 0
+	}
+
+	tokens := 4
+	switch content := msgMap["content"].(type) {
+	case string:
+		tokens += utils.EstimateStringTokens(content)
+	case []interface{}:
+		for _, part := range content {
+			if partMap, ok := part.(map[string]interface{}); ok {
+				if text, ok := partMap["text"].(string); ok {
+					tokens += utils.EstimateStringTokens(text)
+				}
+			}
+		}
+	}
+
+	if toolCalls, ok := msgMap["tool_calls"].([]interface{}); ok {
+		for _, call := range toolCalls {
+			callMap, ok := call.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if function, ok := callMap["function"].(map[string]interface{}); ok {
+				name, _ := function["name"].(string)
+				arguments, _ := function["arguments"].(string)
+				tokens += utils.EstimateStringTokens(name) + utils.EstimateStringTokens(arguments)
+			}
+		}
+	}
+	return tokens
+}
+
+// requestedMaxTokens 获取请求中设置的最大输出令牌数，未设置时返回0
+func requestedMaxTokens(body []byte) int {
+	var requestData map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&requestData); err != nil {
+		return 0
+	}
+
+	for _, name := range maxTokensFields {
+		if number, ok := requestData[name].(json.Number); ok {
+			if value, err := strconv.Atoi(number.String()); err == nil && value > 0 {
+				return value
+			}
+		}
+	}
+	return 0
+}
+
+// messageRole 获取消息的角色
+func messageRole(msg interface{}) string {
+	if msgMap, ok := msg.(map[string]interface{}); ok {
+		role, _ := msgMap["role"].(string)
+		return role
+	}
+	return ""
+}
+
+// hasToolCalls 检查消息是否包含工具调用，包括旧版的function_call
+func hasToolCalls(msg interface{}) bool {
+	msgMap, ok := msg.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if toolCalls, ok := msgMap["tool_calls"].([]interface{}); ok && len(toolCalls) > 0 {
+		return true
+	}
+	_, ok = msgMap["function_call"].(map[string]interface{})
+	return ok
+}
+
+// isToolResultRole 检查是否为工具结果消息的角色，包括旧版的function
+func isToolResultRole(role string) bool {
+	return role == "tool" || role == "function"
+}
@@ -0,0 +1,343 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"flowsilicon/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testMessage 测试用的对话消息
+type testMessage struct {
+	Role       string         `json:"role"`
+	Content    string         `json:"content"`
+	ToolCalls  []testToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+// testToolCall 测试用的工具调用
+type testToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// 每条消息的内容，保证删除一条消息能明显减少估算的令牌数
+var filler = strings.Repeat("context ", 50)
+
+func textMessage(role, content string) testMessage {
+	return testMessage{Role: role, Content: content + " " + filler}
+}
+
+// toolCallMessage 带工具调用的助手消息
+func toolCallMessage(ids ...string) testMessage {
+	msg := testMessage{Role: "assistant"}
+	for _, id := range ids {
+		call := testToolCall{ID: id, Type: "function"}
+		call.Function.Name = "lookup"
+		call.Function.Arguments = `{"query":"` + id + `"}`
+		msg.ToolCalls = append(msg.ToolCalls, call)
+	}
+	return msg
+}
+
+func toolResultMessage(id string) testMessage {
+	return testMessage{Role: "tool", ToolCallID: id, Content: "result " + id + " " + filler}
+}
+
+func chatBody(t *testing.T, messages []testMessage) []byte {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{"model": "test-model", "messages": messages})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func decodeMessages(t *testing.T, body []byte) []testMessage {
+	t.Helper()
+	var data struct {
+		Messages []testMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatal(err)
+	}
+	return data.Messages
+}
+
+// messageKey 区分测试对话中的每条消息
+func messageKey(msg testMessage) string {
+	key := msg.Role + "|" + msg.Content + "|" + msg.ToolCallID
+	for _, call := range msg.ToolCalls {
+		key += "|" + call.ID
+	}
+	return key
+}
+
+// checkTruncated 检查截断后的消息仍然是合法的对话
+// 系统消息和最后一条用户消息及之后的消息全部保留，每个工具调用都有结果，每个工具结果都有对应的调用
+func checkTruncated(t *testing.T, original, kept []testMessage) {
+	t.Helper()
+
+	lastUser := -1
+	for i, msg := range original {
+		if msg.Role == "user" {
+			lastUser = i
+		}
+	}
+	keptMessages := make(map[string]bool)
+	for _, msg := range kept {
+		keptMessages[messageKey(msg)] = true
+	}
+	for i, msg := range original {
+		if (msg.Role == "system" || i >= lastUser) && !keptMessages[messageKey(msg)] {
+			t.Errorf("dropped protected message %d (%s)", i, msg.Role)
+		}
+	}
+
+	pending := make(map[string]bool)
+	for i, msg := range kept {
+		if msg.Role != "tool" && len(pending) > 0 {
+			t.Errorf("message %d (%s) follows tool calls without results: %v", i, msg.Role, pending)
+			pending = make(map[string]bool)
+		}
+		for _, call := range msg.ToolCalls {
+			pending[call.ID] = true
+		}
+		if msg.Role == "tool" {
+			if !pending[msg.ToolCallID] {
+				t.Errorf("tool result %s at %d has no matching tool call", msg.ToolCallID, i)
+			}
+			delete(pending, msg.ToolCallID)
+		}
+	}
+	if len(pending) > 0 {
+		t.Errorf("tool calls without results at the end: %v", pending)
+	}
+}
+
+func TestTruncateMessages(t *testing.T) {
+	toolConversation := []testMessage{
+		textMessage("system", "you are a helper"),
+		textMessage("user", "first question"),
+		toolCallMessage("call_1", "call_2"),
+		toolResultMessage("call_1"),
+		toolResultMessage("call_2"),
+		textMessage("assistant", "first answer"),
+		textMessage("user", "second question"),
+		toolCallMessage("call_3"),
+		toolResultMessage("call_3"),
+		textMessage("assistant", "second answer"),
+		textMessage("user", "latest question"),
+		toolCallMessage("call_4"),
+		toolResultMessage("call_4"),
+	}
+
+	tests := []struct {
+		name        string
+		policy      string
+		messages    []testMessage
+		dropUnits   int // 需要删除的可删除分组数，决定截断目标
+		wantDropped int
+		wantRoles   []string
+	}{
+		{
+			name:        "从最早的消息开始删除",
+			policy:      TruncationDropOldest,
+			messages:    []testMessage{textMessage("system", "s"), textMessage("user", "u1"), textMessage("assistant", "a1"), textMessage("user", "u2"), textMessage("assistant", "a2"), textMessage("user", "u3")},
+			dropUnits:   2,
+			wantDropped: 2,
+			wantRoles:   []string{"system", "user", "assistant", "user"},
+		},
+		{
+			name:        "从中间开始删除",
+			policy:      TruncationMiddleOut,
+			messages:    []testMessage{textMessage("system", "s"), textMessage("user", "u1"), textMessage("assistant", "a1"), textMessage("user", "u2"), textMessage("assistant", "a2"), textMessage("user", "u3")},
+			dropUnits:   1,
+			wantDropped: 1,
+			wantRoles:   []string{"system", "user", "assistant", "assistant", "user"},
+		},
+		{
+			name:        "工具调用和所有结果一起删除",
+			policy:      TruncationDropOldest,
+			messages:    toolConversation,
+			dropUnits:   2,
+			wantDropped: 4,
+			wantRoles:   []string{"system", "assistant", "user", "assistant", "tool", "assistant", "user", "assistant", "tool"},
+		},
+		{
+			name:        "从中间删除时不拆开工具调用",
+			policy:      TruncationMiddleOut,
+			messages:    toolConversation,
+			dropUnits:   3,
+			wantDropped: 4,
+			wantRoles:   []string{"system", "user", "assistant", "tool", "tool", "assistant", "user", "assistant", "tool"},
+		},
+		{
+			name:        "目标无法达到时只保留受保护的消息",
+			policy:      TruncationDropOldest,
+			messages:    toolConversation,
+			dropUnits:   100,
+			wantDropped: 9,
+			wantRoles:   []string{"system", "user", "assistant", "tool"},
+		},
+		{
+			name:        "只有系统消息和最新的用户消息时不删除",
+			policy:      TruncationDropOldest,
+			messages:    []testMessage{textMessage("system", "s"), textMessage("user", "u")},
+			dropUnits:   100,
+			wantDropped: 0,
+			wantRoles:   []string{"system", "user"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := chatBody(t, tt.messages)
+			// 每个可删除的分组至少有一条带filler的消息，按此计算截断目标
+			target := estimateRequestTokens(body) - tt.dropUnits*estimateMessageTokens(map[string]interface{}{"content": filler}) + 1
+
+			newBody, dropped := truncateMessages(body, tt.policy, target)
+			if dropped != tt.wantDropped {
+				t.Errorf("dropped = %d, want %d", dropped, tt.wantDropped)
+			}
+			kept := decodeMessages(t, newBody)
+			var roles []string
+			for _, msg := range kept {
+				roles = append(roles, msg.Role)
+			}
+			if strings.Join(roles, ",") != strings.Join(tt.wantRoles, ",") {
+				t.Errorf("roles = %v, want %v", roles, tt.wantRoles)
+			}
+			checkTruncated(t, tt.messages, kept)
+		})
+	}
+}
+
+// 随机生成包含工具调用的对话，任意目标下截断结果都必须是合法的对话
+func TestTruncateMessagesRandomToolSequences(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for round := 0; round < 500; round++ {
+		var messages []testMessage
+		if rng.Intn(2) == 0 {
+			messages = append(messages, textMessage("system", "system prompt"))
+		}
+		callID := 0
+		for turn := rng.Intn(6) + 1; turn > 0; turn-- {
+			messages = append(messages, textMessage("user", fmt.Sprintf("question %d", turn)))
+			for steps := rng.Intn(3); steps > 0; steps-- {
+				var ids []string
+				for n := rng.Intn(3) + 1; n > 0; n-- {
+					callID++
+					ids = append(ids, fmt.Sprintf("call_%d", callID))
+				}
+				messages = append(messages, toolCallMessage(ids...))
+				for _, id := range ids {
+					messages = append(messages, toolResultMessage(id))
+				}
+			}
+			if rng.Intn(3) > 0 {
+				messages = append(messages, textMessage("assistant", fmt.Sprintf("answer %d", turn)))
+			}
+		}
+
+		body := chatBody(t, messages)
+		target := rng.Intn(estimateRequestTokens(body) + 1)
+		for _, policy := range []string{TruncationDropOldest, TruncationMiddleOut} {
+			newBody, dropped := truncateMessages(body, policy, target)
+			kept := decodeMessages(t, newBody)
+			if len(kept)+dropped != len(messages) {
+				t.Fatalf("round %d %s: kept %d + dropped %d != %d messages", round, policy, len(kept), dropped, len(messages))
+			}
+			checkTruncated(t, messages, kept)
+			if t.Failed() {
+				t.Fatalf("round %d %s: invalid truncation of %d messages", round, policy, len(messages))
+			}
+		}
+	}
+}
+
+// 截断默认关闭，模型配置了截断策略和上下文长度时发送前截断并设置响应头
+func TestApplyProactiveTruncation(t *testing.T) {
+	t.Cleanup(func() { config.UpdateConfig(&config.Config{}) })
+
+	messages := []testMessage{textMessage("system", "s"), textMessage("user", "u1"), textMessage("assistant", "a1"), textMessage("user", "u2")}
+	body := chatBody(t, messages)
+	window := estimateRequestTokens(body) - 10
+
+	tests := []struct {
+		name       string
+		overrides  map[string]config.ModelOverride
+		wantHeader string
+	}{
+		{name: "未配置覆盖时不截断"},
+		{name: "未设置截断策略时不截断", overrides: map[string]config.ModelOverride{"test-model": {ContextWindow: window}}},
+		{name: "未设置上下文长度时不主动截断", overrides: map[string]config.ModelOverride{"test-model": {TruncationPolicy: TruncationDropOldest}}},
+		{name: "超过上下文长度时截断", overrides: map[string]config.ModelOverride{"test-model": {TruncationPolicy: TruncationDropOldest, ContextWindow: window}}, wantHeader: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.App.ModelOverrides = tt.overrides
+			config.UpdateConfig(cfg)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			newBody := applyProactiveTruncation(c, body, "test-model")
+
+			if got := w.Header().Get(TruncatedHeader); got != tt.wantHeader {
+				t.Errorf("%s = %q, want %q", TruncatedHeader, got, tt.wantHeader)
+			}
+			if tt.wantHeader == "" && string(newBody) != string(body) {
+				t.Errorf("body changed without a truncation policy")
+			}
+			if tt.wantHeader != "" {
+				checkTruncated(t, messages, decodeMessages(t, newBody))
+			}
+		})
+	}
+}
+
+// 上游返回上下文过长时按错误信息中的上限截断，同一个请求只截断重试一次
+func TestTruncateForContextErrorOnce(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.ModelOverrides = map[string]config.ModelOverride{"test-model": {TruncationPolicy: TruncationDropOldest}}
+	config.UpdateConfig(cfg)
+	t.Cleanup(func() { config.UpdateConfig(&config.Config{}) })
+
+	messages := []testMessage{
+		textMessage("system", "s"),
+		textMessage("user", "u1"),
+		toolCallMessage("call_1"),
+		toolResultMessage("call_1"),
+		textMessage("assistant", "a1"),
+		textMessage("user", "u2"),
+	}
+	body := chatBody(t, messages)
+	errBody := []byte(fmt.Sprintf(`{"message":"This model's maximum context length is %d tokens"}`, estimateRequestTokens(body)-10))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	newBody, ok := truncateForContextError(c, body, "test-model", errBody)
+	if !ok {
+		t.Fatal("first context length error was not truncated")
+	}
+	if got := w.Header().Get(TruncatedHeader); got != "1" {
+		t.Errorf("%s = %q, want 1", TruncatedHeader, got)
+	}
+	checkTruncated(t, messages, decodeMessages(t, newBody))
+
+	if _, ok := truncateForContextError(c, newBody, "test-model", errBody); ok {
+		t.Errorf("second context length error was truncated again, want a single retry")
+	}
+}
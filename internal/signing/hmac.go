@@ -0,0 +1,113 @@
+/**
+  @author: Hanhai
+  @desc: 内置的HMAC-SHA256请求签名，按模板对时间戳和请求体哈希签名，模拟上游使用同一实现验证签名
+**/
+
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"flowsilicon/internal/config"
+)
+
+// TypeHMACSHA256 内置的HMAC-SHA256签名方式
+const TypeHMACSHA256 = "hmac-sha256"
+
+// 未设置时的签名请求头、时间戳请求头和签名内容模板
+const (
+	DefaultSignatureHeader = "X-Signature"
+	DefaultTimestampHeader = "X-Timestamp"
+	DefaultCanonical       = "{timestamp}\n{body_sha256}"
+)
+
+// hmacSigner HMAC-SHA256签名，签名为十六进制小写
+type hmacSigner struct {
+	secret          []byte
+	header          string
+	timestampHeader string
+	canonical       string
+}
+
+// newHMACSigner 按配置创建HMAC-SHA256签名
+func newHMACSigner(cfg config.RequestSigningConfig) (Signer, error) {
+	if cfg.Secret == "" {
+		return nil, errors.New("签名密钥不能为空")
+	}
+	signer := &hmacSigner{
+		secret:          []byte(cfg.Secret),
+		header:          strings.TrimSpace(cfg.Header),
+		timestampHeader: strings.TrimSpace(cfg.TimestampHeader),
+		canonical:       cfg.Canonical,
+	}
+	if signer.header == "" {
+		signer.header = DefaultSignatureHeader
+	}
+	if signer.timestampHeader == "" {
+		signer.timestampHeader = DefaultTimestampHeader
+	}
+	if signer.canonical == "" {
+		signer.canonical = DefaultCanonical
+	}
+	return signer, nil
+}
+
+// Sign 设置时间戳和签名请求头
+func (s *hmacSigner) Sign(req *http.Request, body []byte, now time.Time) error {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set(s.timestampHeader, timestamp)
+	req.Header.Set(s.header, s.signature(req, body, timestamp))
+	return nil
+}
+
+// signature 计算请求的签名
+func (s *hmacSigner) signature(req *http.Request, body []byte, timestamp string) string {
+	bodyHash := sha256.Sum256(body)
+	content := strings.NewReplacer(
+		"{timestamp}", timestamp,
+		"{body_sha256}", hex.EncodeToString(bodyHash[:]),
+		"{method}", req.Method,
+		"{path}", req.URL.Path,
+	).Replace(s.canonical)
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyHMACSHA256 验证请求的HMAC-SHA256签名，时间戳与当前时间相差超过maxSkew时验证失败，maxSkew为0时不检查时间戳
+func VerifyHMACSHA256(req *http.Request, body []byte, cfg config.RequestSigningConfig, maxSkew time.Duration) error {
+	signer, err := newHMACSigner(cfg)
+	if err != nil {
+		return err
+	}
+	s := signer.(*hmacSigner)
+
+	timestamp := req.Header.Get(s.timestampHeader)
+	if timestamp == "" {
+		return fmt.Errorf("缺少时间戳请求头 %s", s.timestampHeader)
+	}
+	if maxSkew > 0 {
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("无效的时间戳: %s", timestamp)
+		}
+		if skew := time.Since(time.Unix(unix, 0)); skew > maxSkew || skew < -maxSkew {
+			return fmt.Errorf("时间戳超出允许的范围: %s", timestamp)
+		}
+	}
+
+	expected := s.signature(req, body, timestamp)
+	if !hmac.Equal([]byte(req.Header.Get(s.header)), []byte(expected)) {
+		return errors.New("签名不匹配")
+	}
+	return nil
+}
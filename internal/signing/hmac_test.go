@@ -0,0 +1,128 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"flowsilicon/internal/config"
+)
+
+// expectedSignature 按已替换好的签名内容计算HMAC-SHA256签名
+func expectedSignature(secret, content string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 签名内容模板中的{method}、{path}、{timestamp}和{body_sha256}替换为请求的实际值
+func TestHMACSignerCanonicalTemplate(t *testing.T) {
+	body := []byte(`{"model":"test-model"}`)
+	bodyHash := sha256.Sum256(body)
+	now := time.Unix(1700000000, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name      string
+		canonical string
+		want      string // 替换后的签名内容
+	}{
+		{name: "默认模板", want: timestamp + "\n" + hex.EncodeToString(bodyHash[:])},
+		{name: "方法和路径", canonical: "{method} {path}", want: "POST /v1/chat/completions"},
+		{name: "全部占位符", canonical: "{method}\n{path}\n{timestamp}\n{body_sha256}", want: "POST\n/v1/chat/completions\n" + timestamp + "\n" + hex.EncodeToString(bodyHash[:])},
+		{name: "路径不包含查询参数", canonical: "{path}", want: "/v1/chat/completions"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.RequestSigningConfig{Type: TypeHMACSHA256, Secret: "secret", Canonical: tt.canonical}
+			signer, err := NewSigner(cfg)
+			if err != nil {
+				t.Fatalf("NewSigner 失败: %v", err)
+			}
+			req := httptest.NewRequest("POST", "/v1/chat/completions?debug=1", nil)
+			if err := signer.Sign(req, body, now); err != nil {
+				t.Fatalf("Sign 失败: %v", err)
+			}
+
+			if got := req.Header.Get(DefaultTimestampHeader); got != timestamp {
+				t.Errorf("%s = %q, want %q", DefaultTimestampHeader, got, timestamp)
+			}
+			if got, want := req.Header.Get(DefaultSignatureHeader), expectedSignature("secret", tt.want); got != want {
+				t.Errorf("%s = %q, want the HMAC of %q", DefaultSignatureHeader, got, tt.want)
+			}
+			if err := VerifyHMACSHA256(req, body, cfg, 0); err != nil {
+				t.Errorf("VerifyHMACSHA256 失败: %v", err)
+			}
+		})
+	}
+}
+
+// 签名内容包含方法和路径时，方法、路径、请求体或密钥不同都会导致验证失败
+func TestVerifyHMACSHA256(t *testing.T) {
+	cfg := config.RequestSigningConfig{Type: TypeHMACSHA256, Secret: "secret", Canonical: "{method}\n{path}\n{timestamp}\n{body_sha256}"}
+	body := []byte(`{"model":"test-model"}`)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    []byte
+		secret  string
+		maxSkew time.Duration
+		signAt  time.Time
+		wantErr string
+	}{
+		{name: "签名正确", method: "POST", path: "/v1/chat/completions"},
+		{name: "方法不同", method: "PUT", path: "/v1/chat/completions", wantErr: "签名不匹配"},
+		{name: "路径不同", method: "POST", path: "/v1/embeddings", wantErr: "签名不匹配"},
+		{name: "请求体不同", method: "POST", path: "/v1/chat/completions", body: []byte(`{"model":"other"}`), wantErr: "签名不匹配"},
+		{name: "密钥不同", method: "POST", path: "/v1/chat/completions", secret: "wrong", wantErr: "签名不匹配"},
+		{name: "时间戳超出范围", method: "POST", path: "/v1/chat/completions", maxSkew: time.Minute, signAt: time.Now().Add(-time.Hour), wantErr: "时间戳超出允许的范围"},
+		{name: "时间戳在范围内", method: "POST", path: "/v1/chat/completions", maxSkew: time.Minute, signAt: time.Now().Add(-10 * time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signAt := tt.signAt
+			if signAt.IsZero() {
+				signAt = time.Now()
+			}
+			signer, err := NewSigner(cfg)
+			if err != nil {
+				t.Fatalf("NewSigner 失败: %v", err)
+			}
+			req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+			if err := signer.Sign(req, body, signAt); err != nil {
+				t.Fatalf("Sign 失败: %v", err)
+			}
+
+			// 按用例修改签名后的请求再验证
+			req.Method = tt.method
+			req.URL.Path = tt.path
+			verifyBody, verifyCfg := body, cfg
+			if tt.body != nil {
+				verifyBody = tt.body
+			}
+			if tt.secret != "" {
+				verifyCfg.Secret = tt.secret
+			}
+
+			err = VerifyHMACSHA256(req, verifyBody, verifyCfg, tt.maxSkew)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("VerifyHMACSHA256 失败: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("VerifyHMACSHA256 error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
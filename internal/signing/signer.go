@@ -0,0 +1,95 @@
+/**
+  @author: Hanhai
+  @desc: 发往上游的请求按密钥所属的服务商附加请求头和签名，签名方式以插件注册，在请求体改写完成后对实际发送的请求签名
+**/
+
+package signing
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"flowsilicon/internal/config"
+)
+
+// Signer 请求签名插件
+type Signer interface {
+	// Sign 为请求设置签名的请求头，body为实际发送的请求体，流式请求只对请求签名
+	Sign(req *http.Request, body []byte, now time.Time) error
+}
+
+// Factory 按配置创建签名插件，配置无效时返回错误
+type Factory func(cfg config.RequestSigningConfig) (Signer, error)
+
+var (
+	factories     = map[string]Factory{TypeHMACSHA256: newHMACSigner}
+	factoriesLock sync.RWMutex
+)
+
+// Register 注册签名方式，同名时覆盖
+func Register(signingType string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	factories[strings.ToLower(signingType)] = factory
+}
+
+// NewSigner 按配置创建签名插件，Type为空时返回nil
+func NewSigner(cfg config.RequestSigningConfig) (Signer, error) {
+	signingType := strings.ToLower(strings.TrimSpace(cfg.Type))
+	if signingType == "" {
+		return nil, nil
+	}
+
+	factoriesLock.RLock()
+	factory, ok := factories[signingType]
+	factoriesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("不支持的签名方式: %s", cfg.Type)
+	}
+	return factory(cfg)
+}
+
+// ApplyProviderHeaders 为发往密钥所属服务商的请求设置附加的请求头并签名，没有配置时不做任何处理
+// 需要在设置通用请求头之后、发送请求之前调用，body必须与实际发送的请求体相同
+func ApplyProviderHeaders(req *http.Request, apiKey string, body []byte) error {
+	cfg := config.GetConfig()
+	if cfg == nil || len(cfg.Providers) == 0 {
+		return nil
+	}
+	rule, ok := config.GetProviderRequestConfig(cfg, config.GetApiKeyProvider(apiKey))
+	if !ok {
+		return nil
+	}
+
+	for name, value := range rule.Headers {
+		req.Header.Set(name, value)
+	}
+
+	signer, err := NewSigner(rule.Signing)
+	if err != nil {
+		return fmt.Errorf("创建服务商 %s 的请求签名失败: %w", rule.Provider, err)
+	}
+	if signer == nil {
+		return nil
+	}
+	if err := signer.Sign(req, body, time.Now()); err != nil {
+		return fmt.Errorf("服务商 %s 的请求签名失败: %w", rule.Provider, err)
+	}
+	return nil
+}
+
+// ValidateProviders 检查各服务商的签名配置是否有效，保存设置时调用
+func ValidateProviders(providers []config.ProviderRequestConfig) error {
+	for _, rule := range providers {
+		if strings.TrimSpace(rule.Provider) == "" {
+			return fmt.Errorf("服务商不能为空")
+		}
+		if _, err := NewSigner(rule.Signing); err != nil {
+			return fmt.Errorf("服务商 %s 的签名配置无效: %w", rule.Provider, err)
+		}
+	}
+	return nil
+}
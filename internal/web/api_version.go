@@ -0,0 +1,117 @@
+/**
+  @author: Hanhai
+  @desc: API版本路由管理，根据路径前缀分发到不同版本的处理逻辑，并标记即将废弃的接口
+**/
+
+package web
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/proxy"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API版本常量
+const (
+	APIVersionV1 = "v1"
+	APIVersionV2 = "v2"
+	// 无版本号路径默认使用的版本
+	DefaultAPIVersion = APIVersionV1
+	// 上下文中保存API版本的键名
+	APIVersionContextKey = "api_version"
+)
+
+// apiVersionHandlers 各API版本对应的处理函数，未注册的版本返回404
+var apiVersionHandlers = map[string]gin.HandlerFunc{
+	APIVersionV1: proxy.HandleOpenAIProxy,
+}
+
+// SetupAPIVersioning 在指定路由组上注册版本化的API路由
+// /v1/ 使用当前的代理逻辑，/v2/ 预留给未来不兼容的接口变更
+func SetupAPIVersioning(group *gin.RouterGroup) {
+	group.Use(APIVersionMiddleware())
+
+	group.Any("/"+APIVersionV1+"/*path", versionedHandler(APIVersionV1))
+	group.Any("/"+APIVersionV2+"/*path", versionedHandler(APIVersionV2))
+}
+
+// APIVersionMiddleware 解析请求路径中的API版本，并为即将废弃的接口添加响应头
+func APIVersionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+
+		// 记录本次请求使用的API版本
+		c.Set(APIVersionContextKey, getAPIVersionFromPath(path))
+
+		// 检查是否是即将废弃的接口
+		if sunset, ok := getDeprecatedSunset(path); ok {
+			c.Header("Deprecated-Endpoint", "true")
+			if sunset != "" {
+				c.Header("Sunset", sunset)
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// versionedHandler 返回指定API版本的处理函数
+func versionedHandler(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handler, ok := apiVersionHandlers[version]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{
+					"message": fmt.Sprintf("API版本 %s 暂未开放", version),
+					"type":    "invalid_request_error",
+					"code":    404,
+				},
+			})
+			return
+		}
+		handler(c)
+	}
+}
+
+// getAPIVersionFromPath 从请求路径中提取API版本，无版本号时返回默认版本
+func getAPIVersionFromPath(path string) string {
+	trimmed := strings.TrimPrefix(path, "/")
+	prefix := trimmed
+	if idx := strings.Index(trimmed, "/"); idx >= 0 {
+		prefix = trimmed[:idx]
+	}
+
+	switch prefix {
+	case APIVersionV1, APIVersionV2:
+		return prefix
+	default:
+		return DefaultAPIVersion
+	}
+}
+
+// getDeprecatedSunset 检查路径是否在配置的废弃列表中，返回其下线日期
+// 配置项的键为完整路径，以/结尾的键按路径前缀匹配
+func getDeprecatedSunset(path string) (string, bool) {
+	cfg := config.GetConfig()
+	if cfg == nil || len(cfg.API.DeprecatedPaths) == 0 {
+		return "", false
+	}
+
+	// 优先精确匹配
+	if sunset, ok := cfg.API.DeprecatedPaths[path]; ok {
+		return sunset, true
+	}
+
+	// 再按前缀匹配
+	for deprecatedPath, sunset := range cfg.API.DeprecatedPaths {
+		if strings.HasSuffix(deprecatedPath, "/") && strings.HasPrefix(path, deprecatedPath) {
+			return sunset, true
+		}
+	}
+
+	return "", false
+}
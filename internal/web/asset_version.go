@@ -0,0 +1,121 @@
+/**
+  @author: Hanhai
+  @desc: 嵌入式静态资源版本管理，按内容哈希生成带版本的资源地址，并支持ETag协商缓存
+**/
+
+package web
+
+import (
+	"flowsilicon/internal/logger"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 嵌入式静态资源的访问前缀
+	staticFSPrefix = "/static-fs/"
+	// 资源地址中内容哈希的长度
+	assetHashLength = 12
+)
+
+var (
+	// 资源路径（如 js/script.js）到完整内容哈希的映射
+	assetHashes map[string]string
+	// 带哈希的资源路径（如 js/script.0123456789ab.js）到资源路径的映射
+	hashedAssetPaths map[string]string
+	assetVersionOnce sync.Once
+)
+
+// initAssetVersions 计算所有嵌入式静态资源的内容哈希，只在首次调用时执行
+func initAssetVersions() {
+	assetVersionOnce.Do(func() {
+		assetHashes = make(map[string]string)
+		hashedAssetPaths = make(map[string]string)
+
+		manifest, err := GetEmbeddedManifest()
+		if err != nil {
+			logger.Error("计算静态资源哈希失败，资源地址将不带版本: %v", err)
+			return
+		}
+
+		for _, asset := range manifest {
+			name := strings.TrimPrefix(asset.Path, "static/")
+			assetHashes[name] = asset.SHA256
+			hashedAssetPaths[hashedAssetPath(name, asset.SHA256)] = name
+		}
+		logger.Info("已计算 %d 个静态资源的内容哈希", len(assetHashes))
+	})
+}
+
+// hashedAssetPath 在资源文件名的扩展名前插入内容哈希
+func hashedAssetPath(name string, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash[:assetHashLength] + ext
+}
+
+// AssetURL 获取静态资源带内容哈希的访问地址，供模板使用
+// 参数name是相对于static目录的路径，如 "js/script.js"，未知资源返回不带哈希的地址
+func AssetURL(name string) string {
+	initAssetVersions()
+
+	name = strings.TrimPrefix(name, "/")
+	hash, ok := assetHashes[name]
+	if !ok {
+		return staticFSPrefix + name
+	}
+	return staticFSPrefix + hashedAssetPath(name, hash)
+}
+
+// resolveAssetPath 将请求的资源路径解析为实际的资源路径
+// 返回实际路径、内容哈希，以及请求路径是否带有内容哈希
+func resolveAssetPath(requestPath string) (string, string, bool) {
+	initAssetVersions()
+
+	requestPath = strings.TrimPrefix(requestPath, "/")
+	if name, ok := hashedAssetPaths[requestPath]; ok {
+		return name, assetHashes[name], true
+	}
+	return requestPath, assetHashes[requestPath], false
+}
+
+// handleStaticAsset 处理嵌入式静态资源请求
+// 带哈希的地址内容不会变化，允许长期缓存；不带哈希的地址每次都需要通过ETag验证
+func handleStaticAsset(c *gin.Context) {
+	name, hash, versioned := resolveAssetPath(c.Param("filepath"))
+
+	if versioned {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+
+	if hash != "" {
+		etag := `"` + hash + `"`
+		c.Header("ETag", etag)
+		if ifNoneMatch(c.GetHeader("If-None-Match"), etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	// 嵌入式文件系统中的文件路径包括"static"前缀
+	c.FileFromFS("static/"+name, http.FS(staticFS))
+}
+
+// ifNoneMatch 检查If-None-Match请求头是否包含指定的ETag
+func ifNoneMatch(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
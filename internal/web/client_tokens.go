@@ -0,0 +1,87 @@
+/**
+  @author: Hanhai
+  @desc: 客户端令牌管理，吊销的令牌保留累计用量并可以恢复，吊销超过冷却期后才能永久删除
+**/
+
+package web
+
+import (
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientTokenRequest 吊销、恢复和删除令牌的请求
+type clientTokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// handleGetClientTokens 获取所有客户端令牌的状态和累计用量
+func handleGetClientTokens(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"tokens":        config.GetClientTokenInfos(),
+		"cooling_hours": clientTokenCoolingHours(),
+	})
+}
+
+// handleRevokeClientToken 吊销客户端令牌
+func handleRevokeClientToken(c *gin.Context) {
+	updateClientToken(c, config.RevokeClientToken)
+}
+
+// handleRestoreClientToken 恢复已吊销的客户端令牌
+func handleRestoreClientToken(c *gin.Context) {
+	updateClientToken(c, config.RestoreClientToken)
+}
+
+// handleDeleteClientToken 永久删除吊销超过冷却期的客户端令牌，同时解除该令牌客户端的限流
+func handleDeleteClientToken(c *gin.Context) {
+	updateClientToken(c, func(token string) error {
+		if err := config.DeleteClientToken(token); err != nil {
+			return err
+		}
+		key.ClearClientThrottle(config.ClientTokenClient(token))
+		return nil
+	})
+}
+
+// updateClientToken 解析请求中的令牌并修改其状态，返回修改后的令牌列表
+func updateClientToken(c *gin.Context, update func(token string) error) {
+	var req clientTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效请求: %v", err)})
+		return
+	}
+
+	if err := update(strings.TrimSpace(req.Token)); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, config.ErrClientTokenNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, config.ErrClientTokenNotRevoked), errors.Is(err, config.ErrClientTokenCooling):
+			status = http.StatusConflict
+		case errors.Is(err, config.ErrReadOnlyDatabase), errors.Is(err, config.ErrMaintenanceMode):
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"tokens":  config.GetClientTokenInfos(),
+	})
+}
+
+// clientTokenCoolingHours 获取令牌吊销后需要等待的冷却期（小时）
+func clientTokenCoolingHours() int {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Security.TokenDeleteCoolingHours > 0 {
+		return cfg.Security.TokenDeleteCoolingHours
+	}
+	return config.DefaultTokenDeleteCoolingHours
+}
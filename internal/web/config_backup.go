@@ -0,0 +1,185 @@
+/**
+  @author: Hanhai
+  @desc: 配置和API密钥的备份导出和导入，用于换机器迁移，导入后热加载配置并刷新密钥余额
+**/
+
+package web
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/signing"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 备份文件的类型标识
+	configBackupKind = "flowsilicon_backup"
+	// 当前备份文件的版本
+	configBackupVersion = 1
+)
+
+// 导入备份的模式
+const (
+	backupImportMerge     = "merge"     // 只新增不存在的密钥，保留现有配置
+	backupImportOverwrite = "overwrite" // 用备份整体替换配置、模型策略和密钥
+)
+
+// configBackup 备份文件，配置中的登录密码等设置按原样导出，masked时密钥只保留前四位和后四位，不能用于恢复密钥
+type configBackup struct {
+	Kind       string          `json:"kind"`
+	Version    int             `json:"version"`
+	ExportedAt string          `json:"exported_at,omitempty"`
+	Config     *config.Config  `json:"config"`
+	Routing    routingPreset   `json:"routing"`
+	Keys       []config.ApiKey `json:"keys"`
+	KeysMasked bool            `json:"keys_masked"`
+}
+
+// handleExportConfig 导出当前配置、模型路由和所有密钥，mask=true时密钥脱敏导出
+func handleExportConfig(c *gin.Context) {
+	masked := c.Query("mask") == "true"
+
+	keys := make([]config.ApiKey, 0)
+	for _, k := range key.GetKeyPool().Keys() {
+		if k.Delete {
+			continue
+		}
+		if masked {
+			k.Key = config.MaskKey(k.Key)
+		}
+		k.RecentRequests = nil
+		keys = append(keys, k)
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	backup := configBackup{
+		Kind:       configBackupKind,
+		Version:    configBackupVersion,
+		ExportedAt: time.Now().Format(time.RFC3339),
+		Config:     config.GetConfig().Clone(),
+		Routing:    currentRoutingPreset(loadKnownModels()),
+		Keys:       keys,
+		KeysMasked: masked,
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=flowsilicon-backup-%s.json", time.Now().Format("20060102")))
+	c.JSON(http.StatusOK, backup)
+}
+
+// handleImportConfig 导入备份，mode为merge或overwrite，默认为merge
+// 导入后在后台刷新所有密钥的余额，脱敏导出的备份只导入配置
+func handleImportConfig(c *gin.Context) {
+	mode := c.DefaultQuery("mode", backupImportMerge)
+	if mode != backupImportMerge && mode != backupImportOverwrite {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "mode参数无效，只支持merge和overwrite",
+			"code":  "invalid_mode",
+		})
+		return
+	}
+
+	var backup configBackup
+	if err := c.ShouldBindJSON(&backup); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("无效的备份文件: %v", err),
+			"code":  "invalid_backup",
+		})
+		return
+	}
+	if err := validateConfigBackup(backup, mode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "invalid_backup",
+		})
+		return
+	}
+	if err := config.CheckWritable(); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	warnings := make([]string, 0)
+	keys := backup.Keys
+	if backup.KeysMasked {
+		warnings = append(warnings, "备份中的密钥已脱敏，没有导入密钥")
+		keys = nil
+	}
+
+	added, duplicates := 0, 0
+	if mode == backupImportOverwrite {
+		config.UpdateConfig(backup.Config)
+		warnings = append(warnings, applyRoutingPreset(backup.Routing, loadKnownModels())...)
+		if !backup.KeysMasked {
+			if err := config.ReplaceAllApiKeys(keys); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			added = len(keys)
+		}
+	} else {
+		imported, skipped := config.ImportApiKeys(keys)
+		added, duplicates = len(imported), skipped
+	}
+	config.SortApiKeysByBalance()
+
+	// 导入的密钥立即刷新余额，刷新最长需要30秒，不阻塞导入请求
+	go func() {
+		if err := key.ForceRefreshAllKeysBalance(); err != nil {
+			logger.Error("导入备份后刷新API密钥余额失败: %v", err)
+		}
+	}()
+
+	logger.Info("已按 %s 模式导入备份，导入 %d 个API密钥，跳过 %d 个已存在的密钥", mode, added, duplicates)
+	c.JSON(http.StatusOK, gin.H{
+		"message":    fmt.Sprintf("成功导入备份，导入 %d 个API密钥，跳过 %d 个已存在的密钥", added, duplicates),
+		"mode":       mode,
+		"added":      added,
+		"duplicates": duplicates,
+		"warnings":   warnings,
+	})
+}
+
+// validateConfigBackup 检查备份文件的类型、版本、配置和密钥格式，覆盖导入时需要包含配置
+func validateConfigBackup(backup configBackup, mode string) error {
+	if backup.Kind != configBackupKind {
+		return fmt.Errorf("不是备份文件，kind应为 %s", configBackupKind)
+	}
+	if backup.Version < 1 || backup.Version > configBackupVersion {
+		return fmt.Errorf("不支持的备份版本 %d，当前支持的最高版本为 %d", backup.Version, configBackupVersion)
+	}
+
+	if mode == backupImportOverwrite {
+		if backup.Config == nil {
+			return fmt.Errorf("备份中没有配置，不能覆盖导入")
+		}
+		if _, err := config.ParseClientCIDRs(backup.Config.Server.AllowedClientCIDRs); err != nil {
+			return err
+		}
+		if err := signing.ValidateProviders(backup.Config.Providers); err != nil {
+			return err
+		}
+		if backup.Routing.Kind != "" {
+			if err := validateRoutingPreset(backup.Routing); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !backup.KeysMasked {
+		for i, k := range backup.Keys {
+			if err := config.ValidateApiKeyFormat(config.CanonicalApiKey(k.Key)); err != nil {
+				return fmt.Errorf("第 %d 个密钥无效: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
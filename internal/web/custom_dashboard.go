@@ -0,0 +1,127 @@
+/**
+  @author: Hanhai
+  @desc: 用户自定义仪表盘，将配置的目录中的HTML等文件挂载到/custom/下，页面可以调用/stats等接口获取实时数据
+         只返回index.html和常见的静态资源，不列出目录，不返回隐藏文件，包含配置数据库的目录不对外提供
+**/
+
+package web
+
+import (
+	"errors"
+	"flowsilicon/internal/config"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CustomDashboardPath 自定义仪表盘的路径前缀
+const CustomDashboardPath = "/custom"
+
+// 自定义仪表盘目录中允许返回的文件类型
+var customDashboardExts = map[string]bool{
+	".html":  true,
+	".htm":   true,
+	".css":   true,
+	".js":    true,
+	".mjs":   true,
+	".map":   true,
+	".png":   true,
+	".jpg":   true,
+	".jpeg":  true,
+	".gif":   true,
+	".svg":   true,
+	".webp":  true,
+	".ico":   true,
+	".woff":  true,
+	".woff2": true,
+	".ttf":   true,
+}
+
+// errDashboardDir 请求的路径是目录
+var errDashboardDir = errors.New("不提供目录")
+
+// noDirFS 只允许打开文件的文件系统，打开目录时返回错误，不会列出目录内容
+type noDirFS struct {
+	fs.FS
+}
+
+// Open 打开文件，路径是目录时关闭并返回错误
+func (n noDirFS) Open(name string) (fs.File, error) {
+	f, err := n.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, errDashboardDir
+	}
+	return f, nil
+}
+
+// handleCustomDashboard 从自定义仪表盘目录返回文件，路径以/结尾时返回该目录下的index.html
+// 每次请求都从磁盘读取并禁止缓存，修改文件或目录配置后刷新页面即可生效，无需重启
+func handleCustomDashboard(c *gin.Context) {
+	dir := strings.TrimSpace(config.GetConfig().Server.CustomDashboardDir)
+	if dir == "" {
+		handleNotFound(c)
+		return
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() || config.ContainsConfigDB(dir) {
+		handleNotFound(c)
+		return
+	}
+
+	name := strings.TrimPrefix(c.Param("filepath"), "/")
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+	if !isCustomDashboardAsset(name) {
+		handleNotFound(c)
+		return
+	}
+
+	// os.DirFS拒绝包含..的路径，不会读取目录之外的文件
+	f, err := noDirFS{os.DirFS(dir)}.Open(name)
+	if err != nil {
+		handleNotFound(c)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		handleNotFound(c)
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		handleNotFound(c)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), content)
+}
+
+// isCustomDashboardAsset 检查路径是否是允许返回的文件，拒绝隐藏文件、隐藏目录和其他类型的文件
+func isCustomDashboardAsset(name string) bool {
+	if !fs.ValidPath(name) {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return customDashboardExts[strings.ToLower(path.Ext(name))]
+}
@@ -0,0 +1,75 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"flowsilicon/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCustomDashboard(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":     "<h1>dashboard</h1>",
+		"app.js":         "console.log(1)",
+		"keys.json":      `{"key":"sk-secret"}`,
+		".env":           "SECRET=1",
+		"sub/page.html":  "<p>page</p>",
+		"empty/data.txt": "x",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &config.Config{}
+	cfg.Server.CustomDashboardDir = dir
+	config.UpdateConfig(cfg)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET(CustomDashboardPath+"/*filepath", handleCustomDashboard)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/custom/", http.StatusOK},
+		{"/custom/index.html", http.StatusOK},
+		{"/custom/app.js", http.StatusOK},
+		{"/custom/sub/page.html", http.StatusOK},
+		{"/custom/sub/", http.StatusNotFound},   // 没有index.html，不列出目录
+		{"/custom/empty/", http.StatusNotFound}, // 不列出目录
+		{"/custom/empty", http.StatusNotFound},
+		{"/custom/keys.json", http.StatusNotFound},
+		{"/custom/.env", http.StatusNotFound},
+		{"/custom/../config.db", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+
+	// 目录中有配置数据库时不对外提供任何文件
+	if err := os.WriteFile(filepath.Join(dir, "config.db"), []byte("db"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/custom/index.html", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("dashboard dir containing config.db served a file: %d", w.Code)
+	}
+}
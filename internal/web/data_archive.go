@@ -0,0 +1,48 @@
+/**
+  @author: Hanhai
+  @desc: 导出数据归档，用于将配置、密钥和统计迁移到另一台机器，恢复时使用启动参数--restore
+**/
+
+package web
+
+import (
+	"flowsilicon/internal/config"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleExportDataArchive 导出包含配置数据库和每日统计的tar.gz归档
+// 先写入临时文件再返回，导出失败时可以返回错误而不是不完整的文件
+func handleExportDataArchive(c *gin.Context) {
+	tempFile, err := os.CreateTemp("", "flowsilicon-export-*.tar.gz")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("创建临时文件失败: %v", err),
+		})
+		return
+	}
+	defer os.Remove(tempFile.Name())
+
+	manifest, err := config.WriteDataArchive(tempFile)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("导出数据归档失败: %v", err),
+		})
+		return
+	}
+
+	version := manifest.AppVersion
+	if version == "" {
+		version = "unknown"
+	}
+	fileName := fmt.Sprintf("flowsilicon_%s_%s.tar.gz", version, manifest.CreatedAt.Format("20060102_150405"))
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(tempFile.Name(), fileName)
+}
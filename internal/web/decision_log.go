@@ -0,0 +1,55 @@
+/**
+  @author: Hanhai
+  @desc: 密钥选择决策日志的开关，开启时必须指定时长，到期后自动关闭
+**/
+
+package web
+
+import (
+	"flowsilicon/internal/key"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 未指定时长时决策日志开启的时间（分钟）
+const defaultDecisionLogMinutes = 60
+
+// handleGetDecisionLog 获取决策日志的运行状态
+func handleGetDecisionLog(c *gin.Context) {
+	c.JSON(http.StatusOK, key.GetDecisionLogStatus())
+}
+
+// handleSetDecisionLog 开启或关闭决策日志
+func handleSetDecisionLog(c *gin.Context) {
+	var req struct {
+		Enabled         bool `json:"enabled"`
+		DurationMinutes int  `json:"duration_minutes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效请求: %v", err)})
+		return
+	}
+
+	if !req.Enabled {
+		key.DisableDecisionLog()
+		c.JSON(http.StatusOK, key.GetDecisionLogStatus())
+		return
+	}
+
+	if req.DurationMinutes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "开启时长不能为负数"})
+		return
+	}
+	minutes := req.DurationMinutes
+	if minutes == 0 {
+		minutes = defaultDecisionLogMinutes
+	}
+	if err := key.EnableDecisionLog(time.Duration(minutes) * time.Minute); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, key.GetDecisionLogStatus())
+}
@@ -0,0 +1,126 @@
+/**
+  @author: Hanhai
+  @desc: 深层链接页面路由，浏览器直接打开时返回带定位信息的主界面，脚本请求时返回对应的JSON数据
+**/
+
+package web
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/middleware"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 深层链接类型，与script.js中的applyDeepLink对应
+const (
+	DeepLinkKey        = "key"
+	DeepLinkLogs       = "logs"
+	DeepLinkModelStats = "model_stats"
+)
+
+// ModelStatsPath 模型统计页面的路径
+const ModelStatsPath = "/stats/models"
+
+// KeyDetailPath 返回指定密钥详情的页面路径，使用数据库ID避免在链接中暴露密钥
+func KeyDetailPath(id int) string {
+	return fmt.Sprintf("/keys/%d", id)
+}
+
+// LogsPath 返回按日志等级过滤的日志页面路径，等级为空时显示全部日志
+func LogsPath(level string) string {
+	if level == "" {
+		return "/logs"
+	}
+	return "/logs?level=" + url.QueryEscape(level)
+}
+
+// DeepLinkURL 返回在本机浏览器中打开指定页面的完整地址
+func DeepLinkURL(port int, path string) string {
+	return fmt.Sprintf("http://localhost:%d%s", port, path)
+}
+
+// renderIndexPage 渲染主界面，deepLink不为空时页面加载后定位到对应内容
+func renderIndexPage(c *gin.Context, deepLink gin.H) {
+	cfg := config.GetConfig()
+	c.HTML(http.StatusOK, "index.html", gin.H{
+		"title":                  cfg.App.Title,
+		"max_balance_display":    cfg.App.MaxBalanceDisplay,
+		"items_per_page":         cfg.App.ItemsPerPage,
+		"auto_update_interval":   cfg.App.AutoUpdateInterval,
+		"stats_refresh_interval": cfg.App.StatsRefreshInterval,
+		"rate_refresh_interval":  cfg.App.RateRefreshInterval,
+		"min_balance_threshold":  cfg.App.MinBalanceThreshold,
+		"deep_link":              deepLink,
+	})
+}
+
+// handleIndexPage 处理主界面请求
+func handleIndexPage(c *gin.Context) {
+	renderIndexPage(c, nil)
+}
+
+// handleKeyDetail 处理密钥详情请求，参数为密钥的数据库ID，同时返回原始计数和平滑后的指标
+func handleKeyDetail(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("key"))
+	if err != nil {
+		handleNotFound(c)
+		return
+	}
+
+	apiKey, ok := config.GetApiKeyByID(id)
+	if !ok {
+		handleNotFound(c)
+		return
+	}
+
+	if middleware.IsPageRequest(c) {
+		renderIndexPage(c, gin.H{"type": DeepLinkKey, "id": id})
+		return
+	}
+
+	// 详情链接可能被分享，不返回完整的密钥
+	apiKey.Key = config.MaskKey(apiKey.Key)
+	c.JSON(http.StatusOK, gin.H{
+		"key":     apiKey,
+		"metrics": key.GetKeyMetrics(id),
+	})
+}
+
+// handleLogsPage 处理日志请求，浏览器打开时显示日志查看器
+func handleLogsPage(c *gin.Context) {
+	if middleware.IsPageRequest(c) {
+		renderIndexPage(c, gin.H{"type": DeepLinkLogs, "level": c.Query("level")})
+		return
+	}
+	handleGetLogs(c)
+}
+
+// handleModelStatsPage 处理模型统计请求，浏览器打开时定位到常用模型
+func handleModelStatsPage(c *gin.Context) {
+	if middleware.IsPageRequest(c) {
+		renderIndexPage(c, gin.H{"type": DeepLinkModelStats})
+		return
+	}
+	getTopModelsHandler(c)
+}
+
+// handleNotFound 处理未知路径，浏览器访问时返回404页面
+func handleNotFound(c *gin.Context) {
+	if middleware.IsPageRequest(c) {
+		c.HTML(http.StatusNotFound, "404.html", gin.H{
+			"title": config.GetConfig().App.Title,
+			"path":  c.Request.URL.Path,
+		})
+		return
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": fmt.Sprintf("未找到请求的资源: %s", c.Request.URL.Path),
+	})
+}
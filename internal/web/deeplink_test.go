@@ -0,0 +1,42 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"flowsilicon/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestKeyDetailMasksKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.UpdateConfig(&config.Config{})
+	const rawKey = "sk-deeplink-raw-secret-key"
+	config.ReplaceApiKeys([]config.ApiKey{{ID: 7, Key: rawKey, Balance: 10}})
+
+	router := gin.New()
+	router.GET("/keys/:key", handleKeyDetail)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/keys/7", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), rawKey) {
+		t.Fatalf("响应中包含完整的密钥: %s", w.Body.String())
+	}
+
+	var resp struct {
+		Key config.ApiKey `json:"key"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Key.Key != config.MaskKey(rawKey) {
+		t.Fatalf("key = %q，期望 %q", resp.Key.Key, config.MaskKey(rawKey))
+	}
+}
@@ -6,17 +6,26 @@
 package web
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flowsilicon/internal/auth"
+	"flowsilicon/internal/cache"
 	"flowsilicon/internal/common"
 	"flowsilicon/internal/config"
 	"flowsilicon/internal/key"
 	"flowsilicon/internal/logger"
 	"flowsilicon/internal/middleware"
 	"flowsilicon/internal/model"
+	"flowsilicon/internal/notify"
+	"flowsilicon/internal/proxy"
+	"flowsilicon/internal/signing"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -32,8 +41,22 @@ import (
 
 // handleListKeys 处理列出所有 API 密钥的请求
 func handleListKeys(c *gin.Context) {
-	// 获取所有API密钥
-	allKeys := config.GetApiKeys()
+	// 指定了分页参数时直接从数据库分页查询，不复制整个密钥池
+	if c.Query("offset") != "" || c.Query("limit") != "" {
+		handleListKeysPage(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"keys":            keysWithCurrentScores(),
+		"recovery_probes": key.GetRecoveryProbes(),
+	})
+}
+
+// keysWithCurrentScores 获取所有API密钥，得分为按当前状态计算的得分
+func keysWithCurrentScores() []config.ApiKey {
+	// 获取所有API密钥，下面会修改得分，复制快照中的密钥
+	allKeys := append([]config.ApiKey(nil), key.GetKeyPool().Keys()...)
 
 	// 使用公共函数计算密钥得分
 	keysWithScores := key.CalculateKeyScores(allKeys)
@@ -51,9 +74,75 @@ func handleListKeys(c *gin.Context) {
 			allKeys[i].Score = score
 		}
 	}
+	return allKeys
+}
+
+// 密钥列表分页的默认和最大每页数量
+const (
+	defaultKeysPageLimit = 50
+	maxKeysPageLimit     = 500
+)
+
+// handleListKeysPage 分页获取API密钥，支持按状态、提供商、标签和最低余额过滤
+// 返回的得分为最近一次保存到数据库的得分
+func handleListKeysPage(c *gin.Context) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "offset参数无效",
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultKeysPageLimit)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "limit参数无效",
+		})
+		return
+	}
+	if limit > maxKeysPageLimit {
+		limit = maxKeysPageLimit
+	}
+
+	filter := config.KeyFilter{
+		Status:   c.Query("status"),
+		Provider: c.Query("provider"),
+		Tag:      c.Query("tag"),
+	}
+	switch filter.Status {
+	case "", config.KeyStatusActive, config.KeyStatusEnabled, config.KeyStatusDisabled, config.KeyStatusDeleted:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "status参数无效",
+		})
+		return
+	}
+	if value := c.Query("min_balance"); value != "" {
+		minBalance, err := strconv.ParseFloat(value, 64)
+		if err != nil || minBalance < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "min_balance参数无效",
+			})
+			return
+		}
+		filter.MinBalance = minBalance
+	}
+
+	keys, total, err := config.GetApiKeysPage(offset, limit, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("获取API密钥失败: %v", err),
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"keys": allKeys,
+		"keys":            keys,
+		"total":           total,
+		"offset":          offset,
+		"limit":           limit,
+		"recovery_probes": key.GetRecoveryProbes(),
 	})
 }
 
@@ -71,6 +160,13 @@ func handleAddKey(c *gin.Context) {
 		})
 		return
 	}
+	req.Key = config.CanonicalApiKey(req.Key)
+	if req.Key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "API密钥不能为空",
+		})
+		return
+	}
 
 	// 如果未提供余额，尝试检查余额
 	if req.Balance == 0 {
@@ -91,8 +187,8 @@ func handleAddKey(c *gin.Context) {
 		return
 	}
 
-	// 添加 API 密钥
-	config.AddApiKey(req.Key, req.Balance)
+	// 添加 API 密钥，重复提交同一个密钥时返回已有的记录
+	record, exists := config.AddApiKey(req.Key, req.Balance)
 
 	// 重新排序 API 密钥
 	config.SortApiKeysByBalance()
@@ -102,9 +198,15 @@ func handleAddKey(c *gin.Context) {
 		logger.Error("保存API密钥到数据库失败: %v", err)
 	}
 
+	message := "API密钥添加成功"
+	if exists {
+		message = "API密钥已存在，已更新余额"
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"message": "API密钥添加成功",
-		"balance": req.Balance,
+		"message":        message,
+		"id":             record.ID,
+		"balance":        record.Balance,
+		"already_exists": exists,
 	})
 }
 
@@ -215,6 +317,31 @@ func handleGetKeyMode(c *gin.Context) {
 	})
 }
 
+// keySelectionPauseState 返回密钥选择的暂停状态
+func keySelectionPauseState() gin.H {
+	return gin.H{
+		"paused":    key.IsKeySelectionPaused(),
+		"paused_at": key.GetKeySelectionPausedAt(),
+	}
+}
+
+// handleGetKeySelectionPause 获取密钥选择的暂停状态
+func handleGetKeySelectionPause(c *gin.Context) {
+	c.JSON(http.StatusOK, keySelectionPauseState())
+}
+
+// handlePauseKeySelection 暂停密钥选择，维护期间代理请求返回503，各密钥的启用状态不变
+func handlePauseKeySelection(c *gin.Context) {
+	key.PauseKeySelection()
+	c.JSON(http.StatusOK, keySelectionPauseState())
+}
+
+// handleResumeKeySelection 恢复密钥选择
+func handleResumeKeySelection(c *gin.Context) {
+	key.ResumeKeySelection()
+	c.JSON(http.StatusOK, keySelectionPauseState())
+}
+
 // handleBatchAddKeys 处理批量添加 API 密钥的请求
 func handleBatchAddKeys(c *gin.Context) {
 	var req struct {
@@ -233,7 +360,9 @@ func handleBatchAddKeys(c *gin.Context) {
 	// 添加所有 API 密钥
 	addedCount := 0
 	skippedCount := 0
+	existingCount := 0
 	for _, _key := range req.Keys {
+		_key = config.CanonicalApiKey(_key)
 		if _key != "" {
 			// 如果未提供余额，尝试检查余额
 			balance := req.Balance
@@ -246,8 +375,11 @@ func handleBatchAddKeys(c *gin.Context) {
 
 			// 根据AllowZeroBalance参数决定是否添加余额小于等于0的密钥
 			if balance > 0 || req.AllowZeroBalance {
-				config.AddApiKey(_key, balance)
-				addedCount++
+				if _, exists := config.AddApiKey(_key, balance); exists {
+					existingCount++
+				} else {
+					addedCount++
+				}
 			} else {
 				skippedCount++
 			}
@@ -263,9 +395,10 @@ func handleBatchAddKeys(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": fmt.Sprintf("成功添加 %d 个API密钥，跳过 %d 个余额小于或等于0的密钥", addedCount, skippedCount),
-		"added":   addedCount,
-		"skipped": skippedCount,
+		"message":  fmt.Sprintf("成功添加 %d 个API密钥，%d 个已存在的密钥已更新余额，跳过 %d 个余额小于或等于0的密钥", addedCount, existingCount, skippedCount),
+		"added":    addedCount,
+		"skipped":  skippedCount,
+		"existing": existingCount,
 	})
 }
 
@@ -305,37 +438,46 @@ func handleDeleteKey(c *gin.Context) {
 
 // handleStats 处理获取 API 密钥系统概要的请求
 func handleStats(c *gin.Context) {
-	keys := config.GetApiKeys()
+	keys := key.GetKeyPool().Keys()
 
 	// 计算系统概要
 	var totalBalance float64
-	var activeKeys int
 	var lastUsedTime int64
-	var disabledKeys int
 	var totalCalls int
 	var successCalls int
+	var clientErrors int
 	var avgSuccessRate float64
 	var activeKeysBalance float64
 
+	// 密钥数量直接在数据库中统计
+	totalKeys := config.GetKeyCount(config.KeyFilter{})
+	activeKeys := config.GetKeyCount(config.KeyFilter{Status: config.KeyStatusActive})
+	disabledKeys := config.GetKeyCount(config.KeyFilter{Status: config.KeyStatusDisabled})
+
+	minThreshold := 0.0
+	if config.GetConfig() != nil {
+		minThreshold = config.GetConfig().App.MinBalanceThreshold
+	}
+
 	for _, key := range keys {
-		totalBalance += key.Balance
-		if key.Balance > 0 && !key.Disabled {
-			activeKeys++
-			activeKeysBalance += key.Balance
+		// 未跟踪余额的密钥不计入余额汇总
+		if key.IsBalanceTracked() {
+			totalBalance += key.Balance
+			if !key.Disabled && key.Balance >= minThreshold {
+				activeKeysBalance += key.Balance
+			}
 		}
 		if key.LastUsed > lastUsedTime {
 			lastUsedTime = key.LastUsed
 		}
-		if key.Disabled {
-			disabledKeys++
-		}
 		totalCalls += key.TotalCalls
 		successCalls += key.SuccessCalls
+		clientErrors += key.ClientErrors
 	}
 
-	// 计算平均成功率
-	if totalCalls > 0 {
-		avgSuccessRate = float64(successCalls) / float64(totalCalls)
+	// 计算平均成功率，客户端错误不计入
+	if totalCalls-clientErrors > 0 {
+		avgSuccessRate = float64(successCalls) / float64(totalCalls-clientErrors)
 	} else {
 		avgSuccessRate = 0
 	}
@@ -349,7 +491,7 @@ func handleStats(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"total_keys":          len(keys),
+		"total_keys":          totalKeys,
 		"active_keys":         activeKeys,
 		"disabled_keys":       disabledKeys,
 		"total_balance":       totalBalance,
@@ -357,10 +499,38 @@ func handleStats(c *gin.Context) {
 		"last_used_time":      lastUsedTimeStr,
 		"total_calls":         totalCalls,
 		"success_calls":       successCalls,
+		"key_failures":        totalCalls - successCalls - clientErrors,
+		"client_errors":       clientErrors,
 		"avg_success_rate":    avgSuccessRate,
+		"clock_skew":          utils.GetClockSkewStatus(),
+		"data_version":        config.GetDataVersionStatus(),
 	})
 }
 
+// filterLogLevel 只保留不低于指定等级的日志行，未知等级时返回原内容
+func filterLogLevel(content []byte, level string) []byte {
+	var markers []string
+	switch strings.ToLower(level) {
+	case "error":
+		markers = []string{"ERROR: ", "FATAL: "}
+	case "warn", "warning":
+		markers = []string{"WARN: ", "ERROR: ", "FATAL: "}
+	default:
+		return content
+	}
+
+	var filtered []string
+	for _, line := range strings.Split(string(content), "\n") {
+		for _, marker := range markers {
+			if strings.Contains(line, marker) {
+				filtered = append(filtered, line)
+				break
+			}
+		}
+	}
+	return []byte(strings.Join(filtered, "\n"))
+}
+
 // handleGetLogs 处理获取日志的请求
 func handleGetLogs(c *gin.Context) {
 	// 获取最近的日志内容
@@ -381,6 +551,11 @@ func handleGetLogs(c *gin.Context) {
 		return
 	}
 
+	// 按日志等级过滤
+	if level := c.Query("level"); level != "" {
+		logContent = filterLogLevel(logContent, level)
+	}
+
 	// 如果日志文件太大，只返回最后的部分
 	const maxLogSize = 100 * 1024 // 100KB
 	if len(logContent) > maxLogSize {
@@ -478,18 +653,9 @@ func handleEnableKey(c *gin.Context) {
 	// 启用 API 密钥
 	if success := config.EnableApiKey(key); !success {
 		// 查找密钥检查是否存在
-		keys := config.GetApiKeys()
-		var keyExists bool
-		var balance float64
 		var minThreshold float64
-
-		for _, k := range keys {
-			if k.Key == key {
-				keyExists = true
-				balance = k.Balance
-				break
-			}
-		}
+		k, keyExists := findApiKey(key)
+		balance := k.Balance
 
 		if config.GetConfig() != nil {
 			minThreshold = config.GetConfig().App.MinBalanceThreshold
@@ -513,6 +679,246 @@ func handleEnableKey(c *gin.Context) {
 	})
 }
 
+// handleGetKeyGroups 处理获取密钥分组及其最近一小时流量分布的请求
+func handleGetKeyGroups(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"groups": key.GetKeyGroupStats(),
+	})
+}
+
+// handleGetKeyUsageRank 处理获取密钥按最近24小时请求数排名的请求
+func handleGetKeyUsageRank(c *gin.Context) {
+	c.JSON(http.StatusOK, key.GetKeyUsageRankInfo())
+}
+
+// handleGetKeyScoreDistribution 处理获取可用密钥得分分布的请求
+func handleGetKeyScoreDistribution(c *gin.Context) {
+	buckets, err := strconv.Atoi(c.DefaultQuery("buckets", strconv.Itoa(key.DefaultScoreBuckets)))
+	if err != nil || buckets <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "buckets参数无效",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"buckets": key.GroupKeysByScore(buckets),
+	})
+}
+
+// handleGetKeyGroupUsage 处理获取各分组和密钥池余额用量汇总的请求
+// format=csv时导出保留期内按日期和分组统计的用量
+func handleGetKeyGroupUsage(c *gin.Context) {
+	if c.Query("format") == "csv" {
+		var buf strings.Builder
+		writer := csv.NewWriter(&buf)
+		writer.Write([]string{"date", "group", "requests", "tokens", "cost"})
+		for _, entry := range config.GetGroupUsageHistory() {
+			writer.Write([]string{
+				entry.Date,
+				entry.Group,
+				strconv.Itoa(entry.Requests),
+				strconv.Itoa(entry.Tokens),
+				strconv.FormatFloat(entry.Cost, 'f', 4, 64),
+			})
+		}
+		writer.Flush()
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=flowsilicon-group-usage-%s.csv", time.Now().Format("20060102")))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", []byte(buf.String()))
+		return
+	}
+
+	c.JSON(http.StatusOK, key.GetKeyGroupDashboard())
+}
+
+// handleSimulateLoad 处理负载模拟请求，按当前密钥状态估算给定RPS下的错误率、延迟、费用和密钥耗尽概率
+func handleSimulateLoad(c *gin.Context) {
+	var req struct {
+		RPS             int    `json:"rps"`
+		DurationMinutes int    `json:"duration_minutes"`
+		Model           string `json:"model"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的请求数据: %v", err)})
+		return
+	}
+
+	result, err := key.SimulateLoadForModel(req.RPS, time.Duration(req.DurationMinutes)*time.Minute, req.Model)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// handleSetKeyGroup 处理设置密钥所属分组的请求
+func handleSetKeyGroup(c *gin.Context) {
+	apiKey := c.Param("key")
+
+	var req struct {
+		Group string `json:"group"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的请求数据: %v", err)})
+		return
+	}
+
+	if !config.SetApiKeyGroup(apiKey, req.Group) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API密钥不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "密钥分组设置成功",
+		"group":   config.GetKeyGroupName(config.ApiKey{Group: req.Group}),
+	})
+}
+
+// handleGetKeyBalanceHistory 处理获取密钥余额历史的请求，用于绘制余额趋势图
+func handleGetKeyBalanceHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("key"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密钥ID无效"})
+		return
+	}
+	if _, found := config.GetApiKeyByID(id); !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API密钥不存在"})
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days <= 0 || days > config.MaxBalanceHistoryDays {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("days参数必须在1到%d之间", config.MaxBalanceHistoryDays),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key_id": id,
+		"days":   days,
+		"points": config.GetKeyBalanceHistory(id, days),
+	})
+}
+
+// handleGetKeyFailureSources 获取最近24小时在密钥上引发失败的客户端及各错误分类的次数
+func handleGetKeyFailureSources(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("key"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密钥ID无效"})
+		return
+	}
+	apiKey, found := config.GetApiKeyByID(id)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API密钥不存在"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit参数必须是正整数"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key_id":  id,
+		"hours":   24,
+		"sources": key.GetKeyFailureSources(apiKey.Key, limit),
+	})
+}
+
+// handleGetAbuseStats 获取最近24小时错误率最高的客户端，错误只计算客户端原因的错误和限流
+func handleGetAbuseStats(c *gin.Context) {
+	minRequests, err := strconv.Atoi(c.DefaultQuery("min_requests", "1"))
+	if err != nil || minRequests < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_requests参数必须是非负整数"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit参数必须是正整数"})
+		return
+	}
+
+	cfg := config.GetConfig()
+	c.JSON(http.StatusOK, gin.H{
+		"hours":   24,
+		"clients": key.GetAbuseStats(minRequests, limit),
+		"throttle": gin.H{
+			"enabled":    cfg.App.AbuseThrottleErrorRate > 0,
+			"error_rate": cfg.App.AbuseThrottleErrorRate,
+		},
+	})
+}
+
+// handleClearClientThrottle 手动解除客户端的限流并清空其错误率统计
+func handleClearClientThrottle(c *gin.Context) {
+	var req struct {
+		Client string `json:"client" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("无效请求: %v", err),
+		})
+		return
+	}
+
+	cleared := key.ClearClientThrottle(req.Client)
+	c.JSON(http.StatusOK, gin.H{
+		"client":  req.Client,
+		"cleared": cleared,
+	})
+}
+
+// handleSetKeyBalance 处理设置API密钥余额模式和手动余额的请求
+func handleSetKeyBalance(c *gin.Context) {
+	apiKey := c.Param("key")
+
+	var req struct {
+		BalanceMode    string  `json:"balance_mode"`
+		Balance        float64 `json:"balance"`
+		CostPerRequest float64 `json:"cost_per_request"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的请求数据: %v", err)})
+		return
+	}
+
+	if err := config.SetApiKeyBalanceMode(apiKey, req.BalanceMode, req.Balance, req.CostPerRequest); err != nil {
+		if errors.Is(err, config.ErrApiKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API密钥不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 切换为自动模式后立即查询一次余额
+	if req.BalanceMode == "" || req.BalanceMode == config.BalanceModeAuto {
+		if updated, found := findApiKey(apiKey); found && updated.ID > 0 {
+			if err := key.ForceRefreshKeyBalance(updated.ID); err != nil {
+				logger.Error("刷新API密钥余额失败: %v", err)
+			}
+		}
+	}
+
+	updated, _ := findApiKey(apiKey)
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "密钥余额设置成功",
+		"balance_mode":     updated.GetBalanceMode(),
+		"balance":          updated.Balance,
+		"cost_per_request": updated.CostPerRequest,
+		"disabled":         updated.Disabled,
+	})
+}
+
+// findApiKey 在当前密钥列表中查找指定密钥
+func findApiKey(apiKey string) (config.ApiKey, bool) {
+	return key.GetKeyPool().Find(apiKey)
+}
+
 // handleDisableKey 处理禁用 API 密钥的请求
 func handleDisableKey(c *gin.Context) {
 	key := c.Param("key")
@@ -538,12 +944,12 @@ func handleDisableKey(c *gin.Context) {
 
 // handleDeleteZeroBalanceKeys 处理删除余额为0或负数的API密钥的请求
 func handleDeleteZeroBalanceKeys(c *gin.Context) {
-	keys := config.GetApiKeys()
+	keys := key.GetKeyPool().Keys()
 
 	// 过滤出余额小于或等于0的API密钥
 	var zeroOrNegativeBalanceKeys []string
 	for _, key := range keys {
-		if key.Balance <= 0 {
+		if key.IsBalanceTracked() && key.Balance <= 0 {
 			zeroOrNegativeBalanceKeys = append(zeroOrNegativeBalanceKeys, key.Key)
 		}
 	}
@@ -584,12 +990,12 @@ func handleDeleteLowBalanceKeys(c *gin.Context) {
 	}
 
 	// 获取活动的API密钥
-	keys := config.GetActiveApiKeys()
+	keys := key.GetKeyPool().ActiveKeys()
 
 	// 过滤出余额低于阈值的API密钥
 	var lowBalanceKeys []string
 	for _, key := range keys {
-		if key.Balance < threshold {
+		if key.IsBalanceTracked() && key.Balance < threshold {
 			lowBalanceKeys = append(lowBalanceKeys, key.Key)
 		}
 	}
@@ -626,7 +1032,7 @@ func handleRequestStats(c *gin.Context) {
 	tpd := config.GetCurrentTPD()
 
 	// 获取所有API密钥的统计数据
-	keys := config.GetApiKeys()
+	keys := key.GetKeyPool().Keys()
 	keyStats := make([]map[string]interface{}, 0)
 
 	for _, key := range keys {
@@ -635,20 +1041,23 @@ func handleRequestStats(c *gin.Context) {
 			continue
 		}
 
-		// 计算成功率
+		// 计算成功率，客户端错误不计入
 		successRate := 0.0
-		if key.TotalCalls > 0 {
-			successRate = float64(key.SuccessCalls) / float64(key.TotalCalls)
+		if key.TotalCalls-key.ClientErrors > 0 {
+			successRate = float64(key.SuccessCalls) / float64(key.TotalCalls-key.ClientErrors)
 		}
 
 		// 添加密钥的统计数据
 		keyStats = append(keyStats, map[string]interface{}{
-			"key":          key.Key,
-			"rpm":          key.RequestsPerMinute,
-			"tpm":          key.TokensPerMinute,
-			"total_calls":  key.TotalCalls,
-			"success_rate": successRate,
-			"score":        key.Score,
+			"key":           key.Key,
+			"rpm":           key.RPM.Current(),
+			"tpm":           key.TPM.Current(),
+			"total_calls":   key.TotalCalls,
+			"success_calls": key.SuccessCalls,
+			"key_failures":  key.KeyFailures(),
+			"client_errors": key.ClientErrors,
+			"success_rate":  successRate,
+			"score":         key.Score,
 		})
 	}
 
@@ -814,7 +1223,7 @@ func handleGetCurrentRequestStats(c *gin.Context) {
 	logger.Info("当前请求统计 - RPM: %d, TPM: %d, RPD: %d, TPD: %d", rpm, tpm, rpd, tpd)
 
 	// 获取所有API密钥
-	allKeys := config.GetApiKeys()
+	allKeys := key.GetKeyPool().Keys()
 
 	// 使用公共函数计算密钥得分
 	keysWithScores := key.CalculateKeyScores(allKeys)
@@ -835,11 +1244,13 @@ func handleGetCurrentRequestStats(c *gin.Context) {
 
 		keyStats = append(keyStats, map[string]interface{}{
 			"key":                  maskedKey,
-			"rpm":                  k.RequestsPerMinute,
-			"tpm":                  k.TokensPerMinute,
+			"rpm":                  k.RPM.Current(),
+			"tpm":                  k.TPM.Current(),
 			"disabled":             k.Disabled,
 			"total_calls":          k.TotalCalls,
 			"success_calls":        k.SuccessCalls,
+			"key_failures":         k.KeyFailures(),
+			"client_errors":        k.ClientErrors,
 			"success_rate":         k.SuccessRate,
 			"consecutive_failures": k.ConsecutiveFailures,
 			"score":                ks.Score, // 添加得分字段
@@ -872,54 +1283,169 @@ func handleGetDailyStats(c *gin.Context) {
 	})
 }
 
-// handleGetDailyStatsByDate 获取指定日期的统计数据
-func handleGetDailyStatsByDate(c *gin.Context) {
-	// 获取日期参数
-	date := c.Param("date")
-	if date == "" {
+// handleGetStatsComparison 对比当前周期与之前周期的统计，metric为requests、tokens或cost，period为day或week，offset为之前的周期数
+func handleGetStatsComparison(c *gin.Context) {
+	offset := 1
+	if value := c.Query("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "offset参数无效",
+			})
+			return
+		}
+		offset = parsed
+	}
+
+	comparison, err := config.CompareStats(c.DefaultQuery("metric", config.CompareMetricRequests), c.DefaultQuery("period", config.ComparePeriodWeek), offset)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "日期参数不能为空",
+			"error": err.Error(),
 		})
 		return
 	}
 
-	// 获取指定日期的统计数据
-	stats, err := config.GetDailyStats(date)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("获取每日统计数据失败: %v", err),
+	c.JSON(http.StatusOK, comparison)
+}
+
+// handleGetRealtimeStats 获取最近15分钟的每秒请求数、错误数和平均耗时
+// 传入上次返回的cursor作为since时只返回之后的数据
+func handleGetRealtimeStats(c *gin.Context) {
+	var since int64
+	if value := c.Query("since"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "since参数无效",
+			})
+			return
+		}
+		since = parsed
+	}
+
+	c.JSON(http.StatusOK, config.GetRealtimeMetrics(since))
+}
+
+// handleGetStreamAnomalies 获取各密钥出现超长或格式异常流式事件的次数
+func handleGetStreamAnomalies(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"max_event_bytes": proxy.StreamMaxEventBytes(),
+		"keys":            proxy.GetStreamAnomalies(),
+	})
+}
+
+// handleGetClientStats 获取按客户端IP或令牌汇总的每日用量
+func handleGetClientStats(c *gin.Context) {
+	date := c.DefaultQuery("date", config.StatsToday())
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "日期格式无效，应为YYYY-MM-DD",
 		})
 		return
 	}
 
-	if stats == nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": fmt.Sprintf("未找到日期 %s 的统计数据", date),
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "limit参数无效",
 		})
 		return
 	}
 
+	groupBy := "ip"
+	switch config.GetProxyAuthMode(config.GetConfig()) {
+	case config.AuthModeTokenList, config.AuthModeFixedSecret:
+		groupBy = "token"
+	case config.AuthModeAnyNonEmpty:
+		groupBy = "credential_hash"
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"stats": stats,
+		"date":     date,
+		"enabled":  config.IsClientUsageEnabled(),
+		"group_by": groupBy,
+		"clients":  config.GetDailyClientStats(date, limit),
 	})
 }
 
-// handleGetSettings 处理获取系统设置的请求
-func handleGetSettings(c *gin.Context) {
-	// 获取当前配置
-	cfg := config.GetConfig()
-	if cfg == nil {
+// handleGetShadowRecords 获取最近的影子流量记录，可按请求ID过滤
+func handleGetShadowRecords(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "limit参数无效",
+		})
+		return
+	}
+
+	records, err := config.GetShadowRecords(c.Query("request_id"), limit)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "无法获取系统配置",
+			"error": fmt.Sprintf("获取影子流量记录失败: %v", err),
 		})
 		return
 	}
 
-	// 创建与前端匹配的配置数据结构
-	configData := gin.H{
-		"server": gin.H{
-			"port": cfg.Server.Port,
-		},
+	c.JSON(http.StatusOK, gin.H{
+		"mirrored_today": config.GetDailyMirroredCount(),
+		"daily_budget":   config.GetShadowDailyBudget(),
+		"records":        records,
+	})
+}
+
+// handleGetDailyStatsByDate 获取指定日期的统计数据
+func handleGetDailyStatsByDate(c *gin.Context) {
+	// 获取日期参数
+	date := c.Param("date")
+	if date == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "日期参数不能为空",
+		})
+		return
+	}
+
+	// 获取指定日期的统计数据
+	stats, err := config.GetDailyStats(date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("获取每日统计数据失败: %v", err),
+		})
+		return
+	}
+
+	if stats == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("未找到日期 %s 的统计数据", date),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stats": stats,
+	})
+}
+
+// handleGetSettings 处理获取系统设置的请求
+func handleGetSettings(c *gin.Context) {
+	// 获取当前配置
+	cfg := config.GetConfig()
+	if cfg == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "无法获取系统配置",
+		})
+		return
+	}
+
+	// 创建与前端匹配的配置数据结构
+	configData := gin.H{
+		"server": gin.H{
+			"port":                     cfg.Server.Port,
+			"allow_port_fallback":      cfg.Server.AllowPortFallback,
+			"custom_dashboard_dir":     cfg.Server.CustomDashboardDir,
+			"shutdown_timeout_seconds": cfg.Server.ShutdownTimeoutSeconds,
+			"allowed_client_cidrs":     config.GetAllowedClientCIDRs(cfg),
+			"cors_allowed_origins":     cfg.Server.CorsAllowedOrigins,
+		},
 		"api_proxy": gin.H{
 			"base_url":             cfg.ApiProxy.BaseURL,
 			"model_index":          cfg.ApiProxy.ModelIndex,
@@ -939,35 +1465,125 @@ func handleGetSettings(c *gin.Context) {
 			"enabled":     cfg.Proxy.Enabled,
 		},
 		"security": gin.H{
-			"password_enabled":   cfg.Security.PasswordEnabled,
-			"expiration_minutes": cfg.Security.ExpirationMinutes,
-			"api_key_enabled":    cfg.Security.ApiKeyEnabled,
-			"api_key":            cfg.Security.ApiKey,
+			"password_enabled":           cfg.Security.PasswordEnabled,
+			"expiration_minutes":         cfg.Security.ExpirationMinutes,
+			"api_key_enabled":            cfg.Security.ApiKeyEnabled,
+			"api_key":                    cfg.Security.ApiKey,
+			"auth_mode":                  config.GetProxyAuthMode(cfg),
+			"client_tokens":              config.ListedClientTokens(cfg),
+			"client_token_max_choices":   config.ListedClientTokenMaxChoices(cfg),
+			"api_key_from_env":           os.Getenv(config.ProxySecretEnv) != "",
+			"token_delete_cooling_hours": cfg.Security.TokenDeleteCoolingHours,
 			// 不返回哈希后的密码
 		},
 		"app": gin.H{
-			"title":                         cfg.App.Title,
-			"min_balance_threshold":         cfg.App.MinBalanceThreshold,
-			"max_balance_display":           cfg.App.MaxBalanceDisplay,
-			"items_per_page":                cfg.App.ItemsPerPage,
-			"max_stats_entries":             cfg.App.MaxStatsEntries,
-			"recovery_interval":             cfg.App.RecoveryInterval,
-			"max_consecutive_failures":      cfg.App.MaxConsecutiveFailures,
-			"balance_weight":                cfg.App.BalanceWeight,
-			"success_rate_weight":           cfg.App.SuccessRateWeight,
-			"rpm_weight":                    cfg.App.RPMWeight,
-			"tpm_weight":                    cfg.App.TPMWeight,
-			"auto_update_interval":          cfg.App.AutoUpdateInterval,
-			"stats_refresh_interval":        cfg.App.StatsRefreshInterval,
-			"rate_refresh_interval":         cfg.App.RateRefreshInterval,
-			"auto_delete_zero_balance_keys": cfg.App.AutoDeleteZeroBalanceKeys,
-			"refresh_used_keys_interval":    cfg.App.RefreshUsedKeysInterval,
-			"hide_icon":                     cfg.App.HideIcon,
-			"disabled_models":               cfg.App.DisabledModels,
+			"title":                               cfg.App.Title,
+			"min_balance_threshold":               cfg.App.MinBalanceThreshold,
+			"max_balance_display":                 cfg.App.MaxBalanceDisplay,
+			"items_per_page":                      cfg.App.ItemsPerPage,
+			"max_stats_entries":                   cfg.App.MaxStatsEntries,
+			"recovery_give_up_hours":              cfg.App.RecoveryGiveUpHours,
+			"enforce_context_limits":              cfg.App.EnforceContextLimits,
+			"max_consecutive_failures":            cfg.App.MaxConsecutiveFailures,
+			"balance_weight":                      cfg.App.BalanceWeight,
+			"success_rate_weight":                 cfg.App.SuccessRateWeight,
+			"rpm_weight":                          cfg.App.RPMWeight,
+			"tpm_weight":                          cfg.App.TPMWeight,
+			"composite_weights":                   cfg.App.CompositeWeights,
+			"auto_update_interval":                cfg.App.AutoUpdateInterval,
+			"stats_refresh_interval":              cfg.App.StatsRefreshInterval,
+			"rate_refresh_interval":               cfg.App.RateRefreshInterval,
+			"auto_delete_zero_balance_keys":       cfg.App.AutoDeleteZeroBalanceKeys,
+			"refresh_used_keys_interval":          cfg.App.RefreshUsedKeysInterval,
+			"hide_icon":                           cfg.App.HideIcon,
+			"disabled_models":                     cfg.App.DisabledModels,
+			"key_groups":                          formatKeyGroups(cfg.App.KeyGroups),
+			"disable_client_usage":                cfg.App.DisableClientUsage,
+			"max_client_usage_entries":            cfg.App.MaxClientUsageEntries,
+			"snapshot_max_age_minutes":            cfg.App.SnapshotMaxAgeMinutes,
+			"key_rpm_limit":                       cfg.App.KeyRPMLimit,
+			"key_tpm_limit":                       cfg.App.KeyTPMLimit,
+			"cache_memory_budget_mb":              cfg.App.CacheMemoryBudgetMB,
+			"model_overrides":                     formatModelOverrides(cfg.App.ModelOverrides),
+			"upstream_proxy":                      cfg.App.UpstreamProxy,
+			"upstream_proxy_token_set":            cfg.App.UpstreamProxyToken != "", // 令牌只能写入，不返回令牌本身
+			"max_hops":                            cfg.App.MaxHops,
+			"model_mappings":                      cfg.App.ModelMappings,
+			"hide_upstream_models":                cfg.App.HideUpstreamModels,
+			"stream_first_byte_timeout_seconds":   cfg.App.StreamFirstByteTimeoutSeconds,
+			"stream_idle_timeout_seconds":         cfg.App.StreamIdleTimeoutSeconds,
+			"stream_max_event_kb":                 cfg.App.StreamMaxEventKB,
+			"allow_version_rollback":              cfg.App.AllowVersionRollback,
+			"abuse_throttle_error_rate":           cfg.App.AbuseThrottleErrorRate,
+			"abuse_throttle_min_requests":         cfg.App.AbuseThrottleMinRequests,
+			"abuse_throttle_rpm":                  cfg.App.AbuseThrottleRPM,
+			"abuse_throttle_minutes":              cfg.App.AbuseThrottleMinutes,
+			"metrics_half_life_seconds":           cfg.App.MetricsHalfLifeSeconds,
+			"max_concurrent_requests":             cfg.App.MaxConcurrentRequests,
+			"adaptive_concurrency":                cfg.App.AdaptiveConcurrency,
+			"adaptive_concurrency_min":            cfg.App.AdaptiveConcurrencyMin,
+			"adaptive_concurrency_max":            cfg.App.AdaptiveConcurrencyMax,
+			"adaptive_latency_threshold_ms":       cfg.App.AdaptiveLatencyThresholdMs,
+			"decision_log_sample_rate":            cfg.App.DecisionLogSampleRate,
+			"decision_log_max_size_mb":            cfg.App.DecisionLogMaxSizeMB,
+			"decision_log_max_files":              cfg.App.DecisionLogMaxFiles,
+			"decision_log_privacy_mode":           cfg.App.DecisionLogPrivacyMode,
+			"image_hosting":                       cfg.App.ImageHosting,
+			"image_hosting_ttl_minutes":           cfg.App.ImageHostingTTLMinutes,
+			"image_hosting_quota_mb":              cfg.App.ImageHostingQuotaMB,
+			"public_base_url":                     cfg.App.PublicBaseURL,
+			"privacy_mode":                        cfg.App.PrivacyMode,
+			"stats_timezone":                      cfg.App.StatsTimezone,
+			"catch_up_max_age_hours":              cfg.App.CatchUpMaxAgeHours,
+			"catch_up_spread_minutes":             cfg.App.CatchUpSpreadMinutes,
+			"max_retries":                         cfg.App.MaxRetries,
+			"rate_limit_cooldown_seconds":         cfg.App.RateLimitCooldownSeconds,
+			"circuit_breaker_threshold":           cfg.App.CircuitBreakerThreshold,
+			"circuit_breaker_max_backoff_minutes": cfg.App.CircuitBreakerMaxBackoffMinutes,
 		},
 		"log": gin.H{
-			"max_size_mb": cfg.Log.MaxSizeMB,
-			"level":       cfg.Log.Level,
+			"max_size_mb":       cfg.Log.MaxSizeMB,
+			"level":             cfg.Log.Level,
+			"multi_output":      cfg.Log.MultiOutput,
+			"max_files":         cfg.Log.MaxFiles,
+			"min_files":         cfg.Log.MinFiles,
+			"access_log_file":   cfg.Log.AccessLogFile,
+			"access_log_format": cfg.Log.AccessLogFormat,
+		},
+		"shadow_traffic": gin.H{
+			"rules":         formatShadowRules(cfg.ShadowTraffic.Rules),
+			"daily_budget":  cfg.ShadowTraffic.DailyBudget,
+			"store_content": cfg.ShadowTraffic.StoreContent,
+		},
+		"notification": gin.H{
+			"webhooks":             cfg.Notification.Webhooks,
+			"retry_ttl_minutes":    cfg.Notification.RetryTTLMinutes,
+			"outbox_size":          cfg.Notification.OutboxSize,
+			"desktop":              config.GetDesktopNotificationMode(),
+			"disabled_events":      cfg.Notification.DisabledEvents,
+			"legacy_payload":       cfg.Notification.LegacyPayload,
+			"signed_webhooks":      signedWebhooks(cfg),
+			"webhook_formats":      cfg.Notification.WebhookFormats,
+			"balance_threshold":    cfg.Notification.BalanceThreshold,
+			"pool_balance_floor":   cfg.Notification.PoolBalanceFloor,
+			"alert_cooldown_hours": cfg.Notification.AlertCooldownHours,
+		},
+		"providers": formatProviders(cfg.Providers),
+		"metrics": gin.H{
+			"enabled":   cfg.Metrics.Enabled,
+			"token_set": cfg.Metrics.Token != "", // 令牌只能写入，不返回令牌本身
+		},
+		"status_feed": gin.H{
+			"enabled":               cfg.StatusFeed.Enabled,
+			"token":                 cfg.StatusFeed.Token,
+			"rate_limit_per_minute": cfg.StatusFeed.RateLimitPerMinute,
+			"cache_seconds":         cfg.StatusFeed.CacheSeconds,
+			"balance_target":        cfg.StatusFeed.BalanceTarget,
+			"include_service":       cfg.StatusFeed.IncludeService,
+			"include_keys":          cfg.StatusFeed.IncludeKeys,
+			"include_balance":       cfg.StatusFeed.IncludeBalance,
+			"include_requests":      cfg.StatusFeed.IncludeRequests,
+			"include_upstream":      cfg.StatusFeed.IncludeUpstream,
 		},
 	}
 
@@ -975,6 +1591,285 @@ func handleGetSettings(c *gin.Context) {
 	c.JSON(http.StatusOK, configData)
 }
 
+// formatKeyGroups 将密钥分组配置转换为与前端匹配的数据结构
+func formatKeyGroups(groups []config.KeyGroupConfig) []gin.H {
+	result := make([]gin.H, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, gin.H{
+			"name":          group.Name,
+			"weight":        group.Weight,
+			"model_weights": group.ModelWeights,
+		})
+	}
+	return result
+}
+
+// formatModelOverrides 格式化模型覆盖配置用于设置接口返回
+func formatModelOverrides(overrides map[string]config.ModelOverride) gin.H {
+	result := make(gin.H, len(overrides))
+	for modelID, override := range overrides {
+		result[modelID] = gin.H{
+			"inject_default_max_tokens":  override.InjectDefaultMaxTokens,
+			"clamp_max_tokens":           override.ClampMaxTokens,
+			"truncation_policy":          override.TruncationPolicy,
+			"context_window":             override.ContextWindow,
+			"first_byte_timeout_seconds": override.FirstByteTimeoutSeconds,
+			"idle_timeout_seconds":       override.IdleTimeoutSeconds,
+			"max_choices":                override.MaxChoices,
+		}
+	}
+	return result
+}
+
+// parseModelOverrides 解析前端提交的模型覆盖配置，忽略模型ID为空的项
+func parseModelOverrides(items map[string]interface{}) map[string]config.ModelOverride {
+	overrides := make(map[string]config.ModelOverride, len(items))
+	for modelID, item := range items {
+		modelID = strings.TrimSpace(modelID)
+		data, ok := item.(map[string]interface{})
+		if modelID == "" || !ok {
+			continue
+		}
+
+		var override config.ModelOverride
+		override.InjectDefaultMaxTokens, _ = data["inject_default_max_tokens"].(bool)
+		override.ClampMaxTokens, _ = data["clamp_max_tokens"].(bool)
+		if policy, ok := data["truncation_policy"].(string); ok {
+			override.TruncationPolicy = strings.ToLower(strings.TrimSpace(policy))
+		}
+		if contextWindow, ok := data["context_window"].(float64); ok && contextWindow > 0 {
+			override.ContextWindow = int(contextWindow)
+		}
+		if firstByte, ok := data["first_byte_timeout_seconds"].(float64); ok && firstByte > 0 {
+			override.FirstByteTimeoutSeconds = int(firstByte)
+		}
+		if idle, ok := data["idle_timeout_seconds"].(float64); ok && idle > 0 {
+			override.IdleTimeoutSeconds = int(idle)
+		}
+		if maxChoices, ok := data["max_choices"].(float64); ok && maxChoices > 0 {
+			override.MaxChoices = int(maxChoices)
+		}
+		overrides[modelID] = override
+	}
+	return overrides
+}
+
+// formatShadowRules 格式化影子流量规则用于设置接口返回，不返回密钥明文
+func formatShadowRules(rules []config.ShadowRule) []gin.H {
+	result := make([]gin.H, 0, len(rules))
+	for _, rule := range rules {
+		maskedKey := ""
+		if rule.Key != "" {
+			maskedKey = config.MaskKey(rule.Key)
+		}
+		result = append(result, gin.H{
+			"model":        rule.Model,
+			"shadow_model": rule.ShadowModel,
+			"percentage":   rule.Percentage,
+			"key":          maskedKey,
+			"group":        rule.Group,
+		})
+	}
+	return result
+}
+
+// formatProviders 格式化服务商的附加请求头和签名配置用于设置接口返回，签名密钥脱敏
+func formatProviders(providers []config.ProviderRequestConfig) []gin.H {
+	result := make([]gin.H, 0, len(providers))
+	for _, rule := range providers {
+		maskedSecret := ""
+		if rule.Signing.Secret != "" {
+			maskedSecret = config.MaskKey(rule.Signing.Secret)
+		}
+		result = append(result, gin.H{
+			"provider": rule.Provider,
+			"headers":  rule.Headers,
+			"signing": gin.H{
+				"type":             rule.Signing.Type,
+				"secret":           maskedSecret,
+				"header":           rule.Signing.Header,
+				"timestamp_header": rule.Signing.TimestampHeader,
+				"canonical":        rule.Signing.Canonical,
+			},
+		})
+	}
+	return result
+}
+
+// parseProviders 解析前端提交的服务商附加请求头和签名配置，忽略服务商为空的配置
+// 提交的签名密钥为脱敏后的值时保留该服务商原有的签名密钥
+func parseProviders(items []interface{}) []config.ProviderRequestConfig {
+	var existing []config.ProviderRequestConfig
+	if cfg := config.GetConfig(); cfg != nil {
+		existing = cfg.Providers
+	}
+
+	providers := make([]config.ProviderRequestConfig, 0, len(items))
+	for _, item := range items {
+		data, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var rule config.ProviderRequestConfig
+		rule.Provider, _ = data["provider"].(string)
+		rule.Provider = strings.TrimSpace(rule.Provider)
+		if rule.Provider == "" {
+			continue
+		}
+		if headers, ok := data["headers"].(map[string]interface{}); ok {
+			rule.Headers = make(map[string]string, len(headers))
+			for name, value := range headers {
+				if v, ok := value.(string); ok && strings.TrimSpace(name) != "" {
+					rule.Headers[strings.TrimSpace(name)] = v
+				}
+			}
+		}
+		if signingData, ok := data["signing"].(map[string]interface{}); ok {
+			rule.Signing.Type, _ = signingData["type"].(string)
+			rule.Signing.Secret, _ = signingData["secret"].(string)
+			rule.Signing.Header, _ = signingData["header"].(string)
+			rule.Signing.TimestampHeader, _ = signingData["timestamp_header"].(string)
+			rule.Signing.Canonical, _ = signingData["canonical"].(string)
+			rule.Signing.Type = strings.TrimSpace(rule.Signing.Type)
+			for _, old := range existing {
+				if old.Provider == rule.Provider && old.Signing.Secret != "" && rule.Signing.Secret == config.MaskKey(old.Signing.Secret) {
+					rule.Signing.Secret = old.Signing.Secret
+					break
+				}
+			}
+		}
+		providers = append(providers, rule)
+	}
+	return providers
+}
+
+// parseShadowRules 解析前端提交的影子流量规则，忽略模型为空的规则
+// 提交的密钥为脱敏后的值时保留原有密钥
+func parseShadowRules(items []interface{}) []config.ShadowRule {
+	var existing []config.ShadowRule
+	if cfg := config.GetConfig(); cfg != nil {
+		existing = cfg.ShadowTraffic.Rules
+	}
+
+	rules := make([]config.ShadowRule, 0, len(items))
+	for _, item := range items {
+		data, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var rule config.ShadowRule
+		rule.Model, _ = data["model"].(string)
+		rule.ShadowModel, _ = data["shadow_model"].(string)
+		rule.Model = strings.TrimSpace(rule.Model)
+		rule.ShadowModel = strings.TrimSpace(rule.ShadowModel)
+		if rule.Model == "" || rule.ShadowModel == "" {
+			continue
+		}
+		if percentage, ok := data["percentage"].(float64); ok {
+			rule.Percentage = math.Max(0, math.Min(100, percentage))
+		}
+		rule.Group, _ = data["group"].(string)
+		rule.Group = strings.TrimSpace(rule.Group)
+
+		rule.Key, _ = data["key"].(string)
+		rule.Key = strings.TrimSpace(rule.Key)
+		for _, old := range existing {
+			if old.Key != "" && rule.Key == config.MaskKey(old.Key) {
+				rule.Key = old.Key
+				break
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// parseKeyGroups 解析前端提交的密钥分组配置，忽略名称为空的分组
+func parseKeyGroups(items []interface{}) []config.KeyGroupConfig {
+	groups := make([]config.KeyGroupConfig, 0, len(items))
+	for _, item := range items {
+		groupData, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _ := groupData["name"].(string)
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		group := config.KeyGroupConfig{Name: name}
+		if weight, ok := groupData["weight"].(float64); ok && weight > 0 {
+			group.Weight = int(weight)
+		}
+		if modelWeights, ok := groupData["model_weights"].(map[string]interface{}); ok {
+			group.ModelWeights = make(map[string]int, len(modelWeights))
+			for modelID, weight := range modelWeights {
+				if w, ok := weight.(float64); ok && w >= 0 {
+					group.ModelWeights[modelID] = int(w)
+				}
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// handleGetConfigHash 处理获取配置哈希的请求
+// 客户端可以频繁轮询该接口，仅在哈希变化时再获取完整配置
+func handleGetConfigHash(c *gin.Context) {
+	hash := config.GetConfigHash()
+	if hash == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "无法获取系统配置",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hash":       hash,
+		"updated_at": config.GetConfigHashUpdatedAt().Format(time.RFC3339),
+	})
+}
+
+// parseClientTokens 解析设置中的客户端令牌列表，去掉空白和重复的令牌
+func parseClientTokens(values []interface{}) []string {
+	tokens := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		token, ok := value.(string)
+		token = strings.TrimSpace(token)
+		if !ok || token == "" || seen[token] {
+			continue
+		}
+		seen[token] = true
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// parseClientTokenMaxChoices 解析设置中每个客户端令牌的候选结果数上限，只保留令牌列表中的令牌和大于0的上限
+func parseClientTokenMaxChoices(values map[string]interface{}, tokens []string) map[string]int {
+	limits := make(map[string]int, len(values))
+	for token, value := range values {
+		token = strings.TrimSpace(token)
+		limit, ok := value.(float64)
+		if !ok || limit < 1 {
+			continue
+		}
+		for _, listed := range tokens {
+			if listed == token {
+				limits[token] = int(limit)
+				break
+			}
+		}
+	}
+	return limits
+}
+
 // handleSaveSettings 处理保存系统设置的请求
 func handleSaveSettings(c *gin.Context) {
 	// 获取设置数据
@@ -1020,8 +1915,21 @@ func handleSaveSettings(c *gin.Context) {
 		// 检查是否尝试启用API密钥验证但没有提供API密钥
 		apiKeyEnabled, apiKeyEnabledExists := security["api_key_enabled"].(bool)
 		apiKey, apiKeyExists := security["api_key"].(string)
+		authMode, authModeExists := security["auth_mode"].(string)
 
-		if apiKeyEnabledExists && apiKeyEnabled {
+		if authModeExists && !config.IsValidAuthMode(authMode) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("无效的代理验证方式: %s", authMode),
+				"code":  "invalid_auth_mode",
+			})
+			return
+		}
+
+		requireSecret := apiKeyEnabledExists && apiKeyEnabled
+		if authModeExists {
+			requireSecret = authMode == config.AuthModeFixedSecret
+		}
+		if requireSecret && os.Getenv(config.ProxySecretEnv) == "" {
 			// 如果当前没有API密钥，且没有提供新API密钥，则返回错误
 			if currentConfig.Security.ApiKey == "" && (!apiKeyExists || apiKey == "") {
 				c.JSON(http.StatusBadRequest, gin.H{
@@ -1031,16 +1939,67 @@ func handleSaveSettings(c *gin.Context) {
 				return
 			}
 		}
+
+		if authModeExists && authMode == config.AuthModeTokenList {
+			tokens, _ := security["client_tokens"].([]interface{})
+			if len(parseClientTokens(tokens)) == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "使用客户端令牌列表验证时至少需要一个令牌",
+					"code":  "client_tokens_required",
+				})
+				return
+			}
+		}
 	}
 
-	// 创建一个新的Config对象进行更新
-	newConfig := *currentConfig
+	// 复制当前配置进行更新，正在处理的请求继续使用原配置
+	newConfig := *currentConfig.Clone()
 
 	// 服务器设置
 	if server, ok := configData["server"].(map[string]interface{}); ok {
 		if port, ok := server["port"].(float64); ok {
 			newConfig.Server.Port = int(port)
 		}
+		if allowFallback, ok := server["allow_port_fallback"].(bool); ok {
+			newConfig.Server.AllowPortFallback = allowFallback
+		}
+		if dashboardDir, ok := server["custom_dashboard_dir"].(string); ok {
+			dashboardDir = strings.TrimSpace(dashboardDir)
+			if dashboardDir != "" && config.ContainsConfigDB(dashboardDir) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "自定义仪表盘目录不能包含配置数据库，请使用单独的目录",
+					"code":  "invalid_custom_dashboard_dir",
+				})
+				return
+			}
+			newConfig.Server.CustomDashboardDir = dashboardDir
+		}
+		if timeout, ok := server["shutdown_timeout_seconds"].(float64); ok && timeout > 0 {
+			newConfig.Server.ShutdownTimeoutSeconds = int(timeout)
+		}
+		if values, ok := server["allowed_client_cidrs"].([]interface{}); ok {
+			// 与客户端令牌相同，去掉空白和重复的项
+			cidrs := parseClientTokens(values)
+			if _, err := config.ParseClientCIDRs(cidrs); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": err.Error(),
+					"code":  "invalid_client_cidrs",
+				})
+				return
+			}
+			newConfig.Server.AllowedClientCIDRs = cidrs
+		}
+		if values, ok := server["cors_allowed_origins"].([]interface{}); ok {
+			origins, err := config.ParseCorsOrigins(parseClientTokens(values))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": err.Error(),
+					"code":  "invalid_cors_origins",
+				})
+				return
+			}
+			newConfig.Server.CorsAllowedOrigins = origins
+		}
 	}
 
 	// API代理设置
@@ -1057,9 +2016,15 @@ func handleSaveSettings(c *gin.Context) {
 			// 清空现有策略
 			newConfig.App.ModelKeyStrategies = make(map[string]int)
 
-			// 添加新策略
+			// 添加新策略，拒绝无效的策略ID，避免按默认策略静默处理
 			for modelName, strategy := range modelKeyStrategies {
 				if strategyValue, ok := strategy.(float64); ok {
+					if !key.IsValidStrategyID(int(strategyValue)) {
+						c.JSON(http.StatusBadRequest, gin.H{
+							"error": fmt.Sprintf("模型 %s 的策略ID %v 无效，应在%d到%d之间", modelName, strategyValue, key.MinStrategyID, key.MaxStrategyID),
+						})
+						return
+					}
 					newConfig.App.ModelKeyStrategies[modelName] = int(strategyValue)
 				}
 			}
@@ -1119,11 +2084,28 @@ func handleSaveSettings(c *gin.Context) {
 		// 处理API密钥设置
 		if apiKeyEnabled, ok := security["api_key_enabled"].(bool); ok {
 			newConfig.Security.ApiKeyEnabled = apiKeyEnabled
+			// 只设置了api_key_enabled时按该字段推断验证方式
+			newConfig.Security.AuthMode = ""
 		}
 		if apiKey, ok := security["api_key"].(string); ok {
 			// 允许空API密钥，这样用户可以清除API密钥设置
 			newConfig.Security.ApiKey = apiKey
 		}
+		// 设置了验证方式时同步api_key_enabled，兼容只认识该字段的旧版本
+		if authMode, ok := security["auth_mode"].(string); ok {
+			newConfig.Security.AuthMode = authMode
+			newConfig.Security.ApiKeyEnabled = authMode != config.AuthModeNone
+		}
+		if tokens, ok := security["client_tokens"].([]interface{}); ok {
+			// 从列表中移除的令牌先吊销，超过冷却期后才删除
+			config.ApplySavedClientTokens(&newConfig, parseClientTokens(tokens), time.Now())
+		}
+		if limits, ok := security["client_token_max_choices"].(map[string]interface{}); ok {
+			newConfig.Security.ClientTokenMaxChoices = parseClientTokenMaxChoices(limits, config.ListedClientTokens(&newConfig))
+		}
+		if coolingHours, ok := security["token_delete_cooling_hours"].(float64); ok && coolingHours >= 0 {
+			newConfig.Security.TokenDeleteCoolingHours = int(coolingHours)
+		}
 
 		// 处理密码，如果提供了新密码则进行哈希处理
 		if password, ok := security["password"].(string); ok && password != "" {
@@ -1149,8 +2131,11 @@ func handleSaveSettings(c *gin.Context) {
 		if maxStats, ok := app["max_stats_entries"].(float64); ok {
 			newConfig.App.MaxStatsEntries = int(maxStats)
 		}
-		if recoveryInterval, ok := app["recovery_interval"].(float64); ok {
-			newConfig.App.RecoveryInterval = int(recoveryInterval)
+		if giveUpHours, ok := app["recovery_give_up_hours"].(float64); ok && giveUpHours >= 0 {
+			newConfig.App.RecoveryGiveUpHours = int(giveUpHours)
+		}
+		if enforceContext, ok := app["enforce_context_limits"].(bool); ok {
+			newConfig.App.EnforceContextLimits = enforceContext
 		}
 		if maxFailures, ok := app["max_consecutive_failures"].(float64); ok {
 			newConfig.App.MaxConsecutiveFailures = int(maxFailures)
@@ -1172,6 +2157,20 @@ func handleSaveSettings(c *gin.Context) {
 		if tpmWeight, ok := app["tpm_weight"].(float64); ok {
 			newConfig.App.TPMWeight = tpmWeight
 		}
+		if weights, ok := app["composite_weights"].(map[string]interface{}); ok {
+			if balance, ok := weights["balance"].(float64); ok && balance >= 0 {
+				newConfig.App.CompositeWeights.Balance = balance
+			}
+			if success, ok := weights["success"].(float64); ok && success >= 0 {
+				newConfig.App.CompositeWeights.Success = success
+			}
+			if rpm, ok := weights["rpm"].(float64); ok && rpm >= 0 {
+				newConfig.App.CompositeWeights.RPM = rpm
+			}
+			if tpm, ok := weights["tpm"].(float64); ok && tpm >= 0 {
+				newConfig.App.CompositeWeights.TPM = tpm
+			}
+		}
 
 		// 自动更新配置
 		if autoUpdate, ok := app["auto_update_interval"].(float64); ok {
@@ -1201,6 +2200,188 @@ func handleSaveSettings(c *gin.Context) {
 				}
 			}
 		}
+
+		// 处理密钥分组权重
+		if keyGroups, ok := app["key_groups"].([]interface{}); ok {
+			newConfig.App.KeyGroups = parseKeyGroups(keyGroups)
+		}
+
+		// 处理模型级别的请求处理覆盖
+		if modelOverrides, ok := app["model_overrides"].(map[string]interface{}); ok {
+			newConfig.App.ModelOverrides = parseModelOverrides(modelOverrides)
+		}
+
+		// 客户端用量统计
+		if disableClientUsage, ok := app["disable_client_usage"].(bool); ok {
+			newConfig.App.DisableClientUsage = disableClientUsage
+		}
+		if maxClients, ok := app["max_client_usage_entries"].(float64); ok {
+			newConfig.App.MaxClientUsageEntries = int(maxClients)
+		}
+
+		// 密钥池快照
+		if snapshotMaxAge, ok := app["snapshot_max_age_minutes"].(float64); ok {
+			newConfig.App.SnapshotMaxAgeMinutes = int(snapshotMaxAge)
+		}
+
+		// 单个密钥的限流
+		if rpmLimit, ok := app["key_rpm_limit"].(float64); ok && rpmLimit >= 0 {
+			newConfig.App.KeyRPMLimit = int(rpmLimit)
+		}
+		if tpmLimit, ok := app["key_tpm_limit"].(float64); ok && tpmLimit >= 0 {
+			newConfig.App.KeyTPMLimit = int(tpmLimit)
+		}
+
+		// 内存缓存
+		if budget, ok := app["cache_memory_budget_mb"].(float64); ok && budget >= 0 {
+			newConfig.App.CacheMemoryBudgetMB = int(budget)
+		}
+
+		// 多级代理
+		if upstream, ok := app["upstream_proxy"].(string); ok {
+			newConfig.App.UpstreamProxy = strings.TrimRight(strings.TrimSpace(upstream), "/")
+		}
+		// 设置接口不返回令牌，未提交时保留原有的令牌，提交空字符串时清除
+		if token, ok := app["upstream_proxy_token"].(string); ok {
+			newConfig.App.UpstreamProxyToken = strings.TrimSpace(token)
+		}
+		if maxHops, ok := app["max_hops"].(float64); ok && maxHops >= 0 {
+			newConfig.App.MaxHops = int(maxHops)
+		}
+
+		// 虚拟模型
+		if mappings, ok := app["model_mappings"].(map[string]interface{}); ok {
+			newConfig.App.ModelMappings = make(map[string]string, len(mappings))
+			for alias, value := range mappings {
+				target, ok := value.(string)
+				alias = strings.TrimSpace(alias)
+				target = strings.TrimSpace(target)
+				if !ok || alias == "" || target == "" || alias == target {
+					continue
+				}
+				newConfig.App.ModelMappings[alias] = target
+			}
+		}
+		if hideUpstream, ok := app["hide_upstream_models"].(bool); ok {
+			newConfig.App.HideUpstreamModels = hideUpstream
+		}
+
+		// 流式响应超时
+		if firstByte, ok := app["stream_first_byte_timeout_seconds"].(float64); ok && firstByte >= 0 {
+			newConfig.App.StreamFirstByteTimeoutSeconds = int(firstByte)
+		}
+		if idle, ok := app["stream_idle_timeout_seconds"].(float64); ok && idle >= 0 {
+			newConfig.App.StreamIdleTimeoutSeconds = int(idle)
+		}
+		if maxEvent, ok := app["stream_max_event_kb"].(float64); ok && maxEvent >= 0 {
+			newConfig.App.StreamMaxEventKB = int(maxEvent)
+		}
+
+		// 版本回滚
+		if allowRollback, ok := app["allow_version_rollback"].(bool); ok {
+			newConfig.App.AllowVersionRollback = allowRollback
+		}
+
+		// 客户端错误率限流
+		if errorRate, ok := app["abuse_throttle_error_rate"].(float64); ok && errorRate >= 0 && errorRate <= 1 {
+			newConfig.App.AbuseThrottleErrorRate = errorRate
+		}
+		if minRequests, ok := app["abuse_throttle_min_requests"].(float64); ok && minRequests >= 0 {
+			newConfig.App.AbuseThrottleMinRequests = int(minRequests)
+		}
+		if throttleRPM, ok := app["abuse_throttle_rpm"].(float64); ok && throttleRPM >= 0 {
+			newConfig.App.AbuseThrottleRPM = int(throttleRPM)
+		}
+		if throttleMinutes, ok := app["abuse_throttle_minutes"].(float64); ok && throttleMinutes >= 0 {
+			newConfig.App.AbuseThrottleMinutes = int(throttleMinutes)
+		}
+
+		// 密钥平滑指标
+		if halfLife, ok := app["metrics_half_life_seconds"].(float64); ok && halfLife >= 0 {
+			newConfig.App.MetricsHalfLifeSeconds = int(halfLife)
+		}
+
+		// 上游并发限制
+		if maxConcurrent, ok := app["max_concurrent_requests"].(float64); ok && maxConcurrent >= 0 {
+			newConfig.App.MaxConcurrentRequests = int(maxConcurrent)
+		}
+		if adaptive, ok := app["adaptive_concurrency"].(bool); ok {
+			newConfig.App.AdaptiveConcurrency = adaptive
+		}
+		if minLimit, ok := app["adaptive_concurrency_min"].(float64); ok && minLimit >= 0 {
+			newConfig.App.AdaptiveConcurrencyMin = int(minLimit)
+		}
+		if maxLimit, ok := app["adaptive_concurrency_max"].(float64); ok && maxLimit >= 0 {
+			newConfig.App.AdaptiveConcurrencyMax = int(maxLimit)
+		}
+		if threshold, ok := app["adaptive_latency_threshold_ms"].(float64); ok && threshold >= 0 {
+			newConfig.App.AdaptiveLatencyThresholdMs = int(threshold)
+		}
+
+		// 密钥选择决策日志
+		if sampleRate, ok := app["decision_log_sample_rate"].(float64); ok && sampleRate >= 0 && sampleRate <= 1 {
+			newConfig.App.DecisionLogSampleRate = sampleRate
+		}
+		if maxSize, ok := app["decision_log_max_size_mb"].(float64); ok && maxSize >= 0 {
+			newConfig.App.DecisionLogMaxSizeMB = int(maxSize)
+		}
+		if maxFiles, ok := app["decision_log_max_files"].(float64); ok && maxFiles >= 0 {
+			newConfig.App.DecisionLogMaxFiles = int(maxFiles)
+		}
+		if privacyMode, ok := app["decision_log_privacy_mode"].(bool); ok {
+			newConfig.App.DecisionLogPrivacyMode = privacyMode
+		}
+
+		// 图片托管
+		if imageHosting, ok := app["image_hosting"].(bool); ok {
+			newConfig.App.ImageHosting = imageHosting
+		}
+		if ttl, ok := app["image_hosting_ttl_minutes"].(float64); ok && ttl >= 0 {
+			newConfig.App.ImageHostingTTLMinutes = int(ttl)
+		}
+		if quota, ok := app["image_hosting_quota_mb"].(float64); ok && quota >= 0 {
+			newConfig.App.ImageHostingQuotaMB = int(quota)
+		}
+		if baseURL, ok := app["public_base_url"].(string); ok {
+			newConfig.App.PublicBaseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+		}
+		if privacyMode, ok := app["privacy_mode"].(bool); ok {
+			newConfig.App.PrivacyMode = privacyMode
+		}
+
+		// 统计时区，无效的时区不保存
+		if timezone, ok := app["stats_timezone"].(string); ok {
+			timezone = strings.TrimSpace(timezone)
+			if !config.IsValidStatsTimezone(timezone) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的统计时区: %s", timezone)})
+				return
+			}
+			newConfig.App.StatsTimezone = timezone
+		}
+
+		// 休眠唤醒后的补执行
+		if maxAge, ok := app["catch_up_max_age_hours"].(float64); ok && maxAge >= 0 {
+			newConfig.App.CatchUpMaxAgeHours = int(maxAge)
+		}
+		if spread, ok := app["catch_up_spread_minutes"].(float64); ok && spread >= 0 {
+			newConfig.App.CatchUpSpreadMinutes = int(spread)
+		}
+
+		// 换密钥重试
+		if maxRetries, ok := app["max_retries"].(float64); ok {
+			newConfig.App.MaxRetries = int(maxRetries)
+		}
+		if cooldown, ok := app["rate_limit_cooldown_seconds"].(float64); ok && cooldown >= 0 {
+			newConfig.App.RateLimitCooldownSeconds = int(cooldown)
+		}
+
+		// 密钥断路器
+		if threshold, ok := app["circuit_breaker_threshold"].(float64); ok && threshold >= 0 {
+			newConfig.App.CircuitBreakerThreshold = int(threshold)
+		}
+		if maxBackoff, ok := app["circuit_breaker_max_backoff_minutes"].(float64); ok && maxBackoff >= 0 {
+			newConfig.App.CircuitBreakerMaxBackoffMinutes = int(maxBackoff)
+		}
 	}
 
 	// 日志设置
@@ -1211,8 +2392,193 @@ func handleSaveSettings(c *gin.Context) {
 		if level, ok := log["level"].(string); ok {
 			newConfig.Log.Level = level
 		}
+		if multiOutput, ok := log["multi_output"].(bool); ok {
+			newConfig.Log.MultiOutput = multiOutput
+		}
+		if maxFiles, ok := log["max_files"].(float64); ok && maxFiles >= 1 {
+			newConfig.Log.MaxFiles = int(maxFiles)
+		}
+		if minFiles, ok := log["min_files"].(float64); ok && minFiles >= 1 {
+			newConfig.Log.MinFiles = int(minFiles)
+		}
+		if accessLogFile, ok := log["access_log_file"].(string); ok {
+			newConfig.Log.AccessLogFile = strings.TrimSpace(accessLogFile)
+		}
+		if accessLogFormat, ok := log["access_log_format"].(string); ok {
+			newConfig.Log.AccessLogFormat = strings.ToLower(strings.TrimSpace(accessLogFormat))
+		}
+	}
+
+	// 影子流量设置
+	if shadowTraffic, ok := configData["shadow_traffic"].(map[string]interface{}); ok {
+		if rules, ok := shadowTraffic["rules"].([]interface{}); ok {
+			newConfig.ShadowTraffic.Rules = parseShadowRules(rules)
+		}
+		if dailyBudget, ok := shadowTraffic["daily_budget"].(float64); ok && dailyBudget >= 0 {
+			newConfig.ShadowTraffic.DailyBudget = int(dailyBudget)
+		}
+		if storeContent, ok := shadowTraffic["store_content"].(bool); ok {
+			newConfig.ShadowTraffic.StoreContent = storeContent
+		}
+	}
+
+	// Prometheus指标接口设置
+	if metrics, ok := configData["metrics"].(map[string]interface{}); ok {
+		if enabled, ok := metrics["enabled"].(bool); ok {
+			newConfig.Metrics.Enabled = enabled
+		}
+		// 设置接口不返回令牌，未提交时保留原有的令牌，提交空字符串时清除
+		if token, ok := metrics["token"].(string); ok {
+			newConfig.Metrics.Token = strings.TrimSpace(token)
+		}
+	}
+
+	// 服务商的附加请求头和签名
+	if providers, ok := configData["providers"].([]interface{}); ok {
+		parsed := parseProviders(providers)
+		if err := signing.ValidateProviders(parsed); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+				"code":  "invalid_providers",
+			})
+			return
+		}
+		newConfig.Providers = parsed
+	}
+
+	// 通知设置
+	if notification, ok := configData["notification"].(map[string]interface{}); ok {
+		if webhooks, ok := notification["webhooks"].([]interface{}); ok {
+			newConfig.Notification.Webhooks = make([]string, 0, len(webhooks))
+			for _, item := range webhooks {
+				if webhook, ok := item.(string); ok && strings.TrimSpace(webhook) != "" {
+					newConfig.Notification.Webhooks = append(newConfig.Notification.Webhooks, strings.TrimSpace(webhook))
+				}
+			}
+		}
+		if ttl, ok := notification["retry_ttl_minutes"].(float64); ok && ttl >= 0 {
+			newConfig.Notification.RetryTTLMinutes = int(ttl)
+		}
+		if size, ok := notification["outbox_size"].(float64); ok && size >= 0 {
+			newConfig.Notification.OutboxSize = int(size)
+		}
+		if desktop, ok := notification["desktop"].(string); ok {
+			switch desktop = strings.ToLower(strings.TrimSpace(desktop)); desktop {
+			case config.DesktopNotificationAuto, config.DesktopNotificationOn, config.DesktopNotificationOff:
+				newConfig.Notification.Desktop = desktop
+			}
+		}
+		if events, ok := notification["disabled_events"].([]interface{}); ok {
+			newConfig.Notification.DisabledEvents = make([]string, 0, len(events))
+			for _, item := range events {
+				if event, ok := item.(string); ok && strings.TrimSpace(event) != "" {
+					newConfig.Notification.DisabledEvents = append(newConfig.Notification.DisabledEvents, strings.TrimSpace(event))
+				}
+			}
+		}
+		if legacy, ok := notification["legacy_payload"].(bool); ok {
+			newConfig.Notification.LegacyPayload = legacy
+		}
+		// 签名密钥只修改请求中包含的webhook，值为空字符串时移除
+		if secrets, ok := notification["webhook_secrets"].(map[string]interface{}); ok {
+			if newConfig.Notification.WebhookSecrets == nil {
+				newConfig.Notification.WebhookSecrets = make(map[string]string)
+			}
+			for webhook, value := range secrets {
+				secret, ok := value.(string)
+				if !ok {
+					continue
+				}
+				if secret = strings.TrimSpace(secret); secret == "" {
+					delete(newConfig.Notification.WebhookSecrets, strings.TrimSpace(webhook))
+				} else {
+					newConfig.Notification.WebhookSecrets[strings.TrimSpace(webhook)] = secret
+				}
+			}
+		}
+		// 消息格式只修改请求中包含的webhook，值为空字符串或generic时移除
+		if formats, ok := notification["webhook_formats"].(map[string]interface{}); ok {
+			if newConfig.Notification.WebhookFormats == nil {
+				newConfig.Notification.WebhookFormats = make(map[string]string)
+			}
+			for webhook, value := range formats {
+				format, ok := value.(string)
+				if !ok {
+					continue
+				}
+				format = strings.ToLower(strings.TrimSpace(format))
+				if !config.IsValidWebhookFormat(format) {
+					c.JSON(http.StatusBadRequest, gin.H{
+						"error": fmt.Sprintf("无效的webhook消息格式: %s，可选值为 generic、feishu、dingtalk", format),
+					})
+					return
+				}
+				if format == "" || format == config.WebhookFormatGeneric {
+					delete(newConfig.Notification.WebhookFormats, strings.TrimSpace(webhook))
+				} else {
+					newConfig.Notification.WebhookFormats[strings.TrimSpace(webhook)] = format
+				}
+			}
+		}
+		// 已移除的webhook不再保留签名密钥和消息格式
+		for webhook := range newConfig.Notification.WebhookSecrets {
+			if !containsString(newConfig.Notification.Webhooks, webhook) {
+				delete(newConfig.Notification.WebhookSecrets, webhook)
+			}
+		}
+		for webhook := range newConfig.Notification.WebhookFormats {
+			if !containsString(newConfig.Notification.Webhooks, webhook) {
+				delete(newConfig.Notification.WebhookFormats, webhook)
+			}
+		}
+		if threshold, ok := notification["balance_threshold"].(float64); ok && threshold >= 0 {
+			newConfig.Notification.BalanceThreshold = threshold
+		}
+		if floor, ok := notification["pool_balance_floor"].(float64); ok && floor >= 0 {
+			newConfig.Notification.PoolBalanceFloor = floor
+		}
+		if hours, ok := notification["alert_cooldown_hours"].(float64); ok && hours >= 0 {
+			newConfig.Notification.AlertCooldownHours = int(hours)
+		}
 	}
 
+	// 公开状态数据设置
+	if statusFeed, ok := configData["status_feed"].(map[string]interface{}); ok {
+		if enabled, ok := statusFeed["enabled"].(bool); ok {
+			newConfig.StatusFeed.Enabled = enabled
+		}
+		if token, ok := statusFeed["token"].(string); ok {
+			newConfig.StatusFeed.Token = strings.TrimSpace(token)
+		}
+		if rateLimit, ok := statusFeed["rate_limit_per_minute"].(float64); ok && rateLimit >= 1 {
+			newConfig.StatusFeed.RateLimitPerMinute = int(rateLimit)
+		}
+		if cacheSeconds, ok := statusFeed["cache_seconds"].(float64); ok && cacheSeconds >= 1 {
+			newConfig.StatusFeed.CacheSeconds = int(cacheSeconds)
+		}
+		if target, ok := statusFeed["balance_target"].(float64); ok && target >= 0 {
+			newConfig.StatusFeed.BalanceTarget = target
+		}
+		if include, ok := statusFeed["include_service"].(bool); ok {
+			newConfig.StatusFeed.IncludeService = include
+		}
+		if include, ok := statusFeed["include_keys"].(bool); ok {
+			newConfig.StatusFeed.IncludeKeys = include
+		}
+		if include, ok := statusFeed["include_balance"].(bool); ok {
+			newConfig.StatusFeed.IncludeBalance = include
+		}
+		if include, ok := statusFeed["include_requests"].(bool); ok {
+			newConfig.StatusFeed.IncludeRequests = include
+		}
+		if include, ok := statusFeed["include_upstream"].(bool); ok {
+			newConfig.StatusFeed.IncludeUpstream = include
+		}
+	}
+
+	// 紧急轮换凭据后锁定了代理，发放了新的客户端令牌或API密钥时解除锁定
+	config.ReleaseProxyLock(currentConfig, &newConfig)
+
 	// 更新配置
 	config.UpdateConfig(&newConfig)
 
@@ -1246,6 +2612,45 @@ func handleRefreshAllKeysBalance(c *gin.Context) {
 	})
 }
 
+// handleGetBalanceRefreshStatus 获取启动时后台余额刷新的进度
+func handleGetBalanceRefreshStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, key.GetBalanceRefreshStatus())
+}
+
+// handleRefreshKeyBalance 处理刷新单个API密钥余额的请求，路径参数为密钥的数据库ID
+func handleRefreshKeyBalance(c *gin.Context) {
+	// 与其他/keys/:key路由共用参数名，这里只接受数字ID，不按密钥原文查找
+	keyID, err := strconv.Atoi(c.Param("key"))
+	if err != nil || keyID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的API密钥ID",
+		})
+		return
+	}
+	if _, found := config.GetApiKeyByID(keyID); !found {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "API密钥未找到",
+		})
+		return
+	}
+
+	if err := key.ForceRefreshKeyBalance(keyID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("刷新API密钥余额失败: %v", err),
+		})
+		return
+	}
+
+	// 返回刷新后的密钥信息
+	refreshedKey, _ := config.GetApiKeyByID(keyID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "API密钥余额刷新成功",
+		"id":       keyID,
+		"balance":  refreshedKey.Balance,
+		"disabled": refreshedKey.Disabled,
+	})
+}
+
 // handleSystemRestart 处理系统重启请求
 func handleSystemRestart(c *gin.Context) {
 	// 返回成功消息
@@ -1267,7 +2672,7 @@ func handleSystemRestart(c *gin.Context) {
 		// 获取当前命令行参数，排除第一个(程序路径)
 		args := []string{}
 		if len(os.Args) > 1 {
-			args = os.Args[1:]
+			args = config.StripRestoreFlags(os.Args[1:])
 		}
 
 		// 记录重启前的命令行参数
@@ -1324,26 +2729,187 @@ func handleSystemRestart(c *gin.Context) {
 			}
 		}
 
-		// 启动新进程
+		// 等待正在处理的请求完成并关闭端口，保存API密钥后关闭数据库，新进程启动时端口和数据库已释放
+		if err := shutdownForRestart(context.Background()); err != nil {
+			logger.Error("重启前关闭服务失败: %v", err)
+		}
+
+		// 启动新进程，服务已关闭，启动失败时当前进程也退出
 		err = cmd.Start()
 		if err != nil {
 			logger.Error("重启程序失败: %v", err)
-			return
+			logger.CloseLogger()
+			os.Exit(1)
 		}
 
 		logger.Info("新进程已启动，进程ID: %d，命令行参数: %v，工作目录: %s",
 			cmd.Process.Pid, args, executableDir)
 
-		// 设置退出标志
-		logger.Info("当前程序将在重启成功后退出")
-
 		// 如果使用了systray，需要通知退出
 		// 这部分在WEB API中可能无法直接访问systray变量
 		// 所以我们直接退出程序
+		logger.CloseLogger()
 		os.Exit(0)
 	}()
 }
 
+// handleListAssets 处理列出嵌入式静态资源的请求，用于调试资源打包问题
+func handleListAssets(c *gin.Context) {
+	manifest, err := GetEmbeddedManifest()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("获取静态资源清单失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"assets": manifest,
+		"count":  len(manifest),
+	})
+}
+
+// handleSystemHealth 处理健康检查请求，存在时钟偏差等问题时返回warning状态，只读维护模式或暂停密钥选择时返回maintenance状态
+// 健康检查不需要验证，不返回代理验证方式等安全设置，验证方式在设置接口中查看
+func handleSystemHealth(c *gin.Context) {
+	clockSkew := utils.GetClockSkewStatus()
+	dataVersion := config.GetDataVersionStatus()
+	selectionPaused := key.IsKeySelectionPaused()
+
+	status := "ok"
+	if dataVersion.ReadOnly || selectionPaused {
+		status = "maintenance"
+	} else if clockSkew.Warning {
+		status = "warning"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":               status,
+		"version":              config.GetVersion(),
+		"clock_skew":           clockSkew,
+		"data_version":         dataVersion,
+		"key_selection_paused": selectionPaused,
+	})
+}
+
+// handleSystemRuntime 返回运行时内存信息、各内存缓存的大小及淘汰统计和上游并发限制的状态
+func handleSystemRuntime(c *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	c.JSON(http.StatusOK, gin.H{
+		"goroutines": runtime.NumGoroutine(),
+		"memory": gin.H{
+			"heap_alloc":   mem.HeapAlloc,
+			"heap_inuse":   mem.HeapInuse,
+			"heap_objects": mem.HeapObjects,
+			"sys":          mem.Sys,
+			"num_gc":       mem.NumGC,
+		},
+		"caches": gin.H{
+			"memory_budget_bytes": cache.GetMemoryBudget(),
+			"total_bytes":         cache.GetTotalBytes(),
+			"items":               cache.AllStats(),
+		},
+		"concurrency": proxy.GetConcurrencyStatus(),
+	})
+}
+
+// handleGetNotificationOutbox 获取通知发送队列，webhook地址只返回协议和主机
+func handleGetNotificationOutbox(c *gin.Context) {
+	limit := 100
+	if value := c.Query("limit"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	entries := config.GetNotificationOutbox(limit)
+	for i := range entries {
+		entries[i].Channel = maskWebhookURL(entries[i].Channel)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"dropped": config.GetDroppedNotificationCount(),
+	})
+}
+
+// handleRetryNotification 立即重试发送队列中的一条通知
+func handleRetryNotification(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "无效的通知ID",
+		})
+		return
+	}
+
+	if err := notify.RetryNow(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("重试通知失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已加入重试",
+	})
+}
+
+// handleTestKeyNotification 将示例通知直接发送到所有webhook，返回每个webhook的发送结果，默认发送密钥余额不足的示例
+func handleTestKeyNotification(c *gin.Context) {
+	var req struct {
+		Event string `json:"event"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "无效的请求数据",
+			})
+			return
+		}
+	}
+	if req.Event == "" {
+		req.Event = notify.EventKeyLowBalance
+	}
+
+	if len(config.GetNotificationWebhooks()) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "没有配置webhook",
+		})
+		return
+	}
+
+	results, err := notify.SendTest(req.Event)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	success := true
+	for i := range results {
+		results[i].Webhook = maskWebhookURL(results[i].Webhook)
+		success = success && results[i].Success
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": success,
+		"event":   req.Event,
+		"results": results,
+	})
+}
+
+// maskWebhookURL 隐藏webhook地址中的路径和参数，这部分通常包含访问凭证
+func maskWebhookURL(webhook string) string {
+	parsed, err := url.Parse(webhook)
+	if err != nil || parsed.Host == "" {
+		return "***"
+	}
+	return parsed.Scheme + "://" + parsed.Host + "/***"
+}
+
 // handleApiKeyProxy 处理API密钥获取的代理请求
 func handleApiKeyProxy(c *gin.Context) {
 	// 从请求中获取授权令牌
@@ -1454,7 +3020,7 @@ func syncModelsHandler(c *gin.Context) {
 		return
 	}
 
-	baseURL := cfg.ApiProxy.BaseURL
+	baseURL := config.GetApiBaseURL()
 	if baseURL == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -1525,8 +3091,11 @@ func fetchRemoteModels(baseURL string) ([]string, int, error) {
 		return nil, 0, err
 	}
 
-	apikeys := config.GetActiveApiKeys()
+	apikeys := key.GetKeyPool().ActiveKeys()
 	utils.SetCommonHeaders(req, apikeys[0].Key)
+	if err := signing.ApplyProviderHeaders(req, apikeys[0].Key, nil); err != nil {
+		return nil, 0, err
+	}
 
 	// 发送请求
 	client := &http.Client{}
@@ -1557,6 +3126,10 @@ func fetchRemoteModels(baseURL string) ([]string, int, error) {
 		return nil, 0, nil
 	}
 
+	// 记录上游提供的最大输出令牌数和上下文长度
+	model.RecordRemoteTokenLimits(data)
+	model.RecordRemoteContextWindows(data)
+
 	// 提取模型ID
 	var modelIds []string
 	for _, item := range data {
@@ -1623,6 +3196,14 @@ func updateModelStrategyHandler(c *gin.Context) {
 		}
 	}
 
+	if !key.IsValidStrategyID(req.StrategyID) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("策略ID %d 无效，应在%d到%d之间", req.StrategyID, key.MinStrategyID, key.MaxStrategyID),
+		})
+		return
+	}
+
 	// 更新模型策略
 	err := model.UpdateModelStrategy(req.ModelID, req.StrategyID)
 	if err != nil {
@@ -1635,7 +3216,7 @@ func updateModelStrategyHandler(c *gin.Context) {
 	}
 
 	// 更新配置中的模型策略
-	cfg := config.GetConfig()
+	cfg := config.GetConfig().Clone()
 	if cfg.App.ModelKeyStrategies == nil {
 		cfg.App.ModelKeyStrategies = make(map[string]int)
 	}
@@ -1686,6 +3267,16 @@ func getModelsStatusHandler(c *gin.Context) {
 	})
 }
 
+// getModelIssuesHandler 获取模型策略、覆盖配置、禁用列表和虚拟模型映射中的问题
+func getModelIssuesHandler(c *gin.Context) {
+	issues := key.ValidateModelRules(config.GetConfig())
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"issues":  issues,
+	})
+}
+
 // updateModelsHandler 批量更新模型信息
 func updateModelsHandler(c *gin.Context) {
 	var req struct {
@@ -1772,7 +3363,7 @@ func updateModelsHandler(c *gin.Context) {
 	committed = true
 
 	// 更新禁用模型列表
-	cfg := config.GetConfig()
+	cfg := config.GetConfig().Clone()
 	if cfg != nil {
 		cfg.App.DisabledModels = req.DisabledModels
 		config.UpdateConfig(cfg)
@@ -1834,6 +3425,45 @@ func updateModelTypeHandler(c *gin.Context) {
 	})
 }
 
+// updateModelTokenLimitsHandler 更新模型的默认和最大输出令牌数
+func updateModelTokenLimitsHandler(c *gin.Context) {
+	var req struct {
+		ModelID          string `json:"model_id"`
+		DefaultMaxTokens int    `json:"default_max_tokens"`
+		MaxOutputTokens  int    `json:"max_output_tokens"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error("解析请求参数失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "解析请求参数失败: " + err.Error(),
+		})
+		return
+	}
+
+	if req.ModelID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "模型ID不能为空",
+		})
+		return
+	}
+
+	if err := model.UpdateModelTokenLimits(req.ModelID, req.DefaultMaxTokens, req.MaxOutputTokens); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("更新模型输出令牌数失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("成功更新模型 %s 的输出令牌数限制", req.ModelID),
+	})
+}
+
 // handleModelManagementPage 处理模型管理页面请求
 func handleModelManagementPage(c *gin.Context) {
 	// 获取版本号
@@ -1897,7 +3527,7 @@ func deleteModelStrategyHandler(c *gin.Context) {
 	}
 
 	// 更新配置中的模型策略
-	cfg := config.GetConfig()
+	cfg := config.GetConfig().Clone()
 	if cfg.App.ModelKeyStrategies != nil {
 		// 从配置中删除模型策略
 		delete(cfg.App.ModelKeyStrategies, req.ModelID)
@@ -0,0 +1,34 @@
+/**
+  @author: Hanhai
+  @desc: 托管图片的访问地址，图片ID由随机数生成，客户端直接用图片地址下载时不带访问令牌，需要在API密钥验证之前处理
+**/
+
+package web
+
+import (
+	"flowsilicon/internal/proxy"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HostedImageMiddleware 处理GET /v1/files/images/:id，返回托管的图片并结束处理
+// /v1/*path已注册为代理路由，无法再注册该路径，所以在中间件中匹配
+func HostedImageMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if !strings.HasPrefix(path, proxy.HostedImagePathPrefix) {
+			c.Next()
+			return
+		}
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		id := strings.TrimPrefix(path, proxy.HostedImagePathPrefix)
+		proxy.HandleHostedImage(c, id)
+		c.Abort()
+	}
+}
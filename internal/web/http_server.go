@@ -0,0 +1,167 @@
+/**
+  @author: Hanhai
+  @desc: 监听端口的HTTP服务，退出或重启时先等待正在处理的请求完成，期间新的请求返回503，再关闭端口、保存API密钥并关闭数据库，各平台的主程序共用
+**/
+
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+)
+
+// 未设置时退出前等待请求完成的最长时间（秒）
+const defaultShutdownTimeoutSeconds = 30
+
+// 正在监听端口的服务，管理页面重启程序时通过它关闭服务
+var runningServer atomic.Pointer[Server]
+
+// Server 监听端口的HTTP服务
+type Server struct {
+	server     *http.Server
+	handler    http.Handler
+	shutdowner Shutdowner
+
+	mu       sync.Mutex
+	inFlight int           // 正在处理的请求数
+	draining bool          // 是否正在等待请求完成
+	idle     chan struct{} // 开始等待后请求全部完成时关闭
+
+	once        sync.Once
+	shutdownErr error
+}
+
+// NewServer 创建监听port的HTTP服务，shutdowner为NewHandler返回的关闭服务的接口
+func NewServer(port int, handler http.Handler, shutdowner Shutdowner) *Server {
+	s := &Server{
+		handler:    handler,
+		shutdowner: shutdowner,
+		idle:       make(chan struct{}),
+	}
+	s.server = &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: s,
+	}
+	return s
+}
+
+// ListenAndServe 监听端口并处理请求，直到调用Shutdown，正常关闭时返回nil
+func (s *Server) ListenAndServe() error {
+	runningServer.Store(s)
+	err := s.server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// ServeHTTP 记录正在处理的请求数，开始关闭后新的请求返回503
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		writeShuttingDown(w)
+		return
+	}
+	s.inFlight++
+	s.mu.Unlock()
+
+	defer s.finishRequest()
+	s.handler.ServeHTTP(w, r)
+}
+
+// finishRequest 请求处理完成，等待期间最后一个请求完成时通知Shutdown
+func (s *Server) finishRequest() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	if s.draining && s.inFlight == 0 {
+		close(s.idle)
+	}
+}
+
+// writeShuttingDown 返回服务正在关闭的503响应，客户端收到后关闭连接
+func writeShuttingDown(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Connection", "close")
+	w.Header().Set("Retry-After", "5")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": "服务正在关闭，请稍后重试",
+			"type":    "server_shutting_down",
+			"code":    http.StatusServiceUnavailable,
+		},
+	})
+}
+
+// getShutdownTimeout 获取退出前等待请求完成的最长时间
+func getShutdownTimeout() time.Duration {
+	seconds := defaultShutdownTimeoutSeconds
+	if cfg := config.GetConfig(); cfg != nil && cfg.Server.ShutdownTimeoutSeconds > 0 {
+		seconds = cfg.Server.ShutdownTimeoutSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Shutdown 关闭服务，重复调用时只执行一次
+// 先等待正在处理的请求完成，最多等待server.shutdown_timeout_seconds秒，期间新的请求返回503；
+// 然后关闭监听的端口，重启时新进程可以立即使用该端口；最后保存API密钥并关闭数据库
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.once.Do(func() {
+		timeout := getShutdownTimeout()
+		drainCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		s.mu.Lock()
+		s.draining = true
+		inFlight := s.inFlight
+		if inFlight == 0 {
+			close(s.idle)
+		}
+		s.mu.Unlock()
+
+		if inFlight > 0 {
+			logger.Info("正在等待 %d 个请求处理完成，最多等待 %s", inFlight, timeout)
+		}
+		select {
+		case <-s.idle:
+		case <-drainCtx.Done():
+			s.mu.Lock()
+			inFlight = s.inFlight
+			s.mu.Unlock()
+			logger.Warn("等待请求处理完成超时，%d 个未完成的请求将被中断", inFlight)
+		}
+
+		// 关闭端口和空闲连接，超时后仍未完成的请求直接断开
+		if err := s.server.Shutdown(drainCtx); err != nil {
+			s.server.Close()
+		}
+		logger.Info("HTTP服务已关闭")
+
+		// 停止后台任务，保存密钥池快照和API密钥后关闭数据库
+		s.shutdownErr = s.shutdowner.Shutdown(ctx)
+	})
+	return s.shutdownErr
+}
+
+// shutdownForRestart 重启程序前关闭服务，等待请求完成后关闭端口、保存API密钥并关闭数据库
+// 没有通过Server监听端口时（例如嵌入其他程序）只关闭服务，端口由调用方的程序管理
+func shutdownForRestart(ctx context.Context) error {
+	if s := runningServer.Load(); s != nil {
+		return s.Shutdown(ctx)
+	}
+	if svc := currentService.Load(); svc != nil {
+		return svc.Shutdown(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+/**
+  @author: Hanhai
+  @desc: API密钥的批量导入和导出，支持CSV、JSON和每行一个密钥的文本格式，导入前查询余额验证新密钥，导出的文件包括当前的得分、最后测试时间和添加时间，可以作为备份
+**/
+
+package web
+
+import (
+	"encoding/csv"
+	"errors"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 导入的CSV或文本文件的最大大小
+const maxKeyImportSize = 10 << 20
+
+// CSV格式的列，导入时按表头识别，没有表头时按keyImportColumns的顺序读取
+var (
+	keyImportColumns = []string{"key", "alias", "balance", "enabled", "tags"}
+	keyExportColumns = append(append([]string(nil), keyImportColumns...), "score", "last_tested", "added_at")
+)
+
+// 导入结果中每个密钥的状态
+const (
+	keyImportAdded     = "added"     // 已添加
+	keyImportDuplicate = "duplicate" // 密钥池中已有或文件中重复
+	keyImportInvalid   = "invalid"   // 格式无效或查询余额失败
+)
+
+// keyImportResult 导入的一个密钥的结果，row从1开始，CSV包括表头，stored表示无效的密钥是否以禁用状态保存
+type keyImportResult struct {
+	Row     int     `json:"row"`
+	Key     string  `json:"key"`
+	Status  string  `json:"status"`
+	Balance float64 `json:"balance,omitempty"`
+	Error   string  `json:"error,omitempty"`
+	Stored  bool    `json:"stored,omitempty"`
+}
+
+// handleImportKeys 处理批量导入API密钥的请求
+// multipart/form-data时读取file字段中的CSV文件，text/plain时每行一个密钥，否则读取JSON数组
+// 自动余额模式的新密钥先查询余额验证，返回每个密钥的结果，keep_invalid=true时查询余额失败的密钥以禁用状态保存
+func handleImportKeys(c *gin.Context) {
+	var keys []config.ApiKey
+	var rows []int
+	var err error
+	switch {
+	case strings.HasPrefix(c.ContentType(), "multipart/form-data"):
+		keys, rows, err = readImportCSV(c)
+	case c.ContentType() == "text/plain":
+		keys, rows, err = readImportText(c)
+	default:
+		err = c.ShouldBindJSON(&keys)
+		for i := range keys {
+			rows = append(rows, i+1)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("无效的导入文件: %v", err),
+		})
+		return
+	}
+	keepInvalid := c.Query("keep_invalid") == "true"
+
+	existing := make(map[string]bool)
+	for _, k := range key.GetKeyPool().Keys() {
+		if !k.Delete {
+			existing[config.CanonicalApiKey(k.Key)] = true
+		}
+	}
+
+	// 检查密钥格式并去重，只有新密钥需要查询余额
+	results := make([]keyImportResult, len(keys))
+	var pending []int
+	var checkKeys []string
+	for i := range keys {
+		k := &keys[i]
+		k.Key = config.CanonicalApiKey(k.Key)
+		results[i] = keyImportResult{Row: rows[i], Key: config.MaskKey(k.Key)}
+		if err := config.ValidateApiKeyFormat(k.Key); err != nil {
+			results[i].Status, results[i].Error = keyImportInvalid, err.Error()
+			continue
+		}
+		if existing[k.Key] {
+			results[i].Status = keyImportDuplicate
+			continue
+		}
+		existing[k.Key] = true
+		pending = append(pending, i)
+		if k.IsBalanceAuto() {
+			checkKeys = append(checkKeys, k.Key)
+		}
+	}
+
+	checks := make(map[string]key.KeyBalanceCheck, len(checkKeys))
+	for _, check := range key.CheckKeysBalance(checkKeys) {
+		checks[check.Key] = check
+	}
+
+	var valid []config.ApiKey
+	var validIndex []int
+	for _, i := range pending {
+		k := keys[i]
+		if check, ok := checks[k.Key]; ok {
+			if check.Err != nil {
+				results[i].Status, results[i].Error = keyImportInvalid, fmt.Sprintf("查询余额失败: %v", check.Err)
+				if !keepInvalid {
+					continue
+				}
+				// 充值后余额可能恢复，以禁用状态保存，由恢复探测重新检查
+				k.Disabled = true
+			} else {
+				k.Balance = check.Balance
+			}
+		}
+		valid = append(valid, k)
+		validIndex = append(validIndex, i)
+	}
+
+	imported, _ := config.ImportApiKeys(valid)
+	importedKeys := make(map[string]config.ApiKey, len(imported))
+	for _, k := range imported {
+		importedKeys[k.Key] = k
+	}
+
+	addedCount, duplicateCount, invalidCount := 0, 0, 0
+	for j, i := range validIndex {
+		saved, ok := importedKeys[valid[j].Key]
+		switch {
+		case !ok:
+			// 验证期间其他请求添加了同一个密钥
+			results[i].Status = keyImportDuplicate
+		case results[i].Status == keyImportInvalid:
+			results[i].Stored = true
+		default:
+			results[i].Status = keyImportAdded
+			results[i].Balance = saved.Balance
+		}
+	}
+	for _, result := range results {
+		switch result.Status {
+		case keyImportAdded:
+			addedCount++
+		case keyImportDuplicate:
+			duplicateCount++
+		case keyImportInvalid:
+			invalidCount++
+		}
+	}
+
+	config.SortApiKeysByBalance()
+
+	// 保存到数据库
+	if len(imported) > 0 {
+		if err := config.SaveApiKeys(); err != nil {
+			logger.Error("保存导入的API密钥到数据库失败: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    fmt.Sprintf("成功导入 %d 个API密钥，跳过 %d 个已存在的密钥，%d 个密钥无效", addedCount, duplicateCount, invalidCount),
+		"added":      addedCount,
+		"duplicates": duplicateCount,
+		"invalid":    invalidCount,
+		"results":    results,
+	})
+}
+
+// readImportText 读取纯文本格式的请求体，每行一个密钥，忽略空行和以#开头的注释行，返回密钥和每个密钥所在的行号
+func readImportText(c *gin.Context) ([]config.ApiKey, []int, error) {
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxKeyImportSize+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) > maxKeyImportSize {
+		return nil, nil, fmt.Errorf("文件不能超过 %d MB", maxKeyImportSize>>20)
+	}
+
+	var keys []config.ApiKey
+	var rows []int
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, config.ApiKey{Key: line})
+		rows = append(rows, i+1)
+	}
+	return keys, rows, nil
+}
+
+// readImportCSV 读取上传的CSV文件，第一行的列名都能识别时作为表头，返回密钥和每个密钥所在的行号
+func readImportCSV(c *gin.Context) ([]config.ApiKey, []int, error) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return nil, nil, errors.New("缺少file字段")
+	}
+	if fileHeader.Size > maxKeyImportSize {
+		return nil, nil, fmt.Errorf("文件不能超过 %d MB", maxKeyImportSize>>20)
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns := make(map[string]int)
+	start := 0
+	if len(records) > 0 && isKeyCSVHeader(records[0]) {
+		for i, name := range records[0] {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		start = 1
+	} else {
+		for i, name := range keyImportColumns {
+			columns[name] = i
+		}
+	}
+	if _, ok := columns["key"]; !ok {
+		return nil, nil, errors.New("表头中缺少key列")
+	}
+
+	var keys []config.ApiKey
+	var rows []int
+	for i := start; i < len(records); i++ {
+		record := records[i]
+		field := func(name string) string {
+			if j, ok := columns[name]; ok && j < len(record) {
+				return strings.TrimSpace(record[j])
+			}
+			return ""
+		}
+		if field("key") == "" {
+			continue
+		}
+
+		k := config.ApiKey{
+			Key:   field("key"),
+			Alias: field("alias"),
+			Tags:  config.ParseKeyTags(field("tags")),
+		}
+		if value := field("balance"); value != "" {
+			if k.Balance, err = strconv.ParseFloat(value, 64); err != nil {
+				return nil, nil, fmt.Errorf("第 %d 行的balance无效: %s", i+1, value)
+			}
+		}
+		if value := field("enabled"); value != "" {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("第 %d 行的enabled无效: %s", i+1, value)
+			}
+			k.Disabled = !enabled
+		}
+		keys = append(keys, k)
+		rows = append(rows, i+1)
+	}
+	return keys, rows, nil
+}
+
+// isKeyCSVHeader 判断CSV的第一行是否为表头
+func isKeyCSVHeader(record []string) bool {
+	known := make(map[string]bool, len(keyExportColumns))
+	for _, name := range keyExportColumns {
+		known[name] = true
+	}
+	for _, name := range record {
+		if !known[strings.ToLower(strings.TrimSpace(name))] {
+			return false
+		}
+	}
+	return len(record) > 0
+}
+
+// handleExportKeys 处理导出API密钥的请求，format为csv或json，默认为json
+// JSON格式的每一项与密钥列表接口中的密钥相同，不包括已删除的密钥
+func handleExportKeys(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "format参数无效，只支持csv和json",
+		})
+		return
+	}
+
+	keys := make([]config.ApiKey, 0)
+	for _, k := range keysWithCurrentScores() {
+		if !k.Delete {
+			keys = append(keys, k)
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	filename := fmt.Sprintf("flowsilicon-keys-%s.%s", time.Now().Format("20060102"), format)
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	if format == "json" {
+		c.JSON(http.StatusOK, keys)
+		return
+	}
+
+	var buf strings.Builder
+	if err := writeKeysCSV(&buf, keys); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("导出API密钥失败: %v", err),
+		})
+		return
+	}
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", []byte(buf.String()))
+}
+
+// writeKeysCSV 按keyExportColumns的列写入密钥
+func writeKeysCSV(w io.Writer, keys []config.ApiKey) error {
+	writer := csv.NewWriter(w)
+	writer.Write(keyExportColumns)
+	for _, k := range keys {
+		writer.Write([]string{
+			k.Key,
+			k.Alias,
+			strconv.FormatFloat(k.Balance, 'f', -1, 64),
+			strconv.FormatBool(!k.Disabled),
+			strings.Join(k.Tags, ","),
+			strconv.FormatFloat(k.Score, 'f', 4, 64),
+			strconv.FormatInt(k.LastTested, 10),
+			strconv.FormatInt(k.AddedAt, 10),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
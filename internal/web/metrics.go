@@ -0,0 +1,262 @@
+/**
+  @author: Hanhai
+  @desc: Prometheus指标接口，按文本格式导出密钥管理器维护的密钥余额、得分、RPM、TPM、请求数、成功率和上游延迟，按模型和状态码的代理请求计数，以及每日统计中今天的请求数和令牌数
+**/
+
+package web
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsPath Prometheus指标接口的地址
+const MetricsPath = "/metrics"
+
+// Prometheus文本格式的Content-Type
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// SetupMetrics 注册Prometheus指标接口，需要在管理界面的身份验证中间件之前注册，是否开启由metrics.enabled控制
+func SetupMetrics(router *gin.Engine) {
+	router.GET(MetricsPath, handleMetrics)
+}
+
+// handleMetrics 处理Prometheus的抓取请求，未开启时返回404，设置了令牌时需要在Authorization请求头中携带
+// 数据在抓取时从密钥池快照、代理请求计数器和每日统计读取，不在代理请求中加锁采集
+func handleMetrics(c *gin.Context) {
+	cfg := config.GetConfig()
+	if cfg == nil || !cfg.Metrics.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not Found"})
+		return
+	}
+	if token := cfg.Metrics.Token; token != "" {
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的令牌"})
+			return
+		}
+	}
+
+	w := &metricsWriter{}
+	keys := key.GetKeyPool().Keys()
+	writeKeyMetrics(w, keys)
+	histograms := key.GetKeyLatencyHistograms()
+	writeKeyLatencyMetrics(w, keys, histograms)
+	writeUpstreamLatencyMetrics(w, histograms)
+	writeProxyMetrics(w, config.GetProxyCounters(), config.GetProxyRetries())
+	writeModelMetrics(w, config.GetDailyModelStats(""))
+	if today, _ := config.GetDailyStats(""); today != nil {
+		writeDailyMetrics(w, today)
+	}
+	c.Data(http.StatusOK, metricsContentType, w.buf.Bytes())
+}
+
+// sortedMetricsKeys 按数据库记录ID排序密钥，不包括已删除的密钥
+func sortedMetricsKeys(keys []config.ApiKey) []config.ApiKey {
+	sorted := make([]config.ApiKey, 0, len(keys))
+	for _, k := range keys {
+		if !k.Delete {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	return sorted
+}
+
+// metricsKeyLabels 密钥的标签，key标签为掩码后的密钥，id标签为密钥的数据库记录ID，alias标签为密钥的备注名，未设置时为空
+func metricsKeyLabels(k config.ApiKey, extra ...string) []string {
+	return append([]string{"id", strconv.Itoa(k.ID), "key", metricsKeyLabel(k.Key), "alias", k.Alias}, extra...)
+}
+
+// writeKeyMetrics 导出每个密钥的指标和密钥池中的密钥数
+func writeKeyMetrics(w *metricsWriter, keys []config.ApiKey) {
+	sorted := sortedMetricsKeys(keys)
+	labels := metricsKeyLabels
+
+	w.header("flowsilicon_keys", "gauge", "密钥池中的密钥数，不包括已删除的密钥")
+	w.sample("flowsilicon_keys", nil, float64(config.GetKeyCount(config.KeyFilter{})))
+	w.header("flowsilicon_disabled_keys", "gauge", "已禁用的密钥数")
+	w.sample("flowsilicon_disabled_keys", nil, float64(config.GetKeyCount(config.KeyFilter{Status: config.KeyStatusDisabled})))
+
+	w.header("flowsilicon_key_balance", "gauge", "密钥的余额")
+	for _, k := range sorted {
+		w.sample("flowsilicon_key_balance", labels(k), k.Balance)
+	}
+	w.header("flowsilicon_key_rpm", "gauge", "密钥当前窗口内的每分钟请求数")
+	for _, k := range sorted {
+		w.sample("flowsilicon_key_rpm", labels(k), float64(k.RPM.Current()))
+	}
+	w.header("flowsilicon_key_tpm", "gauge", "密钥当前窗口内的每分钟令牌数")
+	for _, k := range sorted {
+		w.sample("flowsilicon_key_tpm", labels(k), float64(k.TPM.Current()))
+	}
+	w.header("flowsilicon_key_requests_total", "counter", "密钥累计的请求数，按结果区分，client_error为客户端原因导致的错误")
+	for _, k := range sorted {
+		failed := k.TotalCalls - k.SuccessCalls - k.ClientErrors
+		if failed < 0 {
+			failed = 0
+		}
+		w.sample("flowsilicon_key_requests_total", labels(k, "result", "success"), float64(k.SuccessCalls))
+		w.sample("flowsilicon_key_requests_total", labels(k, "result", "failure"), float64(failed))
+		w.sample("flowsilicon_key_requests_total", labels(k, "result", "client_error"), float64(k.ClientErrors))
+	}
+	w.header("flowsilicon_key_success_rate", "gauge", "密钥的成功率（0-1），不包括客户端错误")
+	for _, k := range sorted {
+		w.sample("flowsilicon_key_success_rate", labels(k), k.SuccessRate)
+	}
+
+	// 得分与选择密钥时的计算方式相同，禁用或余额不足的密钥为0
+	scores := make(map[string]float64, len(sorted))
+	for _, scored := range key.CalculateKeyScores(sorted) {
+		scores[scored.Key.Key] = scored.Score
+	}
+	w.header("flowsilicon_key_score", "gauge", "密钥的综合得分，禁用或余额不足的密钥为0")
+	for _, k := range sorted {
+		w.sample("flowsilicon_key_score", labels(k), scores[k.Key])
+	}
+}
+
+// writeKeyLatencyMetrics 导出每个密钥启动以来的上游响应延迟直方图，与密钥指标的平滑延迟使用同一份记录
+func writeKeyLatencyMetrics(w *metricsWriter, keys []config.ApiKey, histograms map[string]key.LatencyHistogram) {
+	const name = "flowsilicon_key_upstream_latency_seconds"
+	w.header(name, "histogram", "密钥的上游请求从发出到收到响应头的时间（秒），从启动时开始累计")
+	for _, k := range sortedMetricsKeys(keys) {
+		histogram, ok := histograms[k.Key]
+		if !ok {
+			continue
+		}
+		for i, bound := range key.LatencyHistogramBuckets {
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			w.sample(name+"_bucket", metricsKeyLabels(k, "le", le), float64(histogram.Buckets[i]))
+		}
+		w.sample(name+"_bucket", metricsKeyLabels(k, "le", "+Inf"), float64(histogram.Count))
+		w.sample(name+"_sum", metricsKeyLabels(k), histogram.Sum)
+		w.sample(name+"_count", metricsKeyLabels(k), float64(histogram.Count))
+	}
+}
+
+// writeUpstreamLatencyMetrics 导出所有密钥合计的上游响应延迟直方图
+func writeUpstreamLatencyMetrics(w *metricsWriter, histograms map[string]key.LatencyHistogram) {
+	const name = "flowsilicon_upstream_latency_seconds"
+	total := key.LatencyHistogram{Buckets: make([]uint64, len(key.LatencyHistogramBuckets))}
+	for _, histogram := range histograms {
+		for i := range total.Buckets {
+			if i < len(histogram.Buckets) {
+				total.Buckets[i] += histogram.Buckets[i]
+			}
+		}
+		total.Count += histogram.Count
+		total.Sum += histogram.Sum
+	}
+
+	w.header(name, "histogram", "所有密钥的上游请求从发出到收到响应头的时间（秒），从启动时开始累计")
+	for i, bound := range key.LatencyHistogramBuckets {
+		le := strconv.FormatFloat(bound, 'g', -1, 64)
+		w.sample(name+"_bucket", []string{"le", le}, float64(total.Buckets[i]))
+	}
+	w.sample(name+"_bucket", []string{"le", "+Inf"}, float64(total.Count))
+	w.sample(name+"_sum", nil, total.Sum)
+	w.sample(name+"_count", nil, float64(total.Count))
+}
+
+// writeProxyMetrics 导出启动以来按模型和状态码的代理请求数、失败数，以及按模型的换密钥重试次数
+func writeProxyMetrics(w *metricsWriter, counters []config.ProxyCounterSample, retries map[string]uint64) {
+	w.header("flowsilicon_proxy_requests_total", "counter", "启动以来代理的请求数，status为返回给客户端的状态码")
+	for _, counter := range counters {
+		w.sample("flowsilicon_proxy_requests_total", []string{"model", counter.Model, "status", strconv.Itoa(counter.Status)}, float64(counter.Requests))
+	}
+	w.header("flowsilicon_proxy_failures_total", "counter", "启动以来重试后仍然失败的请求数，status为返回给客户端的状态码")
+	for _, counter := range counters {
+		if counter.Failures > 0 {
+			w.sample("flowsilicon_proxy_failures_total", []string{"model", counter.Model, "status", strconv.Itoa(counter.Status)}, float64(counter.Failures))
+		}
+	}
+
+	models := make([]string, 0, len(retries))
+	for model := range retries {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	w.header("flowsilicon_proxy_retries_total", "counter", "启动以来换密钥重试的次数")
+	for _, model := range models {
+		w.sample("flowsilicon_proxy_retries_total", []string{"model", model}, float64(retries[model]))
+	}
+}
+
+// writeModelMetrics 导出今天各模型的请求数和令牌数
+// 数据来自每日统计，按统计时区在每天零点清零，Prometheus按计数器重置处理
+func writeModelMetrics(w *metricsWriter, models map[string]config.ModelStats) {
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.header("flowsilicon_model_requests_total", "counter", "今天各模型的请求数，每天零点清零")
+	for _, name := range names {
+		w.sample("flowsilicon_model_requests_total", []string{"model", name}, float64(models[name].Requests))
+	}
+	w.header("flowsilicon_model_tokens_total", "counter", "今天各模型的令牌数，每天零点清零")
+	for _, name := range names {
+		w.sample("flowsilicon_model_tokens_total", []string{"model", name}, float64(models[name].Tokens))
+	}
+}
+
+// writeDailyMetrics 导出今天的请求数和提示、补全令牌数，与管理界面的今日统计相同，每天零点清零
+func writeDailyMetrics(w *metricsWriter, today *config.DailyStats) {
+	w.header("flowsilicon_requests_total", "counter", "今天的请求数，按结果区分，每天零点清零")
+	w.sample("flowsilicon_requests_total", []string{"result", "success"}, float64(today.Requests.Success))
+	w.sample("flowsilicon_requests_total", []string{"result", "failure"}, float64(today.Requests.Failed))
+	w.header("flowsilicon_tokens_total", "counter", "今天的令牌数，按提示和补全区分，每天零点清零")
+	w.sample("flowsilicon_tokens_total", []string{"type", "prompt"}, float64(today.Tokens.Prompt))
+	w.sample("flowsilicon_tokens_total", []string{"type", "completion"}, float64(today.Tokens.Completion))
+}
+
+// metricsKeyLabel 获取密钥的标签值，只保留前四位和后四位，不会泄露完整的密钥
+func metricsKeyLabel(apiKey string) string {
+	if len(apiKey) <= 8 {
+		return strings.Repeat("*", len(apiKey))
+	}
+	return apiKey[:4] + "..." + apiKey[len(apiKey)-4:]
+}
+
+// metricsWriter 按Prometheus文本格式写入指标
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+// header 写入指标的说明和类型
+func (w *metricsWriter) header(name, metricType, help string) {
+	w.buf.WriteString("# HELP " + name + " " + help + "\n")
+	w.buf.WriteString("# TYPE " + name + " " + metricType + "\n")
+}
+
+// sample 写入一个样本，labels为按顺序排列的标签名和标签值
+func (w *metricsWriter) sample(name string, labels []string, value float64) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.WriteString(labels[i] + `="` + metricsLabelEscaper.Replace(labels[i+1]) + `"`)
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.buf.WriteByte('\n')
+}
+
+// 标签值中需要转义的字符
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,29 @@
+package web
+
+import (
+	"strings"
+	"testing"
+
+	"flowsilicon/internal/config"
+)
+
+// 密钥数指标使用GetKeyCount统计，不包括已删除的密钥
+func TestWriteKeyMetricsCounts(t *testing.T) {
+	keys := []config.ApiKey{
+		{ID: 1, Key: "sk-metrics-active", Balance: 10},
+		{ID: 2, Key: "sk-metrics-disabled", Balance: 10, Disabled: true},
+		{ID: 3, Key: "sk-metrics-deleted", Balance: 10, Delete: true},
+	}
+	config.UpdateConfig(&config.Config{})
+	config.ReplaceApiKeys(keys)
+	t.Cleanup(func() { config.ReplaceApiKeys(nil) })
+
+	w := &metricsWriter{}
+	writeKeyMetrics(w, keys[:2])
+	out := w.buf.String()
+	for _, want := range []string{"\nflowsilicon_keys 2\n", "\nflowsilicon_disabled_keys 1\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output missing %q:\n%s", strings.TrimSpace(want), out)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/**
+  @author: Hanhai
+  @desc: webhook通知的事件格式说明和示例事件，接收程序可以用示例事件测试解析和签名校验
+**/
+
+package web
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/notify"
+	"flowsilicon/pkg/client"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleGetNotificationSchema 获取事件信封、签名方式和各事件的格式说明
+func handleGetNotificationSchema(c *gin.Context) {
+	cfg := config.GetConfig()
+	c.JSON(http.StatusOK, gin.H{
+		"schema_version": client.WebhookSchemaVersion,
+		"envelope": gin.H{
+			"id":              "发送ID，与请求头中的" + client.HeaderWebhookDelivery + "相同，重试时不变，用于去重",
+			"type":            "事件类型，与请求头中的" + client.HeaderWebhookEvent + "相同",
+			"schema_version":  "事件格式版本，字段只增加不修改，不兼容的修改会增加版本号",
+			"timestamp":       "事件发生的时间（Unix秒）",
+			"instance_id":     "发送通知的实例ID，同一个数据目录不变",
+			"payload.message": "事件说明",
+			"payload.data":    "事件数据，字段见events",
+			"text":            "与payload.message相同，兼容只读取text的webhook",
+		},
+		"signature": gin.H{
+			"header":    client.HeaderWebhookSignature,
+			"format":    "t=<Unix秒>,v1=<十六进制签名>",
+			"algorithm": "HMAC-SHA256(webhook的签名密钥, \"<Unix秒>.<请求体>\")",
+			"note":      "只有设置了签名密钥的webhook附带签名，接收程序应拒绝时间相差超过5分钟的请求",
+		},
+		"legacy_payload": cfg != nil && cfg.Notification.LegacyPayload,
+		"events":         notify.GetEventSchemas(),
+	})
+}
+
+// handleGetNotificationSample 生成事件的示例信封，与实际发送的请求体格式相同
+func handleGetNotificationSample(c *gin.Context) {
+	event := c.Param("event")
+	envelope, ok := notify.SampleEvent(event)
+	if !ok {
+		events := make([]string, 0)
+		for _, schema := range notify.GetEventSchemas() {
+			events = append(events, schema.Type)
+		}
+		sort.Strings(events)
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("未知的事件类型: %s，可用的事件类型: %v", event, events)})
+		return
+	}
+	c.JSON(http.StatusOK, envelope)
+}
+
+// signedWebhooks 获取设置了签名密钥的webhook，不返回密钥
+func signedWebhooks(cfg *config.Config) []string {
+	webhooks := make([]string, 0)
+	for _, webhook := range cfg.Notification.Webhooks {
+		if strings.TrimSpace(cfg.Notification.WebhookSecrets[webhook]) != "" {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks
+}
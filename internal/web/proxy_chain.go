@@ -0,0 +1,183 @@
+/**
+  @author: Hanhai
+  @desc: 多级代理，配置了上游FlowSilicon实例时不选择本地密钥，将整个请求转发到上游实例，并通过跳数请求头防止循环转发
+**/
+
+package web
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/pkg/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// HopHeader 请求已经过的FlowSilicon实例数，每转发一次加1
+	HopHeader = "X-FlowSilicon-Hop"
+	// DefaultMaxHops 未配置时请求最多经过的FlowSilicon实例数
+	DefaultMaxHops = 3
+	// 转发到上游实例的超时时间，需要覆盖完整的流式响应
+	upstreamProxyTimeout = 10 * time.Minute
+)
+
+// 转发时不复制的逐跳请求头和响应头
+var hopByHopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Content-Length":      true,
+}
+
+// SetupProxyChain 在代理路由组上启用多级代理
+// 必须在API密钥验证之后注册，本实例仍然验证客户端的访问令牌
+func SetupProxyChain(group *gin.RouterGroup) {
+	group.Use(ProxyChainMiddleware())
+}
+
+// ProxyChainMiddleware 检查请求的跳数，配置了上游实例时转发请求并结束处理
+func ProxyChainMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.GetConfig()
+		if cfg == nil {
+			c.Next()
+			return
+		}
+
+		hop := 0
+		if value := c.GetHeader(HopHeader); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"error": gin.H{
+						"message": fmt.Sprintf("无效的%s请求头: %s", HopHeader, value),
+						"type":    "invalid_request_error",
+						"code":    http.StatusBadRequest,
+					},
+				})
+				return
+			}
+			hop = parsed
+		}
+
+		maxHops := cfg.App.MaxHops
+		if maxHops <= 0 {
+			maxHops = DefaultMaxHops
+		}
+		if hop > maxHops {
+			logger.Warn("请求经过的实例数 %d 超过上限 %d，可能存在循环转发: %s", hop, maxHops, c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusLoopDetected, gin.H{
+				"error": gin.H{
+					"message": fmt.Sprintf("请求经过的FlowSilicon实例数 %d 超过上限 %d，请检查代理链配置", hop, maxHops),
+					"type":    "proxy_loop_detected",
+					"code":    http.StatusLoopDetected,
+				},
+			})
+			return
+		}
+
+		upstream := strings.TrimRight(strings.TrimSpace(cfg.App.UpstreamProxy), "/")
+		if upstream == "" {
+			c.Next()
+			return
+		}
+
+		forwardToUpstream(c, upstream, cfg.App.UpstreamProxyToken, hop+1)
+		c.Abort()
+	}
+}
+
+// forwardToUpstream 将请求原样转发到上游实例，替换访问令牌并设置跳数，响应按收到的内容逐块返回
+func forwardToUpstream(c *gin.Context, upstream string, token string, hop int) {
+	query := c.Request.URL.Query()
+	query.Del("api_key")
+	targetURL := upstream + c.Request.URL.Path
+	if encoded := query.Encode(); encoded != "" {
+		targetURL += "?" + encoded
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, targetURL, c.Request.Body)
+	if err != nil {
+		logger.Error("创建上游实例请求失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to create upstream request: %v", err),
+		})
+		return
+	}
+	req.ContentLength = c.Request.ContentLength
+
+	for name, values := range c.Request.Header {
+		if hopByHopHeaders[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Del("Authorization")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set(HopHeader, strconv.Itoa(hop))
+
+	resp, err := utils.CreateClientWithTimeout(upstreamProxyTimeout).Do(req)
+	if err != nil {
+		logger.Error("转发请求到上游实例 %s 失败: %v", upstream, err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": gin.H{
+				"message": fmt.Sprintf("转发请求到上游实例失败: %v", err),
+				"type":    "upstream_proxy_error",
+				"code":    http.StatusBadGateway,
+			},
+		})
+		return
+	}
+	defer resp.Body.Close()
+
+	logger.Info("已转发请求到上游实例: %s %s, 状态码=%d, 跳数=%d", c.Request.Method, c.Request.URL.Path, resp.StatusCode, hop)
+
+	for name, values := range resp.Header {
+		if hopByHopHeaders[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		// 跨域响应头由本实例设置，上游实例的会重复
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), "Access-Control-") {
+			continue
+		}
+		for _, value := range values {
+			c.Writer.Header().Add(name, value)
+		}
+	}
+	c.Status(resp.StatusCode)
+
+	// 逐块写入并刷新，流式响应可以及时返回给客户端
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := c.Writer.Write(buf[:n]); err != nil {
+				logger.Info("客户端已断开，停止转发上游实例的响应: %v", err)
+				return
+			}
+			c.Writer.Flush()
+		}
+		if readErr != nil {
+			if readErr != io.EOF {
+				logger.Error("读取上游实例响应失败: %v", readErr)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,55 @@
+/**
+  @author: Hanhai
+  @desc: 代理请求体的缓存，在代理处理之前读取一次请求体，重试、转发到上游实例和检查请求内容时都使用缓存的副本
+**/
+
+package web
+
+import (
+	"bytes"
+	"flowsilicon/internal/proxy"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readAndCacheBody 读取请求体，并把r.Body替换为可以重新读取的副本，GetBody每次返回从头读取的副本
+func readAndCacheBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return []byte{}, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	r.ContentLength = int64(len(body))
+	return body, nil
+}
+
+// RequestBodyCacheMiddleware 缓存代理请求的请求体，供之后的处理使用
+func RequestBodyCacheMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := readAndCacheBody(c.Request)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": fmt.Sprintf("读取请求体失败: %v", err),
+					"type":    "invalid_request_error",
+					"code":    http.StatusBadRequest,
+				},
+			})
+			return
+		}
+		c.Set(proxy.CachedBodyContextKey, body)
+		c.Next()
+	}
+}
@@ -0,0 +1,367 @@
+/**
+  @author: Hanhai
+  @desc: 模型路由预设的导出和导入，只包含模型策略、模型覆盖、输出令牌数和禁用模型，便于分享和一键导入
+**/
+
+package web
+
+import (
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/model"
+	"flowsilicon/internal/proxy"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 路由预设文件的类型标识
+	routingPresetKind = "flowsilicon_routing"
+	// 当前路由预设文件的版本
+	routingPresetVersion = 1
+)
+
+// routingPreset 路由预设文件
+type routingPreset struct {
+	Kind               string                          `json:"kind"`
+	Version            int                             `json:"version"`
+	ExportedAt         string                          `json:"exported_at,omitempty"`
+	ModelKeyStrategies map[string]int                  `json:"model_key_strategies,omitempty"`
+	ModelOverrides     map[string]routingModelOverride `json:"model_overrides,omitempty"`
+	ModelTokenLimits   map[string]routingTokenLimits   `json:"model_token_limits,omitempty"`
+	DisabledModels     []string                        `json:"disabled_models,omitempty"`
+}
+
+// routingModelOverride 预设文件中的模型覆盖配置
+type routingModelOverride struct {
+	InjectDefaultMaxTokens  bool   `json:"inject_default_max_tokens,omitempty"`
+	ClampMaxTokens          bool   `json:"clamp_max_tokens,omitempty"`
+	TruncationPolicy        string `json:"truncation_policy,omitempty"`
+	ContextWindow           int    `json:"context_window,omitempty"`
+	FirstByteTimeoutSeconds int    `json:"first_byte_timeout_seconds,omitempty"`
+	IdleTimeoutSeconds      int    `json:"idle_timeout_seconds,omitempty"`
+	MaxChoices              int    `json:"max_choices,omitempty"`
+}
+
+// routingTokenLimits 预设文件中的模型输出令牌数限制
+type routingTokenLimits struct {
+	DefaultMaxTokens int `json:"default_max_tokens"`
+	MaxOutputTokens  int `json:"max_output_tokens"`
+}
+
+// routingChange 导入时的一项变更
+type routingChange struct {
+	Section string      `json:"section"`
+	Model   string      `json:"model"`
+	Action  string      `json:"action"` // add, update
+	Old     interface{} `json:"old,omitempty"`
+	New     interface{} `json:"new"`
+}
+
+// handleExportRouting 导出当前的模型路由配置
+func handleExportRouting(c *gin.Context) {
+	preset := currentRoutingPreset(loadKnownModels())
+	preset.ExportedAt = time.Now().Format(time.RFC3339)
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=flowsilicon-routing-%s.json", time.Now().Format("20060102")))
+	c.JSON(http.StatusOK, preset)
+}
+
+// handleImportRouting 导入模型路由预设，dry_run=true时只返回将要发生的变更
+// 预设中的条目合并到当前配置中，未在预设中出现的模型保持不变
+func handleImportRouting(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	var preset routingPreset
+	if err := c.ShouldBindJSON(&preset); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的路由预设文件: %v", err)})
+		return
+	}
+	if err := validateRoutingPreset(preset); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	known := loadKnownModels()
+	warnings := routingPresetWarnings(preset, known)
+	changes := diffRoutingPreset(currentRoutingPreset(known), preset)
+
+	if dryRun || len(changes) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"dry_run":  dryRun,
+			"applied":  false,
+			"changes":  changes,
+			"warnings": warnings,
+		})
+		return
+	}
+
+	if err := config.CheckWritable(); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	warnings = append(warnings, applyRoutingPreset(preset, known)...)
+	logger.Info("已导入模型路由预设，共 %d 项变更", len(changes))
+
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":  false,
+		"applied":  true,
+		"changes":  changes,
+		"warnings": warnings,
+	})
+}
+
+// loadKnownModels 获取模型表中的模型，获取失败时返回nil
+func loadKnownModels() map[string]model.Model {
+	models, err := model.GetAllModels()
+	if err != nil {
+		logger.Warn("获取模型列表失败，路由预设只使用配置中的数据: %v", err)
+		return nil
+	}
+
+	known := make(map[string]model.Model, len(models))
+	for _, m := range models {
+		known[m.ID] = m
+	}
+	return known
+}
+
+// currentRoutingPreset 根据当前配置和模型表生成路由预设，模型表中的策略优先于配置中的策略
+func currentRoutingPreset(known map[string]model.Model) routingPreset {
+	preset := routingPreset{
+		Kind:               routingPresetKind,
+		Version:            routingPresetVersion,
+		ModelKeyStrategies: make(map[string]int),
+		ModelOverrides:     make(map[string]routingModelOverride),
+		ModelTokenLimits:   make(map[string]routingTokenLimits),
+		DisabledModels:     make([]string, 0),
+	}
+
+	if cfg := config.GetConfig(); cfg != nil {
+		for modelID, strategyID := range cfg.App.ModelKeyStrategies {
+			preset.ModelKeyStrategies[modelID] = strategyID
+		}
+		for modelID, override := range cfg.App.ModelOverrides {
+			preset.ModelOverrides[modelID] = routingModelOverride(override)
+		}
+		preset.DisabledModels = append(preset.DisabledModels, cfg.App.DisabledModels...)
+	}
+
+	for _, m := range known {
+		if m.StrategyID > 0 {
+			preset.ModelKeyStrategies[m.ID] = m.StrategyID
+		}
+		if m.DefaultMaxTokens > 0 || m.MaxOutputTokens > 0 {
+			preset.ModelTokenLimits[m.ID] = routingTokenLimits{
+				DefaultMaxTokens: m.DefaultMaxTokens,
+				MaxOutputTokens:  m.MaxOutputTokens,
+			}
+		}
+	}
+	sort.Strings(preset.DisabledModels)
+	return preset
+}
+
+// validateRoutingPreset 检查预设文件的类型、版本和各项取值
+func validateRoutingPreset(preset routingPreset) error {
+	if preset.Kind != routingPresetKind {
+		return fmt.Errorf("不是路由预设文件，kind应为 %s", routingPresetKind)
+	}
+	if preset.Version < 1 || preset.Version > routingPresetVersion {
+		return fmt.Errorf("不支持的路由预设版本 %d，当前支持的最高版本为 %d", preset.Version, routingPresetVersion)
+	}
+
+	for modelID, strategyID := range preset.ModelKeyStrategies {
+		if strings.TrimSpace(modelID) == "" {
+			return fmt.Errorf("模型策略中的模型名称不能为空")
+		}
+		if !key.IsValidStrategyID(strategyID) {
+			return fmt.Errorf("模型 %s 的策略ID %d 无效，应在%d到%d之间", modelID, strategyID, key.MinStrategyID, key.MaxStrategyID)
+		}
+	}
+	for modelID, override := range preset.ModelOverrides {
+		if strings.TrimSpace(modelID) == "" {
+			return fmt.Errorf("模型覆盖配置中的模型名称不能为空")
+		}
+		if override.TruncationPolicy != "" && override.TruncationPolicy != proxy.TruncationDropOldest &&
+			override.TruncationPolicy != proxy.TruncationMiddleOut {
+			return fmt.Errorf("模型 %s 的截断策略 %s 无效", modelID, override.TruncationPolicy)
+		}
+		if override.ContextWindow < 0 {
+			return fmt.Errorf("模型 %s 的上下文长度不能为负数", modelID)
+		}
+	}
+	for modelID, limits := range preset.ModelTokenLimits {
+		if limits.DefaultMaxTokens < 0 || limits.MaxOutputTokens < 0 {
+			return fmt.Errorf("模型 %s 的输出令牌数不能为负数", modelID)
+		}
+		if limits.MaxOutputTokens > 0 && limits.DefaultMaxTokens > limits.MaxOutputTokens {
+			return fmt.Errorf("模型 %s 的默认输出令牌数 %d 不能大于最大输出令牌数 %d",
+				modelID, limits.DefaultMaxTokens, limits.MaxOutputTokens)
+		}
+	}
+	for _, modelID := range preset.DisabledModels {
+		if strings.TrimSpace(modelID) == "" {
+			return fmt.Errorf("禁用模型列表中的模型名称不能为空")
+		}
+	}
+	return nil
+}
+
+// routingPresetWarnings 列出预设中当前模型表里不存在的模型，这些模型不会导致导入失败
+func routingPresetWarnings(preset routingPreset, known map[string]model.Model) []string {
+	warnings := make([]string, 0)
+	if known == nil {
+		return append(warnings, "无法获取模型列表，未检查模型名称，输出令牌数限制不会被导入")
+	}
+
+	referenced := make(map[string]bool)
+	for modelID := range preset.ModelKeyStrategies {
+		referenced[modelID] = true
+	}
+	for modelID := range preset.ModelOverrides {
+		referenced[modelID] = true
+	}
+	for modelID := range preset.ModelTokenLimits {
+		referenced[modelID] = true
+	}
+	for _, modelID := range preset.DisabledModels {
+		referenced[modelID] = true
+	}
+
+	names := make([]string, 0, len(referenced))
+	for modelID := range referenced {
+		if _, ok := known[modelID]; !ok {
+			names = append(names, modelID)
+		}
+	}
+	sort.Strings(names)
+	for _, modelID := range names {
+		warning := fmt.Sprintf("模型 %s 不在当前的模型列表中", modelID)
+		if _, ok := preset.ModelTokenLimits[modelID]; ok {
+			warning += "，其输出令牌数限制不会被导入"
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
+
+// diffRoutingPreset 比较当前配置和预设，返回导入后会发生的变更
+func diffRoutingPreset(current routingPreset, preset routingPreset) []routingChange {
+	changes := make([]routingChange, 0)
+	add := func(section string, modelID string, old interface{}, exists bool, value interface{}) {
+		if exists && reflect.DeepEqual(old, value) {
+			return
+		}
+		change := routingChange{Section: section, Model: modelID, Action: "add", New: value}
+		if exists {
+			change.Action = "update"
+			change.Old = old
+		}
+		changes = append(changes, change)
+	}
+
+	for _, modelID := range sortedKeys(preset.ModelKeyStrategies) {
+		old, exists := current.ModelKeyStrategies[modelID]
+		add("model_key_strategies", modelID, old, exists, preset.ModelKeyStrategies[modelID])
+	}
+	for _, modelID := range sortedKeys(preset.ModelOverrides) {
+		old, exists := current.ModelOverrides[modelID]
+		add("model_overrides", modelID, old, exists, preset.ModelOverrides[modelID])
+	}
+	for _, modelID := range sortedKeys(preset.ModelTokenLimits) {
+		old, exists := current.ModelTokenLimits[modelID]
+		add("model_token_limits", modelID, old, exists, preset.ModelTokenLimits[modelID])
+	}
+
+	disabled := make(map[string]bool, len(current.DisabledModels))
+	for _, modelID := range current.DisabledModels {
+		disabled[modelID] = true
+	}
+	for _, modelID := range preset.DisabledModels {
+		if !disabled[modelID] {
+			disabled[modelID] = true
+			changes = append(changes, routingChange{Section: "disabled_models", Model: modelID, Action: "add", New: true})
+		}
+	}
+	return changes
+}
+
+// applyRoutingPreset 将预设合并到当前配置和模型表，返回应用过程中的警告
+func applyRoutingPreset(preset routingPreset, known map[string]model.Model) []string {
+	warnings := make([]string, 0)
+	currentConfig := config.GetConfig()
+	newConfig := *currentConfig.Clone()
+
+	newConfig.App.ModelKeyStrategies = make(map[string]int, len(currentConfig.App.ModelKeyStrategies))
+	for modelID, strategyID := range currentConfig.App.ModelKeyStrategies {
+		newConfig.App.ModelKeyStrategies[modelID] = strategyID
+	}
+	for modelID, strategyID := range preset.ModelKeyStrategies {
+		newConfig.App.ModelKeyStrategies[modelID] = strategyID
+		// 模型表中的策略优先于配置，已知模型需要同时更新模型表
+		if _, ok := known[modelID]; ok {
+			if err := model.UpdateModelStrategy(modelID, strategyID); err != nil {
+				warnings = append(warnings, fmt.Sprintf("更新模型 %s 的策略失败: %v", modelID, err))
+			}
+		}
+	}
+
+	newConfig.App.ModelOverrides = make(map[string]config.ModelOverride, len(currentConfig.App.ModelOverrides))
+	for modelID, override := range currentConfig.App.ModelOverrides {
+		newConfig.App.ModelOverrides[modelID] = override
+	}
+	for modelID, override := range preset.ModelOverrides {
+		newConfig.App.ModelOverrides[modelID] = config.ModelOverride(override)
+	}
+
+	newConfig.App.DisabledModels = append([]string(nil), currentConfig.App.DisabledModels...)
+	for _, modelID := range preset.DisabledModels {
+		if !containsString(newConfig.App.DisabledModels, modelID) {
+			newConfig.App.DisabledModels = append(newConfig.App.DisabledModels, modelID)
+		}
+	}
+
+	for modelID, limits := range preset.ModelTokenLimits {
+		if _, ok := known[modelID]; !ok {
+			continue
+		}
+		if err := model.UpdateModelTokenLimits(modelID, limits.DefaultMaxTokens, limits.MaxOutputTokens); err != nil {
+			warnings = append(warnings, fmt.Sprintf("更新模型 %s 的输出令牌数失败: %v", modelID, err))
+		}
+	}
+
+	config.UpdateConfig(&newConfig)
+	if err := config.SaveConfigToDB(); err != nil {
+		warnings = append(warnings, fmt.Sprintf("保存配置失败: %v", err))
+	}
+	return warnings
+}
+
+// sortedKeys 返回按名称排序的模型ID
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// containsString 检查字符串切片中是否包含指定值
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -13,7 +13,6 @@ import (
 	"flowsilicon/internal/proxy"
 	"html/template"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -26,15 +25,37 @@ var staticFS embed.FS
 
 // SetupApiProxy 设置 API 代理路由
 func SetupApiProxy(router *gin.Engine) {
-	// 代理所有 API 请求
-	router.Any("/api/*path", proxy.HandleApiProxy)
+	// 代理所有 API 请求，配置了上游实例时转发到上游实例
+	router.Any("/api/*path", middleware.ProxyCorsMiddleware(), middleware.ClientWhitelistMiddleware(), middleware.ProxyLockMiddleware(), RequestBodyCacheMiddleware(), middleware.NDJSONMiddleware(), ProxyChainMiddleware(), proxy.HandleApiProxy)
 
-	// 添加API密钥验证中间件
 	openaiGroup := router.Group("")
+
+	// 跨域预检请求不带访问令牌，需要在API密钥验证之前处理
+	openaiGroup.Use(middleware.ProxyCorsMiddleware())
+
+	// 托管图片的地址不需要访问令牌
+	openaiGroup.Use(HostedImageMiddleware())
+
+	// 只允许白名单中的客户端地址使用代理接口，托管图片的地址不受限制
+	openaiGroup.Use(middleware.ClientWhitelistMiddleware())
+
+	// 紧急轮换凭据后锁定代理时拒绝请求
+	openaiGroup.Use(middleware.ProxyLockMiddleware())
+
+	// 添加API密钥验证中间件
 	openaiGroup.Use(middleware.APIKeyMiddleware())
 
-	// 添加对 OpenAI 格式 API 的支持
-	openaiGroup.Any("/v1/*path", proxy.HandleOpenAIProxy)
+	// 验证通过后缓存请求体，重试和转发到上游实例时重新读取
+	openaiGroup.Use(RequestBodyCacheMiddleware())
+
+	// 客户端请求NDJSON时转换流式响应格式
+	openaiGroup.Use(middleware.NDJSONMiddleware())
+
+	// 配置了上游实例时不选择本地密钥，转发到上游实例
+	SetupProxyChain(openaiGroup)
+
+	// 添加对 OpenAI 格式 API 的支持，按版本前缀分发
+	SetupAPIVersioning(openaiGroup)
 
 	// 添加对无版本号路径的支持
 	// 聊天完成
@@ -66,47 +87,73 @@ func SetupKeysAPI(router *gin.Engine) {
 	// 获取当前请求统计
 	router.GET("/request-stats/current", handleGetCurrentRequestStats)
 
+	// 获取最近15分钟的每秒请求统计，需要登录
+	router.GET("/request-stats/realtime", middleware.AuthMiddleware(), handleGetRealtimeStats)
+
 	// 获取每日统计数据
 	router.GET("/request-stats/daily", handleGetDailyStats)
 
 	// 获取指定日期的统计数据
 	router.GET("/request-stats/daily/:date", handleGetDailyStatsByDate)
 
+	// 对比本周与上周、今天与之前某天的统计，需要登录
+	router.GET("/request-stats/compare", middleware.AuthMiddleware(), handleGetStatsComparison)
+
+	// 获取按客户端汇总的用量统计，按客户端IP或令牌区分，需要登录
+	router.GET("/request-stats/clients", middleware.AuthMiddleware(), handleGetClientStats)
+
+	// 获取按密钥统计的超长和格式异常流式事件，需要登录
+	router.GET("/request-stats/stream-anomalies", middleware.AuthMiddleware(), handleGetStreamAnomalies)
+
+	// 获取影子流量记录，记录中包含请求体和模型的回答，需要登录
+	router.GET("/request-stats/shadow", middleware.AuthMiddleware(), handleGetShadowRecords)
+
 	// 刷新所有API密钥余额
 	router.POST("/keys/refresh", handleRefreshAllKeysBalance)
+
+	// 后台余额刷新进度，需要登录
+	router.GET("/keys/refresh-status", middleware.AuthMiddleware(), handleGetBalanceRefreshStatus)
+
+	// 刷新单个API密钥余额，只接受密钥ID，需要登录
+	router.POST("/keys/:key/refresh-balance", middleware.AuthMiddleware(), handleRefreshKeyBalance)
+
+	// 批量导入和导出API密钥，导出的文件包含完整的密钥，需要登录
+	router.POST("/keys/import", middleware.AuthMiddleware(), handleImportKeys)
+	router.GET("/keys/export", middleware.AuthMiddleware(), handleExportKeys)
+
+	// 向所有webhook发送测试通知，需要登录
+	router.POST("/keys/notifications/test", middleware.AuthMiddleware(), handleTestKeyNotification)
+
+	// 导出和导入配置与API密钥的备份，用于迁移到其他机器，需要登录
+	router.GET("/config/export", middleware.AuthMiddleware(), handleExportConfig)
+	router.POST("/config/import", middleware.AuthMiddleware(), handleImportConfig)
 }
 
 // SetupWebServer 设置 Web 服务器
 func SetupWebServer(router *gin.Engine) {
+	// 计算静态资源的内容哈希，模板中通过asset函数引用带版本的资源地址
+	initAssetVersions()
+
 	// 加载模板
-	templ := template.Must(template.New("").ParseFS(templatesFS, "templates/*.html"))
+	templ := template.Must(template.New("").Funcs(template.FuncMap{
+		"asset": AssetURL,
+	}).ParseFS(templatesFS, "templates/*.html"))
 	router.SetHTMLTemplate(templ)
 
-	// 添加禁用静态文件缓存的中间件
-	router.Use(func(c *gin.Context) {
-		if strings.HasPrefix(c.Request.URL.Path, "/static-fs/") {
-			c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
-			c.Header("Pragma", "no-cache")
-			c.Header("Expires", "0")
-		}
-		c.Next()
-	})
-
 	// 静态文件 - 使用嵌入式文件系统
 	router.StaticFS("/static", http.FS(staticFS))
 
-	// 静态文件 - 改用嵌入式文件系统，而不是从文件系统直接提供
-	// 确保从嵌入式文件系统中提供静态资源
-	router.GET("/static-fs/*filepath", func(c *gin.Context) {
-		path := c.Param("filepath")
-		// 嵌入式文件系统中的文件路径包括"static"前缀
-		resourcePath := "static" + path
-		c.FileFromFS(resourcePath, http.FS(staticFS))
-	})
+	// 嵌入式静态资源，支持带内容哈希的地址和ETag协商缓存
+	router.GET("/static-fs/*filepath", handleStaticAsset)
 
 	// 网站图标
 	router.GET("/favicon.ico", func(c *gin.Context) {
-		c.Redirect(http.StatusMovedPermanently, "/static-fs/img/favicon_32.ico")
+		data, err := GetAsset(AssetFavicon)
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Data(http.StatusOK, "image/x-icon", data)
 	})
 
 	// 添加身份验证相关路由
@@ -115,21 +162,21 @@ func SetupWebServer(router *gin.Engine) {
 	router.GET("/logout", handleLogout)
 	router.GET("/auth/check", handleAuthCheck)
 
+	// 公开状态数据，使用单独的令牌，不需要登录
+	router.GET("/status.json", handleStatusFeed)
+
 	// 应用身份验证中间件
 	router.Use(middleware.AuthMiddleware())
 
 	// 页面路由
-	router.GET("/", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "index.html", gin.H{
-			"title":                  config.GetConfig().App.Title,
-			"max_balance_display":    config.GetConfig().App.MaxBalanceDisplay,
-			"items_per_page":         config.GetConfig().App.ItemsPerPage,
-			"auto_update_interval":   config.GetConfig().App.AutoUpdateInterval,
-			"stats_refresh_interval": config.GetConfig().App.StatsRefreshInterval,
-			"rate_refresh_interval":  config.GetConfig().App.RateRefreshInterval,
-			"min_balance_threshold":  config.GetConfig().App.MinBalanceThreshold,
-		})
-	})
+	router.GET("/", handleIndexPage)
+
+	// 深层链接页面，浏览器直接打开时定位到对应内容
+	router.GET("/keys/:key", handleKeyDetail)
+	router.GET(ModelStatsPath, handleModelStatsPage)
+
+	// 未知路径返回404页面
+	router.NoRoute(handleNotFound)
 
 	// 设置页面
 	router.GET("/setting", func(c *gin.Context) {
@@ -141,6 +188,9 @@ func SetupWebServer(router *gin.Engine) {
 	// 模型管理页面
 	router.GET("/model", handleModelManagementPage)
 
+	// 自定义仪表盘
+	router.GET(CustomDashboardPath+"/*filepath", handleCustomDashboard)
+
 	// API 密钥管理
 	router.GET("/keys", handleListKeys)
 	router.POST("/keys", handleAddKey)
@@ -149,8 +199,20 @@ func SetupWebServer(router *gin.Engine) {
 	router.POST("/keys/check", handleCheckKey)
 	router.POST("/keys/mode", handleSetKeyMode)
 	router.GET("/keys/mode", handleGetKeyMode)
+	router.GET("/keys/pause", handleGetKeySelectionPause)
+	router.POST("/keys/pause", handlePauseKeySelection)
+	router.POST("/keys/resume", handleResumeKeySelection)
 	router.POST("/keys/:key/enable", handleEnableKey)
 	router.POST("/keys/:key/disable", handleDisableKey)
+	router.POST("/keys/:key/group", handleSetKeyGroup)
+	router.POST("/keys/:key/balance", handleSetKeyBalance)
+	router.GET("/keys/:key/balance-history", handleGetKeyBalanceHistory)
+	router.GET("/keys/:key/failure-sources", handleGetKeyFailureSources)
+	router.GET("/keys/groups", handleGetKeyGroups)
+	router.GET("/keys/groups/stats", handleGetKeyGroupUsage)
+	router.GET("/keys/usage-rank", handleGetKeyUsageRank)
+	router.GET("/keys/score-distribution", handleGetKeyScoreDistribution)
+	router.POST("/keys/simulate", handleSimulateLoad)
 	router.DELETE("/keys/zero-balance", handleDeleteZeroBalanceKeys)
 	router.DELETE("/keys/low-balance/:threshold", handleDeleteLowBalanceKeys)
 	router.GET("/test-key", handleGetTestKey)
@@ -167,14 +229,20 @@ func SetupWebServer(router *gin.Engine) {
 	// 模型管理页面-模型管理API
 	router.GET("/models-api/list", getModelsAPIHandler)
 	router.GET("/models-api/status", getModelsStatusHandler)
+	router.GET("/models-api/issues", getModelIssuesHandler)
 	router.POST("/models-api/update", updateModelsHandler)
 	router.POST("/models-api/type", updateModelTypeHandler)
+	router.PATCH("/models-api/max-tokens", updateModelTokenLimitsHandler)
+	router.GET("/models-api/routing/export", handleExportRouting)
+	router.POST("/models-api/routing/import", handleImportRouting)
 
 	// API 密钥统计
 	router.GET("/stats", handleStats)
+	router.GET("/stats/abuse", handleGetAbuseStats)
+	router.POST("/stats/abuse/clear", handleClearClientThrottle)
 
-	// 日志查看
-	router.GET("/logs", handleGetLogs)
+	// 日志查看，支持level参数过滤
+	router.GET("/logs", handleLogsPage)
 
 	// 测试embeddings API
 	router.POST("/test-chat", handleTestChat)
@@ -197,10 +265,49 @@ func SetupWebServer(router *gin.Engine) {
 	// 设置相关API
 	router.GET("/settings/config", handleGetSettings)
 	router.POST("/settings/config", handleSaveSettings)
+	router.GET("/settings/config/hash", handleGetConfigHash)
+
+	// 客户端令牌的吊销、恢复和永久删除
+	router.GET("/settings/client-tokens", handleGetClientTokens)
+	router.POST("/settings/client-tokens/revoke", handleRevokeClientToken)
+	router.POST("/settings/client-tokens/restore", handleRestoreClientToken)
+	router.POST("/settings/client-tokens/delete", handleDeleteClientToken)
 
 	// 系统重启API
 	router.POST("/system/restart", handleSystemRestart)
 
+	// 紧急轮换所有对外暴露的凭据和安全审计记录
+	router.POST("/system/panic", handleSystemPanic)
+	router.GET("/system/audit", handleGetSecurityAudit)
+
+	// 嵌入式静态资源清单
+	router.GET("/system/assets", handleListAssets)
+
+	// 健康检查
+	router.GET("/system/health", handleSystemHealth)
+
+	// 运行时内存和缓存统计
+	router.GET("/system/runtime", handleSystemRuntime)
+
+	// 数据目录版本号回滚
+	router.GET("/system/version/rollback", handleGetVersionRollback)
+	router.POST("/system/version/rollback", handleVersionRollback)
+
+	// 导出数据归档，在另一台机器上使用--restore恢复
+	router.POST("/system/export-archive", handleExportDataArchive)
+
+	// 通知发送队列
+	router.GET("/system/notifications/outbox", handleGetNotificationOutbox)
+	router.POST("/system/notifications/outbox/:id/retry", handleRetryNotification)
+
+	// webhook通知的事件格式说明和示例事件
+	router.GET("/system/notifications/schema", handleGetNotificationSchema)
+	router.GET("/system/notifications/sample/:event", handleGetNotificationSample)
+
+	// 密钥选择决策日志
+	router.GET("/system/decision-log", handleGetDecisionLog)
+	router.POST("/system/decision-log", handleSetDecisionLog)
+
 	// API密钥代理 - 解决CORS问题
 	router.GET("/proxy/apikeys", handleApiKeyProxy)
 }
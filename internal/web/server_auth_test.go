@@ -0,0 +1,87 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"flowsilicon/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 开启密码保护时，未登录的请求不能访问新增的统计和密钥接口，只能得到401或重定向到登录页面
+func TestKeysAPIRequiresLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	cfg.Security.PasswordEnabled = true
+	config.UpdateConfig(cfg)
+	t.Cleanup(func() { config.UpdateConfig(&config.Config{}) })
+
+	router := gin.New()
+	SetupKeysAPI(router)
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/request-stats/shadow"},
+		{http.MethodPost, "/keys/1/refresh-balance"},
+		{http.MethodGet, "/request-stats/clients"},
+		{http.MethodGet, "/request-stats/realtime"},
+		{http.MethodGet, "/request-stats/compare"},
+		{http.MethodGet, "/request-stats/stream-anomalies"},
+		{http.MethodGet, "/keys/refresh-status"},
+	}
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(route.method, route.path, nil))
+			switch w.Code {
+			case http.StatusUnauthorized:
+			case http.StatusFound:
+				if got := w.Header().Get("Location"); got != "/login" {
+					t.Errorf("Location = %q, want /login", got)
+				}
+			default:
+				t.Errorf("status = %d: %s, want 401 or a redirect to /login", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// 刷新单个密钥余额只接受数字ID，按密钥原文请求时返回400，不能用来探测密钥是否在密钥池中
+func TestRefreshKeyBalanceRequiresID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.UpdateConfig(&config.Config{})
+	config.ReplaceApiKeys([]config.ApiKey{{ID: 7, Key: "sk-refresh-balance", Balance: 10, BalanceMode: config.BalanceModeManual}})
+	t.Cleanup(func() {
+		config.ReplaceApiKeys(nil)
+		config.UpdateConfig(&config.Config{})
+	})
+
+	router := gin.New()
+	SetupKeysAPI(router)
+
+	tests := []struct {
+		name  string
+		param string
+		want  int
+	}{
+		{"密钥原文", "sk-refresh-balance", http.StatusBadRequest},
+		{"不是数字", "abc", http.StatusBadRequest},
+		{"零", "0", http.StatusBadRequest},
+		{"负数", "-7", http.StatusBadRequest},
+		{"不存在的ID", "99", http.StatusNotFound},
+		{"存在的ID", "7", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/keys/"+tt.param+"/refresh-balance", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d: %s, want %d", w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+/**
+  @author: Hanhai
+  @desc: 服务初始化和关闭，完成数据库、配置、密钥和路由的初始化后返回http.Handler，供主程序或其他Go程序嵌入使用
+**/
+
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/middleware"
+	"flowsilicon/internal/model"
+	"flowsilicon/internal/notify"
+	"flowsilicon/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Options 服务初始化参数
+type Options struct {
+	DataDir     string // 数据目录，保存配置数据库、每日统计和密钥池快照
+	Version     string // 程序版本号，用于数据版本检查和应用标题
+	ReadOnly    bool   // 以只读方式打开共享的配置数据库
+	UpstreamURL string // 不为空时所有上游请求都发往该地址，例如模拟上游
+}
+
+// Shutdowner 关闭服务，停止后台任务、保存密钥状态并关闭数据库
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// service 已初始化的服务
+type service struct {
+	snapshotPath string
+	once         sync.Once
+}
+
+// ErrAlreadyInitialized 进程中已经初始化过服务，再次调用NewHandler或Mount时返回
+var ErrAlreadyInitialized = errors.New("服务已经初始化，一个进程只能初始化一次")
+
+var (
+	// 最近一次NewHandler初始化的服务
+	currentService atomic.Pointer[service]
+	// 是否已经初始化过服务，初始化失败时清除，允许修改参数后重试
+	serviceInitialized atomic.Bool
+)
+
+// NewHandler 按参数完成服务初始化，返回处理所有页面和API请求的http.Handler
+// 配置、密钥池等状态保存在包级变量中，一个进程只能初始化一次，再次调用时返回ErrAlreadyInitialized，Shutdown之后也不能重新初始化
+// 不读取程序目录，也不会退出进程；日志写入当前工作目录下的logs目录
+// 嵌入其他Gin程序时使用Mount挂载到已有的路由分组下
+func NewHandler(opts Options) (http.Handler, Shutdowner, error) {
+	if opts.DataDir == "" {
+		return nil, nil, fmt.Errorf("数据目录不能为空")
+	}
+	if !serviceInitialized.CompareAndSwap(false, true) {
+		return nil, nil, ErrAlreadyInitialized
+	}
+
+	if err := initService(opts); err != nil {
+		serviceInitialized.Store(false)
+		return nil, nil, err
+	}
+
+	svc := &service{snapshotPath: filepath.Join(opts.DataDir, "keypool_snapshot.json")}
+	currentService.Store(svc)
+	return NewRouter(), svc, nil
+}
+
+// Mount 按参数完成服务初始化，把所有页面和API请求挂载到调用方的路由或路由分组下，与NewHandler一样一个进程只能调用一次
+// 分组的路径前缀在交给流动硅基处理前去除，分组上注册的中间件对所有请求生效，分组下不能再注册其他路由
+// 代理接口可以挂载在任意子路径下；管理页面使用绝对路径，需要挂载在根路径才能正常使用
+func Mount(router gin.IRouter, opts Options) (Shutdowner, error) {
+	handler, shutdowner, err := NewHandler(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := ""
+	if group, ok := router.(interface{ BasePath() string }); ok {
+		prefix = strings.TrimSuffix(group.BasePath(), "/")
+	}
+	if prefix != "" {
+		handler = http.StripPrefix(prefix, handler)
+	}
+	router.Any("/*flowsilicon", gin.WrapH(handler))
+	return shutdowner, nil
+}
+
+// initService 初始化数据库、配置、API密钥和后台任务
+func initService(opts Options) error {
+	// 初始化配置数据库，创建表之前检查数据目录版本，程序升级前自动备份数据库，旧版本程序打开新版本数据时进入只读维护模式
+	dbPath := filepath.Join(opts.DataDir, "config.db")
+	config.SetBinaryVersion(opts.Version)
+	var err error
+	if opts.ReadOnly {
+		err = config.InitConfigDBReadOnly(dbPath)
+	} else {
+		err = config.InitConfigDB(dbPath)
+	}
+	if err != nil {
+		return fmt.Errorf("初始化配置数据库失败: %w", err)
+	}
+	logger.Info("配置数据库初始化成功: %s", dbPath)
+
+	// 初始化模型数据库
+	if err := model.InitModelDB(dbPath); err != nil {
+		logger.Error("初始化模型数据库失败: %v", err)
+		// 不退出程序，改用内置模型列表
+		if bundledErr := model.UseBundledModels(err); bundledErr != nil {
+			logger.Error("加载内置模型列表失败: %v", bundledErr)
+		}
+	} else {
+		logger.Info("模型数据库初始化成功，使用数据库模型列表: %s", dbPath)
+	}
+
+	// 将当前版本号保存到数据库中
+	// 确保版本号格式一致 (添加v前缀如果不存在)
+	if opts.Version != "" {
+		versionToSave := opts.Version
+		if !strings.HasPrefix(versionToSave, "v") {
+			versionToSave = "v" + versionToSave
+		}
+		if err := config.SaveVersion(versionToSave); err != nil {
+			logger.Error("保存版本号到数据库失败: %v", err)
+		} else {
+			logger.Info("版本号 '%s' 已保存到数据库", versionToSave)
+		}
+	}
+
+	// 检查并插入默认配置
+	if err := config.EnsureDefaultConfig(dbPath); err != nil {
+		return fmt.Errorf("确保默认配置失败: %w", err)
+	}
+
+	// 确保apikeys表存在
+	if err := config.EnsureApikeys(dbPath); err != nil {
+		logger.Error("创建apikeys表失败: %v", err)
+		// 继续执行，因为这不是致命错误
+	} else {
+		logger.Info("确保API密钥表存在成功")
+	}
+
+	// 设置数据文件路径
+	config.SetDailyFilePath(filepath.Join(opts.DataDir, "daily.json"))
+	key.SetDecisionLogDir(filepath.Join(opts.DataDir, "decisions"))
+	proxy.SetHostedImageDir(filepath.Join(opts.DataDir, "images"))
+
+	// 初始化每日统计数据
+	if err := config.InitDailyStats(); err != nil {
+		logger.Error("初始化每日统计数据失败: %v", err)
+		// 继续执行，因为这不是致命错误
+	} else {
+		logger.Info("每日统计数据初始化成功")
+	}
+
+	// 加载配置
+	cfg, err := config.LoadConfigFromDB()
+	if err != nil {
+		return fmt.Errorf("从数据库加载配置失败: %w", err)
+	}
+	if cfg == nil {
+		return fmt.Errorf("配置加载后为空")
+	}
+
+	// 获取数据库中的版本号，并更新应用标题
+	dbVersion := config.GetVersion()
+	if dbVersion != "" {
+		// 确保版本号格式一致
+		if !strings.HasPrefix(dbVersion, "v") {
+			dbVersion = "v" + dbVersion
+		}
+		// 更新App.Title中的版本号，加载的配置已经发布，在副本上修改
+		cfg = cfg.Clone()
+		cfg.App.Title = fmt.Sprintf("流动硅基 FlowSilicon %s", dbVersion)
+		// 保存回数据库
+		config.UpdateConfig(cfg)
+		config.SaveConfigToDB()
+		logger.Info("已从数据库更新应用标题为: %s", cfg.App.Title)
+	}
+
+	// 所有上游请求发往指定地址，需要在刷新余额前设置
+	if opts.UpstreamURL != "" {
+		config.SetUpstreamOverride(opts.UpstreamURL)
+		logger.Warn("已启用模拟上游 %s，上游请求不会发往 %s", opts.UpstreamURL, cfg.ApiProxy.BaseURL)
+	}
+
+	// 加载API密钥
+	if err := config.LoadApiKeysFromDB(); err != nil {
+		logger.Error("加载API密钥失败: %v", err)
+		// 继续执行，因为这不是致命错误
+	} else {
+		logger.Info("API密钥加载成功")
+
+		// 快照未过期时直接恢复密钥池状态，否则在后台刷新所有API密钥的余额
+		// 后台刷新期间使用上次保存的余额，不阻塞服务启动
+		restored, snapshotErr := key.LoadKeyPoolSnapshot(filepath.Join(opts.DataDir, "keypool_snapshot.json"))
+		if snapshotErr != nil {
+			logger.Error("加载密钥池快照失败: %v", snapshotErr)
+		}
+		if restored {
+			logger.Info("已从快照恢复密钥池，跳过余额刷新")
+		} else {
+			key.StartBackgroundBalanceRefresh()
+		}
+	}
+
+	// 启动API密钥管理器
+	key.StartKeyManager()
+	logger.Info("API密钥管理器已启动")
+
+	// 启动通知发送，继续发送上次运行时未完成的通知
+	notify.StartNotifier()
+
+	return nil
+}
+
+// NewRouter 创建注册了所有页面和API路由的Gin路由
+func NewRouter() *gin.Engine {
+	router := gin.Default()
+	// 设置受信任的代理
+	router.SetTrustedProxies([]string{"127.0.0.1", "::1"})
+	// 访问日志，需要在其他路由之前注册
+	router.Use(middleware.AccessLogMiddleware())
+	// 请求ID，用于关联同一请求的日志和影子流量记录
+	router.Use(middleware.RequestIDMiddleware())
+
+	// 设置API代理
+	SetupApiProxy(router)
+
+	// 设置API密钥管理
+	SetupKeysAPI(router)
+
+	// 设置Prometheus指标接口，不需要登录，由metrics.enabled控制是否开启
+	SetupMetrics(router)
+
+	// 设置Web界面
+	SetupWebServer(router)
+
+	return router
+}
+
+// Shutdown 停止API密钥管理器，保存密钥池快照和API密钥后关闭数据库，重复调用时只执行一次
+// 数据库已被其他退出流程关闭时跳过保存API密钥
+func (s *service) Shutdown(ctx context.Context) error {
+	var shutdownErr error
+	s.once.Do(func() {
+		// 停止API密钥管理器定时任务
+		key.StopKeyManager()
+		logger.Info("API密钥管理器已停止")
+
+		// 保存密钥池快照，用于下次启动时快速恢复
+		if err := key.SaveKeyPoolSnapshot(s.snapshotPath); err != nil {
+			logger.Error("保存密钥池快照失败: %v", err)
+		}
+
+		if db := config.DB(); db != nil && db.PingContext(ctx) == nil {
+			// 保存API密钥
+			if err := config.SaveApiKeys(); err != nil {
+				logger.Error("保存API密钥失败: %v", err)
+				shutdownErr = err
+			} else {
+				logger.Info("API密钥已保存")
+			}
+		} else {
+			// 数据库关闭是预期的行为，例如系统托盘退出时已经关闭
+			logger.Info("数据库已关闭，跳过保存API密钥")
+		}
+
+		// 关闭配置数据库连接
+		if err := config.CloseConfigDB(); err != nil {
+			logger.Error("关闭配置数据库连接失败: %v", err)
+			if shutdownErr == nil {
+				shutdownErr = err
+			}
+		} else {
+			logger.Info("配置数据库已关闭")
+		}
+
+		// 关闭模型数据库连接
+		if err := model.CloseModelDB(); err != nil {
+			logger.Error("关闭模型数据库连接失败: %v", err)
+			if shutdownErr == nil {
+				shutdownErr = err
+			}
+		} else {
+			logger.Info("模型数据库已关闭")
+		}
+	})
+	return shutdownErr
+}
@@ -0,0 +1,39 @@
+package web
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 进程中已经初始化过服务时，NewHandler和Mount返回ErrAlreadyInitialized，不会重新初始化包级状态
+func TestNewHandlerOnlyOnce(t *testing.T) {
+	serviceInitialized.Store(true)
+	t.Cleanup(func() { serviceInitialized.Store(false) })
+
+	handler, shutdowner, err := NewHandler(Options{DataDir: t.TempDir()})
+	if !errors.Is(err, ErrAlreadyInitialized) {
+		t.Fatalf("NewHandler error = %v, want ErrAlreadyInitialized", err)
+	}
+	if handler != nil || shutdowner != nil {
+		t.Errorf("NewHandler returned a handler or shutdowner with the error")
+	}
+
+	if _, err := Mount(gin.New().Group("/flowsilicon"), Options{DataDir: t.TempDir()}); !errors.Is(err, ErrAlreadyInitialized) {
+		t.Errorf("Mount error = %v, want ErrAlreadyInitialized", err)
+	}
+	if !serviceInitialized.Load() {
+		t.Errorf("the initialized flag was cleared by a rejected call")
+	}
+}
+
+// 数据目录为空时返回参数错误，不占用初始化机会
+func TestNewHandlerRequiresDataDir(t *testing.T) {
+	if _, _, err := NewHandler(Options{}); err == nil || errors.Is(err, ErrAlreadyInitialized) {
+		t.Fatalf("NewHandler error = %v, want the data directory error", err)
+	}
+	if serviceInitialized.Load() {
+		t.Errorf("NewHandler with an empty data directory marked the service initialized")
+	}
+}
@@ -0,0 +1,214 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"flowsilicon/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupSettingsTest 初始化临时配置数据库并发布给定的配置
+func setupSettingsTest(t *testing.T, cfg *config.Config) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	if err := config.InitConfigDB(t.TempDir() + "/config.db"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { config.CloseConfigDB() })
+	config.UpdateConfig(cfg)
+}
+
+// getSettings 调用设置接口并返回响应体
+func getSettings(t *testing.T) map[string]interface{} {
+	t.Helper()
+	router := gin.New()
+	router.GET("/settings", handleGetSettings)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/settings", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("获取设置状态码 = %d: %s", w.Code, w.Body.String())
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &settings); err != nil {
+		t.Fatal(err)
+	}
+	return settings
+}
+
+// saveSettings 调用保存设置接口，返回状态码和响应体
+func saveSettings(t *testing.T, settings map[string]interface{}) (int, string) {
+	t.Helper()
+	body, err := json.Marshal(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.POST("/settings", handleSaveSettings)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/settings", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+// section 获取设置中的一个分组
+func section(t *testing.T, settings map[string]interface{}, name string) map[string]interface{} {
+	t.Helper()
+	data, ok := settings[name].(map[string]interface{})
+	if !ok {
+		t.Fatalf("设置中没有 %s 分组", name)
+	}
+	return data
+}
+
+func TestSettingsUpstreamProxyTokenIsWriteOnly(t *testing.T) {
+	const token = "upstream-proxy-secret-token"
+	cfg := &config.Config{}
+	cfg.App.UpstreamProxy = "http://upstream.example"
+	cfg.App.UpstreamProxyToken = token
+	setupSettingsTest(t, cfg)
+
+	settings := getSettings(t)
+	raw, _ := json.Marshal(settings)
+	if strings.Contains(string(raw), token) {
+		t.Fatal("设置接口返回了上游代理令牌")
+	}
+	app := section(t, settings, "app")
+	if set, _ := app["upstream_proxy_token_set"].(bool); !set {
+		t.Fatal("upstream_proxy_token_set 应为 true")
+	}
+
+	// 原样保存读取到的设置时保留令牌
+	if code, body := saveSettings(t, settings); code != http.StatusOK {
+		t.Fatalf("保存设置状态码 = %d: %s", code, body)
+	}
+	if got := config.GetConfig().App.UpstreamProxyToken; got != token {
+		t.Fatalf("保存后令牌 = %q，期望保留原有的令牌", got)
+	}
+
+	// 提交新的令牌时覆盖，提交空字符串时清除
+	app["upstream_proxy_token"] = "new-token"
+	if code, body := saveSettings(t, settings); code != http.StatusOK {
+		t.Fatalf("保存设置状态码 = %d: %s", code, body)
+	}
+	if got := config.GetConfig().App.UpstreamProxyToken; got != "new-token" {
+		t.Fatalf("写入后令牌 = %q", got)
+	}
+	app["upstream_proxy_token"] = ""
+	if code, body := saveSettings(t, settings); code != http.StatusOK {
+		t.Fatalf("保存设置状态码 = %d: %s", code, body)
+	}
+	if got := config.GetConfig().App.UpstreamProxyToken; got != "" {
+		t.Fatalf("清除后令牌 = %q", got)
+	}
+	if set, _ := section(t, getSettings(t), "app")["upstream_proxy_token_set"].(bool); set {
+		t.Fatal("清除后 upstream_proxy_token_set 应为 false")
+	}
+}
+
+func TestSettingsMetricsTokenIsWriteOnly(t *testing.T) {
+	const token = "metrics-secret-token"
+	cfg := &config.Config{}
+	cfg.Metrics.Enabled = true
+	cfg.Metrics.Token = token
+	setupSettingsTest(t, cfg)
+
+	settings := getSettings(t)
+	raw, _ := json.Marshal(settings)
+	if strings.Contains(string(raw), token) {
+		t.Fatal("设置接口返回了/metrics访问令牌")
+	}
+	metrics := section(t, settings, "metrics")
+	if set, _ := metrics["token_set"].(bool); !set {
+		t.Fatal("metrics.token_set 应为 true")
+	}
+
+	if code, body := saveSettings(t, settings); code != http.StatusOK {
+		t.Fatalf("保存设置状态码 = %d: %s", code, body)
+	}
+	if got := config.GetConfig().Metrics.Token; got != token {
+		t.Fatalf("保存后令牌 = %q，期望保留原有的令牌", got)
+	}
+
+	metrics["token"] = ""
+	if code, body := saveSettings(t, settings); code != http.StatusOK {
+		t.Fatalf("保存设置状态码 = %d: %s", code, body)
+	}
+	if got := config.GetConfig().Metrics.Token; got != "" {
+		t.Fatalf("清除后令牌 = %q", got)
+	}
+}
+
+// 客户端令牌的候选结果数上限随令牌列表保存，移除的令牌不保留上限
+func TestSettingsClientTokenMaxChoices(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Security.AuthMode = config.AuthModeTokenList
+	cfg.Security.ClientTokens = []string{"sk-client-a", "sk-client-b"}
+	setupSettingsTest(t, cfg)
+
+	settings := getSettings(t)
+	security := section(t, settings, "security")
+	security["client_token_max_choices"] = map[string]interface{}{"sk-client-a": 2, "sk-client-unknown": 3, "sk-client-b": 0}
+	if code, body := saveSettings(t, settings); code != http.StatusOK {
+		t.Fatalf("保存设置状态码 = %d: %s", code, body)
+	}
+	limits := config.GetConfig().Security.ClientTokenMaxChoices
+	if len(limits) != 1 || limits["sk-client-a"] != 2 {
+		t.Fatalf("保存后的上限 = %v，期望只有 sk-client-a=2", limits)
+	}
+
+	got := section(t, getSettings(t), "security")["client_token_max_choices"].(map[string]interface{})
+	if len(got) != 1 || got["sk-client-a"] != float64(2) {
+		t.Fatalf("读取的上限 = %v", got)
+	}
+
+	// 从列表中移除令牌后不再显示它的上限
+	settings = getSettings(t)
+	security = section(t, settings, "security")
+	security["client_tokens"] = []interface{}{"sk-client-b"}
+	if code, body := saveSettings(t, settings); code != http.StatusOK {
+		t.Fatalf("保存设置状态码 = %d: %s", code, body)
+	}
+	if got := section(t, getSettings(t), "security")["client_token_max_choices"].(map[string]interface{}); len(got) != 0 {
+		t.Fatalf("移除令牌后的上限 = %v，期望为空", got)
+	}
+}
+
+// 设置页面的归档日志文件数量可以读取和保存，空值或小于1时保留原来的值
+func TestSettingsLogFileLimits(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Log.MaxFiles = 5
+	cfg.Log.MinFiles = 2
+	setupSettingsTest(t, cfg)
+
+	settings := getSettings(t)
+	log := section(t, settings, "log")
+	if log["max_files"] != float64(5) || log["min_files"] != float64(2) {
+		t.Fatalf("log = %v，期望 max_files=5 min_files=2", log)
+	}
+
+	log["max_files"] = 3
+	log["min_files"] = 4
+	if code, body := saveSettings(t, settings); code != http.StatusOK {
+		t.Fatalf("保存设置状态码 = %d: %s", code, body)
+	}
+	if got := config.GetConfig().Log; got.MaxFiles != 3 || got.MinFiles != 4 {
+		t.Fatalf("保存后 MaxFiles=%d MinFiles=%d，期望 3 和 4", got.MaxFiles, got.MinFiles)
+	}
+
+	// 页面中的输入框为空时提交0
+	log["max_files"] = 0
+	log["min_files"] = 0
+	if code, body := saveSettings(t, settings); code != http.StatusOK {
+		t.Fatalf("保存设置状态码 = %d: %s", code, body)
+	}
+	if got := config.GetConfig().Log; got.MaxFiles != 3 || got.MinFiles != 4 {
+		t.Fatalf("提交0后 MaxFiles=%d MinFiles=%d，期望保留 3 和 4", got.MaxFiles, got.MinFiles)
+	}
+}
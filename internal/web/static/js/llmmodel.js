@@ -35,7 +35,8 @@ const STRATEGY_TYPES = {
     5: "高余额",
     6: "普通",
     7: "低余额",
-    8: "免费"
+    8: "免费",
+    9: "综合加权"
 };
 
 // 调试日志函数
@@ -91,6 +92,20 @@ document.addEventListener('DOMContentLoaded', function() {
     // 绑定同步模型按钮事件
     document.getElementById('sync-models').addEventListener('click', syncModels);
     
+    // 绑定路由预设导出和导入按钮事件
+    document.getElementById('export-routing').addEventListener('click', function() {
+        window.location.href = '/models-api/routing/export';
+    });
+    document.getElementById('import-routing').addEventListener('click', function() {
+        document.getElementById('import-routing-file').click();
+    });
+    document.getElementById('import-routing-file').addEventListener('change', function() {
+        if (this.files.length > 0) {
+            importRoutingPreset(this.files[0]);
+        }
+        this.value = '';
+    });
+    
     // 绑定保存更改按钮事件
     document.getElementById('save-all').addEventListener('click', saveAllChanges);
     
@@ -432,6 +447,62 @@ function batchDisableModels() {
     saveAllChanges();
 }
 
+// 导入路由预设
+function importRoutingPreset(file) {
+    file.text().then(content => {
+        // 先预览将要发生的变更，确认后再导入
+        return fetch('/models-api/routing/import?dry_run=true', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: content
+        })
+            .then(response => response.json())
+            .then(data => {
+                if (data.error) {
+                    showToast('路由预设无效: ' + data.error, 'error');
+                    return;
+                }
+                if (data.changes.length === 0) {
+                    showToast('路由预设与当前配置相同，无需导入', 'info');
+                    return;
+                }
+                
+                const lines = data.changes.map(change => {
+                    const action = change.action === 'add' ? '新增' : '修改';
+                    return `${action} ${change.section}: ${change.model}`;
+                });
+                let message = `导入后将有 ${data.changes.length} 项变更:\n` + lines.slice(0, 20).join('\n');
+                if (lines.length > 20) {
+                    message += `\n... 另有 ${lines.length - 20} 项`;
+                }
+                if (data.warnings.length > 0) {
+                    message += '\n\n警告:\n' + data.warnings.join('\n');
+                }
+                if (!confirm(message + '\n\n确定导入吗？')) {
+                    return;
+                }
+                
+                return fetch('/models-api/routing/import', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: content
+                })
+                    .then(response => response.json())
+                    .then(result => {
+                        if (result.error) {
+                            showToast('导入路由预设失败: ' + result.error, 'error');
+                            return;
+                        }
+                        showToast(`已导入 ${result.changes.length} 项路由配置`, 'success');
+                        loadModels();
+                    });
+            });
+    }).catch(error => {
+        console.error('导入路由预设失败:', error);
+        showToast('导入路由预设失败: ' + error.message, 'error');
+    });
+}
+
 // 同步模型
 function syncModels() {
     showToast('正在同步模型...', 'info');
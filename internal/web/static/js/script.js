@@ -15,6 +15,12 @@ let currentSortDirection = 'desc';
 let keyMode = 'auto';
 let manualSelectedKeys = [];
 
+// 深层链接是否已定位，只在页面首次加载时处理
+let deepLinkApplied = false;
+
+// 密钥最近24小时的用量排名，hot为请求数明显高于其他密钥的密钥ID
+let keyUsageRank = { ranks: {}, requests: {}, hot: [] };
+
 // 排序相关变量
 let selectedKeys = new Set();
 
@@ -241,6 +247,12 @@ function loadKeys() {
             // 渲染密钥列表
             renderKeysList();
             
+            // 加载用量排名，标记热点密钥
+            loadKeyUsageRank();
+            
+            // 密钥加载完成后定位深层链接中的密钥
+            applyDeepLink(true);
+            
             // 加载当前使用的密钥信息
             loadCurrentKeyInfo();
             
@@ -292,6 +304,26 @@ function loadKeys() {
         });
 }
 
+// 加载密钥用量排名，有热点密钥时重新渲染密钥列表
+function loadKeyUsageRank() {
+    fetch('/keys/usage-rank')
+        .then(response => response.json())
+        .then(data => {
+            const hadHot = keyUsageRank.hot.length > 0;
+            keyUsageRank = {
+                ranks: data.ranks || {},
+                requests: data.requests || {},
+                hot: data.hot || []
+            };
+            if (hadHot || keyUsageRank.hot.length > 0) {
+                renderKeysList();
+            }
+        })
+        .catch(error => {
+            console.error('获取密钥用量排名失败:', error);
+        });
+}
+
 // 开始API密钥列表更新倒计时
 function startKeysUpdateCountdown(seconds) {
     if (keysUpdateCountdownTimer) {
@@ -355,12 +387,19 @@ function renderKeysList() {
     let html = '';
     
     currentPageKeys.forEach(key => {
+        // 未跟踪余额的密钥不参与余额判断，显示为“—”
+        const balanceTracked = key.balance_mode !== 'untracked';
+        const balanceInsufficient = balanceTracked && key.balance < minBalanceThreshold;
+        const balanceText = balanceTracked ? key.balance.toFixed(2) : '—';
+        
         // 计算余额百分比
         const balancePercent = (key.balance / MAX_BALANCE) * 100;
         
         // 确定余额颜色类
         let balanceClass = '';
-        if (balancePercent >= 70) {
+        if (!balanceTracked) {
+            balanceClass = '';
+        } else if (balancePercent >= 70) {
             balanceClass = 'balance-high';
         } else if (balancePercent >= 30) {
             balanceClass = 'balance-medium';
@@ -381,6 +420,12 @@ function renderKeysList() {
         const isSelected = key.selected || false;
         const selectedClass = isSelected ? 'selected' : '';
 
+        // 请求数明显高于其他密钥的热点密钥显示火焰标记
+        const usageRank = keyUsageRank.ranks[key.id];
+        const hotBadge = keyUsageRank.hot.includes(key.id)
+            ? `<span class="key-hot ms-2 text-danger" title="最近24小时请求数排名第${usageRank}（${keyUsageRank.requests[key.id]}次），明显高于其他密钥"><i class="bi bi-fire"></i></span>`
+            : '';
+
         // console.log("key.score",key.score);
         
         
@@ -397,12 +442,12 @@ function renderKeysList() {
                 <div class="key-info-row">
                     <div class="key-content">
                         <input type="checkbox" class="form-check-input key-checkbox key-select" data-key="${key.key}" ${key.disabled ? 'disabled' : ''} ${isSelected ? 'checked' : ''}>
-                        <span class="key-label ms-2">${maskedKey}</span>
+                        <span class="key-label ms-2">${maskedKey}</span>${hotBadge}
                         <span class="key-score ms-2" data-score="${parseFloat(key.score || 0).toFixed(2)}">${parseFloat(key.score || 0).toFixed(2)}</span>
-                        <span class="ms-2">余额: <span class="key-balance ${key.balance < minBalanceThreshold ? 'text-danger' : ''}" data-balance="${key.balance || 0}">${key.balance.toFixed(2)}</span>
+                        <span class="ms-2">余额: <span class="key-balance editable-balance ${balanceInsufficient ? 'text-danger' : ''}" data-key="${key.key}" data-balance="${key.balance || 0}" data-balance-mode="${key.balance_mode || 'auto'}" data-cost-per-request="${key.cost_per_request || 0}" title="点击编辑余额">${balanceText}</span>
                         </span>
                         <span class="key-stat ms-2" data-usage="${key.total_calls || 0}">调用: ${key.total_calls}</span>
-                        <span class="key-stat ms-2" data-success-rate="${key.success_rate || 0}">成功率: ${successRatePercent.toFixed(1)}%</span>
+                        <span class="key-stat ms-2" data-success-rate="${key.success_rate || 0}" title="成功: ${key.success_calls || 0} / 密钥失败: ${Math.max((key.total_calls || 0) - (key.success_calls || 0) - (key.client_errors || 0), 0)} / 客户端错误(不计入成功率): ${key.client_errors || 0}">成功率: ${successRatePercent.toFixed(1)}%</span>
                         <span class="key-stat rpm-stat ms-2" data-rpm="${key.rpm || 0}">RPM: <span class="rpm-value">${key.rpm || 0}</span></span>
                         <span class="key-stat tpm-stat ms-2" data-tpm="${key.tpm || 0}">TPM: <span class="tpm-value">${key.tpm || 0}</span></span>
                     </div>
@@ -412,10 +457,11 @@ function renderKeysList() {
                                 <input class="form-check-input toggle-key-status" type="checkbox" role="switch" 
                                     data-key="${key.key}" 
                                     ${!key.disabled ? 'checked' : ''} 
-                                    ${key.balance < minBalanceThreshold ? 'disabled title="余额低于最低阈值，无法启用"' : ''}>
+                                    ${balanceInsufficient ? 'disabled title="余额低于最低阈值，无法启用"' : ''}>
                             </div>
                             <button class="copy-api-btn" data-key="${key.key}">复制</button>
                             <button class="check-api-btn" data-key="${key.key}">余额</button>
+                            <button class="history-api-btn" data-id="${key.id}">趋势</button>
                             <button class="delete-api-btn" data-key="${key.key}">删除</button>
                         </div>
                     </div>
@@ -560,6 +606,22 @@ function renderKeysList() {
         });
     });
     
+    // 添加余额趋势按钮事件
+    document.querySelectorAll('.history-api-btn').forEach(btn => {
+        btn.addEventListener('click', function(e) {
+            e.stopPropagation(); // 阻止事件冒泡
+            showBalanceHistory(parseInt(this.dataset.id, 10));
+        });
+    });
+    
+    // 添加余额编辑事件
+    document.querySelectorAll('.editable-balance').forEach(span => {
+        span.addEventListener('click', function(e) {
+            e.stopPropagation(); // 阻止事件冒泡
+            showBalanceEditor(this);
+        });
+    });
+    
     // 渲染分页
     renderPagination(totalPages);
     
@@ -572,6 +634,166 @@ function renderKeysList() {
     }
 }
 
+// 显示密钥的余额趋势
+function showBalanceHistory(keyId) {
+    const modalElement = document.getElementById('balance-history-modal');
+    const keyObj = allKeys.find(k => k.id === keyId);
+    if (!modalElement || !keyObj) {
+        return;
+    }
+    
+    const daysSelect = document.getElementById('balance-history-days');
+    document.getElementById('balance-history-key').textContent = maskKey(keyObj.key);
+    daysSelect.onchange = () => loadBalanceHistory(keyId, daysSelect.value);
+    
+    bootstrap.Modal.getOrCreateInstance(modalElement).show();
+    loadBalanceHistory(keyId, daysSelect.value);
+}
+
+// 加载并绘制密钥的余额历史
+function loadBalanceHistory(keyId, days) {
+    const chart = document.getElementById('balance-history-chart');
+    const summary = document.getElementById('balance-history-summary');
+    chart.textContent = '加载中...';
+    summary.textContent = '';
+    
+    fetch(`/keys/${keyId}/balance-history?days=${days}`)
+        .then(response => response.json())
+        .then(data => {
+            if (data.error) {
+                chart.textContent = data.error;
+                return;
+            }
+            
+            const points = data.points || [];
+            if (points.length < 2) {
+                chart.textContent = '余额快照不足，刷新余额后会记录新的快照';
+                return;
+            }
+            
+            chart.innerHTML = renderBalanceHistoryChart(points);
+            
+            // 根据首尾快照估算每天消耗的余额和剩余可用天数
+            const first = points[0];
+            const last = points[points.length - 1];
+            const elapsedDays = (last.sampled_at - first.sampled_at) / 86400;
+            const perDay = elapsedDays > 0 ? (first.balance - last.balance) / elapsedDays : 0;
+            if (perDay > 0) {
+                const daysLeft = Math.max(last.balance - MIN_BALANCE_THRESHOLD, 0) / perDay;
+                summary.textContent = `平均每天消耗 ${perDay.toFixed(2)}，预计 ${daysLeft.toFixed(1)} 天后低于最低余额阈值 ${MIN_BALANCE_THRESHOLD}`;
+            } else {
+                summary.textContent = '该时间段内余额没有减少';
+            }
+        })
+        .catch(error => {
+            chart.textContent = `加载余额历史失败: ${error}`;
+        });
+}
+
+// 以SVG折线图绘制余额快照
+function renderBalanceHistoryChart(points) {
+    const width = 700;
+    const height = 220;
+    const padding = { left: 50, right: 10, top: 10, bottom: 25 };
+    
+    const minTime = points[0].sampled_at;
+    const maxTime = points[points.length - 1].sampled_at;
+    const balances = points.map(p => p.balance);
+    let minBalance = Math.min(...balances);
+    let maxBalance = Math.max(...balances);
+    if (maxBalance === minBalance) {
+        maxBalance += 1;
+        minBalance = Math.max(minBalance - 1, 0);
+    }
+    
+    const x = t => padding.left + (t - minTime) / Math.max(maxTime - minTime, 1) * (width - padding.left - padding.right);
+    const y = b => padding.top + (maxBalance - b) / (maxBalance - minBalance) * (height - padding.top - padding.bottom);
+    const line = points.map(p => `${x(p.sampled_at).toFixed(1)},${y(p.balance).toFixed(1)}`).join(' ');
+    const bottom = height - padding.bottom;
+    
+    return `
+        <svg class="balance-history-chart" viewBox="0 0 ${width} ${height}" preserveAspectRatio="none">
+            <line class="history-axis" x1="${padding.left}" y1="${padding.top}" x2="${padding.left}" y2="${bottom}"></line>
+            <line class="history-axis" x1="${padding.left}" y1="${bottom}" x2="${width - padding.right}" y2="${bottom}"></line>
+            <text x="${padding.left - 5}" y="${padding.top + 10}" text-anchor="end">${maxBalance.toFixed(2)}</text>
+            <text x="${padding.left - 5}" y="${bottom}" text-anchor="end">${minBalance.toFixed(2)}</text>
+            <text x="${padding.left}" y="${height - 5}">${new Date(minTime * 1000).toLocaleString()}</text>
+            <text x="${width - padding.right}" y="${height - 5}" text-anchor="end">${new Date(maxTime * 1000).toLocaleString()}</text>
+            <polyline class="history-line" points="${line}"></polyline>
+        </svg>
+    `;
+}
+
+// 显示密钥余额的行内编辑器
+function showBalanceEditor(span) {
+    const key = span.dataset.key;
+    const mode = span.dataset.balanceMode || 'auto';
+    const balance = parseFloat(span.dataset.balance || 0);
+    const costPerRequest = parseFloat(span.dataset.costPerRequest || 0);
+    
+    const editor = document.createElement('span');
+    editor.className = 'balance-editor d-inline-flex align-items-center gap-1';
+    editor.innerHTML = `
+        <select class="form-select form-select-sm balance-mode-select" style="width: auto;">
+            <option value="auto" ${mode === 'auto' ? 'selected' : ''}>自动</option>
+            <option value="manual" ${mode === 'manual' ? 'selected' : ''}>手动</option>
+            <option value="untracked" ${mode === 'untracked' ? 'selected' : ''}>不跟踪</option>
+        </select>
+        <input type="number" class="form-control form-control-sm balance-input" style="width: 90px;" step="0.01" min="0" value="${balance.toFixed(2)}" title="余额">
+        <input type="number" class="form-control form-control-sm cost-input" style="width: 90px;" step="0.0001" min="0" value="${costPerRequest}" title="每次请求扣减的预估费用">
+        <button type="button" class="btn btn-sm btn-outline-primary balance-save-btn">保存</button>
+        <button type="button" class="btn btn-sm btn-outline-secondary balance-cancel-btn">取消</button>
+    `;
+    
+    const modeSelect = editor.querySelector('.balance-mode-select');
+    const balanceInput = editor.querySelector('.balance-input');
+    const costInput = editor.querySelector('.cost-input');
+    
+    // 只有手动模式需要输入余额和预估费用
+    const updateInputs = () => {
+        const manual = modeSelect.value === 'manual';
+        balanceInput.style.display = manual ? '' : 'none';
+        costInput.style.display = manual ? '' : 'none';
+    };
+    updateInputs();
+    modeSelect.addEventListener('change', updateInputs);
+    
+    // 阻止编辑器内的点击触发密钥项事件
+    editor.addEventListener('click', e => e.stopPropagation());
+    
+    editor.querySelector('.balance-cancel-btn').addEventListener('click', () => {
+        editor.replaceWith(span);
+    });
+    
+    editor.querySelector('.balance-save-btn').addEventListener('click', () => {
+        fetch(`/keys/${encodeURIComponent(key)}/balance`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({
+                balance_mode: modeSelect.value,
+                balance: parseFloat(balanceInput.value) || 0,
+                cost_per_request: parseFloat(costInput.value) || 0
+            })
+        })
+            .then(response => response.json().then(data => ({ ok: response.ok, data })))
+            .then(({ ok, data }) => {
+                if (!ok) {
+                    throw new Error(data.error || '设置余额失败');
+                }
+                showToast('密钥余额已更新', 'success');
+                loadKeys();
+            })
+            .catch(error => {
+                console.error('设置余额失败:', error);
+                showToast(error.message, 'danger');
+            });
+    });
+    
+    span.replaceWith(editor);
+}
+
 // 渲染分页
 function renderPagination(totalPages) {
     const keysPagination = document.getElementById('keys-pagination');
@@ -672,6 +894,74 @@ function renderPagination(totalPages) {
 }
 
 // 加载系统概要
+// 更新系统时钟偏差警告横幅
+function updateClockSkewWarning(clockSkew) {
+    const banner = document.getElementById('clock-skew-warning');
+    if (!banner) {
+        return;
+    }
+
+    if (clockSkew && clockSkew.warning) {
+        document.getElementById('clock-skew-message').textContent = clockSkew.message;
+        banner.classList.remove('d-none');
+    } else {
+        banner.classList.add('d-none');
+    }
+}
+
+// 更新数据目录版本警告横幅
+function updateDataVersionWarning(dataVersion) {
+    const banner = document.getElementById('data-version-warning');
+    if (!banner) {
+        return;
+    }
+
+    if (dataVersion && dataVersion.message) {
+        // 只读维护模式使用更醒目的样式
+        banner.classList.toggle('alert-danger', dataVersion.read_only);
+        banner.classList.toggle('alert-warning', !dataVersion.read_only);
+        document.getElementById('data-version-message').textContent = dataVersion.message;
+        banner.classList.remove('d-none');
+    } else {
+        banner.classList.add('d-none');
+    }
+}
+
+// 轮询后台余额刷新进度，刷新完成后重新加载密钥列表
+function pollBalanceRefreshStatus() {
+    const badge = document.getElementById('balance-refresh-status');
+    if (!badge) {
+        return;
+    }
+
+    fetch('/keys/refresh-status')
+        .then(response => {
+            if (!response.ok) {
+                throw new Error(`服务器响应错误: ${response.status}`);
+            }
+            return response.json();
+        })
+        .then(status => {
+            if (status.running) {
+                badge.textContent = `余额刷新中 ${status.completed}/${status.total}`;
+                badge.classList.remove('d-none');
+                badge.dataset.running = 'true';
+                setTimeout(pollBalanceRefreshStatus, 2000);
+                return;
+            }
+
+            badge.classList.add('d-none');
+            if (badge.dataset.running === 'true') {
+                delete badge.dataset.running;
+                loadKeys();
+                loadStats();
+            }
+        })
+        .catch(error => {
+            console.error('获取余额刷新进度失败:', error);
+        });
+}
+
 function loadStats() {
     fetch('/stats')
         .then(response => {
@@ -681,6 +971,12 @@ function loadStats() {
             return response.json();
         })
         .then(data => {
+            // 更新时钟偏差警告
+            updateClockSkewWarning(data.clock_skew);
+
+            // 更新数据目录版本警告
+            updateDataVersionWarning(data.data_version);
+
             // 将数据显示在系统概要容器中
             const statsContainer = document.getElementById('stats-container');
             
@@ -2115,9 +2411,9 @@ function loadCurrentKeyInfo() {
     }, KEY_INFO_DEBOUNCE_DELAY);
 }
 
-// 加载日志
-function loadLogs() {
-    fetch('/logs')
+// 加载日志，level不为空时只显示该等级及以上的日志
+function loadLogs(level) {
+    fetch(level ? `/logs?level=${encodeURIComponent(level)}` : '/logs')
         .then(response => response.text())
         .then(data => {
             document.getElementById('log-content').textContent = data;
@@ -2129,11 +2425,47 @@ function loadLogs() {
 }
 
 // 显示日志查看器
-function showLogViewer() {
-    loadLogs();
+function showLogViewer(level) {
+    loadLogs(level);
     document.getElementById('log-viewer').style.display = 'block';
 }
 
+// 根据深层链接定位到对应内容，密钥链接需要等密钥列表加载完成
+function applyDeepLink(keysLoaded) {
+    if (deepLinkApplied || typeof DEEP_LINK === 'undefined' || !DEEP_LINK) {
+        return;
+    }
+    if (DEEP_LINK.type === 'key' && !keysLoaded) {
+        return;
+    }
+    deepLinkApplied = true;
+
+    switch (DEEP_LINK.type) {
+        case 'key': {
+            const index = allKeys.findIndex(k => k.id === DEEP_LINK.id);
+            if (index < 0) {
+                showToast('链接中的密钥不存在或已被删除', 'error');
+                return;
+            }
+            currentPage = Math.floor(index / ITEMS_PER_PAGE) + 1;
+            renderKeysList();
+            const item = document.querySelector(`.key-item[data-key="${CSS.escape(allKeys[index].key)}"]`);
+            if (item) {
+                item.classList.add('deep-link-highlight');
+                item.scrollIntoView({ behavior: 'smooth', block: 'center' });
+            }
+            showBalanceHistory(DEEP_LINK.id);
+            break;
+        }
+        case 'logs':
+            showLogViewer(DEEP_LINK.level);
+            break;
+        case 'model_stats':
+            document.getElementById('top-models-container').scrollIntoView({ behavior: 'smooth', block: 'center' });
+            break;
+    }
+}
+
 // 隐藏日志查看器
 function hideLogViewer() {
     document.getElementById('log-viewer').style.display = 'none';
@@ -2788,6 +3120,12 @@ document.addEventListener('DOMContentLoaded', function() {
     // 加载常用模型
     loadTopModels();
     
+    // 定位日志、模型统计等不依赖密钥列表的深层链接
+    applyDeepLink(false);
+    
+    // 显示启动时后台余额刷新的进度
+    pollBalanceRefreshStatus();
+    
     // 添加常用模型的样式
     const modelStyle = document.createElement('style');
     modelStyle.textContent = `
@@ -3028,10 +3366,29 @@ document.addEventListener('DOMContentLoaded', function() {
     
     // 加载常用模型
     loadTopModels();
+    
+    // 加载本周与上周的请求数对比
+    loadWeekComparison();
+    
+    // 加载客户端用量
+    loadClientUsage();
+
+    // 加载分组用量
+    loadGroupUsage();
+
+    // 加载密钥得分分布
+    loadScoreDistribution();
+
+    // 加载实时请求统计，之后每2秒获取新增的数据
+    loadRealtimeStats();
+    realtimeStatsTimer = setInterval(loadRealtimeStats, 2000);
 });
 
 // 在页面关闭或切换时清除定时器
 window.addEventListener('beforeunload', function() {
+    if (realtimeStatsTimer) {
+        clearInterval(realtimeStatsTimer);
+    }
     if (autoUpdateTimer) {
         clearInterval(autoUpdateTimer);
     }
@@ -3488,6 +3845,235 @@ function loadTopModels() {
         });
 }
 
+// 加载本周与上周相同时段的请求数对比，显示在每日请求数下方
+function loadWeekComparison() {
+    const el = document.getElementById('rpd-week-compare');
+    if (!el) return;
+    
+    fetch('/request-stats/compare?metric=requests&period=week&offset=1')
+        .then(response => {
+            if (!response.ok) {
+                throw new Error(`获取周期对比失败: ${response.status}`);
+            }
+            return response.json();
+        })
+        .then(data => {
+            if (data.delta_percent === null || data.delta_percent === undefined) {
+                el.textContent = '相比上周 --';
+                el.className = 'small text-muted';
+                return;
+            }
+            const percent = data.delta_percent;
+            el.textContent = `相比上周 ${percent > 0 ? '+' : ''}${percent.toFixed(1)}%`;
+            el.className = percent > 0 ? 'small text-success' : (percent < 0 ? 'small text-danger' : 'small text-muted');
+            el.title = `${data.current.start} 至 ${data.current.end} 与 ${data.previous.start} 至 ${data.previous.end}，今天只比较前 ${data.compared_hours} 个小时`;
+        })
+        .catch(error => {
+            console.error('获取周期对比失败:', error);
+            el.textContent = '';
+        });
+}
+
+// 加载今日客户端用量
+function loadClientUsage() {
+    const container = document.getElementById('client-usage-container');
+    if (!container) return;
+    
+    fetch('/request-stats/clients?limit=10')
+        .then(response => response.json())
+        .then(data => {
+            if (!data.enabled) {
+                container.innerHTML = '<div class="alert alert-info">客户端用量统计已关闭</div>';
+            } else if (data.clients && data.clients.length > 0) {
+                let html = '<div class="top-models-list">';
+                
+                // 遍历客户端
+                data.clients.forEach(client => {
+                    const name = client.client === 'other' ? '其他客户端' : client.client;
+                    html += `
+                    <div class="top-model-item">
+                        <div class="model-name">${name}</div>
+                        <div class="model-info">
+                            <span class="badge bg-info">请求: ${client.requests}</span>
+                            <span class="badge bg-secondary">令牌: ${client.tokens}</span>
+                        </div>
+                    </div>`;
+                });
+                
+                html += '</div>';
+                container.innerHTML = html;
+            } else {
+                container.innerHTML = '<div class="alert alert-info">今日暂无客户端用量数据</div>';
+            }
+            
+            // 更新时间
+            document.getElementById('client-usage-last-update').textContent = '上次更新: ' + new Date().toLocaleTimeString();
+        })
+        .catch(error => {
+            console.error('获取客户端用量失败:', error);
+            container.innerHTML = '<p>获取客户端用量失败</p>';
+        });
+}
+
+// 加载各分组和密钥池的余额用量
+function loadGroupUsage() {
+    const container = document.getElementById('group-usage-container');
+    if (!container) return;
+    
+    fetch('/keys/groups/stats')
+        .then(response => response.json())
+        .then(data => {
+            const renderItem = (name, usage) => {
+                const exhaustion = usage.days_until_exhausted >= 0
+                    ? `约 ${usage.days_until_exhausted.toFixed(1)} 天（${usage.exhaustion_date}）`
+                    : '无法估算';
+                return `
+                    <div class="top-model-item">
+                        <div class="model-name">${name}</div>
+                        <div class="model-info">
+                            <span class="badge bg-success">余额: ${usage.balance.toFixed(2)}</span>
+                            <span class="badge bg-info">请求: ${usage.today_requests}</span>
+                            <span class="badge bg-secondary">令牌: ${usage.today_tokens}</span>
+                        </div>
+                        <div class="model-info mt-1 small text-muted">
+                            <span>今日消耗: ${usage.today_cost.toFixed(2)}</span>
+                            <span>流量占比: ${usage.traffic_share.toFixed(1)}%</span>
+                            <span>预计耗尽: ${exhaustion}</span>
+                        </div>
+                    </div>`;
+            };
+            
+            let html = '<div class="top-models-list">';
+            if (data.pool) {
+                html += renderItem('全部密钥', data.pool);
+            }
+            (data.groups || []).forEach(group => {
+                html += renderItem(group.name === 'default' ? '默认分组' : group.name, group);
+            });
+            html += '</div>';
+            container.innerHTML = html;
+            
+            // 更新时间
+            document.getElementById('group-usage-last-update').textContent = '上次更新: ' + new Date().toLocaleTimeString();
+        })
+        .catch(error => {
+            console.error('获取分组用量失败:', error);
+            container.innerHTML = '<p>获取分组用量失败</p>';
+        });
+}
+
+// 加载密钥得分分布直方图
+function loadScoreDistribution() {
+    const container = document.getElementById('score-distribution-container');
+    if (!container) return;
+    
+    fetch('/keys/score-distribution?buckets=10')
+        .then(response => response.json())
+        .then(data => {
+            const buckets = data.buckets || [];
+            if (buckets.length === 0) {
+                container.innerHTML = '<p>暂无可用密钥</p>';
+            } else {
+                const maxCount = Math.max(...buckets.map(bucket => bucket.key_count), 1);
+                const total = buckets.reduce((sum, bucket) => sum + bucket.key_count, 0);
+                
+                let html = '<div class="score-histogram">';
+                buckets.forEach(bucket => {
+                    const height = bucket.key_count > 0 ? Math.max(bucket.key_count / maxCount * 80, 3) : 0;
+                    const range = `${bucket.score_min.toFixed(1)} - ${bucket.score_max.toFixed(1)}`;
+                    html += `
+                        <div class="score-histogram-column" title="得分 ${range}：${bucket.key_count} 个密钥">
+                            <div class="score-histogram-count">${bucket.key_count}</div>
+                            <div class="score-histogram-bar" style="height: ${height}%"></div>
+                            <div class="score-histogram-label">${bucket.score_min.toFixed(1)}</div>
+                        </div>`;
+                });
+                html += '</div>';
+                
+                const first = buckets[0];
+                const last = buckets[buckets.length - 1];
+                html += `<div class="small text-muted mt-2">共 ${total} 个可用密钥，得分范围 ${first.score_min.toFixed(1)} - ${last.score_max.toFixed(1)}`;
+                if (buckets.length === 1) {
+                    html += '，所有密钥得分相同，不同得分策略会选出相近的密钥';
+                }
+                html += '</div>';
+                container.innerHTML = html;
+            }
+            
+            // 更新时间
+            document.getElementById('score-distribution-last-update').textContent = '上次更新: ' + new Date().toLocaleTimeString();
+        })
+        .catch(error => {
+            console.error('获取密钥得分分布失败:', error);
+            container.innerHTML = '<p>获取密钥得分分布失败</p>';
+        });
+}
+
+// 实时请求统计，保存最近15分钟的每秒数据，每次只获取上次cursor之后的数据
+let realtimeStatsTimer = null;
+let realtimeStatsCursor = 0;
+let realtimeStatsPoints = [];
+const REALTIME_WINDOW_SECONDS = 15 * 60;
+
+// 加载实时请求统计
+function loadRealtimeStats() {
+    const container = document.getElementById('realtime-stats-container');
+    if (!container) return;
+    
+    fetch(`/request-stats/realtime?since=${realtimeStatsCursor}`)
+        .then(response => response.json())
+        .then(data => {
+            realtimeStatsCursor = data.cursor;
+            realtimeStatsPoints = realtimeStatsPoints.concat(data.points || []);
+            const oldest = data.cursor - REALTIME_WINDOW_SECONDS + 1;
+            realtimeStatsPoints = realtimeStatsPoints.filter(p => p.second >= oldest);
+            
+            const totalRequests = realtimeStatsPoints.reduce((sum, p) => sum + p.requests, 0);
+            const totalErrors = realtimeStatsPoints.reduce((sum, p) => sum + p.errors, 0);
+            document.getElementById('realtime-stats-summary').textContent =
+                `当前 ${data.rps.toFixed(1)} 请求/秒，15分钟内 ${totalRequests} 个请求，${totalErrors} 个失败`;
+            
+            if (realtimeStatsPoints.length < 2) {
+                container.innerHTML = '<p>暂无数据</p>';
+                return;
+            }
+            container.innerHTML = renderRealtimeChart(realtimeStatsPoints);
+        })
+        .catch(error => {
+            console.error('获取实时请求统计失败:', error);
+        });
+}
+
+// 以SVG折线图绘制每秒请求数和失败数
+function renderRealtimeChart(points) {
+    const width = 700;
+    const height = 160;
+    const padding = { left: 40, right: 10, top: 10, bottom: 20 };
+    
+    const minTime = points[0].second;
+    const maxTime = points[points.length - 1].second;
+    const maxRequests = Math.max(...points.map(p => p.requests), 1);
+    
+    const x = t => padding.left + (t - minTime) / Math.max(maxTime - minTime, 1) * (width - padding.left - padding.right);
+    const y = v => padding.top + (maxRequests - v) / maxRequests * (height - padding.top - padding.bottom);
+    const requestLine = points.map(p => `${x(p.second).toFixed(1)},${y(p.requests).toFixed(1)}`).join(' ');
+    const errorLine = points.map(p => `${x(p.second).toFixed(1)},${y(p.errors).toFixed(1)}`).join(' ');
+    const bottom = height - padding.bottom;
+    
+    return `
+        <svg class="realtime-chart" viewBox="0 0 ${width} ${height}" preserveAspectRatio="none">
+            <line class="history-axis" x1="${padding.left}" y1="${padding.top}" x2="${padding.left}" y2="${bottom}"></line>
+            <line class="history-axis" x1="${padding.left}" y1="${bottom}" x2="${width - padding.right}" y2="${bottom}"></line>
+            <text x="${padding.left - 5}" y="${padding.top + 10}" text-anchor="end">${maxRequests}</text>
+            <text x="${padding.left - 5}" y="${bottom}" text-anchor="end">0</text>
+            <text x="${padding.left}" y="${height - 5}">${new Date(minTime * 1000).toLocaleTimeString()}</text>
+            <text x="${width - padding.right}" y="${height - 5}" text-anchor="end">${new Date(maxTime * 1000).toLocaleTimeString()}</text>
+            <polyline class="history-line" points="${requestLine}"></polyline>
+            <polyline class="realtime-error-line" points="${errorLine}"></polyline>
+        </svg>
+    `;
+}
+
 // 添加常用模型的样式
 document.addEventListener('DOMContentLoaded', function() {
     // 创建样式元素
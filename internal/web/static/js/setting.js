@@ -9,7 +9,7 @@ const AUTO_UPDATE_INTERVAL = 'auto_update_interval'; // 自动更新间隔
 const STATS_REFRESH_INTERVAL = 'stats_refresh_interval'; // 统计刷新间隔
 const RATE_REFRESH_INTERVAL = 'rate_refresh_interval'; // 速率刷新间隔
 const RETRY_DELAY_MS = 'retry_delay_ms'; // 重试延迟毫秒
-const RECOVERY_INTERVAL = 'recovery_interval'; // 恢复间隔
+const RECOVERY_GIVE_UP_HOURS = 'recovery_give_up_hours'; // 放弃恢复时间
 const AUTO_DELETE_ZERO_BALANCE_KEYS = 'auto_delete_zero_balance_keys'; // 自动删除余额为0的密钥
 const REFRESH_USED_KEYS_INTERVAL = 'refresh_used_keys_interval'; // 刷新已使用密钥余额的间隔
 const TOAST_DISPLAY_TIME = 1500; // Toast显示时间（毫秒）
@@ -46,6 +46,9 @@ document.addEventListener('DOMContentLoaded', function() {
         }
     });
     
+    // 切换代理验证方式时显示对应的输入项
+    document.getElementById('auth-mode').addEventListener('change', updateAuthModeFields);
+    
     // 绑定生成API密钥按钮点击事件
     document.getElementById('generate-api-key').addEventListener('click', function() {
         const apiKey = generateApiKey();
@@ -69,6 +72,13 @@ document.addEventListener('DOMContentLoaded', function() {
         }
     });
 
+    // 紧急轮换凭据按钮点击事件
+    document.getElementById('panic-rotate').addEventListener('click', panicRotateCredentials);
+    // 从托盘菜单打开时直接进入确认流程
+    if (new URLSearchParams(window.location.search).get('panic') === '1') {
+        setTimeout(panicRotateCredentials, 300);
+    }
+
     // 重启程序按钮点击事件
     document.getElementById('restart-app').addEventListener('click', function() {
         // 先保存设置，然后重启程序
@@ -102,7 +112,9 @@ document.addEventListener('DOMContentLoaded', function() {
             // 收集表单数据
             const config = {
                 server: {
-                    port: getValue('server-port')
+                    port: getValue('server-port'),
+                    allowed_client_cidrs: getAllowedClientCIDRs(),
+                    cors_allowed_origins: getCorsAllowedOrigins()
                 },
                 api_proxy: {
                     base_url: getValue('api-base-url'),
@@ -130,13 +142,14 @@ document.addEventListener('DOMContentLoaded', function() {
                     max_balance_display: getValue('max-balance'),
                     items_per_page: getValue('items-per-page'),
                     max_stats_entries: getValue('max-stats'),
-                    [RECOVERY_INTERVAL]: getValue('recovery-interval'),
+                    [RECOVERY_GIVE_UP_HOURS]: getValue('recovery-give-up-hours'),
                     max_consecutive_failures: getValue('max-failures'),
                     hide_icon: getValue('hide-icon'),
                     balance_weight: getValue('balance-weight'),
                     success_rate_weight: getValue('success-rate-weight'),
                     rpm_weight: getValue('rpm-weight'),
                     tpm_weight: getValue('tpm-weight'),
+                    composite_weights: getCompositeWeights(),
                     [AUTO_UPDATE_INTERVAL]: getValue('auto-update'),
                     [STATS_REFRESH_INTERVAL]: getValue('stats-refresh'),
                     [RATE_REFRESH_INTERVAL]: getValue('rate-refresh'),
@@ -145,7 +158,10 @@ document.addEventListener('DOMContentLoaded', function() {
                 },
                 log: {
                     max_size_mb: getValue('log-max-size'),
-                    level: getValue('log-level')
+                    level: getValue('log-level'),
+                    multi_output: getValue('log-multi-output'),
+                    max_files: getValue('log-max-files'),
+                    min_files: getValue('log-min-files')
                 }
             };
 
@@ -198,12 +214,16 @@ document.addEventListener('DOMContentLoaded', function() {
             // 收集表单数据
             const config = {
                 server: {
-                    port: getValue('server-port')
+                    port: getValue('server-port'),
+                    allowed_client_cidrs: getAllowedClientCIDRs(),
+                    cors_allowed_origins: getCorsAllowedOrigins()
                 },
                 security:{
                     password_enabled: getValue('password-enabled'),
                     expiration_minutes: getValue('expiration-minutes'),
-                    api_key_enabled: getValue('api-key-enabled'),
+                    auth_mode: getValue('auth-mode'),
+                    client_tokens: getClientTokens(),
+                    client_token_max_choices: getClientTokenMaxChoices(),
                     api_key: getValue('api-key'),
                     password: getValue('password')
                 },
@@ -233,13 +253,14 @@ document.addEventListener('DOMContentLoaded', function() {
                     max_balance_display: getValue('max-balance'),
                     items_per_page: getValue('items-per-page'),
                     max_stats_entries: getValue('max-stats'),
-                    [RECOVERY_INTERVAL]: getValue('recovery-interval'),
+                    [RECOVERY_GIVE_UP_HOURS]: getValue('recovery-give-up-hours'),
                     max_consecutive_failures: getValue('max-failures'),
                     hide_icon: getValue('hide-icon'),
                     balance_weight: getValue('balance-weight'),
                     success_rate_weight: getValue('success-rate-weight'),
                     rpm_weight: getValue('rpm-weight'),
                     tpm_weight: getValue('tpm-weight'),
+                    composite_weights: getCompositeWeights(),
                     [AUTO_UPDATE_INTERVAL]: getValue('auto-update'),
                     [STATS_REFRESH_INTERVAL]: getValue('stats-refresh'),
                     [RATE_REFRESH_INTERVAL]: getValue('rate-refresh'),
@@ -248,7 +269,10 @@ document.addEventListener('DOMContentLoaded', function() {
                 },
                 log: {
                     max_size_mb: getValue('log-max-size'),
-                    level: getValue('log-level')
+                    level: getValue('log-level'),
+                    multi_output: getValue('log-multi-output'),
+                    max_files: getValue('log-max-files'),
+                    min_files: getValue('log-min-files')
                 }
             };
 
@@ -641,6 +665,8 @@ function populateForm(config) {
 
     // 服务器设置
     setValue('server-port', config.server.port);
+    setValue('allowed-client-cidrs', (config.server.allowed_client_cidrs || []).join('\n'));
+    setValue('cors-allowed-origins', (config.server.cors_allowed_origins || []).join('\n'));
 
     // API代理设置
     setValue('api-base-url', config.api_proxy.base_url);
@@ -682,8 +708,15 @@ function populateForm(config) {
         // 不回显密码，密码字段留空
         setValue('expiration-minutes', config.security.expiration_minutes);
         // API密钥设置
-        setValue('api-key-enabled', config.security.api_key_enabled);
+        setValue('auth-mode', config.security.auth_mode || (config.security.api_key_enabled ? 'fixed_secret' : 'none'));
+        setValue('client-tokens', (config.security.client_tokens || []).join('\n'));
+        setValue('client-token-max-choices', Object.entries(config.security.client_token_max_choices || {})
+            .map(([token, limit]) => token + '=' + limit)
+            .join('\n'));
         setValue('api-key', config.security.api_key || '');
+        document.getElementById('api-key-env-hint').classList.toggle('d-none', !config.security.api_key_from_env);
+        document.getElementById('auth-mode').dataset.secretFromEnv = config.security.api_key_from_env ? 'true' : '';
+        updateAuthModeFields();
     }
     
     // 应用设置
@@ -692,7 +725,7 @@ function populateForm(config) {
     setValue('max-balance', config.app.max_balance_display);
     setValue('items-per-page', config.app.items_per_page);
     setValue('max-stats', config.app.max_stats_entries);
-    setValue('recovery-interval', config.app[RECOVERY_INTERVAL]);
+    setValue('recovery-give-up-hours', config.app[RECOVERY_GIVE_UP_HOURS]);
     setValue('max-failures', config.app.max_consecutive_failures);
     setValue('hide-icon', config.app.hide_icon);
     
@@ -701,6 +734,11 @@ function populateForm(config) {
     setValue('success-rate-weight', config.app.success_rate_weight);
     setValue('rpm-weight', config.app.rpm_weight);
     setValue('tpm-weight', config.app.tpm_weight);
+    const compositeWeights = config.app.composite_weights || {};
+    setValue('composite-balance-weight', compositeWeights.balance);
+    setValue('composite-success-weight', compositeWeights.success);
+    setValue('composite-rpm-weight', compositeWeights.rpm);
+    setValue('composite-tpm-weight', compositeWeights.tpm);
     
     // 自动更新配置
     setValue('auto-update', config.app[AUTO_UPDATE_INTERVAL]);
@@ -712,6 +750,9 @@ function populateForm(config) {
     // 日志设置
     setValue('log-max-size', config.log.max_size_mb);
     setValue('log-level', config.log.level || 'warn'); // 设置日志等级，默认为warn
+    setValue('log-multi-output', config.log.multi_output);
+    setValue('log-max-files', config.log.max_files);
+    setValue('log-min-files', config.log.min_files);
 }
 
 /**
@@ -781,6 +822,8 @@ function getStrategyText(strategy) {
             return '策略7 - 低余额';
         case 8:
             return '策略8 - 免费';
+        case 9:
+            return '策略9 - 综合加权';
         default:
             return '未知策略';
     }
@@ -1100,7 +1143,9 @@ function saveSettings(callback) {
     // 收集表单数据
     const config = {
         server: {
-            port: getValue('server-port')
+            port: getValue('server-port'),
+            allowed_client_cidrs: getAllowedClientCIDRs(),
+            cors_allowed_origins: getCorsAllowedOrigins()
         },
         api_proxy: {
             base_url: getValue('api-base-url'),
@@ -1121,7 +1166,9 @@ function saveSettings(callback) {
         security: {
             password_enabled: getValue('password-enabled'),
             expiration_minutes: getValue('expiration-minutes'),
-            api_key_enabled: getValue('api-key-enabled'),
+            auth_mode: getValue('auth-mode'),
+            client_tokens: getClientTokens(),
+            client_token_max_choices: getClientTokenMaxChoices(),
             api_key: getValue('api-key')
         },
         app: {
@@ -1130,7 +1177,7 @@ function saveSettings(callback) {
             max_balance_display: getValue('max-balance'),
             items_per_page: getValue('items-per-page'),
             max_stats_entries: getValue('max-stats'),
-            recovery_interval: getValue('recovery-interval'),
+            recovery_give_up_hours: getValue('recovery-give-up-hours'),
             max_consecutive_failures: getValue('max-failures'),
             model_key_strategies: collectModelStrategies(),
             hide_icon: getValue('hide-icon'),
@@ -1138,6 +1185,7 @@ function saveSettings(callback) {
             success_rate_weight: getValue('success-rate-weight'),
             rpm_weight: getValue('rpm-weight'),
             tpm_weight: getValue('tpm-weight'),
+            composite_weights: getCompositeWeights(),
             [AUTO_UPDATE_INTERVAL]: getValue('auto-update'),
             [STATS_REFRESH_INTERVAL]: getValue('stats-refresh'),
             [RATE_REFRESH_INTERVAL]: getValue('rate-refresh'),
@@ -1146,18 +1194,17 @@ function saveSettings(callback) {
         },
         log: {
             max_size_mb: getValue('log-max-size'),
-            level: getValue('log-level')
+            level: getValue('log-level'),
+            multi_output: getValue('log-multi-output'),
+            max_files: getValue('log-max-files'),
+            min_files: getValue('log-min-files')
         }
     };
     
-    // 检查是否尝试启用API密钥验证但没有提供API密钥
-    if (config.security.api_key_enabled) {
-        const apiKey = getValue('api-key');
-        // 检查是否有现有API密钥（通过检查api-key-enabled复选框是否已经被选中）
-        const apiKeyEnabledOrig = document.getElementById('api-key-enabled').hasAttribute('data-orig-checked');
-        
-        // 如果没有已存在的API密钥（新启用API密钥验证）且没有提供新API密钥
-        if (!apiKeyEnabledOrig && !apiKey) {
+    // 检查是否选择了固定API密钥但没有提供API密钥，环境变量设置了密钥时不需要
+    if (config.security.auth_mode === 'fixed_secret') {
+        const secretFromEnv = document.getElementById('auth-mode').dataset.secretFromEnv === 'true';
+        if (!secretFromEnv && !getValue('api-key')) {
             showToast('启用API密钥验证时必须设置API密钥', 'error');
             // 聚焦API密钥输入框
             document.getElementById('api-key').focus();
@@ -1165,6 +1212,13 @@ function saveSettings(callback) {
         }
     }
 
+    // 检查是否选择了客户端令牌列表但没有填写令牌
+    if (config.security.auth_mode === 'token_list' && config.security.client_tokens.length === 0) {
+        showToast('使用客户端令牌列表验证时至少需要一个令牌', 'error');
+        document.getElementById('client-tokens').focus();
+        return;
+    }
+
     // 获取密码值，仅当字段不为空时才添加
     const password = getValue('password');
     if (password !== '') {
@@ -1206,7 +1260,6 @@ function saveSettings(callback) {
 
         // 保存初始复选框状态（用于下次验证）
         saveCheckboxOriginalState('password-enabled');
-        saveCheckboxOriginalState('api-key-enabled');
 
         // 执行回调
         if (typeof callback === 'function') {
@@ -1239,7 +1292,81 @@ function saveCheckboxOriginalState(id) {
  */
 function saveAllCheckboxStates() {
     saveCheckboxOriginalState('password-enabled');
-    saveCheckboxOriginalState('api-key-enabled');
+}
+
+/**
+ * 获取客户端令牌列表，每行一个令牌
+ * @returns {string[]} 去掉空行后的令牌
+ */
+function getClientTokens() {
+    return getValue('client-tokens')
+        .split('\n')
+        .map(token => token.trim())
+        .filter(token => token !== '');
+}
+
+/**
+ * 获取每个客户端令牌的候选结果数上限，每行格式为 令牌=上限
+ * @returns {Object} 令牌到上限的映射，忽略格式错误和不大于0的行
+ */
+function getClientTokenMaxChoices() {
+    const limits = {};
+    getValue('client-token-max-choices').split('\n').forEach(line => {
+        const separator = line.lastIndexOf('=');
+        if (separator <= 0) {
+            return;
+        }
+        const token = line.slice(0, separator).trim();
+        const limit = parseInt(line.slice(separator + 1).trim(), 10);
+        if (token !== '' && limit > 0) {
+            limits[token] = limit;
+        }
+    });
+    return limits;
+}
+
+/**
+ * 获取综合加权策略的权重
+ * @returns {Object} 余额、成功率和剩余RPM、TPM余量的权重
+ */
+function getCompositeWeights() {
+    return {
+        balance: getValue('composite-balance-weight'),
+        success: getValue('composite-success-weight'),
+        rpm: getValue('composite-rpm-weight'),
+        tpm: getValue('composite-tpm-weight')
+    };
+}
+
+/**
+ * 获取允许访问代理接口的客户端地址列表
+ * @returns {string[]} 地址或地址范围
+ */
+function getAllowedClientCIDRs() {
+    return getValue('allowed-client-cidrs')
+        .split('\n')
+        .map(cidr => cidr.trim())
+        .filter(cidr => cidr !== '');
+}
+
+/**
+ * 获取允许跨域调用代理接口的来源列表
+ * @returns {string[]} 来源
+ */
+function getCorsAllowedOrigins() {
+    return getValue('cors-allowed-origins')
+        .split('\n')
+        .map(origin => origin.trim())
+        .filter(origin => origin !== '');
+}
+
+/**
+ * 按代理验证方式显示对应的输入项
+ */
+function updateAuthModeFields() {
+    const mode = getValue('auth-mode');
+    document.getElementById('client-tokens-group').classList.toggle('d-none', mode !== 'token_list');
+    document.getElementById('api-key-group').classList.toggle('d-none', mode !== 'fixed_secret');
 }
 
 /**
@@ -1256,6 +1383,51 @@ function saveSettingsWithCallback(callback) {
  * @param {string} message - 通知消息
  * @param {string} type - 通知类型（success/error/info）
  */
+// 紧急轮换所有对外暴露的凭据，需要输入确认短语，新凭据只显示一次
+function panicRotateCredentials() {
+    const phrase = 'ROTATE ALL CREDENTIALS';
+    if (!confirm('将吊销所有客户端令牌，更换固定API密钥和接口访问令牌，所有登录立即失效。\n上游的API密钥不会修改。确定继续吗？')) {
+        return;
+    }
+    const disableProxy = confirm('是否同时锁定代理？\n确定：不生成新的令牌，在设置中发放新的客户端令牌或API密钥后解除锁定\n取消：立即生成新的令牌');
+    const input = prompt('请输入确认短语 ' + phrase + ' 以继续');
+    if (input === null) {
+        return;
+    }
+
+    fetch('/system/panic', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ confirm: input.trim(), disable_proxy: disableProxy })
+    })
+    .then(response => response.json().then(data => ({ ok: response.ok, data })))
+    .then(({ ok, data }) => {
+        if (!ok) {
+            showToast('轮换凭据失败: ' + (data.error || '未知错误'), 'error');
+            return;
+        }
+
+        const lines = ['已吊销 ' + data.revoked_client_tokens.length + ' 个客户端令牌'];
+        if (data.proxy_locked) {
+            lines.push('代理已锁定，发放新的客户端令牌或API密钥后解除');
+        }
+        const credentials = data.credentials || {};
+        if (credentials.client_token) lines.push('新客户端令牌: ' + credentials.client_token);
+        if (credentials.api_key) lines.push('新API密钥: ' + credentials.api_key);
+        if (credentials.metrics_token) lines.push('新/metrics访问令牌: ' + credentials.metrics_token);
+        if (credentials.status_feed_token) lines.push('新/status.json访问令牌: ' + credentials.status_feed_token);
+        (data.warnings || []).forEach(warning => lines.push('注意: ' + warning));
+        lines.push('', '新凭据只显示这一次，请立即保存。关闭后需要重新登录。');
+
+        alert(lines.join('\n'));
+        window.location.href = '/setting';
+    })
+    .catch(error => {
+        console.error('轮换凭据失败:', error);
+        showToast('轮换凭据失败: ' + error, 'error');
+    });
+}
+
 function showToast(message, type = 'info') {
     const toastContainer = document.getElementById('toast-container');
     
@@ -1,16 +1,134 @@
 /**
   @author: Hanhai
-  @desc: 嵌入式静态文件系统管理，提供读取和列出嵌入文件的功能
+  @desc: 嵌入式静态文件系统管理，提供读取和列出嵌入文件的功能，以及常用资源的统一访问
 **/
 
 package web
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flowsilicon/internal/logger"
 	"fmt"
 	"io"
 	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
 )
 
+// AssetName 常用静态资源名称
+type AssetName string
+
+// 常用静态资源
+const (
+	AssetTrayIcon32  AssetName = "tray_icon_32"  // 32x32系统托盘图标
+	AssetTrayIcon128 AssetName = "tray_icon_128" // 128x128系统托盘图标
+	AssetFavicon     AssetName = "favicon"       // 网站图标
+)
+
+// wellKnownAssets 常用资源名称与嵌入路径的对应关系
+var wellKnownAssets = map[AssetName]string{
+	AssetTrayIcon32:  "static/img/favicon_32.ico",
+	AssetTrayIcon128: "static/img/favicon_128.ico",
+	AssetFavicon:     "static/img/favicon_32.ico",
+}
+
+// AssetInfo 嵌入式资源信息
+type AssetInfo struct {
+	Path   string `json:"path"`   // 嵌入路径
+	Size   int    `json:"size"`   // 文件大小（字节）
+	SHA256 string `json:"sha256"` // 内容哈希
+}
+
+var (
+	// 物理文件系统中的资源覆盖目录，其中存在的文件优先于嵌入式资源
+	assetOverrideDir  string
+	assetOverrideLock sync.RWMutex
+)
+
+// SetAssetOverrideDir 设置物理文件系统中的资源覆盖目录，为空时只使用嵌入式资源
+// 目录结构与嵌入路径一致，如 dir/static/img/favicon_32.ico
+func SetAssetOverrideDir(dir string) {
+	assetOverrideLock.Lock()
+	defer assetOverrideLock.Unlock()
+	assetOverrideDir = dir
+}
+
+// GetAsset 获取常用静态资源内容
+// 覆盖目录中存在该文件时优先使用，否则从嵌入式文件系统读取
+func GetAsset(name AssetName) ([]byte, error) {
+	path, ok := wellKnownAssets[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的静态资源: %s", name)
+	}
+
+	assetOverrideLock.RLock()
+	overrideDir := assetOverrideDir
+	assetOverrideLock.RUnlock()
+
+	if overrideDir != "" {
+		physicalPath := filepath.Join(overrideDir, filepath.FromSlash(path))
+		data, err := os.ReadFile(physicalPath)
+		switch {
+		case err == nil && len(data) > 0:
+			return data, nil
+		case err == nil:
+			logger.Warn("覆盖资源文件 %s 内容为空，使用嵌入式资源", physicalPath)
+		case !errors.Is(err, fs.ErrNotExist):
+			logger.Warn("读取覆盖资源文件 %s 失败: %v，使用嵌入式资源", physicalPath, err)
+		}
+	}
+
+	data, err := GetEmbeddedFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("嵌入式文件 %s 内容为空", path)
+	}
+	return data, nil
+}
+
+// GetTrayIcon 获取系统托盘图标，32x32图标不可用时回退到128x128图标
+func GetTrayIcon() ([]byte, error) {
+	var lastErr error
+	for _, name := range []AssetName{AssetTrayIcon32, AssetTrayIcon128} {
+		data, err := GetAsset(name)
+		if err == nil {
+			return data, nil
+		}
+		logger.Warn("加载托盘图标 %s 失败: %v", name, err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// GetEmbeddedManifest 获取所有嵌入式静态资源的清单，包括大小和内容哈希
+func GetEmbeddedManifest() ([]AssetInfo, error) {
+	files, err := ListEmbeddedFiles("static")
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := make([]AssetInfo, 0, len(files))
+	for _, path := range files {
+		data, err := GetEmbeddedFile(path)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		manifest = append(manifest, AssetInfo{
+			Path:   path,
+			Size:   len(data),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	return manifest, nil
+}
+
 // GetEmbeddedFile 从嵌入式文件系统读取文件内容
 // 参数path是相对于嵌入根目录的路径，如 "static/img/favicon_32.ico"
 func GetEmbeddedFile(path string) ([]byte, error) {
@@ -0,0 +1,125 @@
+package web
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useAssetOverrideDir 临时设置资源覆盖目录，测试结束后恢复
+func useAssetOverrideDir(t *testing.T, dir string) {
+	t.Helper()
+	SetAssetOverrideDir(dir)
+	t.Cleanup(func() { SetAssetOverrideDir("") })
+}
+
+// 所有常用资源都能从嵌入式文件系统读取，内容与清单中的嵌入文件一致
+func TestWellKnownAssetsResolve(t *testing.T) {
+	useAssetOverrideDir(t, "")
+
+	for name, path := range wellKnownAssets {
+		data, err := GetAsset(name)
+		if err != nil {
+			t.Errorf("GetAsset(%s) 失败: %v", name, err)
+			continue
+		}
+		embedded, err := GetEmbeddedFile(path)
+		if err != nil {
+			t.Errorf("GetEmbeddedFile(%s) 失败: %v", path, err)
+			continue
+		}
+		if !bytes.Equal(data, embedded) {
+			t.Errorf("GetAsset(%s) returned %d bytes, want the embedded %s", name, len(data), path)
+		}
+	}
+
+	if _, err := GetTrayIcon(); err != nil {
+		t.Errorf("GetTrayIcon 失败: %v", err)
+	}
+
+	files, err := ListEmbeddedFiles("static")
+	if err != nil {
+		t.Fatalf("ListEmbeddedFiles 失败: %v", err)
+	}
+	listed := make(map[string]bool, len(files))
+	for _, file := range files {
+		listed[file] = true
+	}
+	for name, path := range wellKnownAssets {
+		if !listed[path] {
+			t.Errorf("%s (%s) is not in ListEmbeddedFiles", name, path)
+		}
+	}
+}
+
+// 覆盖目录中存在的文件优先于嵌入式资源，不存在或为空的文件使用嵌入式资源
+func TestAssetOverrideDir(t *testing.T) {
+	dir := t.TempDir()
+	iconPath := filepath.Join(dir, filepath.FromSlash(wellKnownAssets[AssetTrayIcon128]))
+	if err := os.MkdirAll(filepath.Dir(iconPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	override := []byte("override-icon")
+	if err := os.WriteFile(iconPath, override, 0644); err != nil {
+		t.Fatal(err)
+	}
+	emptyPath := filepath.Join(dir, filepath.FromSlash(wellKnownAssets[AssetTrayIcon32]))
+	if err := os.WriteFile(emptyPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	useAssetOverrideDir(t, dir)
+
+	data, err := GetAsset(AssetTrayIcon128)
+	if err != nil {
+		t.Fatalf("GetAsset 失败: %v", err)
+	}
+	if !bytes.Equal(data, override) {
+		t.Errorf("GetAsset(%s) = %q, want the override file", AssetTrayIcon128, data)
+	}
+
+	// 覆盖文件为空时使用嵌入式资源
+	embedded, _ := GetEmbeddedFile(wellKnownAssets[AssetTrayIcon32])
+	if data, err := GetAsset(AssetTrayIcon32); err != nil || !bytes.Equal(data, embedded) {
+		t.Errorf("GetAsset(%s) = %d bytes, %v, want the embedded file", AssetTrayIcon32, len(data), err)
+	}
+
+	// 覆盖目录中没有该文件时使用嵌入式资源
+	if err := os.Remove(iconPath); err != nil {
+		t.Fatal(err)
+	}
+	embedded, _ = GetEmbeddedFile(wellKnownAssets[AssetTrayIcon128])
+	if data, err := GetAsset(AssetTrayIcon128); err != nil || !bytes.Equal(data, embedded) {
+		t.Errorf("GetAsset(%s) = %d bytes, %v, want the embedded file", AssetTrayIcon128, len(data), err)
+	}
+}
+
+// 缺少的资源返回错误而不是panic
+func TestMissingAssetReturnsError(t *testing.T) {
+	useAssetOverrideDir(t, t.TempDir())
+
+	if _, err := GetAsset("unknown_asset"); err == nil {
+		t.Errorf("GetAsset(unknown_asset) returned no error")
+	}
+	if _, err := GetEmbeddedFile("static/img/missing.ico"); err == nil {
+		t.Errorf("GetEmbeddedFile(missing) returned no error")
+	}
+	if _, err := GetEmbeddedFile("static/img"); err == nil {
+		t.Errorf("GetEmbeddedFile(directory) returned no error")
+	}
+	if _, err := ListEmbeddedFiles("static/missing"); err == nil {
+		t.Errorf("ListEmbeddedFiles(missing) returned no error")
+	}
+
+	// 托盘图标的两个候选资源都不存在时返回错误
+	saved := wellKnownAssets
+	wellKnownAssets = map[AssetName]string{
+		AssetTrayIcon32:  "static/img/missing_32.ico",
+		AssetTrayIcon128: "static/img/missing_128.ico",
+	}
+	t.Cleanup(func() { wellKnownAssets = saved })
+
+	if data, err := GetTrayIcon(); err == nil {
+		t.Errorf("GetTrayIcon() = %d bytes, want an error", len(data))
+	}
+}
@@ -0,0 +1,199 @@
+/**
+  @author: Hanhai
+  @desc: 公开状态数据，外部状态页通过独立的令牌读取密钥池的粗略健康状况，只返回区间或取整后的汇总值，不返回密钥和请求内容
+**/
+
+package web
+
+import (
+	"crypto/subtle"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/key"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 计算上游健康状况的时间范围（秒）
+	statusFeedUpstreamSeconds = 5 * 60
+	// 错误率超过该值时上游视为degraded
+	statusFeedDegradedErrorRate = 0.1
+	// 错误率超过该值时上游视为down
+	statusFeedDownErrorRate = 0.5
+	// 未设置时每个IP每分钟最多请求数
+	defaultStatusFeedRateLimit = 60
+	// 未设置时允许缓存的时间（秒）
+	defaultStatusFeedCacheSeconds = 60
+	// 限流记录超过该数量时清理已过期的记录
+	statusFeedLimiterPruneSize = 1024
+)
+
+// 可用密钥数的区间下限，从大到小排列
+var statusFeedKeyBuckets = []int{100, 50, 25, 10, 5, 1}
+
+// 总余额的区间下限，从大到小排列
+var statusFeedBalanceBuckets = []float64{10000, 1000, 100, 10}
+
+var (
+	statusFeedLimiters     = make(map[string]*config.RateLimitWindow)
+	statusFeedLimiterMutex sync.Mutex
+)
+
+// allowStatusFeedRequest 按IP限制/status.json的请求频率
+func allowStatusFeedRequest(ip string, limit int) bool {
+	statusFeedLimiterMutex.Lock()
+	defer statusFeedLimiterMutex.Unlock()
+
+	if len(statusFeedLimiters) > statusFeedLimiterPruneSize {
+		for key, window := range statusFeedLimiters {
+			if window.Current() == 0 {
+				delete(statusFeedLimiters, key)
+			}
+		}
+	}
+
+	window, ok := statusFeedLimiters[ip]
+	if !ok {
+		window = &config.RateLimitWindow{}
+		statusFeedLimiters[ip] = window
+	}
+	window.Limit = limit
+	if window.Available() <= 0 {
+		return false
+	}
+	window.Add(1)
+	return true
+}
+
+// handleStatusFeed 返回公开状态数据，未开启或未设置令牌时返回404，不暴露该接口是否存在
+func handleStatusFeed(c *gin.Context) {
+	cfg := config.GetConfig()
+	if cfg == nil || !cfg.StatusFeed.Enabled || cfg.StatusFeed.Token == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not Found"})
+		return
+	}
+	feed := cfg.StatusFeed
+	if feed.RateLimitPerMinute <= 0 {
+		feed.RateLimitPerMinute = defaultStatusFeedRateLimit
+	}
+	if feed.CacheSeconds <= 0 {
+		feed.CacheSeconds = defaultStatusFeedCacheSeconds
+	}
+
+	// 先限流再检查令牌，避免猜测令牌
+	if !allowStatusFeedRequest(c.ClientIP(), feed.RateLimitPerMinute) {
+		c.Header("Retry-After", "60")
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "请求过于频繁，请稍后重试"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Query("token")), []byte(feed.Token)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的令牌"})
+		return
+	}
+
+	data := gin.H{
+		"updated_at": time.Now().Unix(),
+	}
+	pool := key.GetKeyPool()
+	usableKeys := config.GetKeyCount(config.KeyFilter{Status: config.KeyStatusActive})
+	if feed.IncludeService {
+		data["service"] = "up"
+	}
+	if feed.IncludeKeys {
+		data["usable_keys"] = bucketKeyCount(usableKeys)
+	}
+	if feed.IncludeBalance {
+		data["balance"] = describeTotalBalance(pool, feed.BalanceTarget)
+	}
+	if feed.IncludeRequests {
+		requests := 0
+		if stats, _ := config.GetDailyStats(""); stats != nil {
+			requests = stats.Requests.Total
+		}
+		data["requests_today"] = roundRequestCount(requests)
+	}
+	if feed.IncludeUpstream {
+		data["upstream"] = getUpstreamHealth(usableKeys)
+	}
+
+	// 令牌在查询参数中，CDN按完整地址缓存，不同令牌不会共享缓存
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d, s-maxage=%d", feed.CacheSeconds, feed.CacheSeconds))
+	c.Header("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	// 状态页是独立的静态网站，需要允许跨域读取
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.JSON(http.StatusOK, data)
+}
+
+// bucketKeyCount 将可用密钥数转换为区间，例如10+
+func bucketKeyCount(count int) string {
+	for _, bucket := range statusFeedKeyBuckets {
+		if count >= bucket {
+			return strconv.Itoa(bucket) + "+"
+		}
+	}
+	return "0"
+}
+
+// describeTotalBalance 获取未删除密钥的总余额，设置了目标值时返回按10%取整的百分比，否则返回区间
+func describeTotalBalance(pool key.KeyPoolSnapshot, target float64) string {
+	total := 0.0
+	for _, k := range pool.Keys() {
+		if k.Balance > 0 {
+			total += k.Balance
+		}
+	}
+
+	if target > 0 {
+		percent := math.Min(100, math.Floor(total/target*10)*10)
+		return fmt.Sprintf("%.0f%%", percent)
+	}
+	for _, bucket := range statusFeedBalanceBuckets {
+		if total >= bucket {
+			return fmt.Sprintf("%.0f+", bucket)
+		}
+	}
+	if total > 0 {
+		return "<10"
+	}
+	return "0"
+}
+
+// roundRequestCount 将请求数向下取整，小于100时取整到10，否则保留两位有效数字
+func roundRequestCount(count int) int {
+	if count < 100 {
+		return count / 10 * 10
+	}
+	unit := int(math.Pow10(int(math.Log10(float64(count))) - 1))
+	return count / unit * unit
+}
+
+// getUpstreamHealth 按最近5分钟代理请求的错误率判断上游健康状况，没有可用密钥时为down
+func getUpstreamHealth(usableKeys int) string {
+	if usableKeys == 0 {
+		return "down"
+	}
+	metrics := config.GetRealtimeMetrics(time.Now().Unix() - statusFeedUpstreamSeconds)
+	var requests, errors int64
+	for _, point := range metrics.Points {
+		requests += point.Requests
+		errors += point.Errors
+	}
+	if requests == 0 {
+		return "operational"
+	}
+	errorRate := float64(errors) / float64(requests)
+	switch {
+	case errorRate >= statusFeedDownErrorRate:
+		return "down"
+	case errorRate >= statusFeedDegradedErrorRate:
+		return "degraded"
+	default:
+		return "operational"
+	}
+}
@@ -0,0 +1,45 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"flowsilicon/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 健康检查不需要验证，任何验证方式下都不能返回安全设置
+func TestSystemHealthOmitsAuthMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Cleanup(func() { config.UpdateConfig(&config.Config{}) })
+
+	for _, mode := range []string{config.AuthModeNone, config.AuthModeAnyNonEmpty, config.AuthModeTokenList, config.AuthModeFixedSecret} {
+		t.Run(mode, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Security.AuthMode = mode
+			config.UpdateConfig(cfg)
+
+			router := gin.New()
+			router.GET("/system/health", handleSystemHealth)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/system/health", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := body["status"]; !ok {
+				t.Errorf("response has no status: %s", w.Body.String())
+			}
+			if value, ok := body["auth_mode"]; ok {
+				t.Errorf("response exposes auth_mode = %s", value)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+/**
+  @author: Hanhai
+  @desc: 凭据紧急轮换接口，确认短语匹配后吊销所有客户端令牌并更换各接口的凭据，新凭据只在响应中返回一次
+**/
+
+package web
+
+import (
+	"errors"
+	"flowsilicon/internal/config"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// panicConfirmPhrase 执行紧急轮换前需要输入的确认短语
+const panicConfirmPhrase = "ROTATE ALL CREDENTIALS"
+
+// systemPanicRequest 紧急轮换请求
+type systemPanicRequest struct {
+	Confirm      string `json:"confirm"`
+	DisableProxy bool   `json:"disable_proxy"`
+}
+
+// handleSystemPanic 紧急轮换所有对外暴露的凭据，不修改上游的API密钥
+func handleSystemPanic(c *gin.Context) {
+	var req systemPanicRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效请求: %v", err)})
+		return
+	}
+	if req.Confirm != panicConfirmPhrase {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "确认短语不正确，请输入 " + panicConfirmPhrase})
+		return
+	}
+
+	result, err := config.RotateAllCredentials(config.PanicOptions{DisableProxy: req.DisableProxy}, "web:"+c.ClientIP())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, config.ErrReadOnlyDatabase) || errors.Is(err, config.ErrMaintenanceMode) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 响应中包含新凭据，不允许缓存
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, result)
+}
+
+// handleGetSecurityAudit 获取最近的安全审计记录
+func handleGetSecurityAudit(c *gin.Context) {
+	records, err := config.GetSecurityAudit(100)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"records": records})
+}
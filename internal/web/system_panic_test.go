@@ -0,0 +1,173 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"flowsilicon/internal/auth"
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupPanicTest 初始化临时配置数据库，使用token_list验证方式和一个已发放的客户端令牌
+func setupPanicTest(t *testing.T) string {
+	t.Helper()
+	if err := config.InitConfigDB(t.TempDir() + "/config.db"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { config.CloseConfigDB() })
+
+	const oldToken = "sk-old-client-token"
+	cfg := &config.Config{}
+	cfg.Server.AllowedClientCIDRs = []string{"0.0.0.0/0", "::/0"}
+	cfg.Security.AuthMode = config.AuthModeTokenList
+	cfg.Security.ClientTokens = []string{oldToken}
+	cfg.Metrics.Token = "old-metrics-token"
+	config.UpdateConfig(cfg)
+	gin.SetMode(gin.TestMode)
+	return oldToken
+}
+
+// runPanic 调用紧急轮换接口并返回结果
+func runPanic(t *testing.T, disableProxy bool) config.PanicResult {
+	t.Helper()
+	router := gin.New()
+	router.POST("/system/panic", handleSystemPanic)
+	body, _ := json.Marshal(systemPanicRequest{Confirm: panicConfirmPhrase, DisableProxy: disableProxy})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/system/panic", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("panic returned %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Error("panic response must not be cached")
+	}
+	var result config.PanicResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// proxyAuthStatus 使用令牌请求经过代理锁定和API密钥验证的接口，返回状态码和错误类型
+func proxyAuthStatus(t *testing.T, token string) (int, string) {
+	t.Helper()
+	router := gin.New()
+	router.POST("/v1/chat/completions", middleware.ProxyLockMiddleware(), middleware.APIKeyMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code, errorType(w.Body.Bytes())
+}
+
+func errorType(body []byte) string {
+	var resp struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &resp)
+	return resp.Error.Type
+}
+
+func TestPanicRejectsOldTokensAndSessions(t *testing.T) {
+	oldToken := setupPanicTest(t)
+
+	cookie, err := auth.GenerateCookie(60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := auth.ParseCookie(cookie); !ok {
+		t.Fatal("session cookie should be valid before the panic")
+	}
+	if status, _ := proxyAuthStatus(t, oldToken); status != http.StatusOK {
+		t.Fatalf("old token should work before the panic, got %d", status)
+	}
+
+	result := runPanic(t, false)
+	if !result.SessionsInvalidated || !result.MetricsTokenRotated || len(result.RevokedClientTokens) != 1 {
+		t.Fatalf("unexpected panic result: %+v", result)
+	}
+	if result.Credentials == nil || result.Credentials.ClientToken == "" {
+		t.Fatal("panic should issue a new client token")
+	}
+
+	if ok, _ := auth.ParseCookie(cookie); ok {
+		t.Error("pre-panic session cookie must be rejected")
+	}
+	if status, kind := proxyAuthStatus(t, oldToken); status != http.StatusUnauthorized || kind != "token_revoked" {
+		t.Errorf("pre-panic token: got %d %q, want 401 token_revoked", status, kind)
+	}
+	if status, _ := proxyAuthStatus(t, result.Credentials.ClientToken); status != http.StatusOK {
+		t.Errorf("new token should work, got %d", status)
+	}
+	if config.GetConfig().Metrics.Token == "old-metrics-token" {
+		t.Error("metrics token should be rotated")
+	}
+
+	newCookie, err := auth.GenerateCookie(60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := auth.ParseCookie(newCookie); !ok {
+		t.Error("session issued after the panic should be valid")
+	}
+
+	records, err := config.GetSecurityAudit(10)
+	if err != nil || len(records) != 1 {
+		t.Errorf("expected one audit record, got %d (%v)", len(records), err)
+	}
+}
+
+func TestPanicProxyLock(t *testing.T) {
+	oldToken := setupPanicTest(t)
+
+	result := runPanic(t, true)
+	if !result.ProxyLocked || result.Credentials == nil || result.Credentials.ClientToken != "" {
+		t.Fatalf("locked panic should not issue a client token: %+v", result)
+	}
+	if !config.GetConfig().Security.ProxyLocked {
+		t.Fatal("proxy should be locked")
+	}
+
+	// 两条代理路由都在转发之前拒绝请求
+	router := gin.New()
+	SetupApiProxy(router)
+	for _, path := range []string{"/api/v1/chat/completions", "/v1/chat/completions"} {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(`{"model":"m"}`))
+		req.Header.Set("Authorization", "Bearer "+oldToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusServiceUnavailable || errorType(w.Body.Bytes()) != "proxy_locked" {
+			t.Errorf("%s while locked: got %d %s, want 503 proxy_locked", path, w.Code, w.Body.String())
+		}
+	}
+
+	// 保存设置时只有发放新的令牌才解除锁定
+	previous := config.GetConfig()
+	unchanged := previous.Clone()
+	if config.ReleaseProxyLock(previous, unchanged) || !unchanged.Security.ProxyLocked {
+		t.Error("saving without new credentials must keep the lock")
+	}
+	issued := previous.Clone()
+	issued.Security.ClientTokens = append(issued.Security.ClientTokens, "sk-new-client-token")
+	if !config.ReleaseProxyLock(previous, issued) || issued.Security.ProxyLocked {
+		t.Fatal("issuing a new client token should release the lock")
+	}
+	config.UpdateConfig(issued)
+
+	if status, _ := proxyAuthStatus(t, "sk-new-client-token"); status != http.StatusOK {
+		t.Errorf("new token after unlock: got %d, want 200", status)
+	}
+	if status, kind := proxyAuthStatus(t, oldToken); status != http.StatusUnauthorized || kind != "token_revoked" {
+		t.Errorf("pre-panic token after unlock: got %d %q, want 401 token_revoked", status, kind)
+	}
+}
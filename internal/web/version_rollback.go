@@ -0,0 +1,138 @@
+/**
+  @author: Hanhai
+  @desc: 数据目录版本号回滚，先获取一次性确认令牌再提交回滚，避免误操作
+**/
+
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"flowsilicon/internal/config"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 回滚确认令牌的有效期
+const versionRollbackTokenTTL = 5 * time.Minute
+
+var (
+	versionRollbackToken     string
+	versionRollbackExpiresAt time.Time
+	versionRollbackTokenLock sync.Mutex
+)
+
+// handleGetVersionRollback 返回当前版本、可回滚到的版本和版本历史，允许回滚时同时签发确认令牌
+func handleGetVersionRollback(c *gin.Context) {
+	cfg := config.GetConfig()
+	allowed := cfg.App.AllowVersionRollback && cfg.Security.PasswordEnabled
+
+	current, previous, err := config.GetPreviousVersion()
+	if err != nil && !errors.Is(err, config.ErrNoPreviousVersion) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	history, err := config.GetVersionHistory()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"allowed":          allowed,
+		"current_version":  current,
+		"previous_version": previous,
+		"history":          history,
+	}
+	if allowed && previous != "" {
+		token, err := newVersionRollbackToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成确认令牌失败"})
+			return
+		}
+		response["confirm_token"] = token
+		response["expires_in"] = int(versionRollbackTokenTTL.Seconds())
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleVersionRollback 校验确认令牌后将版本号回滚到上一个版本
+// 需要开启allow_version_rollback和管理密码，确认令牌只能使用一次
+func handleVersionRollback(c *gin.Context) {
+	cfg := config.GetConfig()
+	if !cfg.App.AllowVersionRollback {
+		c.JSON(http.StatusForbidden, gin.H{"error": config.ErrVersionRollbackDisabled.Error()})
+		return
+	}
+	if !cfg.Security.PasswordEnabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "版本回滚只允许管理员操作，请先开启密码保护"})
+		return
+	}
+
+	var req struct {
+		ConfirmToken string `json:"confirm_token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ConfirmToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少确认令牌，请先通过GET /system/version/rollback获取"})
+		return
+	}
+	if !consumeVersionRollbackToken(req.ConfirmToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "确认令牌无效或已过期"})
+		return
+	}
+
+	current, previous, err := config.GetPreviousVersion()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := config.RollbackVersion(); err != nil {
+		if errors.Is(err, config.ErrNoPreviousVersion) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "版本号已回滚，请退出当前程序后使用旧版本程序打开数据目录，重新启动当前版本会再次记录新版本号",
+		"from_version": current,
+		"to_version":   previous,
+	})
+}
+
+// newVersionRollbackToken 生成新的确认令牌，之前签发的令牌失效
+func newVersionRollbackToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	versionRollbackTokenLock.Lock()
+	defer versionRollbackTokenLock.Unlock()
+	versionRollbackToken = token
+	versionRollbackExpiresAt = time.Now().Add(versionRollbackTokenTTL)
+	return token, nil
+}
+
+// consumeVersionRollbackToken 校验并作废确认令牌
+func consumeVersionRollbackToken(token string) bool {
+	versionRollbackTokenLock.Lock()
+	defer versionRollbackTokenLock.Unlock()
+
+	if versionRollbackToken == "" || time.Now().After(versionRollbackExpiresAt) {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(versionRollbackToken)) != 1 {
+		return false
+	}
+	versionRollbackToken = ""
+	return true
+}
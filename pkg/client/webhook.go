@@ -0,0 +1,125 @@
+/**
+  @author: Hanhai
+  @desc: 流动硅基webhook通知的事件格式和签名校验，供接收通知的程序导入，不依赖internal下的包
+**/
+
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebhookSchemaVersion 当前的事件格式版本，字段只增加不修改，不兼容的修改会增加版本号
+const WebhookSchemaVersion = 1
+
+// webhook请求头
+const (
+	HeaderWebhookEvent     = "X-FlowSilicon-Event"     // 事件类型
+	HeaderWebhookDelivery  = "X-FlowSilicon-Delivery"  // 发送ID，重试时不变，用于去重
+	HeaderWebhookSignature = "X-FlowSilicon-Signature" // 签名，格式为 t=<Unix秒>,v1=<十六进制HMAC-SHA256>
+)
+
+// DefaultSignatureTolerance 校验签名时默认允许的时间差，超过时视为重放
+const DefaultSignatureTolerance = 5 * time.Minute
+
+// 签名校验失败的原因
+var (
+	ErrSignatureMissing = errors.New("缺少签名")
+	ErrSignatureInvalid = errors.New("签名不匹配")
+	ErrSignatureExpired = errors.New("签名时间超出允许范围")
+)
+
+// WebhookEnvelope webhook通知的事件信封
+type WebhookEnvelope struct {
+	ID            string       `json:"id"`             // 发送ID，与请求头中的X-FlowSilicon-Delivery相同
+	Type          string       `json:"type"`           // 事件类型
+	SchemaVersion int          `json:"schema_version"` // 事件格式版本
+	Timestamp     int64        `json:"timestamp"`      // 事件发生的时间（Unix秒）
+	InstanceID    string       `json:"instance_id"`    // 发送通知的流动硅基实例ID，同一个数据目录不变
+	Payload       EventPayload `json:"payload"`
+	// text字段兼容Slack等只读取text的webhook
+	Text string `json:"text"`
+}
+
+// EventPayload 事件内容，data的字段见/system/notifications/schema
+type EventPayload struct {
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// ParseWebhookEnvelope 解析webhook请求体，不校验签名
+func ParseWebhookEnvelope(body []byte) (WebhookEnvelope, error) {
+	var envelope WebhookEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return envelope, fmt.Errorf("解析事件失败: %w", err)
+	}
+	if envelope.Type == "" || envelope.SchemaVersion <= 0 {
+		return envelope, errors.New("不是流动硅基的事件格式")
+	}
+	return envelope, nil
+}
+
+// SignWebhook 计算请求体的签名，返回X-FlowSilicon-Signature请求头的值
+// 签名内容为 "<Unix秒>.<请求体>"，使用webhook的密钥计算HMAC-SHA256
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + ts + ",v1=" + webhookSignature(secret, ts, body)
+}
+
+// VerifyWebhookSignature 校验X-FlowSilicon-Signature请求头，tolerance为允许的时间差，0表示使用默认值
+func VerifyWebhookSignature(secret string, header string, body []byte, tolerance time.Duration) error {
+	if tolerance <= 0 {
+		tolerance = DefaultSignatureTolerance
+	}
+
+	var ts string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch name {
+		case "t":
+			ts = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if ts == "" || len(signatures) == 0 {
+		return ErrSignatureMissing
+	}
+
+	seconds, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	if diff := time.Since(time.Unix(seconds, 0)); diff > tolerance || diff < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	expected := webhookSignature(secret, ts, body)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrSignatureInvalid
+}
+
+// webhookSignature 计算签名的十六进制HMAC-SHA256
+func webhookSignature(secret string, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
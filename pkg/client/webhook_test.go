@@ -0,0 +1,72 @@
+package client
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// SignWebhook 的签名内容为 "<Unix秒>.<请求体>"，与接收方文档中的计算方式一致
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"type":"key_disabled"}`)
+	got := SignWebhook("webhook-secret", time.Unix(1700000000, 0), body)
+	want := "t=1700000000,v1=ef1875031723878a30a9db84340f33eb50045f79808654f882464e04ca450b44"
+	if got != want {
+		t.Errorf("SignWebhook = %q, want %q", got, want)
+	}
+}
+
+// 签名后的请求体能通过校验，请求体、密钥或时间不符时返回对应的错误
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte(`{"id":"delivery-1","type":"key_disabled","schema_version":1}`)
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name      string
+		header    string
+		body      []byte
+		secret    string
+		tolerance time.Duration
+		wantErr   error
+	}{
+		{name: "签名正确", header: SignWebhook("secret", now, body)},
+		{name: "请求体被修改", header: SignWebhook("secret", now, body), body: []byte(`{"id":"delivery-1","type":"key_enabled","schema_version":1}`), wantErr: ErrSignatureInvalid},
+		{name: "密钥不同", header: SignWebhook("secret", now, body), secret: "wrong-secret", wantErr: ErrSignatureInvalid},
+		{name: "超过默认时间差", header: SignWebhook("secret", now.Add(-10*time.Minute), body), wantErr: ErrSignatureExpired},
+		{name: "在指定时间差内", header: SignWebhook("secret", now.Add(-10*time.Minute), body), tolerance: time.Hour},
+		{name: "超过指定时间差", header: SignWebhook("secret", now.Add(-2*time.Minute), body), tolerance: time.Minute, wantErr: ErrSignatureExpired},
+		{name: "时间在未来", header: SignWebhook("secret", now.Add(10*time.Minute), body), wantErr: ErrSignatureExpired},
+		// 更换密钥期间请求头中可以有多个v1签名，任意一个匹配即可
+		{name: "多个签名", header: SignWebhook("old-secret", now, body) + ",v1=" + webhookSignature("secret", ts, body)},
+		{name: "空请求头", header: "", wantErr: ErrSignatureMissing},
+		{name: "格式错误", header: "garbage", wantErr: ErrSignatureMissing},
+		{name: "缺少时间", header: "v1=ef1875031723878a30a9db84340f33eb50045f79808654f882464e04ca450b44", wantErr: ErrSignatureMissing},
+		{name: "缺少签名", header: "t=" + ts, wantErr: ErrSignatureMissing},
+		{name: "时间不是数字", header: "t=yesterday,v1=ef1875031723878a30a9db84340f33eb50045f79808654f882464e04ca450b44", wantErr: ErrSignatureInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifyBody, secret := body, "secret"
+			if tt.body != nil {
+				verifyBody = tt.body
+			}
+			if tt.secret != "" {
+				secret = tt.secret
+			}
+
+			err := VerifyWebhookSignature(secret, tt.header, verifyBody, tt.tolerance)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("VerifyWebhookSignature(%q) 失败: %v", tt.header, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyWebhookSignature(%q) error = %v, want %v", tt.header, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package flowsilicon_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"flowsilicon/internal/config"
+	"flowsilicon/internal/logger"
+	"flowsilicon/internal/mockupstream"
+	"flowsilicon/pkg/flowsilicon"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 把流动硅基挂载到已有Gin服务的/flowsilicon分组下，通过挂载后的地址向模拟上游发送聊天请求
+func ExampleMount() {
+	// 日志只写入文件，不影响示例的输出
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	logger.SetGuiMode(true)
+
+	upstream := httptest.NewServer(mockupstream.NewServer().Handler())
+	defer upstream.Close()
+
+	dataDir, err := os.MkdirTemp("", "flowsilicon-example")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dataDir)
+
+	engine := gin.New()
+	engine.GET("/healthz", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	shutdowner, err := flowsilicon.Mount(engine.Group("/flowsilicon"), flowsilicon.Options{
+		DataDir:     dataDir,
+		UpstreamURL: upstream.URL,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer shutdowner.Shutdown(context.Background())
+
+	// 示例中直接添加密钥，实际使用时通过管理页面或/keys接口添加
+	config.AddApiKey("sk-example", mockupstream.DefaultBalance)
+
+	body := `{"model":"Qwen/Qwen2.5-7B-Instruct","messages":[{"role":"user","content":"hello"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/flowsilicon/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "127.0.0.1:51234"
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	var resp struct {
+		Object string `json:"object"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	fmt.Println(rec.Code, resp.Object)
+
+	// 分组之外的路由不受影响
+	rec = httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	fmt.Println(rec.Code, rec.Body.String())
+
+	// 一个进程只能初始化一次服务
+	_, err = flowsilicon.Mount(engine.Group("/another"), flowsilicon.Options{DataDir: dataDir})
+	fmt.Println(errors.Is(err, flowsilicon.ErrAlreadyInitialized))
+
+	// Output:
+	// 200 chat.completion
+	// 200 ok
+	// true
+}
@@ -0,0 +1,45 @@
+/**
+  @author: Hanhai
+  @desc: 供其他Go程序嵌入流动硅基服务的公开接口，internal下的包无法在本模块外导入
+**/
+
+package flowsilicon
+
+import (
+	"net/http"
+
+	"flowsilicon/internal/web"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Options 服务初始化参数，见web.Options
+type Options = web.Options
+
+// Shutdowner 关闭服务，见web.Shutdowner
+type Shutdowner = web.Shutdowner
+
+// ErrAlreadyInitialized 进程中已经初始化过服务时NewHandler和Mount返回的错误
+var ErrAlreadyInitialized = web.ErrAlreadyInitialized
+
+// NewHandler 初始化流动硅基服务并返回处理所有页面和API请求的http.Handler
+// 服务状态保存在包级变量中，一个进程只能初始化一次，再次调用NewHandler或Mount时返回ErrAlreadyInitialized，
+// Shutdown之后也不能在同一个进程中重新初始化；日志写入当前工作目录下的logs目录
+//
+// 挂载到已有的Gin服务的子路径下使用Mount
+func NewHandler(opts Options) (http.Handler, Shutdowner, error) {
+	return web.NewHandler(opts)
+}
+
+// Mount 初始化流动硅基服务并挂载到已有的Gin路由或路由分组下，分组的路径前缀在处理请求前去除
+// 与NewHandler共用同一个进程内的服务状态，只能调用其中一个，且只能调用一次
+// 代理接口可以挂载在任意子路径下，管理页面需要挂载在根路径，见example_test.go
+//
+//	shutdowner, err := flowsilicon.Mount(engine.Group("/flowsilicon"), flowsilicon.Options{DataDir: "/var/lib/flowsilicon"})
+//	if err != nil {
+//		return err
+//	}
+//	defer shutdowner.Shutdown(context.Background())
+func Mount(router gin.IRouter, opts Options) (Shutdowner, error) {
+	return web.Mount(router, opts)
+}
@@ -84,7 +84,7 @@ func CreateClientWithTimeout(timeout time.Duration) *http.Client {
 	// 创建并返回客户端
 	return &http.Client{
 		Timeout:   timeout,
-		Transport: transport,
+		Transport: withClockSkewDetection(transport),
 	}
 }
 
@@ -135,7 +135,7 @@ func CreateInferenceModelClient(requestTimeout time.Duration) *http.Client {
 	}
 
 	return &http.Client{
-		Transport: transport,
+		Transport: withClockSkewDetection(transport),
 		// 客户端总超时设置的略大于上下文超时，让上下文控制主要超时行为
 		Timeout: requestTimeout + 30*time.Second,
 	}
@@ -159,7 +159,7 @@ func CreateStandardModelClient(requestTimeout time.Duration) *http.Client {
 	}
 
 	return &http.Client{
-		Transport: transport,
+		Transport: withClockSkewDetection(transport),
 		// 客户端总超时设置的略大于上下文超时，让上下文控制主要超时行为
 		Timeout: requestTimeout + 10*time.Second,
 	}
@@ -0,0 +1,166 @@
+/**
+  @author: Hanhai
+  @desc: 系统时钟偏差检测，通过上游响应的Date头判断本机时间是否准确
+**/
+
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flowsilicon/internal/logger"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 时钟偏差超过该值时发出警告
+	clockSkewThreshold = 5 * time.Minute
+	// 两次主动探测之间的最小间隔
+	clockSkewProbeInterval = time.Minute
+)
+
+// ClockSkewStatus 时钟偏差检测状态
+type ClockSkewStatus struct {
+	Warning     bool    `json:"warning"`      // 是否存在时钟偏差警告
+	SkewSeconds float64 `json:"skew_seconds"` // 本机时间减去上游时间的秒数
+	CheckedAt   string  `json:"checked_at"`   // 最后一次检测时间
+	Message     string  `json:"message"`      // 警告信息
+}
+
+var (
+	clockSkewMutex     sync.RWMutex
+	clockSkewWarning   bool
+	clockSkewValue     time.Duration
+	clockSkewCheckedAt time.Time
+	clockSkewLastProbe time.Time
+)
+
+// clockSkewTransport 记录上游响应Date头的Transport包装
+type clockSkewTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip 发送请求并根据响应的Date头更新时钟偏差状态
+func (t *clockSkewTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp != nil {
+		ObserveServerDate(resp.Header)
+	}
+	return resp, err
+}
+
+// withClockSkewDetection 为Transport添加时钟偏差检测
+func withClockSkewDetection(base http.RoundTripper) http.RoundTripper {
+	return &clockSkewTransport{base: base}
+}
+
+// ObserveServerDate 根据上游响应的Date头更新时钟偏差状态
+func ObserveServerDate(header http.Header) {
+	dateValue := header.Get("Date")
+	if dateValue == "" {
+		return
+	}
+
+	serverTime, err := http.ParseTime(dateValue)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	skew := now.Sub(serverTime)
+	skewed := skew > clockSkewThreshold || skew < -clockSkewThreshold
+
+	clockSkewMutex.Lock()
+	wasSkewed := clockSkewWarning
+	clockSkewWarning = skewed
+	clockSkewValue = skew
+	clockSkewCheckedAt = now
+	clockSkewMutex.Unlock()
+
+	if skewed && !wasSkewed {
+		logger.Error("系统时钟异常: 本机时间与上游服务器相差 %v，TLS证书校验和上游认证可能失败，请校正系统时间", skew.Round(time.Second))
+	} else if !skewed && wasSkewed {
+		logger.Info("系统时钟已恢复正常，与上游服务器相差 %v", skew.Round(time.Second))
+	}
+}
+
+// IsClockSkewed 检查当前是否存在时钟偏差警告
+func IsClockSkewed() bool {
+	clockSkewMutex.RLock()
+	defer clockSkewMutex.RUnlock()
+	return clockSkewWarning
+}
+
+// GetClockSkewStatus 获取时钟偏差检测状态
+func GetClockSkewStatus() ClockSkewStatus {
+	clockSkewMutex.RLock()
+	defer clockSkewMutex.RUnlock()
+
+	status := ClockSkewStatus{
+		Warning:     clockSkewWarning,
+		SkewSeconds: clockSkewValue.Seconds(),
+	}
+	if !clockSkewCheckedAt.IsZero() {
+		status.CheckedAt = clockSkewCheckedAt.Format(time.RFC3339)
+	}
+	if clockSkewWarning {
+		status.Message = fmt.Sprintf("系统时钟与上游服务器相差 %v，请校正本机时间，否则TLS证书校验和上游认证会失败", clockSkewValue.Round(time.Second))
+	}
+	return status
+}
+
+// IsCertificateError 检查错误是否是TLS证书校验失败
+func IsCertificateError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var verifyErr *tls.CertificateVerificationError
+	var invalidErr x509.CertificateInvalidError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &verifyErr) || errors.As(err, &invalidErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "x509:")
+}
+
+// ProbeClockSkew 跳过证书校验请求上游地址，仅用于读取Date头检测时钟偏差
+// 证书校验失败时无法获得正常响应，需要通过该方式确认是否是本机时钟问题
+func ProbeClockSkew(targetURL string) {
+	clockSkewMutex.Lock()
+	if time.Since(clockSkewLastProbe) < clockSkewProbeInterval {
+		clockSkewMutex.Unlock()
+		return
+	}
+	clockSkewLastProbe = time.Now()
+	clockSkewMutex.Unlock()
+
+	client := CreateClientWithTimeout(10 * time.Second)
+	if wrapped, ok := client.Transport.(*clockSkewTransport); ok {
+		if transport, ok := wrapped.base.(*http.Transport); ok {
+			// 探测请求不携带任何凭据，只读取响应头
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodHead, targetURL, nil)
+	if err != nil {
+		logger.Error("创建时钟偏差探测请求失败: %v", err)
+		return
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Warn("时钟偏差探测请求失败: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
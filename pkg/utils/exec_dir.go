@@ -0,0 +1,57 @@
+/**
+  @author: Hanhai
+  @desc: 程序目录检查，启动时检查程序所在目录是否位于临时目录、是否可写以及是否位于网络文件系统
+**/
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ValidateExecutableDir 检查程序所在目录，返回需要在启动时提示的警告
+// 日志和数据库都写在程序目录下，目录位于临时目录、不可写或位于网络文件系统时写入可能失败或丢失
+func ValidateExecutableDir(dir string) []string {
+	var warnings []string
+
+	resolved := dir
+	if path, err := filepath.EvalSymlinks(dir); err == nil {
+		resolved = path
+	}
+
+	if tempDir, ok := containingTempDir(resolved); ok {
+		warnings = append(warnings, fmt.Sprintf("程序目录 %s 位于临时目录 %s 下，系统清理临时目录时日志和数据库可能被删除", dir, tempDir))
+	}
+
+	if file, err := os.CreateTemp(resolved, ".flowsilicon-write-check-*"); err != nil {
+		warnings = append(warnings, fmt.Sprintf("程序目录 %s 不可写（%v），日志和数据库将无法保存", dir, err))
+	} else {
+		name := file.Name()
+		file.Close()
+		os.Remove(name)
+	}
+
+	if fsType, ok := networkFilesystemType(resolved); ok {
+		warnings = append(warnings, fmt.Sprintf("程序目录 %s 位于网络文件系统（%s）上，数据库文件锁可能不可靠", dir, fsType))
+	}
+
+	return warnings
+}
+
+// containingTempDir 检查目录是否位于系统临时目录或/tmp下，返回所在的临时目录
+func containingTempDir(dir string) (string, bool) {
+	candidates := []string{os.TempDir(), "/tmp", "/var/tmp"}
+	for _, tempDir := range candidates {
+		if resolved, err := filepath.EvalSymlinks(tempDir); err == nil {
+			tempDir = resolved
+		}
+		tempDir = filepath.Clean(tempDir)
+		if dir == tempDir || strings.HasPrefix(dir, tempDir+string(filepath.Separator)) {
+			return tempDir, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,37 @@
+//go:build linux
+// +build linux
+
+/**
+  @author: Hanhai
+  @desc: Linux平台的文件系统类型检测，通过statfs识别网络文件系统
+**/
+
+package utils
+
+import (
+	"syscall"
+)
+
+// 常见网络文件系统的statfs类型编号
+var networkFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517B:     "smb",
+	0xFF534D42: "cifs",
+	0xFE534D42: "smb2",
+	0x00C36400: "ceph",
+	0x5346414F: "afs",
+	0x01021997: "9p",
+	0x0BD00BD0: "lustre",
+	0x01161970: "gfs2",
+}
+
+// networkFilesystemType 检查目录是否位于网络文件系统上，返回文件系统名称
+func networkFilesystemType(dir string) (string, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return "", false
+	}
+	// 不同架构上Type的类型和符号不同，按低32位比较
+	name, ok := networkFilesystems[uint32(stat.Type)]
+	return name, ok
+}
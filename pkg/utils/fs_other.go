@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+/**
+  @author: Hanhai
+  @desc: 非Linux平台的文件系统类型检测存根，不检测网络文件系统
+**/
+
+package utils
+
+// networkFilesystemType 在非Linux平台上的空实现
+func networkFilesystemType(dir string) (string, bool) {
+	return "", false
+}
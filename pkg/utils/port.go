@@ -0,0 +1,35 @@
+/**
+  @author: Hanhai
+  @desc: 端口检测工具，启动时检查端口是否被占用并查找可用端口
+**/
+
+package utils
+
+import (
+	"fmt"
+	"net"
+)
+
+// 首选端口被占用时最多向后尝试的端口数
+const portFallbackRange = 10
+
+// IsPortAvailable 检查端口是否可以监听
+func IsPortAvailable(port int) bool {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	_ = listener.Close()
+	return true
+}
+
+// FindAvailablePort 检查首选端口是否可用，被占用时依次尝试preferred+1到preferred+10
+// 全部被占用时返回首选端口，由后续启动服务时报告错误
+func FindAvailablePort(preferred int) int {
+	for port := preferred; port <= preferred+portFallbackRange && port <= 65535; port++ {
+		if IsPortAvailable(port) {
+			return port
+		}
+	}
+	return preferred
+}